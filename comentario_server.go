@@ -29,6 +29,19 @@ var (
 //go:embed resources/i18n/*.yaml
 var i18nFS embed.FS // Translations
 
+// fileCommand is a command-line command that takes a single file argument
+type fileCommand struct {
+	Args struct {
+		File string `positional-arg-name:"FILE" description:"Archive file"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+// Maintenance commands, which are run instead of serving the API
+var (
+	backupCmd  fileCommand
+	restoreCmd fileCommand
+)
+
 func main() {
 	// Init the version service
 	svc.TheVersionService.Init(version, date)
@@ -45,7 +58,8 @@ func main() {
 	defer util.LogError(server.Shutdown, "server.Shutdown()")
 
 	// Configure command-line options
-	if err := parseCLI(apiInstance, server, swaggerSpec.Spec().Info.Description); err != nil {
+	cmd, err := parseCLI(apiInstance, server, swaggerSpec.Spec().Info.Description)
+	if err != nil {
 		logger.Fatalf("Failed to post-process configuration: %v", err)
 	}
 
@@ -58,6 +72,12 @@ func main() {
 		logger.Fatalf("Failed to init plugin manager: %v", err)
 	}
 
+	// If a maintenance command is given, run it and exit
+	if cmd != "" {
+		runCommand(cmd)
+		return
+	}
+
 	// Configure the API
 	server.ConfigureAPI()
 
@@ -70,11 +90,12 @@ func main() {
 	}
 }
 
-// parseCLI parses the command-line flags
-func parseCLI(api *operations.ComentarioAPI, server *restapi.Server, desc string) error {
+// parseCLI parses the command-line flags, returning the name of the given command, if any
+func parseCLI(api *operations.ComentarioAPI, server *restapi.Server, desc string) (string, error) {
 	parser := flags.NewParser(server, flags.Default)
 	parser.ShortDescription = util.ApplicationName
 	parser.LongDescription = desc
+	parser.SubcommandsOptional = true
 	server.ConfigureFlags()
 	for _, optsGroup := range api.CommandLineOptionsGroups {
 		_, err := parser.AddGroup(optsGroup.ShortDescription, optsGroup.LongDescription, optsGroup.Options)
@@ -83,6 +104,24 @@ func parseCLI(api *operations.ComentarioAPI, server *restapi.Server, desc string
 		}
 	}
 
+	// Add maintenance commands
+	if _, err := parser.AddCommand(
+		"backup",
+		"Back up the instance",
+		"Write all instance data into a compressed archive file and exit",
+		&backupCmd,
+	); err != nil {
+		logger.Fatal(err)
+	}
+	if _, err := parser.AddCommand(
+		"restore",
+		"Restore the instance from a backup",
+		"Load all instance data from an archive file made with the backup command into an empty database and exit",
+		&restoreCmd,
+	); err != nil {
+		logger.Fatal(err)
+	}
+
 	// Parse the command line
 	if _, err := parser.Parse(); err != nil {
 		code := 1
@@ -99,7 +138,29 @@ func parseCLI(api *operations.ComentarioAPI, server *restapi.Server, desc string
 	setupLogging()
 
 	// Post-process the config
-	return config.PostProcess()
+	cmd := ""
+	if parser.Active != nil {
+		cmd = parser.Active.Name
+	}
+	return cmd, config.PostProcess()
+}
+
+// runCommand initialises the services and runs the maintenance command with the given name
+func runCommand(cmd string) {
+	svc.TheServiceManager.Initialise()
+	defer svc.TheServiceManager.Shutdown()
+
+	var err error
+	switch cmd {
+	case "backup":
+		err = svc.TheBackupService.Backup(backupCmd.Args.File)
+	case "restore":
+		err = svc.TheBackupService.Restore(restoreCmd.Args.File)
+	}
+	if err != nil {
+		svc.TheServiceManager.Shutdown()
+		logger.Fatalf("Command %s failed: %v", cmd, err)
+	}
 }
 
 // setupLogging set the correct logging level and format
@@ -75,7 +75,7 @@ context('Config Manager', () => {
                 ['Live update enabled',                     '✔'],
                 ['Page view statistics enabled',            '✔'],
                 ['Available UI languages',                  Object.entries(UI_LANGUAGES).map(([k, v]) => k+v)],
-                ['Enabled extensions',                      ['Akismet', 'APILayer SpamChecker', 'Perspective']],
+                ['Enabled extensions',                      ['Akismet', 'APILayer SpamChecker', 'Local rules', 'Perspective']],
             ]);
 
             // Check clickable links
@@ -142,6 +142,7 @@ context('Config Manager', () => {
                     ['New commenters must confirm their email',             ''],
                     ['New users must confirm their email',                  '✔'],
                     ['Enable registration of new users',                    '✔'],
+                    ['Require two-factor authentication for domain owners', ''],
                     ['Enable commenter registration via external provider', '✔'],
                     ['Enable local commenter registration',                 '✔'],
                     ['Enable commenter registration via SSO',               '✔'],
@@ -150,7 +151,14 @@ context('Config Manager', () => {
                     ['Allow moderators to delete comments',                 '✔'],
                     ['Allow comment authors to edit comments',              '✔'],
                     ['Allow moderators to edit comments',                   '✔'],
+                    ['Re-moderate comments changed on edit by (%)',         '0'],
                     ['Enable voting on comments',                           '✔'],
+                    ['Allow unregistered users to flag comments',           ''],
+                    ['Allow users to flag comments',                        '✔'],
+                    ['Flags needed to send a comment to moderation',        '3'],
+                    ['Max. comments per minute from an IP address',         '0'],
+                    ['Max. comments per minute on a page',                  '0'],
+                    ['Max. comments per minute by a user',                  '0'],
                     ['Enable comment RSS feeds',                            '✔'],
                     ['Show deleted comments',                               '✔'],
                     ['Maximum comment text length',                         '1,024'],
@@ -216,6 +224,7 @@ context('Config Manager', () => {
                     ['New commenters must confirm their email',             '✔'],
                     ['New users must confirm their email',                  ''],
                     ['Enable registration of new users',                    ''],
+                    ['Require two-factor authentication for domain owners', ''],
                     ['Enable commenter registration via external provider', ''],
                     ['Enable local commenter registration',                 '✔'],
                     ['Enable commenter registration via SSO',               ''],
@@ -224,7 +233,14 @@ context('Config Manager', () => {
                     ['Allow moderators to delete comments',                 ''],
                     ['Allow comment authors to edit comments',              ''],
                     ['Allow moderators to edit comments',                   ''],
+                    ['Re-moderate comments changed on edit by (%)',         '0'],
                     ['Enable voting on comments',                           ''],
+                    ['Allow unregistered users to flag comments',           ''],
+                    ['Allow users to flag comments',                        '✔'],
+                    ['Flags needed to send a comment to moderation',        '3'],
+                    ['Max. comments per minute from an IP address',         '0'],
+                    ['Max. comments per minute on a page',                  '0'],
+                    ['Max. comments per minute by a user',                  '0'],
                     ['Enable comment RSS feeds',                            ''],
                     ['Show deleted comments',                               '✔'],
                     ['Maximum comment text length',                         '876'],
@@ -249,6 +265,7 @@ context('Config Manager', () => {
                     ['New commenters must confirm their email',             '✔'],
                     ['New users must confirm their email',                  '✔'],
                     ['Enable registration of new users',                    '✔'],
+                    ['Require two-factor authentication for domain owners', ''],
                     ['Enable commenter registration via external provider', '✔'],
                     ['Enable local commenter registration',                 '✔'],
                     ['Enable commenter registration via SSO',               '✔'],
@@ -257,7 +274,14 @@ context('Config Manager', () => {
                     ['Allow moderators to delete comments',                 '✔'],
                     ['Allow comment authors to edit comments',              '✔'],
                     ['Allow moderators to edit comments',                   '✔'],
+                    ['Re-moderate comments changed on edit by (%)',         '0'],
                     ['Enable voting on comments',                           '✔'],
+                    ['Allow unregistered users to flag comments',           ''],
+                    ['Allow users to flag comments',                        '✔'],
+                    ['Flags needed to send a comment to moderation',        '3'],
+                    ['Max. comments per minute from an IP address',         '0'],
+                    ['Max. comments per minute on a page',                  '0'],
+                    ['Max. comments per minute by a user',                  '0'],
                     ['Enable comment RSS feeds',                            '✔'],
                     ['Show deleted comments',                               '✔'],
                     ['Maximum comment text length',                         '4,096'],
@@ -305,6 +329,7 @@ context('Config Manager', () => {
                     ['New commenters must confirm their email',             ''],
                     ['New users must confirm their email',                  ''],
                     ['Enable registration of new users',                    ''],
+                    ['Require two-factor authentication for domain owners', ''],
                     ['Enable commenter registration via external provider', ''],
                     ['Enable local commenter registration',                 ''],
                     ['Enable commenter registration via SSO',               ''],
@@ -313,7 +338,14 @@ context('Config Manager', () => {
                     ['Allow moderators to delete comments',                 '✔'],
                     ['Allow comment authors to edit comments',              '✔'],
                     ['Allow moderators to edit comments',                   ''],
+                    ['Re-moderate comments changed on edit by (%)',         '0'],
                     ['Enable voting on comments',                           ''],
+                    ['Allow unregistered users to flag comments',           ''],
+                    ['Allow users to flag comments',                        '✔'],
+                    ['Flags needed to send a comment to moderation',        '3'],
+                    ['Max. comments per minute from an IP address',         '0'],
+                    ['Max. comments per minute on a page',                  '0'],
+                    ['Max. comments per minute by a user',                  '0'],
                     ['Enable comment RSS feeds',                            ''],
                     ['Show deleted comments',                               ''],
                     ['Maximum comment text length',                         '516'],
@@ -368,7 +368,14 @@ context('Domain Edit page', () => {
                         ['Allow moderators to delete comments',                 '✔'],
                         ['Allow comment authors to edit comments',              '✔'],
                         ['Allow moderators to edit comments',                   '✔'],
+                        ['Re-moderate comments changed on edit by (%)',         '0'],
                         ['Enable voting on comments',                           '✔'],
+                        ['Allow unregistered users to flag comments',           ''],
+                        ['Allow users to flag comments',                        '✔'],
+                        ['Flags needed to send a comment to moderation',        '3'],
+                        ['Max. comments per minute from an IP address',         '0'],
+                        ['Max. comments per minute on a page',                  '0'],
+                        ['Max. comments per minute by a user',                  '0'],
                         ['Enable comment RSS feeds',                            '✔'],
                         ['Show deleted comments',                               '✔'],
                         ['Maximum comment text length',                         '1,024'],
@@ -494,7 +501,14 @@ context('Domain Edit page', () => {
                         ['Allow moderators to delete comments',                 ''],
                         ['Allow comment authors to edit comments',              ''],
                         ['Allow moderators to edit comments',                   ''],
+                        ['Re-moderate comments changed on edit by (%)',         '0'],
                         ['Enable voting on comments',                           ''],
+                        ['Allow unregistered users to flag comments',           ''],
+                        ['Allow users to flag comments',                        '✔'],
+                        ['Flags needed to send a comment to moderation',        '3'],
+                        ['Max. comments per minute from an IP address',         '0'],
+                        ['Max. comments per minute on a page',                  '0'],
+                        ['Max. comments per minute by a user',                  '0'],
                         ['Enable comment RSS feeds',                            ''],
                         ['Show deleted comments',                               ''],
                         ['Maximum comment text length',                         '8,987'],
@@ -735,7 +749,14 @@ context('Domain Edit page', () => {
                         ['Allow moderators to delete comments',                 ''],
                         ['Allow comment authors to edit comments',              ''],
                         ['Allow moderators to edit comments',                   ''],
+                        ['Re-moderate comments changed on edit by (%)',         '0'],
                         ['Enable voting on comments',                           ''],
+                        ['Allow unregistered users to flag comments',           ''],
+                        ['Allow users to flag comments',                        '✔'],
+                        ['Flags needed to send a comment to moderation',        '3'],
+                        ['Max. comments per minute from an IP address',         '0'],
+                        ['Max. comments per minute on a page',                  '0'],
+                        ['Max. comments per minute by a user',                  '0'],
                         ['Enable comment RSS feeds',                            ''],
                         ['Show deleted comments',                               ''],
                         ['Maximum comment text length',                         '123,456'],
@@ -60,7 +60,14 @@ context('Domain Properties page', () => {
                 ['Allow moderators to delete comments',                 '✔'],
                 ['Allow comment authors to edit comments',              '✔'],
                 ['Allow moderators to edit comments',                   '✔'],
+                ['Re-moderate comments changed on edit by (%)',         '0'],
                 ['Enable voting on comments',                           '✔'],
+                ['Allow unregistered users to flag comments',           ''],
+                ['Allow users to flag comments',                        '✔'],
+                ['Flags needed to send a comment to moderation',        '3'],
+                ['Max. comments per minute from an IP address',         '0'],
+                ['Max. comments per minute on a page',                  '0'],
+                ['Max. comments per minute by a user',                  '0'],
                 ['Enable comment RSS feeds',                            '✔'],
                 ['Show deleted comments',                               '✔'],
                 ['Maximum comment text length',                         '4,096'],
@@ -132,7 +139,14 @@ context('Domain Properties page', () => {
                 ['Allow moderators to delete comments',                 '✔'],
                 ['Allow comment authors to edit comments',              '✔'],
                 ['Allow moderators to edit comments',                   '✔'],
+                ['Re-moderate comments changed on edit by (%)',         '0'],
                 ['Enable voting on comments',                           '✔'],
+                ['Allow unregistered users to flag comments',           ''],
+                ['Allow users to flag comments',                        '✔'],
+                ['Flags needed to send a comment to moderation',        '3'],
+                ['Max. comments per minute from an IP address',         '0'],
+                ['Max. comments per minute on a page',                  '0'],
+                ['Max. comments per minute by a user',                  '0'],
                 ['Enable comment RSS feeds',                            '✔'],
                 ['Show deleted comments',                               '✔'],
                 ['Maximum comment text length',                         '1,024'],
@@ -162,7 +176,14 @@ context('Domain Properties page', () => {
                 ['Allow moderators to delete comments',                 '✔'],
                 ['Allow comment authors to edit comments',              '✔'],
                 ['Allow moderators to edit comments',                   '✔'],
+                ['Re-moderate comments changed on edit by (%)',         '0'],
                 ['Enable voting on comments',                           '✔'],
+                ['Allow unregistered users to flag comments',           ''],
+                ['Allow users to flag comments',                        '✔'],
+                ['Flags needed to send a comment to moderation',        '3'],
+                ['Max. comments per minute from an IP address',         '0'],
+                ['Max. comments per minute on a page',                  '0'],
+                ['Max. comments per minute by a user',                  '0'],
                 ['Enable comment RSS feeds',                            '✔'],
                 ['Show deleted comments',                               '✔'],
                 ['Maximum comment text length',                         '1,024'],
@@ -195,7 +216,14 @@ context('Domain Properties page', () => {
                 ['Allow moderators to delete comments',                 '✔'],
                 ['Allow comment authors to edit comments',              '✔'],
                 ['Allow moderators to edit comments',                   '✔'],
+                ['Re-moderate comments changed on edit by (%)',         '0'],
                 ['Enable voting on comments',                           '✔'],
+                ['Allow unregistered users to flag comments',           ''],
+                ['Allow users to flag comments',                        '✔'],
+                ['Flags needed to send a comment to moderation',        '3'],
+                ['Max. comments per minute from an IP address',         '0'],
+                ['Max. comments per minute on a page',                  '0'],
+                ['Max. comments per minute by a user',                  '0'],
                 ['Enable comment RSS feeds',                            '✔'],
                 ['Show deleted comments',                               '✔'],
                 ['Maximum comment text length',                         '4,096'],
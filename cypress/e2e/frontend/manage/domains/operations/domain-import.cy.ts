@@ -5,15 +5,20 @@ context('Domain Import page', () => {
     const pagePath = PATHS.manage.domains.id(DOMAINS.localhost.id).import;
 
     const zeroResults = [
-        ['Total users',          '0'],
-        ['Added users',          '0'],
-        ['Added domain users',   '0'],
-        ['Total domain pages',   '0'],
-        ['Added domain pages',   '0'],
-        ['Total comments',       '0'],
-        ['Imported comments',    '0'],
-        ['Skipped comments',     '0'],
-        ['Non-deleted comments', '0'],
+        ['Total users',                  '0'],
+        ['Added users',                  '0'],
+        ['Matched existing users',       '0'],
+        ['Added domain users',           '0'],
+        ['Total domain pages',           '0'],
+        ['Added domain pages',           '0'],
+        ['Total comments',               '0'],
+        ['Imported comments',            '0'],
+        ['Skipped comments',             '0'],
+        ['Non-deleted comments',         '0'],
+        ['Duplicate comments',           '0'],
+        ['Comments with missing parent', '0'],
+        ['Invalid dates',                '0'],
+        ['Invalid emails',               '0'],
     ];
 
     const makeAliases = () => {
@@ -35,13 +40,14 @@ context('Domain Import page', () => {
         cy.get('@domainImport').find('#import-complete').should('not.exist');
     };
 
-    const checkResults = (warning: string | null, expected: string[][]) => {
-        cy.get('@domainImport').find('#import-complete').as('importComplete').should('be.visible');
+    const checkResults = (error: string | null, expected: string[][]) => {
+        // The import runs in the background, so wait for it to complete
+        cy.get('@domainImport').find('#import-complete', {timeout: 10000}).as('importComplete').should('be.visible');
 
         // Alert message
-        if (warning) {
-            cy.get('@importComplete').contains('.alert-warning', 'Import finished with a warning:')
-                .as('importWarning').should('be.visible').and('contain', warning);
+        if (error) {
+            cy.get('@importComplete').contains('.alert-warning', 'Import failed:')
+                .as('importError').should('be.visible').and('contain', error);
         } else {
             cy.get('@importComplete').contains('.alert-success', 'Import finished successfully.').should('be.visible');
         }
@@ -122,15 +128,20 @@ context('Domain Import page', () => {
                             cy.get('@btnSubmit').click();
                             const countStr = count.toString();
                             checkResults(null, [
-                                ['Total users',          countStr],
-                                ['Added users',          countStr],
-                                ['Added domain users',   countStr],
-                                ['Total domain pages',   countStr],
-                                ['Added domain pages',   '0'],
-                                ['Total comments',       countStr],
-                                ['Imported comments',    countStr],
-                                ['Skipped comments',     '0'],
-                                ['Non-deleted comments', countStr],
+                                ['Total users',                  countStr],
+                                ['Added users',                  countStr],
+                                ['Matched existing users',       '0'],
+                                ['Added domain users',           countStr],
+                                ['Total domain pages',           countStr],
+                                ['Added domain pages',           '0'],
+                                ['Total comments',               countStr],
+                                ['Imported comments',            countStr],
+                                ['Skipped comments',             '0'],
+                                ['Non-deleted comments',         countStr],
+                                ['Duplicate comments',           '0'],
+                                ['Comments with missing parent', '0'],
+                                ['Invalid dates',                '0'],
+                                ['Invalid emails',               '0'],
                             ]);
 
                             // Click on Comments
@@ -160,14 +171,14 @@ context('Domain Import page', () => {
                         }));
 
                 [
-                    {file: 'comentario-bad-format.json.gz',  warning: 'invalid character \'A\''},
-                    {file: 'comentario-bad-version.json.gz', warning: 'invalid Comentario export version (481)'},
+                    {file: 'comentario-bad-format.json.gz',  error: 'invalid character \'A\''},
+                    {file: 'comentario-bad-version.json.gz', error: 'invalid Comentario export version (481)'},
                 ]
-                    .forEach(({file, warning}) =>
+                    .forEach(({file, error}) =>
                         it(`handles invalid file ${file}`, () => {
                             cy.get('@importFileSelect').selectFile(`cypress/fixtures/import/${file}`);
                             cy.get('@btnSubmit').click();
-                            checkResults(warning, zeroResults);
+                            checkResults(error, zeroResults);
                         }));
             });
 
@@ -186,15 +197,20 @@ context('Domain Import page', () => {
                             cy.get('@btnSubmit').click();
                             const countStr = count.toString();
                             checkResults(null, [
-                                ['Total users',          countStr],
-                                ['Added users',          countStr],
-                                ['Added domain users',   countStr],
-                                ['Total domain pages',   countStr],
-                                ['Added domain pages',   '0'],
-                                ['Total comments',       countStr],
-                                ['Imported comments',    countStr],
-                                ['Skipped comments',     '0'],
-                                ['Non-deleted comments', countStr],
+                                ['Total users',                  countStr],
+                                ['Added users',                  countStr],
+                                ['Matched existing users',       '0'],
+                                ['Added domain users',           countStr],
+                                ['Total domain pages',           countStr],
+                                ['Added domain pages',           '0'],
+                                ['Total comments',               countStr],
+                                ['Imported comments',            countStr],
+                                ['Skipped comments',             '0'],
+                                ['Non-deleted comments',         countStr],
+                                ['Duplicate comments',           '0'],
+                                ['Comments with missing parent', '0'],
+                                ['Invalid dates',                '0'],
+                                ['Invalid emails',               '0'],
                             ]);
 
                             // Click on Comments
@@ -223,14 +239,54 @@ context('Domain Import page', () => {
                             }
                         }));
 
+                it('performs a dry run', () => {
+                    cy.get('@importFileSelect').selectFile('cypress/fixtures/import/disqus-ok-single.xml.gz');
+                    cy.get('@domainImport').find('#import-dry-run').click().should('be.checked');
+                    cy.get('@btnSubmit').click();
+
+                    // Verify the results
+                    cy.get('@domainImport').find('#import-complete', {timeout: 10000}).as('importComplete').should('be.visible');
+                    cy.get('@importComplete').contains('.alert-success', 'Dry run finished successfully.').should('be.visible');
+                    cy.get('@importComplete').find('h2').first().should('have.text', 'Dry run results');
+                    cy.get('@importComplete').find('#importResultsTable').dlTexts().should('matrixMatch', [
+                        ['Total users',                  '1'],
+                        ['Added users',                  '1'],
+                        ['Matched existing users',       '0'],
+                        ['Added domain users',           '1'],
+                        ['Total domain pages',           '1'],
+                        ['Added domain pages',           '0'],
+                        ['Total comments',               '1'],
+                        ['Imported comments',            '1'],
+                        ['Skipped comments',             '0'],
+                        ['Non-deleted comments',         '1'],
+                        ['Duplicate comments',           '0'],
+                        ['Comments with missing parent', '0'],
+                        ['Invalid dates',                '0'],
+                        ['Invalid emails',               '0'],
+                    ]);
+                    cy.get('@importComplete').find('#importReportItems li').should('have.length', 1)
+                        .first().should('contain.text', 'Added user').and('contain.text', 'bugsy@disqus-user');
+
+                    // Go back to the form
+                    cy.get('@importComplete').find('#import-start-over').click();
+                    cy.get('@domainImport').find('#import-complete').should('not.exist');
+                    cy.get('@sourceDisqus').should('have.class', 'selected');
+                    cy.get('@domainImport').find('#import-dry-run').should('not.be.checked');
+
+                    // Verify nothing has been imported
+                    cy.sidebarClick('Comments', PATHS.manage.domains.id(DOMAINS.localhost.id).comments);
+                    cy.get('app-comment-list #filter-string').setValue('yay');
+                    cy.get('app-comment-list').verifyListFooter(0, false);
+                });
+
                 [
-                    {file: 'disqus-bad-format.xml.gz', warning: 'XML syntax error'},
+                    {file: 'disqus-bad-format.xml.gz', error: 'XML syntax error'},
                 ]
-                    .forEach(({file, warning}) =>
+                    .forEach(({file, error}) =>
                         it(`handles invalid file ${file}`, () => {
                             cy.get('@importFileSelect').selectFile(`cypress/fixtures/import/${file}`);
                             cy.get('@btnSubmit').click();
-                            checkResults(warning, zeroResults);
+                            checkResults(error, zeroResults);
                         }));
             });
 
@@ -250,15 +306,20 @@ context('Domain Import page', () => {
                             cy.get('@btnSubmit').click();
                             const countStr = count.toString();
                             checkResults(null, [
-                                ['Total users',          countStr],
-                                ['Added users',          countStr],
-                                ['Added domain users',   countStr],
-                                ['Total domain pages',   countStr],
-                                ['Added domain pages',   '0'],
-                                ['Total comments',       countStr],
-                                ['Imported comments',    countStr],
-                                ['Skipped comments',     '0'],
-                                ['Non-deleted comments', countStr],
+                                ['Total users',                  countStr],
+                                ['Added users',                  countStr],
+                                ['Matched existing users',       '0'],
+                                ['Added domain users',           countStr],
+                                ['Total domain pages',           countStr],
+                                ['Added domain pages',           '0'],
+                                ['Total comments',               countStr],
+                                ['Imported comments',            countStr],
+                                ['Skipped comments',             '0'],
+                                ['Non-deleted comments',         countStr],
+                                ['Duplicate comments',           '0'],
+                                ['Comments with missing parent', '0'],
+                                ['Invalid dates',                '0'],
+                                ['Invalid emails',               '0'],
                             ]);
 
                             // Click on Comments
@@ -289,9 +350,9 @@ context('Domain Import page', () => {
                         }));
 
                 [
-                    {file: 'wordpress-bad-format.zip',    warning: 'XML syntax error'},
+                    {file: 'wordpress-bad-format.zip',    error: 'XML syntax error'},
                     {file: 'wordpress-bad-no-files.zip',  toast: 'invalid-input-data', details: '(unsupported binary data format)'},
-                    {file: 'wordpress-bad-two-files.zip', toast: 'invalid-input-data', details: '(decompression failed)'},
+                    {file: 'wordpress-bad-two-files.zip', error: 'expected exactly one file in zip archive, found many'},
                 ]
                     .forEach(test =>
                         it(`handles invalid file ${test.file}`, () => {
@@ -300,7 +361,7 @@ context('Domain Import page', () => {
                             if (test.toast) {
                                 cy.toastCheckAndClose(test.toast, test.details);
                             } else {
-                                checkResults(test.warning, zeroResults);
+                                checkResults(test.error, zeroResults);
                             }
                         }));
             });
@@ -46,8 +46,9 @@ context('Domain Operations page', () => {
             });
 
             it('allows to export domain', () => {
-                // Trigger export
+                // Trigger export with the default options
                 cy.get('@domainOperations').contains('button', 'Export data').click();
+                cy.confirmationDialog(/Leave all fields empty to export all of the domain's data\./).dlgButtonClick('Export');
 
                 // Read the file name from the toast details
                 cy.get('.top-toast .toast-details').should('be.visible')
@@ -60,6 +61,25 @@ context('Domain Operations page', () => {
                 cy.toastCheckAndClose('file-downloaded');
             });
 
+            it('allows to export domain comments as CSV', () => {
+                // Trigger export, choosing CSV and narrowing it down
+                cy.get('@domainOperations').contains('button', 'Export data').click();
+                cy.confirmationDialog().as('dlg');
+                cy.get('@dlg').find('#export-format').select('Comments as CSV');
+                cy.get('@dlg').find('#export-path-prefix').setValue('/');
+                cy.get('@dlg').find('#export-approved-only').clickLabel().should('be.checked');
+                cy.get('@dlg').dlgButtonClick('Export');
+
+                // Read the file name from the toast details
+                cy.get('.top-toast .toast-details').should('be.visible')
+                    .invoke('text').should('match', /^\(localhost8000-.+\.csv\.gz\)$/)
+                    .then(details =>
+                        cy.readFile(Cypress.config('downloadsFolder') + '/' + details.substring(1, details.length - 1)));
+
+                // There's a success toast
+                cy.toastCheckAndClose('file-downloaded');
+            });
+
             it('navigates to Domain import', () => {
                 cy.get('@domainOperations').contains('button', 'Import data').click();
                 cy.isAt(PATHS.manage.domains.id(DOMAINS.localhost.id).import);
@@ -175,7 +175,14 @@ export enum DomainConfigKey {
     commentDeletionModerator = 'comments.deletion.moderator',
     commentEditingAuthor     = 'comments.editing.author',
     commentEditingModerator  = 'comments.editing.moderator',
+    commentEditingRemoderate = 'comments.editing.remoderate',
     enableCommentVoting      = 'comments.enableVoting',
+    flaggingAnonymous        = 'comments.flagging.anonymous',
+    flaggingEnabled          = 'comments.flagging.enabled',
+    flaggingThreshold        = 'comments.flagging.threshold',
+    rateLimitPerIP           = 'comments.rateLimit.perIP',
+    rateLimitPerPage         = 'comments.rateLimit.perPage',
+    rateLimitPerUser         = 'comments.rateLimit.perUser',
     enableRss                = 'comments.rss.enabled',
     showDeletedComments      = 'comments.showDeleted',
     maxCommentLength         = 'comments.text.maxLength',
@@ -188,7 +195,14 @@ export enum DomainConfigKey {
 }
 
 /** Config keys representing integer values (as opposed to boolean). */
-export const IntegerDomainConfigKeys = new Set<DomainConfigKey>([DomainConfigKey.maxCommentLength]);
+export const IntegerDomainConfigKeys = new Set<DomainConfigKey>([
+    DomainConfigKey.commentEditingRemoderate,
+    DomainConfigKey.flaggingThreshold,
+    DomainConfigKey.rateLimitPerIP,
+    DomainConfigKey.rateLimitPerPage,
+    DomainConfigKey.rateLimitPerUser,
+    DomainConfigKey.maxCommentLength,
+]);
 
 /** Instance dynamic config item keys. */
 export enum InstanceConfigKey {
@@ -197,6 +211,7 @@ export enum InstanceConfigKey {
     authSignupConfirmCommenter             = 'auth.signup.confirm.commenter',
     authSignupConfirmUser                  = 'auth.signup.confirm.user',
     authSignupEnabled                      = 'auth.signup.enabled',
+    authTotpRequiredForOwners              = 'auth.totp.requiredForOwners',
     integrationsUseGravatar                = 'integrations.useGravatar',
     operationNewOwnerEnabled               = 'operation.newOwner.enabled',
     // Domain defaults
@@ -204,7 +219,14 @@ export enum InstanceConfigKey {
     domainDefaultsCommentDeletionModerator = ConfigKeyDomainDefaultsPrefix + DomainConfigKey.commentDeletionModerator,
     domainDefaultsCommentEditingAuthor     = ConfigKeyDomainDefaultsPrefix + DomainConfigKey.commentEditingAuthor,
     domainDefaultsCommentEditingModerator  = ConfigKeyDomainDefaultsPrefix + DomainConfigKey.commentEditingModerator,
+    domainDefaultsCommentEditingRemoderate = ConfigKeyDomainDefaultsPrefix + DomainConfigKey.commentEditingRemoderate,
     domainDefaultsEnableCommentVoting      = ConfigKeyDomainDefaultsPrefix + DomainConfigKey.enableCommentVoting,
+    domainDefaultsFlaggingAnonymous        = ConfigKeyDomainDefaultsPrefix + DomainConfigKey.flaggingAnonymous,
+    domainDefaultsFlaggingEnabled          = ConfigKeyDomainDefaultsPrefix + DomainConfigKey.flaggingEnabled,
+    domainDefaultsFlaggingThreshold        = ConfigKeyDomainDefaultsPrefix + DomainConfigKey.flaggingThreshold,
+    domainDefaultsRateLimitPerIP           = ConfigKeyDomainDefaultsPrefix + DomainConfigKey.rateLimitPerIP,
+    domainDefaultsRateLimitPerPage         = ConfigKeyDomainDefaultsPrefix + DomainConfigKey.rateLimitPerPage,
+    domainDefaultsRateLimitPerUser         = ConfigKeyDomainDefaultsPrefix + DomainConfigKey.rateLimitPerUser,
     domainDefaultsEnableRss                = ConfigKeyDomainDefaultsPrefix + DomainConfigKey.enableRss,
     domainDefaultsShowDeletedComments      = ConfigKeyDomainDefaultsPrefix + DomainConfigKey.showDeletedComments,
     domainDefaultsMaxCommentLength         = ConfigKeyDomainDefaultsPrefix + DomainConfigKey.maxCommentLength,
@@ -0,0 +1,47 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add domain webhooks table
+------------------------------------------------------------------------------------------------------------------------
+
+create table cm_domain_webhooks (
+    id           uuid primary key,                    -- Unique record ID
+    domain_id    uuid                       not null, -- Reference to the domain
+    url          varchar(2083)              not null, -- URL of the endpoint to deliver events to
+    secret       char(64)                   not null, -- Secret used to sign payloads, as a hex string
+    events       varchar(1024) default ''   not null, -- Comma-separated list of subscribed event types
+    is_active    boolean       default true not null, -- Whether the webhook is active
+    ts_created   timestamp                  not null, -- When the record was created
+    user_created uuid                                 -- Reference to the user who created the record
+);
+
+-- Constraints
+alter table cm_domain_webhooks add constraint fk_domain_webhooks_domain_id    foreign key (domain_id)    references cm_domains(id) on delete cascade;
+alter table cm_domain_webhooks add constraint fk_domain_webhooks_user_created foreign key (user_created) references cm_users(id)   on delete set null;
+
+-- Indices
+create index idx_domain_webhooks_domain_id on cm_domain_webhooks(domain_id);
+
+------------------------------------------------------------------------------------------------------------------------
+-- Add webhook deliveries table, which serves as both a retry queue and a delivery log
+------------------------------------------------------------------------------------------------------------------------
+
+create table cm_webhook_deliveries (
+    id              uuid primary key,                  -- Unique record ID
+    webhook_id      uuid                     not null, -- Reference to the webhook
+    event           varchar(32)              not null, -- Event type
+    payload         text                     not null, -- JSON payload to deliver
+    status          varchar(16)              not null, -- Delivery status: 'pending', 'succeeded', 'failed'
+    attempts        integer       default 0  not null, -- Number of delivery attempts made so far
+    ts_created      timestamp                not null, -- When the record was created
+    ts_next_attempt timestamp                not null, -- When the next delivery attempt is due
+    ts_last_attempt timestamp,                         -- When the last delivery attempt was made
+    response_code   integer       default 0  not null, -- HTTP status code of the last response, 0 if none
+    response_error  varchar(1024) default '' not null  -- Error of the last failed attempt
+);
+
+-- Constraints
+alter table cm_webhook_deliveries add constraint fk_webhook_deliveries_webhook_id foreign key (webhook_id) references cm_domain_webhooks(id) on delete cascade;
+
+-- Indices
+create index idx_webhook_deliveries_webhook_id  on cm_webhook_deliveries(webhook_id);
+create index idx_webhook_deliveries_status_next on cm_webhook_deliveries(status, ts_next_attempt);
+create index idx_webhook_deliveries_ts_created  on cm_webhook_deliveries(ts_created);
@@ -0,0 +1,26 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add email digest mode to domain users
+------------------------------------------------------------------------------------------------------------------------
+alter table cm_domains_users add column digest_mode varchar(16) default 'immediate' not null; -- Notification digest mode: 'immediate', 'hourly', 'daily', 'weekly'
+
+------------------------------------------------------------------------------------------------------------------------
+-- Add mail notifications table, which serves as a queue of notifications to be sent as digests
+------------------------------------------------------------------------------------------------------------------------
+
+create table cm_mail_notifications (
+    id         uuid primary key,      -- Unique record ID
+    domain_id  uuid        not null,  -- Reference to the domain
+    user_id    uuid        not null,  -- Reference to the recipient user
+    comment_id uuid        not null,  -- Reference to the comment the notification is about
+    kind       varchar(32) not null,  -- Notification kind: 'reply', 'moderator', 'commentStatus'
+    ts_created timestamp   not null   -- When the record was created
+);
+
+-- Constraints
+alter table cm_mail_notifications add constraint fk_mail_notifications_domain_id  foreign key (domain_id)  references cm_domains(id)  on delete cascade;
+alter table cm_mail_notifications add constraint fk_mail_notifications_user_id    foreign key (user_id)    references cm_users(id)    on delete cascade;
+alter table cm_mail_notifications add constraint fk_mail_notifications_comment_id foreign key (comment_id) references cm_comments(id) on delete cascade;
+
+-- Indices
+create index idx_mail_notifications_user_id    on cm_mail_notifications(user_id);
+create index idx_mail_notifications_comment_id on cm_mail_notifications(comment_id);
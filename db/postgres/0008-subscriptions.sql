@@ -0,0 +1,22 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add page subscriptions table, holding users' subscriptions to new comments on a page or in a comment thread
+------------------------------------------------------------------------------------------------------------------------
+
+create table cm_page_subscriptions (
+    id         uuid primary key,    -- Unique record ID
+    domain_id  uuid      not null,  -- Reference to the domain
+    page_id    uuid      not null,  -- Reference to the page
+    user_id    uuid      not null,  -- Reference to the subscribed user
+    thread_id  uuid,                -- Reference to the comment the subscribed thread starts at, null for the whole page
+    ts_created timestamp not null   -- When the record was created
+);
+
+-- Constraints
+alter table cm_page_subscriptions add constraint fk_page_subscriptions_domain_id foreign key (domain_id) references cm_domains(id)      on delete cascade;
+alter table cm_page_subscriptions add constraint fk_page_subscriptions_page_id   foreign key (page_id)   references cm_domain_pages(id) on delete cascade;
+alter table cm_page_subscriptions add constraint fk_page_subscriptions_user_id   foreign key (user_id)   references cm_users(id)        on delete cascade;
+alter table cm_page_subscriptions add constraint fk_page_subscriptions_thread_id foreign key (thread_id) references cm_comments(id)     on delete cascade;
+
+-- Indices
+create index idx_page_subscriptions_page_id on cm_page_subscriptions(page_id);
+create index idx_page_subscriptions_user_id on cm_page_subscriptions(user_id);
@@ -0,0 +1,6 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add full-text search index on comment text
+------------------------------------------------------------------------------------------------------------------------
+
+-- The 'simple' configuration is used because comments may be written in any language
+create index idx_comments_markdown_fts on cm_comments using gin (to_tsvector('simple', markdown));
@@ -0,0 +1,21 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add personal tokens table, holding long-lived tokens users authenticate API calls with
+------------------------------------------------------------------------------------------------------------------------
+
+create table cm_personal_tokens (
+    id           uuid primary key,                 -- Unique record ID
+    user_id      uuid                    not null, -- Reference to the user owning the token
+    name         varchar(255)            not null, -- Token name, given by the user
+    value_hash   char(64)                not null, -- SHA-256 hash of the token value, as a hex string
+    scopes       varchar(255) default '' not null, -- Comma-separated list of granted scopes
+    domain_ids   text         default '' not null, -- Comma-separated list of IDs of domains the token is restricted to, empty if unrestricted
+    ts_created   timestamp               not null, -- When the record was created
+    ts_last_used timestamp                         -- When the token was last used
+);
+
+-- Constraints
+alter table cm_personal_tokens add constraint fk_personal_tokens_user_id foreign key (user_id) references cm_users(id) on delete cascade;
+
+-- Indices
+create unique index idx_personal_tokens_value_hash on cm_personal_tokens(value_hash);
+create index idx_personal_tokens_user_id on cm_personal_tokens(user_id);
@@ -0,0 +1,26 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add user passkeys table, holding WebAuthn credentials users can sign in with
+------------------------------------------------------------------------------------------------------------------------
+
+create table cm_user_passkeys (
+    id               uuid primary key,                    -- Unique record ID
+    user_id          uuid                       not null, -- Reference to the user owning the passkey
+    name             varchar(255)               not null, -- Passkey name, given by the user
+    credential_id    bytea                      not null, -- Credential ID, as reported by the authenticator
+    public_key       bytea                      not null, -- COSE-encoded credential public key
+    attestation_type varchar(32)  default ''    not null, -- Attestation format reported when the credential was created
+    aaguid           bytea                      not null, -- AAGUID identifying the authenticator model
+    sign_count       bigint       default 0     not null, -- Signature counter value last reported by the authenticator
+    transports       varchar(255) default ''    not null, -- Comma-separated list of transports the authenticator supports
+    backup_eligible  boolean      default false not null, -- Whether the credential can be synced between devices
+    backup_state     boolean      default false not null, -- Whether the credential is currently synced between devices
+    ts_created       timestamp                  not null, -- When the record was created
+    ts_last_used     timestamp                            -- When the passkey was last used to sign in
+);
+
+-- Constraints
+alter table cm_user_passkeys add constraint fk_user_passkeys_user_id foreign key (user_id) references cm_users(id) on delete cascade;
+
+-- Indices
+create unique index idx_user_passkeys_credential_id on cm_user_passkeys(credential_id);
+create index idx_user_passkeys_user_id on cm_user_passkeys(user_id);
@@ -0,0 +1,6 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add JWT-based SSO columns to domains
+------------------------------------------------------------------------------------------------------------------------
+
+alter table cm_domains add column sso_type     varchar(16)   default 'hmac' not null; -- SSO payload type: 'hmac' (hex-encoded payload signed with HMAC) or 'jwt' (JSON Web Token)
+alter table cm_domains add column sso_jwks_url varchar(2083) default ''     not null; -- URL of the JWKS document used to verify asymmetrically signed SSO JWTs
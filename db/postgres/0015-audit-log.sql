@@ -0,0 +1,22 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add audit log table. It's append-only and deliberately has no foreign keys, so that entries outlive the objects
+-- they refer to
+------------------------------------------------------------------------------------------------------------------------
+
+create table cm_audit_log (
+    id           uuid primary key,                 -- Unique record ID
+    ts_created   timestamp               not null, -- When the record was created
+    user_id      uuid,                             -- ID of the user who performed the action, null if it was the system
+    action       varchar(32)             not null, -- Action performed
+    domain_id    uuid,                             -- ID of the domain the action relates to, if any
+    target_id    uuid,                             -- ID of the object affected by the action (user, comment, ...), if any
+    value_before text        default ''  not null, -- JSON representation of the affected values before the action
+    value_after  text        default ''  not null, -- JSON representation of the affected values after the action
+    ip           varchar(39) default ''  not null  -- IP address the action was requested from, if any
+);
+
+-- Indices
+create index idx_audit_log_ts_created on cm_audit_log(ts_created);
+create index idx_audit_log_user_id    on cm_audit_log(user_id);
+create index idx_audit_log_domain_id  on cm_audit_log(domain_id);
+create index idx_audit_log_target_id  on cm_audit_log(target_id);
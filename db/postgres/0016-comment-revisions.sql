@@ -0,0 +1,18 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add comment revisions table, storing superseded versions of edited comments
+------------------------------------------------------------------------------------------------------------------------
+
+create table cm_comment_revisions (
+    id           uuid primary key,   -- Unique record ID
+    comment_id   uuid      not null, -- Reference to the comment
+    markdown     text      not null, -- Comment text in markdown, as it was in this revision
+    ts_created   timestamp not null, -- When the revision was authored
+    user_created uuid                -- Reference to the user who authored the revision
+);
+
+-- Constraints
+alter table cm_comment_revisions add constraint fk_comment_revisions_comment_id   foreign key (comment_id)   references cm_comments(id) on delete cascade;
+alter table cm_comment_revisions add constraint fk_comment_revisions_user_created foreign key (user_created) references cm_users(id)    on delete set null;
+
+-- Indices
+create index idx_comment_revisions_comment_id on cm_comment_revisions(comment_id);
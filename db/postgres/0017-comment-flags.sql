@@ -0,0 +1,24 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add comment flags table, storing user reports on comments
+------------------------------------------------------------------------------------------------------------------------
+
+create table cm_comment_flags (
+    id             uuid primary key,                  -- Unique record ID
+    comment_id     uuid                     not null, -- Reference to the flagged comment
+    user_id        uuid,                              -- Reference to the user who flagged the comment
+    reason         varchar(16)              not null, -- Reason for flagging: 'spam', 'offensive', 'harassment', 'offTopic', 'other'
+    details        varchar(255) default ''  not null, -- Optional details provided by the user
+    ip             varchar(39)  default ''  not null, -- IP address the flag was submitted from
+    ts_created     timestamp                not null, -- When the record was created
+    ts_dismissed   timestamp,                         -- When the flag was dismissed by a moderator, null if it's active
+    user_dismissed uuid                               -- Reference to the user who dismissed the flag
+);
+
+-- Constraints
+alter table cm_comment_flags add constraint fk_comment_flags_comment_id     foreign key (comment_id)     references cm_comments(id) on delete cascade;
+alter table cm_comment_flags add constraint fk_comment_flags_user_id        foreign key (user_id)        references cm_users(id)    on delete set null;
+alter table cm_comment_flags add constraint fk_comment_flags_user_dismissed foreign key (user_dismissed) references cm_users(id)    on delete set null;
+
+-- Indices
+create index idx_comment_flags_comment_id on cm_comment_flags(comment_id);
+create index idx_comment_flags_ip         on cm_comment_flags(ip);
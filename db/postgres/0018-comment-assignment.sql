@@ -0,0 +1,11 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add comment assignment columns, allowing moderators to claim or assign moderation queue items
+------------------------------------------------------------------------------------------------------------------------
+alter table cm_comments add column ts_assigned   timestamp; -- When the comment was assigned to a moderator. null if it's unassigned
+alter table cm_comments add column user_assigned uuid;      -- Reference to the moderator the comment is assigned to
+
+-- Constraints
+alter table cm_comments add constraint fk_comments_user_assigned foreign key (user_assigned) references cm_users(id) on delete set null;
+
+-- Indices
+create index idx_comments_user_assigned on cm_comments(user_assigned);
@@ -0,0 +1,5 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add lease columns to import jobs, so that only one server instance runs a job at a time
+------------------------------------------------------------------------------------------------------------------------
+alter table cm_import_jobs add column owner_id     uuid;      -- ID of the server instance running the job
+alter table cm_import_jobs add column ts_heartbeat timestamp; -- When the owner last renewed its lease on the job, null if never
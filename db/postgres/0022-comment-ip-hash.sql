@@ -0,0 +1,4 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add a hash of the full author IP address to comments, for rate limiting regardless of IP masking
+------------------------------------------------------------------------------------------------------------------------
+alter table cm_comments add column author_ip_hash varchar(64) default '' not null; -- HMAC of the author's full IP address, empty if unknown
@@ -0,0 +1,4 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add a hash of the full IP address to comment flags, for telling anonymous flaggers apart regardless of IP masking
+------------------------------------------------------------------------------------------------------------------------
+alter table cm_comment_flags add column ip_hash varchar(64) default '' not null; -- HMAC of the full IP address the flag was submitted from
@@ -0,0 +1,5 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add send attempt tracking to mail notifications, for backing off and eventually giving up on failing digests
+------------------------------------------------------------------------------------------------------------------------
+alter table cm_mail_notifications add column attempts        integer default 0 not null; -- Number of failed attempts to send the notification's digest
+alter table cm_mail_notifications add column ts_next_attempt timestamp;                  -- When the next send attempt is due, null if not failed yet
@@ -0,0 +1,24 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add full-text search table for comment text, kept in sync with cm_comments by triggers
+------------------------------------------------------------------------------------------------------------------------
+
+create virtual table cm_comments_fts using fts5(
+    id unindexed, -- Reference to the comment
+    markdown      -- Comment text
+);
+
+-- Populate the table with existing comments
+insert into cm_comments_fts(id, markdown) select id, markdown from cm_comments;
+
+-- Triggers
+create trigger trg_comments_fts_insert after insert on cm_comments begin
+    insert into cm_comments_fts(id, markdown) values (new.id, new.markdown);
+end;
+
+create trigger trg_comments_fts_update after update of markdown on cm_comments begin
+    update cm_comments_fts set markdown = new.markdown where id = new.id;
+end;
+
+create trigger trg_comments_fts_delete after delete on cm_comments begin
+    delete from cm_comments_fts where id = old.id;
+end;
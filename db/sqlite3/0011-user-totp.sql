@@ -0,0 +1,9 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add TOTP two-factor authentication columns to users
+------------------------------------------------------------------------------------------------------------------------
+
+alter table cm_users add column totp_secret         varchar(64) default ''    not null; -- Base32-encoded TOTP secret, empty if no second factor is set up
+alter table cm_users add column totp_enabled        boolean     default false not null; -- Whether TOTP two-factor authentication is enabled (enrolment is confirmed)
+alter table cm_users add column ts_totp_enabled     timestamp;                          -- When TOTP two-factor authentication was enabled
+alter table cm_users add column totp_last_counter   bigint      default 0     not null; -- Time step counter of the last accepted TOTP code, to prevent code reuse
+alter table cm_users add column totp_recovery_codes text        default ''    not null; -- Comma-separated list of SHA-256 hashes of unused recovery codes
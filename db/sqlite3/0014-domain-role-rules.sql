@@ -0,0 +1,21 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add domain role rules table, mapping federated identity claims onto domain user roles
+------------------------------------------------------------------------------------------------------------------------
+
+create table cm_domain_role_rules (
+    id           uuid primary key,                  -- Unique record ID
+    domain_id    uuid                     not null, -- Reference to the domain
+    sort_order   integer                  not null, -- Position of the rule in the domain's rule list, the first matching rule wins
+    idp_id       varchar(37)  default ''  not null, -- ID of the identity provider the rule applies to ('sso' for SSO), empty for any provider
+    claim        varchar(255)             not null, -- Name of (or dot-separated path to) the claim to examine
+    value        varchar(255) default ''  not null, -- Value the claim must have (or contain, if it's an array)
+    role         varchar(16)              not null, -- Role to grant to the user: 'owner', 'moderator', 'commenter', 'readonly'
+    ts_created   timestamp                not null, -- When the record was created
+    user_created uuid,                              -- Reference to the user who created the record
+    -- Constraints
+    constraint fk_domain_role_rules_domain_id    foreign key (domain_id)    references cm_domains(id) on delete cascade,
+    constraint fk_domain_role_rules_user_created foreign key (user_created) references cm_users(id)   on delete set null
+);
+
+-- Indices
+create index idx_domain_role_rules_domain_id on cm_domain_role_rules(domain_id);
@@ -0,0 +1,35 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add import jobs table, tracking comment imports running in the background
+------------------------------------------------------------------------------------------------------------------------
+
+create table cm_import_jobs (
+    id                   uuid primary key,                 -- Unique record ID
+    domain_id            uuid                    not null, -- Reference to the domain the data is imported into
+    user_created         uuid                    not null, -- Reference to the user who started the import
+    source               varchar(16)             not null, -- Source of the data: 'comentario', 'disqus', 'wordpress' etc.
+    file_name            varchar(1024)           not null, -- Path to the stored data file
+    file_size            bigint                  not null, -- Size of the data file in bytes
+    status               varchar(16)             not null, -- Job status: 'running', 'completed', 'failed', 'cancelled'
+    ts_created           timestamp               not null, -- When the record was created
+    ts_updated           timestamp               not null, -- When the job's progress was last updated
+    ts_finished          timestamp,                        -- When the job finished, null if it's still running
+    bytes_read           bigint       default 0  not null, -- Number of bytes of the data file processed so far
+    records_committed    integer      default 0  not null, -- Number of leading source records completely processed, where a resumed job continues
+    users_total          integer      default 0  not null, -- Total number of users
+    users_added          integer      default 0  not null, -- Number of added users
+    domain_users_added   integer      default 0  not null, -- Number of added domain users
+    pages_total          integer      default 0  not null, -- Total number of domain pages
+    pages_added          integer      default 0  not null, -- Number of added domain pages
+    comments_total       integer      default 0  not null, -- Total number of comments processed
+    comments_imported    integer      default 0  not null, -- Number of imported comments
+    comments_skipped     integer      default 0  not null, -- Number of skipped comments
+    comments_non_deleted integer      default 0  not null, -- Number of non-deleted imported comments
+    error_text           text         default '' not null, -- Error message of a failed job
+    -- Constraints
+    constraint fk_import_jobs_domain_id    foreign key (domain_id)    references cm_domains(id) on delete cascade,
+    constraint fk_import_jobs_user_created foreign key (user_created) references cm_users(id)   on delete cascade
+);
+
+-- Indices
+create index idx_import_jobs_domain_id on cm_import_jobs(domain_id);
+create index idx_import_jobs_status    on cm_import_jobs(status);
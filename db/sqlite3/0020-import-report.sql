@@ -0,0 +1,10 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add dry-run flag and report columns to import jobs
+------------------------------------------------------------------------------------------------------------------------
+alter table cm_import_jobs add column dry_run            boolean default false not null; -- Whether the job only reports what would be imported, without writing anything
+alter table cm_import_jobs add column users_matched      integer default 0     not null; -- Number of users matched by email to existing ones
+alter table cm_import_jobs add column comments_duplicate integer default 0     not null; -- Number of comments skipped as duplicates of existing ones
+alter table cm_import_jobs add column comments_orphaned  integer default 0     not null; -- Number of comments whose parent is missing, imported as root ones
+alter table cm_import_jobs add column invalid_dates      integer default 0     not null; -- Number of comments with an invalid creation date
+alter table cm_import_jobs add column invalid_emails     integer default 0     not null; -- Number of comment authors with an invalid email
+alter table cm_import_jobs add column report_items       text    default ''    not null; -- JSON array of report items, detailing added or matched users and pages, and conflicts
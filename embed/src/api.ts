@@ -1,4 +1,4 @@
-import { Comment, Commenter, PageInfo, Principal, UUID } from './models';
+import { Comment, Commenter, DigestMode, PageInfo, PageSubscription, Principal, UUID } from './models';
 import { HttpClient, HttpHeaders } from './http-client';
 import { Utils } from './utils';
 
@@ -51,6 +51,11 @@ export interface ApiCommentVoteResponse {
     readonly score: number;
 }
 
+export interface ApiPageSubscriptionListResponse {
+    /** Subscriptions of the user. */
+    readonly subscriptions?: PageSubscription[];
+}
+
 export interface ApiAuthSignupResponse {
     /** Whether the user has been immediately confirmed. */
     readonly isConfirmed: boolean;
@@ -225,9 +230,10 @@ export class ApiService {
      * @param notifyModerator Whether the user is to receive moderator notifications.
      * @param notifyCommentStatus Whether the user is to be notified about status changes (approved/rejected) of their
      *     comments.
+     * @param digestMode How email notifications are delivered to the user.
      */
-    async authUserSettingsUpdate(domainId: UUID, notifyReplies: boolean, notifyModerator: boolean, notifyCommentStatus: boolean): Promise<void> {
-        await this.httpClient.put<void>('embed/auth/user', {domainId, notifyReplies, notifyModerator, notifyCommentStatus}, this.addAuth());
+    async authUserSettingsUpdate(domainId: UUID, notifyReplies: boolean, notifyModerator: boolean, notifyCommentStatus: boolean, digestMode: DigestMode): Promise<void> {
+        await this.httpClient.put<void>('embed/auth/user', {domainId, notifyReplies, notifyModerator, notifyCommentStatus, digestMode}, this.addAuth());
 
         // Reload the principal to reflect the updates
         this._principal = await this.fetchPrincipal() ?? null;
@@ -352,6 +358,34 @@ export class ApiService {
         return this.httpClient.put<void>(`embed/page/${id}`, {isReadonly}, this.addAuth());
     }
 
+    /**
+     * Get the current user's subscriptions to the specified page and its threads.
+     * @param id ID of the page.
+     */
+    async pageSubscriptionList(id: UUID): Promise<PageSubscription[]> {
+        const r = await this.httpClient.get<ApiPageSubscriptionListResponse>(`embed/page/${id}/subscriptions`, this.addAuth());
+        return r.subscriptions ?? [];
+    }
+
+    /**
+     * Subscribe the current user to new comments on the specified page or in a thread on it.
+     * @param id ID of the page.
+     * @param threadId Optional ID of the comment the thread starts at. If omitted, subscribes to the whole page.
+     */
+    async pageSubscribe(id: UUID, threadId?: UUID): Promise<void> {
+        await this.httpClient.put<void>(`embed/page/${id}/subscriptions`, {threadId}, this.addAuth());
+    }
+
+    /**
+     * Unsubscribe the current user from new comments on the specified page or in a thread on it.
+     * @param id ID of the page.
+     * @param threadId Optional ID of the comment the thread starts at. If omitted, unsubscribes from the whole page.
+     */
+    async pageUnsubscribe(id: UUID, threadId?: UUID): Promise<void> {
+        const q = threadId ? `?thread=${encodeURIComponent(threadId)}` : '';
+        return this.httpClient.delete<void>(`embed/page/${id}/subscriptions${q}`, undefined, this.addAuth());
+    }
+
     /**
      * Add the user session auth header to the provided headers, but only if there's a user session.
      * @param headers Headers to amend.
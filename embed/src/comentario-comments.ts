@@ -70,6 +70,9 @@ export class ComentarioComments extends ComentarioBase implements WebComponent {
     /** Current page info as retrieved from the server. */
     private pageInfo?: PageInfo;
 
+    /** Whether the current user is subscribed to the page, or undefined if the user isn't authenticated. */
+    private pageSubscribed?: boolean;
+
     /**
      * Whether to ignore errors coming from the ApiClient. If false, every error will result in an error banner
      * appearing at the top of the embedded comments.
@@ -460,11 +463,13 @@ export class ComentarioComments extends ComentarioBase implements WebComponent {
                 this.i18n.t,
                 el => this.showRssDialog(el),
                 cs => this.applySort(cs),
+                btn => this.pageSubscribeToggle(btn),
                 this.localConfig.commentSort,
                 !!this.pageInfo?.enableRss,
                 !!this.pageInfo?.enableCommentVoting),
             // Create a panel for comments
             this.commentsArea = UIToolkit.div('comments').appendTo(this.mainArea!));
+        this.threadToolbar.subscribed = this.pageSubscribed;
     }
 
     /**
@@ -781,6 +786,11 @@ export class ComentarioComments extends ComentarioBase implements WebComponent {
 
         // Convert commenter list into a map
         r.commenters?.forEach(c => this.commenters[c.id] = c);
+
+        // Fetch the page subscription status of an authenticated user
+        this.pageSubscribed = this.principal ?
+            (await this.apiService.pageSubscriptionList(this.pageInfo.pageId)).some(s => !s.threadId) :
+            undefined;
     }
 
     /**
@@ -794,6 +804,21 @@ export class ComentarioComments extends ComentarioBase implements WebComponent {
         return this.reload();
     }
 
+    /**
+     * Toggle the current user's subscription to the current page.
+     * @param btn Button to show a spinner on while the toggle is running.
+     */
+    private async pageSubscribeToggle(btn: Wrap<HTMLButtonElement>): Promise<void> {
+        const pageId = this.pageInfo!.pageId;
+        await btn.spin(() => this.pageSubscribed ?
+            this.apiService.pageUnsubscribe(pageId) :
+            this.apiService.pageSubscribe(pageId));
+
+        // Update the status
+        this.pageSubscribed = !this.pageSubscribed;
+        this.threadToolbar!.subscribed = this.pageSubscribed;
+    }
+
     /**
      * Approve or reject the comment of the given card.
      * @param card Comment card.
@@ -927,7 +952,7 @@ export class ComentarioComments extends ComentarioBase implements WebComponent {
      */
     private async saveUserSettings(data: UserSettings): Promise<void> {
         // Run the update with the backend
-        await this.apiService.authUserSettingsUpdate(this.pageInfo!.domainId, data.notifyReplies, data.notifyModerator, data.notifyCommentStatus);
+        await this.apiService.authUserSettingsUpdate(this.pageInfo!.domainId, data.notifyReplies, data.notifyModerator, data.notifyCommentStatus, data.digestMode);
 
         // Refresh the principal (it holds the profile settings) and update the profile bar
         await this.updateAuthStatus();
@@ -81,7 +81,7 @@ export class LoginDialog extends Dialog {
                                     UIToolkit.button(
                                         idp.name,
                                         () => this.dismissWith(LoginChoice.federatedAuth, idp.id),
-                                        `btn-${idp.id.startsWith('oidc:') ? 'dark' : idp.id}`)) ??
+                                        `btn-${idp.id.startsWith('oidc:') || idp.id.startsWith('saml:') ? 'dark' : idp.id}`)) ??
                                 [])));
         }
 
@@ -42,6 +42,15 @@ export interface Principal extends User {
     readonly notifyReplies:       boolean; // Whether the user is to be notified about replies to their comments
     readonly notifyModerator:     boolean; // Whether the user is to receive moderator notifications
     readonly notifyCommentStatus: boolean; // Whether the user is to be notified about status changes (approved/rejected) of their comments
+    readonly digestMode?:         DigestMode; // How email notifications are delivered to the user
+}
+
+/** Subscription of the current user to new comments on a page or in a comment thread. */
+export interface PageSubscription {
+    readonly id:          UUID;   // Unique record ID
+    readonly pageId:      UUID;   // ID of the page
+    readonly threadId?:   UUID;   // ID of the comment the subscribed thread starts at, undefined for the whole page
+    readonly createdTime: string; // When the subscription was created
 }
 
 /** Comment residing on a page. */
@@ -177,6 +186,9 @@ export type ComparatorFunc<T> = (a: T, b: T) => number;
 /** Comment sorting. 1st letter defines the property, 2nd letter the direction. */
 export type CommentSort = 'ta' | 'td' | 'sa' | 'sd';
 
+/** How email notifications are delivered to a user. */
+export type DigestMode = 'immediate' | 'hourly' | 'daily' | 'weekly';
+
 /** Login choices available for the user in the Login dialog. */
 export enum LoginChoice {
     /** Signup (registration) instead of login. */
@@ -215,6 +227,7 @@ export interface UserSettings {
     notifyModerator:     boolean; // Whether to send moderator notifications to the user
     notifyReplies:       boolean; // Whether to send reply notifications to the user
     notifyCommentStatus: boolean; // Whether to send comment status notifications to the user
+    digestMode:          DigestMode; // How to deliver email notifications to the user
 }
 
 export const ANONYMOUS_ID: UUID = '00000000-0000-0000-0000-000000000000';
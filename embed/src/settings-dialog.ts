@@ -1,13 +1,14 @@
 import { Wrap } from './element-wrap';
 import { UIToolkit } from './ui-toolkit';
 import { Dialog, DialogPositioning } from './dialog';
-import { AsyncProc, AsyncProcWithArg, Principal, TranslateFunc, UserSettings } from './models';
+import { AsyncProc, AsyncProcWithArg, DigestMode, Principal, TranslateFunc, UserSettings } from './models';
 
 export class SettingsDialog extends Dialog {
 
     private _cbNotifyModerator?: Wrap<HTMLInputElement>;
     private _cbNotifyReplies?: Wrap<HTMLInputElement>;
     private _cbNotifyCommentStatus?: Wrap<HTMLInputElement>;
+    private _selDigestMode?: Wrap<HTMLSelectElement>;
     private _btnSave?: Wrap<HTMLButtonElement>;
 
     private constructor(
@@ -65,6 +66,20 @@ export class SettingsDialog extends Dialog {
                                 .attr({type: 'checkbox'})
                                 .checked(this.principal.notifyCommentStatus),
                             Wrap.new('label').attr({for: this._cbNotifyCommentStatus.getAttr('id')}).inner(this.t('fieldComStatusNotifications')))),
+                // Digest mode select
+                UIToolkit.div('select-container')
+                    .append(
+                        Wrap.new('label').attr({for: 'sel-digest-mode'}).inner(this.t('fieldDigestMode')),
+                        this._selDigestMode = UIToolkit.select(
+                                'digestMode',
+                                {
+                                    immediate: this.t('digestModeImmediate'),
+                                    hourly:    this.t('digestModeHourly'),
+                                    daily:     this.t('digestModeDaily'),
+                                    weekly:    this.t('digestModeWeekly'),
+                                },
+                                this.principal.digestMode || 'immediate')
+                            .id('sel-digest-mode')),
                 // Submit button
                 UIToolkit.div('dialog-centered')
                     .append(this._btnSave = UIToolkit.submit(this.t('actionSave'), false)),
@@ -96,6 +111,7 @@ export class SettingsDialog extends Dialog {
                 notifyModerator:     !!this._cbNotifyModerator?.isChecked,
                 notifyReplies:       !!this._cbNotifyReplies?.isChecked,
                 notifyCommentStatus: !!this._cbNotifyCommentStatus?.isChecked,
+                digestMode:          (this._selDigestMode?.val || 'immediate') as DigestMode,
             }));
 
         // Close the dialog
@@ -4,6 +4,7 @@ import { CommentSort, TranslateFunc } from './models';
 
 export class ThreadToolbar extends Wrap<HTMLDivElement> {
 
+    private readonly btnSubscribe:  Wrap<HTMLButtonElement>;
     private readonly countBar:      Wrap<HTMLDivElement>;
     private readonly sortBar:       Wrap<HTMLDivElement>;
     private readonly btnByScore?:   Wrap<HTMLButtonElement>;
@@ -14,6 +15,7 @@ export class ThreadToolbar extends Wrap<HTMLDivElement> {
         private readonly t: TranslateFunc,
         private readonly onRssClick: (ref: Wrap<any>) => void,
         private readonly onSortChange: (cs: CommentSort) => void,
+        private readonly onSubscribeToggle: (btn: Wrap<HTMLButtonElement>) => void,
         private curSort: CommentSort | undefined,
         allowRss: boolean,
         allowByScore: boolean,
@@ -22,7 +24,9 @@ export class ThreadToolbar extends Wrap<HTMLDivElement> {
         this.append(
             // Thread buttons
             UIToolkit.div('thread-buttons')
-                .append(allowRss && UIToolkit.button('RSS', btn => this.onRssClick(btn), 'btn-sm', 'btn-link')),
+                .append(
+                    allowRss && UIToolkit.button('RSS', btn => this.onRssClick(btn), 'btn-sm', 'btn-link'),
+                    this.btnSubscribe = UIToolkit.button('', btn => this.onSubscribeToggle(btn), 'btn-sm', 'btn-link', 'hidden')),
             // Comment count
             this.countBar = UIToolkit.div('comment-count'),
             // Sort buttons
@@ -49,6 +53,13 @@ export class ThreadToolbar extends Wrap<HTMLDivElement> {
         this.sortBar .setClasses(!n, 'hidden');
     }
 
+    /** Set the page subscription status of the current user. Undefined hides the Subscribe button. */
+    set subscribed(b: boolean | undefined) {
+        this.btnSubscribe
+            .inner(this.t(b ? 'actionUnsubscribe' : 'actionSubscribe'))
+            .setClasses(b === undefined, 'hidden');
+    }
+
     private setSort(cs: CommentSort | undefined) {
         const chg = this.curSort !== cs;
 
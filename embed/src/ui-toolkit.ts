@@ -147,6 +147,19 @@ export class UIToolkit {
             .on('blur', t => t.classes('touched'));
     }
 
+    /**
+     * Create and return a new select element.
+     * @param name Name of the element.
+     * @param options Options to select from, as a value-to-label map.
+     * @param value Initially selected value.
+     */
+    static select(name: string, options: Record<string, string>, value: string): Wrap<HTMLSelectElement> {
+        return Wrap.new('select')
+            .attr({name})
+            .append(...Object.entries(options).map(([v, label]) => Wrap.new('option').attr({value: v}).inner(label)))
+            .value(value);
+    }
+
     /**
      * Create and return a new textarea element.
      */
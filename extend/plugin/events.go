@@ -3,6 +3,8 @@
 
 package plugin
 
+import "github.com/google/uuid"
+
 // UserPayload is implemented by events carrying a user
 type UserPayload interface {
 	// User payload
@@ -65,3 +67,150 @@ type UserLoginLockedStatusEvent struct {
 type UserMadeSuperuserEvent struct {
 	UserUpdateEvent
 }
+
+// ---------------------------------------------------------------------------------------------------------------------
+
+// CommentPayload is implemented by events carrying a comment
+type CommentPayload interface {
+	// Comment payload
+	Comment() *Comment
+	// SetComment updates the comment payload
+	SetComment(*Comment)
+}
+
+// CommentEvent is an event related to comment, which implements CommentPayload
+type CommentEvent struct {
+	comment *Comment
+}
+
+func (e *CommentEvent) Comment() *Comment {
+	return e.comment
+}
+
+func (e *CommentEvent) SetComment(c *Comment) {
+	e.comment = c
+}
+
+// ---------------------------------------------------------------------------------------------------------------------
+
+// CommentBeforeCreateEvent is fired before a new comment is persisted. The plugin may modify the comment (if only
+// Markdown is changed, HTML gets re-rendered) or reject it by returning an error
+type CommentBeforeCreateEvent struct {
+	CommentEvent
+}
+
+// CommentCreateEvent is fired after a new comment has been persisted. Changes to the comment are ignored
+type CommentCreateEvent struct {
+	CommentEvent
+}
+
+// CommentBeforeEditEvent is fired before the text of an existing comment is updated, with the payload carrying the new
+// Markdown. The plugin may modify the Markdown or reject the edit by returning an error
+type CommentBeforeEditEvent struct {
+	CommentEvent
+}
+
+// CommentModeratedEvent is fired before the moderation status of a comment is persisted. The plugin may modify the
+// status or reject the change by returning an error
+type CommentModeratedEvent struct {
+	CommentEvent
+}
+
+// CommentDeleteEvent is fired before a comment is marked deleted. The plugin may prevent the deletion by returning an
+// error
+type CommentDeleteEvent struct {
+	CommentEvent
+}
+
+// CommentVoteEvent is fired before a vote for a comment is cast. The plugin may reject the vote by returning an error
+type CommentVoteEvent struct {
+	CommentEvent
+	VoterID   uuid.UUID // ID of the voting user
+	Direction int8      // Vote direction: -1 for a downvote, 1 for an upvote, 0 for revoking the vote
+}
+
+// ---------------------------------------------------------------------------------------------------------------------
+
+// DomainPayload is implemented by events carrying a domain
+type DomainPayload interface {
+	// Domain payload
+	Domain() *Domain
+	// SetDomain updates the domain payload
+	SetDomain(*Domain)
+}
+
+// DomainEvent is an event related to domain, which implements DomainPayload
+type DomainEvent struct {
+	domain *Domain
+}
+
+func (e *DomainEvent) Domain() *Domain {
+	return e.domain
+}
+
+func (e *DomainEvent) SetDomain(d *Domain) {
+	e.domain = d
+}
+
+// ---------------------------------------------------------------------------------------------------------------------
+
+// DomainCreateEvent is fired before a new domain is persisted
+type DomainCreateEvent struct {
+	DomainEvent
+}
+
+// DomainUpdateEvent is fired before domain properties are updated
+type DomainUpdateEvent struct {
+	DomainEvent
+}
+
+// DomainDeleteEvent is fired before a domain and all its dependent objects are deleted
+type DomainDeleteEvent struct {
+	DomainEvent
+}
+
+// DomainClearEvent is fired before all domain's pages, comments, votes, and views are removed
+type DomainClearEvent struct {
+	DomainUpdateEvent
+}
+
+// DomainPurgeEvent is fired before deleted comments and/or comments by deleted users are permanently removed from a
+// domain
+type DomainPurgeEvent struct {
+	DomainUpdateEvent
+}
+
+// DomainReadonlyEvent is fired before the domain's readonly status is changed, with the payload carrying the new status
+type DomainReadonlyEvent struct {
+	DomainUpdateEvent
+}
+
+// ---------------------------------------------------------------------------------------------------------------------
+
+// PagePayload is implemented by events carrying a domain page
+type PagePayload interface {
+	// Page payload
+	Page() *DomainPage
+	// SetPage updates the page payload
+	SetPage(*DomainPage)
+}
+
+// PageEvent is an event related to domain page, which implements PagePayload
+type PageEvent struct {
+	page *DomainPage
+}
+
+func (e *PageEvent) Page() *DomainPage {
+	return e.page
+}
+
+func (e *PageEvent) SetPage(p *DomainPage) {
+	e.page = p
+}
+
+// ---------------------------------------------------------------------------------------------------------------------
+
+// PageCreateEvent is fired after a new domain page has been persisted. Changes to the page are ignored
+type PageCreateEvent struct {
+	PageEvent
+}
@@ -35,6 +35,8 @@ type HostApp interface {
 	CreateLogger(module string) Logger
 	// DomainAttrStore returns an instance of the domain attributes store for the plugin
 	DomainAttrStore() AttrStore
+	// DomainStore returns an instance of the domain store
+	DomainStore() DomainStore
 	// UserAttrStore returns an instance of the user attributes store for the plugin
 	UserAttrStore() AttrStore
 	// UserStore returns an instance of the user store
@@ -54,6 +56,14 @@ type AttrStore interface {
 	Set(ownerID *uuid.UUID, attr AttrValues) error
 }
 
+// DomainStore allows to retrieve Comentario domains
+type DomainStore interface {
+	// FindDomainByHost finds and returns a domain by the given host
+	FindDomainByHost(host string) (*Domain, error)
+	// FindDomainByID finds and returns a domain by the given domain ID
+	FindDomainByID(id *uuid.UUID) (*Domain, error)
+}
+
 // UserStore allows to retrieve Comentario users
 type UserStore interface {
 	// FindUserByID finds and returns a user by the given user ID
@@ -101,11 +111,12 @@ type MessageEntry struct {
 // Config describes plugin configuration
 // Warning: Unstable API
 type Config struct {
-	Path          string         // Path the plugin's handlers are invoked on
-	UIResources   []UIResource   // UI resources to be loaded for the plugin
-	UIPlugs       []UIPlug       // UI plugs
-	Messages      []MessageEntry // Plugin messages
-	XSRFSafePaths []string       // API endpoint path prefixes to exclude from XSRF protection (for methods other than GET/HEAD/OPTIONS), relative to plugin API root (may contain leading "/")
+	Path          string           // Path the plugin's handlers are invoked on
+	UIResources   []UIResource     // UI resources to be loaded for the plugin
+	UIPlugs       []UIPlug         // UI plugs
+	Messages      []MessageEntry   // Plugin messages
+	XSRFSafePaths []string         // API endpoint path prefixes to exclude from XSRF protection (for methods other than GET/HEAD/OPTIONS), relative to plugin API root (may contain leading "/")
+	Scanners      []CommentScanner // Comment scanners provided by the plugin, which become available as domain extensions
 }
 
 // YAMLDecoder allows for unmarshalling configuration into a user-defined structure, which provides `yaml` metadata
@@ -134,3 +145,32 @@ type ComentarioPlugin interface {
 	// the passed event's payload as necessary
 	HandleEvent(event any) error
 }
+
+// CommentScanContext provides the context for scanning a comment
+// Warning: Unstable API
+type CommentScanContext struct {
+	Request *http.Request // HTTP request sent by the commenter
+	Comment *Comment      // Comment being submitted
+	Domain  *Domain       // Comment's domain
+	Page    *DomainPage   // Comment's domain page
+	User    *User         // User who submitted the comment
+	IsEdit  bool          // Whether the comment was edited, as opposed to a new comment
+}
+
+// CommentScanner can scan a comment for inappropriate content. Each scanner is exposed as a domain extension, which
+// domain owners can enable and configure per domain
+// Warning: Unstable API
+type CommentScanner interface {
+	// ID returns a unique domain extension ID for the scanner, which must start with a letter and consist of no more
+	// than 32 letters, digits, dots, dashes, or underscores. It's advisable to prefix it with the plugin ID
+	ID() string
+	// Name returns the extension's display name
+	Name() string
+	// DefaultConfig returns the extension's default configuration, a linebreak-separated list of key=value pairs
+	DefaultConfig() string
+	// KeyRequired returns whether the scanner requires an API key to be configured at domain level
+	KeyRequired() bool
+	// Scan scans the provided comment for inappropriate content and returns whether it was found, and a reason for
+	// that. The config map contains the extension configuration of the comment's domain
+	Scan(config map[string]string, ctx *CommentScanContext) (bool, string, error)
+}
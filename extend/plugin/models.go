@@ -6,6 +6,7 @@ package plugin
 import (
 	"github.com/google/uuid"
 	"net/url"
+	"time"
 )
 
 // HostConfig provides access to the host app configuration
@@ -14,6 +15,31 @@ type HostConfig struct {
 	DefaultLangID string   // Default interface language ID
 }
 
+// Domain represents a domain registered in Comentario
+type Domain struct {
+	ID            uuid.UUID // Unique domain ID
+	Name          string    // Domain display name
+	Host          string    // Domain host
+	CreatedTime   time.Time // When the domain was created
+	IsHTTPS       bool      // Whether HTTPS should be used to resolve URLs on this domain (as opposed to HTTP)
+	IsReadonly    bool      // Whether the domain is readonly (no new comments are allowed)
+	AuthAnonymous bool      // Whether anonymous comments are allowed
+	AuthLocal     bool      // Whether local authentication is allowed
+	AuthSSO       bool      // Whether SSO authentication is allowed
+	CountComments int64     // Total number of comments
+	CountViews    int64     // Total number of views
+}
+
+// DomainPage represents a page on a specific domain
+type DomainPage struct {
+	ID          uuid.UUID // Unique page ID
+	DomainID    uuid.UUID // ID of the domain
+	Path        string    // Page path
+	Title       string    // Page title
+	IsReadonly  bool      // Whether the page is readonly (no new comments are allowed)
+	CreatedTime time.Time // When the page was created
+}
+
 // User represents an authenticated or an anonymous user
 type User struct {
 	ID          uuid.UUID // Unique user ID
@@ -25,3 +51,21 @@ type User struct {
 	Banned      bool      // Whether the user is banned
 	IsLocked    bool      // Whether the user is locked out
 }
+
+// Comment represents a comment
+type Comment struct {
+	ID            uuid.UUID     // Unique comment ID
+	ParentID      uuid.NullUUID // Parent comment ID, null if it's a root comment on the page
+	PageID        uuid.UUID     // Reference to the page
+	Markdown      string        // Comment text in markdown
+	HTML          string        // Rendered comment text in HTML
+	Score         int           // Comment score
+	IsSticky      bool          // Whether the comment is sticky (attached to the top of page)
+	IsApproved    bool          // Whether the comment is approved and can be seen by everyone
+	IsPending     bool          // Whether the comment is pending approval
+	IsDeleted     bool          // Whether the comment is marked as deleted
+	PendingReason string        // The reason for the pending status
+	AuthorName    string        // Name of the author, in case the user isn't registered
+	UserCreated   uuid.NullUUID // Reference to the user who created the comment
+	CreatedTime   time.Time     // When the comment was created
+}
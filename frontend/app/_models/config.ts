@@ -10,7 +10,14 @@ export enum DomainConfigItemKey {
     commentDeletionModerator = 'comments.deletion.moderator',
     commentEditingAuthor     = 'comments.editing.author',
     commentEditingModerator  = 'comments.editing.moderator',
+    commentEditingRemoderate = 'comments.editing.remoderate',
     enableCommentVoting      = 'comments.enableVoting',
+    flaggingAnonymous        = 'comments.flagging.anonymous',
+    flaggingEnabled          = 'comments.flagging.enabled',
+    flaggingThreshold        = 'comments.flagging.threshold',
+    rateLimitPerIP           = 'comments.rateLimit.perIP',
+    rateLimitPerPage         = 'comments.rateLimit.perPage',
+    rateLimitPerUser         = 'comments.rateLimit.perUser',
     enableRss                = 'comments.rss.enabled',
     showDeletedComments      = 'comments.showDeleted',
     maxCommentLength         = 'comments.text.maxLength',
@@ -29,6 +36,7 @@ export enum InstanceConfigItemKey {
     authSignupConfirmCommenter             = 'auth.signup.confirm.commenter',
     authSignupConfirmUser                  = 'auth.signup.confirm.user',
     authSignupEnabled                      = 'auth.signup.enabled',
+    authTotpRequiredForOwners              = 'auth.totp.requiredForOwners',
     integrationsUseGravatar                = 'integrations.useGravatar',
     operationNewOwnerEnabled               = 'operation.newOwner.enabled',
     // Domain defaults
@@ -36,7 +44,14 @@ export enum InstanceConfigItemKey {
     domainDefaultsCommentDeletionModerator = ConfigKeyDomainDefaultsPrefix + DomainConfigItemKey.commentDeletionModerator,
     domainDefaultsCommentEditingAuthor     = ConfigKeyDomainDefaultsPrefix + DomainConfigItemKey.commentEditingAuthor,
     domainDefaultsCommentEditingModerator  = ConfigKeyDomainDefaultsPrefix + DomainConfigItemKey.commentEditingModerator,
+    domainDefaultsCommentEditingRemoderate = ConfigKeyDomainDefaultsPrefix + DomainConfigItemKey.commentEditingRemoderate,
     domainDefaultsEnableCommentVoting      = ConfigKeyDomainDefaultsPrefix + DomainConfigItemKey.enableCommentVoting,
+    domainDefaultsFlaggingAnonymous        = ConfigKeyDomainDefaultsPrefix + DomainConfigItemKey.flaggingAnonymous,
+    domainDefaultsFlaggingEnabled          = ConfigKeyDomainDefaultsPrefix + DomainConfigItemKey.flaggingEnabled,
+    domainDefaultsFlaggingThreshold        = ConfigKeyDomainDefaultsPrefix + DomainConfigItemKey.flaggingThreshold,
+    domainDefaultsRateLimitPerIP           = ConfigKeyDomainDefaultsPrefix + DomainConfigItemKey.rateLimitPerIP,
+    domainDefaultsRateLimitPerPage         = ConfigKeyDomainDefaultsPrefix + DomainConfigItemKey.rateLimitPerPage,
+    domainDefaultsRateLimitPerUser         = ConfigKeyDomainDefaultsPrefix + DomainConfigItemKey.rateLimitPerUser,
     domainDefaultsEnableRss                = ConfigKeyDomainDefaultsPrefix + DomainConfigItemKey.enableRss,
     domainDefaultsShowDeletedComments      = ConfigKeyDomainDefaultsPrefix + DomainConfigItemKey.showDeletedComments,
     domainDefaultsMaxCommentLength         = ConfigKeyDomainDefaultsPrefix + DomainConfigItemKey.maxCommentLength,
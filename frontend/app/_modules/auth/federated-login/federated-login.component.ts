@@ -88,6 +88,6 @@ export class FederatedLoginComponent {
     }
 
     getButtonClass(provider: FederatedIdentityProvider) {
-        return provider.id.startsWith('oidc:') ? 'btn-dark' : `btn-${provider.id}`;
+        return provider.id.startsWith('oidc:') || provider.id.startsWith('saml:') ? 'btn-dark' : `btn-${provider.id}`;
     }
 }
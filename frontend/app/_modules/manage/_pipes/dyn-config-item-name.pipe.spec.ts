@@ -21,6 +21,7 @@ describe('DynConfigItemNamePipe', () => {
         {in: 'auth.signup.confirm.commenter',               want: 'New commenters must confirm their email'},
         {in: 'auth.signup.confirm.user',                    want: 'New users must confirm their email'},
         {in: 'auth.signup.enabled',                         want: 'Enable registration of new users'},
+        {in: 'auth.totp.requiredForOwners',                 want: 'Require two-factor authentication for domain owners'},
         {in: 'integrations.useGravatar',                    want: 'Use Gravatar for user avatars'},
         {in: 'operation.newOwner.enabled',                  want: 'Non-owner users can add domains'},
         // Domain defaults
@@ -28,7 +29,14 @@ describe('DynConfigItemNamePipe', () => {
         {in: 'domain.defaults.comments.deletion.moderator', want: 'Allow moderators to delete comments'},
         {in: 'domain.defaults.comments.editing.author',     want: 'Allow comment authors to edit comments'},
         {in: 'domain.defaults.comments.editing.moderator',  want: 'Allow moderators to edit comments'},
+        {in: 'domain.defaults.comments.editing.remoderate', want: 'Re-moderate comments changed on edit by (%)'},
         {in: 'domain.defaults.comments.enableVoting',       want: 'Enable voting on comments'},
+        {in: 'domain.defaults.comments.flagging.anonymous', want: 'Allow unregistered users to flag comments'},
+        {in: 'domain.defaults.comments.flagging.enabled',   want: 'Allow users to flag comments'},
+        {in: 'domain.defaults.comments.flagging.threshold', want: 'Flags needed to send a comment to moderation'},
+        {in: 'domain.defaults.comments.rateLimit.perIP',    want: 'Max. comments per minute from an IP address'},
+        {in: 'domain.defaults.comments.rateLimit.perPage',  want: 'Max. comments per minute on a page'},
+        {in: 'domain.defaults.comments.rateLimit.perUser',  want: 'Max. comments per minute by a user'},
         {in: 'domain.defaults.comments.rss.enabled',        want: 'Enable comment RSS feeds'},
         {in: 'domain.defaults.comments.showDeleted',        want: 'Show deleted comments'},
         {in: 'domain.defaults.comments.text.maxLength',     want: 'Maximum comment text length'},
@@ -43,7 +51,14 @@ describe('DynConfigItemNamePipe', () => {
         {in: 'comments.deletion.moderator',                 want: 'Allow moderators to delete comments'},
         {in: 'comments.editing.author',                     want: 'Allow comment authors to edit comments'},
         {in: 'comments.editing.moderator',                  want: 'Allow moderators to edit comments'},
+        {in: 'comments.editing.remoderate',                 want: 'Re-moderate comments changed on edit by (%)'},
         {in: 'comments.enableVoting',                       want: 'Enable voting on comments'},
+        {in: 'comments.flagging.anonymous',                 want: 'Allow unregistered users to flag comments'},
+        {in: 'comments.flagging.enabled',                   want: 'Allow users to flag comments'},
+        {in: 'comments.flagging.threshold',                 want: 'Flags needed to send a comment to moderation'},
+        {in: 'comments.rateLimit.perIP',                    want: 'Max. comments per minute from an IP address'},
+        {in: 'comments.rateLimit.perPage',                  want: 'Max. comments per minute on a page'},
+        {in: 'comments.rateLimit.perUser',                  want: 'Max. comments per minute by a user'},
         {in: 'comments.rss.enabled',                        want: 'Enable comment RSS feeds'},
         {in: 'comments.showDeleted',                        want: 'Show deleted comments'},
         {in: 'comments.text.maxLength',                     want: 'Maximum comment text length'},
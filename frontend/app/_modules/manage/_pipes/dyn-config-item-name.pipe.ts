@@ -12,6 +12,7 @@ export class DynConfigItemNamePipe implements PipeTransform {
         [InstanceConfigItemKey.authSignupConfirmCommenter]:             $localize`New commenters must confirm their email`,
         [InstanceConfigItemKey.authSignupConfirmUser]:                  $localize`New users must confirm their email`,
         [InstanceConfigItemKey.authSignupEnabled]:                      $localize`Enable registration of new users`,
+        [InstanceConfigItemKey.authTotpRequiredForOwners]:              $localize`Require two-factor authentication for domain owners`,
         [InstanceConfigItemKey.integrationsUseGravatar]:                $localize`Use Gravatar for user avatars`,
         [InstanceConfigItemKey.operationNewOwnerEnabled]:               $localize`Non-owner users can add domains`,
         // Domain defaults
@@ -19,7 +20,14 @@ export class DynConfigItemNamePipe implements PipeTransform {
         [InstanceConfigItemKey.domainDefaultsCommentDeletionModerator]: $localize`Allow moderators to delete comments`,
         [InstanceConfigItemKey.domainDefaultsCommentEditingAuthor]:     $localize`Allow comment authors to edit comments`,
         [InstanceConfigItemKey.domainDefaultsCommentEditingModerator]:  $localize`Allow moderators to edit comments`,
+        [InstanceConfigItemKey.domainDefaultsCommentEditingRemoderate]: $localize`Re-moderate comments changed on edit by (%)`,
         [InstanceConfigItemKey.domainDefaultsEnableCommentVoting]:      $localize`Enable voting on comments`,
+        [InstanceConfigItemKey.domainDefaultsFlaggingAnonymous]:        $localize`Allow unregistered users to flag comments`,
+        [InstanceConfigItemKey.domainDefaultsFlaggingEnabled]:          $localize`Allow users to flag comments`,
+        [InstanceConfigItemKey.domainDefaultsFlaggingThreshold]:        $localize`Flags needed to send a comment to moderation`,
+        [InstanceConfigItemKey.domainDefaultsRateLimitPerIP]:           $localize`Max. comments per minute from an IP address`,
+        [InstanceConfigItemKey.domainDefaultsRateLimitPerPage]:         $localize`Max. comments per minute on a page`,
+        [InstanceConfigItemKey.domainDefaultsRateLimitPerUser]:         $localize`Max. comments per minute by a user`,
         [InstanceConfigItemKey.domainDefaultsEnableRss]:                $localize`Enable comment RSS feeds`,
         [InstanceConfigItemKey.domainDefaultsShowDeletedComments]:      $localize`Show deleted comments`,
         [InstanceConfigItemKey.domainDefaultsMaxCommentLength]:         $localize`Maximum comment text length`,
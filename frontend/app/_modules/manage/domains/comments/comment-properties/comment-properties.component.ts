@@ -7,7 +7,16 @@ import { NgbModal, NgbNavModule } from '@ng-bootstrap/ng-bootstrap';
 import { FaIconComponent } from '@fortawesome/angular-fontawesome';
 import { faCheck, faTrashAlt, faXmark } from '@fortawesome/free-solid-svg-icons';
 import { Highlight } from 'ngx-highlightjs';
-import { ApiGeneralService, Comment, Commenter, DomainPage, Principal, User } from '../../../../../../generated-api';
+import {
+    ApiGeneralService,
+    Comment,
+    Commenter,
+    CommentRevision,
+    DomainPage,
+    Principal,
+    TextDiffChunk,
+    User,
+} from '../../../../../../generated-api';
 import { DomainMeta, DomainSelectorService } from '../../../_services/domain-selector.service';
 import { ProcessingStatus } from '../../../../../_utils/processing-status';
 import { AnonymousUser, Paths } from '../../../../../_utils/consts';
@@ -81,12 +90,28 @@ export class CommentPropertiesComponent implements OnInit {
     /** Optional action extracted from query param. */
     action?: string;
 
+    /** Revisions of the comment text, oldest first (only for edited comments and moderators). */
+    revisions?: CommentRevision[];
+
+    /** Users who authored the revisions, indexed by ID. */
+    revisionUsers = new Map<string, User>();
+
+    /** Number of the revision whose difference from the previous one is displayed. */
+    diffRevision?: number;
+
+    /** Chunks of the displayed revision difference. */
+    diffChunks?: TextDiffChunk[];
+
+    /** Extent of the displayed revision difference, in percent. */
+    diffChangePercent?: number;
+
     readonly Paths = Paths;
     readonly AnonymousUser = AnonymousUser;
 
-    readonly loading  = new ProcessingStatus();
-    readonly deleting = new ProcessingStatus();
-    readonly updating = new ProcessingStatus();
+    readonly loading     = new ProcessingStatus();
+    readonly deleting    = new ProcessingStatus();
+    readonly updating    = new ProcessingStatus();
+    readonly loadingDiff = new ProcessingStatus();
 
     // Icons
     readonly faCheck    = faCheck;
@@ -176,6 +201,9 @@ export class CommentPropertiesComponent implements OnInit {
                     }
                 }
 
+                // Load the revisions of an edited comment
+                this.loadRevisions();
+
                 // If there's a comment and an action, apply it
                 if (this.comment && this.action) {
                     this.runAction();
@@ -227,6 +255,45 @@ export class CommentPropertiesComponent implements OnInit {
             });
     }
 
+    /**
+     * Show the difference between the revision with the given number and its predecessor.
+     */
+    showDiff(number: number) {
+        // Clicking the same revision again hides the difference
+        if (this.diffRevision === number) {
+            this.diffRevision = undefined;
+            this.diffChunks = undefined;
+            return;
+        }
+
+        this.diffRevision = number;
+        this.diffChunks = undefined;
+        this.api.commentRevisionDiff(this.comment!.id!, number - 1, number)
+            .pipe(this.loadingDiff.processing())
+            .subscribe(r => {
+                this.diffChunks        = r.chunks;
+                this.diffChangePercent = r.changePercent;
+            });
+    }
+
+    private loadRevisions() {
+        this.revisions = undefined;
+        this.revisionUsers.clear();
+        this.diffRevision = undefined;
+        this.diffChunks = undefined;
+
+        // Only moderators can see revisions, which only exist for edited comments
+        if (!this.comment?.editedTime || !this.domainMeta?.canModerateDomain) {
+            return;
+        }
+
+        this.api.commentRevisionList(this.comment.id!)
+            .subscribe(r => {
+                this.revisions = r.revisions;
+                r.users?.forEach(u => this.revisionUsers.set(u.id!, u));
+            });
+    }
+
     private runAction() {
         switch (this.action) {
             case 'approve':
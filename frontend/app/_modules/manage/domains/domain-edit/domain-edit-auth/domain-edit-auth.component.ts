@@ -1,7 +1,7 @@
 import { Component, Input } from '@angular/core';
 import { faExclamationTriangle } from '@fortawesome/free-solid-svg-icons';
 import { FormGroup, ReactiveFormsModule } from '@angular/forms';
-import { FederatedIdentityProvider } from '../../../../../../generated-api';
+import { DomainSsoType, FederatedIdentityProvider } from '../../../../../../generated-api';
 import { DynamicConfig } from '../../../../../_models/config';
 import { InfoBlockComponent } from '../../../../tools/info-block/info-block.component';
 import { InfoIconComponent } from '../../../../tools/info-icon/info-icon.component';
@@ -39,6 +39,8 @@ export class DomainEditAuthComponent {
     @Input({required: true})
     federatedIdps?: FederatedIdentityProvider[];
 
+    readonly SsoType = DomainSsoType;
+
     // Icons
     readonly faExclamationTriangle = faExclamationTriangle;
 }
@@ -13,6 +13,7 @@ import {
     Domain,
     DomainExtension,
     DomainModNotifyPolicy,
+    DomainSsoType,
 } from '../../../../../generated-api';
 import { Paths } from '../../../../_utils/consts';
 import { ConfigService } from '../../../../_services/config.service';
@@ -155,12 +156,14 @@ export class DomainEditComponent implements OnInit {
                                 defaultSort: d.defaultSort,
                             },
                             auth: {
-                                anonymous: d.authAnonymous,
-                                local:     d.authLocal,
-                                sso:       d.authSso,
-                                ssoUrl:    d.ssoUrl,
-                                ssoNonInt: d.ssoNonInteractive,
-                                fedIdps:   this.fedIdps?.map(idp => !!this.domainMeta!.federatedIdpIds?.includes(idp.id)),
+                                anonymous:  d.authAnonymous,
+                                local:      d.authLocal,
+                                sso:        d.authSso,
+                                ssoUrl:     d.ssoUrl,
+                                ssoNonInt:  d.ssoNonInteractive,
+                                ssoType:    d.ssoType || DomainSsoType.Hmac,
+                                ssoJwksUrl: d.ssoJwksUrl,
+                                fedIdps:    this.fedIdps?.map(idp => !!this.domainMeta!.federatedIdpIds?.includes(idp.id)),
                             },
                             mod: {
                                 anonymous:     d.modAnonymous,
@@ -226,6 +229,8 @@ export class DomainEditComponent implements OnInit {
                 authSso:           !!vals.auth.sso,
                 ssoUrl:            vals.auth.ssoUrl ?? '',
                 ssoNonInteractive: !!vals.auth.ssoNonInt,
+                ssoType:           vals.auth.ssoType ?? DomainSsoType.Hmac,
+                ssoJwksUrl:        vals.auth.ssoJwksUrl ?? '',
                 // Moderation
                 modAnonymous:      !!vals.mod.anonymous,
                 modAuthenticated:  !!vals.mod.authenticated,
@@ -291,16 +296,22 @@ export class DomainEditComponent implements OnInit {
                             defaultSort: CommentSort.Td,
                         }),
                         auth: this.fb.nonNullable.group({
-                            anonymous: false,
-                            local:     true,
-                            sso:       false,
-                            ssoUrl:    [
+                            anonymous:  false,
+                            local:      true,
+                            sso:        false,
+                            ssoUrl:     [
                                 {value: '', disabled: true},
                                 // Only allow insecure URL if the app itself runs on an HTTP host
                                 [Validators.required, XtraValidators.url(window.location.protocol === 'https:')],
                             ],
-                            ssoNonInt: false,
-                            fedIdps:   this.fb.array(Array(this.fedIdps?.length).fill(true)), // Enable all by default
+                            ssoNonInt:  false,
+                            ssoType:    {value: DomainSsoType.Hmac, disabled: true},
+                            ssoJwksUrl: [
+                                {value: '', disabled: true},
+                                // Only allow insecure URL if the app itself runs on an HTTP host
+                                [XtraValidators.url(window.location.protocol === 'https:')],
+                            ],
+                            fedIdps:    this.fb.array(Array(this.fedIdps?.length).fill(true)), // Enable all by default
                         }),
                         mod: this.fb.nonNullable.group({
                             anonymous:     true,
@@ -317,10 +328,17 @@ export class DomainEditComponent implements OnInit {
                         config: this.fb.nonNullable.group({}),
                     });
 
-                    // SSO URL is only relevant when SSO auth is enabled
-                    f.controls.auth.controls.sso.valueChanges
+                    // SSO URL is only relevant when SSO auth is enabled, and JWKS URL only for JWT SSO
+                    const ctlsAuth = f.controls.auth.controls;
+                    ctlsAuth.sso.valueChanges
+                        .pipe(untilDestroyed(this))
+                        .subscribe(b => {
+                            Utils.enableControls(b, ctlsAuth.ssoUrl, ctlsAuth.ssoNonInt, ctlsAuth.ssoType);
+                            Utils.enableControls(b && ctlsAuth.ssoType.value === DomainSsoType.Jwt, ctlsAuth.ssoJwksUrl);
+                        });
+                    ctlsAuth.ssoType.valueChanges
                         .pipe(untilDestroyed(this))
-                        .subscribe(b => Utils.enableControls(b, f.controls.auth.controls.ssoUrl, f.controls.auth.controls.ssoNonInt));
+                        .subscribe(t => Utils.enableControls(ctlsAuth.sso.value && t === DomainSsoType.Jwt, ctlsAuth.ssoJwksUrl));
 
                     // Disable numeric controls when the corresponding checkbox is off
                     f.controls.mod.controls.numCommentsOn.valueChanges
@@ -5,12 +5,12 @@ import { FormBuilder, ReactiveFormsModule, Validators } from '@angular/forms';
 import { FaIconComponent } from '@fortawesome/angular-fontawesome';
 import { faCheck, faExclamationTriangle } from '@fortawesome/free-solid-svg-icons';
 import { UntilDestroy, untilDestroyed } from '@ngneat/until-destroy';
-import { ApiGeneralService, Domain, ImportResult } from '../../../../../generated-api';
+import { Subscription, switchMap, takeWhile, timer } from 'rxjs';
+import { ApiGeneralService, Domain, ImportJob, ImportJobStatus, ImportReportItemKind } from '../../../../../generated-api';
 import { ProcessingStatus } from '../../../../_utils/processing-status';
 import { Animations } from '../../../../_utils/animations';
 import { Paths } from '../../../../_utils/consts';
 import { DomainSelectorService } from '../../_services/domain-selector.service';
-import { XtraValidators } from '../../../../_utils/xtra-validators';
 import { InfoIconComponent } from '../../../tools/info-icon/info-icon.component';
 import { SpinnerDirective } from '../../../tools/_directives/spinner.directive';
 import { ValidatableDirective } from '../../../tools/_directives/validatable.directive';
@@ -37,16 +37,23 @@ export class DomainImportComponent implements OnInit {
     /** Target domain. */
     domain?: Domain;
 
-    /** Import result. */
-    result?: ImportResult;
+    /** Import job being tracked, if any. */
+    job?: ImportJob;
 
     readonly Paths = Paths;
-    readonly importing = new ProcessingStatus();
+    readonly ImportJobStatus = ImportJobStatus;
+    readonly ImportReportItemKind = ImportReportItemKind;
+    readonly importing  = new ProcessingStatus();
+    readonly cancelling = new ProcessingStatus();
     readonly form = this.fb.nonNullable.group({
         source: ['comentario' as 'comentario' | 'disqus' | 'wordpress', [Validators.required]],
-        file:   [undefined as any, [Validators.required, XtraValidators.maxSize(10 * 1024 * 1024)]],
+        file:   [undefined as any, [Validators.required]],
+        dryRun: false,
     });
 
+    /** Subscription for polling the job's progress. */
+    private polling?: Subscription;
+
     // Icons
     readonly faCheck               = faCheck;
     readonly faExclamationTriangle = faExclamationTriangle;
@@ -65,10 +72,40 @@ export class DomainImportComponent implements OnInit {
         this.form.controls.source.setValue(source);
     }
 
+    /**
+     * Whether the tracked job is running.
+     */
+    get running(): boolean {
+        return this.job?.status === ImportJobStatus.Running;
+    }
+
+    /**
+     * Progress of the tracked job in percent.
+     */
+    get progress(): number {
+        return this.job?.fileSize ? Math.min(100, Math.round((this.job.bytesRead || 0) * 100 / this.job.fileSize)) : 0;
+    }
+
     ngOnInit(): void {
         this.domainSelectorSvc.domainMeta(true)
             .pipe(untilDestroyed(this))
-            .subscribe(meta => this.domain = meta.domain);
+            .subscribe(meta => {
+                const changed = meta.domain?.id !== this.domain?.id;
+                this.domain = meta.domain;
+
+                // Pick up an import running in the domain, if any
+                if (changed && this.domain) {
+                    this.job = undefined;
+                    this.polling?.unsubscribe();
+                    this.api.domainImportJobList(this.domain.id!)
+                        .subscribe(r => {
+                            const job = r.jobs?.find(j => j.status === ImportJobStatus.Running);
+                            if (job) {
+                                this.track(job);
+                            }
+                        });
+                }
+            });
     }
 
     submit() {
@@ -78,18 +115,52 @@ export class DomainImportComponent implements OnInit {
         // Submit the form if it's valid
         if (this.form.valid && this.domain) {
             const val = this.form.value;
-            this.api.domainImport(this.domain.id!, val.source!, val.file)
+            this.api.domainImport(this.domain.id!, val.source!, val.file, val.dryRun)
                 .pipe(this.importing.processing())
-                .subscribe(r => {
-                    this.result = r;
+                .subscribe(job => this.track(job));
+        }
+    }
 
-                    // Reload the domain to update its metrics
-                    this.domainSelectorSvc.reload();
-                });
+    cancel() {
+        if (this.job && this.domain) {
+            this.api.domainImportJobCancel(this.domain.id!, this.job.id)
+                .pipe(this.cancelling.processing())
+                .subscribe(job => this.job = job);
         }
     }
 
+    /**
+     * Discard the tracked (finished) job and return to the import form, for example, to proceed with a real import after
+     * a dry run.
+     */
+    startOver() {
+        this.job = undefined;
+        this.form.reset({source: this.source});
+    }
+
     onFileSelected(event: Event) {
         this.form.controls.file.setValue((event.target as HTMLInputElement).files?.[0]);
     }
+
+    /**
+     * Start tracking the given job, polling its progress until it finishes.
+     */
+    private track(job: ImportJob) {
+        this.job = job;
+        this.polling?.unsubscribe();
+        this.polling = timer(1000, 1000)
+            .pipe(
+                untilDestroyed(this),
+                switchMap(() => this.api.domainImportJobGet(job.domainId, job.id)),
+                // Stop once the job isn't running anymore, including the last update
+                takeWhile(j => j.status === ImportJobStatus.Running, true))
+            .subscribe(j => {
+                this.job = j;
+
+                // Reload the domain to update its metrics once the job is finished
+                if (j.status !== ImportJobStatus.Running) {
+                    this.domainSelectorSvc.reload();
+                }
+            });
+    }
 }
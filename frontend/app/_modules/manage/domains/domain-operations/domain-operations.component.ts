@@ -24,6 +24,8 @@ import { DomainBadgeComponent } from '../../badges/domain-badge/domain-badge.com
 import { SpinnerDirective } from '../../../tools/_directives/spinner.directive';
 import { ConfirmDirective } from '../../../tools/_directives/confirm.directive';
 
+type DomainExportFormat = 'comentario' | 'ndjson' | 'csv' | 'disqus';
+
 @UntilDestroy()
 @Component({
     selector: 'app-domain-operations',
@@ -58,6 +60,24 @@ export class DomainOperationsComponent implements OnInit {
         userCreatedDeleted: false,
     });
 
+    readonly exportForm = this.fb.nonNullable.group({
+        format:       'comentario' as DomainExportFormat,
+        from:         '',
+        to:           '',
+        since:        '',
+        pathPrefix:   '',
+        approvedOnly: false,
+        deleted:      true,
+    });
+
+    /** Exported file extensions (before compression), per export format. */
+    readonly exportExtensions: Record<DomainExportFormat, string> = {
+        comentario: 'json',
+        ndjson:     'ndjson',
+        csv:        'csv',
+        disqus:     'xml',
+    };
+
     // Icons
     readonly faAngleDown       = faAngleDown;
     readonly faCalendarXmark   = faCalendarXmark;
@@ -90,11 +110,21 @@ export class DomainOperationsComponent implements OnInit {
     }
 
     exportData() {
-        // Trigger an export
-        this.api.domainExport(this.domain!.id!)
+        // Trigger an export. Dates are converted into timestamps in the local timezone
+        const f = this.exportForm.getRawValue();
+        const ts = (s: string) => s ? new Date(`${s}T00:00:00`).toISOString() : undefined;
+        this.api.domainExport(
+                this.domain!.id!,
+                f.format,
+                ts(f.from),
+                ts(f.to),
+                ts(f.since),
+                f.pathPrefix || undefined,
+                f.approvedOnly,
+                f.deleted)
             .pipe(this.downloading.processing())
             .subscribe(b => {
-                const filename = `${this.domain!.host}-${new Date().toISOString()}.json.gz`.replaceAll(':', '');
+                const filename = `${this.domain!.host}-${new Date().toISOString()}.${this.exportExtensions[f.format]}.gz`.replaceAll(':', '');
 
                 // Create a link element
                 const a = this.doc.createElement('a');
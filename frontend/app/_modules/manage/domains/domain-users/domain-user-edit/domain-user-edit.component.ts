@@ -4,7 +4,7 @@ import { Router, RouterLink } from '@angular/router';
 import { combineLatestWith, ReplaySubject, switchMap } from 'rxjs';
 import { filter } from 'rxjs/operators';
 import { UntilDestroy, untilDestroyed } from '@ngneat/until-destroy';
-import { ApiGeneralService, DomainUser, DomainUserRole, Principal } from '../../../../../../generated-api';
+import { ApiGeneralService, DomainUser, DomainUserDigestMode, DomainUserRole, Principal } from '../../../../../../generated-api';
 import { DomainSelectorService } from '../../../_services/domain-selector.service';
 import { ProcessingStatus } from '../../../../../_utils/processing-status';
 import { Paths } from '../../../../../_utils/consts';
@@ -45,8 +45,11 @@ export class DomainUserEditComponent implements OnInit {
         notifyReplies:       false,
         notifyModerator:     false,
         notifyCommentStatus: false,
+        digestMode:          DomainUserDigestMode.Immediate,
     });
 
+    readonly DigestMode = DomainUserDigestMode;
+
     private readonly id$ = new ReplaySubject<string>(1);
 
     constructor(
@@ -85,6 +88,7 @@ export class DomainUserEditComponent implements OnInit {
                     notifyReplies:       du.notifyReplies,
                     notifyModerator:     du.notifyModerator,
                     notifyCommentStatus: du.notifyCommentStatus,
+                    digestMode:          du.digestMode,
                 });
 
                 // Only superuser can change their own role
@@ -109,6 +113,7 @@ export class DomainUserEditComponent implements OnInit {
                         notifyReplies:       val.notifyReplies,
                         notifyModerator:     val.notifyModerator,
                         notifyCommentStatus: val.notifyCommentStatus,
+                        digestMode:          val.digestMode,
                     })
                 .pipe(this.saving.processing())
                 .subscribe(() => {
@@ -43,6 +43,9 @@ export class IdentityProviderIconComponent {
             case '':
                 return this.sso ? faIdCard : undefined;
         }
+        if (this.idpId.startsWith('saml:')) {
+            return faIdCard;
+        }
         return this.idpId.startsWith('oidc:') ? faOpenid : faQuestionCircle;
     }
 }
@@ -38,6 +38,7 @@ var (
 	ErrorUnknown = &Error{Message: "Internal server error"}
 
 	ErrorBadToken              = &Error{ID: "bad-token", Message: "Token is missing or invalid"}
+	ErrorCommentAssigned       = &Error{ID: "comment-assigned", Message: "Comment is assigned to another moderator"}
 	ErrorCommentTextTooLong    = &Error{ID: "comment-text-too-long", Message: "Comment text is too long"}
 	ErrorDeletingLastSuperuser = &Error{ID: "deleting-last-superuser", Message: "Can't delete the last superuser in the system"}
 	ErrorDeletingLastOwner     = &Error{ID: "deleting-last-owner", Message: "Can't delete the last owner in domain(s)"}
@@ -47,14 +48,18 @@ var (
 	ErrorEmailNotConfirmed     = &Error{ID: "email-not-confirmed", Message: "User's email address is not confirmed yet"}
 	ErrorEmailSendFailure      = &Error{ID: "email-send-failure", Message: "Failed to send email"}
 	ErrorFeatureDisabled       = &Error{ID: "feature-disabled", Message: "This feature is disabled"}
+	ErrorFlagRateLimitExceeded = &Error{ID: "flag-rate-limit-exceeded", Message: "Too many flags, please try again later"}
 	ErrorHostAlreadyExists     = &Error{ID: "host-already-exists", Message: "This host is already registered"}
 	ErrorIdPUnconfigured       = &Error{ID: "idp-unconfigured", Message: "Identity provider isn't configured"}
 	ErrorIdPUnknown            = &Error{ID: "idp-unknown", Message: "Unknown identity provider"}
 	ErrorImmutableAccount      = &Error{ID: "immutable-account", Message: "Account cannot be updated"}
 	ErrorImmutableProperty     = &Error{ID: "immutable-property", Message: "Property cannot be updated"}
+	ErrorImportInProgress      = &Error{ID: "import-in-progress", Message: "Another import into this domain is in progress"}
 	ErrorInvalidCredentials    = &Error{ID: "invalid-credentials", Message: "Wrong password or user doesn't exist"}
 	ErrorInvalidInputData      = &Error{ID: "invalid-input-data", Message: "Invalid input data provided"}
+	ErrorInvalidPasskey        = &Error{ID: "invalid-passkey", Message: "Passkey verification failed"}
 	ErrorInvalidPropertyValue  = &Error{ID: "invalid-prop-value", Message: "Value of the property is invalid"}
+	ErrorInvalidTOTPCode       = &Error{ID: "invalid-totp-code", Message: "Wrong two-factor authentication code"}
 	ErrorInvalidUUID           = &Error{ID: "invalid-uuid", Message: "Invalid UUID value"}
 	ErrorLoginLocally          = &Error{ID: "login-locally", Message: "There's already a registered account with this email. Please login with your email and password instead"}
 	ErrorLoginUsingIdP         = &Error{ID: "login-using-idp", Message: "There's already a registered account with this email. Please login via the correct federated identity provider instead"}
@@ -68,11 +73,17 @@ var (
 	ErrorNotModerator          = &Error{ID: "not-moderator", Message: "User is not a moderator"}
 	ErrorPagePathAlreadyExists = &Error{ID: "page-path-already-exists", Message: "This page path is already used by another page"}
 	ErrorPageReadonly          = &Error{ID: "page-readonly", Message: "This page is read-only"}
+	ErrorRateLimitExceeded     = &Error{ID: "rate-limit-exceeded", Message: "Too many comments, please try again later"}
 	ErrorResourceFetchFailed   = &Error{ID: "resource-fetch-failed", Message: "Failed to fetch external resource"}
+	ErrorSelfFlag              = &Error{ID: "self-flag", Message: "You cannot flag your own comment"}
 	ErrorSelfOperation         = &Error{ID: "self-operation", Message: "You cannot do this to yourself"}
 	ErrorSelfVote              = &Error{ID: "self-vote", Message: "You cannot vote for your own comment"}
 	ErrorSignupsForbidden      = &Error{ID: "signups-forbidden", Message: "New signups are forbidden"}
 	ErrorSSOMisconfigured      = &Error{ID: "sso-misconfigured", Message: "Domain's SSO configuration is invalid"}
+	ErrorTOTPAlreadyEnabled    = &Error{ID: "totp-already-enabled", Message: "Two-factor authentication is already enabled"}
+	ErrorTOTPCodeRequired      = &Error{ID: "totp-code-required", Message: "Two-factor authentication code is required"}
+	ErrorTOTPEnrolmentRequired = &Error{ID: "totp-enrolment-required", Message: "Two-factor authentication must be enabled to manage domains"}
+	ErrorTOTPNotEnabled        = &Error{ID: "totp-not-enabled", Message: "Two-factor authentication isn't enabled"}
 	ErrorUnauthenticated       = &Error{ID: "unauthenticated", Message: "User isn't authenticated"}
 	ErrorUnauthorized          = &Error{ID: "unauthorized", Message: "You are not allowed to perform this operation"}
 	ErrorUnknownHost           = &Error{ID: "unknown-host", Message: "Unknown host"}
@@ -65,9 +65,11 @@ func configureAPI(api *operations.ComentarioAPI) http.Handler {
 	}
 
 	// Set up auth handlers
+	api.PersonalTokenAuth = svc.TheAuthService.AuthenticateUserByPersonalToken
 	api.TokenAuth = svc.TheAuthService.AuthenticateBearerToken
 	api.UserSessionHeaderAuth = svc.TheAuthService.AuthenticateUserBySessionHeader
 	api.UserCookieAuth = svc.TheAuthService.AuthenticateUserByCookieHeader
+	api.APIAuthorizer = runtime.AuthorizerFunc(svc.TheAuthService.AuthorizeRequest)
 
 	//------------------------------------------------------------------------------------------------------------------
 	// General API
@@ -80,12 +82,16 @@ func configureAPI(api *operations.ComentarioAPI) http.Handler {
 	api.APIGeneralAuthLoginTokenNewHandler = api_general.AuthLoginTokenNewHandlerFunc(handlers.AuthLoginTokenNew)
 	api.APIGeneralAuthLoginTokenRedeemHandler = api_general.AuthLoginTokenRedeemHandlerFunc(handlers.AuthLoginTokenRedeem)
 	api.APIGeneralAuthLogoutHandler = api_general.AuthLogoutHandlerFunc(handlers.AuthLogout)
+	api.APIGeneralAuthPasskeyLoginBeginHandler = api_general.AuthPasskeyLoginBeginHandlerFunc(handlers.AuthPasskeyLoginBegin)
+	api.APIGeneralAuthPasskeyLoginFinishHandler = api_general.AuthPasskeyLoginFinishHandlerFunc(handlers.AuthPasskeyLoginFinish)
 	api.APIGeneralAuthPwdResetChangeHandler = api_general.AuthPwdResetChangeHandlerFunc(handlers.AuthPwdResetChange)
 	api.APIGeneralAuthPwdResetSendEmailHandler = api_general.AuthPwdResetSendEmailHandlerFunc(handlers.AuthPwdResetSendEmail)
 	api.APIGeneralAuthSignupHandler = api_general.AuthSignupHandlerFunc(handlers.AuthSignup)
 	// OAuth
 	api.APIGeneralAuthOauthCallbackHandler = api_general.AuthOauthCallbackHandlerFunc(handlers.AuthOauthCallback)
+	api.APIGeneralAuthOauthCallbackPostHandler = api_general.AuthOauthCallbackPostHandlerFunc(handlers.AuthOauthCallbackPost)
 	api.APIGeneralAuthOauthInitHandler = api_general.AuthOauthInitHandlerFunc(handlers.AuthOauthInit)
+	api.APIGeneralAuthOauthMetadataHandler = api_general.AuthOauthMetadataHandlerFunc(handlers.AuthOauthMetadata)
 	// Config
 	api.APIGeneralConfigDynamicResetHandler = api_general.ConfigDynamicResetHandlerFunc(handlers.ConfigDynamicReset)
 	api.APIGeneralConfigDynamicUpdateHandler = api_general.ConfigDynamicUpdateHandlerFunc(handlers.ConfigDynamicUpdate)
@@ -93,13 +99,27 @@ func configureAPI(api *operations.ComentarioAPI) http.Handler {
 	api.APIGeneralConfigGetHandler = api_general.ConfigGetHandlerFunc(handlers.ConfigGet)
 	api.APIGeneralConfigVersionsGetHandler = api_general.ConfigVersionsGetHandlerFunc(handlers.ConfigVersionsGet)
 	// Mail
+	api.APIGeneralMailInboundHandler = api_general.MailInboundHandlerFunc(handlers.MailInbound)
 	api.APIGeneralMailUnsubscribeHandler = api_general.MailUnsubscribeHandlerFunc(handlers.MailUnsubscribe)
 	// CurUser
 	api.APIGeneralCurUserEmailUpdateConfirmHandler = api_general.CurUserEmailUpdateConfirmHandlerFunc(handlers.CurUserEmailUpdateConfirm)
 	api.APIGeneralCurUserEmailUpdateRequestHandler = api_general.CurUserEmailUpdateRequestHandlerFunc(handlers.CurUserEmailUpdateRequest)
 	api.APIGeneralCurUserGetHandler = api_general.CurUserGetHandlerFunc(handlers.CurUserGet)
+	api.APIGeneralCurUserPasskeyDeleteHandler = api_general.CurUserPasskeyDeleteHandlerFunc(handlers.CurUserPasskeyDelete)
+	api.APIGeneralCurUserPasskeyListHandler = api_general.CurUserPasskeyListHandlerFunc(handlers.CurUserPasskeyList)
+	api.APIGeneralCurUserPasskeyRegisterBeginHandler = api_general.CurUserPasskeyRegisterBeginHandlerFunc(handlers.CurUserPasskeyRegisterBegin)
+	api.APIGeneralCurUserPasskeyRegisterFinishHandler = api_general.CurUserPasskeyRegisterFinishHandlerFunc(handlers.CurUserPasskeyRegisterFinish)
+	api.APIGeneralCurUserPasskeyUpdateHandler = api_general.CurUserPasskeyUpdateHandlerFunc(handlers.CurUserPasskeyUpdate)
 	api.APIGeneralCurUserSetAvatarFromGravatarHandler = api_general.CurUserSetAvatarFromGravatarHandlerFunc(handlers.CurUserSetAvatarFromGravatar)
 	api.APIGeneralCurUserSetAvatarHandler = api_general.CurUserSetAvatarHandlerFunc(handlers.CurUserSetAvatar)
+	api.APIGeneralCurUserTokenDeleteHandler = api_general.CurUserTokenDeleteHandlerFunc(handlers.CurUserTokenDelete)
+	api.APIGeneralCurUserTokenListHandler = api_general.CurUserTokenListHandlerFunc(handlers.CurUserTokenList)
+	api.APIGeneralCurUserTokenNewHandler = api_general.CurUserTokenNewHandlerFunc(handlers.CurUserTokenNew)
+	api.APIGeneralCurUserTotpDisableHandler = api_general.CurUserTotpDisableHandlerFunc(handlers.CurUserTotpDisable)
+	api.APIGeneralCurUserTotpEnableHandler = api_general.CurUserTotpEnableHandlerFunc(handlers.CurUserTotpEnable)
+	api.APIGeneralCurUserTotpGetHandler = api_general.CurUserTotpGetHandlerFunc(handlers.CurUserTotpGet)
+	api.APIGeneralCurUserTotpNewHandler = api_general.CurUserTotpNewHandlerFunc(handlers.CurUserTotpNew)
+	api.APIGeneralCurUserTotpRecoveryCodesNewHandler = api_general.CurUserTotpRecoveryCodesNewHandlerFunc(handlers.CurUserTotpRecoveryCodesNew)
 	api.APIGeneralCurUserUpdateHandler = api_general.CurUserUpdateHandlerFunc(handlers.CurUserUpdate)
 	// Dashboard
 	api.APIGeneralDashboardDailyStatsHandler = api_general.DashboardDailyStatsHandlerFunc(handlers.DashboardDailyStats)
@@ -113,6 +133,9 @@ func configureAPI(api *operations.ComentarioAPI) http.Handler {
 	api.APIGeneralDomainExportHandler = api_general.DomainExportHandlerFunc(handlers.DomainExport)
 	api.APIGeneralDomainGetHandler = api_general.DomainGetHandlerFunc(handlers.DomainGet)
 	api.APIGeneralDomainImportHandler = api_general.DomainImportHandlerFunc(handlers.DomainImport)
+	api.APIGeneralDomainImportJobCancelHandler = api_general.DomainImportJobCancelHandlerFunc(handlers.DomainImportJobCancel)
+	api.APIGeneralDomainImportJobGetHandler = api_general.DomainImportJobGetHandlerFunc(handlers.DomainImportJobGet)
+	api.APIGeneralDomainImportJobListHandler = api_general.DomainImportJobListHandlerFunc(handlers.DomainImportJobList)
 	api.APIGeneralDomainListHandler = api_general.DomainListHandlerFunc(handlers.DomainList)
 	api.APIGeneralDomainNewHandler = api_general.DomainNewHandlerFunc(handlers.DomainNew)
 	api.APIGeneralDomainPurgeHandler = api_general.DomainPurgeHandlerFunc(handlers.DomainPurge)
@@ -125,15 +148,35 @@ func configureAPI(api *operations.ComentarioAPI) http.Handler {
 	api.APIGeneralDomainPageUpdateHandler = api_general.DomainPageUpdateHandlerFunc(handlers.DomainPageUpdate)
 	api.APIGeneralDomainPageUpdateTitleHandler = api_general.DomainPageUpdateTitleHandlerFunc(handlers.DomainPageUpdateTitle)
 	// Comments
+	api.APIGeneralCommentAssignHandler = api_general.CommentAssignHandlerFunc(handlers.CommentAssign)
+	api.APIGeneralCommentBulkModerateHandler = api_general.CommentBulkModerateHandlerFunc(handlers.CommentBulkModerate)
 	api.APIGeneralCommentCountHandler = api_general.CommentCountHandlerFunc(handlers.CommentCount)
 	api.APIGeneralCommentDeleteHandler = api_general.CommentDeleteHandlerFunc(handlers.CommentDelete)
+	api.APIGeneralCommentFlagsDismissHandler = api_general.CommentFlagsDismissHandlerFunc(handlers.CommentFlagsDismiss)
 	api.APIGeneralCommentGetHandler = api_general.CommentGetHandlerFunc(handlers.CommentGet)
 	api.APIGeneralCommentListHandler = api_general.CommentListHandlerFunc(handlers.CommentList)
+	api.APIGeneralCommentListFlaggedHandler = api_general.CommentListFlaggedHandlerFunc(handlers.CommentListFlagged)
 	api.APIGeneralCommentModerateHandler = api_general.CommentModerateHandlerFunc(handlers.CommentModerate)
+	api.APIGeneralCommentQueueListHandler = api_general.CommentQueueListHandlerFunc(handlers.CommentQueueList)
+	api.APIGeneralCommentQueueStatsHandler = api_general.CommentQueueStatsHandlerFunc(handlers.CommentQueueStats)
+	api.APIGeneralCommentRevisionDiffHandler = api_general.CommentRevisionDiffHandlerFunc(handlers.CommentRevisionDiff)
+	api.APIGeneralCommentRevisionListHandler = api_general.CommentRevisionListHandlerFunc(handlers.CommentRevisionList)
+	api.APIGeneralCommentSearchHandler = api_general.CommentSearchHandlerFunc(handlers.CommentSearch)
 	// Domain users
 	api.APIGeneralDomainUserListHandler = api_general.DomainUserListHandlerFunc(handlers.DomainUserList)
 	api.APIGeneralDomainUserGetHandler = api_general.DomainUserGetHandlerFunc(handlers.DomainUserGet)
 	api.APIGeneralDomainUserUpdateHandler = api_general.DomainUserUpdateHandlerFunc(handlers.DomainUserUpdate)
+	// Domain role rules
+	api.APIGeneralDomainRoleRuleListHandler = api_general.DomainRoleRuleListHandlerFunc(handlers.DomainRoleRuleList)
+	api.APIGeneralDomainRoleRuleSaveHandler = api_general.DomainRoleRuleSaveHandlerFunc(handlers.DomainRoleRuleSave)
+	// Domain webhooks
+	api.APIGeneralDomainWebhookDeleteHandler = api_general.DomainWebhookDeleteHandlerFunc(handlers.DomainWebhookDelete)
+	api.APIGeneralDomainWebhookDeliveryListHandler = api_general.DomainWebhookDeliveryListHandlerFunc(handlers.DomainWebhookDeliveryList)
+	api.APIGeneralDomainWebhookListHandler = api_general.DomainWebhookListHandlerFunc(handlers.DomainWebhookList)
+	api.APIGeneralDomainWebhookNewHandler = api_general.DomainWebhookNewHandlerFunc(handlers.DomainWebhookNew)
+	api.APIGeneralDomainWebhookUpdateHandler = api_general.DomainWebhookUpdateHandlerFunc(handlers.DomainWebhookUpdate)
+	// Audit log
+	api.APIGeneralAuditListHandler = api_general.AuditListHandlerFunc(handlers.AuditList)
 	// Users
 	api.APIGeneralUserAvatarGetHandler = api_general.UserAvatarGetHandlerFunc(handlers.UserAvatarGet)
 	api.APIGeneralUserBanHandler = api_general.UserBanHandlerFunc(handlers.UserBan)
@@ -142,6 +185,7 @@ func configureAPI(api *operations.ComentarioAPI) http.Handler {
 	api.APIGeneralUserListHandler = api_general.UserListHandlerFunc(handlers.UserList)
 	api.APIGeneralUserSessionListHandler = api_general.UserSessionListHandlerFunc(handlers.UserSessionList)
 	api.APIGeneralUserSessionsExpireHandler = api_general.UserSessionsExpireHandlerFunc(handlers.UserSessionsExpire)
+	api.APIGeneralUserTotpResetHandler = api_general.UserTotpResetHandlerFunc(handlers.UserTotpReset)
 	api.APIGeneralUserUnlockHandler = api_general.UserUnlockHandlerFunc(handlers.UserUnlock)
 	api.APIGeneralUserUpdateHandler = api_general.UserUpdateHandlerFunc(handlers.UserUpdate)
 
@@ -156,12 +200,15 @@ func configureAPI(api *operations.ComentarioAPI) http.Handler {
 	api.APIEmbedEmbedAuthLoginTokenNewHandler = api_embed.EmbedAuthLoginTokenNewHandlerFunc(handlers.EmbedAuthLoginTokenNew)
 	api.APIEmbedEmbedAuthLoginTokenRedeemHandler = api_embed.EmbedAuthLoginTokenRedeemHandlerFunc(handlers.EmbedAuthLoginTokenRedeem)
 	api.APIEmbedEmbedAuthLogoutHandler = api_embed.EmbedAuthLogoutHandlerFunc(handlers.EmbedAuthLogout)
+	api.APIEmbedEmbedAuthPasskeyLoginBeginHandler = api_embed.EmbedAuthPasskeyLoginBeginHandlerFunc(handlers.EmbedAuthPasskeyLoginBegin)
+	api.APIEmbedEmbedAuthPasskeyLoginFinishHandler = api_embed.EmbedAuthPasskeyLoginFinishHandlerFunc(handlers.EmbedAuthPasskeyLoginFinish)
 	api.APIEmbedEmbedAuthSignupHandler = api_embed.EmbedAuthSignupHandlerFunc(handlers.EmbedAuthSignup)
 	api.APIEmbedEmbedAuthCurUserGetHandler = api_embed.EmbedAuthCurUserGetHandlerFunc(handlers.EmbedAuthCurUserGet)
 	api.APIEmbedEmbedAuthCurUserUpdateHandler = api_embed.EmbedAuthCurUserUpdateHandlerFunc(handlers.EmbedAuthCurUserUpdate)
 	// Comment
 	api.APIEmbedEmbedCommentCountHandler = api_embed.EmbedCommentCountHandlerFunc(handlers.EmbedCommentCount)
 	api.APIEmbedEmbedCommentDeleteHandler = api_embed.EmbedCommentDeleteHandlerFunc(handlers.EmbedCommentDelete)
+	api.APIEmbedEmbedCommentFlagHandler = api_embed.EmbedCommentFlagHandlerFunc(handlers.EmbedCommentFlag)
 	api.APIEmbedEmbedCommentGetHandler = api_embed.EmbedCommentGetHandlerFunc(handlers.EmbedCommentGet)
 	api.APIEmbedEmbedCommentListHandler = api_embed.EmbedCommentListHandlerFunc(handlers.EmbedCommentList)
 	api.APIEmbedEmbedCommentModerateHandler = api_embed.EmbedCommentModerateHandlerFunc(handlers.EmbedCommentModerate)
@@ -171,6 +218,9 @@ func configureAPI(api *operations.ComentarioAPI) http.Handler {
 	api.APIEmbedEmbedCommentUpdateHandler = api_embed.EmbedCommentUpdateHandlerFunc(handlers.EmbedCommentUpdate)
 	api.APIEmbedEmbedCommentVoteHandler = api_embed.EmbedCommentVoteHandlerFunc(handlers.EmbedCommentVote)
 	// Page
+	api.APIEmbedEmbedPageSubscribeHandler = api_embed.EmbedPageSubscribeHandlerFunc(handlers.EmbedPageSubscribe)
+	api.APIEmbedEmbedPageSubscriptionListHandler = api_embed.EmbedPageSubscriptionListHandlerFunc(handlers.EmbedPageSubscriptionList)
+	api.APIEmbedEmbedPageUnsubscribeHandler = api_embed.EmbedPageUnsubscribeHandlerFunc(handlers.EmbedPageUnsubscribe)
 	api.APIEmbedEmbedPageUpdateHandler = api_embed.EmbedPageUpdateHandlerFunc(handlers.EmbedPageUpdate)
 
 	//------------------------------------------------------------------------------------------------------------------
@@ -193,6 +243,7 @@ func configureAPI(api *operations.ComentarioAPI) http.Handler {
 	// Set up the middleware
 	chain := alice.New(
 		webSocketsHandler,
+		webAuthnWellKnownHandler,
 		redirectToLangRootHandler,
 		corsHandler,
 	)
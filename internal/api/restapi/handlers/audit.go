@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/go-openapi/swag"
+	"github.com/google/uuid"
+	"gitlab.com/comentario/comentario/internal/api/exmodels"
+	"gitlab.com/comentario/comentario/internal/api/models"
+	"gitlab.com/comentario/comentario/internal/api/restapi/operations/api_general"
+	"gitlab.com/comentario/comentario/internal/config"
+	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/svc"
+	"net/http"
+	"time"
+)
+
+func AuditList(params api_general.AuditListParams, user *data.User) middleware.Responder {
+	// Superusers can query the entire log, including entries for domains that no longer exist
+	var domainID *uuid.UUID
+	if user.IsSuperuser {
+		var r middleware.Responder
+		if domainID, r = parseUUIDPtr(params.Domain); r != nil {
+			return r
+		}
+
+		// Other users can only query entries for a domain they own
+	} else if params.Domain == nil {
+		return respForbidden(exmodels.ErrorNoSuperuser)
+	} else if d, _, r := domainGetWithUser(*params.Domain, user, true); r != nil {
+		return r
+	} else {
+		domainID = &d.ID
+	}
+
+	// Extract the acting user ID
+	userID, r := parseUUIDPtr(params.UserID)
+	if r != nil {
+		return r
+	}
+
+	// Extract the target ID
+	targetID, r := parseUUIDPtr(params.TargetID)
+	if r != nil {
+		return r
+	}
+
+	// Fetch the entries
+	es, err := svc.TheAuditService.List(
+		userID,
+		domainID,
+		targetID,
+		data.AuditAction(swag.StringValue(params.Action)),
+		(*time.Time)(params.From),
+		(*time.Time)(params.To),
+		data.PageIndex(params.Page))
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewAuditListOK().
+		WithPayload(&api_general.AuditListOKBody{Entries: data.SliceToDTOs[*data.AuditEntry, *models.AuditEntry](es)})
+}
+
+// auditEntry returns a new audit log entry for the given action, performed by the given user (nil for the system) in
+// the course of processing the given request
+func auditEntry(req *http.Request, user *data.User, action data.AuditAction) *data.AuditEntry {
+	var userID *uuid.UUID
+	if user != nil {
+		userID = &user.ID
+	}
+	return data.NewAuditEntry(action, userID).WithRequest(req, !config.ServerConfig.LogFullIPs)
+}
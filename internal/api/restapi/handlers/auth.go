@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"encoding/json"
 	"errors"
 	"github.com/go-openapi/runtime/middleware"
+	"github.com/go-openapi/strfmt"
 	"github.com/go-openapi/swag"
 	"github.com/google/uuid"
 	"gitlab.com/comentario/comentario/internal/api/exmodels"
@@ -114,6 +116,7 @@ func AuthLogin(params api_general.AuthLoginParams) middleware.Responder {
 	user, us, r := loginLocalUser(
 		data.EmailPtrToString(params.Body.Email),
 		swag.StringValue(params.Body.Password),
+		string(params.Body.TotpCode),
 		"",
 		params.HTTPRequest)
 	if r != nil {
@@ -160,6 +163,38 @@ func AuthLogout(params api_general.AuthLogoutParams, _ *data.User) middleware.Re
 	return NewCookieResponder(api_general.NewAuthLogoutNoContent()).WithoutCookie(util.CookieNameUserSession, "/")
 }
 
+func AuthPasskeyLoginBegin(api_general.AuthPasskeyLoginBeginParams) middleware.Responder {
+	// Make sure passkeys are enabled
+	if r := Verifier.PasskeysEnabled(); r != nil {
+		return r
+	}
+
+	// Start a sign-in ceremony
+	id, opts, err := svc.ThePasskeyService.LoginBegin("")
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewAuthPasskeyLoginBeginOK().WithPayload(passkeyCeremonyDTO(id, opts))
+}
+
+func AuthPasskeyLoginFinish(params api_general.AuthPasskeyLoginFinishParams) middleware.Responder {
+	// Make sure passkeys are enabled
+	if r := Verifier.PasskeysEnabled(); r != nil {
+		return r
+	}
+
+	// Log the user in
+	user, us, r := loginPasskeyUser(params.Body.SessionID, params.Body.Credential, "", params.HTTPRequest)
+	if r != nil {
+		return r
+	}
+
+	// Succeeded. Return a principal and a session cookie
+	return authAddUserSessionToResponse(api_general.NewAuthPasskeyLoginFinishOK(), user, us)
+}
+
 func AuthPwdResetChange(params api_general.AuthPwdResetChangeParams, user *data.User) middleware.Responder {
 	// Verify it's a local user
 	if r := Verifier.UserIsLocal(user); r != nil {
@@ -293,9 +328,10 @@ func authAddUserSessionToResponse(resp PrincipalResponder, user *data.User, us *
 			http.SameSiteLaxMode)
 }
 
-// loginLocalUser tries to log a local user in using their email and password, returning the user and a new user
-// session. In case of error an error responder is returned
-func loginLocalUser(email, password, host string, req *http.Request) (*data.User, *data.UserSession, middleware.Responder) {
+// loginLocalUser tries to log a local user in using their email, password, and, if the user has two-factor
+// authentication enabled, a TOTP or recovery code, returning the user and a new user session. In case of error an error
+// responder is returned
+func loginLocalUser(email, password, totpCode, host string, req *http.Request) (*data.User, *data.UserSession, middleware.Responder) {
 	// Find the user
 	user, err := svc.TheUserService.FindUserByEmail(email)
 	if errors.Is(err, svc.ErrNotFound) || err == nil && !user.IsLocal() {
@@ -307,20 +343,16 @@ func loginLocalUser(email, password, host string, req *http.Request) (*data.User
 
 	// Verify the provided password
 	if !user.VerifyPassword(password) {
-		// Wrong password. Register the failed login attempt
-		user.WithLastLogin(false)
+		return nil, nil, loginFailed(user, exmodels.ErrorInvalidCredentials)
+	}
 
-		// Lock the user out if they exhausted the allowed attempts (and maxAttempts > 0)
-		if i := svc.TheDynConfigService.GetInt(data.ConfigKeyAuthLoginLocalMaxAttempts); i > 0 && user.FailedLoginAttempts > i {
-			user.WithLocked(true)
+	// If two-factor authentication is enabled, and so it is for the user, verify the second factor
+	if config.ServerConfig.EnableTOTP && user.TOTPEnabled {
+		if totpCode == "" {
+			return nil, nil, respUnauthorized(exmodels.ErrorTOTPCodeRequired)
+		} else if !user.VerifySecondFactor(totpCode) {
+			return nil, nil, loginFailed(user, exmodels.ErrorInvalidTOTPCode)
 		}
-
-		// Persist ignoring possible errors
-		_ = svc.TheUserService.UpdateLoginLocked(user)
-
-		// Pause for a random while
-		util.RandomSleep(util.WrongAuthDelayMin, util.WrongAuthDelayMax)
-		return nil, nil, respUnauthorized(exmodels.ErrorInvalidCredentials)
 	}
 
 	// Verify the user can log in and create a new session
@@ -332,6 +364,58 @@ func loginLocalUser(email, password, host string, req *http.Request) (*data.User
 	}
 }
 
+// loginFailed registers a failed login attempt of the given user, locking them out if they exhausted the allowed
+// attempts, and returns an Unauthorized responder with the given error
+func loginFailed(user *data.User, errm *exmodels.Error) middleware.Responder {
+	// Register the failed login attempt
+	user.WithLastLogin(false)
+
+	// Lock the user out if they exhausted the allowed attempts (and maxAttempts > 0)
+	if i := svc.TheDynConfigService.GetInt(data.ConfigKeyAuthLoginLocalMaxAttempts); i > 0 && user.FailedLoginAttempts > i {
+		user.WithLocked(true)
+	}
+
+	// Persist ignoring possible errors
+	_ = svc.TheUserService.UpdateLoginLocked(user)
+
+	// Pause for a random while
+	util.RandomSleep(util.WrongAuthDelayMin, util.WrongAuthDelayMax)
+	return respUnauthorized(errm)
+}
+
+// loginPasskeyUser verifies the passkey credential against the ceremony state stored in the given auth session, and
+// logs the passkey's owner in
+func loginPasskeyUser(sessionID *strfmt.UUID, credential any, host string, req *http.Request) (*data.User, *data.UserSession, middleware.Responder) {
+	// Parse the session ID
+	id, r := parseUUIDPtr(sessionID)
+	if r != nil {
+		return nil, nil, r
+	}
+
+	// Serialise the credential back into JSON
+	b, r := passkeyCredentialJSON(credential)
+	if r != nil {
+		return nil, nil, r
+	}
+
+	// Verify the credential
+	user, err := svc.ThePasskeyService.LoginFinish(id, host, b)
+	if errors.Is(err, svc.ErrPasskeyVerification) {
+		return nil, nil, respUnauthorized(exmodels.ErrorInvalidPasskey)
+	} else if err != nil {
+		return nil, nil, respServiceError(err)
+	}
+
+	// Log the user in
+	us, r := loginUser(user, host, req)
+	if r != nil {
+		return nil, nil, r
+	}
+
+	// Succeeded
+	return user, us, nil
+}
+
 // loginUser verifies the user is allowed to authenticate, logs the given user in, and returns a new user session. In
 // case of error an error responder is returned
 func loginUser(user *data.User, host string, req *http.Request) (*data.UserSession, middleware.Responder) {
@@ -360,6 +444,23 @@ func loginUser(user *data.User, host string, req *http.Request) (*data.UserSessi
 	return us, nil
 }
 
+// passkeyCeremonyDTO returns an API model for a started passkey ceremony
+func passkeyCeremonyDTO(sessionID *uuid.UUID, options any) *models.PasskeyCeremony {
+	return &models.PasskeyCeremony{
+		Options:   options,
+		SessionID: (*strfmt.UUID)(swag.String(sessionID.String())),
+	}
+}
+
+// passkeyCredentialJSON serialises the given credential, as received from the browser, back into JSON
+func passkeyCredentialJSON(credential any) ([]byte, middleware.Responder) {
+	b, err := json.Marshal(credential)
+	if err != nil {
+		return nil, respBadRequest(exmodels.ErrorInvalidInputData.WithDetails(err.Error()))
+	}
+	return b, nil
+}
+
 // signupUser saves the given user and runs post-signup tasks
 func signupUser(user *data.User) middleware.Responder {
 	// Save the new user
@@ -1,20 +1,148 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"github.com/go-openapi/runtime/middleware"
 	"github.com/go-openapi/strfmt"
 	"github.com/go-openapi/swag"
 	"github.com/google/uuid"
+	"gitlab.com/comentario/comentario/internal/api/exmodels"
 	"gitlab.com/comentario/comentario/internal/api/models"
 	"gitlab.com/comentario/comentario/internal/api/restapi/operations/api_general"
 	"gitlab.com/comentario/comentario/internal/data"
 	"gitlab.com/comentario/comentario/internal/svc"
+	"gitlab.com/comentario/comentario/internal/util"
 	"maps"
+	"net/http"
 	"slices"
 	"time"
 )
 
+func CommentAssign(params api_general.CommentAssignParams, user *data.User) middleware.Responder {
+	// Find the comment and related objects
+	comment, _, domain, domainUser, r := commentGetCommentPageDomainUser(params.UUID, &user.ID)
+	if r != nil {
+		return r
+	}
+
+	// Verify the user is a moderator
+	if r := Verifier.UserCanModerateDomain(user, domainUser); r != nil {
+		return r
+	}
+
+	// Extract the assignee ID, if any
+	var assigneeID *uuid.UUID
+	if params.Body.UserID != "" {
+		if assigneeID, r = parseUUID(params.Body.UserID); r != nil {
+			return r
+		}
+
+		// Verify the assignee is a moderator, too
+		if *assigneeID != user.ID {
+			if u, du, err := svc.TheUserService.FindDomainUserByID(assigneeID, &domain.ID); err != nil {
+				return respServiceError(err)
+			} else if !u.IsSuperuser && !du.CanModerate() {
+				return respBadRequest(exmodels.ErrorNotModerator.WithDetails(u.Email))
+			}
+		}
+	}
+
+	// Only owners can take over a comment assigned to another moderator
+	if cur := comment.UserAssigned; cur.Valid && cur.UUID != user.ID && (assigneeID == nil || *assigneeID != cur.UUID) &&
+		!user.IsSuperuser && !domainUser.IsAnOwner() {
+		return respForbidden(exmodels.ErrorCommentAssigned)
+	}
+
+	// Update the comment
+	if err := svc.TheCommentService.Assign(&comment.ID, assigneeID); err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewCommentAssignNoContent()
+}
+
+func CommentBulkModerate(params api_general.CommentBulkModerateParams, user *data.User) middleware.Responder {
+	// Extract domain ID
+	domainID, r := parseUUID(*params.Body.DomainID)
+	if r != nil {
+		return r
+	}
+
+	// Find the domain and the domain user
+	domain, domainUser, err := svc.TheDomainService.FindDomainUserByID(domainID, &user.ID, false)
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Verify the user is a moderator
+	if r := Verifier.UserCanModerateDomain(user, domainUser); r != nil {
+		return r
+	}
+
+	// Compile the filter
+	f := &svc.CommentFilter{
+		AuthorIP:      params.Body.AuthorIP,
+		PendingReason: params.Body.PendingReason,
+		Status:        params.Body.Status,
+	}
+	if params.Body.PageID != "" {
+		if f.PageID, r = parseUUID(params.Body.PageID); r != nil {
+			return r
+		}
+	}
+	if params.Body.UserID != "" {
+		if f.AuthorID, r = parseUUID(params.Body.UserID); r != nil {
+			return r
+		}
+	}
+	if t := time.Time(params.Body.From); !t.IsZero() {
+		f.From = &t
+	}
+	if t := time.Time(params.Body.To); !t.IsZero() {
+		f.To = &t
+	}
+
+	// Refuse to act on all the domain's comments at once
+	if f.IsEmpty() {
+		return respBadRequest(exmodels.ErrorInvalidInputData.WithDetails("no filter criteria specified"))
+	}
+
+	// IP addresses are only visible to superusers, so only they can filter by one
+	if f.AuthorIP != "" && !user.IsSuperuser {
+		return respForbidden(exmodels.ErrorNoSuperuser)
+	}
+
+	// Apply the action
+	action := data.CommentBulkAction(params.Body.Action)
+	reason := ""
+	if action == data.CommentBulkActionSpam {
+		reason = fmt.Sprintf("Marked as spam by %s <%s>", user.Name, user.Email)
+	}
+	cs, err := svc.TheCommentService.ModerateBulk(&domain.ID, f, action, &user.ID, reason)
+	if errors.Is(err, svc.ErrTooManyComments) {
+		return respBadRequest(exmodels.ErrorInvalidInputData.WithDetails(fmt.Sprintf("filter matches more than %d comments", util.CommentBulkMaxCount)))
+	} else if err != nil {
+		return respServiceError(err)
+	}
+
+	// Record the action in the audit log
+	svc.TheAuditService.Record(
+		auditEntry(params.HTTPRequest, user, data.AuditActionCommentBulk).
+			WithDomain(&domain.ID).
+			WithChange(nil, map[string]any{"action": action, "filter": f, "count": len(cs)}))
+
+	// Update the counts and send out notifications
+	if r := commentBulkNotify(domain, cs, action); r != nil {
+		return r
+	}
+
+	// Succeeded
+	return api_general.NewCommentBulkModerateOK().
+		WithPayload(&api_general.CommentBulkModerateOKBody{Count: int64(len(cs))})
+}
+
 func CommentCount(params api_general.CommentCountParams, user *data.User) middleware.Responder {
 	// Extract domain ID
 	domainID, r := parseUUID(params.Domain)
@@ -61,7 +189,7 @@ func CommentCount(params api_general.CommentCountParams, user *data.User) middle
 
 func CommentDelete(params api_general.CommentDeleteParams, user *data.User) middleware.Responder {
 	// Delete the comment
-	if r := commentDelete(params.UUID, user); r != nil {
+	if r := commentDelete(params.HTTPRequest, params.UUID, user); r != nil {
 		return r
 	}
 
@@ -69,6 +197,27 @@ func CommentDelete(params api_general.CommentDeleteParams, user *data.User) midd
 	return api_general.NewCommentDeleteNoContent()
 }
 
+func CommentFlagsDismiss(params api_general.CommentFlagsDismissParams, user *data.User) middleware.Responder {
+	// Find the comment and related objects
+	comment, _, domain, domainUser, r := commentGetCommentPageDomainUser(params.UUID, &user.ID)
+	if r != nil {
+		return r
+	}
+
+	// Verify the user is a moderator
+	if r := Verifier.UserCanModerateDomain(user, domainUser); r != nil {
+		return r
+	}
+
+	// Dismiss the flags
+	if r := commentDismissFlags(params.HTTPRequest, domain, comment, user); r != nil {
+		return r
+	}
+
+	// Succeeded
+	return api_general.NewCommentFlagsDismissNoContent()
+}
+
 func CommentGet(params api_general.CommentGetParams, user *data.User) middleware.Responder {
 	// Find the comment and related objects
 	comment, page, domain, domainUser, r := commentGetCommentPageDomainUser(params.UUID, &user.ID)
@@ -182,9 +331,70 @@ func CommentList(params api_general.CommentListParams, user *data.User) middlewa
 	})
 }
 
+func CommentListFlagged(params api_general.CommentListFlaggedParams, user *data.User) middleware.Responder {
+	// Extract domain ID
+	domainID, r := parseUUID(params.Domain)
+	if r != nil {
+		return r
+	}
+
+	// Find the domain user, if any
+	_, domainUser, err := svc.TheDomainService.FindDomainUserByID(domainID, &user.ID, false)
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Verify the user is a moderator
+	if r := Verifier.UserCanModerateDomain(user, domainUser); r != nil {
+		return r
+	}
+
+	// Fetch the flagged comments
+	cs, crMap, err := svc.TheCommentService.ListFlagged(user, domainUser, domainID, data.PageIndex(params.Page))
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Fetch the flags of the comments
+	commentIDs := make([]uuid.UUID, len(cs))
+	for i, c := range cs {
+		if id, r := parseUUID(c.ID); r != nil {
+			return r
+		} else {
+			commentIDs[i] = *id
+		}
+	}
+	fs, err := svc.TheCommentFlagService.ListActive(commentIDs)
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Convert the flags into DTOs, collecting the registered users who submitted them. Only superusers get to see IPs
+	flags := make([]*models.CommentFlag, len(fs))
+	reporters := map[uuid.UUID]*models.User{}
+	for i, f := range fs {
+		flags[i] = f.ToDTO(user.IsSuperuser)
+		if id := f.UserID; id.Valid && id.UUID != data.AnonymousUser.ID && reporters[id.UUID] == nil {
+			if u, err := svc.TheUserService.FindUserByID(&id.UUID); err != nil {
+				return respServiceError(err)
+			} else {
+				reporters[id.UUID] = u.CloneWithClearance(user.IsSuperuser, domainUser.IsAnOwner(), true).ToDTO()
+			}
+		}
+	}
+
+	// Succeeded
+	return api_general.NewCommentListFlaggedOK().WithPayload(&api_general.CommentListFlaggedOKBody{
+		Commenters: slices.Collect(maps.Values(crMap)),
+		Comments:   cs,
+		Flags:      flags,
+		Reporters:  slices.Collect(maps.Values(reporters)),
+	})
+}
+
 func CommentModerate(params api_general.CommentModerateParams, user *data.User) middleware.Responder {
 	// Update the comment
-	if r := commentModerate(params.UUID, user, swag.BoolValue(params.Body.Pending), swag.BoolValue(params.Body.Approve)); r != nil {
+	if r := commentModerate(params.HTTPRequest, params.UUID, user, swag.BoolValue(params.Body.Pending), swag.BoolValue(params.Body.Approve)); r != nil {
 		return r
 	}
 
@@ -192,8 +402,389 @@ func CommentModerate(params api_general.CommentModerateParams, user *data.User)
 	return api_general.NewCommentModerateNoContent()
 }
 
+func CommentQueueList(params api_general.CommentQueueListParams, user *data.User) middleware.Responder {
+	// Extract domain ID
+	domainID, r := parseUUID(params.Domain)
+	if r != nil {
+		return r
+	}
+
+	// Extract assignee ID
+	assigneeID, r := parseUUIDPtr(params.AssigneeID)
+	if r != nil {
+		return r
+	}
+
+	// Find the domain user, if any
+	_, domainUser, err := svc.TheDomainService.FindDomainUserByID(domainID, &user.ID, false)
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Verify the user is a moderator
+	if r := Verifier.UserCanModerateDomain(user, domainUser); r != nil {
+		return r
+	}
+
+	// Fetch the queued comments
+	cs, crMap, err := svc.TheCommentService.ListQueue(
+		user,
+		domainUser,
+		domainID,
+		assigneeID,
+		swag.BoolValue(params.Unassigned),
+		data.PageIndex(params.Page))
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Collect the assigned moderators
+	assignees := map[strfmt.UUID]*models.User{}
+	for _, c := range cs {
+		if id := c.UserAssigned; id != "" && assignees[id] == nil {
+			if u, r := commentFindUser(id, user, domainUser); r != nil {
+				return r
+			} else {
+				assignees[id] = u
+			}
+		}
+	}
+
+	// Succeeded
+	return api_general.NewCommentQueueListOK().WithPayload(&api_general.CommentQueueListOKBody{
+		Assignees:  slices.Collect(maps.Values(assignees)),
+		Commenters: slices.Collect(maps.Values(crMap)),
+		Comments:   cs,
+	})
+}
+
+func CommentQueueStats(params api_general.CommentQueueStatsParams, user *data.User) middleware.Responder {
+	// Extract domain ID
+	domainID, r := parseUUID(params.Domain)
+	if r != nil {
+		return r
+	}
+
+	// Find the domain user, if any
+	_, domainUser, err := svc.TheDomainService.FindDomainUserByID(domainID, &user.ID, false)
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Verify the user is a moderator
+	if r := Verifier.UserCanModerateDomain(user, domainUser); r != nil {
+		return r
+	}
+
+	// Fetch the figures
+	ts, err := svc.TheStatsService.GetModeratorThroughput(domainID, int(swag.Uint64Value(params.Days)))
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Convert the figures into DTOs, collecting the moderators
+	dtos := make([]*models.ModeratorThroughput, len(ts))
+	users := make([]*models.User, 0, len(ts))
+	for i, t := range ts {
+		dtos[i] = t.ToDTO()
+		if u, r := commentFindUser(dtos[i].UserID, user, domainUser); r != nil {
+			return r
+		} else {
+			users = append(users, u)
+		}
+	}
+
+	// Succeeded
+	return api_general.NewCommentQueueStatsOK().
+		WithPayload(&api_general.CommentQueueStatsOKBody{Moderators: dtos, Users: users})
+}
+
+func CommentRevisionDiff(params api_general.CommentRevisionDiffParams, user *data.User) middleware.Responder {
+	// Fetch the comment's revisions
+	revs, _, r := commentRevisions(params.UUID, user)
+	if r != nil {
+		return r
+	}
+
+	// Validate the revision numbers
+	if params.From > int64(len(revs)) {
+		return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("from"))
+	} else if params.To > int64(len(revs)) {
+		return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("to"))
+	}
+
+	// Compare the texts
+	from, to := revs[params.From-1].Markdown, revs[params.To-1].Markdown
+	diff := util.TextDiff(from, to)
+	chunks := make([]*models.TextDiffChunk, len(diff))
+	for i, c := range diff {
+		chunks[i] = &models.TextDiffChunk{Op: c.Op, Text: c.Text}
+	}
+
+	// Succeeded
+	return api_general.NewCommentRevisionDiffOK().
+		WithPayload(&api_general.CommentRevisionDiffOKBody{
+			ChangePercent: int64(util.TextChangePercent(from, to)),
+			Chunks:        chunks,
+		})
+}
+
+func CommentRevisionList(params api_general.CommentRevisionListParams, user *data.User) middleware.Responder {
+	// Fetch the comment's revisions
+	revs, domainUser, r := commentRevisions(params.UUID, user)
+	if r != nil {
+		return r
+	}
+
+	// Convert the revisions into DTOs, collecting their authors
+	dtos := make([]*models.CommentRevision, len(revs))
+	users := map[uuid.UUID]*models.User{}
+	for i, rev := range revs {
+		dtos[i] = rev.ToDTO(i + 1)
+		if id := rev.UserCreated; id.Valid && users[id.UUID] == nil {
+			if u, err := svc.TheUserService.FindUserByID(&id.UUID); err != nil {
+				return respServiceError(err)
+			} else {
+				users[id.UUID] = u.CloneWithClearance(user.IsSuperuser, domainUser.IsAnOwner(), true).ToDTO()
+			}
+		}
+	}
+
+	// Succeeded
+	return api_general.NewCommentRevisionListOK().
+		WithPayload(&api_general.CommentRevisionListOKBody{
+			Revisions: dtos,
+			Users:     slices.Collect(maps.Values(users)),
+		})
+}
+
+func CommentSearch(params api_general.CommentSearchParams, user *data.User) middleware.Responder {
+	// Extract domain ID
+	domainID, r := parseUUID(params.Domain)
+	if r != nil {
+		return r
+	}
+
+	// Extract page ID
+	pageID, r := parseUUIDPtr(params.PageID)
+	if r != nil {
+		return r
+	}
+
+	// Extract user ID
+	userID, r := parseUUIDPtr(params.UserID)
+	if r != nil {
+		return r
+	}
+
+	// Parse the search query, which must contain at least one term
+	terms := util.ParseSearchQuery(params.Q)
+	if len(terms) == 0 {
+		return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("q"))
+	}
+
+	// Find the domain user, if any
+	_, domainUser, err := svc.TheDomainService.FindDomainUserByID(domainID, &user.ID, false)
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Search comments the user has access to
+	cs, crMap, err := svc.TheCommentService.Search(
+		user,
+		domainUser,
+		domainID,
+		pageID,
+		userID,
+		terms,
+		(*time.Time)(params.From),
+		(*time.Time)(params.To),
+		swag.BoolValue(params.Approved),
+		swag.BoolValue(params.Pending),
+		swag.BoolValue(params.Rejected),
+		swag.BoolValue(params.Deleted),
+		swag.StringValue(params.SortBy),
+		data.SortDirection(swag.BoolValue(params.SortDesc)),
+		data.PageIndex(params.Page))
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewCommentSearchOK().WithPayload(&api_general.CommentSearchOKBody{
+		Commenters: slices.Collect(maps.Values(crMap)),
+		Comments:   cs,
+	})
+}
+
+// commentAuditValues returns the comment's properties relevant to the audit log
+func commentAuditValues(c *data.Comment) map[string]any {
+	return map[string]any{
+		"pending":       c.IsPending,
+		"approved":      c.IsApproved,
+		"deleted":       c.IsDeleted,
+		"pendingReason": c.PendingReason,
+	}
+}
+
+// commentBulkNotify updates page and domain comment counts after the given comments have been deleted in bulk, notifies
+// the authors of comments whose status has changed and the subscribers of newly approved ones, and notifies websocket
+// subscribers and webhooks about the change in the given comments
+func commentBulkNotify(domain *data.Domain, comments []*svc.BulkModeratedComment, action data.CommentBulkAction) middleware.Responder {
+	// Fetch the comments' pages
+	pages := map[uuid.UUID]*data.DomainPage{}
+	for _, c := range comments {
+		if _, ok := pages[c.PageID]; !ok {
+			if p, err := svc.ThePageService.FindByID(&c.PageID); err != nil {
+				return respServiceError(err)
+			} else {
+				pages[c.PageID] = p
+			}
+		}
+	}
+
+	// Decrement page/domain comment counts in the background, ignoring any errors
+	if action == data.CommentBulkActionDelete {
+		go func() {
+			counts := map[uuid.UUID]int{}
+			for _, c := range comments {
+				counts[c.PageID]++
+			}
+			for id, cnt := range counts {
+				_ = svc.ThePageService.IncrementCounts(&id, -cnt, 0)
+			}
+			_ = svc.TheDomainService.IncrementCounts(&domain.ID, -len(comments), 0)
+		}()
+
+	} else {
+		// Notify the authors of comments whose status has changed and, if a comment has just got approved, page and
+		// thread subscribers, in the background
+		go func() {
+			for _, c := range comments {
+				if !c.StatusChanged() {
+					continue
+				}
+				page := pages[c.PageID]
+				_ = sendCommentStatusNotifications(domain, page, c.Comment)
+				if c.IsApproved && !c.WasApproved {
+					if commenter, err := svc.TheUserService.FindUserByID(&c.UserCreated.UUID); err == nil {
+						_ = sendCommentSubscriptionNotifications(domain, page, c.Comment, commenter)
+					}
+				}
+			}
+		}()
+	}
+
+	// Notify websocket subscribers and webhooks
+	for _, c := range comments {
+		page := pages[c.PageID]
+		if action == data.CommentBulkActionDelete {
+			commentWebSocketNotify(page, c.Comment, "delete")
+			commentWebhookNotify(domain, page, c.Comment, models.WebhookEventTypeCommentDeleted)
+		} else {
+			commentWebSocketNotify(page, c.Comment, "update")
+			commentWebhookNotify(domain, page, c.Comment, models.WebhookEventTypeCommentModerated)
+		}
+	}
+	return nil
+}
+
+// commentCheckRateLimits verifies that adding a new comment by the given user from the IP address with the given hash
+// (if known) doesn't exceed any of the per-minute rate limits configured for the domain, and returns an error responder
+// if it does
+func commentCheckRateLimits(domain *data.Domain, page *data.DomainPage, user *data.User, authorIPHash string) middleware.Responder {
+	since := time.Now().UTC().Add(-time.Minute)
+	check := func(key data.DynConfigItemKey, pageID, userID *uuid.UUID, ipHash string) middleware.Responder {
+		// Skip over disabled limits
+		limit := svc.TheDomainConfigService.GetInt(&domain.ID, key)
+		if limit <= 0 {
+			return nil
+		}
+
+		// Count comments created within the last minute
+		if cnt, err := svc.TheCommentService.CountCreatedSince(&domain.ID, pageID, userID, ipHash, since); err != nil {
+			return respServiceError(err)
+		} else if cnt >= int64(limit) {
+			return respTooManyRequests(exmodels.ErrorRateLimitExceeded)
+		}
+		return nil
+	}
+
+	// Check the per-user limit for registered users only
+	if !user.IsAnonymous() {
+		if r := check(data.DomainConfigKeyRateLimitPerUser, nil, &user.ID, ""); r != nil {
+			return r
+		}
+	}
+
+	// Check the per-IP limit. Comments coming without an IP address (such as replies by email) are counted by their
+	// author instead, so that they can't bypass it
+	if authorIPHash != "" {
+		if r := check(data.DomainConfigKeyRateLimitPerIP, nil, nil, authorIPHash); r != nil {
+			return r
+		}
+	} else if r := check(data.DomainConfigKeyRateLimitPerIP, nil, &user.ID, ""); r != nil {
+		return r
+	}
+
+	// Check the per-page limit
+	return check(data.DomainConfigKeyRateLimitPerPage, &page.ID, nil, "")
+}
+
+// commentCreate checks the given new comment against the domain's rate limits and moderation rules, persists it, and
+// sends out the relevant notifications. Returns nil if succeeded, or an error responder otherwise
+func commentCreate(req *http.Request, domain *data.Domain, page *data.DomainPage, user *data.User, domainUser *data.DomainUser, comment *data.Comment) middleware.Responder {
+	// Make sure no rate limit is exceeded, unless it's a superuser or a moderator
+	if !user.IsSuperuser && !domainUser.CanModerate() {
+		if r := commentCheckRateLimits(domain, page, user, comment.AuthorIPHash); r != nil {
+			return r
+		}
+	}
+
+	// Determine comment state
+	if action, reason, err := svc.ThePerlustrationService.NeedsModeration(req, comment, domain, page, user, domainUser, false); err != nil {
+		return respServiceError(err)
+	} else {
+		comment.WithModerationAction(&user.ID, action, reason)
+	}
+
+	// Persist a new comment record
+	if err := svc.TheCommentService.Create(comment); err != nil {
+		return respServiceError(err)
+	}
+
+	// Increment page/domain comment counts in the background, ignoring any error
+	go func() {
+		_ = svc.ThePageService.IncrementCounts(&page.ID, 1, 0)
+		_ = svc.TheDomainService.IncrementCounts(&domain.ID, 1, 0)
+	}()
+
+	// Send an email notification to moderators, if we notify about every comment or comments pending moderation and
+	// the comment isn't approved yet, in the background
+	if domain.ModNotifyPolicy == data.DomainModNotifyPolicyAll || comment.IsPending && domain.ModNotifyPolicy == data.DomainModNotifyPolicyPending {
+		go func() { _ = sendCommentModNotifications(domain, page, comment, user) }()
+	}
+
+	// If it's a reply and the comment is approved, send out a reply notifications, in the background
+	if !comment.IsRoot() && comment.IsApproved {
+		go func() { _ = sendCommentReplyNotifications(domain, page, comment, user) }()
+	}
+
+	// If the comment is approved, notify page and thread subscribers, in the background
+	if comment.IsApproved {
+		go func() { _ = sendCommentSubscriptionNotifications(domain, page, comment, user) }()
+	}
+
+	// Notify websocket subscribers and webhooks
+	commentWebSocketNotify(page, comment, "new")
+	commentWebhookNotify(domain, page, comment, models.WebhookEventTypeCommentCreated)
+
+	// Succeeded
+	return nil
+}
+
 // commentDelete verifies the user is allowed to delete a comment (specified by its ID) and deletes it
-func commentDelete(commentUUID strfmt.UUID, user *data.User) middleware.Responder {
+func commentDelete(req *http.Request, commentUUID strfmt.UUID, user *data.User) middleware.Responder {
 	// Find the comment and related objects
 	comment, page, domain, domainUser, r := commentGetCommentPageDomainUser(commentUUID, &user.ID)
 	if r != nil {
@@ -210,19 +801,66 @@ func commentDelete(commentUUID strfmt.UUID, user *data.User) middleware.Responde
 		return respServiceError(err)
 	}
 
+	// Any flags of the comment are now irrelevant
+	if r := commentDismissFlags(req, domain, comment, user); r != nil {
+		return r
+	}
+
+	// Record the action in the audit log, unless it's the author deleting their own comment
+	if comment.UserCreated.UUID != user.ID {
+		svc.TheAuditService.Record(
+			auditEntry(req, user, data.AuditActionCommentDelete).
+				WithDomain(&domain.ID).
+				WithTarget(&comment.ID).
+				WithChange(commentAuditValues(comment), map[string]any{"deleted": true}))
+	}
+
 	// Decrement page/domain comment count in the background, ignoring any errors
 	go func() {
 		_ = svc.ThePageService.IncrementCounts(&page.ID, -1, 0)
 		_ = svc.TheDomainService.IncrementCounts(&domain.ID, -1, 0)
 	}()
 
-	// Notify websocket subscribers
+	// Notify websocket subscribers and webhooks
 	commentWebSocketNotify(page, comment, "delete")
+	commentWebhookNotify(domain, page, comment.WithDeleted(&user.ID), models.WebhookEventTypeCommentDeleted)
+
+	// Succeeded
+	return nil
+}
+
+// commentDismissFlags dismisses all active flags of the given comment on behalf of the given user, recording the action
+// in the audit log if there were any
+func commentDismissFlags(req *http.Request, domain *data.Domain, comment *data.Comment, user *data.User) middleware.Responder {
+	cnt, err := svc.TheCommentFlagService.Dismiss(&comment.ID, &user.ID)
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Record the action in the audit log
+	if cnt > 0 {
+		svc.TheAuditService.Record(
+			auditEntry(req, user, data.AuditActionCommentFlags).
+				WithDomain(&domain.ID).
+				WithTarget(&comment.ID).
+				WithChange(map[string]any{"activeFlags": cnt}, map[string]any{"activeFlags": 0}))
+	}
 
 	// Succeeded
 	return nil
 }
 
+// commentFindUser finds a user by their ID and returns it as seen by the given current user, who's a domain moderator
+func commentFindUser(id strfmt.UUID, curUser *data.User, curDomainUser *data.DomainUser) (*models.User, middleware.Responder) {
+	if userID, r := parseUUID(id); r != nil {
+		return nil, r
+	} else if u, err := svc.TheUserService.FindUserByID(userID); err != nil {
+		return nil, respServiceError(err)
+	} else {
+		return u.CloneWithClearance(curUser.IsSuperuser, curDomainUser.IsAnOwner(), true).ToDTO(), nil
+	}
+}
+
 // commentGetCommentPageDomainUser finds and returns a Comment, DomainPage and Domain by a string comment ID. Also tries
 // to find and return a DomainUser that corresponds to the given curUserID, returning nil if no such domain user exists
 func commentGetCommentPageDomainUser(commentUUID strfmt.UUID, curUserID *uuid.UUID) (*data.Comment, *data.DomainPage, *data.Domain, *data.DomainUser, middleware.Responder) {
@@ -249,7 +887,7 @@ func commentGetCommentPageDomainUser(commentUUID strfmt.UUID, curUserID *uuid.UU
 }
 
 // commentModerate verifies the user is allowed to moderate a comment (specified by its ID) and updates it
-func commentModerate(commentUUID strfmt.UUID, curUser *data.User, pending, approve bool) middleware.Responder {
+func commentModerate(req *http.Request, commentUUID strfmt.UUID, curUser *data.User, pending, approve bool) middleware.Responder {
 	// Find the comment and related objects
 	comment, page, domain, curDomainUser, r := commentGetCommentPageDomainUser(commentUUID, &curUser.ID)
 	if r != nil {
@@ -268,21 +906,76 @@ func commentModerate(commentUUID strfmt.UUID, curUser *data.User, pending, appro
 	}
 
 	// Update the comment's state in the database
+	wasApproved := comment.IsApproved
+	before := commentAuditValues(comment)
 	comment.WithModerated(&curUser.ID, pending, approve, reason)
 	if err := svc.TheCommentService.Moderated(comment); err != nil {
 		return respServiceError(err)
 	}
 
+	// Record the action in the audit log
+	svc.TheAuditService.Record(
+		auditEntry(req, curUser, data.AuditActionCommentModerate).
+			WithDomain(&domain.ID).
+			WithTarget(&comment.ID).
+			WithChange(before, commentAuditValues(comment)))
+
+	// Approving or rejecting the comment resolves its flags
+	if !pending {
+		if r := commentDismissFlags(req, domain, comment, curUser); r != nil {
+			return r
+		}
+	}
+
 	// Notify the comment author about the status change, in the background
 	go func() { _ = sendCommentStatusNotifications(domain, page, comment) }()
 
-	// Notify websocket subscribers
+	// If the comment has just got approved, notify page and thread subscribers, in the background
+	if comment.IsApproved && !wasApproved {
+		go func() {
+			if commenter, err := svc.TheUserService.FindUserByID(&comment.UserCreated.UUID); err == nil {
+				_ = sendCommentSubscriptionNotifications(domain, page, comment, commenter)
+			}
+		}()
+	}
+
+	// Notify websocket subscribers and webhooks
 	commentWebSocketNotify(page, comment, "update")
+	commentWebhookNotify(domain, page, comment, models.WebhookEventTypeCommentModerated)
 
 	// Succeeded
 	return nil
 }
 
+// commentRevisions returns all revisions of the comment with the given ID, oldest first, along with the current domain
+// user, after verifying the given user is allowed to moderate the comment's domain
+func commentRevisions(commentUUID strfmt.UUID, user *data.User) ([]*data.CommentRevision, *data.DomainUser, middleware.Responder) {
+	// Find the comment and related objects
+	comment, _, _, domainUser, r := commentGetCommentPageDomainUser(commentUUID, &user.ID)
+	if r != nil {
+		return nil, nil, r
+	}
+
+	// Verify the user is a moderator
+	if r := Verifier.UserCanModerateDomain(user, domainUser); r != nil {
+		return nil, nil, r
+	}
+
+	// Fetch the revisions
+	revs, err := svc.TheCommentService.ListRevisions(comment)
+	if err != nil {
+		return nil, nil, respServiceError(err)
+	}
+
+	// Succeeded
+	return revs, domainUser, nil
+}
+
+// commentWebhookNotify queues webhook deliveries about a change in the given comment, in background
+func commentWebhookNotify(domain *data.Domain, page *data.DomainPage, comment *data.Comment, event models.WebhookEventType) {
+	go func() { _ = svc.TheWebhookService.Notify(event, domain, page, comment) }()
+}
+
 // commentWebSocketNotify notifies websocket subscribers about a change in the given comment, in background
 func commentWebSocketNotify(page *data.DomainPage, comment *data.Comment, action string) {
 	if svc.TheWebSocketsService.Active() {
@@ -15,17 +15,31 @@ import (
 	"time"
 )
 
-func ConfigDynamicReset(_ api_general.ConfigDynamicResetParams, user *data.User) middleware.Responder {
+func ConfigDynamicReset(params api_general.ConfigDynamicResetParams, user *data.User) middleware.Responder {
 	// Verify the user is a superuser
 	if r := Verifier.UserIsSuperuser(user); r != nil {
 		return r
 	}
 
+	// Fetch the current config for the audit log
+	items, err := svc.TheDynConfigService.GetAll()
+	if err != nil {
+		return respServiceError(err)
+	}
+
 	// Reset the config
 	if err := svc.TheDynConfigService.Reset(); err != nil {
 		return respServiceError(err)
 	}
 
+	// Record the action in the audit log, listing the values that differed from their defaults
+	defaults := make(map[data.DynConfigItemKey]string, len(items))
+	for k, item := range items {
+		defaults[k] = item.DefaultValue
+	}
+	before, after := data.DynConfigDiff(items, defaults)
+	svc.TheAuditService.Record(auditEntry(params.HTTPRequest, user, data.AuditActionConfigReset).WithChange(before, after))
+
 	// Succeeded
 	return api_general.NewConfigDynamicResetNoContent()
 }
@@ -36,11 +50,22 @@ func ConfigDynamicUpdate(params api_general.ConfigDynamicUpdateParams, user *dat
 		return r
 	}
 
+	// Fetch the current config for the audit log
+	items, err := svc.TheDynConfigService.GetAll()
+	if err != nil {
+		return respServiceError(err)
+	}
+
 	// Update the config
-	if err := svc.TheDynConfigService.Update(&user.ID, data.DynConfigDTOsToMap(params.Body)); err != nil {
+	vals := data.DynConfigDTOsToMap(params.Body)
+	if err := svc.TheDynConfigService.Update(&user.ID, vals); err != nil {
 		return respServiceError(err)
 	}
 
+	// Record the action in the audit log
+	before, after := data.DynConfigDiff(items, vals)
+	svc.TheAuditService.Record(auditEntry(params.HTTPRequest, user, data.AuditActionConfigUpdate).WithChange(before, after))
+
 	// Succeeded
 	return api_general.NewConfigDynamicUpdateNoContent()
 }
@@ -7,6 +7,7 @@ import (
 	"github.com/go-openapi/runtime/middleware"
 	"github.com/go-openapi/swag"
 	"gitlab.com/comentario/comentario/internal/api/exmodels"
+	"gitlab.com/comentario/comentario/internal/api/models"
 	"gitlab.com/comentario/comentario/internal/api/restapi/operations/api_general"
 	"gitlab.com/comentario/comentario/internal/config"
 	"gitlab.com/comentario/comentario/internal/data"
@@ -106,6 +107,107 @@ func CurUserGet(params api_general.CurUserGetParams) middleware.Responder {
 	return api_general.NewCurUserGetOK().WithPayload(user.ToPrincipal(attr, nil))
 }
 
+func CurUserPasskeyDelete(params api_general.CurUserPasskeyDeleteParams, user *data.User) middleware.Responder {
+	// Parse the passkey ID
+	id, r := parseUUID(params.UUID)
+	if r != nil {
+		return r
+	}
+
+	// Delete the passkey, making sure it belongs to the user
+	if err := svc.ThePasskeyService.Delete(&user.ID, id); err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewCurUserPasskeyDeleteNoContent()
+}
+
+func CurUserPasskeyList(_ api_general.CurUserPasskeyListParams, user *data.User) middleware.Responder {
+	// Fetch the user's passkeys
+	pks, err := svc.ThePasskeyService.ListByUser(&user.ID)
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewCurUserPasskeyListOK().WithPayload(&api_general.CurUserPasskeyListOKBody{
+		Passkeys: data.SliceToDTOs[*data.Passkey, *models.Passkey](pks),
+	})
+}
+
+func CurUserPasskeyRegisterBegin(_ api_general.CurUserPasskeyRegisterBeginParams, user *data.User) middleware.Responder {
+	// Make sure passkeys are enabled
+	if r := Verifier.PasskeysEnabled(); r != nil {
+		return r
+	}
+
+	// Passkeys only apply to local users
+	if r := Verifier.UserIsLocal(user); r != nil {
+		return r
+	}
+
+	// Start a registration ceremony
+	id, opts, err := svc.ThePasskeyService.RegistrationBegin(user)
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewCurUserPasskeyRegisterBeginOK().WithPayload(passkeyCeremonyDTO(id, opts))
+}
+
+func CurUserPasskeyRegisterFinish(params api_general.CurUserPasskeyRegisterFinishParams, user *data.User) middleware.Responder {
+	// Make sure passkeys are enabled
+	if r := Verifier.PasskeysEnabled(); r != nil {
+		return r
+	}
+
+	// Passkeys only apply to local users
+	if r := Verifier.UserIsLocal(user); r != nil {
+		return r
+	}
+
+	// Parse the session ID
+	id, r := parseUUIDPtr(params.Body.SessionID)
+	if r != nil {
+		return r
+	}
+
+	// Serialise the credential back into JSON
+	b, r := passkeyCredentialJSON(params.Body.Credential)
+	if r != nil {
+		return r
+	}
+
+	// Verify the credential and save the passkey
+	pk, err := svc.ThePasskeyService.RegistrationFinish(user, id, data.TrimmedString(params.Body.Name), b)
+	if errors.Is(err, svc.ErrPasskeyVerification) {
+		return respBadRequest(exmodels.ErrorInvalidPasskey)
+	} else if err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewCurUserPasskeyRegisterFinishOK().WithPayload(pk.ToDTO())
+}
+
+func CurUserPasskeyUpdate(params api_general.CurUserPasskeyUpdateParams, user *data.User) middleware.Responder {
+	// Parse the passkey ID
+	id, r := parseUUID(params.UUID)
+	if r != nil {
+		return r
+	}
+
+	// Rename the passkey, making sure it belongs to the user
+	if err := svc.ThePasskeyService.Rename(&user.ID, id, data.TrimmedString(params.Body.Name)); err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewCurUserPasskeyUpdateNoContent()
+}
+
 func CurUserSetAvatar(params api_general.CurUserSetAvatarParams, user *data.User) middleware.Responder {
 	if params.Data != nil {
 		defer util.LogError(params.Data.Close, "CurUserSetAvatar, params.Data.Close()")
@@ -130,6 +232,187 @@ func CurUserSetAvatarFromGravatar(_ api_general.CurUserSetAvatarFromGravatarPara
 	return api_general.NewCurUserSetAvatarFromGravatarNoContent()
 }
 
+func CurUserTokenDelete(params api_general.CurUserTokenDeleteParams, user *data.User) middleware.Responder {
+	// Parse the token ID
+	id, r := parseUUID(params.UUID)
+	if r != nil {
+		return r
+	}
+
+	// Delete the token, making sure it belongs to the user
+	if err := svc.ThePersonalTokenService.Delete(&user.ID, id); err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewCurUserTokenDeleteNoContent()
+}
+
+func CurUserTokenList(_ api_general.CurUserTokenListParams, user *data.User) middleware.Responder {
+	// Fetch the user's tokens
+	ts, err := svc.ThePersonalTokenService.ListByUser(&user.ID)
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewCurUserTokenListOK().WithPayload(&api_general.CurUserTokenListOKBody{
+		Tokens: data.SliceToDTOs[*data.PersonalToken, *models.PersonalToken](ts),
+	})
+}
+
+func CurUserTokenNew(params api_general.CurUserTokenNewParams, user *data.User) middleware.Responder {
+	// Instantiate a new token
+	pt, value, err := data.NewPersonalToken(&user.ID)
+	if err != nil {
+		return respServiceError(err)
+	}
+	if err := pt.FromDTO(params.Body); err != nil {
+		return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("domainIds"))
+	}
+
+	// Verify the user has access to every domain the token is restricted to
+	for _, id := range pt.DomainIDList() {
+		if _, du, err := svc.TheDomainService.FindDomainUserByID(&id, &user.ID, false); errors.Is(err, svc.ErrNotFound) {
+			return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("domainIds"))
+		} else if err != nil {
+			return respServiceError(err)
+		} else if du == nil && !user.IsSuperuser {
+			return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("domainIds"))
+		}
+	}
+
+	// Persist the token
+	if err := svc.ThePersonalTokenService.Create(pt); err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewCurUserTokenNewOK().WithPayload(&api_general.CurUserTokenNewOKBody{
+		Token: pt.ToDTO(),
+		Value: &value,
+	})
+}
+
+func CurUserTotpDisable(params api_general.CurUserTotpDisableParams, user *data.User) middleware.Responder {
+	// Make sure two-factor authentication is enabled
+	if !user.TOTPEnabled {
+		return respBadRequest(exmodels.ErrorTOTPNotEnabled)
+	}
+
+	// Verify the current password and the second factor
+	if r := Verifier.UserCurrentPassword(user, swag.StringValue(params.Body.CurPassword)); r != nil {
+		return r
+	} else if r := Verifier.UserSecondFactor(user, string(*params.Body.Code)); r != nil {
+		return r
+	}
+
+	// Disable two-factor authentication
+	if err := svc.TheUserService.UpdateTOTP(user.WithTOTPEnabled(false)); err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewCurUserTotpDisableNoContent()
+}
+
+func CurUserTotpEnable(params api_general.CurUserTotpEnableParams, user *data.User) middleware.Responder {
+	// Make sure two-factor authentication is enabled
+	if r := Verifier.TOTPEnabled(); r != nil {
+		return r
+	}
+
+	// Make sure two-factor authentication isn't enabled yet
+	if user.TOTPEnabled {
+		return respBadRequest(exmodels.ErrorTOTPAlreadyEnabled)
+	}
+
+	// Verify the code against the pending secret
+	if !user.VerifyTOTPCode(string(*params.Body.Code)) {
+		return respBadRequest(exmodels.ErrorInvalidTOTPCode)
+	}
+
+	// Enable two-factor authentication and generate recovery codes
+	codes, err := user.WithTOTPEnabled(true).TOTPRecoveryCodesNew()
+	if err != nil {
+		return respServiceError(err)
+	}
+	if err := svc.TheUserService.UpdateTOTP(user); err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewCurUserTotpEnableOK().WithPayload(&models.TotpRecoveryCodes{Codes: codes})
+}
+
+func CurUserTotpGet(_ api_general.CurUserTotpGetParams, user *data.User) middleware.Responder {
+	return api_general.NewCurUserTotpGetOK().WithPayload(&api_general.CurUserTotpGetOKBody{
+		CountRecoveryCodes: int64(user.TOTPRecoveryCodeCount()),
+		Enabled:            user.TOTPEnabled,
+		EnabledTime:        data.NullDateTime(user.TOTPEnabledTime),
+	})
+}
+
+func CurUserTotpNew(params api_general.CurUserTotpNewParams, user *data.User) middleware.Responder {
+	// Make sure two-factor authentication is enabled
+	if r := Verifier.TOTPEnabled(); r != nil {
+		return r
+	}
+
+	// Two-factor authentication only applies to local users
+	if r := Verifier.UserIsLocal(user); r != nil {
+		return r
+	}
+
+	// Make sure two-factor authentication isn't enabled yet
+	if user.TOTPEnabled {
+		return respBadRequest(exmodels.ErrorTOTPAlreadyEnabled)
+	}
+
+	// Verify the current password
+	if r := Verifier.UserCurrentPassword(user, swag.StringValue(params.Body.CurPassword)); r != nil {
+		return r
+	}
+
+	// Generate a new (pending) secret
+	if err := user.TOTPSecretNew(); err != nil {
+		return respServiceError(err)
+	}
+	if err := svc.TheUserService.UpdateTOTP(user); err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewCurUserTotpNewOK().WithPayload(&api_general.CurUserTotpNewOKBody{
+		Secret: swag.String(user.TOTPSecret),
+		URI:    swag.String(user.TOTPProvisioningURI()),
+	})
+}
+
+func CurUserTotpRecoveryCodesNew(params api_general.CurUserTotpRecoveryCodesNewParams, user *data.User) middleware.Responder {
+	// Make sure two-factor authentication is enabled
+	if !user.TOTPEnabled {
+		return respBadRequest(exmodels.ErrorTOTPNotEnabled)
+	}
+
+	// Verify the second factor
+	if r := Verifier.UserSecondFactor(user, string(*params.Body.Code)); r != nil {
+		return r
+	}
+
+	// Replace the recovery codes
+	codes, err := user.TOTPRecoveryCodesNew()
+	if err != nil {
+		return respServiceError(err)
+	}
+	if err := svc.TheUserService.UpdateTOTP(user); err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewCurUserTotpRecoveryCodesNewOK().WithPayload(&models.TotpRecoveryCodes{Codes: codes})
+}
+
 func CurUserUpdate(params api_general.CurUserUpdateParams, user *data.User) middleware.Responder {
 	// If it's a local user
 	if user.IsLocal() {
@@ -1,8 +1,10 @@
 package handlers
 
 import (
-	"bytes"
+	"bufio"
+	"errors"
 	"fmt"
+	"github.com/go-openapi/runtime"
 	"github.com/go-openapi/runtime/middleware"
 	"github.com/go-openapi/strfmt"
 	"github.com/go-openapi/swag"
@@ -28,6 +30,10 @@ func DomainClear(params api_general.DomainClearParams, user *data.User) middlewa
 		// Clear all domain's users/pages/comments
 	} else if err := svc.TheDomainService.ClearByID(&d.ID); err != nil {
 		return respServiceError(err)
+
+	} else {
+		// Record the action in the audit log
+		svc.TheAuditService.Record(auditEntry(params.HTTPRequest, user, data.AuditActionDomainClear).WithDomain(&d.ID))
 	}
 
 	// Succeeded
@@ -53,6 +59,13 @@ func DomainDelete(params api_general.DomainDeleteParams, user *data.User) middle
 		// Delete the domain and all dependent objects
 	} else if err := svc.TheDomainService.DeleteByID(&d.ID); err != nil {
 		return respServiceError(err)
+
+	} else {
+		// Record the action in the audit log
+		svc.TheAuditService.Record(
+			auditEntry(params.HTTPRequest, user, data.AuditActionDomainDelete).
+				WithDomain(&d.ID).
+				WithChange(d.ToDTO(), nil))
 	}
 
 	// Succeeded
@@ -61,22 +74,36 @@ func DomainDelete(params api_general.DomainDeleteParams, user *data.User) middle
 
 func DomainExport(params api_general.DomainExportParams, user *data.User) middleware.Responder {
 	// Find the domain and verify the user's privileges
-	if d, _, r := domainGetWithUser(params.UUID, user, true); r != nil {
+	d, _, r := domainGetWithUser(params.UUID, user, true)
+	if r != nil {
 		return r
-
-		// Export the data
-	} else if b, err := svc.TheImportExportService.Export(&d.ID); err != nil {
-		return respServiceError(err)
-	} else {
-		// Succeeded. Send the data as a file
-		return api_general.NewDomainExportOK().
-			WithContentDisposition(
-				fmt.Sprintf(
-					`inline; filename="%s-%s.json.gz"`,
-					strings.ReplaceAll(d.Host, ":", "-"),
-					time.Now().UTC().Format("2006-01-02-15-04-05"))).
-			WithPayload(io.NopCloser(bytes.NewReader(b)))
 	}
+
+	// Collect the export options
+	format := swag.StringValue(params.Format)
+	filter := &svc.ExportFilter{
+		From:           (*time.Time)(params.From),
+		To:             (*time.Time)(params.To),
+		Since:          (*time.Time)(params.Since),
+		PathPrefix:     swag.StringValue(params.PathPrefix),
+		ApprovedOnly:   swag.BoolValue(params.ApprovedOnly),
+		IncludeDeleted: swag.BoolValue(params.Deleted),
+	}
+
+	// Succeeded. Stream the data as a file, since it's written as it's being read from the database
+	return middleware.ResponderFunc(func(rw http.ResponseWriter, _ runtime.Producer) {
+		rw.Header().Set(
+			"Content-Disposition",
+			fmt.Sprintf(
+				`inline; filename="%s-%s.%s.gz"`,
+				strings.ReplaceAll(d.Host, ":", "-"),
+				time.Now().UTC().Format("2006-01-02-15-04-05"),
+				util.ExportFileExtensions[format]))
+		rw.WriteHeader(http.StatusOK)
+
+		// The status is already sent at this point, so an error can only be logged (which the service does)
+		_ = svc.TheImportExportService.Export(d, format, filter, rw)
+	})
 }
 
 // DomainGet returns properties of a domain belonging to the current user
@@ -127,52 +154,101 @@ func DomainGet(params api_general.DomainGetParams, user *data.User) middleware.R
 func DomainImport(params api_general.DomainImportParams, user *data.User) middleware.Responder {
 	defer util.LogError(params.Data.Close, "DomainImport, defer Data.Close()")
 
-	// Read the entire data buffer into memory
-	expData, err := io.ReadAll(params.Data)
-	if err != nil {
-		logger.Warningf("DomainImport(): failed to read data buffer: %v", err)
-		return respInternalError(nil)
+	// Find the domain and verify the user's privileges
+	domain, _, r := domainGetWithUser(params.UUID, user, true)
+	if r != nil {
+		return r
+	}
+
+	// Make sure no other import into the domain is in progress
+	if jobs, err := svc.TheImportExportService.ListImportJobs(&domain.ID); err != nil {
+		return respServiceError(err)
+	} else {
+		for _, j := range jobs {
+			if j.IsRunning() {
+				return respBadRequest(exmodels.ErrorImportInProgress)
+			}
+		}
 	}
 
-	// Detect data content type and decompress if needed
-	ct := http.DetectContentType(expData)
-	switch ct {
-	case "application/x-gzip":
-		expData, err = util.DecompressGzip(expData)
-	case "application/zip":
-		expData, err = util.DecompressZip(expData)
-	case "application/octet-stream":
+	// Detect data content type: Isso data is the only supported binary format, being an SQLite database. Compressed
+	// data is decompressed by the import itself
+	br := bufio.NewReader(params.Data)
+	if b, err := br.Peek(512); err != nil && !errors.Is(err, io.EOF) {
+		logger.Warningf("DomainImport(): failed to read data buffer: %v", err)
+		return respInternalError(nil)
+	} else if http.DetectContentType(b) == "application/octet-stream" && params.Source != "isso" {
 		return respBadRequest(exmodels.ErrorInvalidInputData.WithDetails("unsupported binary data format"))
 	}
+
+	// Store the data and start the import in the background
+	job, err := svc.TheImportExportService.StartImport(user, domain, params.Source, swag.BoolValue(params.DryRun), br)
 	if err != nil {
-		logger.Warningf("DomainImport(): failed to decompress data: %v", err)
-		return respBadRequest(exmodels.ErrorInvalidInputData.WithDetails("decompression failed"))
+		return respServiceError(err)
 	}
 
-	// Find the domain and verify the user's privileges
-	domain, _, r := domainGetWithUser(params.UUID, user, true)
+	// Record the action in the audit log, unless it's a dry run, which doesn't change anything
+	if !job.DryRun {
+		svc.TheAuditService.Record(
+			auditEntry(params.HTTPRequest, user, data.AuditActionDomainImport).
+				WithDomain(&domain.ID).
+				WithChange(nil, map[string]any{"source": params.Source, "job": &job.ID}))
+	}
+
+	// Succeeded
+	return api_general.NewDomainImportOK().WithPayload(job.ToDTO())
+}
+
+func DomainImportJobCancel(params api_general.DomainImportJobCancelParams, user *data.User) middleware.Responder {
+	// Find the job
+	job, r := domainImportJobGet(params.UUID, params.JobID, user)
 	if r != nil {
 		return r
 	}
 
-	// Perform import
-	var res *svc.ImportResult
-	switch params.Source {
-	case "comentario":
-		res = svc.TheImportExportService.Import(user, domain, expData)
+	// Make sure the job is still running
+	if !job.IsRunning() {
+		return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("status"))
+	}
 
-	case "disqus":
-		res = svc.TheImportExportService.ImportDisqus(user, domain, expData)
+	// Cancel the job
+	if err := svc.TheImportExportService.CancelImport(job); err != nil {
+		return respServiceError(err)
+	}
 
-	case "wordpress":
-		res = svc.TheImportExportService.ImportWordPress(user, domain, expData)
+	// Succeeded
+	return api_general.NewDomainImportJobCancelOK().WithPayload(job.ToDTO())
+}
 
-	default:
-		return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("source"))
+func DomainImportJobGet(params api_general.DomainImportJobGetParams, user *data.User) middleware.Responder {
+	// Find the job
+	job, r := domainImportJobGet(params.UUID, params.JobID, user)
+	if r != nil {
+		return r
 	}
 
 	// Succeeded
-	return api_general.NewDomainImportOK().WithPayload(res.ToDTO())
+	return api_general.NewDomainImportJobGetOK().WithPayload(job.ToDTO())
+}
+
+func DomainImportJobList(params api_general.DomainImportJobListParams, user *data.User) middleware.Responder {
+	// Find the domain and verify the user's privileges
+	domain, _, r := domainGetWithUser(params.UUID, user, true)
+	if r != nil {
+		return r
+	}
+
+	// Fetch the domain's jobs
+	jobs, err := svc.TheImportExportService.ListImportJobs(&domain.ID)
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewDomainImportJobListOK().
+		WithPayload(&api_general.DomainImportJobListOKBody{
+			Jobs: data.SliceToDTOs[*data.ImportJob, *models.ImportJob](jobs),
+		})
 }
 
 func DomainList(params api_general.DomainListParams, user *data.User) middleware.Responder {
@@ -260,6 +336,14 @@ func DomainPurge(params api_general.DomainPurgeParams, user *data.User) middlewa
 		return respServiceError(err)
 
 	} else {
+		// Record the action in the audit log
+		svc.TheAuditService.Record(
+			auditEntry(params.HTTPRequest, user, data.AuditActionDomainPurge).
+				WithDomain(&d.ID).
+				WithChange(
+					map[string]any{"markedDeleted": params.Body.MarkedDeleted, "userCreatedDeleted": params.Body.UserCreatedDeleted},
+					map[string]any{"commentCount": cnt}))
+
 		// Succeeded
 		return api_general.NewDomainPurgeOK().WithPayload(&api_general.DomainPurgeOKBody{CommentCount: cnt})
 	}
@@ -275,6 +359,12 @@ func DomainSsoSecretNew(params api_general.DomainSsoSecretNewParams, user *data.
 		return respServiceError(err)
 
 	} else {
+		// Record the action in the audit log (without the secret itself)
+		svc.TheAuditService.Record(
+			auditEntry(params.HTTPRequest, user, data.AuditActionDomainSSOSecret).
+				WithDomain(&d.ID).
+				WithChange(map[string]any{"ssoSecretConfigured": d.SSOSecret.Valid}, map[string]any{"ssoSecretConfigured": true}))
+
 		// Succeeded
 		return api_general.NewDomainSsoSecretNewOK().WithPayload(&api_general.DomainSsoSecretNewOKBody{SsoSecret: ss})
 	}
@@ -289,6 +379,13 @@ func DomainReadonly(params api_general.DomainReadonlyParams, user *data.User) mi
 		// Update the domain status
 	} else if err := svc.TheDomainService.SetReadonly(&d.ID, swag.BoolValue(params.Body.Readonly)); err != nil {
 		return respServiceError(err)
+
+	} else {
+		// Record the action in the audit log
+		svc.TheAuditService.Record(
+			auditEntry(params.HTTPRequest, user, data.AuditActionDomainReadonly).
+				WithDomain(&d.ID).
+				WithChange(map[string]any{"readonly": d.IsReadonly}, map[string]any{"readonly": swag.BoolValue(params.Body.Readonly)}))
 	}
 
 	// Succeeded
@@ -323,19 +420,40 @@ func DomainUpdate(params api_general.DomainUpdateParams, user *data.User) middle
 		return r
 	}
 
+	// Fetch the current configuration and identity providers for the audit log
+	cfg, err := svc.TheDomainConfigService.GetAll(&domain.ID)
+	if err != nil {
+		return respServiceError(err)
+	}
+	idps, err := svc.TheDomainService.ListDomainFederatedIdPs(&domain.ID)
+	if err != nil {
+		return respServiceError(err)
+	}
+	cfgVals := data.DynConfigDTOsToMap(params.Body.Configuration)
+	cfgBefore, cfgAfter := data.DynConfigDiff(cfg, cfgVals)
+	before := map[string]any{"domain": domain.ToDTO(), "configuration": cfgBefore, "federatedIdpIds": idps}
+
 	// Update domain properties
 	domain.FromDTO(params.Body.Domain)
 
 	// Persist the updated properties
-	err := util.CheckErrors(
+	err = util.CheckErrors(
 		svc.TheDomainService.Update(domain),
-		svc.TheDomainConfigService.Update(&domain.ID, &user.ID, data.DynConfigDTOsToMap(params.Body.Configuration)),
+		svc.TheDomainConfigService.Update(&domain.ID, &user.ID, cfgVals),
 		svc.TheDomainService.SaveIdPs(&domain.ID, params.Body.FederatedIdpIds),
 		svc.TheDomainService.SaveExtensions(&domain.ID, exts))
 	if err != nil {
 		return respServiceError(err)
 	}
 
+	// Record the action in the audit log
+	svc.TheAuditService.Record(
+		auditEntry(params.HTTPRequest, user, data.AuditActionDomainUpdate).
+			WithDomain(&domain.ID).
+			WithChange(
+				before,
+				map[string]any{"domain": domain.ToDTO(), "configuration": cfgAfter, "federatedIdpIds": params.Body.FederatedIdpIds}))
+
 	// Succeeded
 	return api_general.NewDomainUpdateOK().WithPayload(domain.ToDTO())
 }
@@ -411,3 +529,26 @@ func domainGetWithUser(domainUUID strfmt.UUID, user *data.User, checkCanManage b
 		return domain, domainUser, nil
 	}
 }
+
+// domainImportJobGet parses string UUIDs and fetches the corresponding domain's import job, verifying the user is
+// allowed to manage the domain
+func domainImportJobGet(domainUUID, jobUUID strfmt.UUID, user *data.User) (*data.ImportJob, middleware.Responder) {
+	// Find the domain and verify the user's privileges
+	domain, _, r := domainGetWithUser(domainUUID, user, true)
+	if r != nil {
+		return nil, r
+	}
+
+	// Parse job ID
+	if jobID, r := parseUUID(jobUUID); r != nil {
+		return nil, r
+
+		// Find the job
+	} else if job, err := svc.TheImportExportService.FindImportJob(&domain.ID, jobID); err != nil {
+		return nil, respServiceError(err)
+
+	} else {
+		// Succeeded
+		return job, nil
+	}
+}
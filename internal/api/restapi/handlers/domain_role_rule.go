@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"github.com/go-openapi/runtime/middleware"
+	"gitlab.com/comentario/comentario/internal/api/exmodels"
+	"gitlab.com/comentario/comentario/internal/api/models"
+	"gitlab.com/comentario/comentario/internal/api/restapi/operations/api_general"
+	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/svc"
+	"strings"
+)
+
+func DomainRoleRuleList(params api_general.DomainRoleRuleListParams, user *data.User) middleware.Responder {
+	// Find the domain and verify the user's privileges
+	d, _, r := domainGetWithUser(params.UUID, user, true)
+	if r != nil {
+		return r
+	}
+
+	// Fetch the rules
+	rules, err := svc.TheDomainService.ListRoleRules(&d.ID)
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewDomainRoleRuleListOK().
+		WithPayload(&api_general.DomainRoleRuleListOKBody{
+			Rules: data.SliceToDTOs[*data.DomainRoleRule, *models.DomainRoleRule](rules),
+		})
+}
+
+func DomainRoleRuleSave(params api_general.DomainRoleRuleSaveParams, user *data.User) middleware.Responder {
+	// Find the domain and verify the user's privileges
+	d, _, r := domainGetWithUser(params.UUID, user, true)
+	if r != nil {
+		return r
+	}
+
+	// Convert the DTOs into rules, keeping their order
+	rules := make([]*data.DomainRoleRule, 0, len(params.Body.Rules))
+	for i, dto := range params.Body.Rules {
+		rule := data.NewDomainRoleRule(&d.ID, &user.ID, i)
+		rule.FromDTO(dto)
+
+		// Validate the rule
+		if r := domainRoleRuleValidate(rule); r != nil {
+			return r
+		}
+		rules = append(rules, rule)
+	}
+
+	// Fetch the current rules for the audit log
+	oldRules, err := svc.TheDomainService.ListRoleRules(&d.ID)
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Persist the rules
+	if err := svc.TheDomainService.SaveRoleRules(&d.ID, rules); err != nil {
+		return respServiceError(err)
+	}
+
+	// Record the action in the audit log, as it affects user privileges
+	svc.TheAuditService.Record(
+		auditEntry(params.HTTPRequest, user, data.AuditActionDomainRoleRules).
+			WithDomain(&d.ID).
+			WithChange(
+				data.SliceToDTOs[*data.DomainRoleRule, *models.DomainRoleRule](oldRules),
+				data.SliceToDTOs[*data.DomainRoleRule, *models.DomainRoleRule](rules)))
+
+	// Succeeded
+	return api_general.NewDomainRoleRuleSaveOK().
+		WithPayload(&api_general.DomainRoleRuleSaveOKBody{
+			Rules: data.SliceToDTOs[*data.DomainRoleRule, *models.DomainRoleRule](rules),
+		})
+}
+
+// domainRoleRuleValidate verifies the provided role rule contains valid data
+func domainRoleRuleValidate(rule *data.DomainRoleRule) middleware.Responder {
+	// Verify the claim path has no empty elements
+	if rule.Claim == "" || strings.HasPrefix(rule.Claim, ".") || strings.HasSuffix(rule.Claim, ".") || strings.Contains(rule.Claim, "..") {
+		return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("claim"))
+	}
+
+	// Verify the role
+	switch rule.Role {
+	case models.DomainUserRoleOwner, models.DomainUserRoleModerator, models.DomainUserRoleCommenter, models.DomainUserRoleReadonly:
+		// Succeeded
+		return nil
+	}
+	return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("role"))
+}
@@ -70,14 +70,25 @@ func DomainUserUpdate(params api_general.DomainUserUpdateParams, user *data.User
 	}
 
 	// Update the domain user
+	oldRole := du.Role()
 	du.WithRole(role).
 		WithNotifyReplies(params.Body.NotifyReplies).
 		WithNotifyModerator(params.Body.NotifyModerator).
-		WithNotifyCommentStatus(params.Body.NotifyCommentStatus)
+		WithNotifyCommentStatus(params.Body.NotifyCommentStatus).
+		WithDigestMode(params.Body.DigestMode)
 	if err := svc.TheDomainService.UserModify(du); err != nil {
 		return respServiceError(err)
 	}
 
+	// Record any role change in the audit log
+	if role != oldRole {
+		svc.TheAuditService.Record(
+			auditEntry(params.HTTPRequest, user, data.AuditActionDomainUserUpdate).
+				WithDomain(&du.DomainID).
+				WithTarget(&du.UserID).
+				WithChange(map[string]any{"role": oldRole}, map[string]any{"role": role}))
+	}
+
 	// Succeeded
 	return api_general.NewDomainUserUpdateNoContent()
 }
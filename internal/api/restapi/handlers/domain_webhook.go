@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/go-openapi/strfmt"
+	"gitlab.com/comentario/comentario/internal/api/exmodels"
+	"gitlab.com/comentario/comentario/internal/api/models"
+	"gitlab.com/comentario/comentario/internal/api/restapi/operations/api_general"
+	"gitlab.com/comentario/comentario/internal/config"
+	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/svc"
+	"gitlab.com/comentario/comentario/internal/util"
+)
+
+func DomainWebhookDelete(params api_general.DomainWebhookDeleteParams, user *data.User) middleware.Responder {
+	// Find the domain and the webhook, verifying the user's privileges
+	if d, wh, r := domainWebhookGet(params.UUID, params.WebhookID, user); r != nil {
+		return r
+
+		// Delete the webhook
+	} else if err := svc.TheWebhookService.DeleteByID(&d.ID, &wh.ID); err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewDomainWebhookDeleteNoContent()
+}
+
+func DomainWebhookDeliveryList(params api_general.DomainWebhookDeliveryListParams, user *data.User) middleware.Responder {
+	// Find the domain and the webhook, verifying the user's privileges
+	_, wh, r := domainWebhookGet(params.UUID, params.WebhookID, user)
+	if r != nil {
+		return r
+	}
+
+	// Fetch the deliveries
+	wds, err := svc.TheWebhookService.ListDeliveries(&wh.ID, data.PageIndex(params.Page))
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewDomainWebhookDeliveryListOK().
+		WithPayload(&api_general.DomainWebhookDeliveryListOKBody{
+			Deliveries: data.SliceToDTOs[*data.WebhookDelivery, *models.WebhookDelivery](wds),
+		})
+}
+
+func DomainWebhookList(params api_general.DomainWebhookListParams, user *data.User) middleware.Responder {
+	// Find the domain and verify the user's privileges
+	d, _, r := domainGetWithUser(params.UUID, user, true)
+	if r != nil {
+		return r
+	}
+
+	// Fetch the webhooks
+	whs, err := svc.TheWebhookService.ListByDomain(&d.ID)
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Convert the webhooks into DTOs, omitting their secrets
+	var dtos []*models.DomainWebhook
+	for _, wh := range whs {
+		dtos = append(dtos, wh.ToDTO(false))
+	}
+
+	// Succeeded
+	return api_general.NewDomainWebhookListOK().WithPayload(&api_general.DomainWebhookListOKBody{Webhooks: dtos})
+}
+
+func DomainWebhookNew(params api_general.DomainWebhookNewParams, user *data.User) middleware.Responder {
+	// Find the domain and verify the user's privileges
+	d, _, r := domainGetWithUser(params.UUID, user, true)
+	if r != nil {
+		return r
+	}
+
+	// Validate the webhook properties
+	if r := domainWebhookValidate(params.Body.Webhook); r != nil {
+		return r
+	}
+
+	// Prepare a webhook
+	wh, err := data.NewDomainWebhook(&d.ID, &user.ID)
+	if err != nil {
+		return respServiceError(err)
+	}
+	wh.FromDTO(params.Body.Webhook)
+
+	// Persist the webhook
+	if err := svc.TheWebhookService.Create(wh); err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded. This is the only time the secret is disclosed, except for a regeneration
+	return api_general.NewDomainWebhookNewOK().WithPayload(wh.ToDTO(true))
+}
+
+func DomainWebhookUpdate(params api_general.DomainWebhookUpdateParams, user *data.User) middleware.Responder {
+	// Find the domain and the webhook, verifying the user's privileges
+	_, wh, r := domainWebhookGet(params.UUID, params.WebhookID, user)
+	if r != nil {
+		return r
+	}
+
+	// Validate the webhook properties
+	if r := domainWebhookValidate(params.Body.Webhook); r != nil {
+		return r
+	}
+
+	// Update the webhook, regenerating the secret if requested
+	wh.FromDTO(params.Body.Webhook)
+	regen := params.Body.RegenerateSecret
+	if regen {
+		if err := wh.SecretNew(); err != nil {
+			return respServiceError(err)
+		}
+	}
+
+	// Persist the webhook
+	if err := svc.TheWebhookService.Update(wh); err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewDomainWebhookUpdateOK().WithPayload(wh.ToDTO(regen))
+}
+
+// domainWebhookGet parses string domain and webhook UUIDs and fetches the corresponding domain and webhook, verifying
+// the user is allowed to manage the domain
+func domainWebhookGet(domainUUID, webhookUUID strfmt.UUID, user *data.User) (*data.Domain, *data.DomainWebhook, middleware.Responder) {
+	// Find the domain and verify the user's privileges
+	if d, _, r := domainGetWithUser(domainUUID, user, true); r != nil {
+		return nil, nil, r
+
+		// Parse webhook ID
+	} else if whID, r := parseUUID(webhookUUID); r != nil {
+		return nil, nil, r
+
+		// Find the webhook
+	} else if wh, err := svc.TheWebhookService.FindByID(&d.ID, whID); err != nil {
+		return nil, nil, respServiceError(err)
+
+	} else {
+		// Succeeded
+		return d, wh, nil
+	}
+}
+
+// domainWebhookValidate verifies the provided webhook DTO contains valid data
+func domainWebhookValidate(dto *models.DomainWebhook) middleware.Responder {
+	// Validate the URL (the Swagger format only performs a superficial check)
+	u, err := util.ParseAbsoluteURL(data.URIPtrToString(dto.URL), true, false)
+	if err != nil {
+		return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("url"))
+	}
+
+	// Make sure the URL doesn't point to an internal address (allow it in e2e-testing mode)
+	if !config.ServerConfig.E2e {
+		if err := util.VerifyPublicHost(u.Hostname()); err != nil {
+			return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("url: " + err.Error()))
+		}
+	}
+
+	// Make sure at least one event is subscribed to
+	if len(dto.Events) == 0 {
+		return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("events"))
+	}
+
+	// Succeeded
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/go-openapi/runtime/middleware"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/op/go-logging"
 	complugin "gitlab.com/comentario/comentario/extend/plugin"
 	"gitlab.com/comentario/comentario/internal/api/exmodels"
@@ -22,6 +23,7 @@ import (
 	"os"
 	"path"
 	"plugin"
+	"time"
 )
 
 // Global e2e handler instance (only in e2e testing mode)
@@ -305,16 +307,37 @@ func E2eOAuthSSONonInteractive(params api_e2e.E2eOAuthSSONonInteractiveParams) m
 		Name:  "John Doe",
 		Role:  string(models.DomainUserRoleModerator),
 	}
-	payloadBytes, err := json.Marshal(payload)
-	if err != nil {
-		return respInternalError(nil)
-	}
 
-	// Calculate the callback URL, including the payload and its HMAC signature
+	// Calculate the callback URL, including the payload
 	u := config.ServerConfig.ParsedBaseURL().JoinPath(util.APIPath, "oauth/sso/callback")
 	q := u.Query()
-	q.Set("payload", hex.EncodeToString(payloadBytes))
-	q.Set("hmac", hex.EncodeToString(util.HMACSign(payloadBytes, secBytes)))
+	if domain.SSOType == data.DomainSSOTypeJWT {
+		// JWT SSO: pass the payload as claims of a token signed with the SSO secret
+		now := time.Now()
+		s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &svc.SSOClaims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				IssuedAt:  jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			},
+			Token: payload.Token,
+			Email: payload.Email,
+			Name:  payload.Name,
+			Role:  payload.Role,
+		}).SignedString(secBytes)
+		if err != nil {
+			return respInternalError(nil)
+		}
+		q.Set("jwt", s)
+
+	} else {
+		// HMAC SSO: pass the hex-encoded payload along with its HMAC signature
+		payloadBytes, err := json.Marshal(payload)
+		if err != nil {
+			return respInternalError(nil)
+		}
+		q.Set("payload", hex.EncodeToString(payloadBytes))
+		q.Set("hmac", hex.EncodeToString(util.HMACSign(payloadBytes, secBytes)))
+	}
 	u.RawQuery = q.Encode()
 
 	// Succeeded
@@ -18,6 +18,7 @@ func EmbedAuthLogin(params api_embed.EmbedAuthLoginParams) middleware.Responder
 	user, us, r := loginLocalUser(
 		data.EmailPtrToString(params.Body.Email),
 		swag.StringValue(params.Body.Password),
+		string(params.Body.TotpCode),
 		string(params.Body.Host),
 		params.HTTPRequest)
 	if r != nil {
@@ -108,6 +109,54 @@ func EmbedAuthLogout(params api_embed.EmbedAuthLogoutParams, _ *data.User) middl
 	return api_embed.NewEmbedAuthLogoutNoContent()
 }
 
+func EmbedAuthPasskeyLoginBegin(params api_embed.EmbedAuthPasskeyLoginBeginParams) middleware.Responder {
+	// Make sure passkeys are enabled
+	if r := Verifier.PasskeysEnabled(); r != nil {
+		return r
+	}
+
+	// Start a sign-in ceremony
+	id, opts, err := svc.ThePasskeyService.LoginBegin(string(params.Body.Host))
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_embed.NewEmbedAuthPasskeyLoginBeginOK().WithPayload(passkeyCeremonyDTO(id, opts))
+}
+
+func EmbedAuthPasskeyLoginFinish(params api_embed.EmbedAuthPasskeyLoginFinishParams) middleware.Responder {
+	// Make sure passkeys are enabled
+	if r := Verifier.PasskeysEnabled(); r != nil {
+		return r
+	}
+
+	// Log the user in
+	host := string(params.Body.Host)
+	user, us, r := loginPasskeyUser(params.Body.SessionID, params.Body.Credential, host, params.HTTPRequest)
+	if r != nil {
+		return r
+	}
+
+	// Fetch the user's attributes
+	attr, err := svc.TheUserAttrService.GetAll(&user.ID)
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Find the domain user, creating one if necessary
+	_, du, err := svc.TheDomainService.FindDomainUserByHost(host, &user.ID, true)
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_embed.NewEmbedAuthPasskeyLoginFinishOK().WithPayload(&api_embed.EmbedAuthPasskeyLoginFinishOKBody{
+		SessionToken: us.EncodeIDs(),
+		Principal:    user.ToPrincipal(attr, du),
+	})
+}
+
 func EmbedAuthSignup(params api_embed.EmbedAuthSignupParams) middleware.Responder {
 	// Extract domain ID
 	domainID, r := parseUUID(params.Body.DomainID)
@@ -187,12 +236,17 @@ func EmbedAuthCurUserUpdate(params api_embed.EmbedAuthCurUserUpdateParams, user
 		return respServiceError(err)
 	}
 
-	// Update the domain user, if the settings change
-	if du.NotifyReplies != params.Body.NotifyReplies || du.NotifyModerator != params.Body.NotifyModerator || du.NotifyCommentStatus != params.Body.NotifyCommentStatus {
+	// Update the domain user, if the settings change (an empty digest mode means it remains unchanged)
+	digestMode := params.Body.DigestMode
+	if du.NotifyReplies != params.Body.NotifyReplies ||
+		du.NotifyModerator != params.Body.NotifyModerator ||
+		du.NotifyCommentStatus != params.Body.NotifyCommentStatus ||
+		digestMode != "" && du.DigestMode != digestMode {
 		if err := svc.TheDomainService.UserModify(du.
 			WithNotifyReplies(params.Body.NotifyReplies).
 			WithNotifyModerator(params.Body.NotifyModerator).
-			WithNotifyCommentStatus(params.Body.NotifyCommentStatus),
+			WithNotifyCommentStatus(params.Body.NotifyCommentStatus).
+			WithDigestMode(digestMode),
 		); err != nil {
 			return respServiceError(err)
 		}
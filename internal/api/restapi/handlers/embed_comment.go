@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"errors"
+	"fmt"
 	"github.com/go-openapi/runtime/middleware"
 	"github.com/go-openapi/strfmt"
 	"github.com/go-openapi/swag"
@@ -37,7 +38,7 @@ func EmbedCommentCount(params api_embed.EmbedCommentCountParams) middleware.Resp
 
 func EmbedCommentDelete(params api_embed.EmbedCommentDeleteParams, user *data.User) middleware.Responder {
 	// Delete the comment
-	if r := commentDelete(params.UUID, user); r != nil {
+	if r := commentDelete(params.HTTPRequest, params.UUID, user); r != nil {
 		return r
 	}
 
@@ -45,6 +46,94 @@ func EmbedCommentDelete(params api_embed.EmbedCommentDeleteParams, user *data.Us
 	return api_embed.NewEmbedCommentDeleteNoContent()
 }
 
+func EmbedCommentFlag(params api_embed.EmbedCommentFlagParams) middleware.Responder {
+	// Try to authenticate the user
+	user, _, err := svc.TheAuthService.GetUserSessionBySessionHeader(params.HTTPRequest)
+	if errors.Is(err, svc.ErrSessionHeaderMissing) {
+		// No auth header: the user is anonymous
+		user = data.AnonymousUser
+	} else if err != nil {
+		// Any error other than "auth header missing"
+		return respUnauthorized(exmodels.ErrorUnauthenticated)
+	}
+
+	// Find the comment and the related objects
+	comment, page, domain, _, r := commentGetCommentPageDomainUser(params.UUID, &user.ID)
+	if r != nil {
+		return r
+	}
+
+	// Make sure flagging is enabled, and, for an anonymous user, allowed without registration
+	if !svc.TheDomainConfigService.GetBool(&domain.ID, data.DomainConfigKeyFlaggingEnabled) {
+		return respForbidden(exmodels.ErrorFeatureDisabled.WithDetails("comment flagging"))
+	} else if user.IsAnonymous() && !svc.TheDomainConfigService.GetBool(&domain.ID, data.DomainConfigKeyFlaggingAnonymous) {
+		return respUnauthorized(exmodels.ErrorUnauthenticated)
+	}
+
+	// Only visible comments can be flagged
+	if comment.IsDeleted || comment.IsPending || !comment.IsApproved {
+		return respNotFound(nil)
+	}
+
+	// Make sure the user is not flagging their own comment
+	if !user.IsAnonymous() && comment.UserCreated.UUID == user.ID {
+		return respForbidden(exmodels.ErrorSelfFlag)
+	}
+
+	// Prepare a new flag
+	flag := data.NewCommentFlag(&comment.ID, &user.ID, data.CommentFlagReason(params.Body.Reason), params.Body.Details).
+		WithRequest(params.HTTPRequest, !config.ServerConfig.LogFullIPs, config.SecretsConfig.IPHashKey())
+
+	// Limit the number of flags submitted by anonymous users from the same IP address
+	if user.IsAnonymous() {
+		if cnt, err := svc.TheCommentFlagService.CountCreatedSince(flag.IPHash, time.Now().UTC().Add(-time.Hour)); err != nil {
+			return respServiceError(err)
+		} else if cnt >= util.CommentFlagMaxPerIPPerHour {
+			return respTooManyRequests(exmodels.ErrorFlagRateLimitExceeded)
+		}
+	}
+
+	// Persist the flag. Repeated flagging is silently ignored
+	if added, err := svc.TheCommentFlagService.Add(flag); err != nil {
+		return respServiceError(err)
+	} else if !added {
+		return api_embed.NewEmbedCommentFlagNoContent()
+	}
+
+	// Check whether the number of active flags has reached the domain's threshold
+	threshold := svc.TheDomainConfigService.GetInt(&domain.ID, data.DomainConfigKeyFlaggingThreshold)
+	if threshold <= 0 {
+		return api_embed.NewEmbedCommentFlagNoContent()
+	}
+	cnt, err := svc.TheCommentFlagService.CountActive(&comment.ID)
+	if err != nil {
+		return respServiceError(err)
+	} else if cnt < threshold {
+		return api_embed.NewEmbedCommentFlagNoContent()
+	}
+
+	// Threshold reached: send the comment back to moderation
+	before := commentAuditValues(comment)
+	comment.WithModerated(nil, true, false, fmt.Sprintf("Flagged by readers %d times", cnt))
+	if err := svc.TheCommentService.Moderated(comment); err != nil {
+		return respServiceError(err)
+	}
+
+	// Record the action in the audit log, as performed by the system
+	svc.TheAuditService.Record(
+		auditEntry(params.HTTPRequest, nil, data.AuditActionCommentModerate).
+			WithDomain(&domain.ID).
+			WithTarget(&comment.ID).
+			WithChange(before, commentAuditValues(comment)))
+
+	// Notify websocket subscribers and webhooks
+	commentWebSocketNotify(page, comment, "update")
+	commentWebhookNotify(domain, page, comment, models.WebhookEventTypeCommentModerated)
+
+	// Succeeded
+	return api_embed.NewEmbedCommentFlagNoContent()
+}
+
 func EmbedCommentGet(params api_embed.EmbedCommentGetParams) middleware.Responder {
 	// Try to authenticate the user
 	user, _, err := svc.TheAuthService.GetUserSessionBySessionHeader(params.HTTPRequest)
@@ -204,7 +293,7 @@ func EmbedCommentList(params api_embed.EmbedCommentListParams) middleware.Respon
 
 func EmbedCommentModerate(params api_embed.EmbedCommentModerateParams, user *data.User) middleware.Responder {
 	// Update the comment
-	if r := commentModerate(params.UUID, user, false, swag.BoolValue(params.Body.Approve)); r != nil {
+	if r := commentModerate(params.HTTPRequest, params.UUID, user, false, swag.BoolValue(params.Body.Approve)); r != nil {
 		return r
 	}
 
@@ -283,43 +372,13 @@ func EmbedCommentNew(params api_embed.EmbedCommentNewParams) middleware.Responde
 		return respServiceError(err)
 	}
 	comment.AuthorIP, comment.AuthorCountry = util.UserIPCountry(params.HTTPRequest, !config.ServerConfig.LogFullIPs)
+	comment.AuthorIPHash = util.HashIP(util.UserIP(params.HTTPRequest), config.SecretsConfig.IPHashKey())
 
-	// Determine comment state
-	if b, reason, err := svc.ThePerlustrationService.NeedsModeration(params.HTTPRequest, comment, domain, page, user, domainUser, false); err != nil {
-		return respServiceError(err)
-	} else if b {
-		// Comment needs to be approved
-		comment.WithModerated(nil, true, false, reason)
-	} else {
-		// No need for moderator approval
-		comment.WithModerated(&user.ID, false, true, "")
-	}
-
-	// Persist a new comment record
-	if err := svc.TheCommentService.Create(comment); err != nil {
-		return respServiceError(err)
-	}
-
-	// Increment page/domain comment counts in the background, ignoring any error
-	go func() {
-		_ = svc.ThePageService.IncrementCounts(&page.ID, 1, 0)
-		_ = svc.TheDomainService.IncrementCounts(&domain.ID, 1, 0)
-	}()
-
-	// Send an email notification to moderators, if we notify about every comment or comments pending moderation and
-	// the comment isn't approved yet, in the background
-	if domain.ModNotifyPolicy == data.DomainModNotifyPolicyAll || comment.IsPending && domain.ModNotifyPolicy == data.DomainModNotifyPolicyPending {
-		go func() { _ = sendCommentModNotifications(domain, page, comment, user) }()
-	}
-
-	// If it's a reply and the comment is approved, send out a reply notifications, in the background
-	if !comment.IsRoot() && comment.IsApproved {
-		go func() { _ = sendCommentReplyNotifications(domain, page, comment, user) }()
+	// Check and persist the comment
+	if r := commentCreate(params.HTTPRequest, domain, page, user, domainUser, comment); r != nil {
+		return r
 	}
 
-	// Notify websocket subscribers
-	commentWebSocketNotify(page, comment, "new")
-
 	// Succeeded
 	return api_embed.NewEmbedCommentNewOK().WithPayload(&api_embed.EmbedCommentNewOKBody{
 		Comment: comment.ToDTO(domain.IsHTTPS, domain.Host, page.Path),
@@ -348,7 +407,7 @@ func EmbedCommentPreview(params api_embed.EmbedCommentPreviewParams) middleware.
 
 func EmbedCommentSticky(params api_embed.EmbedCommentStickyParams, user *data.User) middleware.Responder {
 	// Find the comment and related objects
-	comment, page, _, domainUser, r := commentGetCommentPageDomainUser(params.UUID, &user.ID)
+	comment, page, domain, domainUser, r := commentGetCommentPageDomainUser(params.UUID, &user.ID)
 	if r != nil {
 		return r
 	}
@@ -370,8 +429,10 @@ func EmbedCommentSticky(params api_embed.EmbedCommentStickyParams, user *data.Us
 			return respServiceError(err)
 		}
 
-		// Notify websocket subscribers
+		// Notify websocket subscribers and webhooks
+		comment.IsSticky = b
 		commentWebSocketNotify(page, comment, "sticky")
+		commentWebhookNotify(domain, page, comment, models.WebhookEventTypeCommentSticky)
 	}
 
 	// Succeeded or no change
@@ -390,35 +451,49 @@ func EmbedCommentUpdate(params api_embed.EmbedCommentUpdateParams, user *data.Us
 		return r
 	}
 
+	// Keep the current text as a revision
+	prev := data.NewCommentRevision(comment)
+
+	// Update the comment text/HTML
+	if err := svc.TheCommentService.SetMarkdown(comment, params.Body.Markdown, &domain.ID, &user.ID); err != nil {
+		return respServiceError(err)
+	}
+
 	// If the comment was approved, check the need for moderation again
-	unapprove := false
+	modChanged := false
 	if !comment.IsPending && comment.IsApproved {
 		// Run the approval rules
-		if b, s, err := svc.ThePerlustrationService.NeedsModeration(params.HTTPRequest, comment, domain, page, user, domainUser, true); err != nil {
+		if action, s, err := svc.ThePerlustrationService.NeedsModeration(params.HTTPRequest, comment, domain, page, user, domainUser, true); err != nil {
 			return respServiceError(err)
-		} else if b {
-			unapprove = true
-			comment.WithModerated(&user.ID, true, false, s)
+		} else if action != data.ModerationActionNone {
+			// The comment either loses its approval or gets flagged
+			modChanged = true
+			comment.WithModerationAction(&user.ID, action, s)
+
+			// Non-moderator's edit changing the text substantially sends the comment back to moderation, if configured
+		} else if pct := svc.TheDomainConfigService.GetInt(&domain.ID, data.DomainConfigKeyCommentEditingRemoderate); pct > 0 && !user.IsSuperuser && !domainUser.CanModerate() {
+			if changed := util.TextChangePercent(prev.Markdown, comment.Markdown); changed >= pct {
+				modChanged = true
+				comment.WithModerationAction(&user.ID, data.ModerationActionPending, fmt.Sprintf("Comment text changed by %d%% on edit", changed))
+			}
 		}
 	}
 
-	// Update the comment text/HTML
-	if err := svc.TheCommentService.SetMarkdown(comment, params.Body.Markdown, &domain.ID, &user.ID); err != nil {
-		return respServiceError(err)
-	}
-	if err := svc.TheCommentService.Edited(comment); err != nil {
+	// Persist the text changes
+	if err := svc.TheCommentService.Edited(comment, prev); err != nil {
 		return respServiceError(err)
 	}
 
-	// If the comment approval was revoked
-	if unapprove {
+	// If the comment approval was revoked or the comment was flagged
+	if modChanged {
 		if err := svc.TheCommentService.Moderated(comment); err != nil {
 			return respServiceError(err)
 		}
 	}
 
-	// Notify websocket subscribers
+	// Notify websocket subscribers and webhooks
 	commentWebSocketNotify(page, comment, "update")
+	commentWebhookNotify(domain, page, comment, models.WebhookEventTypeCommentEdited)
 
 	// Succeeded
 	return api_embed.NewEmbedCommentUpdateOK().
@@ -451,8 +526,10 @@ func EmbedCommentVote(params api_embed.EmbedCommentVoteParams, user *data.User)
 
 	}
 
-	// Notify websocket subscribers
+	// Notify websocket subscribers and webhooks
+	comment.Score = score
 	commentWebSocketNotify(page, comment, "vote")
+	commentWebhookNotify(domain, page, comment, models.WebhookEventTypeCommentVoted)
 
 	// Succeeded
 	return api_embed.NewEmbedCommentVoteOK().WithPayload(&api_embed.EmbedCommentVoteOKBody{Score: int64(score)})
@@ -2,12 +2,89 @@ package handlers
 
 import (
 	"github.com/go-openapi/runtime/middleware"
+	"github.com/go-openapi/strfmt"
+	"github.com/go-openapi/strfmt/conv"
 	"github.com/go-openapi/swag"
+	"github.com/google/uuid"
+	"gitlab.com/comentario/comentario/internal/api/exmodels"
+	"gitlab.com/comentario/comentario/internal/api/models"
 	"gitlab.com/comentario/comentario/internal/api/restapi/operations/api_embed"
 	"gitlab.com/comentario/comentario/internal/data"
 	"gitlab.com/comentario/comentario/internal/svc"
 )
 
+func EmbedPageSubscribe(params api_embed.EmbedPageSubscribeParams, user *data.User) middleware.Responder {
+	// Fetch the page and the thread, if any
+	page, thread, r := embedPageGetThread(params.UUID, params.Body.ThreadID)
+	if r != nil {
+		return r
+	}
+
+	// Only allow subscribing to threads starting at a visible comment
+	var threadID *uuid.UUID
+	if thread != nil {
+		if thread.IsDeleted || !thread.IsApproved {
+			return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("threadId"))
+		}
+		threadID = &thread.ID
+	}
+
+	// Make sure the domain user exists, creating one if necessary
+	if _, _, err := svc.TheDomainService.FindDomainUserByID(&page.DomainID, &user.ID, true); err != nil {
+		return respServiceError(err)
+	}
+
+	// Subscribe the user
+	sub, err := svc.TheSubscriptionService.Create(data.NewPageSubscription(&page.DomainID, &page.ID, &user.ID, threadID))
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_embed.NewEmbedPageSubscribeOK().
+		WithPayload(&api_embed.EmbedPageSubscribeOKBody{Subscription: sub.ToDTO()})
+}
+
+func EmbedPageSubscriptionList(params api_embed.EmbedPageSubscriptionListParams, user *data.User) middleware.Responder {
+	// Fetch the page
+	page, _, r := embedPageGetThread(params.UUID, "")
+	if r != nil {
+		return r
+	}
+
+	// Fetch the user's subscriptions
+	subs, err := svc.TheSubscriptionService.ListByPageUser(&page.ID, &user.ID)
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_embed.NewEmbedPageSubscriptionListOK().
+		WithPayload(&api_embed.EmbedPageSubscriptionListOKBody{
+			Subscriptions: data.SliceToDTOs[*data.PageSubscription, *models.PageSubscription](subs),
+		})
+}
+
+func EmbedPageUnsubscribe(params api_embed.EmbedPageUnsubscribeParams, user *data.User) middleware.Responder {
+	// Fetch the page and the thread, if any
+	page, thread, r := embedPageGetThread(params.UUID, conv.UUIDValue(params.Thread))
+	if r != nil {
+		return r
+	}
+
+	// Unsubscribe the user
+	var threadID *uuid.UUID
+	if thread != nil {
+		threadID = &thread.ID
+	}
+	if err := svc.TheSubscriptionService.Delete(&user.ID, &page.ID, threadID); err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_embed.NewEmbedPageUnsubscribeNoContent()
+}
+
 func EmbedPageUpdate(params api_embed.EmbedPageUpdateParams, user *data.User) middleware.Responder {
 	// Fetch the page and the domain user
 	page, _, domainUser, r := domainPageGetDomainUser(params.UUID, user)
@@ -31,3 +108,40 @@ func EmbedPageUpdate(params api_embed.EmbedPageUpdateParams, user *data.User) mi
 	// Succeeded
 	return api_embed.NewEmbedPageUpdateNoContent()
 }
+
+// embedPageGetThread finds and returns a page by its ID and, if threadID isn't empty, the comment the thread starts at,
+// verifying it belongs to the page
+func embedPageGetThread(pageID, threadID strfmt.UUID) (*data.DomainPage, *data.Comment, middleware.Responder) {
+	// Find the page
+	pID, r := parseUUID(pageID)
+	if r != nil {
+		return nil, nil, r
+	}
+	page, err := svc.ThePageService.FindByID(pID)
+	if err != nil {
+		return nil, nil, respServiceError(err)
+	}
+
+	// If there's no thread ID, we're done
+	if threadID == "" {
+		return page, nil, nil
+	}
+
+	// Find the thread's comment
+	tID, r := parseUUID(threadID)
+	if r != nil {
+		return nil, nil, r
+	}
+	comment, err := svc.TheCommentService.FindByID(tID)
+	if err != nil {
+		return nil, nil, respServiceError(err)
+	}
+
+	// Make sure the comment belongs to the page
+	if comment.PageID != page.ID {
+		return nil, nil, respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("threadId"))
+	}
+
+	// Succeeded
+	return page, comment, nil
+}
@@ -1,14 +1,93 @@
 package handlers
 
 import (
+	"crypto/subtle"
+	"errors"
 	"github.com/go-openapi/runtime/middleware"
+	"github.com/go-openapi/strfmt"
+	"github.com/google/uuid"
 	"gitlab.com/comentario/comentario/internal/api/exmodels"
+	"gitlab.com/comentario/comentario/internal/api/models"
 	"gitlab.com/comentario/comentario/internal/api/restapi/operations/api_general"
+	"gitlab.com/comentario/comentario/internal/config"
 	"gitlab.com/comentario/comentario/internal/data"
 	"gitlab.com/comentario/comentario/internal/svc"
 	"gitlab.com/comentario/comentario/internal/util"
+	"time"
 )
 
+func MailInbound(params api_general.MailInboundParams) middleware.Responder {
+	defer util.LogError(params.Message.Close, "MailInbound, defer Message.Close()")
+
+	// Make sure reply-by-email is configured
+	cfg := &config.SecretsConfig.InboundMail
+	if !cfg.Enabled() {
+		return respForbidden(exmodels.ErrorFeatureDisabled.WithDetails("reply by email"))
+	}
+
+	// Verify the inbound secret
+	if subtle.ConstantTimeCompare([]byte(params.XInboundSecret), []byte(cfg.Secret)) != 1 {
+		return respUnauthorized(exmodels.ErrorBadToken)
+	}
+
+	// Parse the message, identifying the sender and the comment being replied to
+	user, parentID, text, err := svc.TheMailService.ParseReply(params.Message)
+	switch {
+	case errors.Is(err, svc.ErrBadToken):
+		return respUnauthorized(exmodels.ErrorBadToken)
+	case errors.Is(err, svc.ErrDB):
+		return respServiceError(err)
+	case err != nil:
+		return respBadRequest(exmodels.ErrorInvalidInputData.WithDetails(err.Error()))
+	case text == "":
+		return respBadRequest(exmodels.ErrorInvalidInputData.WithDetails("reply text is empty"))
+	}
+
+	// Verify the user is allowed to comment
+	if user.Banned {
+		return respForbidden(exmodels.ErrorUserBanned)
+	} else if user.IsLocked {
+		return respForbidden(exmodels.ErrorUserLocked)
+	}
+
+	// Find the parent comment and related objects
+	parent, page, domain, domainUser, r := commentGetCommentPageDomainUser(strfmt.UUID(parentID.String()), &user.ID)
+	if r != nil {
+		return r
+	}
+
+	// Verify the parent comment can be replied to, and the domain, the page, and the user aren't readonly
+	if parent.IsDeleted || !parent.IsApproved {
+		return respForbidden(exmodels.ErrorNotAllowed)
+	} else if domain.IsReadonly {
+		return respForbidden(exmodels.ErrorDomainReadonly)
+	} else if page.IsReadonly {
+		return respForbidden(exmodels.ErrorPageReadonly)
+	} else if domainUser.IsReadonly() {
+		return respForbidden(exmodels.ErrorUserReadonly)
+	}
+
+	// Prepare a reply comment
+	comment := &data.Comment{
+		ID:          uuid.New(),
+		ParentID:    uuid.NullUUID{UUID: parent.ID, Valid: true},
+		PageID:      page.ID,
+		CreatedTime: time.Now().UTC(),
+		UserCreated: uuid.NullUUID{UUID: user.ID, Valid: true},
+	}
+	if err := svc.TheCommentService.SetMarkdown(comment, text, &domain.ID, nil); err != nil {
+		return respServiceError(err)
+	}
+
+	// Check and persist the comment
+	if r := commentCreate(params.HTTPRequest, domain, page, user, domainUser, comment); r != nil {
+		return r
+	}
+
+	// Succeeded
+	return api_general.NewMailInboundNoContent()
+}
+
 func MailUnsubscribe(params api_general.MailUnsubscribeParams) middleware.Responder {
 	// Parse user ID
 	uID, r := parseUUID(params.User)
@@ -39,12 +118,18 @@ func MailUnsubscribe(params api_general.MailUnsubscribeParams) middleware.Respon
 
 		// Make sure the secret checks out
 	} else if *secret != user.SecretToken {
-		respUnauthorized(exmodels.ErrorBadToken)
+		return respUnauthorized(exmodels.ErrorBadToken)
 	}
 
 	// Update the domain user properties
 	var changed bool
 	switch svc.MailNotificationKind(params.Kind) {
+	// Page and thread subscriptions: remove them all
+	case svc.MailNotificationKindSubscription:
+		if err := svc.TheSubscriptionService.DeleteByDomainUser(dID, uID); err != nil {
+			return respServiceError(err)
+		}
+
 	// Moderator notifications
 	case svc.MailNotificationKindModerator:
 		changed = domainUser.NotifyModerator
@@ -76,16 +161,16 @@ func MailUnsubscribe(params api_general.MailUnsubscribeParams) middleware.Respon
 // sendCommentModNotifications sends a comment notification to all domain moderators
 func sendCommentModNotifications(domain *data.Domain, page *data.DomainPage, comment *data.Comment, commenter *data.User) error {
 	// Fetch domain moderators to be notified
-	mods, err := svc.TheUserService.ListDomainModerators(&domain.ID, true)
+	mods, modDUs, err := svc.TheUserService.ListDomainModerators(&domain.ID, true)
 	if err != nil {
 		return err
 	}
 
 	// Iterate the moderator users
-	for _, mod := range mods {
+	for _, du := range modDUs {
 		// Do not email the commenting moderator their own comment
-		if mod.ID != commenter.ID {
-			_ = svc.TheMailService.SendCommentNotification(svc.MailNotificationKindModerator, mod, true, domain, page, comment, commenter.Name)
+		if mod := mods[du.UserID]; mod != nil && mod.ID != commenter.ID {
+			_ = sendCommentNotification(svc.MailNotificationKindModerator, mod, du, true, domain, page, comment, commenter.Name)
 		}
 	}
 
@@ -93,6 +178,15 @@ func sendCommentModNotifications(domain *data.Domain, page *data.DomainPage, com
 	return nil
 }
 
+// sendCommentNotification sends a comment notification of the given kind to the recipient right away, or postpones it
+// until the next digest if the recipient has opted for digests on the domain. recipientDU can be nil
+func sendCommentNotification(kind svc.MailNotificationKind, recipient *data.User, recipientDU *data.DomainUser, canModerate bool, domain *data.Domain, page *data.DomainPage, comment *data.Comment, commenterName string) error {
+	if recipientDU != nil && recipientDU.DigestMode != models.DomainUserDigestModeImmediate {
+		return svc.TheDigestService.Enqueue(kind, &recipient.ID, &domain.ID, &comment.ID)
+	}
+	return svc.TheMailService.SendCommentNotification(kind, recipient, canModerate, domain, page, comment, commenterName)
+}
+
 // sendCommentReplyNotifications sends a comment reply notification
 func sendCommentReplyNotifications(domain *data.Domain, page *data.DomainPage, comment *data.Comment, commenter *data.User) error {
 	// Fetch the parent comment
@@ -113,9 +207,10 @@ func sendCommentReplyNotifications(domain *data.Domain, page *data.DomainPage, c
 
 		// Send a reply notification
 	} else {
-		return svc.TheMailService.SendCommentNotification(
+		return sendCommentNotification(
 			svc.MailNotificationKindReply,
 			parentUser,
+			parentDomainUser,
 			parentUser.IsSuperuser || parentDomainUser.CanModerate(),
 			domain,
 			page,
@@ -124,6 +219,58 @@ func sendCommentReplyNotifications(domain *data.Domain, page *data.DomainPage, c
 	}
 }
 
+// sendCommentSubscriptionNotifications sends a notification about a new approved comment to every user subscribed to
+// the comment's page or thread, except the commenter and the parent comment's author, who gets a reply notification
+// instead
+func sendCommentSubscriptionNotifications(domain *data.Domain, page *data.DomainPage, comment *data.Comment, commenter *data.User) error {
+	// Fetch the subscriptions matching the comment
+	subs, err := svc.TheSubscriptionService.ListForComment(comment)
+	if err != nil {
+		return err
+	}
+
+	// Find the parent comment's author, if any
+	var parentAuthorID uuid.UUID
+	if !comment.IsRoot() {
+		parent, err := svc.TheCommentService.FindByID(&comment.ParentID.UUID)
+		if err != nil {
+			return err
+		}
+		parentAuthorID = parent.UserCreated.UUID
+	}
+
+	// Iterate the subscriptions
+	for _, sub := range subs {
+		if sub.UserID == commenter.ID || sub.UserID == parentAuthorID {
+			continue
+		}
+
+		// Find the subscriber and the corresponding domain user
+		subscriber, subscriberDU, err := svc.TheUserService.FindDomainUserByID(&sub.UserID, &domain.ID)
+		if err != nil {
+			return err
+		}
+
+		// Skip users who can't receive notifications
+		if subscriber.Banned || subscriber.IsLocked {
+			continue
+		}
+
+		_ = sendCommentNotification(
+			svc.MailNotificationKindSubscription,
+			subscriber,
+			subscriberDU,
+			subscriber.IsSuperuser || subscriberDU.CanModerate(),
+			domain,
+			page,
+			comment,
+			commenter.Name)
+	}
+
+	// Succeeded
+	return nil
+}
+
 // sendCommentStatusNotifications sends a notification about comment status change
 func sendCommentStatusNotifications(domain *data.Domain, page *data.DomainPage, comment *data.Comment) error {
 	// No notifications for anonymous comments
@@ -140,9 +287,10 @@ func sendCommentStatusNotifications(domain *data.Domain, page *data.DomainPage,
 
 		// Send a comment status notification
 	} else {
-		return svc.TheMailService.SendCommentNotification(
+		return sendCommentNotification(
 			svc.MailNotificationKindCommentStatus,
 			commenter,
+			domainUser,
 			false,
 			domain,
 			page,
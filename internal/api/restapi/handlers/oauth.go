@@ -23,21 +23,34 @@ import (
 )
 
 type ssoPayload struct {
-	Token string `json:"token"`
-	Email string `json:"email"`
-	Name  string `json:"name"`
-	Photo string `json:"photo"`
-	Link  string `json:"link"`
-	Role  string `json:"role"`
+	Token  string         `json:"token"`
+	Email  string         `json:"email"`
+	Name   string         `json:"name"`
+	Photo  string         `json:"photo"`
+	Link   string         `json:"link"`
+	Role   string         `json:"role"`
+	Claims map[string]any `json:"-"` // All properties of the payload, for evaluating role rules
 }
 
 func AuthOauthCallback(params api_general.AuthOauthCallbackParams) middleware.Responder {
+	return oauthCallback(params.Provider, params.HTTPRequest, params.HTTPRequest.URL.Query())
+}
+
+// AuthOauthCallbackPost handles a federated authentication callback made using the HTTP POST binding, which is what SAML
+// identity providers do
+func AuthOauthCallbackPost(params api_general.AuthOauthCallbackPostParams) middleware.Responder {
+	return oauthCallback(params.Provider, params.HTTPRequest, params.HTTPRequest.PostForm)
+}
+
+// oauthCallback handles a federated authentication callback for the identity provider with the given ID, reqParams
+// being the parameters passed by the provider
+func oauthCallback(providerID string, req *http.Request, reqParams url.Values) middleware.Responder {
 	// SSO authentication is a special case
 	var provider goth.Provider
 	var r middleware.Responder
 	var idpID string
-	if params.Provider != "sso" {
-		idpID = params.Provider
+	if providerID != "sso" {
+		idpID = providerID
 
 		// It's a goth provider: find it
 		if provider, r = Verifier.FederatedIdProvider(models.FederatedIdpID(idpID)); r != nil {
@@ -47,7 +60,7 @@ func AuthOauthCallback(params api_general.AuthOauthCallbackParams) middleware.Re
 
 	// Obtain the auth session ID from the cookie
 	var authSession *data.AuthSession
-	if cookie, err := params.HTTPRequest.Cookie(util.CookieNameAuthSession); err != nil {
+	if cookie, err := req.Cookie(util.CookieNameAuthSession); err != nil {
 		logger.Debugf("Auth session cookie error: %v", err)
 		return oauthFailure(false, "auth session cookie missing", err)
 
@@ -87,7 +100,6 @@ func AuthOauthCallback(params api_general.AuthOauthCallbackParams) middleware.Re
 		return oauthFailure(false, "host is missing in request", nil)
 	}
 
-	reqParams := params.HTTPRequest.URL.Query()
 	var fedUser goth.User
 	var userWebsiteURL string
 	var userRole models.DomainUserRole
@@ -103,36 +115,24 @@ func AuthOauthCallback(params api_general.AuthOauthCallbackParams) middleware.Re
 		nonIntSSO = domain.SSONonInteractive
 
 		// Verify the payload
-		payload := ssoPayload{}
-		var payloadBytes []byte
-		if s := reqParams.Get("payload"); s == "" {
-			return oauthFailure(nonIntSSO, "payload is missing", nil)
-		} else if payloadBytes, err = hex.DecodeString(s); err != nil {
-			return oauthFailure(nonIntSSO, "payload: invalid hex encoding", err)
-		} else if err = json.Unmarshal(payloadBytes, &payload); err != nil {
-			return oauthFailureInternal(nonIntSSO, fmt.Errorf("payload: failed to unmarshal: %w", err))
+		var payload *ssoPayload
+		if domain.SSOType == data.DomainSSOTypeJWT {
+			payload, r = ssoPayloadFromJWT(domain, reqParams, nonIntSSO)
+		} else {
+			payload, r = ssoPayloadFromHMAC(domain, reqParams, nonIntSSO)
+		}
+		if r != nil {
+			return r
 		} else if payload.Token != token.Value {
 			return oauthFailure(nonIntSSO, "payload: invalid token", nil)
 		}
 
-		// Verify the HMAC signature
-		if s := reqParams.Get("hmac"); s == "" {
-			return oauthFailure(nonIntSSO, "hmac is missing", nil)
-		} else if signature, err := hex.DecodeString(s); err != nil {
-			return oauthFailure(nonIntSSO, "hmac: invalid hex encoding", err)
-		} else if secBytes, err := domain.SSOSecretBytes(); err != nil {
-			return oauthFailure(nonIntSSO, "domain SSO secret: invalid hex encoding", err)
-		} else if secBytes == nil {
-			return oauthFailure(nonIntSSO, "domain SSO secret not set", nil)
-		} else if !hmac.Equal(signature, util.HMACSign(payloadBytes, secBytes)) {
-			return oauthFailure(nonIntSSO, "hmac: signature verification failed", nil)
-		}
-
 		// Prepare a federated user, using email as the ID (until #100 is implemented)
 		fedUser = goth.User{
-			Email:  payload.Email,
-			Name:   payload.Name,
-			UserID: payload.Email,
+			Email:   payload.Email,
+			Name:    payload.Name,
+			UserID:  payload.Email,
+			RawData: payload.Claims,
 		}
 
 		// If a valid avatar link is provided, store it as the user's avatar URL
@@ -157,7 +157,7 @@ func AuthOauthCallback(params api_general.AuthOauthCallbackParams) middleware.Re
 		}
 
 		// Validate the session state
-		if msg, err := validateAuthSessionState(sess, params.HTTPRequest); err != nil {
+		if msg, err := validateAuthSessionState(sess, req); err != nil {
 			return oauthFailure(false, msg, err)
 		}
 
@@ -243,8 +243,8 @@ func AuthOauthCallback(params api_general.AuthOauthCallbackParams) middleware.Re
 		// Insert a new user
 		user = data.NewUser(fedUser.Email, fedUserName).
 			WithConfirmed(true). // Confirm the user right away as we trust the IdP
-			WithLangFromReq(params.HTTPRequest).
-			WithSignup(params.HTTPRequest, authSession.Host, !config.ServerConfig.LogFullIPs).
+			WithLangFromReq(req).
+			WithSignup(req, authSession.Host, !config.ServerConfig.LogFullIPs).
 			WithFederated(fedUser.UserID, idpID).
 			WithWebsiteURL(userWebsiteURL)
 		if err := svc.TheUserService.Create(user); err != nil {
@@ -317,11 +317,29 @@ func AuthOauthCallback(params api_general.AuthOauthCallbackParams) middleware.Re
 			return oauthFailureInternal(nonIntSSO, err)
 		}
 
-		// If a role was returned by the (SSO) provider and it's changing, update the domain user
-		if userRole != "" && userRole != du.Role() {
+		// Apply the domain's role mapping rules, which take precedence over the role returned by the (SSO) provider
+		var ruleID string
+		if rules, err := svc.TheDomainService.ListRoleRules(&domain.ID); err != nil {
+			return oauthFailureInternal(nonIntSSO, err)
+		} else if rule := data.MatchDomainRoleRules(rules, util.If(idpID == "", data.DomainRoleRuleIdPSSO, idpID), fedUser.RawData); rule != nil {
+			ruleID = rule.ID.String()
+			userRole = rule.Role
+		}
+
+		// If a role was determined and it's changing, update the domain user
+		if oldRole := du.Role(); userRole != "" && userRole != oldRole {
 			if err := svc.TheDomainService.UserModify(du.WithRole(userRole)); err != nil {
 				return oauthFailureInternal(nonIntSSO, err)
 			}
+
+			// Record the change in the audit log: it's made by the system, on behalf of the identity provider
+			svc.TheAuditService.Record(
+				auditEntry(req, nil, data.AuditActionDomainUserUpdate).
+					WithDomain(&domain.ID).
+					WithTarget(&user.ID).
+					WithChange(
+						map[string]any{"role": oldRole},
+						map[string]any{"role": userRole, "idpId": idpID, "roleRuleId": ruleID}))
 		}
 	}
 
@@ -392,17 +410,18 @@ func AuthOauthInit(params api_general.AuthOauthInitParams) middleware.Responder
 			return oauthFailure(nonIntSSO, "failed to parse SSO URL", err)
 		}
 
-		// Add the token and its HMAC signature to the SSO URL
+		// Add the token and its HMAC signature to the SSO URL. The signature is optional for JWT SSO, which may rely on
+		// the domain's JWKS alone
 		q := ssoURL.Query()
 		q.Set("token", token.Value)
 		if tokenBytes, err := token.ValueBytes(); err != nil {
 			return oauthFailure(false, "failed to parse token value", err)
 		} else if secBytes, err := domain.SSOSecretBytes(); err != nil {
 			return oauthFailure(false, "failed to parse domain SSO secret", err)
-		} else if secBytes == nil {
-			return oauthFailure(false, "domain SSO secret not set", nil)
-		} else {
+		} else if secBytes != nil {
 			q.Set("hmac", hex.EncodeToString(util.HMACSign(tokenBytes, secBytes)))
+		} else if domain.SSOType != data.DomainSSOTypeJWT {
+			return oauthFailure(false, "domain SSO secret not set", nil)
 		}
 		ssoURL.RawQuery = q.Encode()
 		authURL = ssoURL.String()
@@ -451,6 +470,84 @@ func AuthOauthInit(params api_general.AuthOauthInitParams) middleware.Responder
 			util.If(config.ServerConfig.UseHTTPS(), http.SameSiteNoneMode, http.SameSiteLaxMode))
 }
 
+// AuthOauthMetadata returns the service provider metadata for the given (SAML) identity provider
+func AuthOauthMetadata(params api_general.AuthOauthMetadataParams) middleware.Responder {
+	// Find the provider
+	provider, r := Verifier.FederatedIdProvider(models.FederatedIdpID(params.Provider))
+	if r != nil {
+		return r
+	}
+
+	// Only SAML providers have metadata
+	sp, ok := provider.(*config.SAMLIdProvider)
+	if !ok {
+		return respNotFound(exmodels.ErrorIdPUnknown.WithDetails(params.Provider))
+	}
+
+	// Succeeded
+	return api_general.NewAuthOauthMetadataOK().WithPayload(sp.Metadata())
+}
+
+// ssoPayloadFromHMAC extracts an SSO payload from the given request parameters, which must contain a hex-encoded JSON
+// payload and its HMAC signature made with the domain's SSO secret
+func ssoPayloadFromHMAC(domain *data.Domain, reqParams url.Values, nonIntSSO bool) (*ssoPayload, middleware.Responder) {
+	// Decode the payload
+	payload := &ssoPayload{}
+	var payloadBytes []byte
+	var err error
+	if s := reqParams.Get("payload"); s == "" {
+		return nil, oauthFailure(nonIntSSO, "payload is missing", nil)
+	} else if payloadBytes, err = hex.DecodeString(s); err != nil {
+		return nil, oauthFailure(nonIntSSO, "payload: invalid hex encoding", err)
+	} else if err = json.Unmarshal(payloadBytes, payload); err != nil {
+		return nil, oauthFailureInternal(nonIntSSO, fmt.Errorf("payload: failed to unmarshal: %w", err))
+	} else if err = json.Unmarshal(payloadBytes, &payload.Claims); err != nil {
+		return nil, oauthFailureInternal(nonIntSSO, fmt.Errorf("payload: failed to unmarshal claims: %w", err))
+	}
+
+	// Verify the HMAC signature
+	if s := reqParams.Get("hmac"); s == "" {
+		return nil, oauthFailure(nonIntSSO, "hmac is missing", nil)
+	} else if signature, err := hex.DecodeString(s); err != nil {
+		return nil, oauthFailure(nonIntSSO, "hmac: invalid hex encoding", err)
+	} else if secBytes, err := domain.SSOSecretBytes(); err != nil {
+		return nil, oauthFailure(nonIntSSO, "domain SSO secret: invalid hex encoding", err)
+	} else if secBytes == nil {
+		return nil, oauthFailure(nonIntSSO, "domain SSO secret not set", nil)
+	} else if !hmac.Equal(signature, util.HMACSign(payloadBytes, secBytes)) {
+		return nil, oauthFailure(nonIntSSO, "hmac: signature verification failed", nil)
+	}
+
+	// Succeeded
+	return payload, nil
+}
+
+// ssoPayloadFromJWT extracts an SSO payload from the given request parameters, which must contain a JWT signed with the
+// domain's SSO secret or a key from the domain's JWKS
+func ssoPayloadFromJWT(domain *data.Domain, reqParams url.Values, nonIntSSO bool) (*ssoPayload, middleware.Responder) {
+	s := reqParams.Get("jwt")
+	if s == "" {
+		return nil, oauthFailure(nonIntSSO, "jwt is missing", nil)
+	}
+
+	// Verify the token and its claims
+	claims, err := svc.TheSSOService.ParseJWT(domain, s)
+	if err != nil {
+		return nil, oauthFailure(nonIntSSO, "jwt: verification failed", err)
+	}
+
+	// Succeeded: map the claims onto a payload
+	return &ssoPayload{
+		Token:  claims.Token,
+		Email:  claims.Email,
+		Name:   claims.Name,
+		Photo:  claims.AvatarURL(),
+		Link:   claims.Website,
+		Role:   claims.Role,
+		Claims: claims.Raw,
+	}, nil
+}
+
 // oauthFailure returns either a generic "Unauthorized" responder (in case of interactive authentication), with the
 // given message in the details, or a postMessage responder (for non-interactive auth), and logs the passed error.
 // The reason it's handled this way is that logging may expose actual (confidential) error details, whereas the response
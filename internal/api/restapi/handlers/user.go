@@ -57,7 +57,8 @@ func UserBan(params api_general.UserBanParams, user *data.User) middleware.Respo
 
 	// Update the user if necessary
 	ban := swag.BoolValue(params.Body.Ban)
-	if u.Banned != ban {
+	wasBanned := u.Banned
+	if wasBanned != ban {
 		if err := svc.TheUserService.UpdateBanned(&user.ID, u, ban); err != nil {
 			return respServiceError(err)
 		}
@@ -76,6 +77,14 @@ func UserBan(params api_general.UserBanParams, user *data.User) middleware.Respo
 		}
 	}
 
+	// Record the action in the audit log
+	svc.TheAuditService.Record(
+		auditEntry(params.HTTPRequest, user, data.AuditActionUserBan).
+			WithTarget(&u.ID).
+			WithChange(
+				map[string]any{"banned": wasBanned},
+				map[string]any{"banned": ban, "countDeletedComments": cntDel}))
+
 	// Succeeded
 	return api_general.NewUserBanOK().WithPayload(&api_general.UserBanOKBody{CountDeletedComments: cntDel})
 }
@@ -103,12 +112,19 @@ func UserDelete(params api_general.UserDeleteParams, user *data.User) middleware
 	}
 
 	// Delete the user, optionally deleting their comments
-	if cntDel, err := svc.TheUserService.DeleteUserByID(u, params.Body.DeleteComments, params.Body.PurgeComments); err != nil {
+	cntDel, err := svc.TheUserService.DeleteUserByID(u, params.Body.DeleteComments, params.Body.PurgeComments)
+	if err != nil {
 		return respServiceError(err)
-	} else {
-		// Succeeded
-		return api_general.NewUserDeleteOK().WithPayload(&api_general.UserDeleteOKBody{CountDeletedComments: cntDel})
 	}
+
+	// Record the action in the audit log
+	svc.TheAuditService.Record(
+		auditEntry(params.HTTPRequest, user, data.AuditActionUserDelete).
+			WithTarget(&u.ID).
+			WithChange(userAuditValues(u), map[string]any{"countDeletedComments": cntDel}))
+
+	// Succeeded
+	return api_general.NewUserDeleteOK().WithPayload(&api_general.UserDeleteOKBody{CountDeletedComments: cntDel})
 }
 
 func UserGet(params api_general.UserGetParams, user *data.User) middleware.Responder {
@@ -210,6 +226,37 @@ func UserSessionsExpire(params api_general.UserSessionsExpireParams, user *data.
 	return api_general.NewUserSessionsExpireNoContent()
 }
 
+func UserTotpReset(params api_general.UserTotpResetParams, user *data.User) middleware.Responder {
+	// Verify the user is a superuser
+	if r := Verifier.UserIsSuperuser(user); r != nil {
+		return r
+	}
+
+	// Fetch the user
+	u, r := userGet(params.UUID)
+	if r != nil {
+		return r
+	}
+
+	// Don't bother if the user has no second factor, not even a pending one
+	if u.TOTPEnabled || u.TOTPSecret != "" {
+		// Update the user
+		enabled := u.TOTPEnabled
+		if err := svc.TheUserService.UpdateTOTP(u.WithTOTPEnabled(false)); err != nil {
+			return respServiceError(err)
+		}
+
+		// Record the action in the audit log
+		svc.TheAuditService.Record(
+			auditEntry(params.HTTPRequest, user, data.AuditActionUserTOTPReset).
+				WithTarget(&u.ID).
+				WithChange(map[string]any{"totpEnabled": enabled}, map[string]any{"totpEnabled": false}))
+	}
+
+	// Succeeded
+	return api_general.NewUserTotpResetNoContent()
+}
+
 func UserUnlock(params api_general.UserUnlockParams, user *data.User) middleware.Responder {
 	// Verify the user is a superuser
 	if r := Verifier.UserIsSuperuser(user); r != nil {
@@ -228,6 +275,12 @@ func UserUnlock(params api_general.UserUnlockParams, user *data.User) middleware
 		if err := svc.TheUserService.UpdateLoginLocked(u.WithLocked(false)); err != nil {
 			return respServiceError(err)
 		}
+
+		// Record the action in the audit log
+		svc.TheAuditService.Record(
+			auditEntry(params.HTTPRequest, user, data.AuditActionUserUnlock).
+				WithTarget(&u.ID).
+				WithChange(map[string]any{"locked": true}, map[string]any{"locked": false}))
 	}
 
 	// Succeeded
@@ -251,6 +304,9 @@ func UserUpdate(params api_general.UserUpdateParams, user *data.User) middleware
 		return r
 	}
 
+	// Remember the current values for the audit log
+	before := userAuditValues(u)
+
 	// Email, name, password, website can only be updated for a local user (email and name are mandatory)
 	dto := params.Body.User
 	email := data.EmailToString(dto.Email)
@@ -308,10 +364,28 @@ func UserUpdate(params api_general.UserUpdateParams, user *data.User) middleware
 		return respServiceError(err)
 	}
 
+	// Record the action in the audit log. The password itself is never logged
+	after := userAuditValues(u)
+	after["passwordChanged"] = password != ""
+	svc.TheAuditService.Record(auditEntry(params.HTTPRequest, user, data.AuditActionUserUpdate).WithTarget(&u.ID).WithChange(before, after))
+
 	// Succeeded
 	return api_general.NewUserUpdateOK().WithPayload(&api_general.UserUpdateOKBody{User: u.ToDTO()})
 }
 
+// userAuditValues returns the user's properties relevant to the audit log
+func userAuditValues(u *data.User) map[string]any {
+	return map[string]any{
+		"email":       u.Email,
+		"name":        u.Name,
+		"websiteUrl":  u.WebsiteURL,
+		"confirmed":   u.Confirmed,
+		"isSuperuser": u.IsSuperuser,
+		"remarks":     u.Remarks,
+		"langId":      u.LangID,
+	}
+}
+
 // userGet parses a string UUID and fetches the corresponding user
 func userGet(id strfmt.UUID) (*data.User, middleware.Responder) {
 	// Extract user ID
@@ -187,6 +187,11 @@ func respServiceError(err error) middleware.Responder {
 	return respInternalError(nil)
 }
 
+// respTooManyRequests returns a responder that responds with HTTP Too Many Requests error
+func respTooManyRequests(err *exmodels.Error) middleware.Responder {
+	return api_general.NewGenericTooManyRequests().WithPayload(err)
+}
+
 // respUnauthorized returns a responder that responds with HTTP Unauthorized error
 func respUnauthorized(err *exmodels.Error) middleware.Responder {
 	return api_general.NewGenericUnauthorized().WithPayload(err)
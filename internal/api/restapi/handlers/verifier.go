@@ -38,6 +38,10 @@ type VerifierService interface {
 	// LocalSignupEnabled checks if users are allowed to sign up locally. If domainID == nil, it's a frontend (Admin UI)
 	// sign-up
 	LocalSignupEnabled(domainID *uuid.UUID) middleware.Responder
+	// PasskeysEnabled checks if signing in with and registering passkeys is enabled
+	PasskeysEnabled() middleware.Responder
+	// TOTPEnabled checks if enabling two-factor authentication is allowed
+	TOTPEnabled() middleware.Responder
 	// UserCanAddDomain checks if the provided user is allowed to register a new domain (and become its owner)
 	UserCanAddDomain(user *data.User) middleware.Responder
 	// UserCanChangeEmailTo verifies the user can change their email to the new given value
@@ -67,6 +71,9 @@ type VerifierService interface {
 	UserIsNotSystem(user *data.User) middleware.Responder
 	// UserIsSuperuser verifies the given user is a superuser
 	UserIsSuperuser(user *data.User) middleware.Responder
+	// UserSecondFactor verifies the provided code is a valid TOTP or recovery code for the user. It also has a built-in
+	// sleep on a wrong code to discourage brute-force attacks
+	UserSecondFactor(user *data.User, code string) middleware.Responder
 }
 
 // ----------------------------------------------------------------------------------------------------------------------
@@ -126,25 +133,38 @@ func (v *verifier) DomainHostCanBeAdded(host string) middleware.Responder {
 }
 
 func (v *verifier) DomainSSOConfig(domain *data.Domain) middleware.Responder {
+	isJWT := domain.SSOType == data.DomainSSOTypeJWT
+
 	// Verify SSO is at all enabled
 	if !domain.AuthSSO {
-		respBadRequest(exmodels.ErrorSSOMisconfigured.WithDetails("SSO isn't enabled"))
+		return respBadRequest(exmodels.ErrorSSOMisconfigured.WithDetails("SSO isn't enabled"))
 
 		// Verify SSO URL is set
 	} else if domain.SSOURL == "" {
-		respBadRequest(exmodels.ErrorSSOMisconfigured.WithDetails("SSO URL is missing"))
+		return respBadRequest(exmodels.ErrorSSOMisconfigured.WithDetails("SSO URL is missing"))
 
 		// Verify SSO URL is valid and secure (allow insecure in e2e-testing mode)
 	} else if _, err := util.ParseAbsoluteURL(domain.SSOURL, config.ServerConfig.E2e, false); err != nil {
-		respBadRequest(exmodels.ErrorSSOMisconfigured.WithDetails(err.Error()))
+		return respBadRequest(exmodels.ErrorSSOMisconfigured.WithDetails(err.Error()))
 
 		// Verify SSO secret is encoded properly
 	} else if sec, err := domain.SSOSecretBytes(); err != nil {
-		respBadRequest(exmodels.ErrorSSOMisconfigured.WithDetails("SSO secret is invalid"))
-
-		// Verify SSO secret is set
-	} else if sec == nil {
-		respBadRequest(exmodels.ErrorSSOMisconfigured.WithDetails("SSO secret isn't configured"))
+		return respBadRequest(exmodels.ErrorSSOMisconfigured.WithDetails("SSO secret is invalid"))
+
+		// Verify SSO secret is set, unless it's JWT SSO relying on a JWKS
+	} else if sec == nil && !(isJWT && domain.SSOJWKSURL != "") {
+		return respBadRequest(exmodels.ErrorSSOMisconfigured.WithDetails("SSO secret isn't configured"))
+
+		// Verify JWKS URL, if any, is valid, secure, and points to a public host (allow insecure and non-public ones in
+		// e2e-testing mode)
+	} else if isJWT && domain.SSOJWKSURL != "" {
+		if u, err := util.ParseAbsoluteURL(domain.SSOJWKSURL, config.ServerConfig.E2e, false); err != nil {
+			return respBadRequest(exmodels.ErrorSSOMisconfigured.WithDetails("SSO JWKS URL: " + err.Error()))
+		} else if !config.ServerConfig.E2e {
+			if err := util.VerifyPublicHost(u.Hostname()); err != nil {
+				return respBadRequest(exmodels.ErrorSSOMisconfigured.WithDetails("SSO JWKS URL: " + err.Error()))
+			}
+		}
 	}
 
 	// Succeeded
@@ -210,6 +230,20 @@ func (v *verifier) LocalSignupEnabled(domainID *uuid.UUID) middleware.Responder
 	return nil
 }
 
+func (v *verifier) PasskeysEnabled() middleware.Responder {
+	if !config.ServerConfig.EnablePasskeys {
+		return respForbidden(exmodels.ErrorFeatureDisabled.WithDetails("passkeys"))
+	}
+	return nil
+}
+
+func (v *verifier) TOTPEnabled() middleware.Responder {
+	if !config.ServerConfig.EnableTOTP {
+		return respForbidden(exmodels.ErrorFeatureDisabled.WithDetails("two-factor authentication"))
+	}
+	return nil
+}
+
 func (v *verifier) UserCanAddDomain(user *data.User) middleware.Responder {
 	// If the user isn't a superuser and no new owners are allowed
 	if !user.IsSuperuser && !svc.TheDynConfigService.GetBool(data.ConfigKeyOperationNewOwnerEnabled) {
@@ -221,7 +255,7 @@ func (v *verifier) UserCanAddDomain(user *data.User) middleware.Responder {
 			return respForbidden(exmodels.ErrorNewOwnersForbidden)
 		}
 	}
-	return nil
+	return v.userHasRequiredTOTP(user)
 }
 
 func (v *verifier) UserCanChangeEmailTo(user *data.User, newEmail string) middleware.Responder {
@@ -273,10 +307,10 @@ func (v *verifier) UserCanDeleteComment(domainID *uuid.UUID, user *data.User, do
 }
 
 func (v *verifier) UserCanManageDomain(user *data.User, domainUser *data.DomainUser) middleware.Responder {
-	if user.IsSuperuser || domainUser.IsAnOwner() {
-		return nil
+	if !user.IsSuperuser && !domainUser.IsAnOwner() {
+		return respForbidden(exmodels.ErrorNotDomainOwner)
 	}
-	return respForbidden(exmodels.ErrorNotDomainOwner)
+	return v.userHasRequiredTOTP(user)
 }
 
 func (v *verifier) UserCanModerateDomain(user *data.User, domainUser *data.DomainUser) middleware.Responder {
@@ -368,3 +402,22 @@ func (v *verifier) UserIsSuperuser(user *data.User) middleware.Responder {
 	}
 	return nil
 }
+
+func (v *verifier) UserSecondFactor(user *data.User, code string) middleware.Responder {
+	if !user.VerifySecondFactor(code) {
+		// Sleep a while to discourage brute-force attacks
+		time.Sleep(util.WrongAuthDelayMax)
+		return respBadRequest(exmodels.ErrorInvalidTOTPCode)
+	}
+	return nil
+}
+
+// userHasRequiredTOTP verifies the given user has two-factor authentication enabled if it's required for domain owners.
+// Only applies to local users, as federated ones authenticate with their identity provider, and only if two-factor
+// authentication is enabled at all
+func (v *verifier) userHasRequiredTOTP(user *data.User) middleware.Responder {
+	if config.ServerConfig.EnableTOTP && user.IsLocal() && !user.TOTPEnabled && svc.TheDynConfigService.GetBool(data.ConfigKeyAuthTOTPRequiredForOwners) {
+		return respForbidden(exmodels.ErrorTOTPEnrolmentRequired)
+	}
+	return nil
+}
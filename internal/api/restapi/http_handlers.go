@@ -1,6 +1,7 @@
 package restapi
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/go-openapi/errors"
 	"github.com/go-openapi/runtime"
@@ -276,6 +277,32 @@ func staticHandler(next http.Handler) http.Handler {
 	})
 }
 
+// webAuthnWellKnownHandler returns a middleware that serves the list of origins allowed to use passkeys issued for the
+// server, which is what makes passkey sign-in on embedding sites possible. The document is always served from the root
+// of the host since the relying party ID is the hostname. Nothing is served unless passkeys are enabled
+func webAuthnWellKnownHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if config.ServerConfig.EnablePasskeys && r.URL.Path == util.WebAuthnWellKnownPath && r.Method == http.MethodGet {
+			// Fetch the origins
+			origins, err := svc.ThePasskeyService.RelatedOrigins()
+			if err != nil {
+				writeError(w, http.StatusInternalServerError)
+				return
+			}
+
+			// Serve them as JSON
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(map[string][]string{"origins": origins}); err != nil {
+				logger.Warningf("Failed to write WebAuthn related origins: %v", err)
+			}
+			return
+		}
+
+		// Pass on to the next handler otherwise
+		next.ServeHTTP(w, r)
+	})
+}
+
 // webSocketsHandler handles incoming Live update (web sockets) connections
 func webSocketsHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -11,6 +11,7 @@ import (
 	"net/mail"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -28,6 +29,8 @@ type ServerConfiguration struct {
 	DBIdleConns          int    `long:"db-idle-conns"       description:"Max. # of idle DB connections"              default:"50"                          env:"DB_MAX_IDLE_CONNS"`
 	DisableXSRF          bool   `long:"disable-xsrf"        description:"Disable XSRF protection (development purposes only)"`
 	EnableSwaggerUI      bool   `long:"enable-swagger-ui"   description:"Enable Swagger UI at /api/docs"`
+	EnablePasskeys       bool   `long:"enable-passkeys"     description:"Enable signing in with passkeys (server API only)"`
+	EnableTOTP           bool   `long:"enable-totp"         description:"Enable two-factor authentication (server API only)"`
 	PluginPath           string `long:"plugin-path"         description:"Path to plugins"                            default:""                            env:"PLUGIN_PATH"`
 	StaticPath           string `long:"static-path"         description:"Path to static files"                       default:"./frontend"                  env:"STATIC_PATH"`
 	DBMigrationPath      string `long:"db-migration-path"   description:"Path to DB migration files"                 default:"./db"                        env:"DB_MIGRATION_PATH"`
@@ -41,6 +44,8 @@ type ServerConfiguration struct {
 	DisableLiveUpdate    bool   `long:"no-live-update"      description:"Disable live updates via WebSockets"                                              env:"NO_LIVE_UPDATE"`
 	DisablePageViewStats bool   `long:"no-page-view-stats"  description:"Disable page view statistics gathering and reporting"                             env:"NO_PAGE_VIEW_STATS"`
 	WSMaxClients         uint32 `long:"ws-max-clients"      description:"Maximum number of WebSocket clients"        default:"10000"                       env:"WS_MAX_CLIENTS"`
+	AuditRetentionDays   int    `long:"audit-retention"     description:"Audit log retention in days, 0 = forever"   default:"365"                         env:"AUDIT_RETENTION_DAYS"`
+	ImportPath           string `long:"import-path"         description:"Path to store import data files"            default:""                            env:"IMPORT_PATH"`
 	E2e                  bool   `long:"e2e"                 description:"End-2-end testing mode"`
 
 	parsedBaseURL *url.URL // The parsed base URL
@@ -139,6 +144,17 @@ func (sc *ServerConfiguration) postProcess() error {
 		return fmt.Errorf("invalid CDN URL: %w", err)
 	}
 
+	// Validate the audit log retention
+	if sc.AuditRetentionDays < 0 {
+		return fmt.Errorf("invalid audit log retention: %d", sc.AuditRetentionDays)
+	}
+
+	// Import data files are stored in a temporary directory by default, which may not survive a restart
+	if sc.ImportPath == "" {
+		sc.ImportPath = filepath.Join(os.TempDir(), "comentario-import")
+		logger.Warningf("Import path isn't provided, using %s: interrupted imports can't be resumed if it's cleared on restart", sc.ImportPath)
+	}
+
 	// Load and post-process secrets
 	if err := UnmarshalConfigFile(sc.SecretsFile, SecretsConfig); err != nil {
 		return err
@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"github.com/crewjam/saml"
 	"gitlab.com/comentario/comentario/internal/util"
 	"net/http"
 	"net/url"
@@ -16,6 +17,39 @@ func mustParseURL(s string) *url.URL {
 	}
 }
 
+func TestInboundMail_ReplyAddress(t *testing.T) {
+	c := &InboundMail{Address: "reply@example.com"}
+	if got := c.ReplyAddress("abc123"); got != "reply+abc123@example.com" {
+		t.Errorf("ReplyAddress() = %v, want %v", got, "reply+abc123@example.com")
+	}
+}
+
+func TestInboundMail_ReplyTag(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		addr    string
+		want    string
+	}{
+		{"unconfigured    ", "", "reply+abc@example.com", ""},
+		{"tagged          ", "reply@example.com", "reply+abc@example.com", "abc"},
+		{"case-insensitive", "reply@example.com", "Reply+ABC@Example.COM", "ABC"},
+		{"untagged        ", "reply@example.com", "reply@example.com", ""},
+		{"empty tag       ", "reply@example.com", "reply+@example.com", ""},
+		{"other local part", "reply@example.com", "replies+abc@example.com", ""},
+		{"other domain    ", "reply@example.com", "reply+abc@example.org", ""},
+		{"no domain       ", "reply@example.com", "reply+abc", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &InboundMail{Address: tt.address}
+			if got := c.ReplyTag(tt.addr); got != tt.want {
+				t.Errorf("ReplyTag() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestKeySecret_Usable(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -41,6 +75,68 @@ func TestKeySecret_Usable(t *testing.T) {
 	}
 }
 
+func TestSAMLProvider_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       SAMLProvider
+		wantErr bool
+	}{
+		{"disabled, empty   ", SAMLProvider{Disableable: Disableable{true}}, false},
+		{"no ID             ", SAMLProvider{Name: "X", MetadataURL: "https://idp.example.com/md"}, true},
+		{"bad ID            ", SAMLProvider{ID: "Foo", Name: "X", MetadataURL: "https://idp.example.com/md"}, true},
+		{"no name           ", SAMLProvider{ID: "foo", MetadataURL: "https://idp.example.com/md"}, true},
+		{"no metadata       ", SAMLProvider{ID: "foo", Name: "X"}, true},
+		{"bad metadata URL  ", SAMLProvider{ID: "foo", Name: "X", MetadataURL: "idp.example.com"}, true},
+		{"cert without key  ", SAMLProvider{ID: "foo", Name: "X", Metadata: "<x/>", Cert: "cert"}, true},
+		{"metadata URL      ", SAMLProvider{ID: "foo", Name: "X", MetadataURL: "https://idp.example.com/md"}, false},
+		{"inline metadata   ", SAMLProvider{ID: "foo-1", Name: "X", Metadata: "<x/>"}, false},
+		{"cert and key      ", SAMLProvider{ID: "foo", Name: "X", Metadata: "<x/>", Cert: "cert", Key: "key"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.p.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_samlAssertionUser(t *testing.T) {
+	attr := func(name, friendly, value string) saml.Attribute {
+		return saml.Attribute{Name: name, FriendlyName: friendly, Values: []saml.AttributeValue{{Value: value}}}
+	}
+	assertion := &saml.Assertion{
+		Subject: &saml.Subject{NameID: &saml.NameID{Value: "name-id"}},
+		AttributeStatements: []saml.AttributeStatement{{Attributes: []saml.Attribute{
+			attr("urn:oid:0.9.2342.19200300.100.1.3", "mail", "jane@example.com"),
+			attr("urn:oid:2.16.840.1.113730.3.1.241", "displayName", "Jane Doe"),
+			attr("employeeNumber", "", "1234"),
+			attr("nickname", "", " "),
+		}}},
+	}
+	tests := []struct {
+		name      string
+		attrs     SAMLAttributes
+		wantID    string
+		wantEmail string
+		wantName  string
+	}{
+		{"defaults       ", SAMLAttributes{}, "name-id", "jane@example.com", "Jane Doe"},
+		{"mapped by name ", SAMLAttributes{ID: "employeeNumber", Email: "urn:oid:0.9.2342.19200300.100.1.3"}, "1234", "jane@example.com", "Jane Doe"},
+		{"mapped friendly", SAMLAttributes{Name: "displayName"}, "name-id", "jane@example.com", "Jane Doe"},
+		{"blank value    ", SAMLAttributes{Name: "nickname"}, "name-id", "jane@example.com", ""},
+		{"missing        ", SAMLAttributes{ID: "uid", Email: "email"}, "", "", "Jane Doe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := samlAssertionUser(assertion, &tt.attrs)
+			if u.UserID != tt.wantID || u.Email != tt.wantEmail || u.Name != tt.wantName {
+				t.Errorf("samlAssertionUser() = (%q, %q, %q), want (%q, %q, %q)", u.UserID, u.Email, u.Name, tt.wantID, tt.wantEmail, tt.wantName)
+			}
+		})
+	}
+}
+
 func TestServerConfiguration_PathOfBaseURL(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -191,6 +287,8 @@ func TestIsXSRFSafe(t *testing.T) {
 		{"POST", "/cc/api/embed/", true},
 		{"POST", "/cc/en/fonts/", true},
 		{"POST", "/cc/en/images/", true},
+		{"POST", "/cc/api/oauth/github/callback", false},
+		{"POST", "/cc/api/oauth/saml:adfs/callback", false},
 		{"PUT", "/cc/api/embed/foo/42", true},
 		{"PUT", "/cc/en/fonts/foo/42", true},
 		{"PUT", "/cc/en/images/foo/42", true},
@@ -45,7 +45,10 @@ func oauthConfigure() error {
 	gitlabOauthConfigure()
 	googleOauthConfigure()
 	twitterOauthConfigure()
-	return oidcConfigure()
+	if err := oidcConfigure(); err != nil {
+		return err
+	}
+	return samlConfigure()
 }
 
 // oauthCallbackURL returns the full callback URL for the provider with the given ID
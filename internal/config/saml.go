@@ -0,0 +1,337 @@
+package config
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+	"github.com/markbates/goth"
+	"gitlab.com/comentario/comentario/internal/api/models"
+	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/util"
+	"golang.org/x/oauth2"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// samlMetadataFetchTimeout is the maximum time allowed for fetching the IdP metadata
+const samlMetadataFetchTimeout = 30 * time.Second
+
+// Commonly used names of SAML attributes, applied when no explicit mapping is configured
+var (
+	samlDefaultEmailAttrs = []string{
+		"email",
+		"mail",
+		"urn:oid:0.9.2342.19200300.100.1.3",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+	}
+	samlDefaultNameAttrs = []string{
+		"displayName",
+		"name",
+		"cn",
+		"urn:oid:2.16.840.1.113730.3.1.241",
+		"urn:oid:2.5.4.3",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name",
+	}
+)
+
+// SAMLIdProvider is a goth.Provider implementation for SAML 2.0 identity providers, which makes SAML authentication
+// follow the same flow as the OAuth one
+type SAMLIdProvider struct {
+	name  string                // Provider (goth) name
+	sp    *saml.ServiceProvider // Service provider instance
+	attrs SAMLAttributes        // Attribute mapping
+}
+
+// Metadata returns the service provider metadata, to be imported into the IdP
+func (p *SAMLIdProvider) Metadata() *saml.EntityDescriptor {
+	return p.sp.Metadata()
+}
+
+func (p *SAMLIdProvider) Name() string {
+	return p.name
+}
+
+func (p *SAMLIdProvider) SetName(name string) {
+	p.name = name
+}
+
+func (p *SAMLIdProvider) BeginAuth(state string) (goth.Session, error) {
+	// Make an authentication request using the redirect binding, and ask for the response to be posted back
+	req, err := p.sp.MakeAuthenticationRequest(p.sp.GetSSOBindingLocation(saml.HTTPRedirectBinding), saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pass the state as the relay state
+	u, err := req.Redirect(state, p.sp)
+	if err != nil {
+		return nil, err
+	}
+	return &samlSession{AuthURL: u.String(), RequestID: req.ID, State: state}, nil
+}
+
+func (p *SAMLIdProvider) UnmarshalSession(s string) (goth.Session, error) {
+	sess := &samlSession{}
+	err := json.Unmarshal([]byte(s), sess)
+	return sess, err
+}
+
+func (p *SAMLIdProvider) FetchUser(session goth.Session) (goth.User, error) {
+	sess := session.(*samlSession)
+	if sess.user == nil {
+		return goth.User{}, errors.New("SAML session isn't authorised")
+	}
+	return *sess.user, nil
+}
+
+func (p *SAMLIdProvider) Debug(bool) {}
+
+func (p *SAMLIdProvider) RefreshToken(string) (*oauth2.Token, error) {
+	return nil, errors.New("refresh token isn't supported by SAML")
+}
+
+func (p *SAMLIdProvider) RefreshTokenAvailable() bool {
+	return false
+}
+
+// samlSession is a goth.Session implementation for SAML 2.0 identity providers
+type samlSession struct {
+	AuthURL   string     `json:"authUrl"`   // IdP URL the user is redirected to
+	RequestID string     `json:"requestId"` // ID of the authentication request, which the response must refer to
+	State     string     `json:"state"`     // Relay state, which the response must carry over
+	user      *goth.User // User obtained from a validated assertion
+}
+
+func (s *samlSession) GetAuthURL() (string, error) {
+	return s.AuthURL, nil
+}
+
+func (s *samlSession) Marshal() string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func (s *samlSession) Authorize(provider goth.Provider, params goth.Params) (string, error) {
+	p := provider.(*SAMLIdProvider)
+
+	// Verify the relay state
+	if rs := params.Get("RelayState"); rs != s.State {
+		return "", fmt.Errorf("relay state mismatch: want %q, got %q", s.State, rs)
+	}
+
+	// Decode the response
+	b, err := base64.StdEncoding.DecodeString(params.Get("SAMLResponse"))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode SAML response: %w", err)
+	}
+
+	// Validate the response and extract the assertion
+	assertion, err := p.sp.ParseXMLResponse(b, []string{s.RequestID}, p.sp.AcsURL)
+	if err != nil {
+		var ire *saml.InvalidResponseError
+		if errors.As(err, &ire) {
+			err = ire.PrivateErr
+		}
+		return "", fmt.Errorf("invalid SAML response: %w", err)
+	}
+
+	// Map the assertion onto a user
+	u := samlAssertionUser(assertion, &p.attrs)
+	u.Provider = p.name
+	s.user = &u
+	return "", nil
+}
+
+// samlAssertionUser returns a user based on the attributes of the given assertion
+func samlAssertionUser(assertion *saml.Assertion, attrs *SAMLAttributes) goth.User {
+	u := goth.User{
+		Email:   samlAttrValue(assertion, attrs.Email, samlDefaultEmailAttrs),
+		Name:    samlAttrValue(assertion, attrs.Name, samlDefaultNameAttrs),
+		RawData: map[string]any{},
+	}
+
+	// Use the ID attribute, if configured, falling back to the subject's NameID
+	if attrs.ID != "" {
+		u.UserID = samlAttrValue(assertion, attrs.ID, nil)
+	} else if assertion.Subject != nil && assertion.Subject.NameID != nil {
+		u.UserID = assertion.Subject.NameID.Value
+	}
+
+	// Collect all attributes as raw data, keyed by both name and friendly name. Multi-valued attributes (such as group
+	// memberships) are stored as a string slice
+	for _, as := range assertion.AttributeStatements {
+		for _, a := range as.Attributes {
+			var v any
+			switch len(a.Values) {
+			case 0:
+				continue
+			case 1:
+				v = a.Values[0].Value
+			default:
+				vals := make([]string, len(a.Values))
+				for i, av := range a.Values {
+					vals[i] = av.Value
+				}
+				v = vals
+			}
+			u.RawData[a.Name] = v
+			if a.FriendlyName != "" {
+				u.RawData[a.FriendlyName] = v
+			}
+		}
+	}
+	return u
+}
+
+// samlAttrValue returns the (first) value of the assertion attribute with the given name, or, if name is empty, of the
+// first found attribute with any of the fallback names
+func samlAttrValue(assertion *saml.Assertion, name string, fallback []string) string {
+	names := fallback
+	if name != "" {
+		names = []string{name}
+	}
+	for _, n := range names {
+		for _, as := range assertion.AttributeStatements {
+			for _, a := range as.Attributes {
+				if (a.Name == n || a.FriendlyName == n) && len(a.Values) > 0 {
+					if v := strings.TrimSpace(a.Values[0].Value); v != "" {
+						return v
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// samlConfigure configures federated authentication via SAML providers
+func samlConfigure() error {
+	cnt := 0
+	for _, p := range SecretsConfig.IdP.SAML {
+		// Skip disabled ones
+		if p.Disable {
+			continue
+		}
+
+		// The IdP posts its response back cross-site, and browsers only send the auth session cookie along with such a
+		// request if it's a secure one (SameSite=None)
+		if !ServerConfig.UseHTTPS() {
+			return fmt.Errorf("SAML provider (ID=%q) requires the base URL to be an HTTPS one", p.ID)
+		}
+
+		// Instantiate a new SAML provider. This will also import its metadata, if a URL is given
+		qid := p.QualifiedID()
+		sp, err := samlServiceProvider(&p, qid)
+		if err != nil {
+			return fmt.Errorf("failed to add SAML provider (ID=%q): %w", p.ID, err)
+		}
+
+		// Register the provider
+		logger.Infof("Registering SAML provider (ID=%q) for IdP %s", p.ID, sp.IDPMetadata.EntityID)
+		goth.UseProviders(&SAMLIdProvider{name: qid, sp: sp, attrs: p.Attributes})
+
+		// The IdP posts assertions to the callback cross-site, so only that path is excluded from XSRF protection. The
+		// assertion is bound to the auth session instead
+		util.XSRFSafePaths.Add(fmt.Sprintf("%soauth/%s/callback", util.APIPath, qid))
+
+		// Add it to the configured providers map
+		mid := models.FederatedIdpID(qid)
+		FederatedIdProviders[mid] = &data.FederatedIdentityProvider{
+			ID:       mid,
+			Name:     p.Name,
+			GothName: qid,
+		}
+		cnt++
+	}
+
+	// If no configure providers available
+	if cnt == 0 {
+		logger.Debug("No SAML providers configured or enabled")
+	}
+	return nil
+}
+
+// samlServiceProvider instantiates and returns a new SAML service provider for the given IdP config
+func samlServiceProvider(p *SAMLProvider, qid string) (*saml.ServiceProvider, error) {
+	// Obtain the IdP metadata
+	var md *saml.EntityDescriptor
+	var err error
+	if p.MetadataURL != "" {
+		var mdURL *url.URL
+		if mdURL, err = url.Parse(p.MetadataURL); err != nil {
+			return nil, fmt.Errorf("failed to parse metadata URL: %w", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), samlMetadataFetchTimeout)
+		defer cancel()
+		if md, err = samlsp.FetchMetadata(ctx, http.DefaultClient, *mdURL); err != nil {
+			return nil, fmt.Errorf("failed to fetch metadata: %w", err)
+		}
+	} else if md, err = samlsp.ParseMetadata([]byte(p.Metadata)); err != nil {
+		return nil, fmt.Errorf("failed to parse metadata: %w", err)
+	}
+
+	// Parse the SP URLs
+	acsURL, err := url.Parse(oauthCallbackURL(qid))
+	if err != nil {
+		return nil, err
+	}
+	spMDURL, err := url.Parse(ServerConfig.URLForAPI(fmt.Sprintf("oauth/%s/metadata", qid), nil))
+	if err != nil {
+		return nil, err
+	}
+
+	sp := &saml.ServiceProvider{
+		EntityID:    spMDURL.String(),
+		MetadataURL: *spMDURL,
+		AcsURL:      *acsURL,
+		IDPMetadata: md,
+	}
+
+	// Parse the certificate and the key, if any
+	if p.Cert != "" {
+		if sp.Certificate, err = samlParseCert(p.Cert); err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		if sp.Key, err = samlParseKey(p.Key); err != nil {
+			return nil, fmt.Errorf("failed to parse key: %w", err)
+		}
+	}
+	return sp, nil
+}
+
+// samlParseCert parses a PEM-encoded X.509 certificate
+func samlParseCert(s string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// samlParseKey parses a PEM-encoded private key, either in PKCS #8 or PKCS #1 form
+func samlParseKey(s string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	if k, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if signer, ok := k.(crypto.Signer); ok {
+		return signer, nil
+	}
+	return nil, errors.New("unsupported key type")
+}
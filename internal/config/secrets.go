@@ -46,6 +46,59 @@ type APIKey struct {
 	Key         string `yaml:"key"` // API key
 }
 
+// InboundMail stores the configuration of reply-by-email ingestion
+type InboundMail struct {
+	Address string `yaml:"address"` // Address replies get sent to; it's tagged per comment using subaddressing ("reply+tag@...")
+	Secret  string `yaml:"secret"`  // Secret used to authenticate inbound messages and to sign reply addresses
+}
+
+// Enabled returns whether reply-by-email is configured
+func (c *InboundMail) Enabled() bool {
+	return c.Address != ""
+}
+
+// ReplyAddress returns the reply address with the given tag added to its local part
+func (c *InboundMail) ReplyAddress(tag string) string {
+	local, domain, _ := strings.Cut(c.Address, "@")
+	return local + "+" + tag + "@" + domain
+}
+
+// ReplyTag returns the tag of the given email address if it's a tagged reply address, or an empty string otherwise
+func (c *InboundMail) ReplyTag(addr string) string {
+	local, domain, ok := strings.Cut(c.Address, "@")
+	addrLocal, addrDomain, addrOK := strings.Cut(addr, "@")
+	if !ok || !addrOK || !strings.EqualFold(domain, addrDomain) {
+		return ""
+	}
+
+	// The address' local part must be prefixed with the configured one
+	if prefix := local + "+"; len(addrLocal) > len(prefix) && strings.EqualFold(addrLocal[:len(prefix)], prefix) {
+		return addrLocal[len(prefix):]
+	}
+	return ""
+}
+
+// validate the inbound mail configuration
+func (c *InboundMail) validate() error {
+	// Don't bother if it's not configured
+	if !c.Enabled() {
+		return nil
+	}
+
+	// Address
+	if !util.IsValidEmail(c.Address) {
+		return errors.New("invalid address")
+	} else if strings.Contains(c.Address, "+") {
+		return errors.New("address must not contain a '+'")
+	}
+
+	// Secret
+	if len(c.Secret) < 16 {
+		return errors.New("secret must be at least 16 characters long")
+	}
+	return nil
+}
+
 // OIDCProvider stores OIDC provider configuration
 type OIDCProvider struct {
 	KeySecret `yaml:",inline"`
@@ -60,7 +113,7 @@ func (p *OIDCProvider) QualifiedID() string {
 	return "oidc:" + p.ID
 }
 
-var reOIDCProviderID = regexp.MustCompile(`^[-a-z0-9]{1,32}$`)
+var reProviderID = regexp.MustCompile(`^[-a-z0-9]{1,32}$`)
 
 // validate the OIDC provider configuration
 func (p *OIDCProvider) validate() error {
@@ -80,7 +133,7 @@ func (p *OIDCProvider) validate() error {
 		return errors.New("provider ID must be specified")
 	case len(p.ID) > 32:
 		return fmt.Errorf("provider ID cannot exceed 32 characters (%d supplied)", len(p.ID))
-	case !reOIDCProviderID.MatchString(p.ID):
+	case !reProviderID.MatchString(p.ID):
 		return errors.New("provider ID must consist of lowercase characters, digits, and dashes only")
 	}
 
@@ -98,6 +151,67 @@ func (p *OIDCProvider) validate() error {
 	return nil
 }
 
+// SAMLAttributes stores names of SAML assertion attributes holding user properties. Every name is matched against both
+// the attribute's name and its friendly name; an empty name makes the commonly used ones apply
+type SAMLAttributes struct {
+	ID    string `yaml:"id"`    // Attribute holding the user's unique ID. If empty, the assertion subject's NameID is used
+	Email string `yaml:"email"` // Attribute holding the user's email
+	Name  string `yaml:"name"`  // Attribute holding the user's display name
+}
+
+// SAMLProvider stores SAML 2.0 identity provider configuration
+type SAMLProvider struct {
+	Disableable `yaml:",inline"`
+	ID          string         `yaml:"id"`          // Unique provider ID, e.g. "adfs"
+	Name        string         `yaml:"name"`        // Provider display name, e.g. "Corporate account"
+	MetadataURL string         `yaml:"metadataUrl"` // URL to import the IdP metadata from
+	Metadata    string         `yaml:"metadata"`    // IdP metadata XML, used if no metadataUrl is given
+	Cert        string         `yaml:"cert"`        // Optional PEM-encoded SP certificate, advertised in the SP metadata
+	Key         string         `yaml:"key"`         // PEM-encoded SP private key, required if a certificate is given
+	Attributes  SAMLAttributes `yaml:"attributes"`  // Mapping of assertion attributes to user properties
+}
+
+// QualifiedID returns the provider's ID prepended with the common SAML prefix
+func (p *SAMLProvider) QualifiedID() string {
+	return "saml:" + p.ID
+}
+
+// validate the SAML provider configuration
+func (p *SAMLProvider) validate() error {
+	// Don't bother if it's disabled
+	if p.Disable {
+		return nil
+	}
+
+	// ID
+	switch {
+	case p.ID == "":
+		return errors.New("provider ID must be specified")
+	case len(p.ID) > 32:
+		return fmt.Errorf("provider ID cannot exceed 32 characters (%d supplied)", len(p.ID))
+	case !reProviderID.MatchString(p.ID):
+		return errors.New("provider ID must consist of lowercase characters, digits, and dashes only")
+	}
+
+	// Name
+	if p.Name == "" {
+		return errors.New("provider name must be specified")
+	}
+
+	// Metadata
+	if p.MetadataURL == "" && p.Metadata == "" {
+		return errors.New("either provider metadata URL or metadata must be specified")
+	} else if p.MetadataURL != "" && !util.IsValidURL(p.MetadataURL, false) {
+		return errors.New("invalid provider metadata URL")
+	}
+
+	// Certificate and key
+	if p.Cert != "" && p.Key == "" {
+		return errors.New("key must be specified along with the certificate")
+	}
+	return nil
+}
+
 // SecretsConfiguration accumulates the entire configuration provided in a secrets file
 type SecretsConfiguration struct {
 	// PostgreSQL settings. Used when at least host is provided
@@ -125,6 +239,9 @@ type SecretsConfiguration struct {
 		Insecure   bool           `yaml:"insecure"`   // Skip SMTP server certificate verification
 	} `yaml:"smtpServer"`
 
+	// Reply-by-email settings
+	InboundMail InboundMail `yaml:"inboundMail"`
+
 	// Federated identity provider settings
 	IdP struct {
 		Facebook KeySecret      `yaml:"facebook"` // Facebook auth config
@@ -133,13 +250,15 @@ type SecretsConfiguration struct {
 		Google   KeySecret      `yaml:"google"`   // Google auth config
 		Twitter  KeySecret      `yaml:"twitter"`  // Twitter auth config
 		OIDC     []OIDCProvider `yaml:"oidc"`     // OIDC provider specs
+		SAML     []SAMLProvider `yaml:"saml"`     // SAML provider specs
 	} `yaml:"idp"`
 
 	// Extension settings
 	Extensions struct {
-		Akismet             APIKey `yaml:"akismet"`
-		Perspective         APIKey `yaml:"perspective"`
-		APILayerSpamChecker APIKey `yaml:"apiLayerSpamChecker"`
+		LocalRules          Disableable `yaml:"localRules"`
+		Akismet             APIKey      `yaml:"akismet"`
+		Perspective         APIKey      `yaml:"perspective"`
+		APILayerSpamChecker APIKey      `yaml:"apiLayerSpamChecker"`
 	} `yaml:"extensions"`
 
 	// Optional random string to generate XSRF key from
@@ -148,7 +267,8 @@ type SecretsConfiguration struct {
 	// Optional plugin config, a map indexed by plugin ID. Gets read as raw YAML nodes
 	Plugins map[string]yaml.Node `yaml:"plugins"`
 
-	xsrfKey []byte // The generated XSRF key for the server
+	xsrfKey   []byte // The generated XSRF key for the server
+	ipHashKey []byte // The key for hashing IP addresses, derived from the XSRF key
 }
 
 // PostProcess signals the configuration the values have been assigned
@@ -168,11 +288,17 @@ func (sc *SecretsConfiguration) PostProcess() error {
 	} else if sc.xsrfKey, err = util.RandomBytes(32); err != nil {
 		return err
 	}
+	sc.ipHashKey = util.HMACSign([]byte("ip-hash"), sc.xsrfKey)
 
 	// Succeeded
 	return nil
 }
 
+// IPHashKey returns the key for hashing IP addresses
+func (sc *SecretsConfiguration) IPHashKey() []byte {
+	return sc.ipHashKey
+}
+
 // XSRFKey returns the XSRF key for the server
 func (sc *SecretsConfiguration) XSRFKey() []byte {
 	return sc.xsrfKey
@@ -199,6 +325,11 @@ func (sc *SecretsConfiguration) validate() error {
 		return errors.New("could not determine DB dialect to use. Either postgres.host or sqlite3.file must be set")
 	}
 
+	// Validate inbound mail configuration
+	if err := sc.InboundMail.validate(); err != nil {
+		return fmt.Errorf("inbound mail misconfigured: %w", err)
+	}
+
 	// Validate identity providers
 	return sc.validateIdPConfig()
 }
@@ -261,6 +392,21 @@ func (sc *SecretsConfiguration) validateIdPConfig() error {
 		ids[p.ID] = true
 	}
 
+	// Iterate all available SAML entries
+	ids = map[string]bool{}
+	for _, p := range sc.IdP.SAML {
+		// Validate the config
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("invalid SAML provider (ID=%q) config: %w", p.ID, err)
+		}
+
+		// Make sure the ID is unique
+		if ids[p.ID] {
+			return fmt.Errorf("duplicate SAML provider ID: %q", p.ID)
+		}
+		ids[p.ID] = true
+	}
+
 	// Succeeded
 	return nil
 }
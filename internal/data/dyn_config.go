@@ -97,6 +97,22 @@ func (ci *DynConfigItem) ValidateValue(value string) error {
 	return nil
 }
 
+// DynConfigDiff compares the given config items with the given new values and returns only the values that differ, as
+// two maps: one with the current and one with the new values
+func DynConfigDiff(items map[DynConfigItemKey]*DynConfigItem, vals map[DynConfigItemKey]string) (before, after map[DynConfigItemKey]string) {
+	before = map[DynConfigItemKey]string{}
+	after = map[DynConfigItemKey]string{}
+	for k, v := range vals {
+		if item, ok := items[k]; !ok || item.Value != v {
+			if ok {
+				before[k] = item.Value
+			}
+			after[k] = v
+		}
+	}
+	return
+}
+
 // DynConfigDTOsToMap converts a slice of dynamic config item DTOs into a key-value map
 func DynConfigDTOsToMap(items []*models.DynamicConfigItem) map[DynConfigItemKey]string {
 	m := make(map[DynConfigItemKey]string, len(items))
@@ -136,6 +152,7 @@ const (
 	ConfigKeyAuthSignupConfirmCommenter DynConfigItemKey = "auth.signup.confirm.commenter"
 	ConfigKeyAuthSignupConfirmUser      DynConfigItemKey = "auth.signup.confirm.user"
 	ConfigKeyAuthSignupEnabled          DynConfigItemKey = "auth.signup.enabled"
+	ConfigKeyAuthTOTPRequiredForOwners  DynConfigItemKey = "auth.totp.requiredForOwners"
 	ConfigKeyIntegrationsUseGravatar    DynConfigItemKey = "integrations.useGravatar"
 	ConfigKeyOperationNewOwnerEnabled   DynConfigItemKey = "operation.newOwner.enabled"
 )
@@ -146,7 +163,14 @@ const (
 	DomainConfigKeyCommentDeletionModerator DynConfigItemKey = "comments.deletion.moderator"
 	DomainConfigKeyCommentEditingAuthor     DynConfigItemKey = "comments.editing.author"
 	DomainConfigKeyCommentEditingModerator  DynConfigItemKey = "comments.editing.moderator"
+	DomainConfigKeyCommentEditingRemoderate DynConfigItemKey = "comments.editing.remoderate"
 	DomainConfigKeyEnableCommentVoting      DynConfigItemKey = "comments.enableVoting"
+	DomainConfigKeyFlaggingAnonymous        DynConfigItemKey = "comments.flagging.anonymous"
+	DomainConfigKeyFlaggingEnabled          DynConfigItemKey = "comments.flagging.enabled"
+	DomainConfigKeyFlaggingThreshold        DynConfigItemKey = "comments.flagging.threshold"
+	DomainConfigKeyRateLimitPerIP           DynConfigItemKey = "comments.rateLimit.perIP"
+	DomainConfigKeyRateLimitPerPage         DynConfigItemKey = "comments.rateLimit.perPage"
+	DomainConfigKeyRateLimitPerUser         DynConfigItemKey = "comments.rateLimit.perUser"
 	DomainConfigKeyRSSEnabled               DynConfigItemKey = "comments.rss.enabled"
 	DomainConfigKeyShowDeletedComments      DynConfigItemKey = "comments.showDeleted"
 	DomainConfigKeyMaxCommentLength         DynConfigItemKey = "comments.text.maxLength"
@@ -168,13 +192,21 @@ var DefaultDynInstanceConfig = map[DynConfigItemKey]*DynConfigItem{
 	ConfigKeyAuthSignupConfirmCommenter:                                     {DefaultValue: "true", Datatype: ConfigDatatypeBool, Section: DynConfigItemSectionAuth},
 	ConfigKeyAuthSignupConfirmUser:                                          {DefaultValue: "true", Datatype: ConfigDatatypeBool, Section: DynConfigItemSectionAuth},
 	ConfigKeyAuthSignupEnabled:                                              {DefaultValue: "true", Datatype: ConfigDatatypeBool, Section: DynConfigItemSectionAuth},
+	ConfigKeyAuthTOTPRequiredForOwners:                                      {DefaultValue: "false", Datatype: ConfigDatatypeBool, Section: DynConfigItemSectionAuth},
 	ConfigKeyIntegrationsUseGravatar:                                        {DefaultValue: "true", Datatype: ConfigDatatypeBool, Section: DynConfigItemSectionIntegrations},
 	ConfigKeyOperationNewOwnerEnabled:                                       {DefaultValue: "false", Datatype: ConfigDatatypeBool, Section: DynConfigItemSectionMisc},
 	ConfigKeyDomainDefaultsPrefix + DomainConfigKeyCommentDeletionAuthor:    {DefaultValue: "true", Datatype: ConfigDatatypeBool, Section: DynConfigItemSectionComments},
 	ConfigKeyDomainDefaultsPrefix + DomainConfigKeyCommentDeletionModerator: {DefaultValue: "true", Datatype: ConfigDatatypeBool, Section: DynConfigItemSectionComments},
 	ConfigKeyDomainDefaultsPrefix + DomainConfigKeyCommentEditingAuthor:     {DefaultValue: "true", Datatype: ConfigDatatypeBool, Section: DynConfigItemSectionComments},
 	ConfigKeyDomainDefaultsPrefix + DomainConfigKeyCommentEditingModerator:  {DefaultValue: "true", Datatype: ConfigDatatypeBool, Section: DynConfigItemSectionComments},
+	ConfigKeyDomainDefaultsPrefix + DomainConfigKeyCommentEditingRemoderate: {DefaultValue: "0", Datatype: ConfigDatatypeInt, Section: DynConfigItemSectionComments, Min: 0, Max: 100},
 	ConfigKeyDomainDefaultsPrefix + DomainConfigKeyEnableCommentVoting:      {DefaultValue: "true", Datatype: ConfigDatatypeBool, Section: DynConfigItemSectionComments},
+	ConfigKeyDomainDefaultsPrefix + DomainConfigKeyFlaggingAnonymous:        {DefaultValue: "false", Datatype: ConfigDatatypeBool, Section: DynConfigItemSectionComments},
+	ConfigKeyDomainDefaultsPrefix + DomainConfigKeyFlaggingEnabled:          {DefaultValue: "true", Datatype: ConfigDatatypeBool, Section: DynConfigItemSectionComments},
+	ConfigKeyDomainDefaultsPrefix + DomainConfigKeyFlaggingThreshold:        {DefaultValue: "3", Datatype: ConfigDatatypeInt, Section: DynConfigItemSectionComments, Min: 0, Max: 1000},
+	ConfigKeyDomainDefaultsPrefix + DomainConfigKeyRateLimitPerIP:           {DefaultValue: "0", Datatype: ConfigDatatypeInt, Section: DynConfigItemSectionComments, Min: 0, Max: 10000},
+	ConfigKeyDomainDefaultsPrefix + DomainConfigKeyRateLimitPerPage:         {DefaultValue: "0", Datatype: ConfigDatatypeInt, Section: DynConfigItemSectionComments, Min: 0, Max: 10000},
+	ConfigKeyDomainDefaultsPrefix + DomainConfigKeyRateLimitPerUser:         {DefaultValue: "0", Datatype: ConfigDatatypeInt, Section: DynConfigItemSectionComments, Min: 0, Max: 10000},
 	ConfigKeyDomainDefaultsPrefix + DomainConfigKeyRSSEnabled:               {DefaultValue: "true", Datatype: ConfigDatatypeBool, Section: DynConfigItemSectionComments},
 	ConfigKeyDomainDefaultsPrefix + DomainConfigKeyShowDeletedComments:      {DefaultValue: "true", Datatype: ConfigDatatypeBool, Section: DynConfigItemSectionComments},
 	ConfigKeyDomainDefaultsPrefix + DomainConfigKeyMaxCommentLength:         {DefaultValue: "4096", Datatype: ConfigDatatypeInt, Section: DynConfigItemSectionComments, Min: 140, Max: 1048576},
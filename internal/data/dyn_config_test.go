@@ -1,6 +1,7 @@
 package data
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -55,3 +56,33 @@ func TestDynConfigItem_AsInt(t *testing.T) {
 		})
 	}
 }
+
+func TestDynConfigDiff(t *testing.T) {
+	items := map[DynConfigItemKey]*DynConfigItem{
+		"a": {Value: "true"},
+		"b": {Value: "42"},
+	}
+	tests := []struct {
+		name       string
+		vals       map[DynConfigItemKey]string
+		wantBefore map[DynConfigItemKey]string
+		wantAfter  map[DynConfigItemKey]string
+	}{
+		{"no values    ", nil, map[DynConfigItemKey]string{}, map[DynConfigItemKey]string{}},
+		{"all unchanged", map[DynConfigItemKey]string{"a": "true", "b": "42"}, map[DynConfigItemKey]string{}, map[DynConfigItemKey]string{}},
+		{"one changed  ", map[DynConfigItemKey]string{"a": "true", "b": "43"}, map[DynConfigItemKey]string{"b": "42"}, map[DynConfigItemKey]string{"b": "43"}},
+		{"all changed  ", map[DynConfigItemKey]string{"a": "false", "b": "0"}, map[DynConfigItemKey]string{"a": "true", "b": "42"}, map[DynConfigItemKey]string{"a": "false", "b": "0"}},
+		{"unknown key  ", map[DynConfigItemKey]string{"c": "foo"}, map[DynConfigItemKey]string{}, map[DynConfigItemKey]string{"c": "foo"}},
+	}
+	for _, tt := range tests {
+		t.Run(strings.TrimSpace(tt.name), func(t *testing.T) {
+			gotBefore, gotAfter := DynConfigDiff(items, tt.vals)
+			if !reflect.DeepEqual(gotBefore, tt.wantBefore) {
+				t.Errorf("DynConfigDiff() before = %v, want %v", gotBefore, tt.wantBefore)
+			}
+			if !reflect.DeepEqual(gotAfter, tt.wantAfter) {
+				t.Errorf("DynConfigDiff() after = %v, want %v", gotAfter, tt.wantAfter)
+			}
+		})
+	}
+}
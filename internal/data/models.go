@@ -1,15 +1,21 @@
 package data
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
+	"encoding/base32"
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"github.com/avct/uasurfer"
 	"github.com/doug-martin/goqu/v9"
 	"github.com/doug-martin/goqu/v9/exp"
 	"github.com/go-openapi/strfmt"
 	"github.com/go-openapi/swag"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/google/uuid"
 	"gitlab.com/comentario/comentario/extend/plugin"
 	"gitlab.com/comentario/comentario/internal/api/exmodels"
@@ -18,6 +24,8 @@ import (
 	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/text/language"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -26,9 +34,11 @@ import (
 var AnonymousUser = &User{Name: "Anonymous", SystemAccount: true}
 
 const (
-	MaxPageTitleLength     = 100 // Maximum length allowed for a page title
-	MaxPendingReasonLength = 255 // Maximum length allowed for Comment.PendingReason field
-	ColourIndexCount       = 60  // Number of colours in the palette used to colourise users based on their IDs
+	MaxPageTitleLength          = 100  // Maximum length allowed for a page title
+	MaxPendingReasonLength      = 255  // Maximum length allowed for Comment.PendingReason field
+	MaxCommentFlagDetailsLength = 255  // Maximum length allowed for CommentFlag.Details field
+	MaxWebhookErrorLength       = 1024 // Maximum length allowed for WebhookDelivery.ResponseError field
+	ColourIndexCount            = 60   // Number of colours in the palette used to colourise users based on their IDs
 )
 
 // DTOAware is an interface capable of converting a model into an API model
@@ -94,6 +104,7 @@ const (
 	TokenScopeConfirmEmail       = TokenScope("confirm-email")        // Bearer makes their account confirmed
 	TokenScopeConfirmEmailUpdate = TokenScope("confirm-email-update") // Bearer confirms updating their email
 	TokenScopeLogin              = TokenScope("login")                // Bearer is eligible for a one-time login
+	TokenScopePasskey            = TokenScope("passkey")              // Bearer can complete a passkey ceremony
 )
 
 // Token is, well, a token
@@ -195,7 +206,13 @@ type User struct {
 	FailedLoginAttempts int            `db:"failed_login_attempts"`                   // Number of failed login attempts
 	IsLocked            bool           `db:"is_locked"`                               // Whether the user is locked out
 	LockedTime          sql.NullTime   `db:"ts_locked"`                               // When the user was locked
+	TOTPSecret          string         `db:"totp_secret"`                             // Base32-encoded TOTP secret, empty if no second factor is set up
+	TOTPEnabled         bool           `db:"totp_enabled"`                            // Whether TOTP two-factor authentication is enabled (i.e. enrolment is confirmed)
+	TOTPEnabledTime     sql.NullTime   `db:"ts_totp_enabled"`                         // When TOTP two-factor authentication was enabled
+	TOTPLastCounter     int64          `db:"totp_last_counter"`                       // Time step counter of the last accepted TOTP code, to prevent code reuse
+	TOTPRecoveryCodes   string         `db:"totp_recovery_codes"`                     // Comma-separated list of SHA-256 hashes of unused recovery codes
 	HasAvatar           bool           `db:"has_avatar" goqu:"skipinsert,skipupdate"` // Whether the user has an avatar image. Calculated field populated only while loading from the DB
+	PersonalToken       *PersonalToken `db:"-"`                                       // Personal token the user has authenticated the current request with, if any
 }
 
 // NewUser instantiates a new User
@@ -297,6 +314,56 @@ func (u *User) IsLocal() bool {
 	return (!u.FederatedIdP.Valid || u.FederatedIdP.String == "") && !u.FederatedSSO
 }
 
+// TOTPProvisioningURI returns an "otpauth://" URI for provisioning the user's TOTP secret into an authenticator app,
+// usually rendered as a QR code
+func (u *User) TOTPProvisioningURI() string {
+	q := url.Values{}
+	q.Set("secret", u.TOTPSecret)
+	q.Set("issuer", util.ApplicationName)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", strconv.Itoa(util.TOTPDigits))
+	q.Set("period", strconv.Itoa(int(util.TOTPPeriod/time.Second)))
+	return fmt.Sprintf("otpauth://totp/%s?%s", url.PathEscape(util.ApplicationName+":"+u.Email), q.Encode())
+}
+
+// TOTPRecoveryCodeCount returns the number of unused recovery codes the user has
+func (u *User) TOTPRecoveryCodeCount() int {
+	if u.TOTPRecoveryCodes == "" {
+		return 0
+	}
+	return len(strings.Split(u.TOTPRecoveryCodes, ","))
+}
+
+// TOTPRecoveryCodesNew generates a new set of recovery codes for the user, replacing any existing ones, and returns
+// them in plain text. Only the codes' hashes are retained
+func (u *User) TOTPRecoveryCodesNew() ([]string, error) {
+	codes := make([]string, util.TOTPRecoveryCodeCount)
+	hashes := make([]string, util.TOTPRecoveryCodeCount)
+	for i := range codes {
+		b, err := util.RandomBytes(5)
+		if err != nil {
+			return nil, err
+		}
+		s := hex.EncodeToString(b)
+		codes[i] = s[:5] + "-" + s[5:]
+		hashes[i] = totpRecoveryCodeHash(s)
+	}
+	u.TOTPRecoveryCodes = strings.Join(hashes, ",")
+	return codes, nil
+}
+
+// TOTPSecretNew generates a new TOTP secret for the user, which is pending until two-factor authentication is enabled
+// with WithTOTPEnabled()
+func (u *User) TOTPSecretNew() error {
+	b, err := util.RandomBytes(20)
+	if err != nil {
+		return err
+	}
+	u.WithTOTPEnabled(false)
+	u.TOTPSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)
+	return nil
+}
+
 // ToCommenter converts this user into a Commenter model
 func (u *User) ToCommenter(isCommenter, isModerator bool) *models.Commenter {
 	return &models.Commenter{
@@ -329,6 +396,7 @@ func (u *User) ToDTO() *models.User {
 		FederatedIDP:        models.FederatedIdpID(u.FederatedIdP.String),
 		FederatedSso:        u.FederatedSSO,
 		HasAvatar:           u.HasAvatar,
+		HasTotp:             u.TOTPEnabled,
 		ID:                  strfmt.UUID(u.ID.String()),
 		IsLocked:            u.IsLocked,
 		IsSuperuser:         u.IsSuperuser,
@@ -366,11 +434,12 @@ func (u *User) ToPluginUser() *plugin.User {
 // ToPrincipal converts this user into a Principal model. attr is the user's attribute map. du is an optional domain
 // user model, which only applies to commenter authentication; should be nil for UI authentication
 func (u *User) ToPrincipal(attr plugin.AttrValues, du *DomainUser) *models.Principal {
-	return &models.Principal{
+	p := &models.Principal{
 		Attributes:          exmodels.KeyValueMap(attr),
 		ColourIndex:         u.ColourIndex(),
 		Email:               strfmt.Email(u.Email),
 		HasAvatar:           u.HasAvatar,
+		HasTotp:             u.TOTPEnabled,
 		ID:                  strfmt.UUID(u.ID.String()),
 		IsCommenter:         du.IsACommenter(),
 		IsConfirmed:         u.Confirmed,
@@ -386,6 +455,10 @@ func (u *User) ToPrincipal(attr plugin.AttrValues, du *DomainUser) *models.Princ
 		NotifyReplies:       du != nil && du.NotifyReplies,
 		WebsiteURL:          strfmt.URI(u.WebsiteURL),
 	}
+	if du != nil {
+		p.DigestMode = du.DigestMode
+	}
+	return p
 }
 
 // VerifyPassword checks whether the provided password matches the hash
@@ -393,6 +466,49 @@ func (u *User) VerifyPassword(s string) bool {
 	return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(s)) == nil
 }
 
+// VerifySecondFactor checks whether the provided code is a valid TOTP code or an unused recovery code, provided the
+// user has two-factor authentication enabled. A matching recovery code gets consumed, so the user needs to be persisted
+// afterwards
+func (u *User) VerifySecondFactor(code string) bool {
+	if !u.TOTPEnabled {
+		return false
+	}
+
+	// Try the code as a TOTP code first
+	if u.VerifyTOTPCode(code) {
+		return true
+	}
+
+	// Try to match the code against recovery codes
+	h := totpRecoveryCodeHash(code)
+	hashes := strings.Split(u.TOTPRecoveryCodes, ",")
+	for i, rh := range hashes {
+		if rh != "" && subtle.ConstantTimeCompare([]byte(rh), []byte(h)) == 1 {
+			// Remove the used code
+			u.TOTPRecoveryCodes = strings.Join(append(hashes[:i], hashes[i+1:]...), ",")
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyTOTPCode checks whether the provided code is a valid TOTP code for the user's secret, and hasn't been used
+// before. It updates TOTPLastCounter on success
+func (u *User) VerifyTOTPCode(code string) bool {
+	// Decode the secret
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(u.TOTPSecret)
+	if err != nil || len(secret) == 0 {
+		return false
+	}
+
+	// Verify the code, rejecting codes not newer than the last accepted one
+	if counter, ok := util.TOTPMatch(secret, strings.TrimSpace(code), time.Now()); ok && counter > u.TOTPLastCounter {
+		u.TOTPLastCounter = counter
+		return true
+	}
+	return false
+}
+
 // WithBanned sets the value of Banned, BannedTime, and UserBanned. byUser can be nil
 func (u *User) WithBanned(b bool, byUser *uuid.UUID) *User {
 	if u.Banned != b {
@@ -540,6 +656,21 @@ func (u *User) WithSuperuser(b bool) *User {
 	return u
 }
 
+// WithTOTPEnabled enables or disables TOTP two-factor authentication for the user. Disabling also discards the secret
+// and recovery codes
+func (u *User) WithTOTPEnabled(b bool) *User {
+	u.TOTPEnabled = b
+	if b {
+		u.TOTPEnabledTime = NowNullable()
+	} else {
+		u.TOTPSecret = ""
+		u.TOTPEnabledTime = sql.NullTime{}
+		u.TOTPLastCounter = 0
+		u.TOTPRecoveryCodes = ""
+	}
+	return u
+}
+
 // WithWebsiteURL sets the WebsiteURL value
 func (u *User) WithWebsiteURL(s string) *User {
 	u.WebsiteURL = s
@@ -678,6 +809,302 @@ func (us *UserSession) ToDTO() *models.UserSession {
 
 // ---------------------------------------------------------------------------------------------------------------------
 
+// PersonalTokenPrefix is the prefix of every personal token value, making such tokens easy to recognise
+const PersonalTokenPrefix = "cmpt_"
+
+// PersonalToken represents a long-lived token a user authenticates API calls with
+type PersonalToken struct {
+	ID           uuid.UUID    `db:"id"         goqu:"skipupdate"` // Unique record ID
+	UserID       uuid.UUID    `db:"user_id"    goqu:"skipupdate"` // Reference to the user owning the token
+	Name         string       `db:"name"`                         // Token name, given by the user
+	ValueHash    string       `db:"value_hash" goqu:"skipupdate"` // SHA-256 hash of the token value, as a hex string
+	Scopes       string       `db:"scopes"`                       // Comma-separated list of granted scopes
+	DomainIDs    string       `db:"domain_ids"`                   // Comma-separated list of IDs of domains the token is restricted to, empty if unrestricted
+	CreatedTime  time.Time    `db:"ts_created" goqu:"skipupdate"` // When the record was created
+	LastUsedTime sql.NullTime `db:"ts_last_used"`                 // When the token was last used
+}
+
+// NewPersonalToken instantiates a new PersonalToken for the given user, returning it along with the generated token
+// value, which is only stored as a hash
+func NewPersonalToken(userID *uuid.UUID) (*PersonalToken, string, error) {
+	b, err := util.RandomBytes(32)
+	if err != nil {
+		return nil, "", err
+	}
+	value := PersonalTokenPrefix + hex.EncodeToString(b)
+	return &PersonalToken{
+			ID:          uuid.New(),
+			UserID:      *userID,
+			ValueHash:   PersonalTokenHash(value),
+			CreatedTime: time.Now().UTC(),
+		},
+		value,
+		nil
+}
+
+// PersonalTokenHash returns the hash of the given personal token value, as a hex string
+func PersonalTokenHash(value string) string {
+	h := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(h[:])
+}
+
+// AllowsDomain returns whether the token can be used for the domain with the given ID
+func (t *PersonalToken) AllowsDomain(id *uuid.UUID) bool {
+	if !t.IsDomainRestricted() {
+		return true
+	}
+	for _, i := range t.DomainIDList() {
+		if i == *id {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsOperation returns whether the token can be used to call an API operation with the given HTTP method and path
+// pattern (relative to the API base path). Reading is allowed with any scope, whereas writing requires a scope covering
+// the path. The user's own profile, tokens, and authentication are never accessible with a personal token
+func (t *PersonalToken) AllowsOperation(method, path string) bool {
+	// Deny access to the user's own stuff
+	if pathHasPrefix(path, "/user") || pathHasPrefix(path, "/auth") {
+		return false
+	}
+
+	// Any scope allows reading
+	if method == http.MethodGet || method == http.MethodHead {
+		return t.Scopes != ""
+	}
+
+	// Writing requires an appropriate scope
+	superuser := t.HasScope(models.PersonalTokenScopeSuperuserDashAdmin)
+	domainAdmin := superuser || t.HasScope(models.PersonalTokenScopeDomainDashAdmin)
+	switch {
+	case pathHasPrefix(path, "/comments"):
+		return domainAdmin || t.HasScope(models.PersonalTokenScopeModerate)
+	case pathHasPrefix(path, "/domains"), pathHasPrefix(path, "/domain-pages"), pathHasPrefix(path, "/domain-users"):
+		return domainAdmin
+	case pathHasPrefix(path, "/users"), pathHasPrefix(path, "/config"):
+		return superuser
+	}
+	return false
+}
+
+// DomainIDList returns the list of IDs of domains the token is restricted to
+func (t *PersonalToken) DomainIDList() []uuid.UUID {
+	var res []uuid.UUID
+	for _, s := range strings.Split(t.DomainIDs, ",") {
+		if id, err := uuid.Parse(strings.TrimSpace(s)); err == nil {
+			res = append(res, id)
+		}
+	}
+	return res
+}
+
+// FromDTO updates this model from an API model. It omits fields that never originate from the DTO:
+//   - ID
+//   - UserID
+//   - ValueHash
+//   - CreatedTime
+//   - LastUsedTime
+func (t *PersonalToken) FromDTO(dto *models.PersonalToken) error {
+	t.Name = TrimmedString(dto.Name)
+	t.WithScopes(dto.Scopes)
+	var ids []uuid.UUID
+	for _, s := range dto.DomainIds {
+		id, err := DecodeUUID(s)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, *id)
+	}
+	t.WithDomainIDs(ids)
+	return nil
+}
+
+// HasScope returns whether the token has been granted the given scope
+func (t *PersonalToken) HasScope(scope models.PersonalTokenScope) bool {
+	for _, s := range t.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsDomainRestricted returns whether the token is restricted to specific domains
+func (t *PersonalToken) IsDomainRestricted() bool {
+	return t.DomainIDs != ""
+}
+
+// ScopeList returns the list of scopes granted to the token
+func (t *PersonalToken) ScopeList() []models.PersonalTokenScope {
+	var res []models.PersonalTokenScope
+	for _, s := range strings.Split(t.Scopes, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			res = append(res, models.PersonalTokenScope(s))
+		}
+	}
+	return res
+}
+
+// ToDTO converts this model into an API model
+func (t *PersonalToken) ToDTO() *models.PersonalToken {
+	var ids []strfmt.UUID
+	for _, id := range t.DomainIDList() {
+		ids = append(ids, strfmt.UUID(id.String()))
+	}
+	return &models.PersonalToken{
+		CreatedTime:  strfmt.DateTime(t.CreatedTime),
+		DomainIds:    ids,
+		ID:           strfmt.UUID(t.ID.String()),
+		LastUsedTime: NullDateTime(t.LastUsedTime),
+		Name:         swag.String(t.Name),
+		Scopes:       t.ScopeList(),
+	}
+}
+
+// WithDomainIDs sets the list of IDs of domains the token is restricted to, ignoring duplicates
+func (t *PersonalToken) WithDomainIDs(ids []uuid.UUID) *PersonalToken {
+	var ss []string
+	for _, id := range ids {
+		if s := id.String(); util.IndexOfString(s, ss) < 0 {
+			ss = append(ss, s)
+		}
+	}
+	t.DomainIDs = strings.Join(ss, ",")
+	return t
+}
+
+// WithScopes sets the list of granted scopes, ignoring duplicates
+func (t *PersonalToken) WithScopes(scopes []models.PersonalTokenScope) *PersonalToken {
+	var ss []string
+	for _, sc := range scopes {
+		if s := string(sc); util.IndexOfString(s, ss) < 0 {
+			ss = append(ss, s)
+		}
+	}
+	t.Scopes = strings.Join(ss, ",")
+	return t
+}
+
+// ---------------------------------------------------------------------------------------------------------------------
+
+// Passkey represents a WebAuthn credential a user can sign in with
+type Passkey struct {
+	ID              uuid.UUID    `db:"id"               goqu:"skipupdate"` // Unique record ID
+	UserID          uuid.UUID    `db:"user_id"          goqu:"skipupdate"` // Reference to the user owning the passkey
+	Name            string       `db:"name"`                               // Passkey name, given by the user
+	CredentialID    []byte       `db:"credential_id"    goqu:"skipupdate"` // Credential ID, as reported by the authenticator
+	PublicKey       []byte       `db:"public_key"       goqu:"skipupdate"` // COSE-encoded credential public key
+	AttestationType string       `db:"attestation_type" goqu:"skipupdate"` // Attestation format reported when the credential was created
+	AAGUID          []byte       `db:"aaguid"           goqu:"skipupdate"` // AAGUID identifying the authenticator model
+	SignCount       int64        `db:"sign_count"`                         // Signature counter value last reported by the authenticator
+	Transports      string       `db:"transports"       goqu:"skipupdate"` // Comma-separated list of transports the authenticator supports
+	BackupEligible  bool         `db:"backup_eligible"  goqu:"skipupdate"` // Whether the credential can be synced between devices
+	BackupState     bool         `db:"backup_state"`                       // Whether the credential is currently synced between devices
+	CreatedTime     time.Time    `db:"ts_created"       goqu:"skipupdate"` // When the record was created
+	LastUsedTime    sql.NullTime `db:"ts_last_used"`                       // When the passkey was last used to sign in
+}
+
+// NewPasskey instantiates a new Passkey for the given user from a freshly created WebAuthn credential
+func NewPasskey(userID *uuid.UUID, name string, cred *webauthn.Credential) *Passkey {
+	var ts []string
+	for _, t := range cred.Transport {
+		ts = append(ts, string(t))
+	}
+	return &Passkey{
+		ID:              uuid.New(),
+		UserID:          *userID,
+		Name:            name,
+		CredentialID:    cred.ID,
+		PublicKey:       cred.PublicKey,
+		AttestationType: cred.AttestationType,
+		AAGUID:          cred.Authenticator.AAGUID,
+		SignCount:       int64(cred.Authenticator.SignCount),
+		Transports:      strings.Join(ts, ","),
+		BackupEligible:  cred.Flags.BackupEligible,
+		BackupState:     cred.Flags.BackupState,
+		CreatedTime:     time.Now().UTC(),
+	}
+}
+
+// Credential converts this passkey into a WebAuthn credential
+func (p *Passkey) Credential() webauthn.Credential {
+	var ts []protocol.AuthenticatorTransport
+	for _, s := range strings.Split(p.Transports, ",") {
+		if s != "" {
+			ts = append(ts, protocol.AuthenticatorTransport(s))
+		}
+	}
+	return webauthn.Credential{
+		ID:              p.CredentialID,
+		PublicKey:       p.PublicKey,
+		AttestationType: p.AttestationType,
+		Transport:       ts,
+		Flags: webauthn.CredentialFlags{
+			UserPresent:    true,
+			UserVerified:   true,
+			BackupEligible: p.BackupEligible,
+			BackupState:    p.BackupState,
+		},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:    p.AAGUID,
+			SignCount: uint32(p.SignCount),
+		},
+	}
+}
+
+// ToDTO converts this model into an API model
+func (p *Passkey) ToDTO() *models.Passkey {
+	return &models.Passkey{
+		CreatedTime:  strfmt.DateTime(p.CreatedTime),
+		ID:           strfmt.UUID(p.ID.String()),
+		LastUsedTime: NullDateTime(p.LastUsedTime),
+		Name:         swag.String(p.Name),
+		Synced:       swag.Bool(p.BackupState),
+	}
+}
+
+// WithCredential updates the passkey's mutable properties from the credential it has just been used with
+func (p *Passkey) WithCredential(cred *webauthn.Credential) *Passkey {
+	p.SignCount = int64(cred.Authenticator.SignCount)
+	p.BackupState = cred.Flags.BackupState
+	p.LastUsedTime = NowNullable()
+	return p
+}
+
+// PasskeyUser adapts a user along with their passkeys to the webauthn.User interface
+type PasskeyUser struct {
+	User     *User      // The user in question
+	Passkeys []*Passkey // Passkeys registered by the user
+}
+
+// WebAuthnCredentials returns the user's passkeys as WebAuthn credentials
+func (u *PasskeyUser) WebAuthnCredentials() []webauthn.Credential {
+	res := make([]webauthn.Credential, len(u.Passkeys))
+	for i, p := range u.Passkeys {
+		res[i] = p.Credential()
+	}
+	return res
+}
+
+// WebAuthnDisplayName returns the user's display name
+func (u *PasskeyUser) WebAuthnDisplayName() string {
+	return u.User.Name
+}
+
+// WebAuthnID returns the user handle, which is the user's ID bytes
+func (u *PasskeyUser) WebAuthnID() []byte {
+	return u.User.ID[:]
+}
+
+// WebAuthnName returns the user's account name, which is their email
+func (u *PasskeyUser) WebAuthnName() string {
+	return u.User.Email
+}
+
+// ---------------------------------------------------------------------------------------------------------------------
+
 // DomainModNotifyPolicy describes moderator notification policy on a specific domain
 type DomainModNotifyPolicy string
 
@@ -688,6 +1115,15 @@ const (
 	DomainModNotifyPolicyAll                           = "all"     // Notify moderators about every comment
 )
 
+// DomainSSOType describes the type of SSO payload accepted on a specific domain
+type DomainSSOType string
+
+//goland:noinspection GoUnusedConst
+const (
+	DomainSSOTypeHMAC DomainSSOType = "hmac" // Hex-encoded JSON payload signed with an HMAC using the domain's SSO secret
+	DomainSSOTypeJWT                = "jwt"  // JSON Web Token signed with the domain's SSO secret or a key from the domain's JWKS
+)
+
 // Domain holds domain configuration
 type Domain struct {
 	ID                uuid.UUID             `db:"id"         goqu:"skipupdate"` // Unique record ID
@@ -702,6 +1138,8 @@ type Domain struct {
 	SSOURL            string                `db:"sso_url"`                      // SSO provider URL
 	SSOSecret         sql.NullString        `db:"sso_secret"`                   // SSO secret as a hex string
 	SSONonInteractive bool                  `db:"sso_noninteractive"`           // Whether to use a non-interactive SSO login
+	SSOType           DomainSSOType         `db:"sso_type"`                     // SSO payload type: 'hmac', 'jwt'
+	SSOJWKSURL        string                `db:"sso_jwks_url"`                 // URL of the JWKS document to verify asymmetrically signed SSO JWTs with
 	ModAnonymous      bool                  `db:"mod_anonymous"`                // Whether all anonymous comments are to be approved by a moderator
 	ModAuthenticated  bool                  `db:"mod_authenticated"`            // Whether all non-anonymous comments are to be approved by a moderator
 	ModNumComments    int                   `db:"mod_num_comments"`             // Number of first comments by user on this domain that require a moderator approval
@@ -769,10 +1207,24 @@ func (d *Domain) FromDTO(dto *models.Domain) {
 	d.ModNumComments = int(dto.ModNumComments)
 	d.ModUserAgeDays = int(dto.ModUserAgeDays)
 	d.Name = dto.Name
+	d.SSOJWKSURL = dto.SsoJwksURL
 	d.SSONonInteractive = dto.SsoNonInteractive
+	d.SSOType = DomainSSOType(dto.SsoType)
 	d.SSOURL = dto.SsoURL
 }
 
+// FromPluginDomain updates this domain from the given plugin domain, ignoring the properties that cannot be changed by
+// a plugin
+func (d *Domain) FromPluginDomain(pd *plugin.Domain) {
+	// ID, Host, CreatedTime, CountComments, and CountViews are immutable
+	d.Name = pd.Name
+	d.IsHTTPS = pd.IsHTTPS
+	d.IsReadonly = pd.IsReadonly
+	d.AuthAnonymous = pd.AuthAnonymous
+	d.AuthLocal = pd.AuthLocal
+	d.AuthSSO = pd.AuthSSO
+}
+
 // RootURL returns the root URL of the domain, without the trailing slash
 func (d *Domain) RootURL() string {
 	return fmt.Sprintf("%s://%s", d.Scheme(), d.Host)
@@ -834,25 +1286,45 @@ func (d *Domain) ToDTO() *models.Domain {
 		ModUserAgeDays:      uint64(d.ModUserAgeDays),
 		Name:                d.Name,
 		RootURL:             strfmt.URI(d.RootURL()),
+		SsoJwksURL:          d.SSOJWKSURL,
 		SsoNonInteractive:   d.SSONonInteractive,
 		SsoSecretConfigured: d.SSOSecret.Valid,
+		SsoType:             models.DomainSsoType(d.SSOType),
 		SsoURL:              d.SSOURL,
 	}
 }
 
+// ToPluginDomain converts this domain into a plugin model
+func (d *Domain) ToPluginDomain() *plugin.Domain {
+	return &plugin.Domain{
+		ID:            d.ID,
+		Name:          d.Name,
+		Host:          d.Host,
+		CreatedTime:   d.CreatedTime,
+		IsHTTPS:       d.IsHTTPS,
+		IsReadonly:    d.IsReadonly,
+		AuthAnonymous: d.AuthAnonymous,
+		AuthLocal:     d.AuthLocal,
+		AuthSSO:       d.AuthSSO,
+		CountComments: d.CountComments,
+		CountViews:    d.CountViews,
+	}
+}
+
 // ---------------------------------------------------------------------------------------------------------------------
 
 // DomainUser represents user configuration in a specific domain
 type DomainUser struct {
-	DomainID            uuid.UUID `db:"domain_id"  goqu:"skipupdate"` // ID of the domain
-	UserID              uuid.UUID `db:"user_id"    goqu:"skipupdate"` // ID of the user
-	IsOwner             bool      `db:"is_owner"`                     // Whether the user is an owner of the domain (assumes is_moderator and is_commenter)
-	IsModerator         bool      `db:"is_moderator"`                 // Whether the user is a moderator of the domain (assumes is_commenter)
-	IsCommenter         bool      `db:"is_commenter"`                 // Whether the user is a commenter of the domain (if false, the user is readonly on the domain)
-	NotifyReplies       bool      `db:"notify_replies"`               // Whether the user is to be notified about replies to their comments
-	NotifyModerator     bool      `db:"notify_moderator"`             // Whether the user is to receive moderator notifications (only when is_moderator is true)
-	NotifyCommentStatus bool      `db:"notify_comment_status"`        // Whether the user is to be notified about status changes (approved/rejected) of their comments
-	CreatedTime         time.Time `db:"ts_created" goqu:"skipupdate"` // When the domain user was created
+	DomainID            uuid.UUID                   `db:"domain_id"  goqu:"skipupdate"` // ID of the domain
+	UserID              uuid.UUID                   `db:"user_id"    goqu:"skipupdate"` // ID of the user
+	IsOwner             bool                        `db:"is_owner"`                     // Whether the user is an owner of the domain (assumes is_moderator and is_commenter)
+	IsModerator         bool                        `db:"is_moderator"`                 // Whether the user is a moderator of the domain (assumes is_commenter)
+	IsCommenter         bool                        `db:"is_commenter"`                 // Whether the user is a commenter of the domain (if false, the user is readonly on the domain)
+	NotifyReplies       bool                        `db:"notify_replies"`               // Whether the user is to be notified about replies to their comments
+	NotifyModerator     bool                        `db:"notify_moderator"`             // Whether the user is to receive moderator notifications (only when is_moderator is true)
+	NotifyCommentStatus bool                        `db:"notify_comment_status"`        // Whether the user is to be notified about status changes (approved/rejected) of their comments
+	DigestMode          models.DomainUserDigestMode `db:"digest_mode"`                  // How email notifications are delivered to the user
+	CreatedTime         time.Time                   `db:"ts_created" goqu:"skipupdate"` // When the domain user was created
 }
 
 // NewDomainUser creates a new DomainUser instance, with all notifications enabled
@@ -866,6 +1338,7 @@ func NewDomainUser(domainID, userID *uuid.UUID, owner, moderator, commenter bool
 		NotifyReplies:       true,
 		NotifyModerator:     true,
 		NotifyCommentStatus: true,
+		DigestMode:          models.DomainUserDigestModeImmediate,
 		CreatedTime:         time.Now().UTC(),
 	}
 }
@@ -933,6 +1406,7 @@ func (du *DomainUser) ToDTO() *models.DomainUser {
 	}
 	return &models.DomainUser{
 		CreatedTime:         strfmt.DateTime(du.CreatedTime),
+		DigestMode:          du.DigestMode,
 		DomainID:            strfmt.UUID(du.DomainID.String()),
 		NotifyCommentStatus: du.NotifyCommentStatus,
 		NotifyModerator:     du.NotifyModerator,
@@ -948,6 +1422,18 @@ func (du *DomainUser) WithCreated(t time.Time) *DomainUser {
 	return du
 }
 
+// WithDigestMode sets the DigestMode value, ignoring any invalid/unknown mode
+func (du *DomainUser) WithDigestMode(m models.DomainUserDigestMode) *DomainUser {
+	switch m {
+	case models.DomainUserDigestModeImmediate,
+		models.DomainUserDigestModeHourly,
+		models.DomainUserDigestModeDaily,
+		models.DomainUserDigestModeWeekly:
+		du.DigestMode = m
+	}
+	return du
+}
+
 // WithNotifyCommentStatus sets the NotifyCommentStatus value
 func (du *DomainUser) WithNotifyCommentStatus(b bool) *DomainUser {
 	du.NotifyCommentStatus = b
@@ -992,15 +1478,16 @@ func (du *DomainUser) WithRole(r models.DomainUserRole) *DomainUser {
 // NullDomainUser is the same as DomainUser, but "optional", ie. having all fields nullable, and with the "du_" column
 // prefix meant for (outer) joins
 type NullDomainUser struct {
-	DomainID            uuid.NullUUID `db:"du_domain_id"`
-	UserID              uuid.NullUUID `db:"du_user_id"`
-	IsOwner             sql.NullBool  `db:"du_is_owner"`
-	IsModerator         sql.NullBool  `db:"du_is_moderator"`
-	IsCommenter         sql.NullBool  `db:"du_is_commenter"`
-	NotifyReplies       sql.NullBool  `db:"du_notify_replies"`
-	NotifyModerator     sql.NullBool  `db:"du_notify_moderator"`
-	NotifyCommentStatus sql.NullBool  `db:"du_notify_comment_status"`
-	CreatedTime         sql.NullTime  `db:"du_ts_created"`
+	DomainID            uuid.NullUUID  `db:"du_domain_id"`
+	UserID              uuid.NullUUID  `db:"du_user_id"`
+	IsOwner             sql.NullBool   `db:"du_is_owner"`
+	IsModerator         sql.NullBool   `db:"du_is_moderator"`
+	IsCommenter         sql.NullBool   `db:"du_is_commenter"`
+	NotifyReplies       sql.NullBool   `db:"du_notify_replies"`
+	NotifyModerator     sql.NullBool   `db:"du_notify_moderator"`
+	NotifyCommentStatus sql.NullBool   `db:"du_notify_comment_status"`
+	DigestMode          sql.NullString `db:"du_digest_mode"`
+	CreatedTime         sql.NullTime   `db:"du_ts_created"`
 }
 
 // ToDomainUser returns either nil if the object is nil or has a null ID, or a new DomainUser with all the field values
@@ -1012,6 +1499,7 @@ func (n *NullDomainUser) ToDomainUser() *DomainUser {
 		WithNotifyReplies(n.NotifyReplies.Bool).
 		WithNotifyModerator(n.NotifyModerator.Bool).
 		WithNotifyCommentStatus(n.NotifyCommentStatus.Bool).
+		WithDigestMode(models.DomainUserDigestMode(n.DigestMode.String)).
 		WithCreated(n.CreatedTime.Time)
 }
 
@@ -1072,6 +1560,18 @@ func (p *DomainPage) ToDTO() *models.DomainPage {
 	}
 }
 
+// ToPluginDomainPage converts this page into a plugin model
+func (p *DomainPage) ToPluginDomainPage() *plugin.DomainPage {
+	return &plugin.DomainPage{
+		ID:          p.ID,
+		DomainID:    p.DomainID,
+		Path:        p.Path,
+		Title:       p.Title,
+		IsReadonly:  p.IsReadonly,
+		CreatedTime: p.CreatedTime,
+	}
+}
+
 // WithIsReadonly sets the IsReadonly value
 func (p *DomainPage) WithIsReadonly(b bool) *DomainPage {
 	p.IsReadonly = b
@@ -1086,6 +1586,42 @@ func (p *DomainPage) WithPath(s string) *DomainPage {
 
 // ---------------------------------------------------------------------------------------------------------------------
 
+// PageSubscription represents a user's subscription to new comments on a whole page or in a comment thread (the
+// subtree starting at a specific comment)
+type PageSubscription struct {
+	ID          uuid.UUID     `db:"id"`         // Unique record ID
+	DomainID    uuid.UUID     `db:"domain_id"`  // Reference to the domain
+	PageID      uuid.UUID     `db:"page_id"`    // Reference to the page
+	UserID      uuid.UUID     `db:"user_id"`    // Reference to the subscribed user
+	ThreadID    uuid.NullUUID `db:"thread_id"`  // Reference to the comment the thread starts at, null for the whole page
+	CreatedTime time.Time     `db:"ts_created"` // When the record was created
+}
+
+// NewPageSubscription instantiates a new PageSubscription. threadID can be nil, in which case the subscription is
+// for the whole page
+func NewPageSubscription(domainID, pageID, userID, threadID *uuid.UUID) *PageSubscription {
+	return &PageSubscription{
+		ID:          uuid.New(),
+		DomainID:    *domainID,
+		PageID:      *pageID,
+		UserID:      *userID,
+		ThreadID:    *PtrToNullUUID(threadID),
+		CreatedTime: time.Now().UTC(),
+	}
+}
+
+// ToDTO converts this model into an API model
+func (s *PageSubscription) ToDTO() *models.PageSubscription {
+	return &models.PageSubscription{
+		CreatedTime: strfmt.DateTime(s.CreatedTime),
+		ID:          strfmt.UUID(s.ID.String()),
+		PageID:      strfmt.UUID(s.PageID.String()),
+		ThreadID:    NullUUIDStr(&s.ThreadID),
+	}
+}
+
+// ---------------------------------------------------------------------------------------------------------------------
+
 // DomainPageView is a domain page view database record
 type DomainPageView struct {
 	PageID         uuid.UUID `db:"page_id"`            // Reference to the page
@@ -1102,6 +1638,35 @@ type DomainPageView struct {
 
 // ---------------------------------------------------------------------------------------------------------------------
 
+// ModerationAction is an action to be taken on a comment as an outcome of automated moderation
+type ModerationAction string
+
+//goland:noinspection GoUnusedConst
+const (
+	ModerationActionNone    ModerationAction = ""        // No action: the comment can be approved right away
+	ModerationActionFlag    ModerationAction = "flag"    // Approve the comment, but retain the reason for moderators' attention
+	ModerationActionPending ModerationAction = "pending" // Put the comment on hold pending moderator approval
+	ModerationActionReject  ModerationAction = "reject"  // Reject the comment straight away
+)
+
+// Outweighs returns whether this action is more severe than the given one
+func (a ModerationAction) Outweighs(other ModerationAction) bool {
+	return a.severity() > other.severity()
+}
+
+// severity returns the numeric severity of the action
+func (a ModerationAction) severity() int {
+	switch a {
+	case ModerationActionFlag:
+		return 1
+	case ModerationActionPending:
+		return 2
+	case ModerationActionReject:
+		return 3
+	}
+	return 0
+}
+
 // Comment represents a comment
 type Comment struct {
 	ID            uuid.UUID     `db:"id"`             // Unique record ID
@@ -1125,7 +1690,10 @@ type Comment struct {
 	PendingReason string        `db:"pending_reason"` // The reason for the pending status
 	AuthorName    string        `db:"author_name"`    // Name of the author, in case the user isn't registered
 	AuthorIP      string        `db:"author_ip"`      // IP address of the author
+	AuthorIPHash  string        `db:"author_ip_hash"` // HMAC of the author's full IP address, used for rate limiting
 	AuthorCountry string        `db:"author_country"` // 2-letter country code matching the AuthorIP
+	AssignedTime  sql.NullTime  `db:"ts_assigned"`    // When the comment was assigned to a moderator
+	UserAssigned  uuid.NullUUID `db:"user_assigned"`  // Reference to the moderator the comment is assigned to
 }
 
 // CloneWithClearance returns a clone of the comment with a limited set of properties, depending on the specified
@@ -1179,6 +1747,19 @@ func (c *Comment) CloneWithClearance(user *User, domainUser *DomainUser) *Commen
 	return cc
 }
 
+// FromPluginComment updates this comment from the given plugin comment, ignoring the properties that cannot be changed
+// by a plugin
+func (c *Comment) FromPluginComment(pc *plugin.Comment) {
+	// ID, ParentID, PageID, Score, IsDeleted, UserCreated, and CreatedTime are immutable
+	c.Markdown = pc.Markdown
+	c.HTML = pc.HTML
+	c.IsSticky = pc.IsSticky
+	c.IsApproved = pc.IsApproved
+	c.IsPending = pc.IsPending
+	c.PendingReason = util.TruncateStr(pc.PendingReason, MaxPendingReasonLength)
+	c.AuthorName = pc.AuthorName
+}
+
 // IsAnonymous returns whether the comment is authored by an anonymous or nonexistent (deleted) commenter
 func (c *Comment) IsAnonymous() bool {
 	return !c.UserCreated.Valid || c.UserCreated.UUID == AnonymousUser.ID
@@ -1197,6 +1778,7 @@ func (c *Comment) IsRoot() bool {
 // NB: leaves the Direction at 0
 func (c *Comment) ToDTO(https bool, host, path string) *models.Comment {
 	return &models.Comment{
+		AssignedTime:  NullDateTime(c.AssignedTime),
 		AuthorCountry: c.AuthorCountry,
 		AuthorIP:      c.AuthorIP,
 		AuthorName:    c.AuthorName,
@@ -1216,6 +1798,7 @@ func (c *Comment) ToDTO(https bool, host, path string) *models.Comment {
 		PendingReason: c.PendingReason,
 		Score:         int64(c.Score),
 		URL:           strfmt.URI(c.URL(https, host, path)),
+		UserAssigned:  NullUUIDStr(&c.UserAssigned),
 		UserCreated:   NullUUIDStr(&c.UserCreated),
 		UserDeleted:   NullUUIDStr(&c.UserDeleted),
 		UserEdited:    NullUUIDStr(&c.UserEdited),
@@ -1223,11 +1806,56 @@ func (c *Comment) ToDTO(https bool, host, path string) *models.Comment {
 	}
 }
 
+// ToPluginComment converts this comment into a plugin model
+func (c *Comment) ToPluginComment() *plugin.Comment {
+	return &plugin.Comment{
+		ID:            c.ID,
+		ParentID:      c.ParentID,
+		PageID:        c.PageID,
+		Markdown:      c.Markdown,
+		HTML:          c.HTML,
+		Score:         c.Score,
+		IsSticky:      c.IsSticky,
+		IsApproved:    c.IsApproved,
+		IsPending:     c.IsPending,
+		IsDeleted:     c.IsDeleted,
+		PendingReason: c.PendingReason,
+		AuthorName:    c.AuthorName,
+		UserCreated:   c.UserCreated,
+		CreatedTime:   c.CreatedTime,
+	}
+}
+
 // URL returns the absolute URL of the comment
 func (c *Comment) URL(https bool, host, path string) string {
 	return fmt.Sprintf("%s://%s%s#comentario-%s", util.If(https, "https", "http"), host, path, c.ID)
 }
 
+// WithDeleted marks the comment deleted by the given user, wiping out its content
+func (c *Comment) WithDeleted(userID *uuid.UUID) *Comment {
+	c.IsDeleted = true
+	c.Markdown = ""
+	c.HTML = ""
+	c.PendingReason = ""
+	c.DeletedTime = NowNullable()
+	c.UserDeleted = uuid.NullUUID{UUID: *userID, Valid: true}
+	return c
+}
+
+// WithModerationAction sets the moderation status values according to the given automated moderation action and its
+// reason. userID is the comment's author, recorded as the moderator in case the comment gets approved
+func (c *Comment) WithModerationAction(userID *uuid.UUID, action ModerationAction, reason string) *Comment {
+	switch action {
+	case ModerationActionPending:
+		return c.WithModerated(nil, true, false, reason)
+	case ModerationActionReject:
+		return c.WithModerated(nil, false, false, reason)
+	case ModerationActionFlag:
+		return c.WithModerated(userID, false, true, reason)
+	}
+	return c.WithModerated(userID, false, true, "")
+}
+
 // WithModerated sets the moderation status values. userID can be nil
 func (c *Comment) WithModerated(userID *uuid.UUID, pending, approved bool, reason string) *Comment {
 	c.IsPending = pending
@@ -1242,6 +1870,118 @@ func (c *Comment) WithModerated(userID *uuid.UUID, pending, approved bool, reaso
 
 // ---------------------------------------------------------------------------------------------------------------------
 
+// CommentBulkAction is an action applied to multiple comments at once
+type CommentBulkAction string
+
+const (
+	CommentBulkActionApprove CommentBulkAction = "approve" // Approve the comments
+	CommentBulkActionReject  CommentBulkAction = "reject"  // Reject the comments
+	CommentBulkActionSpam    CommentBulkAction = "spam"    // Reject the comments as spam
+	CommentBulkActionDelete  CommentBulkAction = "delete"  // Mark the comments deleted
+)
+
+// ---------------------------------------------------------------------------------------------------------------------
+
+// CommentFlagReason is a reason for flagging a comment
+type CommentFlagReason string
+
+const (
+	CommentFlagReasonSpam       CommentFlagReason = "spam"       // Spam or advertising
+	CommentFlagReasonOffensive  CommentFlagReason = "offensive"  // Offensive or inappropriate content
+	CommentFlagReasonHarassment CommentFlagReason = "harassment" // Harassment or personal attack
+	CommentFlagReasonOffTopic   CommentFlagReason = "offTopic"   // Off-topic content
+	CommentFlagReasonOther      CommentFlagReason = "other"      // Any other reason
+)
+
+// CommentFlag represents a user report on a comment
+type CommentFlag struct {
+	ID            uuid.UUID         `db:"id"`             // Unique record ID
+	CommentID     uuid.UUID         `db:"comment_id"`     // Reference to the flagged comment
+	UserID        uuid.NullUUID     `db:"user_id"`        // Reference to the user who flagged the comment
+	Reason        CommentFlagReason `db:"reason"`         // Reason for flagging
+	Details       string            `db:"details"`        // Optional details provided by the user
+	IP            string            `db:"ip"`             // IP address the flag was submitted from
+	IPHash        string            `db:"ip_hash"`        // HMAC of the full IP address the flag was submitted from
+	CreatedTime   time.Time         `db:"ts_created"`     // When the record was created
+	DismissedTime sql.NullTime      `db:"ts_dismissed"`   // When the flag was dismissed by a moderator, null if it's active
+	UserDismissed uuid.NullUUID     `db:"user_dismissed"` // Reference to the user who dismissed the flag
+}
+
+// NewCommentFlag instantiates a new, active CommentFlag for the given comment, submitted by the given user
+func NewCommentFlag(commentID, userID *uuid.UUID, reason CommentFlagReason, details string) *CommentFlag {
+	return &CommentFlag{
+		ID:          uuid.New(),
+		CommentID:   *commentID,
+		UserID:      uuid.NullUUID{UUID: *userID, Valid: true},
+		Reason:      reason,
+		Details:     util.TruncateStr(strings.TrimSpace(details), MaxCommentFlagDetailsLength),
+		CreatedTime: time.Now().UTC(),
+	}
+}
+
+// ToDTO converts this model into an API model. IP address is only included if withIP is true
+func (f *CommentFlag) ToDTO(withIP bool) *models.CommentFlag {
+	return &models.CommentFlag{
+		CommentID:   strfmt.UUID(f.CommentID.String()),
+		CreatedTime: strfmt.DateTime(f.CreatedTime),
+		Details:     f.Details,
+		ID:          strfmt.UUID(f.ID.String()),
+		IP:          util.If(withIP, f.IP, ""),
+		Reason:      models.CommentFlagReason(f.Reason),
+		UserID:      NullUUIDStr(&f.UserID),
+	}
+}
+
+// WithRequest sets the IP address from the given request, masking it if required, and its hash made with the given key
+func (f *CommentFlag) WithRequest(req *http.Request, maskIP bool, ipHashKey []byte) *CommentFlag {
+	f.IP = util.UserIP(req)
+	f.IPHash = util.HashIP(f.IP, ipHashKey)
+	if maskIP {
+		f.IP = util.MaskIP(f.IP)
+	}
+	return f
+}
+
+// ---------------------------------------------------------------------------------------------------------------------
+
+// CommentRevision represents a superseded version of an edited comment's text
+type CommentRevision struct {
+	ID          uuid.UUID     `db:"id"`           // Unique record ID
+	CommentID   uuid.UUID     `db:"comment_id"`   // Reference to the comment
+	Markdown    string        `db:"markdown"`     // Comment text in markdown, as it was in this revision
+	CreatedTime time.Time     `db:"ts_created"`   // When the revision was authored
+	UserCreated uuid.NullUUID `db:"user_created"` // Reference to the user who authored the revision
+}
+
+// NewCommentRevision instantiates a new CommentRevision holding the current text of the given comment, attributed to
+// the user who last edited the comment or, if it's never been edited, to its author
+func NewCommentRevision(c *Comment) *CommentRevision {
+	r := &CommentRevision{
+		ID:          uuid.New(),
+		CommentID:   c.ID,
+		Markdown:    c.Markdown,
+		CreatedTime: c.CreatedTime,
+		UserCreated: c.UserCreated,
+	}
+	if c.EditedTime.Valid {
+		r.CreatedTime = c.EditedTime.Time
+		r.UserCreated = c.UserEdited
+	}
+	return r
+}
+
+// ToDTO converts this model into an API model. number is the 1-based number of the revision
+func (r *CommentRevision) ToDTO(number int) *models.CommentRevision {
+	return &models.CommentRevision{
+		CreatedTime: strfmt.DateTime(r.CreatedTime),
+		Markdown:    r.Markdown,
+		Number:      int64(number),
+		UserCreated: NullUUIDStr(&r.UserCreated),
+	}
+}
+
+// ---------------------------------------------------------------------------------------------------------------------
+
 // CommentVote represents a comment vote database record
 type CommentVote struct {
 	CommentID  uuid.UUID `db:"comment_id" goqu:"skipupdate"` // Reference to the comment
@@ -1301,22 +2041,38 @@ func (de *DomainExtension) ToDTO() *models.DomainExtension {
 	}
 }
 
-// DomainExtensions is a map of known domain extensions and their default configurations. All disabled initially
+// IDs of built-in domain extensions
+const (
+	DomainExtensionIDLocalRules             models.DomainExtensionID = "localRules"
+	DomainExtensionIDAkismet                models.DomainExtensionID = "akismet"
+	DomainExtensionIDPerspective            models.DomainExtensionID = "perspective"
+	DomainExtensionIDAPILayerDotSpamChecker models.DomainExtensionID = "apiLayer.spamChecker"
+)
+
+// DomainExtensions is a map of known domain extensions and their default configurations. All disabled initially.
+// Extensions provided by plugins get added to the map on startup
 var DomainExtensions = map[models.DomainExtensionID]*DomainExtension{
-	models.DomainExtensionIDAkismet: {
-		ID:          models.DomainExtensionIDAkismet,
+	DomainExtensionIDLocalRules: {
+		ID:   DomainExtensionIDLocalRules,
+		Name: "Local rules",
+		Config: "#blockedWords=word1,word2\n#blockedWords.action=reject\n#blockedRegex=(?i)buy\\s+now\n#maxLinks=3\n" +
+			"#maxRepeatedChars=10\n#maxRepeatedChars.action=flag\n#maxCapsRatio=0.7\n#maxCapsRatio.action=flag\n" +
+			"#languages=en,de\n#maxPerIPPerHour=10\n#maxPerUserPerHour=20",
+	},
+	DomainExtensionIDAkismet: {
+		ID:          DomainExtensionIDAkismet,
 		Name:        "Akismet",
 		Config:      "#apiKey=...",
 		KeyRequired: true,
 	},
-	models.DomainExtensionIDPerspective: {
-		ID:          models.DomainExtensionIDPerspective,
+	DomainExtensionIDPerspective: {
+		ID:          DomainExtensionIDPerspective,
 		Name:        "Perspective",
 		Config:      "#apiKey=...\ntoxicity=0.5\nsevereToxicity=0.5\nidentityAttack=0.5\ninsult=0.5\nprofanity=0.5\nthreat=0.5",
 		KeyRequired: true,
 	},
-	models.DomainExtensionIDAPILayerDotSpamChecker: {
-		ID:          models.DomainExtensionIDAPILayerDotSpamChecker,
+	DomainExtensionIDAPILayerDotSpamChecker: {
+		ID:          DomainExtensionIDAPILayerDotSpamChecker,
 		Name:        "APILayer SpamChecker",
 		Config:      "#apiKey=...\nthreshold=5",
 		KeyRequired: true,
@@ -1331,3 +2087,670 @@ type DomainExtensionConfig struct {
 	ExtensionID models.DomainExtensionID `db:"extension_id"` // Extension ID
 	Config      string                   `db:"config"`       // Extension configuration parameters
 }
+
+// ---------------------------------------------------------------------------------------------------------------------
+
+// DomainRoleRuleIdPSSO is the identity provider ID a domain role rule uses to refer to the domain's SSO
+const DomainRoleRuleIdPSSO = "sso"
+
+// DomainRoleRule is a rule mapping a claim reported by a federated identity provider onto a role on a domain
+type DomainRoleRule struct {
+	ID          uuid.UUID             `db:"id"           goqu:"skipupdate"` // Unique record ID
+	DomainID    uuid.UUID             `db:"domain_id"    goqu:"skipupdate"` // Reference to the domain
+	SortOrder   int                   `db:"sort_order"`                     // Position of the rule in the domain's rule list
+	IdPID       string                `db:"idp_id"`                         // ID of the identity provider the rule applies to ("sso" for SSO), empty for any provider
+	Claim       string                `db:"claim"`                          // Name of (or dot-separated path to) the claim to examine
+	Value       string                `db:"value"`                          // Value the claim must have (or contain, if it's an array)
+	Role        models.DomainUserRole `db:"role"`                           // Role to grant to the user
+	CreatedTime time.Time             `db:"ts_created"   goqu:"skipupdate"` // When the record was created
+	UserCreated uuid.NullUUID         `db:"user_created" goqu:"skipupdate"` // Reference to the user who created the record
+}
+
+// NewDomainRoleRule instantiates a new DomainRoleRule for the given domain
+func NewDomainRoleRule(domainID, userID *uuid.UUID, sortOrder int) *DomainRoleRule {
+	return &DomainRoleRule{
+		ID:          uuid.New(),
+		DomainID:    *domainID,
+		SortOrder:   sortOrder,
+		CreatedTime: time.Now().UTC(),
+		UserCreated: uuid.NullUUID{UUID: *userID, Valid: true},
+	}
+}
+
+// FromDTO updates this model from an API model. It omits fields that never originate from the DTO:
+//   - ID
+//   - DomainID
+//   - SortOrder
+//   - CreatedTime
+//   - UserCreated
+func (r *DomainRoleRule) FromDTO(dto *models.DomainRoleRule) {
+	r.IdPID = dto.IdpID
+	r.Claim = strings.TrimSpace(swag.StringValue(dto.Claim))
+	r.Value = dto.Value
+	r.Role = dto.Role
+}
+
+// Matches returns whether the rule applies to a user authenticated via the identity provider with the given ID ("sso"
+// for SSO) and having the given claims
+func (r *DomainRoleRule) Matches(idpID string, claims map[string]any) bool {
+	// Check the identity provider
+	if r.IdPID != "" && r.IdPID != idpID {
+		return false
+	}
+
+	// Walk down the claim path
+	var v any = claims
+	for _, name := range strings.Split(r.Claim, ".") {
+		if m, ok := v.(map[string]any); !ok {
+			return false
+		} else if v, ok = m[name]; !ok {
+			return false
+		}
+	}
+
+	// Compare the value, or, in case of an array, each of its elements
+	switch cv := v.(type) {
+	case []any:
+		for _, e := range cv {
+			if claimValueEquals(e, r.Value) {
+				return true
+			}
+		}
+		return false
+	case []string:
+		return util.IndexOfString(r.Value, cv) >= 0
+	}
+	return claimValueEquals(v, r.Value)
+}
+
+// ToDTO converts this model into an API model
+func (r *DomainRoleRule) ToDTO() *models.DomainRoleRule {
+	return &models.DomainRoleRule{
+		Claim: swag.String(r.Claim),
+		ID:    strfmt.UUID(r.ID.String()),
+		IdpID: r.IdPID,
+		Role:  r.Role,
+		Value: r.Value,
+	}
+}
+
+// MatchDomainRoleRules returns the first of the given rules that matches a user authenticated via the identity provider
+// with the given ID ("sso" for SSO) and having the given claims, or nil if there's none
+func MatchDomainRoleRules(rules []*DomainRoleRule, idpID string, claims map[string]any) *DomainRoleRule {
+	for _, r := range rules {
+		if r.Matches(idpID, claims) {
+			return r
+		}
+	}
+	return nil
+}
+
+// claimValueEquals returns whether the given scalar claim value, in its string form, equals s
+func claimValueEquals(v any, s string) bool {
+	switch cv := v.(type) {
+	case nil, map[string]any, []any:
+		return false
+	case string:
+		return cv == s
+	}
+	return fmt.Sprint(v) == s
+}
+
+// ---------------------------------------------------------------------------------------------------------------------
+
+// DomainWebhook represents an outgoing webhook registered for a domain
+type DomainWebhook struct {
+	ID          uuid.UUID     `db:"id"           goqu:"skipupdate"` // Unique record ID
+	DomainID    uuid.UUID     `db:"domain_id"    goqu:"skipupdate"` // Reference to the domain
+	URL         string        `db:"url"`                            // URL of the endpoint to deliver events to
+	Secret      string        `db:"secret"`                         // Secret used to sign payloads, as a hex string
+	Events      string        `db:"events"`                         // Comma-separated list of subscribed event types
+	IsActive    bool          `db:"is_active"`                      // Whether the webhook is active
+	CreatedTime time.Time     `db:"ts_created"   goqu:"skipupdate"` // When the record was created
+	UserCreated uuid.NullUUID `db:"user_created" goqu:"skipupdate"` // Reference to the user who created the record
+}
+
+// NewDomainWebhook instantiates a new DomainWebhook for the given domain, with a freshly generated secret
+func NewDomainWebhook(domainID, userID *uuid.UUID) (*DomainWebhook, error) {
+	wh := &DomainWebhook{
+		ID:          uuid.New(),
+		DomainID:    *domainID,
+		IsActive:    true,
+		CreatedTime: time.Now().UTC(),
+		UserCreated: uuid.NullUUID{UUID: *userID, Valid: true},
+	}
+	if err := wh.SecretNew(); err != nil {
+		return nil, err
+	}
+	return wh, nil
+}
+
+// EventList returns the list of event types the webhook is subscribed to
+func (wh *DomainWebhook) EventList() []models.WebhookEventType {
+	var res []models.WebhookEventType
+	for _, s := range strings.Split(wh.Events, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			res = append(res, models.WebhookEventType(s))
+		}
+	}
+	return res
+}
+
+// FromDTO updates this model from an API model. It omits fields that never originate from the DTO:
+//   - ID
+//   - DomainID
+//   - Secret
+//   - CreatedTime
+//   - UserCreated
+func (wh *DomainWebhook) FromDTO(dto *models.DomainWebhook) {
+	wh.IsActive = dto.Active
+	wh.URL = strings.TrimSpace(URIPtrToString(dto.URL))
+	wh.WithEvents(dto.Events)
+}
+
+// HasEvent returns whether the webhook is subscribed to the given event type
+func (wh *DomainWebhook) HasEvent(event models.WebhookEventType) bool {
+	for _, e := range wh.EventList() {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// SecretNew generates a new signing secret for the webhook
+func (wh *DomainWebhook) SecretNew() error {
+	b, err := util.RandomBytes(32)
+	if err != nil {
+		return err
+	}
+	wh.Secret = hex.EncodeToString(b)
+	return nil
+}
+
+// ToDTO converts this model into an API model. The secret is only included if withSecret is true
+func (wh *DomainWebhook) ToDTO(withSecret bool) *models.DomainWebhook {
+	return &models.DomainWebhook{
+		Active:      wh.IsActive,
+		CreatedTime: strfmt.DateTime(wh.CreatedTime),
+		DomainID:    strfmt.UUID(wh.DomainID.String()),
+		Events:      wh.EventList(),
+		ID:          strfmt.UUID(wh.ID.String()),
+		Secret:      util.If(withSecret, wh.Secret, ""),
+		URL:         (*strfmt.URI)(&wh.URL),
+		UserCreated: NullUUIDStr(&wh.UserCreated),
+	}
+}
+
+// WithEvents sets the list of subscribed event types, ignoring duplicates
+func (wh *DomainWebhook) WithEvents(events []models.WebhookEventType) *DomainWebhook {
+	var ss []string
+	for _, e := range events {
+		if s := string(e); util.IndexOfString(s, ss) < 0 {
+			ss = append(ss, s)
+		}
+	}
+	wh.Events = strings.Join(ss, ",")
+	return wh
+}
+
+// ---------------------------------------------------------------------------------------------------------------------
+
+// WebhookDeliveryStatus is the status of a webhook delivery
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryStatusPending   WebhookDeliveryStatus = "pending"   // Delivery is queued and awaits a (next) attempt
+	WebhookDeliveryStatusSucceeded WebhookDeliveryStatus = "succeeded" // Payload has been delivered successfully
+	WebhookDeliveryStatusFailed    WebhookDeliveryStatus = "failed"    // All delivery attempts have been exhausted
+)
+
+// WebhookDelivery represents a single delivery of an event payload to a webhook. It serves as both a retry queue
+// entry and a delivery log record
+type WebhookDelivery struct {
+	ID              uuid.UUID               `db:"id"         goqu:"skipupdate"` // Unique record ID
+	WebhookID       uuid.UUID               `db:"webhook_id" goqu:"skipupdate"` // Reference to the webhook
+	Event           models.WebhookEventType `db:"event"      goqu:"skipupdate"` // Event type
+	Payload         string                  `db:"payload"    goqu:"skipupdate"` // JSON payload to deliver
+	Status          WebhookDeliveryStatus   `db:"status"`                       // Delivery status
+	Attempts        int                     `db:"attempts"`                     // Number of delivery attempts made so far
+	CreatedTime     time.Time               `db:"ts_created" goqu:"skipupdate"` // When the record was created
+	NextAttemptTime time.Time               `db:"ts_next_attempt"`              // When the next delivery attempt is due
+	LastAttemptTime sql.NullTime            `db:"ts_last_attempt"`              // When the last delivery attempt was made
+	ResponseCode    int                     `db:"response_code"`                // HTTP status code of the last response, 0 if none
+	ResponseError   string                  `db:"response_error"`               // Error of the last failed attempt
+}
+
+// NewWebhookDelivery instantiates a new, pending WebhookDelivery, due immediately
+func NewWebhookDelivery(webhookID *uuid.UUID, event models.WebhookEventType, payload string) *WebhookDelivery {
+	now := time.Now().UTC()
+	return &WebhookDelivery{
+		ID:              uuid.New(),
+		WebhookID:       *webhookID,
+		Event:           event,
+		Payload:         payload,
+		Status:          WebhookDeliveryStatusPending,
+		CreatedTime:     now,
+		NextAttemptTime: now,
+	}
+}
+
+// ToDTO converts this model into an API model
+func (wd *WebhookDelivery) ToDTO() *models.WebhookDelivery {
+	return &models.WebhookDelivery{
+		Attempts:        int64(wd.Attempts),
+		CreatedTime:     strfmt.DateTime(wd.CreatedTime),
+		Event:           wd.Event,
+		ID:              strfmt.UUID(wd.ID.String()),
+		LastAttemptTime: NullDateTime(wd.LastAttemptTime),
+		NextAttemptTime: strfmt.DateTime(wd.NextAttemptTime),
+		Payload:         wd.Payload,
+		ResponseCode:    int64(wd.ResponseCode),
+		ResponseError:   wd.ResponseError,
+		Status:          models.WebhookDeliveryStatus(wd.Status),
+		WebhookID:       strfmt.UUID(wd.WebhookID.String()),
+	}
+}
+
+// WithAttempt registers the outcome of a delivery attempt: respCode is the received HTTP status code (0 if none), err
+// is the error that occurred, if any. Once the maximum number of attempts is reached, the delivery is marked failed,
+// otherwise the next attempt is scheduled with an exponential backoff
+func (wd *WebhookDelivery) WithAttempt(respCode int, err error) *WebhookDelivery {
+	now := time.Now().UTC()
+	wd.Attempts++
+	wd.LastAttemptTime = sql.NullTime{Time: now, Valid: true}
+	wd.ResponseCode = respCode
+	wd.ResponseError = ""
+	switch {
+	case err == nil:
+		wd.Status = WebhookDeliveryStatusSucceeded
+	case wd.Attempts >= util.WebhookMaxDeliveryAttempts:
+		wd.ResponseError = util.TruncateStr(err.Error(), MaxWebhookErrorLength)
+		wd.Status = WebhookDeliveryStatusFailed
+	default:
+		wd.ResponseError = util.TruncateStr(err.Error(), MaxWebhookErrorLength)
+		wd.NextAttemptTime = now.Add(WebhookRetryDelay(wd.Attempts))
+	}
+	return wd
+}
+
+// WebhookRetryDelay returns the delay before the next delivery attempt, given the number of attempts already made. The
+// delay doubles with every attempt, starting at util.WebhookRetryBaseDelay and capped at util.WebhookRetryMaxDelay
+func WebhookRetryDelay(attempts int) time.Duration {
+	d := util.WebhookRetryBaseDelay
+	for i := 1; i < attempts; i++ {
+		if d *= 2; d >= util.WebhookRetryMaxDelay {
+			return util.WebhookRetryMaxDelay
+		}
+	}
+	return d
+}
+
+// ---------------------------------------------------------------------------------------------------------------------
+
+// ImportReportItemKind is the kind of an import report item
+type ImportReportItemKind string
+
+const (
+	ImportReportItemKindCommentDuplicate ImportReportItemKind = "commentDuplicate" // Comment skipped as a duplicate of an existing one
+	ImportReportItemKindCommentOrphaned  ImportReportItemKind = "commentOrphaned"  // Comment whose parent is missing, imported as a root one
+	ImportReportItemKindInvalidDate      ImportReportItemKind = "invalidDate"      // Comment with an invalid creation date, replaced with the import time
+	ImportReportItemKindInvalidEmail     ImportReportItemKind = "invalidEmail"     // Comment author with an invalid email, imported as an unregistered one
+	ImportReportItemKindPageAdded        ImportReportItemKind = "pageAdded"        // Domain page added
+	ImportReportItemKindUserAdded        ImportReportItemKind = "userAdded"        // User added
+	ImportReportItemKindUserMatched      ImportReportItemKind = "userMatched"      // User matched by email to an existing one
+)
+
+// ImportReportItem is a single detail of an import report
+type ImportReportItem struct {
+	Kind    ImportReportItemKind `json:"kind"`              // Item kind
+	Ref     string               `json:"ref"`               // Reference to the item: source comment ID, user email, or page path
+	Details string               `json:"details,omitempty"` // Optional details, such as the offending value
+}
+
+// ToDTO converts the item to an API model
+func (ri *ImportReportItem) ToDTO() *models.ImportReportItem {
+	return &models.ImportReportItem{
+		Details: ri.Details,
+		Kind:    models.ImportReportItemKind(ri.Kind),
+		Ref:     ri.Ref,
+	}
+}
+
+// ImportResult is the result of a comment import
+type ImportResult struct {
+	UsersTotal         int    `db:"users_total"`          // Total number of users
+	UsersAdded         int    `db:"users_added"`          // Number of added users
+	UsersMatched       int    `db:"users_matched"`        // Number of users matched by email to existing ones
+	DomainUsersAdded   int    `db:"domain_users_added"`   // Number of added domain users
+	PagesTotal         int    `db:"pages_total"`          // Total number of domain pages
+	PagesAdded         int    `db:"pages_added"`          // Number of added domain pages
+	CommentsTotal      int    `db:"comments_total"`       // Total number of comments processed
+	CommentsImported   int    `db:"comments_imported"`    // Number of imported comments
+	CommentsSkipped    int    `db:"comments_skipped"`     // Number of skipped comments
+	CommentsNonDeleted int    `db:"comments_non_deleted"` // Number of non-deleted imported comments
+	CommentsDuplicate  int    `db:"comments_duplicate"`   // Number of comments skipped as duplicates of existing ones
+	CommentsOrphaned   int    `db:"comments_orphaned"`    // Number of comments whose parent is missing, imported as root ones
+	InvalidDates       int    `db:"invalid_dates"`        // Number of comments with an invalid creation date
+	InvalidEmails      int    `db:"invalid_emails"`       // Number of comment authors with an invalid email
+	ReportItems        string `db:"report_items"`         // JSON array of ImportReportItem
+	Error              string `db:"error_text"`           // Any error occurred during the import
+}
+
+// Items returns the result's report items
+func (ir *ImportResult) Items() []ImportReportItem {
+	var items []ImportReportItem
+	if ir.ReportItems != "" {
+		if err := json.Unmarshal([]byte(ir.ReportItems), &items); err != nil {
+			return nil
+		}
+	}
+	return items
+}
+
+// ToDTO converts the result to an API model
+func (ir *ImportResult) ToDTO() *models.ImportResult {
+	items := ir.Items()
+	dtoItems := make([]*models.ImportReportItem, len(items))
+	for i := range items {
+		dtoItems[i] = items[i].ToDTO()
+	}
+	return &models.ImportResult{
+		CommentsDuplicate:  uint64(ir.CommentsDuplicate),
+		CommentsImported:   uint64(ir.CommentsImported),
+		CommentsNonDeleted: uint64(ir.CommentsNonDeleted),
+		CommentsOrphaned:   uint64(ir.CommentsOrphaned),
+		CommentsSkipped:    uint64(ir.CommentsSkipped),
+		CommentsTotal:      uint64(ir.CommentsTotal),
+		DomainUsersAdded:   uint64(ir.DomainUsersAdded),
+		Error:              ir.Error,
+		InvalidDates:       uint64(ir.InvalidDates),
+		InvalidEmails:      uint64(ir.InvalidEmails),
+		Items:              dtoItems,
+		PagesAdded:         uint64(ir.PagesAdded),
+		PagesTotal:         uint64(ir.PagesTotal),
+		UsersAdded:         uint64(ir.UsersAdded),
+		UsersMatched:       uint64(ir.UsersMatched),
+		UsersTotal:         uint64(ir.UsersTotal),
+	}
+}
+
+// WithItems sets the result's report items
+func (ir *ImportResult) WithItems(items []ImportReportItem) *ImportResult {
+	ir.ReportItems = ""
+	if len(items) > 0 {
+		if b, err := json.Marshal(items); err == nil {
+			ir.ReportItems = string(b)
+		}
+	}
+	return ir
+}
+
+// ImportJobStatus is the status of an import job
+type ImportJobStatus string
+
+const (
+	ImportJobStatusRunning   ImportJobStatus = "running"   // Job is running, or is to be resumed
+	ImportJobStatusCompleted ImportJobStatus = "completed" // All data has been processed
+	ImportJobStatusFailed    ImportJobStatus = "failed"    // Job has been aborted due to an error
+	ImportJobStatusCancelled ImportJobStatus = "cancelled" // Job has been cancelled by a user
+)
+
+// ImportJob represents a comment import running in the background. Import counters are updated as the job progresses
+type ImportJob struct {
+	ID               uuid.UUID       `db:"id"           goqu:"skipupdate"` // Unique record ID
+	DomainID         uuid.UUID       `db:"domain_id"    goqu:"skipupdate"` // Reference to the domain the data is imported into
+	UserCreated      uuid.UUID       `db:"user_created" goqu:"skipupdate"` // Reference to the user who started the import
+	Source           string          `db:"source"       goqu:"skipupdate"` // Source of the data
+	DryRun           bool            `db:"dry_run"      goqu:"skipupdate"` // Whether the job only reports what would be imported, without writing anything
+	FileName         string          `db:"file_name"    goqu:"skipupdate"` // Path to the stored data file
+	FileSize         int64           `db:"file_size"    goqu:"skipupdate"` // Size of the data file in bytes
+	Status           ImportJobStatus `db:"status"`                         // Job status
+	CreatedTime      time.Time       `db:"ts_created"   goqu:"skipupdate"` // When the record was created
+	UpdatedTime      time.Time       `db:"ts_updated"`                     // When the job's progress was last updated
+	FinishedTime     sql.NullTime    `db:"ts_finished"`                    // When the job finished, null if it's still running
+	BytesRead        int64           `db:"bytes_read"`                     // Number of bytes of the data file processed so far
+	RecordsCommitted int             `db:"records_committed"`              // Number of leading source records completely processed
+	OwnerID          uuid.NullUUID   `db:"owner_id"     goqu:"skipupdate"` // ID of the server instance running the job
+	HeartbeatTime    sql.NullTime    `db:"ts_heartbeat" goqu:"skipupdate"` // When the owner last renewed its lease on the job
+	ImportResult                     // Import counters
+}
+
+// NewImportJob instantiates a new, running ImportJob
+func NewImportJob(domainID, userID *uuid.UUID, source string) *ImportJob {
+	now := time.Now().UTC()
+	return &ImportJob{
+		ID:          uuid.New(),
+		DomainID:    *domainID,
+		UserCreated: *userID,
+		Source:      source,
+		Status:      ImportJobStatusRunning,
+		CreatedTime: now,
+		UpdatedTime: now,
+	}
+}
+
+// IsRunning returns whether the job is still running
+func (j *ImportJob) IsRunning() bool {
+	return j.Status == ImportJobStatusRunning
+}
+
+// ToDTO converts this model into an API model
+func (j *ImportJob) ToDTO() *models.ImportJob {
+	return &models.ImportJob{
+		BytesRead:    j.BytesRead,
+		CreatedTime:  strfmt.DateTime(j.CreatedTime),
+		DomainID:     strfmt.UUID(j.DomainID.String()),
+		DryRun:       j.DryRun,
+		FileSize:     j.FileSize,
+		FinishedTime: NullDateTime(j.FinishedTime),
+		ID:           strfmt.UUID(j.ID.String()),
+		Result:       j.ImportResult.ToDTO(),
+		Source:       j.Source,
+		Status:       models.ImportJobStatus(j.Status),
+		UpdatedTime:  strfmt.DateTime(j.UpdatedTime),
+		UserCreated:  strfmt.UUID(j.UserCreated.String()),
+	}
+}
+
+// WithDryRun sets the dry-run flag
+func (j *ImportJob) WithDryRun(b bool) *ImportJob {
+	j.DryRun = b
+	return j
+}
+
+// WithFile sets the data file properties
+func (j *ImportJob) WithFile(fileName string, fileSize int64) *ImportJob {
+	j.FileName = fileName
+	j.FileSize = fileSize
+	return j
+}
+
+// WithOwner makes the server instance with the given ID the job's owner, renewing its lease
+func (j *ImportJob) WithOwner(id *uuid.UUID) *ImportJob {
+	j.OwnerID = uuid.NullUUID{UUID: *id, Valid: true}
+	j.HeartbeatTime = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+	return j
+}
+
+// WithFinished marks the job finished with the given status and error (if any)
+func (j *ImportJob) WithFinished(status ImportJobStatus, err error) *ImportJob {
+	now := time.Now().UTC()
+	j.Status = status
+	j.UpdatedTime = now
+	j.FinishedTime = sql.NullTime{Time: now, Valid: true}
+	if err != nil {
+		j.Error = err.Error()
+	}
+	return j
+}
+
+// ---------------------------------------------------------------------------------------------------------------------
+
+// AuditAction is an administrative or moderation action recorded in the audit log
+type AuditAction string
+
+const (
+	AuditActionCommentBulk      AuditAction = "comment.bulk"      // Comments moderated or deleted in bulk
+	AuditActionCommentDelete    AuditAction = "comment.delete"    // Comment deleted by someone other than its author
+	AuditActionCommentFlags     AuditAction = "comment.flags"     // Comment's flags dismissed
+	AuditActionCommentModerate  AuditAction = "comment.moderate"  // Comment approved, rejected, or set to pending
+	AuditActionConfigReset      AuditAction = "config.reset"      // Instance configuration reset to defaults
+	AuditActionConfigUpdate     AuditAction = "config.update"     // Instance configuration updated
+	AuditActionDomainClear      AuditAction = "domain.clear"      // Domain's users, pages, and comments removed
+	AuditActionDomainDelete     AuditAction = "domain.delete"     // Domain deleted
+	AuditActionDomainImport     AuditAction = "domain.import"     // Data imported into domain
+	AuditActionDomainPurge      AuditAction = "domain.purge"      // Domain's comments purged
+	AuditActionDomainReadonly   AuditAction = "domain.readonly"   // Domain's readonly status changed
+	AuditActionDomainRoleRules  AuditAction = "domain.roleRules"  // Domain's role rules updated
+	AuditActionDomainSSOSecret  AuditAction = "domain.ssoSecret"  // Domain's SSO secret regenerated
+	AuditActionDomainUpdate     AuditAction = "domain.update"     // Domain properties or configuration updated
+	AuditActionDomainUserUpdate AuditAction = "domainUser.update" // Domain user's role changed
+	AuditActionUserBan          AuditAction = "user.ban"          // User banned or unbanned
+	AuditActionUserDelete       AuditAction = "user.delete"       // User deleted
+	AuditActionUserTOTPReset    AuditAction = "user.totpReset"    // User's two-factor authentication reset
+	AuditActionUserUnlock       AuditAction = "user.unlock"       // Locked user unlocked
+	AuditActionUserUpdate       AuditAction = "user.update"       // User properties updated
+)
+
+// AuditEntry is a record in the append-only audit log
+type AuditEntry struct {
+	ID          uuid.UUID     `db:"id"`           // Unique record ID
+	CreatedTime time.Time     `db:"ts_created"`   // When the record was created
+	UserID      uuid.NullUUID `db:"user_id"`      // ID of the user who performed the action, null if it was the system
+	Action      AuditAction   `db:"action"`       // Action performed
+	DomainID    uuid.NullUUID `db:"domain_id"`    // ID of the domain the action relates to, if any
+	TargetID    uuid.NullUUID `db:"target_id"`    // ID of the object affected by the action (user, comment, ...), if any
+	ValueBefore string        `db:"value_before"` // JSON representation of the affected values before the action
+	ValueAfter  string        `db:"value_after"`  // JSON representation of the affected values after the action
+	IP          string        `db:"ip"`           // IP address the action was requested from, if any
+}
+
+// NewAuditEntry instantiates a new AuditEntry for the given action. userID is the user who performed the action, nil
+// if it was the system
+func NewAuditEntry(action AuditAction, userID *uuid.UUID) *AuditEntry {
+	return &AuditEntry{
+		ID:          uuid.New(),
+		CreatedTime: time.Now().UTC(),
+		UserID:      *PtrToNullUUID(userID),
+		Action:      action,
+	}
+}
+
+// ToDTO converts this model into an API model
+func (e *AuditEntry) ToDTO() *models.AuditEntry {
+	return &models.AuditEntry{
+		Action:      models.AuditAction(e.Action),
+		After:       e.ValueAfter,
+		Before:      e.ValueBefore,
+		CreatedTime: strfmt.DateTime(e.CreatedTime),
+		DomainID:    NullUUIDStr(&e.DomainID),
+		ID:          strfmt.UUID(e.ID.String()),
+		IP:          e.IP,
+		TargetID:    NullUUIDStr(&e.TargetID),
+		UserID:      NullUUIDStr(&e.UserID),
+	}
+}
+
+// WithChange sets the values affected by the action, before and after it. Either can be nil, otherwise it's stored
+// as JSON
+func (e *AuditEntry) WithChange(before, after any) *AuditEntry {
+	e.ValueBefore = auditJSON(before)
+	e.ValueAfter = auditJSON(after)
+	return e
+}
+
+// WithDomain sets the ID of the domain the action relates to
+func (e *AuditEntry) WithDomain(id *uuid.UUID) *AuditEntry {
+	e.DomainID = *PtrToNullUUID(id)
+	return e
+}
+
+// WithRequest sets the IP address from the given HTTP request, optionally masking it
+func (e *AuditEntry) WithRequest(req *http.Request, maskIP bool) *AuditEntry {
+	e.IP = util.UserIP(req)
+	if maskIP {
+		e.IP = util.MaskIP(e.IP)
+	}
+	return e
+}
+
+// WithTarget sets the ID of the object affected by the action
+func (e *AuditEntry) WithTarget(id *uuid.UUID) *AuditEntry {
+	e.TargetID = *PtrToNullUUID(id)
+	return e
+}
+
+// auditJSON returns the JSON representation of an audited value, or an empty string if the value is nil or can't be
+// marshalled
+func auditJSON(v any) string {
+	if v == nil {
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// ---------------------------------------------------------------------------------------------------------------------
+
+// MailNotification represents an email notification postponed to be sent as part of a digest
+type MailNotification struct {
+	ID              uuid.UUID    `db:"id"`              // Unique record ID
+	DomainID        uuid.UUID    `db:"domain_id"`       // Reference to the domain
+	UserID          uuid.UUID    `db:"user_id"`         // Reference to the recipient user
+	CommentID       uuid.UUID    `db:"comment_id"`      // Reference to the comment the notification is about
+	Kind            string       `db:"kind"`            // Notification kind
+	CreatedTime     time.Time    `db:"ts_created"`      // When the record was created
+	Attempts        int          `db:"attempts"`        // Number of failed attempts to send the notification's digest
+	NextAttemptTime sql.NullTime `db:"ts_next_attempt"` // When the next send attempt is due, null if not failed yet
+}
+
+// NewMailNotification instantiates a new MailNotification
+func NewMailNotification(kind string, userID, domainID, commentID *uuid.UUID) *MailNotification {
+	return &MailNotification{
+		ID:          uuid.New(),
+		DomainID:    *domainID,
+		UserID:      *userID,
+		CommentID:   *commentID,
+		Kind:        kind,
+		CreatedTime: time.Now().UTC(),
+	}
+}
+
+// DigestRetryDelay returns the delay before the next attempt to send a digest, given the number of failed attempts
+// already made. The delay doubles with every attempt, starting at util.DigestRetryBaseDelay and capped at
+// util.DigestRetryMaxDelay
+func DigestRetryDelay(attempts int) time.Duration {
+	d := util.DigestRetryBaseDelay
+	for i := 1; i < attempts; i++ {
+		if d *= 2; d >= util.DigestRetryMaxDelay {
+			return util.DigestRetryMaxDelay
+		}
+	}
+	return d
+}
+
+// DigestPeriodStart returns the start of the digest period the given time falls into, for the given digest mode:
+//   - hourly: the start of the hour
+//   - daily: midnight UTC
+//   - weekly: Monday midnight UTC
+//
+// For the immediate (or an unknown) mode the time itself is returned. Notifications created before the start of the
+// current period are due to be sent
+func DigestPeriodStart(mode models.DomainUserDigestMode, t time.Time) time.Time {
+	t = t.UTC()
+	switch mode {
+	case models.DomainUserDigestModeHourly:
+		return t.Truncate(time.Hour)
+	case models.DomainUserDigestModeDaily:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	case models.DomainUserDigestModeWeekly:
+		// Weekday() counts from Sunday, whereas weeks start on Monday
+		days := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-days, 0, 0, 0, 0, time.UTC)
+	}
+	return t
+}
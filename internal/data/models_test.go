@@ -2,8 +2,14 @@ package data
 
 import (
 	"database/sql"
+	"errors"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/google/uuid"
+	"gitlab.com/comentario/comentario/internal/api/models"
+	"gitlab.com/comentario/comentario/internal/util"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -124,6 +130,227 @@ func TestUser_ColourIndex(t *testing.T) {
 	}
 }
 
+func TestUser_TOTPRecoveryCodesNew(t *testing.T) {
+	u := &User{}
+	codes, err := u.TOTPRecoveryCodesNew()
+	if err != nil {
+		t.Fatalf("TOTPRecoveryCodesNew() error = %v", err)
+	}
+	if len(codes) != util.TOTPRecoveryCodeCount {
+		t.Errorf("TOTPRecoveryCodesNew() got %d codes, want %d", len(codes), util.TOTPRecoveryCodeCount)
+	}
+	if got := u.TOTPRecoveryCodeCount(); got != util.TOTPRecoveryCodeCount {
+		t.Errorf("TOTPRecoveryCodeCount() = %d, want %d", got, util.TOTPRecoveryCodeCount)
+	}
+	for _, c := range codes {
+		if strings.Contains(u.TOTPRecoveryCodes, strings.ReplaceAll(c, "-", "")) {
+			t.Errorf("TOTPRecoveryCodesNew() stored plain-text code %q", c)
+		}
+	}
+}
+
+func TestUser_VerifySecondFactor(t *testing.T) {
+	// Base32 encoding of "12345678901234567890"
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	code := util.TOTPCode([]byte("12345678901234567890"), time.Now().Unix()/int64(util.TOTPPeriod/time.Second))
+
+	// Disabled two-factor authentication
+	u := &User{TOTPSecret: secret}
+	if u.VerifySecondFactor(code) {
+		t.Errorf("VerifySecondFactor() = true for a user with TOTP disabled")
+	}
+
+	// TOTP code
+	u.WithTOTPEnabled(true)
+	recCodes, err := u.TOTPRecoveryCodesNew()
+	if err != nil {
+		t.Fatalf("TOTPRecoveryCodesNew() error = %v", err)
+	}
+	if u.VerifySecondFactor("000000x") {
+		t.Errorf("VerifySecondFactor() = true for a wrong code")
+	}
+	if !u.VerifySecondFactor(code) {
+		t.Errorf("VerifySecondFactor() = false for a valid TOTP code")
+	}
+	if u.VerifySecondFactor(code) {
+		t.Errorf("VerifySecondFactor() = true for a reused TOTP code")
+	}
+
+	// Recovery code, with varying case and formatting
+	if !u.VerifySecondFactor(" " + strings.ToUpper(recCodes[3]) + " ") {
+		t.Errorf("VerifySecondFactor() = false for a valid recovery code")
+	}
+	if got := u.TOTPRecoveryCodeCount(); got != util.TOTPRecoveryCodeCount-1 {
+		t.Errorf("TOTPRecoveryCodeCount() = %d after using a code, want %d", got, util.TOTPRecoveryCodeCount-1)
+	}
+	if u.VerifySecondFactor(recCodes[3]) {
+		t.Errorf("VerifySecondFactor() = true for a reused recovery code")
+	}
+	if !u.VerifySecondFactor(strings.ReplaceAll(recCodes[0], "-", "")) {
+		t.Errorf("VerifySecondFactor() = false for a valid recovery code without dash")
+	}
+
+	// Disabling discards everything
+	u.WithTOTPEnabled(false)
+	if u.TOTPSecret != "" || u.TOTPRecoveryCodes != "" || u.TOTPLastCounter != 0 || u.TOTPEnabledTime.Valid {
+		t.Errorf("WithTOTPEnabled(false) didn't reset TOTP fields: %#v", u)
+	}
+}
+
+func TestPersonalToken_AllowsDomain(t *testing.T) {
+	id1 := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	id2 := uuid.MustParse("22222222-2222-2222-2222-222222222222")
+	tests := []struct {
+		name      string
+		domainIDs string
+		id        uuid.UUID
+		want      bool
+	}{
+		{"unrestricted  ", "", id1, true},
+		{"single match  ", id1.String(), id1, true},
+		{"single miss   ", id1.String(), id2, false},
+		{"multiple match", id1.String() + "," + id2.String(), id2, true},
+		{"garbage       ", "foo", id1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pt := &PersonalToken{DomainIDs: tt.domainIDs}
+			if got := pt.AllowsDomain(&tt.id); got != tt.want {
+				t.Errorf("AllowsDomain() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPersonalToken_AllowsOperation(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes string
+		method string
+		path   string
+		want   bool
+	}{
+		{"no scopes, read            ", "", "GET", "/comments", false},
+		{"read-only, read            ", "read-only", "GET", "/comments", true},
+		{"read-only, read users      ", "read-only", "GET", "/users/{uuid}", true},
+		{"read-only, moderate        ", "read-only", "POST", "/comments/{uuid}", false},
+		{"read-only, own profile     ", "read-only", "GET", "/user", false},
+		{"moderate, moderate         ", "moderate", "POST", "/comments/{uuid}", true},
+		{"moderate, delete comment   ", "moderate", "DELETE", "/comments/{uuid}", true},
+		{"moderate, update domain    ", "moderate", "PUT", "/domains/{uuid}", false},
+		{"domain-admin, moderate     ", "domain-admin", "POST", "/comments/{uuid}", true},
+		{"domain-admin, update domain", "domain-admin", "PUT", "/domains/{uuid}", true},
+		{"domain-admin, update page  ", "domain-admin", "PUT", "/domain-pages/{uuid}", true},
+		{"domain-admin, update user  ", "domain-admin", "PUT", "/users/{uuid}", false},
+		{"domain-admin, config       ", "domain-admin", "PATCH", "/config", false},
+		{"superuser-admin, domain    ", "superuser-admin", "DELETE", "/domains/{uuid}", true},
+		{"superuser-admin, user      ", "superuser-admin", "PUT", "/users/{uuid}", true},
+		{"superuser-admin, config    ", "superuser-admin", "PATCH", "/config", true},
+		{"superuser-admin, tokens    ", "superuser-admin", "POST", "/user/tokens", false},
+		{"superuser-admin, logout    ", "superuser-admin", "POST", "/auth/logout", false},
+		{"superuser-admin, unknown   ", "superuser-admin", "POST", "/whatever", false},
+		{"multiple scopes            ", "read-only,moderate", "DELETE", "/comments/{uuid}", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pt := &PersonalToken{Scopes: tt.scopes}
+			if got := pt.AllowsOperation(tt.method, tt.path); got != tt.want {
+				t.Errorf("AllowsOperation() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPersonalToken_WithScopes(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []models.PersonalTokenScope
+		want   string
+	}{
+		{"nil       ", nil, ""},
+		{"single    ", []models.PersonalTokenScope{models.PersonalTokenScopeReadDashOnly}, "read-only"},
+		{"multiple  ", []models.PersonalTokenScope{models.PersonalTokenScopeModerate, models.PersonalTokenScopeDomainDashAdmin}, "moderate,domain-admin"},
+		{"duplicates", []models.PersonalTokenScope{models.PersonalTokenScopeModerate, models.PersonalTokenScopeModerate}, "moderate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pt := &PersonalToken{}
+			if got := pt.WithScopes(tt.scopes).Scopes; got != tt.want {
+				t.Errorf("WithScopes() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPersonalTokenHash(t *testing.T) {
+	t.Run("SHA-256 hex", func(t *testing.T) {
+		want := "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+		if got := PersonalTokenHash("foo"); got != want {
+			t.Errorf("PersonalTokenHash() = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestPasskey_Credential(t *testing.T) {
+	userID := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	tests := []struct {
+		name string
+		cred webauthn.Credential
+	}{
+		{"no transports ", webauthn.Credential{ID: []byte{1, 2}, PublicKey: []byte{3}}},
+		{"one transport ", webauthn.Credential{ID: []byte{1}, Transport: []protocol.AuthenticatorTransport{protocol.USB}}},
+		{"two transports", webauthn.Credential{ID: []byte{1}, Transport: []protocol.AuthenticatorTransport{protocol.Internal, protocol.Hybrid}}},
+		{"flags, counter", webauthn.Credential{
+			ID:            []byte{1},
+			Flags:         webauthn.CredentialFlags{BackupEligible: true, BackupState: true},
+			Authenticator: webauthn.Authenticator{AAGUID: []byte{4, 5}, SignCount: 42},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pk := NewPasskey(&userID, "Key", &tt.cred)
+			got := pk.Credential()
+			if !reflect.DeepEqual(got.ID, tt.cred.ID) || !reflect.DeepEqual(got.PublicKey, tt.cred.PublicKey) {
+				t.Errorf("Credential() ID/PublicKey = %v/%v, want %v/%v", got.ID, got.PublicKey, tt.cred.ID, tt.cred.PublicKey)
+			}
+			if !reflect.DeepEqual(got.Transport, tt.cred.Transport) {
+				t.Errorf("Credential() Transport = %v, want %v", got.Transport, tt.cred.Transport)
+			}
+			if got.Flags.BackupEligible != tt.cred.Flags.BackupEligible || got.Flags.BackupState != tt.cred.Flags.BackupState {
+				t.Errorf("Credential() Flags = %+v, want %+v", got.Flags, tt.cred.Flags)
+			}
+			if !reflect.DeepEqual(got.Authenticator.AAGUID, tt.cred.Authenticator.AAGUID) || got.Authenticator.SignCount != tt.cred.Authenticator.SignCount {
+				t.Errorf("Credential() Authenticator = %+v, want %+v", got.Authenticator, tt.cred.Authenticator)
+			}
+		})
+	}
+}
+
+func TestPasskey_WithCredential(t *testing.T) {
+	pk := &Passkey{SignCount: 1}
+	pk.WithCredential(&webauthn.Credential{
+		Flags:         webauthn.CredentialFlags{BackupState: true},
+		Authenticator: webauthn.Authenticator{SignCount: 7},
+	})
+	if pk.SignCount != 7 {
+		t.Errorf("WithCredential() SignCount = %d, want 7", pk.SignCount)
+	}
+	if !pk.BackupState {
+		t.Error("WithCredential() BackupState = false, want true")
+	}
+	if !pk.LastUsedTime.Valid {
+		t.Error("WithCredential() LastUsedTime isn't set")
+	}
+}
+
+func TestPasskeyUser_WebAuthnID(t *testing.T) {
+	u := &User{ID: uuid.MustParse("01020304-0506-0708-090a-0b0c0d0e0f10")}
+	want := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	if got := (&PasskeyUser{User: u}).WebAuthnID(); !reflect.DeepEqual(got, want) {
+		t.Errorf("WebAuthnID() = %v, want %v", got, want)
+	}
+}
+
 func TestDomainUser_AgeInDays(t *testing.T) {
 	tests := []struct {
 		name string
@@ -395,3 +622,408 @@ func TestComment_IsRoot(t *testing.T) {
 		})
 	}
 }
+
+func TestComment_WithModerationAction(t *testing.T) {
+	uid := uuid.MustParse("477649e8-d122-480c-b183-c3e80e998276")
+	tests := []struct {
+		name         string
+		action       ModerationAction
+		wantPending  bool
+		wantApproved bool
+		wantReason   string
+		wantModUser  bool
+	}{
+		{"none   ", ModerationActionNone, false, true, "", true},
+		{"flag   ", ModerationActionFlag, false, true, "foo", true},
+		{"pending", ModerationActionPending, true, false, "foo", false},
+		{"reject ", ModerationActionReject, false, false, "foo", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := (&Comment{}).WithModerationAction(&uid, tt.action, "foo")
+			if c.IsPending != tt.wantPending {
+				t.Errorf("WithModerationAction() got IsPending = %v, want %v", c.IsPending, tt.wantPending)
+			}
+			if c.IsApproved != tt.wantApproved {
+				t.Errorf("WithModerationAction() got IsApproved = %v, want %v", c.IsApproved, tt.wantApproved)
+			}
+			if c.PendingReason != tt.wantReason {
+				t.Errorf("WithModerationAction() got PendingReason = %q, want %q", c.PendingReason, tt.wantReason)
+			}
+			if c.UserModerated.Valid != tt.wantModUser {
+				t.Errorf("WithModerationAction() got UserModerated.Valid = %v, want %v", c.UserModerated.Valid, tt.wantModUser)
+			}
+		})
+	}
+}
+
+func TestNewCommentFlag(t *testing.T) {
+	tests := []struct {
+		name        string
+		details     string
+		wantDetails string
+	}{
+		{"empty    ", "", ""},
+		{"spaces   ", "  foo bar \n", "foo bar"},
+		{"too long ", strings.Repeat("x", MaxCommentFlagDetailsLength+10), strings.Repeat("x", MaxCommentFlagDetailsLength-3) + "…"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.TrimSpace(tt.name), func(t *testing.T) {
+			commentID, userID := uuid.New(), uuid.New()
+			f := NewCommentFlag(&commentID, &userID, CommentFlagReasonSpam, tt.details)
+			if f.CommentID != commentID {
+				t.Errorf("NewCommentFlag() CommentID = %v, want %v", f.CommentID, commentID)
+			}
+			if !f.UserID.Valid || f.UserID.UUID != userID {
+				t.Errorf("NewCommentFlag() UserID = %v, want %v", f.UserID, userID)
+			}
+			if f.Reason != CommentFlagReasonSpam {
+				t.Errorf("NewCommentFlag() Reason = %q, want %q", f.Reason, CommentFlagReasonSpam)
+			}
+			if f.Details != tt.wantDetails {
+				t.Errorf("NewCommentFlag() Details = %q, want %q", f.Details, tt.wantDetails)
+			}
+			if f.DismissedTime.Valid {
+				t.Errorf("NewCommentFlag() DismissedTime = %v, want null", f.DismissedTime)
+			}
+		})
+	}
+}
+
+func TestNewCommentRevision(t *testing.T) {
+	created := time.Date(2024, 5, 15, 13, 47, 12, 0, time.UTC)
+	edited := created.Add(time.Hour)
+	author := uuid.New()
+	editor := uuid.New()
+	tests := []struct {
+		name     string
+		c        *Comment
+		wantTime time.Time
+		wantUser uuid.NullUUID
+	}{
+		{
+			"never edited",
+			&Comment{Markdown: "foo", CreatedTime: created, UserCreated: uuid.NullUUID{UUID: author, Valid: true}},
+			created,
+			uuid.NullUUID{UUID: author, Valid: true},
+		},
+		{
+			"edited      ",
+			&Comment{
+				Markdown:    "foo",
+				CreatedTime: created,
+				UserCreated: uuid.NullUUID{UUID: author, Valid: true},
+				EditedTime:  sql.NullTime{Time: edited, Valid: true},
+				UserEdited:  uuid.NullUUID{UUID: editor, Valid: true},
+			},
+			edited,
+			uuid.NullUUID{UUID: editor, Valid: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(strings.TrimSpace(tt.name), func(t *testing.T) {
+			tt.c.ID = uuid.New()
+			r := NewCommentRevision(tt.c)
+			if r.CommentID != tt.c.ID {
+				t.Errorf("NewCommentRevision() CommentID = %v, want %v", r.CommentID, tt.c.ID)
+			}
+			if r.Markdown != tt.c.Markdown {
+				t.Errorf("NewCommentRevision() Markdown = %q, want %q", r.Markdown, tt.c.Markdown)
+			}
+			if !r.CreatedTime.Equal(tt.wantTime) {
+				t.Errorf("NewCommentRevision() CreatedTime = %v, want %v", r.CreatedTime, tt.wantTime)
+			}
+			if r.UserCreated != tt.wantUser {
+				t.Errorf("NewCommentRevision() UserCreated = %v, want %v", r.UserCreated, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestModerationAction_Outweighs(t *testing.T) {
+	tests := []struct {
+		name  string
+		a     ModerationAction
+		other ModerationAction
+		want  bool
+	}{
+		{"none vs none      ", ModerationActionNone, ModerationActionNone, false},
+		{"flag vs none      ", ModerationActionFlag, ModerationActionNone, true},
+		{"none vs flag      ", ModerationActionNone, ModerationActionFlag, false},
+		{"pending vs flag   ", ModerationActionPending, ModerationActionFlag, true},
+		{"pending vs pending", ModerationActionPending, ModerationActionPending, false},
+		{"reject vs pending ", ModerationActionReject, ModerationActionPending, true},
+		{"pending vs reject ", ModerationActionPending, ModerationActionReject, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.Outweighs(tt.other); got != tt.want {
+				t.Errorf("Outweighs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDomainRoleRule_Matches(t *testing.T) {
+	claims := map[string]any{
+		"groups":       []any{"users", "staff"},
+		"roles":        []string{"editor"},
+		"banned":       true,
+		"level":        float64(3),
+		"email":        "jane@example.com",
+		"realm_access": map[string]any{"roles": []any{"admin"}},
+		"empty":        nil,
+	}
+	tests := []struct {
+		name  string
+		rule  DomainRoleRule
+		idpID string
+		want  bool
+	}{
+		{"string match        ", DomainRoleRule{Claim: "email", Value: "jane@example.com"}, "oidc:kc", true},
+		{"string miss         ", DomainRoleRule{Claim: "email", Value: "john@example.com"}, "oidc:kc", false},
+		{"array element       ", DomainRoleRule{Claim: "groups", Value: "staff"}, "oidc:kc", true},
+		{"array miss          ", DomainRoleRule{Claim: "groups", Value: "admins"}, "oidc:kc", false},
+		{"string slice element", DomainRoleRule{Claim: "roles", Value: "editor"}, "saml:adfs", true},
+		{"bool                ", DomainRoleRule{Claim: "banned", Value: "true"}, "sso", true},
+		{"bool miss           ", DomainRoleRule{Claim: "banned", Value: "false"}, "sso", false},
+		{"number              ", DomainRoleRule{Claim: "level", Value: "3"}, "sso", true},
+		{"nested path         ", DomainRoleRule{Claim: "realm_access.roles", Value: "admin"}, "oidc:kc", true},
+		{"path into scalar    ", DomainRoleRule{Claim: "email.domain", Value: "example.com"}, "oidc:kc", false},
+		{"object value        ", DomainRoleRule{Claim: "realm_access", Value: ""}, "oidc:kc", false},
+		{"null value          ", DomainRoleRule{Claim: "empty", Value: ""}, "oidc:kc", false},
+		{"missing claim       ", DomainRoleRule{Claim: "department", Value: ""}, "oidc:kc", false},
+		{"IdP match           ", DomainRoleRule{IdPID: "oidc:kc", Claim: "groups", Value: "staff"}, "oidc:kc", true},
+		{"IdP miss            ", DomainRoleRule{IdPID: "sso", Claim: "groups", Value: "staff"}, "oidc:kc", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.Matches(tt.idpID, claims); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchDomainRoleRules(t *testing.T) {
+	banned := &DomainRoleRule{Claim: "banned", Value: "true", Role: models.DomainUserRoleReadonly}
+	staff := &DomainRoleRule{Claim: "groups", Value: "staff", Role: models.DomainUserRoleModerator}
+	tests := []struct {
+		name   string
+		rules  []*DomainRoleRule
+		claims map[string]any
+		want   *DomainRoleRule
+	}{
+		{"no rules      ", nil, map[string]any{"banned": true}, nil},
+		{"no claims     ", []*DomainRoleRule{banned, staff}, nil, nil},
+		{"no match      ", []*DomainRoleRule{banned, staff}, map[string]any{"groups": []any{"users"}}, nil},
+		{"single match  ", []*DomainRoleRule{banned, staff}, map[string]any{"groups": []any{"staff"}}, staff},
+		{"first wins    ", []*DomainRoleRule{banned, staff}, map[string]any{"groups": []any{"staff"}, "banned": true}, banned},
+		{"order matters ", []*DomainRoleRule{staff, banned}, map[string]any{"groups": []any{"staff"}, "banned": true}, staff},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchDomainRoleRules(tt.rules, "sso", tt.claims); got != tt.want {
+				t.Errorf("MatchDomainRoleRules() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDomainWebhook_HasEvent(t *testing.T) {
+	tests := []struct {
+		name   string
+		events string
+		event  models.WebhookEventType
+		want   bool
+	}{
+		{"empty       ", "", models.WebhookEventTypeCommentCreated, false},
+		{"single match", "commentCreated", models.WebhookEventTypeCommentCreated, true},
+		{"single miss ", "commentCreated", models.WebhookEventTypeCommentDeleted, false},
+		{"multi match ", "commentCreated,commentDeleted", models.WebhookEventTypeCommentDeleted, true},
+		{"spaces      ", " commentCreated , commentVoted ", models.WebhookEventTypeCommentVoted, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wh := &DomainWebhook{Events: tt.events}
+			if got := wh.HasEvent(tt.event); got != tt.want {
+				t.Errorf("HasEvent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDomainWebhook_WithEvents(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []models.WebhookEventType
+		want   string
+	}{
+		{"nil       ", nil, ""},
+		{"single    ", []models.WebhookEventType{models.WebhookEventTypeCommentCreated}, "commentCreated"},
+		{"multiple  ", []models.WebhookEventType{models.WebhookEventTypeCommentCreated, models.WebhookEventTypeCommentSticky}, "commentCreated,commentSticky"},
+		{"duplicates", []models.WebhookEventType{models.WebhookEventTypeCommentVoted, models.WebhookEventTypeCommentVoted}, "commentVoted"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wh := &DomainWebhook{}
+			if got := wh.WithEvents(tt.events).Events; got != tt.want {
+				t.Errorf("WithEvents() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookDelivery_WithAttempt(t *testing.T) {
+	tests := []struct {
+		name       string
+		attempts   int
+		err        error
+		wantStatus WebhookDeliveryStatus
+		wantError  string
+	}{
+		{"first success    ", 0, nil, WebhookDeliveryStatusSucceeded, ""},
+		{"first failure    ", 0, errors.New("boom"), WebhookDeliveryStatusPending, "boom"},
+		{"late success     ", util.WebhookMaxDeliveryAttempts - 1, nil, WebhookDeliveryStatusSucceeded, ""},
+		{"last failure     ", util.WebhookMaxDeliveryAttempts - 1, errors.New("boom"), WebhookDeliveryStatusFailed, "boom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wd := &WebhookDelivery{Status: WebhookDeliveryStatusPending, Attempts: tt.attempts}
+			wd.WithAttempt(200, tt.err)
+			if wd.Attempts != tt.attempts+1 {
+				t.Errorf("WithAttempt() Attempts = %d, want %d", wd.Attempts, tt.attempts+1)
+			}
+			if wd.Status != tt.wantStatus {
+				t.Errorf("WithAttempt() Status = %q, want %q", wd.Status, tt.wantStatus)
+			}
+			if wd.ResponseError != tt.wantError {
+				t.Errorf("WithAttempt() ResponseError = %q, want %q", wd.ResponseError, tt.wantError)
+			}
+			if !wd.LastAttemptTime.Valid {
+				t.Errorf("WithAttempt() LastAttemptTime isn't set")
+			}
+		})
+	}
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts int
+		want     time.Duration
+	}{
+		{"zero  ", 0, util.WebhookRetryBaseDelay},
+		{"first ", 1, util.WebhookRetryBaseDelay},
+		{"second", 2, 2 * util.WebhookRetryBaseDelay},
+		{"third ", 3, 4 * util.WebhookRetryBaseDelay},
+		{"many  ", 100, util.WebhookRetryMaxDelay},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := WebhookRetryDelay(tt.attempts); got != tt.want {
+				t.Errorf("WebhookRetryDelay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDigestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts int
+		want     time.Duration
+	}{
+		{"zero  ", 0, util.DigestRetryBaseDelay},
+		{"first ", 1, util.DigestRetryBaseDelay},
+		{"second", 2, 2 * util.DigestRetryBaseDelay},
+		{"third ", 3, 4 * util.DigestRetryBaseDelay},
+		{"many  ", 100, util.DigestRetryMaxDelay},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DigestRetryDelay(tt.attempts); got != tt.want {
+				t.Errorf("DigestRetryDelay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuditEntry_WithChange(t *testing.T) {
+	tests := []struct {
+		name       string
+		before     any
+		after      any
+		wantBefore string
+		wantAfter  string
+	}{
+		{"both nil      ", nil, nil, "", ""},
+		{"before only   ", map[string]bool{"banned": false}, nil, `{"banned":false}`, ""},
+		{"after only    ", nil, map[string]string{"role": "owner"}, "", `{"role":"owner"}`},
+		{"both          ", map[string]int{"n": 1}, map[string]int{"n": 2}, `{"n":1}`, `{"n":2}`},
+		{"unmarshallable", func() {}, "x", "", `"x"`},
+	}
+	for _, tt := range tests {
+		t.Run(strings.TrimSpace(tt.name), func(t *testing.T) {
+			e := (&AuditEntry{}).WithChange(tt.before, tt.after)
+			if e.ValueBefore != tt.wantBefore {
+				t.Errorf("WithChange() ValueBefore = %q, want %q", e.ValueBefore, tt.wantBefore)
+			}
+			if e.ValueAfter != tt.wantAfter {
+				t.Errorf("WithChange() ValueAfter = %q, want %q", e.ValueAfter, tt.wantAfter)
+			}
+		})
+	}
+}
+
+func TestDigestPeriodStart(t *testing.T) {
+	// Wednesday
+	ts := time.Date(2024, 5, 15, 13, 47, 12, 0, time.UTC)
+	tests := []struct {
+		name string
+		mode models.DomainUserDigestMode
+		t    time.Time
+		want time.Time
+	}{
+		{"immediate       ", models.DomainUserDigestModeImmediate, ts, ts},
+		{"unknown         ", "", ts, ts},
+		{"hourly          ", models.DomainUserDigestModeHourly, ts, time.Date(2024, 5, 15, 13, 0, 0, 0, time.UTC)},
+		{"daily           ", models.DomainUserDigestModeDaily, ts, time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC)},
+		{"weekly          ", models.DomainUserDigestModeWeekly, ts, time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC)},
+		{"weekly, Monday  ", models.DomainUserDigestModeWeekly, time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC), time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC)},
+		{"weekly, Sunday  ", models.DomainUserDigestModeWeekly, time.Date(2024, 5, 19, 23, 59, 0, 0, time.UTC), time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC)},
+		{"weekly, new year", models.DomainUserDigestModeWeekly, time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC), time.Date(2024, 12, 30, 0, 0, 0, 0, time.UTC)},
+		{"daily, non-UTC  ", models.DomainUserDigestModeDaily, time.Date(2024, 5, 15, 1, 0, 0, 0, time.FixedZone("CEST", 2*3600)), time.Date(2024, 5, 14, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DigestPeriodStart(tt.mode, tt.t); !got.Equal(tt.want) {
+				t.Errorf("DigestPeriodStart() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportResult_WithItems(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []ImportReportItem
+		want  string
+	}{
+		{"nil       ", nil, ""},
+		{"empty     ", []ImportReportItem{}, ""},
+		{"no details", []ImportReportItem{{Kind: ImportReportItemKindPageAdded, Ref: "/"}}, `[{"kind":"pageAdded","ref":"/"}]`},
+		{"multiple  ", []ImportReportItem{{Kind: ImportReportItemKindUserAdded, Ref: "a@b.com", Details: "Ann"}, {Kind: ImportReportItemKindCommentOrphaned, Ref: "42", Details: "17"}}, `[{"kind":"userAdded","ref":"a@b.com","details":"Ann"},{"kind":"commentOrphaned","ref":"42","details":"17"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(strings.TrimSpace(tt.name), func(t *testing.T) {
+			ir := (&ImportResult{}).WithItems(tt.items)
+			if ir.ReportItems != tt.want {
+				t.Errorf("WithItems() ReportItems = %q, want %q", ir.ReportItems, tt.want)
+			}
+			if got := ir.Items(); len(got) != len(tt.items) || len(got) > 0 && !reflect.DeepEqual(got, tt.items) {
+				t.Errorf("Items() = %v, want %v", got, tt.items)
+			}
+		})
+	}
+}
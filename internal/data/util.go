@@ -1,7 +1,9 @@
 package data
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"github.com/go-openapi/strfmt"
 	"github.com/go-openapi/swag"
 	"github.com/google/uuid"
@@ -133,3 +135,15 @@ func URIPtrToString(v *strfmt.URI) string {
 func URIToString(v strfmt.URI) string {
 	return strings.TrimSpace(string(v))
 }
+
+// pathHasPrefix returns whether the given URL path equals the given prefix or is nested under it
+func pathHasPrefix(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// totpRecoveryCodeHash returns the SHA-256 hash of the given TOTP recovery code, as a hex string. The code gets
+// normalised first, so that letter case, whitespace, and dashes don't matter
+func totpRecoveryCodeHash(code string) string {
+	h := sha256.Sum256([]byte(strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))))
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,701 @@
+package persistence
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/doug-martin/goqu/v9"
+	"gitlab.com/comentario/comentario/internal/util"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupFormat identifies a backup archive
+const backupFormat = "comentario-backup"
+
+// backupVersion is the version of the backup archive format
+const backupVersion = 1
+
+// backupColumnKind is a kind of a table column's value, which is mapped onto an appropriate data type on either
+// database backend
+type backupColumnKind int
+
+const (
+	backupKindText backupColumnKind = iota
+	backupKindBool
+	backupKindInt
+	backupKindFloat
+	backupKindTime
+	backupKindBytes
+)
+
+// backupColumnKindOf returns the column kind for the given database column type name
+func backupColumnKindOf(typeName string) backupColumnKind {
+	s := strings.ToLower(typeName)
+	switch {
+	case strings.Contains(s, "bool"):
+		return backupKindBool
+	case strings.Contains(s, "int"):
+		return backupKindInt
+	case strings.Contains(s, "real"), strings.Contains(s, "double"), strings.Contains(s, "float"),
+		strings.Contains(s, "numeric"), strings.Contains(s, "decimal"):
+		return backupKindFloat
+	case strings.Contains(s, "timestamp"), strings.Contains(s, "date"):
+		return backupKindTime
+	case strings.Contains(s, "bytea"), strings.Contains(s, "blob"):
+		return backupKindBytes
+	}
+	return backupKindText
+}
+
+// BackupHeader is the leading record of a backup archive
+type BackupHeader struct {
+	Format      string    `json:"format"`      // Archive format identifier, always backupFormat
+	Version     int       `json:"version"`     // Archive format version
+	Dialect     string    `json:"dialect"`     // Database dialect the backup was made on
+	CreatedTime time.Time `json:"createdTime"` // When the backup was made
+	Migrations  []string  `json:"migrations"`  // Names of the database migrations installed at the time of the backup
+}
+
+// backupTableHeader is a record preceding the rows of a table in a backup archive. Each row is a JSON array of values,
+// in the order of the columns
+type backupTableHeader struct {
+	Table   string   `json:"table"`   // Table name
+	Columns []string `json:"columns"` // Names of the table's columns
+}
+
+// BackupTrailer is the final record of a backup archive, which allows detecting a truncated archive
+type BackupTrailer struct {
+	Tables int `json:"tables"` // Number of tables in the archive
+	Rows   int `json:"rows"`   // Total number of rows in the archive
+}
+
+// backupColumn describes a table column
+type backupColumn struct {
+	name string           // Column name
+	kind backupColumnKind // Kind of the column's value
+}
+
+// backupForeignKey describes a single-column foreign key
+type backupForeignKey struct {
+	table    string // Name of the referencing table
+	column   string // Name of the referencing column
+	refTable string // Name of the referenced table
+	refCol   string // Name of the referenced column
+}
+
+// backupTable describes a table that gets backed up and restored
+type backupTable struct {
+	name     string              // Table name
+	columns  []backupColumn      // Table columns
+	selfRefs []*backupForeignKey // Foreign keys referencing the table itself
+}
+
+// column returns the column with the given name, or nil if there's none
+func (t *backupTable) column(name string) *backupColumn {
+	for i := range t.columns {
+		if t.columns[i].name == name {
+			return &t.columns[i]
+		}
+	}
+	return nil
+}
+
+// backupSortTables sorts the given table names so that every table comes after all tables it references, with
+// references of a table to itself ignored. Tables not depending on each other are sorted alphabetically
+func backupSortTables(names []string, fks []*backupForeignKey) ([]string, error) {
+	// Collect the dependencies of each table, skipping self-references and unknown tables
+	deps := make(map[string]map[string]bool, len(names))
+	for _, n := range names {
+		deps[n] = map[string]bool{}
+	}
+	for _, fk := range fks {
+		if _, ok := deps[fk.table]; ok && fk.table != fk.refTable {
+			if _, ok := deps[fk.refTable]; ok {
+				deps[fk.table][fk.refTable] = true
+			}
+		}
+	}
+
+	// Repeatedly pick tables whose dependencies have all been picked
+	remaining := slices.Clone(names)
+	sort.Strings(remaining)
+	res := make([]string, 0, len(names))
+	done := make(map[string]bool, len(names))
+	for len(remaining) > 0 {
+		var next []string
+		for _, n := range remaining {
+			ready := true
+			for d := range deps[n] {
+				if !done[d] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				res = append(res, n)
+			} else {
+				next = append(next, n)
+			}
+		}
+		if len(next) == len(remaining) {
+			return nil, fmt.Errorf("circular references between tables: %s", strings.Join(remaining, ", "))
+		}
+		for _, n := range res[len(res)-(len(remaining)-len(next)):] {
+			done[n] = true
+		}
+		remaining = next
+	}
+	return res, nil
+}
+
+// backupValue converts a value read from a column of the given kind into one suitable for storing in an archive
+func backupValue(kind backupColumnKind, v any) any {
+	switch x := v.(type) {
+	case []byte:
+		// Byte values are only stored as such (i.e. base64-encoded) if the column is binary
+		if kind != backupKindBytes {
+			return string(x)
+		}
+	case int64:
+		// Booleans can be stored as numbers
+		if kind == backupKindBool {
+			return x != 0
+		}
+	case time.Time:
+		return x.UTC()
+	}
+	return v
+}
+
+// restoreValue converts a value read from an archive into one suitable for storing in a column of the given kind
+func restoreValue(kind backupColumnKind, v any) (any, error) {
+	switch x := v.(type) {
+	case nil:
+		return nil, nil
+
+	case json.Number:
+		switch kind {
+		case backupKindBool:
+			return x.String() != "0", nil
+		case backupKindInt:
+			return x.Int64()
+		case backupKindFloat:
+			return x.Float64()
+		}
+		return x.String(), nil
+
+	case string:
+		switch kind {
+		case backupKindBytes:
+			return base64.StdEncoding.DecodeString(x)
+		case backupKindTime:
+			// Pass the value on as is if it isn't a valid timestamp, letting the database take care of it
+			if t, err := time.Parse(time.RFC3339Nano, x); err == nil {
+				return t.UTC(), nil
+			}
+		}
+		return x, nil
+
+	case bool:
+		if kind == backupKindInt {
+			return util.If(x, 1, 0), nil
+		}
+		return x, nil
+	}
+	return nil, fmt.Errorf("unsupported value type %T", v)
+}
+
+// Backup writes all instance data, i.e. the content of all tables except migration ones, to w as a stream of JSON
+// records, one per line: a header, followed by every table's header and rows, and finally a trailer. The data is read
+// within a single read-only transaction, which makes it consistent
+func (db *Database) Backup(w io.Writer) (*BackupTrailer, error) {
+	logger.Debug("db.Backup()")
+
+	// Fetch the installed migrations
+	installed, err := db.getInstalledMigrations()
+	if err != nil {
+		return nil, err
+	}
+	migrations := make([]string, 0, len(installed))
+	for filename := range installed {
+		migrations = append(migrations, filename)
+	}
+	sort.Strings(migrations)
+
+	// Describe the tables
+	tables, err := db.backupTables()
+	if err != nil {
+		return nil, err
+	}
+
+	// Start a transaction. PostgreSQL needs to be told to use a snapshot, whereas an SQLite transaction already is one
+	opts := &sql.TxOptions{}
+	if db.dialect == dbPostgres {
+		opts = &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+	}
+	tx, err := db.db.BeginTx(context.Background(), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer util.LogError(tx.Rollback, "db.Backup, tx.Rollback()")
+
+	// Write the header
+	enc := json.NewEncoder(w)
+	err = enc.Encode(&BackupHeader{
+		Format:      backupFormat,
+		Version:     backupVersion,
+		Dialect:     string(db.dialect),
+		CreatedTime: time.Now().UTC(),
+		Migrations:  migrations,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Write every table
+	trailer := &BackupTrailer{}
+	for _, t := range tables {
+		cnt, err := db.backupTable(tx, enc, t)
+		if err != nil {
+			return nil, fmt.Errorf("failed to back up table %s: %w", t.name, err)
+		}
+		trailer.Tables++
+		trailer.Rows += cnt
+	}
+
+	// Write the trailer
+	if err := enc.Encode(trailer); err != nil {
+		return nil, err
+	}
+
+	// Succeeded
+	return trailer, nil
+}
+
+// Restore replaces all instance data with that read from r, which must be a backup archive made by Backup() on the
+// same set of database migrations (but not necessarily the same database dialect). The data is written within a single
+// transaction, so either the entire archive is restored, or nothing at all
+func (db *Database) Restore(r io.Reader) (*BackupTrailer, error) {
+	logger.Debug("db.Restore()")
+	dec := json.NewDecoder(r)
+
+	// Read and validate the header
+	var header BackupHeader
+	if err := dec.Decode(&header); err != nil {
+		return nil, fmt.Errorf("failed to read archive header: %w", err)
+	} else if header.Format != backupFormat {
+		return nil, errors.New("data isn't a Comentario backup archive")
+	} else if header.Version != backupVersion {
+		return nil, fmt.Errorf("unsupported archive version: %d", header.Version)
+	}
+
+	// Make sure the database schema is the same
+	installed, err := db.getInstalledMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if len(installed) != len(header.Migrations) {
+		return nil, fmt.Errorf(
+			"archive was made on a database with %d migrations installed, but %d are installed now",
+			len(header.Migrations), len(installed))
+	}
+	for _, filename := range header.Migrations {
+		if _, ok := installed[filename]; !ok {
+			return nil, fmt.Errorf("archive was made on a database with migration %s, which isn't installed now", filename)
+		}
+	}
+
+	// Describe the tables
+	tables, err := db.backupTables()
+	if err != nil {
+		return nil, err
+	}
+	tableMap := make(map[string]*backupTable, len(tables))
+	for _, t := range tables {
+		tableMap[t.name] = t
+	}
+
+	// Make sure there's no data yet
+	if cnt, err := db.From("cm_domains").Count(); err != nil {
+		return nil, err
+	} else if cnt > 0 {
+		return nil, errors.New("database isn't empty: there are domains in it")
+	}
+	if cnt, err := db.From("cm_users").Where(goqu.Ex{"system_account": false}).Count(); err != nil {
+		return nil, err
+	} else if cnt > 0 {
+		return nil, errors.New("database isn't empty: there are users in it")
+	}
+
+	// Restore the data in a transaction
+	trailer := &BackupTrailer{}
+	err = db.WithTx(func(tx *goqu.TxDatabase) error {
+		// Remove any existing (initial) data, dependent tables first
+		for i := len(tables) - 1; i >= 0; i-- {
+			if _, err := tx.Delete(tables[i].name).Executor().Exec(); err != nil {
+				return fmt.Errorf("failed to clean table %s: %w", tables[i].name, err)
+			}
+		}
+
+		// Iterate the records: a table's rows are arrays, whereas table headers and the trailer are objects
+		var tr *tableRestorer
+		for {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); errors.Is(err, io.EOF) {
+				return errors.New("archive is truncated")
+			} else if err != nil {
+				return err
+			}
+
+			// Add a row to the current table
+			if raw[0] == '[' {
+				if tr == nil {
+					return errors.New("table rows come before table header")
+				}
+				if err := tr.add(raw); err != nil {
+					return fmt.Errorf("failed to restore table %s: %w", tr.table.name, err)
+				}
+				continue
+			}
+
+			// Finish the current table
+			if tr != nil {
+				if err := tr.finish(); err != nil {
+					return fmt.Errorf("failed to restore table %s: %w", tr.table.name, err)
+				}
+				trailer.Tables++
+				trailer.Rows += tr.count
+				tr = nil
+			}
+
+			// Read the object as either a table header or the trailer
+			var rec struct {
+				backupTableHeader
+				BackupTrailer
+			}
+			if err := unmarshalJSONNumbers(raw, &rec); err != nil {
+				return err
+			}
+
+			// The trailer must match what's been restored
+			if rec.Table == "" {
+				if rec.BackupTrailer != *trailer {
+					return fmt.Errorf("archive trailer %+v doesn't match the restored data %+v", rec.BackupTrailer, *trailer)
+				}
+				return nil
+			}
+
+			// Start restoring the next table
+			t, ok := tableMap[rec.Table]
+			if !ok {
+				return fmt.Errorf("table %s doesn't exist", rec.Table)
+			}
+			if tr, err = newTableRestorer(tx, t, rec.Columns); err != nil {
+				return fmt.Errorf("failed to restore table %s: %w", t.name, err)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Succeeded
+	return trailer, nil
+}
+
+// backupForeignKeys returns all single-column foreign keys in the database
+func (db *Database) backupForeignKeys(tables []string) ([]*backupForeignKey, error) {
+	var res []*backupForeignKey
+	switch db.dialect {
+	case dbPostgres:
+		rows, err := db.db.Query(
+			`select cl.relname, a.attname, fcl.relname, fa.attname ` +
+				`from pg_constraint c ` +
+				`join pg_class cl on cl.oid = c.conrelid ` +
+				`join pg_namespace n on n.oid = cl.relnamespace ` +
+				`join pg_class fcl on fcl.oid = c.confrelid ` +
+				`join pg_attribute a on a.attrelid = c.conrelid and a.attnum = c.conkey[1] ` +
+				`join pg_attribute fa on fa.attrelid = c.confrelid and fa.attnum = c.confkey[1] ` +
+				`where c.contype = 'f' and n.nspname = 'public'`)
+		if err != nil {
+			return nil, err
+		}
+		defer util.LogError(rows.Close, "db.backupForeignKeys, rows.Close()")
+		for rows.Next() {
+			var fk backupForeignKey
+			if err := rows.Scan(&fk.table, &fk.column, &fk.refTable, &fk.refCol); err != nil {
+				return nil, err
+			}
+			res = append(res, &fk)
+		}
+		return res, rows.Err()
+
+	case dbSQLite3:
+		for _, t := range tables {
+			if err := db.backupQuery(
+				func(rows *sql.Rows) error {
+					fk := backupForeignKey{table: t}
+					res = append(res, &fk)
+					return rows.Scan(&fk.refTable, &fk.column, &fk.refCol)
+				},
+				`select "table", "from", "to" from pragma_foreign_key_list(?)`,
+				t,
+			); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	}
+	return nil, errUnknownDialect
+}
+
+// backupQuery runs the given query, calling fn for every returned row
+func (db *Database) backupQuery(fn func(rows *sql.Rows) error, query string, args ...any) error {
+	rows, err := db.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer util.LogError(rows.Close, "db.backupQuery, rows.Close()")
+	for rows.Next() {
+		if err := fn(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// backupTable writes the header and rows of the given table using the provided encoder, returning the number of rows
+func (db *Database) backupTable(tx *sql.Tx, enc *json.Encoder, t *backupTable) (int, error) {
+	// Write the table header
+	cols := make([]any, len(t.columns))
+	h := backupTableHeader{Table: t.name, Columns: make([]string, len(t.columns))}
+	for i, c := range t.columns {
+		h.Columns[i] = c.name
+		cols[i] = c.name
+	}
+	if err := enc.Encode(&h); err != nil {
+		return 0, err
+	}
+
+	// Query the rows
+	query, args, err := db.goquDB().From(t.name).Select(cols...).ToSQL()
+	if err != nil {
+		return 0, err
+	}
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer util.LogError(rows.Close, "db.backupTable, rows.Close()")
+
+	// Write the rows
+	cnt := 0
+	vals := make([]any, len(t.columns))
+	ptrs := make([]any, len(t.columns))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return 0, err
+		}
+		for i, c := range t.columns {
+			vals[i] = backupValue(c.kind, vals[i])
+		}
+		if err := enc.Encode(vals); err != nil {
+			return 0, err
+		}
+		cnt++
+	}
+	return cnt, rows.Err()
+}
+
+// backupTables returns descriptions of the tables to back up, in the order of their dependencies
+func (db *Database) backupTables() ([]*backupTable, error) {
+	// Fetch the names of regular tables
+	var query string
+	switch db.dialect {
+	case dbPostgres:
+		query = `select tablename from pg_tables where schemaname = 'public' and tablename like 'cm\_%'`
+	case dbSQLite3:
+		// Skip virtual (full-text search) tables, which are maintained by triggers, and their shadow tables
+		query = `select name from pragma_table_list where schema = 'main' and type = 'table' and name like 'cm\_%' escape '\'`
+	default:
+		return nil, errUnknownDialect
+	}
+	var names []string
+	if err := db.backupQuery(
+		func(rows *sql.Rows) error {
+			var s string
+			if err := rows.Scan(&s); err != nil {
+				return err
+			}
+			// Migration data is specific to the database, and import jobs to the host their data files are stored on
+			if s != "cm_migrations" && s != "cm_migration_log" && s != "cm_import_jobs" {
+				names = append(names, s)
+			}
+			return nil
+		},
+		query,
+	); err != nil {
+		return nil, err
+	}
+
+	// Sort the tables by their dependencies
+	fks, err := db.backupForeignKeys(names)
+	if err != nil {
+		return nil, err
+	}
+	if names, err = backupSortTables(names, fks); err != nil {
+		return nil, err
+	}
+
+	// Describe each table
+	res := make([]*backupTable, len(names))
+	for i, name := range names {
+		t := &backupTable{name: name}
+		switch db.dialect {
+		case dbPostgres:
+			query = `select column_name, data_type from information_schema.columns ` +
+				`where table_schema = 'public' and table_name = $1 order by ordinal_position`
+		case dbSQLite3:
+			query = `select name, type from pragma_table_info(?) order by cid`
+		}
+		if err := db.backupQuery(
+			func(rows *sql.Rows) error {
+				var col, typ string
+				if err := rows.Scan(&col, &typ); err != nil {
+					return err
+				}
+				t.columns = append(t.columns, backupColumn{name: col, kind: backupColumnKindOf(typ)})
+				return nil
+			},
+			query,
+			name,
+		); err != nil {
+			return nil, err
+		}
+		for _, fk := range fks {
+			if fk.table == name && fk.refTable == name {
+				t.selfRefs = append(t.selfRefs, fk)
+			}
+		}
+		res[i] = t
+	}
+	return res, nil
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+
+// restoreSelfRef is a postponed update of a column referencing the table itself
+type restoreSelfRef struct {
+	fk    *backupForeignKey // Foreign key the column belongs to
+	value any               // Column value
+	ref   any               // Value of the referenced column of the row to update
+}
+
+// tableRestorer inserts rows of a table read from a backup archive. Columns referencing the table itself are only
+// filled in once all rows have been inserted, because a row may be referenced by one coming before it
+type tableRestorer struct {
+	tx       *goqu.TxDatabase    // Transaction to run statements in
+	table    *backupTable        // Table being restored
+	columns  []*backupColumn     // Table columns, in the order of row values
+	batch    []any               // Rows waiting to be inserted
+	selfRefs []*backupForeignKey // Self-referencing foreign keys, whose columns come in the rows
+	updates  []restoreSelfRef    // Postponed self-reference updates
+	count    int                 // Number of rows read
+}
+
+// newTableRestorer returns a new tableRestorer for the given table, whose rows come with the specified columns
+func newTableRestorer(tx *goqu.TxDatabase, t *backupTable, columns []string) (*tableRestorer, error) {
+	tr := &tableRestorer{tx: tx, table: t, columns: make([]*backupColumn, len(columns))}
+	for i, name := range columns {
+		if tr.columns[i] = t.column(name); tr.columns[i] == nil {
+			return nil, fmt.Errorf("column %s doesn't exist", name)
+		}
+	}
+	for _, fk := range t.selfRefs {
+		if slices.Contains(columns, fk.column) && slices.Contains(columns, fk.refCol) {
+			tr.selfRefs = append(tr.selfRefs, fk)
+		}
+	}
+	return tr, nil
+}
+
+// add adds a row, given as a JSON array of values
+func (tr *tableRestorer) add(raw json.RawMessage) error {
+	tr.count++
+	var vals []any
+	if err := unmarshalJSONNumbers(raw, &vals); err != nil {
+		return err
+	} else if len(vals) != len(tr.columns) {
+		return fmt.Errorf("row %d has %d values, want %d", tr.count, len(vals), len(tr.columns))
+	}
+
+	// Convert the values
+	rec := goqu.Record{}
+	for i, c := range tr.columns {
+		v, err := restoreValue(c.kind, vals[i])
+		if err != nil {
+			return fmt.Errorf("row %d, column %s: %w", tr.count, c.name, err)
+		}
+		rec[c.name] = v
+	}
+
+	// Postpone setting the self-references
+	for _, fk := range tr.selfRefs {
+		if v := rec[fk.column]; v != nil {
+			tr.updates = append(tr.updates, restoreSelfRef{fk: fk, value: v, ref: rec[fk.refCol]})
+			rec[fk.column] = nil
+		}
+	}
+
+	// Insert the rows in batches
+	tr.batch = append(tr.batch, rec)
+	if len(tr.batch) < util.BackupBatchSize {
+		return nil
+	}
+	return tr.insert()
+}
+
+// finish inserts any remaining rows and fills in the self-references
+func (tr *tableRestorer) finish() error {
+	if err := tr.insert(); err != nil {
+		return err
+	}
+	for _, u := range tr.updates {
+		if _, err := tr.tx.Update(tr.table.name).
+			Set(goqu.Record{u.fk.column: u.value}).
+			Where(goqu.Ex{u.fk.refCol: u.ref}).
+			Executor().Exec(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insert inserts the rows waiting in the batch
+func (tr *tableRestorer) insert() error {
+	if len(tr.batch) > 0 {
+		if _, err := tr.tx.Insert(tr.table.name).Rows(tr.batch...).Executor().Exec(); err != nil {
+			return err
+		}
+		tr.batch = nil
+	}
+	return nil
+}
+
+// unmarshalJSONNumbers unmarshals the given JSON data into v, keeping numbers as json.Number
+func unmarshalJSONNumbers(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
@@ -0,0 +1,81 @@
+//go:build sqlite_fts5
+
+package persistence
+
+import (
+	"bytes"
+	"gitlab.com/comentario/comentario/internal/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestDatabase_BackupRestore backs up a seeded SQLite database, restores it into a new one, and verifies a backup of the
+// latter matches the original
+func TestDatabase_BackupRestore(t *testing.T) {
+	seed, err := os.ReadFile("../../e2e/plugin/db-seed.sql")
+	if err != nil {
+		t.Fatalf("ReadFile() failed: %v", err)
+	}
+	config.ServerConfig.DBMigrationPath = "../../db"
+	dir := t.TempDir()
+
+	// Create and seed the source database
+	src := testSQLiteDB(t, filepath.Join(dir, "src.db"))
+	if err := src.Migrate(string(seed)); err != nil {
+		t.Fatalf("Migrate() failed: %v", err)
+	}
+
+	// Back it up
+	var archive bytes.Buffer
+	trailer, err := src.Backup(&archive)
+	if err != nil {
+		t.Fatalf("Backup() failed: %v", err)
+	} else if trailer.Tables == 0 || trailer.Rows == 0 {
+		t.Fatalf("Backup() backed up nothing: %+v", trailer)
+	}
+	if strings.Contains(archive.String(), `"cm_import_jobs"`) {
+		t.Errorf("Backup() included import jobs")
+	}
+
+	// Restoring into a non-empty database must fail
+	if _, err := src.Restore(bytes.NewReader(archive.Bytes())); err == nil {
+		t.Errorf("Restore() into a non-empty database succeeded")
+	}
+
+	// Restore the archive into a new database
+	dst := testSQLiteDB(t, filepath.Join(dir, "dst.db"))
+	restored, err := dst.Restore(bytes.NewReader(archive.Bytes()))
+	if err != nil {
+		t.Fatalf("Restore() failed: %v", err)
+	} else if *restored != *trailer {
+		t.Errorf("Restore() got = %+v, want %+v", restored, trailer)
+	}
+
+	// Back the restored database up, too: both archives must only differ in the header, which holds the creation time
+	var archive2 bytes.Buffer
+	if _, err := dst.Backup(&archive2); err != nil {
+		t.Fatalf("Backup() of restored database failed: %v", err)
+	}
+	_, body, _ := strings.Cut(archive.String(), "\n")
+	_, body2, _ := strings.Cut(archive2.String(), "\n")
+	if body != body2 {
+		t.Errorf("Backup() of restored database differs from the original")
+	}
+}
+
+// testSQLiteDB connects to a new SQLite database stored in the given file and installs all migrations
+func testSQLiteDB(t *testing.T, fileName string) *Database {
+	config.SecretsConfig.SQLite3.File = fileName
+	db, err := InitDB()
+	if err != nil {
+		t.Fatalf("InitDB() failed: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := db.Shutdown(); err != nil {
+			t.Errorf("Shutdown() failed: %v", err)
+		}
+	})
+	return db
+}
@@ -0,0 +1,139 @@
+package persistence
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_backupColumnKindOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		typeName string
+		want     backupColumnKind
+	}{
+		{"empty            ", "", backupKindText},
+		{"text             ", "text", backupKindText},
+		{"varchar          ", "VARCHAR(128)", backupKindText},
+		{"uuid             ", "uuid", backupKindText},
+		{"boolean          ", "boolean", backupKindBool},
+		{"BOOLEAN          ", "BOOLEAN", backupKindBool},
+		{"integer          ", "integer", backupKindInt},
+		{"bigint           ", "bigint", backupKindInt},
+		{"smallint         ", "smallint", backupKindInt},
+		{"double precision ", "double precision", backupKindFloat},
+		{"real             ", "REAL", backupKindFloat},
+		{"numeric          ", "numeric(5,2)", backupKindFloat},
+		{"timestamp        ", "timestamp", backupKindTime},
+		{"timestamp with tz", "timestamp with time zone", backupKindTime},
+		{"date             ", "date", backupKindTime},
+		{"bytea            ", "bytea", backupKindBytes},
+		{"blob             ", "BLOB", backupKindBytes},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := backupColumnKindOf(tt.typeName); got != tt.want {
+				t.Errorf("backupColumnKindOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_backupSortTables(t *testing.T) {
+	fk := func(table, refTable string) *backupForeignKey {
+		return &backupForeignKey{table: table, column: "ref_id", refTable: refTable, refCol: "id"}
+	}
+	tests := []struct {
+		name    string
+		names   []string
+		fks     []*backupForeignKey
+		want    []string
+		wantErr bool
+	}{
+		{"empty                 ", nil, nil, []string{}, false},
+		{"no references         ", []string{"c", "a", "b"}, nil, []string{"a", "b", "c"}, false},
+		{"self-reference        ", []string{"b", "a"}, []*backupForeignKey{fk("a", "a")}, []string{"a", "b"}, false},
+		{"chain                 ", []string{"a", "b", "c"}, []*backupForeignKey{fk("a", "b"), fk("b", "c")}, []string{"c", "b", "a"}, false},
+		{"diamond               ", []string{"d", "c", "b", "a"}, []*backupForeignKey{fk("a", "b"), fk("a", "c"), fk("b", "d"), fk("c", "d")}, []string{"d", "b", "c", "a"}, false},
+		{"unknown table ignored ", []string{"a", "b"}, []*backupForeignKey{fk("a", "x"), fk("x", "b")}, []string{"a", "b"}, false},
+		{"cycle                 ", []string{"a", "b", "c"}, []*backupForeignKey{fk("a", "b"), fk("b", "a")}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := backupSortTables(tt.names, tt.fks)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("backupSortTables() error = %v, want error = %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("backupSortTables() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_backupValue(t *testing.T) {
+	tm := time.Date(2024, 5, 6, 7, 8, 9, 10, time.FixedZone("X", 3600))
+	tests := []struct {
+		name string
+		kind backupColumnKind
+		v    any
+		want any
+	}{
+		{"nil          ", backupKindText, nil, nil},
+		{"string       ", backupKindText, "foo", "foo"},
+		{"bytes as text", backupKindText, []byte("foo"), "foo"},
+		{"bytes        ", backupKindBytes, []byte("foo"), []byte("foo")},
+		{"int          ", backupKindInt, int64(42), int64(42)},
+		{"int as bool 0", backupKindBool, int64(0), false},
+		{"int as bool 1", backupKindBool, int64(1), true},
+		{"bool         ", backupKindBool, true, true},
+		{"time         ", backupKindTime, tm, tm.UTC()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := backupValue(tt.kind, tt.v); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("backupValue() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_restoreValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		kind    backupColumnKind
+		v       any
+		want    any
+		wantErr bool
+	}{
+		{"nil              ", backupKindText, nil, nil, false},
+		{"string           ", backupKindText, "foo", "foo", false},
+		{"number as int    ", backupKindInt, json.Number("42"), int64(42), false},
+		{"number as float  ", backupKindFloat, json.Number("1.5"), 1.5, false},
+		{"number as bool 0 ", backupKindBool, json.Number("0"), false, false},
+		{"number as bool 1 ", backupKindBool, json.Number("1"), true, false},
+		{"number as text   ", backupKindText, json.Number("17"), "17", false},
+		{"invalid int      ", backupKindInt, json.Number("1.5"), nil, true},
+		{"bool             ", backupKindBool, true, true, false},
+		{"bool as int      ", backupKindInt, true, 1, false},
+		{"bytes            ", backupKindBytes, "Zm9v", []byte("foo"), false},
+		{"invalid bytes    ", backupKindBytes, "!!", nil, true},
+		{"time             ", backupKindTime, "2024-05-06T07:08:09.00000001+01:00", time.Date(2024, 5, 6, 6, 8, 9, 10, time.UTC), false},
+		{"invalid time     ", backupKindTime, "yesterday", "yesterday", false},
+		{"unsupported type ", backupKindText, []any{}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := restoreValue(tt.kind, tt.v)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("restoreValue() error = %v, want error = %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("restoreValue() got = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
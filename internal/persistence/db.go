@@ -137,6 +137,11 @@ func InitDB() (*Database, error) {
 		return nil, err
 	}
 
+	// Make sure the database provides all the features the schema relies on
+	if err := db.verifyFeatures(); err != nil {
+		return nil, err
+	}
+
 	// Run migrations
 	if err := db.Migrate(""); err != nil {
 		return nil, err
@@ -180,6 +185,44 @@ func (db *Database) From(v ...any) *goqu.SelectDataset {
 	return db.goquDB().From(v...)
 }
 
+// FullTextSearch narrows down the given query, selecting from the given table under the given alias, to the rows whose
+// text column matches all the given search terms (words or phrases), using the table's full-text index. Returns the
+// updated query, along with an expression for ordering the matches by relevance, most relevant first. The index is
+// expected to be an expression index on to_tsvector('simple', <col>) for PostgreSQL, and an FTS5 table called
+// <table>_fts, holding the row's id and col, for SQLite
+func (db *Database) FullTextSearch(
+	q *goqu.SelectDataset, table, alias, col string, terms []string,
+) (*goqu.SelectDataset, exp.OrderedExpression) {
+	var rank exp.OrderedExpression
+	switch db.dialect {
+	case dbPostgres:
+		// Make up a tsquery requiring every term, each treated as a phrase
+		var qs []string
+		var args []any
+		for _, t := range terms {
+			qs = append(qs, "phraseto_tsquery('simple', ?)")
+			args = append(args, t)
+		}
+		doc := fmt.Sprintf(`to_tsvector('simple', "%s"."%s")`, alias, col)
+		tsq := "(" + strings.Join(qs, " && ") + ")"
+		q = q.Where(goqu.L(doc+" @@ "+tsq, args...))
+		rank = goqu.L("ts_rank("+doc+", "+tsq+")", args...).Desc()
+
+	case dbSQLite3:
+		// Make up an FTS5 query requiring every term, each quoted as a phrase
+		qs := make([]string, len(terms))
+		for i, t := range terms {
+			qs[i] = `"` + strings.ReplaceAll(t, `"`, `""`) + `"`
+		}
+		fts := table + "_fts"
+		q = q.
+			Join(goqu.T(fts), goqu.On(goqu.Ex{fts + ".id": goqu.I(alias + ".id")})).
+			Where(goqu.L("? match ?", goqu.I(fts), strings.Join(qs, " ")))
+		rank = goqu.L("bm25(?)", goqu.I(fts)).Asc()
+	}
+	return q, rank
+}
+
 // Insert returns a new InsertDataset
 func (db *Database) Insert(table any) *goqu.InsertDataset {
 	return db.goquDB().Insert(table)
@@ -374,6 +417,12 @@ func (db *Database) Version() string {
 	return db.version
 }
 
+// WithTx runs the given function within a database transaction, which is committed if the function succeeds, and rolled
+// back if it returns an error or panics. All statements inside the function must be run against the passed tx
+func (db *Database) WithTx(fn func(tx *goqu.TxDatabase) error) error {
+	return db.goquDB().WithTx(fn)
+}
+
 // connect establishes a database connection up to the configured number of attempts
 func (db *Database) connect() error {
 	logger.Infof("Connecting to database %s", db.getConnectString(true))
@@ -684,3 +733,17 @@ func (db *Database) tryConnect(num, total int) (err error) {
 	}
 	return
 }
+
+// verifyFeatures checks the database engine provides all the features required by the schema
+func (db *Database) verifyFeatures() error {
+	if db.dialect == dbSQLite3 {
+		// Comment search relies on FTS5, which the SQLite driver only includes when built with the sqlite_fts5 tag
+		var ok bool
+		if err := db.db.QueryRow("select sqlite_compileoption_used('ENABLE_FTS5')").Scan(&ok); err != nil {
+			return fmt.Errorf("failed to check SQLite FTS5 support: %w", err)
+		} else if !ok {
+			return errors.New("SQLite is built without FTS5 full-text search support, rebuild Comentario with '-tags sqlite_fts5'")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package svc
+
+import (
+	"github.com/doug-martin/goqu/v9"
+	"github.com/google/uuid"
+	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/util"
+	"time"
+)
+
+// TheAuditService is a global AuditService implementation
+var TheAuditService AuditService = &auditService{}
+
+// AuditService is a service interface for dealing with the audit log
+type AuditService interface {
+	// List fetches and returns a page of audit log entries, most recent first. All filters are optional:
+	//   - userID is the ID of the user who performed the action.
+	//   - domainID is the ID of the domain the action relates to.
+	//   - targetID is the ID of the object affected by the action.
+	//   - action is the action performed.
+	//   - from and to limit the entry creation time range (from is inclusive, to is exclusive).
+	//   - pageIndex is the page index, if negative, no pagination is applied.
+	List(userID, domainID, targetID *uuid.UUID, action data.AuditAction, from, to *time.Time, pageIndex int) ([]*data.AuditEntry, error)
+	// Record adds the given entry to the audit log. A failure is logged rather than returned, since the audited action
+	// has already been carried out by then
+	Record(e *data.AuditEntry)
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+
+// auditService is a blueprint AuditService implementation
+type auditService struct{}
+
+func (svc *auditService) List(userID, domainID, targetID *uuid.UUID, action data.AuditAction, from, to *time.Time, pageIndex int) ([]*data.AuditEntry, error) {
+	logger.Debugf("auditService.List(%s, %s, %s, '%s', %v, %v, %d)", userID, domainID, targetID, action, from, to, pageIndex)
+
+	// Prepare a query
+	q := db.From("cm_audit_log").Order(goqu.I("ts_created").Desc(), goqu.I("id").Asc())
+
+	// Apply filters
+	if userID != nil {
+		q = q.Where(goqu.Ex{"user_id": userID})
+	}
+	if domainID != nil {
+		q = q.Where(goqu.Ex{"domain_id": domainID})
+	}
+	if targetID != nil {
+		q = q.Where(goqu.Ex{"target_id": targetID})
+	}
+	if action != "" {
+		q = q.Where(goqu.Ex{"action": action})
+	}
+	if from != nil {
+		q = q.Where(goqu.I("ts_created").Gte(*from))
+	}
+	if to != nil {
+		q = q.Where(goqu.I("ts_created").Lt(*to))
+	}
+
+	// Paginate if required
+	if pageIndex >= 0 {
+		q = q.Limit(util.ResultPageSize).Offset(uint(pageIndex) * util.ResultPageSize)
+	}
+
+	// Query the entries
+	var res []*data.AuditEntry
+	if err := q.ScanStructs(&res); err != nil {
+		logger.Errorf("auditService.List: ScanStructs() failed: %v", err)
+		return nil, translateDBErrors(err)
+	}
+
+	// Succeeded
+	return res, nil
+}
+
+func (svc *auditService) Record(e *data.AuditEntry) {
+	logger.Debugf("auditService.Record(%#v)", e)
+
+	// Insert a new record
+	if err := db.ExecOne(db.Insert("cm_audit_log").Rows(e)); err != nil {
+		logger.Errorf("auditService.Record: ExecOne() failed: %v", err)
+	}
+}
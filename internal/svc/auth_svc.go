@@ -5,17 +5,21 @@ import (
 	"errors"
 	"fmt"
 	oaerrors "github.com/go-openapi/errors"
+	"github.com/go-openapi/runtime/middleware"
 	"github.com/google/uuid"
 	"gitlab.com/comentario/comentario/internal/api/exmodels"
+	"gitlab.com/comentario/comentario/internal/api/models"
 	"gitlab.com/comentario/comentario/internal/data"
 	"gitlab.com/comentario/comentario/internal/util"
 	"net/http"
+	"strings"
 )
 
 var (
 	ErrSessionHeaderMissing = errors.New("session auth header missing in request")
 
 	ErrUnauthorised  = oaerrors.New(http.StatusUnauthorized, "Unauthorized")
+	ErrForbidden     = oaerrors.New(http.StatusForbidden, "Forbidden")
 	ErrInternalError = oaerrors.New(http.StatusInternalServerError, "Internal Server Error")
 )
 
@@ -29,8 +33,14 @@ type AuthService interface {
 	AuthenticateBearerToken(tokenStr string, scopes []string) (*data.User, error)
 	// AuthenticateUserByCookieHeader tries to fetch the user owning the session contained in the Cookie header
 	AuthenticateUserByCookieHeader(headerValue string) (*data.User, error)
+	// AuthenticateUserByPersonalToken tries to fetch the user owning the personal token contained in the Authorization
+	// header
+	AuthenticateUserByPersonalToken(headerValue string) (*data.User, error)
 	// AuthenticateUserBySessionHeader tries to fetch the user owning the session contained in the X-User-Session header
 	AuthenticateUserBySessionHeader(headerValue string) (*data.User, error)
+	// AuthorizeRequest verifies the authenticated principal is allowed to make the given API request. This only
+	// restricts requests authenticated with a personal token, to the token's scopes and domains
+	AuthorizeRequest(r *http.Request, principal any) error
 	// ExtractUserSessionIDs parses and return the given string value that combines user and session ID
 	ExtractUserSessionIDs(s string) (*uuid.UUID, *uuid.UUID, error)
 	// FetchUserBySessionHeader tries to fetch the user and their session by the session token contained in the
@@ -104,6 +114,49 @@ func (svc *authService) AuthenticateUserByCookieHeader(headerValue string) (*dat
 	return u, nil
 }
 
+// AuthenticateUserByPersonalToken tries to fetch the user owning the personal token contained in the Authorization
+// header
+func (svc *authService) AuthenticateUserByPersonalToken(headerValue string) (*data.User, error) {
+	// Extract the token value from the header, which is expected to contain a bearer token
+	const bearer = "Bearer "
+	if len(headerValue) <= len(bearer) || !strings.EqualFold(headerValue[:len(bearer)], bearer) {
+		return nil, ErrUnauthorised
+	}
+	value := strings.TrimSpace(headerValue[len(bearer):])
+	if !strings.HasPrefix(value, data.PersonalTokenPrefix) {
+		return nil, ErrUnauthorised
+	}
+
+	// Find the token
+	token, err := ThePersonalTokenService.FindByValue(value)
+	if err != nil {
+		return nil, ErrUnauthorised
+	}
+
+	// Token seems legitimate, now find its owner
+	user, err := TheUserService.FindUserByID(&token.UserID)
+	if err != nil {
+		return nil, ErrInternalError
+
+		// Verify the user is allowed to authenticate
+	} else if errm := svc.UserCanAuthenticate(user, true); errm != nil {
+		logger.Warningf("Failed to authenticate user %s by personal token: %v", &user.ID, errm)
+		return nil, ErrUnauthorised
+	}
+
+	// Register the token usage, ignoring any error
+	_ = ThePersonalTokenService.MarkUsed(token)
+
+	// Superuser privileges require an explicit scope
+	if !token.HasScope(models.PersonalTokenScopeSuperuserDashAdmin) {
+		user.IsSuperuser = false
+	}
+
+	// Succeeded
+	user.PersonalToken = token
+	return user, nil
+}
+
 // AuthenticateUserBySessionHeader tries to fetch the user owning the session contained in the X-User-Session header
 func (svc *authService) AuthenticateUserBySessionHeader(headerValue string) (*data.User, error) {
 	if user, _, err := svc.FetchUserBySessionHeader(headerValue); err != nil {
@@ -115,6 +168,37 @@ func (svc *authService) AuthenticateUserBySessionHeader(headerValue string) (*da
 	}
 }
 
+// AuthorizeRequest verifies the authenticated principal is allowed to make the given API request. This only restricts
+// requests authenticated with a personal token, to the token's scopes and domains
+func (svc *authService) AuthorizeRequest(r *http.Request, principal any) error {
+	// Skip unless it's a user authenticated with a personal token
+	user, ok := principal.(*data.User)
+	if !ok || user.PersonalToken == nil {
+		return nil
+	}
+	token := user.PersonalToken
+
+	// Verify the token's scopes allow for the operation
+	route := middleware.MatchedRouteFrom(r)
+	if route == nil || !token.AllowsOperation(r.Method, route.PathPattern) {
+		logger.Warningf("Personal token %s isn't allowed to %s %s", &token.ID, r.Method, r.URL.Path)
+		return ErrForbidden
+	}
+
+	// If the token is restricted to specific domains, verify the request pertains to one of them
+	if token.IsDomainRestricted() {
+		if domainID, err := svc.requestDomainID(r, route); err != nil {
+			return ErrInternalError
+		} else if domainID == nil || !token.AllowsDomain(domainID) {
+			logger.Warningf("Personal token %s isn't allowed to %s %s on this domain", &token.ID, r.Method, r.URL.Path)
+			return ErrForbidden
+		}
+	}
+
+	// Succeeded
+	return nil
+}
+
 // ExtractUserSessionIDs parses and return the given string value that combines user and session ID
 func (svc *authService) ExtractUserSessionIDs(s string) (*uuid.UUID, *uuid.UUID, error) {
 	// Decode the value from base64
@@ -229,3 +313,45 @@ func (svc *authService) UserCanAuthenticate(user *data.User, requireConfirmed bo
 	// Succeeded
 	return nil
 }
+
+// requestDomainID determines the ID of the domain the given API request pertains to, based on the entity ID in the
+// path or, if the operation accepts it, on the domain query parameter. Returns nil if there's no such domain
+func (svc *authService) requestDomainID(r *http.Request, route *middleware.MatchedRoute) (*uuid.UUID, error) {
+	// Check for an entity ID passed in the path
+	if id, err := uuid.Parse(route.Params.Get("uuid")); err == nil {
+		var page *data.DomainPage
+		switch {
+		case strings.HasPrefix(route.PathPattern, "/domains/{uuid}"):
+			return &id, nil
+
+		case strings.HasPrefix(route.PathPattern, "/domain-pages/{uuid}"):
+			page, err = ThePageService.FindByID(&id)
+
+		case strings.HasPrefix(route.PathPattern, "/comments/{uuid}"):
+			var comment *data.Comment
+			if comment, err = TheCommentService.FindByID(&id); err == nil {
+				page, err = ThePageService.FindByID(&comment.PageID)
+			}
+		}
+
+		// A non-existent entity doesn't belong to any domain
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		} else if page != nil {
+			return &page.DomainID, nil
+		}
+	}
+
+	// Check for a domain ID passed in the query, but only if the operation declares such a parameter: it's ignored
+	// otherwise
+	for _, p := range route.Parameters {
+		if p.In == "query" && p.Name == "domain" {
+			if id, err := uuid.Parse(r.URL.Query().Get("domain")); err == nil {
+				return &id, nil
+			}
+		}
+	}
+	return nil, nil
+}
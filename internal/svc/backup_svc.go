@@ -0,0 +1,95 @@
+package svc
+
+import (
+	"compress/gzip"
+	"gitlab.com/comentario/comentario/internal/util"
+	"os"
+	"path/filepath"
+)
+
+// TheBackupService is a global BackupService implementation
+var TheBackupService BackupService = &backupService{}
+
+// BackupService is a service interface for backing up and restoring the entire instance
+type BackupService interface {
+	// Backup writes a consistent, gzip-compressed archive of all instance data into the file with the given name
+	Backup(fileName string) error
+	// Restore replaces all instance data with that from the archive file with the given name. The archive must have
+	// been made on the same database schema version, but possibly on a different database backend. The instance must
+	// contain no domains or users
+	Restore(fileName string) error
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+
+// backupService is a blueprint BackupService implementation
+type backupService struct{}
+
+func (svc *backupService) Backup(fileName string) error {
+	logger.Debugf("backupService.Backup(%q)", fileName)
+
+	// Write into a temporary file first, so that a failed backup doesn't leave a partial archive behind
+	f, err := os.CreateTemp(filepath.Dir(fileName), filepath.Base(fileName)+".*.tmp")
+	if err != nil {
+		logger.Errorf("backupService.Backup: CreateTemp() failed: %v", err)
+		return err
+	}
+	tmpName := f.Name()
+	defer func() {
+		if _, err := os.Stat(tmpName); err == nil {
+			util.LogError(func() error { return os.Remove(tmpName) }, "backupService.Backup, os.Remove()")
+		}
+	}()
+
+	// Compress the data as it's being written
+	gw := gzip.NewWriter(f)
+	trailer, err := db.Backup(gw)
+	if err == nil {
+		err = gw.Close()
+	}
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		logger.Errorf("backupService.Backup: failed to write archive: %v", err)
+		return err
+	}
+
+	// Move the file in place
+	if err := os.Rename(tmpName, fileName); err != nil {
+		logger.Errorf("backupService.Backup: Rename() failed: %v", err)
+		return err
+	}
+
+	// Succeeded
+	logger.Infof("Backed up %d rows in %d tables into %s", trailer.Rows, trailer.Tables, fileName)
+	return nil
+}
+
+func (svc *backupService) Restore(fileName string) error {
+	logger.Debugf("backupService.Restore(%q)", fileName)
+
+	// Open the archive
+	f, err := os.Open(fileName)
+	if err != nil {
+		logger.Errorf("backupService.Restore: Open() failed: %v", err)
+		return err
+	}
+	defer util.LogError(f.Close, "backupService.Restore, f.Close()")
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		logger.Errorf("backupService.Restore: NewReader() failed: %v", err)
+		return err
+	}
+
+	// Restore the data
+	trailer, err := db.Restore(gr)
+	if err != nil {
+		logger.Errorf("backupService.Restore: failed to restore archive: %v", err)
+		return err
+	}
+
+	// Succeeded
+	logger.Infof("Restored %d rows in %d tables from %s", trailer.Rows, trailer.Tables, fileName)
+	return nil
+}
@@ -2,6 +2,8 @@ package svc
 
 import (
 	"github.com/doug-martin/goqu/v9"
+	"gitlab.com/comentario/comentario/internal/config"
+	"gitlab.com/comentario/comentario/internal/data"
 	"gitlab.com/comentario/comentario/internal/persistence"
 	"gitlab.com/comentario/comentario/internal/util"
 	"time"
@@ -18,10 +20,12 @@ type cleanupService struct{}
 
 func (svc *cleanupService) Init() error {
 	logger.Debugf("cleanupService: initialising")
+	go svc.cleanupStaleAuditEntries()
 	go svc.cleanupExpiredAuthSessions()
 	go svc.cleanupExpiredTokens()
 	go svc.cleanupExpiredUserSessions()
 	go svc.cleanupStalePageViews()
+	go svc.cleanupStaleWebhookDeliveries()
 	return nil
 }
 
@@ -61,6 +65,24 @@ func (svc *cleanupService) cleanupExpiredUserSessions() {
 	}
 }
 
+// cleanupStaleAuditEntries removes audit log entries older than the configured retention period from the database
+func (svc *cleanupService) cleanupStaleAuditEntries() {
+	logger.Debug("cleanupService.cleanupStaleAuditEntries()")
+
+	// Zero retention means entries are kept forever
+	days := config.ServerConfig.AuditRetentionDays
+	if days <= 0 {
+		return
+	}
+	for svc.runLogSleep(
+		util.OneDay,
+		"stale audit log entries",
+		db.Delete("cm_audit_log").
+			Where(goqu.I("ts_created").Lt(time.Now().UTC().AddDate(0, 0, -days))),
+	) == nil {
+	}
+}
+
 // cleanupStalePageViews removes stale page view stats from the database
 func (svc *cleanupService) cleanupStalePageViews() {
 	logger.Debug("cleanupService.cleanupStalePageViews()")
@@ -73,6 +95,20 @@ func (svc *cleanupService) cleanupStalePageViews() {
 	}
 }
 
+// cleanupStaleWebhookDeliveries removes stale completed (succeeded or failed) webhook deliveries from the database
+func (svc *cleanupService) cleanupStaleWebhookDeliveries() {
+	logger.Debug("cleanupService.cleanupStaleWebhookDeliveries()")
+	for svc.runLogSleep(
+		util.OneDay,
+		"stale webhook deliveries",
+		db.Delete("cm_webhook_deliveries").
+			Where(
+				goqu.I("status").Neq(data.WebhookDeliveryStatusPending),
+				goqu.I("ts_created").Lt(time.Now().UTC().Add(-util.WebhookDeliveryRetention))),
+	) == nil {
+	}
+}
+
 // runLogSleep runs the provided cleanup query, logs the outcome, then sleeps for the given duration
 func (svc *cleanupService) runLogSleep(interval time.Duration, entity string, x persistence.Executable) error {
 	if res, err := x.Executor().Exec(); err != nil {
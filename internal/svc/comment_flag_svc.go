@@ -0,0 +1,132 @@
+package svc
+
+import (
+	"github.com/doug-martin/goqu/v9"
+	"github.com/google/uuid"
+	"gitlab.com/comentario/comentario/internal/data"
+	"time"
+)
+
+// TheCommentFlagService is a global CommentFlagService implementation
+var TheCommentFlagService CommentFlagService = &commentFlagService{}
+
+// CommentFlagService is a service interface for dealing with comment flags (user reports)
+type CommentFlagService interface {
+	// Add persists the given flag, unless the comment has already been flagged by the same user or, for unregistered
+	// users, from the same IP address (whether or not that flag was dismissed). Returns whether the flag was added
+	Add(f *data.CommentFlag) (bool, error)
+	// CountActive returns the number of active (not dismissed) flags for the comment with the given ID
+	CountActive(commentID *uuid.UUID) (int, error)
+	// CountCreatedSince returns the number of flags submitted since the given time from the IP address with the given
+	// hash (see util.HashIP())
+	CountCreatedSince(ipHash string, since time.Time) (int64, error)
+	// Dismiss marks all active flags for the comment with the given ID dismissed by the given user, returning the
+	// number of dismissed flags
+	Dismiss(commentID, userID *uuid.UUID) (int64, error)
+	// ListActive returns active (not dismissed) flags for the comments with the given IDs, most recent first
+	ListActive(commentIDs []uuid.UUID) ([]*data.CommentFlag, error)
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+
+// commentFlagService is a blueprint CommentFlagService implementation
+type commentFlagService struct{}
+
+func (svc *commentFlagService) Add(f *data.CommentFlag) (bool, error) {
+	logger.Debugf("commentFlagService.Add(%#v)", f)
+
+	// Check for an existing flag by the same user, or from the same IP if the user is anonymous
+	q := db.From("cm_comment_flags").Where(goqu.Ex{"comment_id": &f.CommentID})
+	if f.UserID.UUID == data.AnonymousUser.ID {
+		q = q.Where(goqu.Ex{"user_id": &data.AnonymousUser.ID, "ip_hash": f.IPHash})
+	} else {
+		q = q.Where(goqu.Ex{"user_id": &f.UserID})
+	}
+	if cnt, err := q.Count(); err != nil {
+		logger.Errorf("commentFlagService.Add: Count() failed: %v", err)
+		return false, translateDBErrors(err)
+	} else if cnt > 0 {
+		return false, nil
+	}
+
+	// Insert a new record
+	if err := db.ExecOne(db.Insert("cm_comment_flags").Rows(f)); err != nil {
+		logger.Errorf("commentFlagService.Add: ExecOne() failed: %v", err)
+		return false, translateDBErrors(err)
+	}
+
+	// Succeeded
+	return true, nil
+}
+
+func (svc *commentFlagService) CountActive(commentID *uuid.UUID) (int, error) {
+	logger.Debugf("commentFlagService.CountActive(%s)", commentID)
+
+	// Query the flag count
+	cnt, err := db.From("cm_comment_flags").Where(goqu.Ex{"comment_id": commentID, "ts_dismissed": nil}).Count()
+	if err != nil {
+		logger.Errorf("commentFlagService.CountActive: Count() failed: %v", err)
+		return 0, translateDBErrors(err)
+	}
+
+	// Succeeded
+	return int(cnt), nil
+}
+
+func (svc *commentFlagService) CountCreatedSince(ipHash string, since time.Time) (int64, error) {
+	logger.Debugf("commentFlagService.CountCreatedSince(%q, %v)", ipHash, since)
+
+	// Query the flag count
+	cnt, err := db.From("cm_comment_flags").Where(goqu.Ex{"ip_hash": ipHash}, goqu.I("ts_created").Gte(since)).Count()
+	if err != nil {
+		logger.Errorf("commentFlagService.CountCreatedSince: Count() failed: %v", err)
+		return 0, translateDBErrors(err)
+	}
+
+	// Succeeded
+	return cnt, nil
+}
+
+func (svc *commentFlagService) Dismiss(commentID, userID *uuid.UUID) (int64, error) {
+	logger.Debugf("commentFlagService.Dismiss(%s, %s)", commentID, userID)
+
+	// Update all active flags of the comment
+	res, err := db.Update("cm_comment_flags").
+		Set(goqu.Record{"ts_dismissed": time.Now().UTC(), "user_dismissed": userID}).
+		Where(goqu.Ex{"comment_id": commentID, "ts_dismissed": nil}).
+		Executor().Exec()
+	if err != nil {
+		logger.Errorf("commentFlagService.Dismiss: Exec() failed: %v", err)
+		return 0, translateDBErrors(err)
+	}
+	cnt, err := res.RowsAffected()
+	if err != nil {
+		logger.Errorf("commentFlagService.Dismiss: RowsAffected() failed: %v", err)
+		return 0, translateDBErrors(err)
+	}
+
+	// Succeeded
+	return cnt, nil
+}
+
+func (svc *commentFlagService) ListActive(commentIDs []uuid.UUID) ([]*data.CommentFlag, error) {
+	logger.Debugf("commentFlagService.ListActive(%v)", commentIDs)
+
+	// Don't bother querying if there are no comments
+	if len(commentIDs) == 0 {
+		return nil, nil
+	}
+
+	// Query the flags
+	var res []*data.CommentFlag
+	if err := db.From("cm_comment_flags").
+		Where(goqu.I("comment_id").In(commentIDs), goqu.Ex{"ts_dismissed": nil}).
+		Order(goqu.I("ts_created").Desc(), goqu.I("id").Asc()).
+		ScanStructs(&res); err != nil {
+		logger.Errorf("commentFlagService.ListActive: ScanStructs() failed: %v", err)
+		return nil, translateDBErrors(err)
+	}
+
+	// Succeeded
+	return res, nil
+}
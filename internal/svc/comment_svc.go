@@ -2,10 +2,12 @@ package svc
 
 import (
 	"database/sql"
+	"errors"
 	"github.com/doug-martin/goqu/v9"
 	"github.com/doug-martin/goqu/v9/exp"
 	"github.com/go-openapi/strfmt"
 	"github.com/google/uuid"
+	"gitlab.com/comentario/comentario/extend/plugin"
 	"gitlab.com/comentario/comentario/internal/api/models"
 	"gitlab.com/comentario/comentario/internal/data"
 	"gitlab.com/comentario/comentario/internal/util"
@@ -18,6 +20,8 @@ var TheCommentService CommentService = &commentService{}
 
 // CommentService is a service interface for dealing with comments
 type CommentService interface {
+	// Assign assigns the comment with the given ID to the given moderator, or unassigns it if userID is nil
+	Assign(commentID, userID *uuid.UUID) error
 	// Count returns number of comments for the given domain and, optionally, page.
 	//   - curUser is the current authenticated/anonymous user.
 	//   - curDomainUser is the current domain user (can be nil).
@@ -31,17 +35,24 @@ type CommentService interface {
 	Count(
 		curUser *data.User, curDomainUser *data.DomainUser, domainID, pageID, userID *uuid.UUID,
 		inclApproved, inclPending, inclRejected, inclDeleted bool) (int64, error)
+	// CountCreatedSince returns the number of comments, regardless of their status, created on the given domain since
+	// the given time.
+	//   - pageID is an optional page ID to filter the result by.
+	//   - userID is an optional author user ID to filter the result by.
+	//   - authorIPHash is an optional hash of the author's full IP address (see util.HashIP()) to filter the result by.
+	CountCreatedSince(domainID, pageID, userID *uuid.UUID, authorIPHash string, since time.Time) (int64, error)
 	// Create creates, persists, and returns a new comment
 	Create(comment *data.Comment) error
 	// DeleteByUser permanently deletes all comments by the specified user, returning the affected comment count
 	DeleteByUser(userID *uuid.UUID) (int64, error)
-	// Edited persists the text changes of the given comment in the database
-	Edited(comment *data.Comment) error
+	// Edited persists the text changes of the given comment in the database. prev is an optional revision holding the
+	// comment's previous text, which is stored unless it's identical to the current one
+	Edited(comment *data.Comment, prev *data.CommentRevision) error
 	// FindByID finds and returns a comment with the given ID
 	FindByID(id *uuid.UUID) (*data.Comment, error)
-	// ListByDomain returns a list of comments for the given domain. No comment property filtering is applied, so
-	// minimum access privileges are domain moderator
-	ListByDomain(domainID *uuid.UUID) ([]*models.Comment, error)
+	// ListFlagged returns a page of comments on the given domain having active (not dismissed) flags, along with their
+	// commenters, the most flagged comments first. Minimum access privileges are domain moderator
+	ListFlagged(curUser *data.User, curDomainUser *data.DomainUser, domainID *uuid.UUID, pageIndex int) ([]*models.Comment, map[uuid.UUID]*models.Commenter, error)
 	// ListWithCommenters returns a list of comments and related commenters for the given domain and, optionally, page
 	// and/or user.
 	//   - curUser is the current authenticated/anonymous user.
@@ -65,12 +76,47 @@ type CommentService interface {
 		curUser *data.User, curDomainUser *data.DomainUser, domainID, pageID, authorUserID, replyToUserID *uuid.UUID,
 		inclApproved, inclPending, inclRejected, inclDeleted, removeOrphans bool, filter, sortBy string, dir data.SortDirection,
 		pageIndex int) ([]*models.Comment, map[uuid.UUID]*models.Commenter, error)
-	// MarkDeleted marks a comment with the given ID deleted by the given user
+	// ListQueue returns a page of comments on the given domain pending moderation, along with their commenters, oldest
+	// first. Minimum access privileges are domain moderator.
+	//   - assigneeID is an optional moderator user ID to only include comments assigned to.
+	//   - unassigned indicates whether to only include comments not assigned to anyone.
+	ListQueue(
+		curUser *data.User, curDomainUser *data.DomainUser, domainID, assigneeID *uuid.UUID, unassigned bool,
+		pageIndex int) ([]*models.Comment, map[uuid.UUID]*models.Commenter, error)
+	// ListRevisions returns all revisions of the given comment, oldest first, the last one holding its current text
+	ListRevisions(comment *data.Comment) ([]*data.CommentRevision, error)
+	// MarkDeleted marks a comment with the given ID deleted by the given user, also removing its revisions
 	MarkDeleted(commentID, userID *uuid.UUID) error
-	// MarkDeletedByUser deletes all comments by the specified user, returning the affected comment count
+	// MarkDeletedByUser deletes all comments by the specified user, also removing their revisions, returning the
+	// affected comment count
 	MarkDeletedByUser(curUserID, userID *uuid.UUID) (int64, error)
+	// ModerateBulk applies the given action on behalf of the given user to all non-deleted comments on the given domain
+	// matching the given filter, in a single transaction, and returns the affected comments in their updated state.
+	// reason is the pending reason to store for the comments, if any. The comments' active flags get dismissed. If the
+	// filter matches more than util.CommentBulkMaxCount comments, nothing is changed and ErrTooManyComments is returned
+	ModerateBulk(domainID *uuid.UUID, filter *CommentFilter, action data.CommentBulkAction, userID *uuid.UUID, reason string) ([]*BulkModeratedComment, error)
 	// Moderated persists the moderation status changes of the given comment in the database
 	Moderated(comment *data.Comment) error
+	// Search returns a list of comments and related commenters for the given domain, whose text matches all the given
+	// full-text search terms.
+	//   - curUser is the current authenticated/anonymous user.
+	//   - curDomainUser is the current domain user (can be nil).
+	//   - domainID is the mandatory domain ID.
+	//   - pageID is an optional page ID to filter the result by.
+	//   - authorUserID is an optional comment author user ID to filter the result by.
+	//   - terms is a list of words or phrases to search for, see util.ParseSearchQuery().
+	//   - from and to are optional bounds of the comment creation time (inclusive and exclusive, respectively).
+	//   - inclApproved indicates whether to include approved comments.
+	//   - inclPending indicates whether to include comments pending moderation.
+	//   - inclRejected indicates whether to include rejected comments.
+	//   - inclDeleted indicates whether to include deleted comments.
+	//   - sortBy is an optional property name to sort the result by. If empty, sorts by relevance, most relevant first.
+	//   - dir is the sort direction, ignored when sorting by relevance.
+	//   - pageIndex is the page index, if negative, no pagination is applied.
+	Search(
+		curUser *data.User, curDomainUser *data.DomainUser, domainID, pageID, authorUserID *uuid.UUID, terms []string,
+		from, to *time.Time, inclApproved, inclPending, inclRejected, inclDeleted bool, sortBy string,
+		dir data.SortDirection, pageIndex int) ([]*models.Comment, map[uuid.UUID]*models.Commenter, error)
 	// SetMarkdown updates the Markdown/HTML properties of the given comment in the specified domain. editedUserID
 	// should point to the user who edited the comment in case it's edited, otherwise nil
 	SetMarkdown(comment *data.Comment, markdown string, domainID, editedUserID *uuid.UUID) error
@@ -80,11 +126,89 @@ type CommentService interface {
 	Vote(commentID, userID *uuid.UUID, direction int8) (int, error)
 }
 
+// BulkModeratedComment is a comment moderated or deleted in bulk, along with its moderation status before the change
+type BulkModeratedComment struct {
+	*data.Comment
+	WasPending  bool // Whether the comment was pending moderation before the change
+	WasApproved bool // Whether the comment was approved before the change
+}
+
+// StatusChanged returns whether the comment's moderation status has changed
+func (c *BulkModeratedComment) StatusChanged() bool {
+	return c.IsPending != c.WasPending || c.IsApproved != c.WasApproved
+}
+
+// CommentFilter holds optional criteria for selecting comments
+type CommentFilter struct {
+	PageID        *uuid.UUID `json:"pageId,omitempty"`        // Page ID to filter comments by
+	AuthorID      *uuid.UUID `json:"userId,omitempty"`        // Author user ID to filter comments by
+	AuthorIP      string     `json:"authorIp,omitempty"`      // Author IP address to filter comments by
+	From          *time.Time `json:"from,omitempty"`          // Start of the creation time range (inclusive)
+	To            *time.Time `json:"to,omitempty"`            // End of the creation time range (exclusive)
+	PendingReason string     `json:"pendingReason,omitempty"` // Case-insensitive substring of the pending reason to filter comments by
+	Status        string     `json:"status,omitempty"`        // Moderation status to filter comments by: "pending", "approved", or "rejected"
+}
+
+// IsEmpty returns whether the filter has no criteria set
+func (f *CommentFilter) IsEmpty() bool {
+	return f.PageID == nil && f.AuthorID == nil && f.AuthorIP == "" && f.From == nil && f.To == nil &&
+		f.PendingReason == "" && f.Status == ""
+}
+
+// apply narrows down the given query, selecting from the cm_comments table under the alias "c", to the comments
+// matching the filter
+func (f *CommentFilter) apply(q *goqu.SelectDataset) *goqu.SelectDataset {
+	if f.PageID != nil {
+		q = q.Where(goqu.Ex{"c.page_id": f.PageID})
+	}
+	if f.AuthorID != nil {
+		q = q.Where(goqu.Ex{"c.user_created": f.AuthorID})
+	}
+	if f.AuthorIP != "" {
+		q = q.Where(goqu.Ex{"c.author_ip": f.AuthorIP})
+	}
+	if f.From != nil {
+		q = q.Where(goqu.I("c.ts_created").Gte(*f.From))
+	}
+	if f.To != nil {
+		q = q.Where(goqu.I("c.ts_created").Lt(*f.To))
+	}
+	if f.PendingReason != "" {
+		q = q.Where(goqu.L(`lower("c"."pending_reason")`).Like("%" + strings.ToLower(f.PendingReason) + "%"))
+	}
+	switch f.Status {
+	case "pending":
+		q = q.Where(goqu.Ex{"c.is_pending": true})
+	case "approved":
+		q = q.Where(goqu.Ex{"c.is_pending": false, "c.is_approved": true})
+	case "rejected":
+		q = q.Where(goqu.Ex{"c.is_pending": false, "c.is_approved": false})
+	}
+	return q
+}
+
 //----------------------------------------------------------------------------------------------------------------------
 
 // commentService is a blueprint CommentService implementation
 type commentService struct{}
 
+func (svc *commentService) Assign(commentID, userID *uuid.UUID) error {
+	logger.Debugf("commentService.Assign(%s, %s)", commentID, userID)
+
+	// Update the row in the database
+	r := goqu.Record{"ts_assigned": nil, "user_assigned": nil}
+	if userID != nil {
+		r = goqu.Record{"ts_assigned": time.Now().UTC(), "user_assigned": userID}
+	}
+	if err := db.ExecOne(db.Update("cm_comments").Set(r).Where(goqu.Ex{"id": commentID})); err != nil {
+		logger.Errorf("commentService.Assign: ExecOne() failed: %v", err)
+		return translateDBErrors(err)
+	}
+
+	// Succeeded
+	return nil
+}
+
 func (svc *commentService) Count(
 	curUser *data.User, curDomainUser *data.DomainUser, domainID, pageID, userID *uuid.UUID,
 	inclApproved, inclPending, inclRejected, inclDeleted bool) (int64, error) {
@@ -143,13 +267,63 @@ func (svc *commentService) Count(
 	return cnt, nil
 }
 
+func (svc *commentService) CountCreatedSince(domainID, pageID, userID *uuid.UUID, authorIPHash string, since time.Time) (int64, error) {
+	logger.Debugf("commentService.CountCreatedSince(%s, %s, %s, %q, %v)", domainID, pageID, userID, authorIPHash, since)
+
+	// Prepare a query
+	q := db.From(goqu.T("cm_comments").As("c")).
+		Join(goqu.T("cm_domain_pages").As("p"), goqu.On(goqu.Ex{"p.id": goqu.I("c.page_id")})).
+		Where(goqu.Ex{"p.domain_id": domainID}, goqu.I("c.ts_created").Gte(since))
+
+	// Apply optional filters
+	if pageID != nil {
+		q = q.Where(goqu.Ex{"c.page_id": pageID})
+	}
+	if userID != nil {
+		q = q.Where(goqu.Ex{"c.user_created": userID})
+	}
+	if authorIPHash != "" {
+		q = q.Where(goqu.Ex{"c.author_ip_hash": authorIPHash})
+	}
+
+	// Query the comment count
+	cnt, err := q.Count()
+	if err != nil {
+		logger.Errorf("commentService.CountCreatedSince: Count() failed: %v", err)
+		return 0, translateDBErrors(err)
+	}
+
+	// Succeeded
+	return cnt, nil
+}
+
 func (svc *commentService) Create(c *data.Comment) error {
 	logger.Debugf("commentService.Create(%#v)", c)
+
+	// Fire a before-create event, letting plugins alter or reject the comment
+	md, html := c.Markdown, c.HTML
+	if changed, err := handleCommentEvent(&plugin.CommentBeforeCreateEvent{}, c); err != nil {
+		return err
+
+	} else if changed && c.Markdown != md && c.HTML == html {
+		// Only the Markdown has been altered: re-render the HTML using settings of the corresponding domain
+		page, err := ThePageService.FindByID(&c.PageID)
+		if err != nil {
+			return err
+		}
+		svc.renderHTML(c, &page.DomainID)
+	}
+
+	// Insert a new record
 	if err := db.ExecOne(db.Insert("cm_comments").Rows(c)); err != nil {
 		logger.Errorf("commentService.Create: ExecOne() failed: %v", err)
 		return translateDBErrors(err)
 	}
 
+	// Fire a creation event. The comment is already persisted at this point, so any changes or errors are ignored
+	cc := *c
+	_, _ = handleCommentEvent(&plugin.CommentCreateEvent{}, &cc)
+
 	// Succeeded
 	return nil
 }
@@ -170,8 +344,16 @@ func (svc *commentService) DeleteByUser(userID *uuid.UUID) (int64, error) {
 	}
 }
 
-func (svc *commentService) Edited(comment *data.Comment) error {
-	logger.Debugf("commentService.Edited(%#v)", comment)
+func (svc *commentService) Edited(comment *data.Comment, prev *data.CommentRevision) error {
+	logger.Debugf("commentService.Edited(%#v, %#v)", comment, prev)
+
+	// Store the previous text as a revision, if it's changed
+	if prev != nil && prev.Markdown != comment.Markdown {
+		if err := db.ExecOne(db.Insert("cm_comment_revisions").Rows(prev)); err != nil {
+			logger.Errorf("commentService.Edited: ExecOne() failed for revision: %v", err)
+			return translateDBErrors(err)
+		}
+	}
 
 	// Update the row in the database
 	if err := db.ExecOne(
@@ -208,39 +390,31 @@ func (svc *commentService) FindByID(id *uuid.UUID) (*data.Comment, error) {
 	return &c, nil
 }
 
-func (svc *commentService) ListByDomain(domainID *uuid.UUID) ([]*models.Comment, error) {
-	logger.Debugf("commentService.ListByDomain(%s)", domainID)
-
-	// Prepare a query
-	q := db.From(goqu.T("cm_comments").As("c")).
-		Select("c.*", "p.path", "d.host", "d.is_https").
-		// Join comment pages
-		Join(goqu.T("cm_domain_pages").As("p"), goqu.On(goqu.Ex{"p.id": goqu.I("c.page_id")})).
-		// Join domain
-		Join(goqu.T("cm_domains").As("d"), goqu.On(goqu.Ex{"d.id": goqu.I("p.domain_id")})).
-		// Filter by page domain
-		Where(goqu.Ex{"p.domain_id": domainID})
-
-	// Fetch the comments
-	var dbRecs []struct {
-		data.Comment
-		PagePath    string `db:"path"`
-		DomainHost  string `db:"host"`
-		DomainHTTPS bool   `db:"is_https"`
-	}
-	if err := q.ScanStructs(&dbRecs); err != nil {
-		logger.Errorf("commentService.ListByDomain: ScanStructs() failed: %v", err)
-		return nil, translateDBErrors(err)
-	}
+func (svc *commentService) ListFlagged(curUser *data.User, curDomainUser *data.DomainUser, domainID *uuid.UUID, pageIndex int) ([]*models.Comment, map[uuid.UUID]*models.Commenter, error) {
+	logger.Debugf("commentService.ListFlagged(%s, %#v, %s, %d)", &curUser.ID, curDomainUser, domainID, pageIndex)
+
+	// Prepare a query, inner-joining on the aggregated active flags
+	q := svc.queryWithCommenters(curUser, domainID, nil, nil).
+		Join(
+			db.From("cm_comment_flags").
+				Select(goqu.C("comment_id"), goqu.COUNT("*").As("cnt"), goqu.MAX("ts_created").As("ts_last")).
+				Where(goqu.Ex{"ts_dismissed": nil}).
+				GroupBy("comment_id").
+				As("f"),
+			goqu.On(goqu.Ex{"f.comment_id": goqu.I("c.id")})).
+		Order(
+			goqu.I("f.cnt").Desc(),
+			goqu.I("f.ts_last").Desc(),
+			goqu.I("c.id").Asc(), // Always add ID for stable ordering
+		)
 
-	// Convert models into DTOs
-	var comments []*models.Comment
-	for _, r := range dbRecs {
-		comments = append(comments, r.Comment.ToDTO(r.DomainHTTPS, r.DomainHost, r.PagePath))
+	// Paginate if required
+	if pageIndex >= 0 {
+		q = q.Limit(util.ResultPageSize).Offset(uint(pageIndex) * util.ResultPageSize)
 	}
 
-	// Succeeded
-	return comments, nil
+	// Fetch the comments
+	return svc.fetchWithCommenters(q, curUser, curDomainUser)
 }
 
 func (svc *commentService) ListWithCommenters(curUser *data.User, curDomainUser *data.DomainUser,
@@ -254,53 +428,7 @@ func (svc *commentService) ListWithCommenters(curUser *data.User, curDomainUser
 		removeOrphans, filter, sortBy, dir, pageIndex)
 
 	// Prepare a query
-	q := db.From(goqu.T("cm_comments").As("c")).
-		Select(
-			// Comment fields
-			"c.*",
-			// Commenter fields
-			goqu.I("u.id").As("u_id"),
-			goqu.I("u.email").As("u_email"),
-			goqu.I("u.name").As("u_name"),
-			goqu.I("u.website_url").As("u_website_url"),
-			goqu.I("u.is_superuser").As("u_is_superuser"),
-			goqu.I("du.is_owner").As("du_is_owner"),
-			goqu.I("du.is_moderator").As("du_is_moderator"),
-			goqu.I("du.is_commenter").As("du_is_commenter"),
-			// Avatar fields
-			goqu.I("a.user_id").As("a_user_id"),
-			// Votes fields
-			goqu.I("v.negative").As("v_negative"),
-			// Page fields
-			goqu.I("p.path").As("p_path"),
-			// Domain fields
-			goqu.I("d.host").As("d_host"),
-			goqu.I("d.is_https").As("d_is_https")).
-		// Join comment pages
-		Join(goqu.T("cm_domain_pages").As("p"), goqu.On(goqu.Ex{"p.id": goqu.I("c.page_id")})).
-		// Join domain
-		Join(goqu.T("cm_domains").As("d"), goqu.On(goqu.Ex{"d.id": goqu.I("p.domain_id")})).
-		// Outer-join commenter users
-		LeftJoin(goqu.T("cm_users").As("u"), goqu.On(goqu.Ex{"u.id": goqu.I("c.user_created")})).
-		// Outer-join domain users
-		LeftJoin(goqu.T("cm_domains_users").As("du"), goqu.On(goqu.Ex{"du.user_id": goqu.I("c.user_created"), "du.domain_id": goqu.I("p.domain_id")})).
-		// Outer-join user avatars
-		LeftJoin(goqu.T("cm_user_avatars").As("a"), goqu.On(goqu.Ex{"a.user_id": goqu.I("c.user_created")})).
-		// Outer-join comment votes
-		LeftJoin(goqu.T("cm_comment_votes").As("v"), goqu.On(goqu.Ex{"v.comment_id": goqu.I("c.id"), "v.user_id": &curUser.ID})).
-		// Filter by page domain
-		Where(goqu.Ex{"p.domain_id": domainID})
-
-	// If there's a page ID specified, include only comments for that page (otherwise  comments for all pages of the
-	// domain will be included)
-	if pageID != nil {
-		q = q.Where(goqu.Ex{"c.page_id": pageID})
-	}
-
-	// If there's a user ID specified, include only comments by that user
-	if authorUserID != nil {
-		q = q.Where(goqu.Ex{"c.user_created": authorUserID})
-	}
+	q := svc.queryWithCommenters(curUser, domainID, pageID, authorUserID)
 
 	// If there's a reply-to-user ID specified, include only replies to comments by that user, by inner-joining on the
 	// parent comment authored by the user
@@ -311,29 +439,7 @@ func (svc *commentService) ListWithCommenters(curUser *data.User, curDomainUser
 	}
 
 	// Add status filter
-	if !inclApproved {
-		q = q.Where(goqu.ExOr{"c.is_pending": true, "c.is_approved": false})
-	}
-	if !inclPending {
-		q = q.Where(goqu.Ex{"c.is_pending": false})
-	}
-	if !inclRejected {
-		q = q.Where(goqu.ExOr{"c.is_pending": true, "c.is_approved": true})
-	}
-	if !inclDeleted {
-		q = q.Where(goqu.Ex{"c.is_deleted": false})
-	}
-
-	// Add authorship filter. If anonymous user: only include approved
-	if curUser.IsAnonymous() {
-		q = q.Where(goqu.Ex{"c.is_pending": false, "c.is_approved": true})
-
-	} else if !curUser.IsSuperuser && !curDomainUser.CanModerate() {
-		// Authenticated, non-moderator user: show others' comments only if they are approved
-		q = q.Where(goqu.Or(
-			goqu.Ex{"c.is_pending": false, "c.is_approved": true},
-			goqu.Ex{"c.user_created": &curUser.ID}))
-	}
+	q = svc.filterByStatus(q, curUser, curDomainUser, inclApproved, inclPending, inclRejected, inclDeleted)
 
 	// Add substring filter
 	if filter != "" {
@@ -366,74 +472,14 @@ func (svc *commentService) ListWithCommenters(curUser *data.User, curDomainUser
 	}
 
 	// Fetch the comments
-	var dbRecs []struct {
-		data.Comment
-		UserID          uuid.NullUUID  `db:"u_id"`
-		UserEmail       sql.NullString `db:"u_email"`
-		UserName        sql.NullString `db:"u_name"`
-		UserWebsiteUrl  sql.NullString `db:"u_website_url"`
-		UserIsSuperuser sql.NullBool   `db:"u_is_superuser"`
-		UserIsOwner     sql.NullBool   `db:"du_is_owner"`
-		UserIsModerator sql.NullBool   `db:"du_is_moderator"`
-		UserIsCommenter sql.NullBool   `db:"du_is_commenter"`
-		AvatarID        uuid.NullUUID  `db:"a_user_id"`
-		VoteNegative    sql.NullBool   `db:"v_negative"`
-		PagePath        string         `db:"p_path"`
-		DomainHost      string         `db:"d_host"`
-		DomainHTTPS     bool           `db:"d_is_https"`
-	}
-	if err := q.ScanStructs(&dbRecs); err != nil {
-		logger.Errorf("commentService.ListWithCommenters: ScanStructs() failed: %v", err)
-		return nil, nil, translateDBErrors(err)
+	comments, commenterMap, err := svc.fetchWithCommenters(q, curUser, curDomainUser)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// Prepare commenter map: begin with only the "anonymous" one
-	commenterMap := map[uuid.UUID]*models.Commenter{data.AnonymousUser.ID: data.AnonymousUser.ToCommenter(true, false)}
-
-	// Iterate result rows
-	var comments []*models.Comment
-	commentMap := make(map[strfmt.UUID]bool)
-	for _, r := range dbRecs {
-		// Convert the comment, applying the required access privileges
-		cm := r.Comment.
-			CloneWithClearance(curUser, curDomainUser).
-			ToDTO(r.DomainHTTPS, r.DomainHost, r.PagePath)
-
-		// If the user exists and isn't anonymous
-		if r.UserID.Valid && r.UserID.UUID != data.AnonymousUser.ID {
-			// If the commenter isn't present in the map yet
-			if _, ok := commenterMap[r.UserID.UUID]; !ok {
-				u := data.User{
-					ID:          r.UserID.UUID,
-					Email:       r.UserEmail.String,
-					Name:        r.UserName.String,
-					IsSuperuser: r.UserIsSuperuser.Valid && r.UserIsSuperuser.Bool,
-					WebsiteURL:  r.UserWebsiteUrl.String,
-					HasAvatar:   r.AvatarID.Valid,
-				}
-
-				// Calculate commenter roles
-				uIsOwner := u.IsSuperuser || r.UserIsOwner.Valid && r.UserIsOwner.Bool
-				uIsModerator := uIsOwner || r.UserIsModerator.Valid && r.UserIsModerator.Bool
-
-				// Convert the user into a commenter and add it to the map
-				commenterMap[r.UserID.UUID] = u.
-					CloneWithClearance(curUser.IsSuperuser, curDomainUser.IsAnOwner(), curDomainUser.IsAModerator()).
-					ToCommenter(uIsModerator || !r.UserIsCommenter.Valid || r.UserIsCommenter.Bool, uIsModerator)
-			}
-		}
-
-		// Determine comment vote direction for the user
-		if r.VoteNegative.Valid {
-			if r.VoteNegative.Bool {
-				cm.Direction = -1
-			} else {
-				cm.Direction = 1
-			}
-		}
-
-		// Append the comment to the list and a flag to the map
-		comments = append(comments, cm)
+	// Build a map of the fetched comments
+	commentMap := make(map[strfmt.UUID]bool, len(comments))
+	for _, cm := range comments {
 		commentMap[cm.ID] = true
 	}
 
@@ -477,27 +523,73 @@ func (svc *commentService) ListWithCommenters(curUser *data.User, curDomainUser
 	return comments, commenterMap, nil
 }
 
+func (svc *commentService) ListQueue(
+	curUser *data.User, curDomainUser *data.DomainUser, domainID, assigneeID *uuid.UUID, unassigned bool, pageIndex int,
+) ([]*models.Comment, map[uuid.UUID]*models.Commenter, error) {
+	logger.Debugf("commentService.ListQueue(%s, %#v, %s, %s, %v, %d)", &curUser.ID, curDomainUser, domainID, assigneeID, unassigned, pageIndex)
+
+	// Prepare a query for pending comments
+	q := svc.queryWithCommenters(curUser, domainID, nil, nil).
+		Where(goqu.Ex{"c.is_pending": true, "c.is_deleted": false}).
+		Order(
+			goqu.I("c.ts_created").Asc(),
+			goqu.I("c.id").Asc(), // Always add ID for stable ordering
+		)
+
+	// Apply the assignment filter
+	if assigneeID != nil {
+		q = q.Where(goqu.Ex{"c.user_assigned": assigneeID})
+	} else if unassigned {
+		q = q.Where(goqu.Ex{"c.user_assigned": nil})
+	}
+
+	// Paginate if required
+	if pageIndex >= 0 {
+		q = q.Limit(util.ResultPageSize).Offset(uint(pageIndex) * util.ResultPageSize)
+	}
+
+	// Fetch the comments
+	return svc.fetchWithCommenters(q, curUser, curDomainUser)
+}
+
+func (svc *commentService) ListRevisions(comment *data.Comment) ([]*data.CommentRevision, error) {
+	logger.Debugf("commentService.ListRevisions(%s)", &comment.ID)
+
+	// Query the stored revisions
+	var res []*data.CommentRevision
+	if err := db.From("cm_comment_revisions").
+		Where(goqu.Ex{"comment_id": &comment.ID}).
+		Order(goqu.I("ts_created").Asc(), goqu.I("id").Asc()).
+		ScanStructs(&res); err != nil {
+		logger.Errorf("commentService.ListRevisions: ScanStructs() failed: %v", err)
+		return nil, translateDBErrors(err)
+	}
+
+	// Succeeded: add the current text as the last revision
+	return append(res, data.NewCommentRevision(comment)), nil
+}
+
 func (svc *commentService) MarkDeleted(commentID, userID *uuid.UUID) error {
 	logger.Debugf("commentService.MarkDeleted(%s, %s)", commentID, userID)
 
+	// Fire a deletion event, letting plugins prevent the deletion
+	if err := handleCommentEventByID(&plugin.CommentDeleteEvent{}, commentID); err != nil {
+		return err
+	}
+
 	// Update the record in the database
-	if err := db.ExecOne(
-		db.Update("cm_comments").
-			Set(goqu.Record{
-				"is_deleted":     true,
-				"markdown":       "",
-				"html":           "",
-				"pending_reason": "",
-				"ts_deleted":     time.Now().UTC(),
-				"user_deleted":   userID,
-			}).
-			Where(goqu.Ex{"id": commentID}),
-	); err != nil {
+	if err := db.ExecOne(db.Update("cm_comments").Set(commentDeletedRecord(userID)).Where(goqu.Ex{"id": commentID})); err != nil {
 		logger.Errorf("commentService.MarkDeleted: ExecOne() failed: %v", err)
 		return translateDBErrors(err)
 	}
 
-	// Succeeded
+	// Remove the comment's revisions, so that its text is gone for good
+	if _, err := db.Delete("cm_comment_revisions").Where(goqu.Ex{"comment_id": commentID}).Executor().Exec(); err != nil {
+		logger.Errorf("commentService.MarkDeleted: Exec() failed for revisions: %v", err)
+		return translateDBErrors(err)
+	}
+
+	// Succeeded
 	return nil
 }
 
@@ -505,41 +597,117 @@ func (svc *commentService) MarkDeletedByUser(curUserID, userID *uuid.UUID) (int6
 	logger.Debugf("commentService.MarkDeletedByUser(%s, %s)", curUserID, userID)
 
 	// Update records from the database
-	r := goqu.Record{
-		"is_deleted":     true,
-		"markdown":       "",
-		"html":           "",
-		"pending_reason": "",
-		"ts_deleted":     time.Now().UTC(),
-		"user_deleted":   curUserID,
-	}
-	if res, err := db.Update("cm_comments").Set(r).Where(goqu.Ex{"user_created": userID}).Executor().Exec(); err != nil {
+	res, err := db.Update("cm_comments").Set(commentDeletedRecord(curUserID)).Where(goqu.Ex{"user_created": userID}).Executor().Exec()
+	if err != nil {
 		logger.Errorf("commentService.MarkDeletedByUser: Exec() failed: %v", err)
 		return 0, translateDBErrors(err)
-	} else if cnt, err := res.RowsAffected(); err != nil {
+	}
+	cnt, err := res.RowsAffected()
+	if err != nil {
 		logger.Errorf("commentService.MarkDeletedByUser: RowsAffected() failed: %v", err)
 		return 0, translateDBErrors(err)
-	} else {
-		// Succeeded
-		return cnt, nil
 	}
+
+	// Remove revisions of the user's comments
+	if _, err := db.Delete("cm_comment_revisions").
+		Where(goqu.I("comment_id").In(db.From("cm_comments").Select("id").Where(goqu.Ex{"user_created": userID}))).
+		Executor().Exec(); err != nil {
+		logger.Errorf("commentService.MarkDeletedByUser: Exec() failed for revisions: %v", err)
+		return 0, translateDBErrors(err)
+	}
+
+	// Succeeded
+	return cnt, nil
+}
+
+func (svc *commentService) ModerateBulk(domainID *uuid.UUID, filter *CommentFilter, action data.CommentBulkAction, userID *uuid.UUID, reason string) ([]*BulkModeratedComment, error) {
+	logger.Debugf("commentService.ModerateBulk(%s, %#v, '%s', %s, %q)", domainID, filter, action, userID, reason)
+
+	var res []*BulkModeratedComment
+	err := db.WithTx(func(tx *goqu.TxDatabase) error {
+		// Fetch the matching comments, one more than allowed to detect an excess
+		var cs []*data.Comment
+		q := filter.apply(
+			tx.From(goqu.T("cm_comments").As("c")).
+				Select("c.*").
+				Join(goqu.T("cm_domain_pages").As("p"), goqu.On(goqu.Ex{"p.id": goqu.I("c.page_id")})).
+				Where(goqu.Ex{"p.domain_id": domainID, "c.is_deleted": false}).
+				Order(goqu.I("c.ts_created").Asc(), goqu.I("c.id").Asc()).
+				Limit(util.CommentBulkMaxCount + 1))
+		if err := q.ScanStructs(&cs); err != nil {
+			logger.Errorf("commentService.ModerateBulk: ScanStructs() failed: %v", err)
+			return err
+		} else if len(cs) > util.CommentBulkMaxCount {
+			return ErrTooManyComments
+		}
+
+		// Process the comments one by one
+		now := time.Now().UTC()
+		for _, c := range cs {
+			res = append(res, &BulkModeratedComment{Comment: c, WasPending: c.IsPending, WasApproved: c.IsApproved})
+			var r goqu.Record
+			if action == data.CommentBulkActionDelete {
+				// Fire a deletion event, letting plugins prevent the deletion
+				if _, err := handleCommentEvent(&plugin.CommentDeleteEvent{}, c); err != nil {
+					return err
+				}
+				r = commentDeletedRecord(userID)
+				c.WithDeleted(userID)
+
+			} else {
+				// Fire a moderation event, letting plugins alter or reject the status change
+				c.WithModerated(userID, false, action == data.CommentBulkActionApprove, reason)
+				if _, err := handleCommentEvent(&plugin.CommentModeratedEvent{}, c); err != nil {
+					return err
+				}
+				r = commentModeratedRecord(c)
+			}
+
+			// Update the comment
+			if err := db.ExecOne(tx.Update("cm_comments").Set(r).Where(goqu.Ex{"id": &c.ID})); err != nil {
+				logger.Errorf("commentService.ModerateBulk: ExecOne() failed for comment %s: %v", &c.ID, err)
+				return err
+			}
+
+			// Remove the revisions of a deleted comment
+			if action == data.CommentBulkActionDelete {
+				if _, err := tx.Delete("cm_comment_revisions").Where(goqu.Ex{"comment_id": &c.ID}).Executor().Exec(); err != nil {
+					logger.Errorf("commentService.ModerateBulk: Exec() failed for revisions of comment %s: %v", &c.ID, err)
+					return err
+				}
+			}
+
+			// Dismiss the comment's active flags
+			if _, err := tx.Update("cm_comment_flags").
+				Set(goqu.Record{"ts_dismissed": now, "user_dismissed": userID}).
+				Where(goqu.Ex{"comment_id": &c.ID, "ts_dismissed": nil}).
+				Executor().Exec(); err != nil {
+				logger.Errorf("commentService.ModerateBulk: Exec() failed for flags of comment %s: %v", &c.ID, err)
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, ErrTooManyComments) {
+		return nil, err
+	} else if err != nil {
+		return nil, translateDBErrors(err)
+	}
+
+	// Succeeded
+	return res, nil
 }
 
 func (svc *commentService) Moderated(comment *data.Comment) error {
 	logger.Debugf("commentService.Moderated(%#v)", comment)
 
+	// Fire a moderation event, letting plugins alter or reject the status change
+	if _, err := handleCommentEvent(&plugin.CommentModeratedEvent{}, comment); err != nil {
+		return err
+	}
+
 	// Update the record in the database
-	if err := db.ExecOne(
-		db.Update("cm_comments").
-			Set(goqu.Record{
-				"is_pending":     comment.IsPending,
-				"is_approved":    comment.IsApproved,
-				"pending_reason": util.TruncateStr(comment.PendingReason, data.MaxPendingReasonLength),
-				"ts_moderated":   comment.ModeratedTime,
-				"user_moderated": comment.UserModerated,
-			}).
-			Where(goqu.Ex{"id": &comment.ID}),
-	); err != nil {
+	if err := db.ExecOne(db.Update("cm_comments").Set(commentModeratedRecord(comment)).Where(goqu.Ex{"id": &comment.ID})); err != nil {
 		logger.Errorf("commentService.Moderated: ExecOne() failed: %v", err)
 		return translateDBErrors(err)
 	}
@@ -548,12 +716,72 @@ func (svc *commentService) Moderated(comment *data.Comment) error {
 	return nil
 }
 
+func (svc *commentService) Search(curUser *data.User, curDomainUser *data.DomainUser,
+	domainID, pageID, authorUserID *uuid.UUID, terms []string, from, to *time.Time,
+	inclApproved, inclPending, inclRejected, inclDeleted bool, sortBy string, dir data.SortDirection, pageIndex int,
+) ([]*models.Comment, map[uuid.UUID]*models.Commenter, error) {
+	logger.Debugf(
+		"commentService.Search(%s, %#v, %s, %s, %s, %q, %v, %v, %v, %v, %v, %v, '%s', %s, %d)",
+		&curUser.ID, curDomainUser, domainID, pageID, authorUserID, terms, from, to, inclApproved, inclPending,
+		inclRejected, inclDeleted, sortBy, dir, pageIndex)
+
+	// Prepare a query
+	q := svc.queryWithCommenters(curUser, domainID, pageID, authorUserID)
+
+	// Add status filter
+	q = svc.filterByStatus(q, curUser, curDomainUser, inclApproved, inclPending, inclRejected, inclDeleted)
+
+	// Add creation time filter
+	if from != nil {
+		q = q.Where(goqu.I("c.ts_created").Gte(*from))
+	}
+	if to != nil {
+		q = q.Where(goqu.I("c.ts_created").Lt(*to))
+	}
+
+	// Add full-text search
+	q, rank := db.FullTextSearch(q, "cm_comments", "c", "markdown", terms)
+
+	// Configure sorting
+	var order exp.OrderedExpression
+	switch sortBy {
+	case "created":
+		order = dir.ToOrderedExpression("c.ts_created")
+	case "score":
+		order = dir.ToOrderedExpression("c.score")
+	default:
+		order = rank
+	}
+	q = q.Order(
+		order,
+		goqu.I("c.id").Asc(), // Always add ID for stable ordering
+	)
+
+	// Paginate if required
+	if pageIndex >= 0 {
+		q = q.Limit(util.ResultPageSize).Offset(uint(pageIndex) * util.ResultPageSize)
+	}
+
+	// Fetch the comments
+	return svc.fetchWithCommenters(q, curUser, curDomainUser)
+}
+
 func (svc *commentService) SetMarkdown(comment *data.Comment, markdown string, domainID, editedUserID *uuid.UUID) error {
 	logger.Debugf("commentService.SetMarkdown(%v, %q, %s, %s)", comment, markdown, domainID, editedUserID)
 
+	// If the comment is being edited, fire a before-edit event, letting plugins alter or reject the new text
+	md := strings.TrimSpace(markdown)
+	if editedUserID != nil {
+		pc := *comment
+		pc.Markdown = md
+		if _, err := handleCommentEvent(&plugin.CommentBeforeEditEvent{}, &pc); err != nil {
+			return err
+		}
+		md = strings.TrimSpace(pc.Markdown)
+	}
+
 	// Validate comment length
 	maxLen := TheDomainConfigService.GetInt(domainID, data.DomainConfigKeyMaxCommentLength)
-	md := strings.TrimSpace(markdown)
 	if l := len(md); l > maxLen {
 		logger.Errorf("commentService.SetMarkdown: comment text length (%d bytes) > allowed (%d bytes)", l, maxLen)
 		return ErrCommentTooLong
@@ -561,11 +789,7 @@ func (svc *commentService) SetMarkdown(comment *data.Comment, markdown string, d
 
 	// Render the comment's HTML using settings of the corresponding domain
 	comment.Markdown = md
-	comment.HTML = util.MarkdownToHTML(
-		md,
-		TheDomainConfigService.GetBool(domainID, data.DomainConfigKeyMarkdownLinksEnabled),
-		TheDomainConfigService.GetBool(domainID, data.DomainConfigKeyMarkdownImagesEnabled),
-		TheDomainConfigService.GetBool(domainID, data.DomainConfigKeyMarkdownTablesEnabled))
+	svc.renderHTML(comment, domainID)
 
 	// Update the audit fields, if required
 	if editedUserID != nil {
@@ -622,7 +846,12 @@ func (svc *commentService) Vote(commentID, userID *uuid.UUID, direction int8) (i
 		return r.Score, nil
 	}
 
-	// A change is necessary
+	// A change is necessary. Fire a vote event, letting plugins reject the vote
+	if err := handleCommentEventByID(&plugin.CommentVoteEvent{VoterID: *userID, Direction: direction}, commentID); err != nil {
+		return 0, err
+	}
+
+	// Apply the change
 	var op string
 	inc := 0
 	vote := &data.CommentVote{
@@ -665,3 +894,244 @@ func (svc *commentService) Vote(commentID, userID *uuid.UUID, direction int8) (i
 	// Succeeded
 	return r.Score, nil
 }
+
+// fetchWithCommenters executes the given query, prepared by queryWithCommenters(), and returns the fetched comments
+// along with a map of their commenters, applying the access privileges of the given user
+func (svc *commentService) fetchWithCommenters(
+	q *goqu.SelectDataset, curUser *data.User, curDomainUser *data.DomainUser,
+) ([]*models.Comment, map[uuid.UUID]*models.Commenter, error) {
+	// Fetch the comments
+	var dbRecs []struct {
+		data.Comment
+		UserID          uuid.NullUUID  `db:"u_id"`
+		UserEmail       sql.NullString `db:"u_email"`
+		UserName        sql.NullString `db:"u_name"`
+		UserWebsiteUrl  sql.NullString `db:"u_website_url"`
+		UserIsSuperuser sql.NullBool   `db:"u_is_superuser"`
+		UserIsOwner     sql.NullBool   `db:"du_is_owner"`
+		UserIsModerator sql.NullBool   `db:"du_is_moderator"`
+		UserIsCommenter sql.NullBool   `db:"du_is_commenter"`
+		AvatarID        uuid.NullUUID  `db:"a_user_id"`
+		VoteNegative    sql.NullBool   `db:"v_negative"`
+		PagePath        string         `db:"p_path"`
+		DomainHost      string         `db:"d_host"`
+		DomainHTTPS     bool           `db:"d_is_https"`
+	}
+	if err := q.ScanStructs(&dbRecs); err != nil {
+		logger.Errorf("commentService.fetchWithCommenters: ScanStructs() failed: %v", err)
+		return nil, nil, translateDBErrors(err)
+	}
+
+	// Prepare commenter map: begin with only the "anonymous" one
+	commenterMap := map[uuid.UUID]*models.Commenter{data.AnonymousUser.ID: data.AnonymousUser.ToCommenter(true, false)}
+
+	// Iterate result rows
+	var comments []*models.Comment
+	for _, r := range dbRecs {
+		// Convert the comment, applying the required access privileges
+		cm := r.Comment.
+			CloneWithClearance(curUser, curDomainUser).
+			ToDTO(r.DomainHTTPS, r.DomainHost, r.PagePath)
+
+		// If the user exists and isn't anonymous
+		if r.UserID.Valid && r.UserID.UUID != data.AnonymousUser.ID {
+			// If the commenter isn't present in the map yet
+			if _, ok := commenterMap[r.UserID.UUID]; !ok {
+				u := data.User{
+					ID:          r.UserID.UUID,
+					Email:       r.UserEmail.String,
+					Name:        r.UserName.String,
+					IsSuperuser: r.UserIsSuperuser.Valid && r.UserIsSuperuser.Bool,
+					WebsiteURL:  r.UserWebsiteUrl.String,
+					HasAvatar:   r.AvatarID.Valid,
+				}
+
+				// Calculate commenter roles
+				uIsOwner := u.IsSuperuser || r.UserIsOwner.Valid && r.UserIsOwner.Bool
+				uIsModerator := uIsOwner || r.UserIsModerator.Valid && r.UserIsModerator.Bool
+
+				// Convert the user into a commenter and add it to the map
+				commenterMap[r.UserID.UUID] = u.
+					CloneWithClearance(curUser.IsSuperuser, curDomainUser.IsAnOwner(), curDomainUser.IsAModerator()).
+					ToCommenter(uIsModerator || !r.UserIsCommenter.Valid || r.UserIsCommenter.Bool, uIsModerator)
+			}
+		}
+
+		// Determine comment vote direction for the user
+		if r.VoteNegative.Valid {
+			if r.VoteNegative.Bool {
+				cm.Direction = -1
+			} else {
+				cm.Direction = 1
+			}
+		}
+
+		// Append the comment to the list
+		comments = append(comments, cm)
+	}
+
+	// Succeeded
+	return comments, commenterMap, nil
+}
+
+// filterByStatus adds a comment status filter to the given query, also taking into account which comments the given
+// user is allowed to see
+func (svc *commentService) filterByStatus(
+	q *goqu.SelectDataset, curUser *data.User, curDomainUser *data.DomainUser,
+	inclApproved, inclPending, inclRejected, inclDeleted bool,
+) *goqu.SelectDataset {
+	if !inclApproved {
+		q = q.Where(goqu.ExOr{"c.is_pending": true, "c.is_approved": false})
+	}
+	if !inclPending {
+		q = q.Where(goqu.Ex{"c.is_pending": false})
+	}
+	if !inclRejected {
+		q = q.Where(goqu.ExOr{"c.is_pending": true, "c.is_approved": true})
+	}
+	if !inclDeleted {
+		q = q.Where(goqu.Ex{"c.is_deleted": false})
+	}
+
+	// Add authorship filter. If anonymous user: only include approved
+	if curUser.IsAnonymous() {
+		q = q.Where(goqu.Ex{"c.is_pending": false, "c.is_approved": true})
+
+	} else if !curUser.IsSuperuser && !curDomainUser.CanModerate() {
+		// Authenticated, non-moderator user: show others' comments only if they are approved
+		q = q.Where(goqu.Or(
+			goqu.Ex{"c.is_pending": false, "c.is_approved": true},
+			goqu.Ex{"c.user_created": &curUser.ID}))
+	}
+	return q
+}
+
+// queryWithCommenters returns a query for comments on the given domain, along with their authors, pages, and the
+// votes of the given user. pageID and authorUserID optionally narrow the result down to the given page and author
+func (svc *commentService) queryWithCommenters(curUser *data.User, domainID, pageID, authorUserID *uuid.UUID) *goqu.SelectDataset {
+	q := db.From(goqu.T("cm_comments").As("c")).
+		Select(
+			// Comment fields
+			"c.*",
+			// Commenter fields
+			goqu.I("u.id").As("u_id"),
+			goqu.I("u.email").As("u_email"),
+			goqu.I("u.name").As("u_name"),
+			goqu.I("u.website_url").As("u_website_url"),
+			goqu.I("u.is_superuser").As("u_is_superuser"),
+			goqu.I("du.is_owner").As("du_is_owner"),
+			goqu.I("du.is_moderator").As("du_is_moderator"),
+			goqu.I("du.is_commenter").As("du_is_commenter"),
+			// Avatar fields
+			goqu.I("a.user_id").As("a_user_id"),
+			// Votes fields
+			goqu.I("v.negative").As("v_negative"),
+			// Page fields
+			goqu.I("p.path").As("p_path"),
+			// Domain fields
+			goqu.I("d.host").As("d_host"),
+			goqu.I("d.is_https").As("d_is_https")).
+		// Join comment pages
+		Join(goqu.T("cm_domain_pages").As("p"), goqu.On(goqu.Ex{"p.id": goqu.I("c.page_id")})).
+		// Join domain
+		Join(goqu.T("cm_domains").As("d"), goqu.On(goqu.Ex{"d.id": goqu.I("p.domain_id")})).
+		// Outer-join commenter users
+		LeftJoin(goqu.T("cm_users").As("u"), goqu.On(goqu.Ex{"u.id": goqu.I("c.user_created")})).
+		// Outer-join domain users
+		LeftJoin(goqu.T("cm_domains_users").As("du"), goqu.On(goqu.Ex{"du.user_id": goqu.I("c.user_created"), "du.domain_id": goqu.I("p.domain_id")})).
+		// Outer-join user avatars
+		LeftJoin(goqu.T("cm_user_avatars").As("a"), goqu.On(goqu.Ex{"a.user_id": goqu.I("c.user_created")})).
+		// Outer-join comment votes
+		LeftJoin(goqu.T("cm_comment_votes").As("v"), goqu.On(goqu.Ex{"v.comment_id": goqu.I("c.id"), "v.user_id": &curUser.ID})).
+		// Filter by page domain
+		Where(goqu.Ex{"p.domain_id": domainID})
+
+	// If there's a page ID specified, include only comments for that page (otherwise  comments for all pages of the
+	// domain will be included)
+	if pageID != nil {
+		q = q.Where(goqu.Ex{"c.page_id": pageID})
+	}
+
+	// If there's a user ID specified, include only comments by that user
+	if authorUserID != nil {
+		q = q.Where(goqu.Ex{"c.user_created": authorUserID})
+	}
+	return q
+}
+
+// renderHTML renders the comment's HTML from its Markdown, using settings of the specified domain
+func (svc *commentService) renderHTML(comment *data.Comment, domainID *uuid.UUID) {
+	comment.HTML = util.MarkdownToHTML(
+		comment.Markdown,
+		TheDomainConfigService.GetBool(domainID, data.DomainConfigKeyMarkdownLinksEnabled),
+		TheDomainConfigService.GetBool(domainID, data.DomainConfigKeyMarkdownImagesEnabled),
+		TheDomainConfigService.GetBool(domainID, data.DomainConfigKeyMarkdownTablesEnabled))
+}
+
+// commentDeletedRecord returns a record for updating a comment that gets marked deleted by the given user
+func commentDeletedRecord(userID *uuid.UUID) goqu.Record {
+	return goqu.Record{
+		"is_deleted":     true,
+		"markdown":       "",
+		"html":           "",
+		"pending_reason": "",
+		"ts_deleted":     time.Now().UTC(),
+		"user_deleted":   userID,
+	}
+}
+
+// commentModeratedRecord returns a record for updating the moderation status of the given comment
+func commentModeratedRecord(c *data.Comment) goqu.Record {
+	return goqu.Record{
+		"is_pending":     c.IsPending,
+		"is_approved":    c.IsApproved,
+		"pending_reason": util.TruncateStr(c.PendingReason, data.MaxPendingReasonLength),
+		"ts_moderated":   c.ModeratedTime,
+		"user_moderated": c.UserModerated,
+	}
+}
+
+// handleCommentEvent fires a comment event. It returns true if the comment has been modified during the event handling
+func handleCommentEvent[E plugin.CommentPayload](e E, c *data.Comment) (changed bool, err error) {
+	// Skip unless the plugin manager is active
+	if !ThePluginManager.Active() {
+		return
+	}
+
+	// Set the event's payload
+	e.SetComment(c.ToPluginComment())
+
+	// Make a clone of the original comment
+	cc := c.ToPluginComment()
+
+	// Fire an event
+	if err = ThePluginManager.HandleEvent(e); err != nil {
+		return
+	}
+
+	// If event handling changed the comment, update the working model
+	if *e.Comment() != *cc {
+		c.FromPluginComment(e.Comment())
+		changed = true
+	}
+	return
+}
+
+// handleCommentEventByID fetches a comment by its ID and fires a comment event for it, discarding any changes made
+// during the event handling
+func handleCommentEventByID[E plugin.CommentPayload](e E, commentID *uuid.UUID) error {
+	// Skip unless the plugin manager is active
+	if !ThePluginManager.Active() {
+		return nil
+	}
+
+	// Fetch the comment
+	c, err := TheCommentService.FindByID(commentID)
+	if err != nil {
+		return err
+	}
+
+	// Fire the event
+	_, err = handleCommentEvent(e, c)
+	return err
+}
@@ -0,0 +1,41 @@
+package svc
+
+import (
+	"github.com/doug-martin/goqu/v9"
+	"github.com/google/uuid"
+	"testing"
+	"time"
+)
+
+func TestCommentFilter_apply(t *testing.T) {
+	id := uuid.MustParse("f6e2c6a8-3c3e-4e5f-9d3a-0b1c2d3e4f50")
+	tm := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	tests := []struct {
+		name   string
+		filter CommentFilter
+		want   string
+	}{
+		{"empty          ", CommentFilter{}, ``},
+		{"page           ", CommentFilter{PageID: &id}, ` WHERE ("c"."page_id" = 'f6e2c6a8-3c3e-4e5f-9d3a-0b1c2d3e4f50')`},
+		{"author         ", CommentFilter{AuthorID: &id}, ` WHERE ("c"."user_created" = 'f6e2c6a8-3c3e-4e5f-9d3a-0b1c2d3e4f50')`},
+		{"author IP      ", CommentFilter{AuthorIP: "10.0.0.1"}, ` WHERE ("c"."author_ip" = '10.0.0.1')`},
+		{"time range     ", CommentFilter{From: &tm, To: &tm}, ` WHERE (("c"."ts_created" >= '2024-05-06T07:08:09Z') AND ("c"."ts_created" < '2024-05-06T07:08:09Z'))`},
+		{"pending reason ", CommentFilter{PendingReason: "Spam"}, ` WHERE (lower("c"."pending_reason") LIKE '%spam%')`},
+		{"status pending ", CommentFilter{Status: "pending"}, ` WHERE ("c"."is_pending" IS TRUE)`},
+		{"status approved", CommentFilter{Status: "approved"}, ` WHERE (("c"."is_approved" IS TRUE) AND ("c"."is_pending" IS FALSE))`},
+		{"status rejected", CommentFilter{Status: "rejected"}, ` WHERE (("c"."is_approved" IS FALSE) AND ("c"."is_pending" IS FALSE))`},
+		{"status unknown ", CommentFilter{Status: "foo"}, ``},
+		{"combined       ", CommentFilter{PageID: &id, Status: "pending"}, ` WHERE (("c"."page_id" = 'f6e2c6a8-3c3e-4e5f-9d3a-0b1c2d3e4f50') AND ("c"."is_pending" IS TRUE))`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := tt.filter.apply(goqu.From(goqu.T("cm_comments").As("c"))).ToSQL()
+			if err != nil {
+				t.Fatalf("ToSQL() failed: %v", err)
+			}
+			if want := `SELECT * FROM "cm_comments" AS "c"` + tt.want; got != want {
+				t.Errorf("apply() got = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package svc
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/google/uuid"
+	"gitlab.com/comentario/comentario/internal/api/models"
+	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/util"
+	"time"
+)
+
+// TheDigestService is a global DigestService implementation
+var TheDigestService DigestService = &digestService{}
+
+// DigestService is a service interface for collecting email notifications and sending them out as periodic digests
+type DigestService interface {
+	// Enqueue postpones an email notification of the given kind about a comment, to be sent to the given user as part
+	// of their next digest
+	Enqueue(kind MailNotificationKind, userID, domainID, commentID *uuid.UUID) error
+	// Run starts sending out due digests in the background
+	Run() error
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+
+// digestService is a blueprint DigestService implementation
+type digestService struct{}
+
+func (svc *digestService) Enqueue(kind MailNotificationKind, userID, domainID, commentID *uuid.UUID) error {
+	logger.Debugf("digestService.Enqueue(%s, %s, %s, %s)", kind, userID, domainID, commentID)
+
+	// Insert a new record
+	mn := data.NewMailNotification(string(kind), userID, domainID, commentID)
+	if err := db.ExecOne(db.Insert("cm_mail_notifications").Rows(mn)); err != nil {
+		logger.Errorf("digestService.Enqueue: ExecOne() failed: %v", err)
+		return translateDBErrors(err)
+	}
+
+	// Succeeded
+	return nil
+}
+
+func (svc *digestService) Run() error {
+	logger.Debug("digestService: starting digest processing")
+	go svc.process()
+	return nil
+}
+
+// digestRecord is a queued notification along with the recipient's settings for the domain
+type digestRecord struct {
+	data.MailNotification
+	DigestMode  sql.NullString `db:"du_digest_mode"`
+	IsOwner     sql.NullBool   `db:"du_is_owner"`
+	IsModerator sql.NullBool   `db:"du_is_moderator"`
+}
+
+// canModerate returns whether the recipient can moderate comments on the notification's domain
+func (r *digestRecord) canModerate() bool {
+	return r.IsOwner.Bool || r.IsModerator.Bool
+}
+
+// dueBefore returns the time before which the notification must have been created for it to be due
+func (r *digestRecord) dueBefore(now time.Time) time.Time {
+	// A missing domain user (null mode) results in the notification being due immediately
+	return data.DigestPeriodStart(models.DomainUserDigestMode(r.DigestMode.String), now)
+}
+
+// digestObjects caches objects loaded while composing digests, to avoid fetching them repeatedly
+type digestObjects struct {
+	domains map[uuid.UUID]*data.Domain
+	pages   map[uuid.UUID]*data.DomainPage
+	names   map[uuid.UUID]string
+}
+
+// domain returns a (cached) domain by its ID
+func (o *digestObjects) domain(id *uuid.UUID) (*data.Domain, error) {
+	if d, ok := o.domains[*id]; ok {
+		return d, nil
+	}
+	d, err := TheDomainService.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	o.domains[*id] = d
+	return d, nil
+}
+
+// page returns a (cached) domain page by its ID
+func (o *digestObjects) page(id *uuid.UUID) (*data.DomainPage, error) {
+	if p, ok := o.pages[*id]; ok {
+		return p, nil
+	}
+	p, err := ThePageService.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	o.pages[*id] = p
+	return p, nil
+}
+
+// commenterName returns the (cached) name of the author of the given comment
+func (o *digestObjects) commenterName(c *data.Comment) (string, error) {
+	if c.IsAnonymous() {
+		return c.AuthorName, nil
+	}
+	if s, ok := o.names[c.UserCreated.UUID]; ok {
+		return s, nil
+	}
+	u, err := TheUserService.FindUserByID(&c.UserCreated.UUID)
+	if errors.Is(err, ErrNotFound) {
+		// The user might have been deleted meanwhile
+		return c.AuthorName, nil
+	} else if err != nil {
+		return "", err
+	}
+	o.names[u.ID] = u.Name
+	return u.Name, nil
+}
+
+// process endlessly sends out due digests, sleeping between rounds
+func (svc *digestService) process() {
+	for {
+		if err := svc.sendDue(); err != nil {
+			logger.Errorf("digestService: sending digests failed: %v", err)
+		}
+		time.Sleep(util.DigestPollInterval)
+	}
+}
+
+// send composes and sends a digest out of the given notifications to the user with the given ID. Notifications about
+// comments that no longer exist or have been deleted are skipped
+func (svc *digestService) send(userID *uuid.UUID, recs []*digestRecord, objs *digestObjects) error {
+	logger.Debugf("digestService.send(%s, [%d])", userID, len(recs))
+
+	// Fetch the recipient
+	user, err := TheUserService.FindUserByID(userID)
+	if err != nil {
+		return err
+	}
+
+	// Compose digest items
+	var items []*MailDigestItem
+	for _, r := range recs {
+		// Fetch the comment, skipping it if it's gone
+		comment, err := TheCommentService.FindByID(&r.CommentID)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		} else if comment.IsDeleted {
+			continue
+		}
+
+		// Fetch the page and the domain
+		page, err := objs.page(&comment.PageID)
+		if err != nil {
+			return err
+		}
+		domain, err := objs.domain(&r.DomainID)
+		if err != nil {
+			return err
+		}
+
+		// Figure out the commenter's name
+		name, err := objs.commenterName(comment)
+		if err != nil {
+			return err
+		}
+
+		// Add an item
+		kind := MailNotificationKind(r.Kind)
+		items = append(items, &MailDigestItem{
+			Kind:          kind,
+			CanModerate:   kind != MailNotificationKindCommentStatus && (user.IsSuperuser || r.canModerate()),
+			Domain:        domain,
+			Page:          page,
+			Comment:       comment,
+			CommenterName: name,
+		})
+	}
+
+	// Send out the digest, if there's anything left
+	if len(items) > 0 {
+		if err := TheMailService.SendCommentDigest(user, items); err != nil {
+			return err
+		}
+	}
+
+	// Succeeded
+	return nil
+}
+
+// sendDue sends out a digest to every user having notifications due, and removes the sent notifications
+func (svc *digestService) sendDue() error {
+	// Find the recipient/domain pairs that are due. A pair is due once its oldest notification precedes the start of
+	// the current digest period (a missing domain user results in the notifications being due immediately), and it
+	// isn't backing off after a failed attempt
+	now := time.Now().UTC()
+	modes := []models.DomainUserDigestMode{
+		models.DomainUserDigestModeHourly,
+		models.DomainUserDigestModeDaily,
+		models.DomainUserDigestModeWeekly,
+	}
+	dueExps := []goqu.Expression{
+		goqu.And(
+			goqu.Or(goqu.I("du.digest_mode").IsNull(), goqu.I("du.digest_mode").NotIn(modes)),
+			goqu.MIN("mn.ts_created").Lt(now)),
+	}
+	for _, m := range modes {
+		dueExps = append(dueExps, goqu.And(
+			goqu.I("du.digest_mode").Eq(m),
+			goqu.MIN("mn.ts_created").Lt(data.DigestPeriodStart(m, now))))
+	}
+	var pairs []struct {
+		UserID   uuid.UUID `db:"user_id"`
+		DomainID uuid.UUID `db:"domain_id"`
+	}
+	err := db.From(goqu.T("cm_mail_notifications").As("mn")).
+		Select("mn.user_id", "mn.domain_id").
+		LeftJoin(
+			goqu.T("cm_domains_users").As("du"),
+			goqu.On(goqu.Ex{"du.domain_id": goqu.I("mn.domain_id"), "du.user_id": goqu.I("mn.user_id")})).
+		GroupBy("mn.user_id", "mn.domain_id", "du.digest_mode").
+		Having(
+			goqu.Or(dueExps...),
+			goqu.Or(goqu.MAX("mn.ts_next_attempt").IsNull(), goqu.MAX("mn.ts_next_attempt").Lte(now))).
+		Order(goqu.MIN("mn.ts_created").Asc()).
+		ScanStructs(&pairs)
+	if err != nil {
+		logger.Errorf("digestService.sendDue: ScanStructs() failed: %v", err)
+		return translateDBErrors(err)
+	}
+
+	// Collect the due domains per recipient, keeping the order of appearance
+	dueDomains := map[uuid.UUID][]uuid.UUID{}
+	var userIDs []uuid.UUID
+	for _, p := range pairs {
+		if _, ok := dueDomains[p.UserID]; !ok {
+			userIDs = append(userIDs, p.UserID)
+		}
+		dueDomains[p.UserID] = append(dueDomains[p.UserID], p.DomainID)
+	}
+
+	// Send a digest to each recipient
+	objs := &digestObjects{
+		domains: map[uuid.UUID]*data.Domain{},
+		pages:   map[uuid.UUID]*data.DomainPage{},
+		names:   map[uuid.UUID]string{},
+	}
+	for _, id := range userIDs {
+		// Fetch the recipient's notifications for the due domains along with their domain settings
+		var recs []*digestRecord
+		err := db.From(goqu.T("cm_mail_notifications").As("mn")).
+			Select(
+				"mn.*",
+				goqu.I("du.digest_mode").As("du_digest_mode"),
+				goqu.I("du.is_owner").As("du_is_owner"),
+				goqu.I("du.is_moderator").As("du_is_moderator")).
+			LeftJoin(
+				goqu.T("cm_domains_users").As("du"),
+				goqu.On(goqu.Ex{"du.domain_id": goqu.I("mn.domain_id"), "du.user_id": goqu.I("mn.user_id")})).
+			Where(goqu.I("mn.user_id").Eq(id), goqu.I("mn.domain_id").In(dueDomains[id])).
+			Order(goqu.I("mn.domain_id").Asc(), goqu.I("mn.ts_created").Asc()).
+			ScanStructs(&recs)
+		if err != nil {
+			logger.Errorf("digestService.sendDue: ScanStructs() failed: %v", err)
+			return translateDBErrors(err)
+		}
+		ids := make([]uuid.UUID, len(recs))
+		attempts := 0
+		for i, r := range recs {
+			ids[i] = r.ID
+			attempts = max(attempts, r.Attempts)
+		}
+
+		// Try to send the digest
+		if err := svc.send(&id, recs, objs); err != nil {
+			// Give up on the notifications once the max number of attempts is reached
+			if attempts++; attempts >= util.DigestMaxSendAttempts {
+				logger.Warningf("Failed to send digest to user %s, giving up after %d attempts: %v", &id, attempts, err)
+			} else {
+				// Otherwise keep them and back off before retrying
+				logger.Warningf("Failed to send digest to user %s (attempt %d), will retry: %v", &id, attempts, err)
+				_, err := db.Update("cm_mail_notifications").
+					Set(goqu.Record{
+						"attempts":        attempts,
+						"ts_next_attempt": now.Add(data.DigestRetryDelay(attempts)),
+					}).
+					Where(goqu.I("id").In(ids)).
+					Executor().Exec()
+				if err != nil {
+					logger.Errorf("digestService.sendDue: Exec() failed: %v", err)
+					return translateDBErrors(err)
+				}
+				continue
+			}
+		}
+
+		// Remove the sent (or given up) notifications
+		if _, err := db.Delete("cm_mail_notifications").Where(goqu.I("id").In(ids)).Executor().Exec(); err != nil {
+			logger.Errorf("digestService.sendDue: Exec() failed: %v", err)
+			return translateDBErrors(err)
+		}
+	}
+
+	// Succeeded
+	return nil
+}
@@ -65,6 +65,9 @@ type DomainService interface {
 	// ListDomainFederatedIdPs fetches and returns a list of federated identity providers enabled for the domain with
 	// the given ID
 	ListDomainFederatedIdPs(domainID *uuid.UUID) ([]models.FederatedIdpID, error)
+	// ListRoleRules fetches and returns role mapping rules of the domain with the given ID, in the order of their
+	// evaluation
+	ListRoleRules(domainID *uuid.UUID) ([]*data.DomainRoleRule, error)
 	// PurgeByID permanently removes specified comments for the specified domain by its ID.
 	//   - deleted indicates whether to remove comments marked as deleted
 	//   - userDeleted indicates whether to remove comments created by now deleted users
@@ -74,6 +77,8 @@ type DomainService interface {
 	SaveExtensions(domainID *uuid.UUID, extensions []*data.DomainExtension) error
 	// SaveIdPs saves domain's identity provider links
 	SaveIdPs(domainID *uuid.UUID, idps []models.FederatedIdpID) error
+	// SaveRoleRules replaces domain's role mapping rules with the given ones
+	SaveRoleRules(domainID *uuid.UUID, rules []*data.DomainRoleRule) error
 	// SetReadonly sets the readonly status for the given domain
 	SetReadonly(domainID *uuid.UUID, readonly bool) error
 	// Update updates an existing domain record in the database
@@ -94,6 +99,11 @@ type domainService struct{}
 func (svc *domainService) ClearByID(id *uuid.UUID) error {
 	logger.Debugf("domainService.ClearByID(%s)", id)
 
+	// Fire an event
+	if err := handleDomainEventByID(&plugin.DomainClearEvent{}, id); err != nil {
+		return err
+	}
+
 	// Remove all domain's pages, which will also cause the removal of all comments, votes, and view stats
 	if _, err := db.Delete("cm_domain_pages").Where(goqu.Ex{"domain_id": id}).Executor().Exec(); err != nil {
 		logger.Errorf("domainService.ClearByID: Exec() for page removal failed: %v", err)
@@ -135,6 +145,11 @@ func (svc *domainService) CountForUser(userID *uuid.UUID, owner, moderator bool)
 func (svc *domainService) Create(userID *uuid.UUID, domain *data.Domain) error {
 	logger.Debugf("domainService.Create(%s, %#v)", userID, domain)
 
+	// Fire an event, letting plugins adjust the domain
+	if _, err := handleDomainEvent(&plugin.DomainCreateEvent{}, domain); err != nil {
+		return err
+	}
+
 	// Insert a new domain record
 	if err := db.ExecOne(db.Insert("cm_domains").Rows(domain)); err != nil {
 		logger.Errorf("domainService.Create: ExecOne() failed: %v", err)
@@ -152,6 +167,13 @@ func (svc *domainService) Create(userID *uuid.UUID, domain *data.Domain) error {
 
 func (svc *domainService) DeleteByID(id *uuid.UUID) error {
 	logger.Debugf("domainService.DeleteByID(%s)", id)
+
+	// Fire an event
+	if err := handleDomainEventByID(&plugin.DomainDeleteEvent{}, id); err != nil {
+		return err
+	}
+
+	// Delete the domain record
 	if err := db.ExecOne(db.Delete("cm_domains").Where(goqu.Ex{"id": id})); err != nil {
 		logger.Errorf("domainService.DeleteByID: ExecOne() failed: %v", err)
 		return translateDBErrors(err)
@@ -211,6 +233,7 @@ func (svc *domainService) FindDomainUserByHost(host string, userID *uuid.UUID, c
 				goqu.I("du.notify_replies").As("du_notify_replies"),
 				goqu.I("du.notify_moderator").As("du_notify_moderator"),
 				goqu.I("du.notify_comment_status").As("du_notify_comment_status"),
+				goqu.I("du.digest_mode").As("du_digest_mode"),
 				goqu.I("du.ts_created").As("du_ts_created")).
 			LeftJoin(
 				goqu.T("cm_domains_users").As("du"),
@@ -238,6 +261,7 @@ func (svc *domainService) FindDomainUserByID(domainID, userID *uuid.UUID, create
 				goqu.I("du.notify_replies").As("du_notify_replies"),
 				goqu.I("du.notify_moderator").As("du_notify_moderator"),
 				goqu.I("du.notify_comment_status").As("du_notify_comment_status"),
+				goqu.I("du.digest_mode").As("du_digest_mode"),
 				goqu.I("du.ts_created").As("du_ts_created")).
 			LeftJoin(
 				goqu.T("cm_domains_users").As("du"),
@@ -304,6 +328,7 @@ func (svc *domainService) ListByDomainUser(userID, curUserID *uuid.UUID, superus
 			goqu.I("du.notify_replies").As("du_notify_replies"),
 			goqu.I("du.notify_moderator").As("du_notify_moderator"),
 			goqu.I("du.notify_comment_status").As("du_notify_comment_status"),
+			goqu.I("du.digest_mode").As("du_digest_mode"),
 			goqu.I("du.ts_created").As("du_ts_created"),
 			// Domain user fields for curUserID
 			goqu.I("duc.is_owner").As("duc_is_owner"))
@@ -448,6 +473,23 @@ func (svc *domainService) ListDomainFederatedIdPs(domainID *uuid.UUID) ([]models
 	return res, nil
 }
 
+func (svc *domainService) ListRoleRules(domainID *uuid.UUID) ([]*data.DomainRoleRule, error) {
+	logger.Debugf("domainService.ListRoleRules(%s)", domainID)
+
+	// Query the rules
+	var res []*data.DomainRoleRule
+	if err := db.From("cm_domain_role_rules").
+		Where(goqu.Ex{"domain_id": domainID}).
+		Order(goqu.I("sort_order").Asc()).
+		ScanStructs(&res); err != nil {
+		logger.Errorf("domainService.ListRoleRules: ScanStructs() failed: %v", err)
+		return nil, translateDBErrors(err)
+	}
+
+	// Succeeded
+	return res, nil
+}
+
 func (svc *domainService) PurgeByID(id *uuid.UUID, deleted, userDeleted bool) (int64, error) {
 	logger.Debugf("domainService.PurgeByID(%s, %v, %v)", id, deleted, userDeleted)
 
@@ -456,6 +498,11 @@ func (svc *domainService) PurgeByID(id *uuid.UUID, deleted, userDeleted bool) (i
 		return 0, nil
 	}
 
+	// Fire an event
+	if err := handleDomainEventByID(&plugin.DomainPurgeEvent{}, id); err != nil {
+		return 0, err
+	}
+
 	// Prepare filter
 	var filter []exp.Expression
 	if deleted {
@@ -545,9 +592,50 @@ func (svc *domainService) SaveIdPs(domainID *uuid.UUID, idps []models.FederatedI
 	return nil
 }
 
+func (svc *domainService) SaveRoleRules(domainID *uuid.UUID, rules []*data.DomainRoleRule) error {
+	logger.Debugf("domainService.SaveRoleRules(%s, [%d rules])", domainID, len(rules))
+
+	// Replace the rules within a transaction, so that a failure leaves the existing ones intact
+	err := db.WithTx(func(tx *goqu.TxDatabase) error {
+		// Delete any existing rules
+		if _, err := tx.Delete("cm_domain_role_rules").Where(goqu.Ex{"domain_id": domainID}).Executor().Exec(); err != nil {
+			logger.Errorf("domainService.SaveRoleRules: Exec() failed for deleting records: %v", err)
+			return err
+		}
+
+		// Insert the new rules, if any
+		if len(rules) > 0 {
+			if _, err := tx.Insert("cm_domain_role_rules").Rows(rules).Executor().Exec(); err != nil {
+				logger.Errorf("domainService.SaveRoleRules: Exec() failed for inserting records: %v", err)
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return translateDBErrors(err)
+	}
+
+	// Succeeded
+	return nil
+}
+
 func (svc *domainService) SetReadonly(domainID *uuid.UUID, readonly bool) error {
 	logger.Debugf("domainService.SetReadonly(%s, %v)", domainID, readonly)
 
+	// If there are plugins around, fire an event carrying the new status, which a plugin may alter
+	if ThePluginManager.Active() {
+		d, err := svc.FindByID(domainID)
+		if err != nil {
+			return err
+		}
+		d.IsReadonly = readonly
+		if _, err := handleDomainEvent(&plugin.DomainReadonlyEvent{}, d); err != nil {
+			return err
+		}
+		readonly = d.IsReadonly
+	}
+
 	// Update the domain record
 	if err := db.ExecOne(db.Update("cm_domains").Set(goqu.Record{"is_readonly": readonly}).Where(goqu.Ex{"id": domainID})); err != nil {
 		logger.Errorf("domainService.SetReadonly: ExecOne() failed: %v", err)
@@ -561,6 +649,11 @@ func (svc *domainService) SetReadonly(domainID *uuid.UUID, readonly bool) error
 func (svc *domainService) Update(domain *data.Domain) error {
 	logger.Debugf("domainService.Update(%#v)", domain)
 
+	// Fire an event, letting plugins adjust the domain
+	if _, err := handleDomainEvent(&plugin.DomainUpdateEvent{}, domain); err != nil {
+		return err
+	}
+
 	// Update the domain record
 	if err := db.ExecOne(db.Update("cm_domains").Set(domain).Where(goqu.Ex{"id": &domain.ID})); err != nil {
 		logger.Errorf("domainService.Update: ExecOne() failed: %v", err)
@@ -692,3 +785,49 @@ func (svc *domainService) fetchDomainUser(q *goqu.SelectDataset, userID *uuid.UU
 	// Succeeded
 	return &r.Domain, du, nil
 }
+
+// handleDomainEvent fires a domain event for the given domain, updating the domain if any of its properties have been
+// changed by plugins
+func handleDomainEvent[E plugin.DomainPayload](e E, d *data.Domain) (changed bool, err error) {
+	// Skip unless the plugin manager is active
+	if !ThePluginManager.Active() {
+		return
+	}
+
+	// Set the event's payload
+	e.SetDomain(d.ToPluginDomain())
+
+	// Make a clone of the original domain
+	dc := d.ToPluginDomain()
+
+	// Fire an event
+	if err = ThePluginManager.HandleEvent(e); err != nil {
+		return
+	}
+
+	// If event handling changed the domain, update the working model
+	if *e.Domain() != *dc {
+		d.FromPluginDomain(e.Domain())
+		changed = true
+	}
+	return
+}
+
+// handleDomainEventByID fetches a domain by its ID and fires a domain event for it, discarding any changes made during
+// the event handling
+func handleDomainEventByID[E plugin.DomainPayload](e E, domainID *uuid.UUID) error {
+	// Skip unless the plugin manager is active
+	if !ThePluginManager.Active() {
+		return nil
+	}
+
+	// Fetch the domain
+	d, err := TheDomainService.FindByID(domainID)
+	if err != nil {
+		return err
+	}
+
+	// Fire the event
+	_, err = handleDomainEvent(e, d)
+	return err
+}
@@ -3,33 +3,24 @@ package svc
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/go-openapi/strfmt"
 	"github.com/google/uuid"
 	"gitlab.com/comentario/comentario/internal/api/models"
 	"gitlab.com/comentario/comentario/internal/data"
 	"gitlab.com/comentario/comentario/internal/util"
+	"io"
 	"strings"
 	"time"
 )
 
-// comentarioExportMeta is the export metadata header
-type comentarioExportMeta struct {
-	Version int `json:"version"`
-}
-
 //----------------------------------------------------------------------------------------------------------------------
 // V1 export format
 //----------------------------------------------------------------------------------------------------------------------
 
 type HexIDV1 string
 
-type comentarioExportV1 struct {
-	Version    int           `json:"version"`
-	Comments   []CommentV1   `json:"comments"`
-	Commenters []CommenterV1 `json:"commenters"`
-}
-
 type CommentV1 struct {
 	CommentHex   HexIDV1   `json:"commentHex"`
 	CommenterHex HexIDV1   `json:"commenterHex"`
@@ -63,424 +54,305 @@ const AnonymousCommenterHexIDV1 = HexIDV1("0000000000000000000000000000000000000
 // V3 export format
 //----------------------------------------------------------------------------------------------------------------------
 
-type comentarioExportV3 struct {
-	Version    int                  `json:"version"`
-	Pages      []*models.DomainPage `json:"pages"`
-	Comments   []*models.Comment    `json:"comments"`
-	Commenters []*models.Commenter  `json:"commenters"`
-}
-
-func comentarioExport(domainID *uuid.UUID) ([]byte, error) {
-	// Create an export data object
-	exp := comentarioExportV3{Version: 3}
-
+// comentarioExport writes the domain data in the native (V3) format, which is a JSON object holding arrays of pages,
+// comments, and commenters. The version comes first so that it can be read without parsing the whole thing
+func comentarioExport(run *exportRun) error {
 	// Fetch pages
-	if ps, err := ThePageService.ListByDomain(domainID); err != nil {
-		return nil, err
-	} else {
-		exp.Pages = data.SliceToDTOs[*data.DomainPage, *models.DomainPage](ps)
+	ps, err := run.pages()
+	if err != nil {
+		return err
 	}
 
-	// Fetch comments
-	if cs, err := TheCommentService.ListByDomain(domainID); err != nil {
-		return nil, err
-	} else {
-		exp.Comments = cs
+	// Write the version
+	if _, err := io.WriteString(run.w, `{"version":3`); err != nil {
+		return err
 	}
 
-	// Fetch commenters
-	if um, dus, err := TheUserService.ListByDomain(domainID, false, "", "", data.SortAsc, -1); err != nil {
-		return nil, err
-	} else {
-		cs := make([]*models.Commenter, 0, len(dus))
-		for _, du := range dus {
-			// Find the related user instance
-			if u, ok := um[du.UserID]; ok {
-				// Convert the User/DomainUser combo into a commenter
-				cs = append(cs, u.ToCommenter(du.IsCommenter, du.IsModerator))
+	// Write the pages
+	err = run.writeJSONArray("pages", func(add func(v any) error) error {
+		for _, p := range ps {
+			if err := add(p.ToDTO()); err != nil {
+				return err
 			}
 		}
-		exp.Commenters = cs
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	// Convert the data into JSON
-	jsonData, err := json.Marshal(exp)
+	// Stream the comments
+	err = run.writeJSONArray("comments", func(add func(v any) error) error {
+		return run.comments(func(ec *exportComment) error {
+			return add(ec.ToDTO(run.domain.IsHTTPS, run.domain.Host, ec.PagePath))
+		})
+	})
 	if err != nil {
-		logger.Errorf("comentarioExport: json.Marshal() failed: %v", err)
-		return nil, err
+		return err
 	}
 
-	// Compress the JSON data with Gzip
-	gzippedData, err := util.CompressGzip(jsonData)
+	// Write the commenters
+	err = run.writeJSONArray("commenters", func(add func(v any) error) error {
+		cs, err := run.commenters()
+		if err != nil {
+			return err
+		}
+		for _, c := range cs {
+			if err := add(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		logger.Errorf("comentarioExport: CompressGzip() failed: %v", err)
-		return nil, err
+		return err
 	}
-
-	// Succeeded
-	return gzippedData, nil
+	_, err = io.WriteString(run.w, "}")
+	return err
 }
 
-func comentarioImport(curUser *data.User, domain *data.Domain, buf []byte) *ImportResult {
-	// Unmarshal the metadata to determine the format version
-	var exp comentarioExportMeta
-	if err := json.Unmarshal(buf, &exp); err != nil {
-		logger.Errorf("comentarioImport: json.Unmarshal() failed: %v", err)
-		return importError(err)
+func comentarioImport(run *importRun) error {
+	// Read the metadata to determine the format version
+	version, err := comentarioReadVersion(run)
+	if err != nil {
+		logger.Errorf("comentarioImport: comentarioReadVersion() failed: %v", err)
+		return err
 	}
-	logger.Debugf("Comentario export version: %d", exp.Version)
+	logger.Debugf("Comentario export version: %d", version)
 
-	switch exp.Version {
+	switch version {
 	case 1:
-		return comentarioImportV1(curUser, domain, buf)
+		return comentarioImportV1(run)
 
 	case 3:
-		return comentarioImportV3(curUser, domain, buf)
+		return comentarioImportV3(run)
 
 	default:
 		// Unrecognised version
-		err := fmt.Errorf("invalid Comentario export version (%d)", exp.Version)
+		err := fmt.Errorf("invalid Comentario export version (%d)", version)
 		logger.Errorf("comentarioImport: %v", err)
-		return importError(err)
+		return err
 	}
 }
 
-func comentarioImportV1(curUser *data.User, domain *data.Domain, buf []byte) *ImportResult {
-	// Unmarshal the data
-	var exp comentarioExportV1
-	if err := json.Unmarshal(buf, &exp); err != nil {
-		logger.Errorf("comentarioImportV1: json.Unmarshal() failed: %v", err)
-		return importError(err)
-	}
-
-	result := &ImportResult{}
-
-	// Fetch domain config
-	maxLength := TheDomainConfigService.GetInt(&domain.ID, data.DomainConfigKeyMaxCommentLength)
-	logger.Debugf("Max. comment text length is %d", maxLength)
-
-	// Create a map of commenterHex -> user ID
+func comentarioImportV1(run *importRun) error {
+	// Read the commenters and create a map of commenterHex -> user ID
 	commenterIDMap := map[HexIDV1]uuid.UUID{
 		AnonymousCommenterHexIDV1: data.AnonymousUser.ID,
 		"anonymous":               data.AnonymousUser.ID, // A special ugly case for the "anonymous" commenter in Commento
 	}
-	for _, commenter := range exp.Commenters {
-		result.UsersTotal++
-
-		// Import the user and domain user
-		var user *data.User
-		if u, userAdded, domainUserAdded, err := importUserByEmail(
-			commenter.Email,
-			"", // Local auth only
-			commenter.Name,
-			commenter.WebsiteURL,
-			"Imported from Commento/Comentario",
-			true,
-			false, // No SSO flag support in the export
-			&curUser.ID,
-			&domain.ID,
-			commenter.JoinDate,
-		); err != nil {
-			return result.WithError(err)
-		} else {
-			user = u
-
-			// Increment user counters
-			if userAdded {
-				result.UsersAdded++
-			}
-			if domainUserAdded {
-				result.DomainUsersAdded++
+	err := importJSONArrays(run, false, map[string]func(dec *json.Decoder) error{
+		"commenters": func(dec *json.Decoder) error {
+			var commenter CommenterV1
+			if err := dec.Decode(&commenter); err != nil {
+				return err
 			}
-		}
 
-		// Add the commenter's hex-to-ID mapping
-		commenterIDMap[commenter.CommenterHex] = user.ID
-	}
+			// Import the user and domain user
+			uid, err := run.user(&importAuthor{
+				Email:       commenter.Email,
+				Name:        commenter.Name,
+				WebsiteURL:  commenter.WebsiteURL,
+				Remarks:     "Imported from Commento/Comentario",
+				RealEmail:   true,
+				CreatedTime: commenter.JoinDate,
+			})
+			if err != nil {
+				return err
+			}
 
-	// Prepare a map of comment HexID -> Comment ID (randomly generated)
-	commentHexToIDMap := make(map[HexIDV1]uuid.UUID, len(exp.Comments))
-	for _, c := range exp.Comments {
-		commentHexToIDMap[c.CommentHex] = uuid.New()
+			// Add the commenter's hex-to-ID mapping
+			commenterIDMap[commenter.CommenterHex] = uid
+			return nil
+		},
+	})
+	if err != nil {
+		logger.Errorf("comentarioImportV1: failed to read commenters: %v", err)
+		return err
 	}
 
-	commentParentIDMap := map[uuid.UUID][]*data.Comment{} // Groups comment lists by their parent ID
-	pageIDMap := map[string]uuid.UUID{}
-
-	// Iterate over all comments
-	for _, comment := range exp.Comments {
-		result.CommentsTotal++
-
-		// Find the comment ID (it must exist at this point)
-		commentID, ok := commentHexToIDMap[comment.CommentHex]
-		if !ok {
-			err := fmt.Errorf("failed to map comment Hex (%s) to comment ID", comment.CommentHex)
-			logger.Errorf("comentarioImportV1: %v", err)
-			return result.WithError(err)
-		}
-
-		// Find the comment's author
-		uid, ok := commenterIDMap[comment.CommenterHex]
-		if !ok {
-			err := fmt.Errorf("failed to find mapped commenter (hex=%v)", comment.CommenterHex)
-			logger.Errorf("comentarioImportV1: %v", err)
-			return result.WithError(err)
-		}
-
-		// There seems to be a little confusion about the format: Commento filed the path under "url", whereas
-		// Comentario used "path"
-		pagePath := comment.Path
-		if pagePath == "" {
-			pagePath = comment.URL
-		}
-		pagePath = "/" + strings.TrimPrefix(pagePath, "/")
-
-		// Find the page for the comment based on path
-		var pageID uuid.UUID
-		if id, ok := pageIDMap[pagePath]; ok {
-			pageID = id
-
-			// Page doesn't exist. Find or insert a page with this path
-		} else if page, added, err := ThePageService.UpsertByDomainPath(domain, pagePath, "", nil); err != nil {
-			return result.WithError(err)
-
-		} else {
-			pageID = page.ID
-			pageIDMap[pagePath] = pageID
-			result.PagesTotal++
-
-			// If the page was added, increment the page count
-			if added {
-				result.PagesAdded++
+	// Stream the comments
+	return importJSONArrays(run, true, map[string]func(dec *json.Decoder) error{
+		"comments": func(dec *json.Decoder) error {
+			var comment CommentV1
+			if err := dec.Decode(&comment); err != nil {
+				return err
 			}
-		}
-
-		// Find the parent comment ID. For indexing purposes only, root ID will be represented by a zero UUID. It will
-		// also be the fallback, should parent ID not exist in the map
-		parentCommentID := uuid.NullUUID{}
-		pzID := util.ZeroUUID
-		if id, ok := commentHexToIDMap[comment.ParentHex]; ok {
-			parentCommentID = uuid.NullUUID{UUID: id, Valid: true}
-			pzID = id
-		}
-
-		// Create a new comment instance
-		del := comment.Deleted || comment.Markdown == "" || comment.Markdown == "[deleted]"
-		c := &data.Comment{
-			ID:            commentID,
-			ParentID:      parentCommentID,
-			PageID:        pageID,
-			Score:         comment.Score,
-			IsApproved:    comment.State == "approved",
-			IsPending:     comment.State == "unapproved",
-			IsDeleted:     del,
-			CreatedTime:   comment.CreationDate,
-			ModeratedTime: sql.NullTime{Time: comment.CreationDate, Valid: true},
-			UserCreated:   uuid.NullUUID{UUID: uid, Valid: true},
-			UserModerated: uuid.NullUUID{UUID: curUser.ID, Valid: true},
-		}
 
-		// Render Markdown into HTML (the latter doesn't get exported)
-		if !del {
-			// Truncate comment text to avoid errors
-			if err := TheCommentService.SetMarkdown(c, util.TruncateStr(comment.Markdown, maxLength), &domain.ID, nil); err != nil {
-				return result.WithError(err)
+			// Find the comment's author
+			uid, ok := commenterIDMap[comment.CommenterHex]
+			if !ok {
+				err := fmt.Errorf("failed to find mapped commenter (hex=%v)", comment.CommenterHex)
+				logger.Errorf("comentarioImportV1: %v", err)
+				return err
 			}
-		}
-
-		// File it under the appropriate parent ID
-		if l, ok := commentParentIDMap[pzID]; ok {
-			commentParentIDMap[pzID] = append(l, c)
-		} else {
-			commentParentIDMap[pzID] = []*data.Comment{c}
-		}
-	}
-
-	// Recurse the comment tree (map) to insert the comments in the right order (parents-to-children), starting with the
-	// root (= zero UUID)
-	countsPerPage := map[uuid.UUID]int{}
-	result.CommentsImported, result.CommentsNonDeleted, result.Error = insertCommentsForParent(util.ZeroUUID, commentParentIDMap, countsPerPage)
 
-	// Increase comment count on the domain, ignoring errors
-	_ = TheDomainService.IncrementCounts(&domain.ID, result.CommentsNonDeleted, 0)
+			// There seems to be a little confusion about the format: Commento filed the path under "url", whereas
+			// Comentario used "path"
+			pagePath := comment.Path
+			if pagePath == "" {
+				pagePath = comment.URL
+			}
+			pagePath = "/" + strings.TrimPrefix(pagePath, "/")
 
-	// Increase comment counts on all pages
-	for pageID, pc := range countsPerPage {
-		if pc > 0 {
-			_ = ThePageService.IncrementCounts(&pageID, pc, 0)
-		}
-	}
+			// Root comments have "root" as their parent
+			rec := &importRecord{ID: string(comment.CommentHex), PagePath: pagePath}
+			if comment.ParentHex != "" && comment.ParentHex != "root" {
+				rec.ParentID = string(comment.ParentHex)
+			}
 
-	// Succeeded
-	return result
+			// Create a new comment instance. Markdown is rendered into HTML (the latter doesn't get exported)
+			del := comment.Deleted || comment.Markdown == "" || comment.Markdown == "[deleted]"
+			rec.Comment = &data.Comment{
+				Score:         comment.Score,
+				IsApproved:    comment.State == "approved",
+				IsPending:     comment.State == "unapproved",
+				IsDeleted:     del,
+				CreatedTime:   comment.CreationDate,
+				ModeratedTime: sql.NullTime{Time: comment.CreationDate, Valid: true},
+				UserCreated:   uuid.NullUUID{UUID: uid, Valid: true},
+				UserModerated: uuid.NullUUID{UUID: run.curUser.ID, Valid: true},
+			}
+			if !del {
+				rec.Markdown = comment.Markdown
+			}
+			return run.add(rec)
+		},
+	})
 }
 
-func comentarioImportV3(curUser *data.User, domain *data.Domain, buf []byte) *ImportResult {
-	// Unmarshal the data
-	var exp comentarioExportV3
-	if err := json.Unmarshal(buf, &exp); err != nil {
-		logger.Errorf("comentarioImportV3: json.Unmarshal() failed: %v", err)
-		return importError(err)
-	}
-
-	result := &ImportResult{}
-
-	// Create a map of user IDs
+func comentarioImportV3(run *importRun) error {
+	// Read the commenters and pages, and create maps of their IDs
 	commenterIDMap := map[strfmt.UUID]uuid.UUID{
 		strfmt.UUID(data.AnonymousUser.ID.String()): data.AnonymousUser.ID,
 	}
-	for _, commenter := range exp.Commenters {
-		result.UsersTotal++
-
-		// Import the user and domain user
-		var user *data.User
-		if u, userAdded, domainUserAdded, err := importUserByEmail(
-			string(commenter.Email),
-			string(commenter.FederatedIDP),
-			commenter.Name,
-			string(commenter.WebsiteURL),
-			"Imported from Comentario V3",
-			true,
-			commenter.FederatedSso,
-			&curUser.ID,
-			&domain.ID,
-			time.Time(commenter.CreatedTime),
-		); err != nil {
-			return result.WithError(err)
-		} else {
-			user = u
-
-			// Increment user counters
-			if userAdded {
-				result.UsersAdded++
+	pageMap := map[strfmt.UUID]*models.DomainPage{}
+	err := importJSONArrays(run, false, map[string]func(dec *json.Decoder) error{
+		"commenters": func(dec *json.Decoder) error {
+			var commenter models.Commenter
+			if err := dec.Decode(&commenter); err != nil {
+				return err
 			}
-			if domainUserAdded {
-				result.DomainUsersAdded++
-			}
-		}
 
-		// Add the commenter's hex-to-ID mapping
-		commenterIDMap[commenter.ID] = user.ID
-	}
-
-	// Create a map of page IDs
-	pageIDMap := make(map[strfmt.UUID]uuid.UUID, len(exp.Pages))
-	for _, page := range exp.Pages {
-		result.PagesTotal++
-
-		// Find the page for the comment based on path
-		p, added, err := ThePageService.UpsertByDomainPath(domain, string(page.Path), page.Title, nil)
-		if err != nil {
-			return result.WithError(err)
-
-		}
-
-		// Store the ID mapping
-		pageIDMap[page.ID] = p.ID
+			// Import the user and domain user
+			uid, err := run.user(&importAuthor{
+				Email:          string(commenter.Email),
+				FederatedIdpID: string(commenter.FederatedIDP),
+				Name:           commenter.Name,
+				WebsiteURL:     string(commenter.WebsiteURL),
+				Remarks:        "Imported from Comentario V3",
+				RealEmail:      true,
+				FederatedSSO:   commenter.FederatedSso,
+				CreatedTime:    time.Time(commenter.CreatedTime),
+			})
+			if err != nil {
+				return err
+			}
 
-		// If the page was added, increment the page count
-		if added {
-			result.PagesAdded++
-		}
-	}
+			// Add the commenter's ID mapping
+			commenterIDMap[commenter.ID] = uid
+			return nil
+		},
+		"pages": func(dec *json.Decoder) error {
+			var page models.DomainPage
+			if err := dec.Decode(&page); err != nil {
+				return err
+			}
 
-	// Prepare a map of comment IDs (randomly generated)
-	commentIDMap := make(map[strfmt.UUID]uuid.UUID, len(exp.Comments))
-	for _, c := range exp.Comments {
-		commentIDMap[c.ID] = uuid.New()
+			// Find or insert a page with this path
+			if _, err := run.page(string(page.Path), page.Title); err != nil {
+				return err
+			}
+			pageMap[page.ID] = &page
+			return nil
+		},
+	})
+	if err != nil {
+		logger.Errorf("comentarioImportV3: failed to read commenters and pages: %v", err)
+		return err
 	}
 
-	// Create a map that groups comment lists by their parent ID
-	commentParentIDMap := map[uuid.UUID][]*data.Comment{}
-
-	// Iterate over all comments
-	for _, comment := range exp.Comments {
-		result.CommentsTotal++
-
-		// Find the comment ID (it must exist at this point)
-		commentID, ok := commentIDMap[comment.ID]
-		if !ok {
-			err := fmt.Errorf("failed to map comment with ID=%s", comment.ID)
-			logger.Errorf("comentarioImportV3: %v", err)
-			return result.WithError(err)
-		}
-
-		// Find the comment's author
-		uid, ok := commenterIDMap[comment.UserCreated]
-		if !ok {
-			err := fmt.Errorf("failed to map commenter with ID=%s", comment.UserCreated)
-			logger.Errorf("comentarioImportV3: %v", err)
-			return result.WithError(err)
-		}
+	// Stream the comments
+	return importJSONArrays(run, true, map[string]func(dec *json.Decoder) error{
+		"comments": func(dec *json.Decoder) error {
+			var comment models.Comment
+			if err := dec.Decode(&comment); err != nil {
+				return err
+			}
 
-		// Find the comment's page ID
-		pageID, ok := pageIDMap[comment.PageID]
-		if !ok {
-			err := fmt.Errorf("failed to map page with ID=%s", comment.PageID)
-			logger.Errorf("comentarioImportV3: %v", err)
-			return result.WithError(err)
-		}
+			// Find the comment's author
+			uid, ok := commenterIDMap[comment.UserCreated]
+			if !ok {
+				err := fmt.Errorf("failed to map commenter with ID=%s", comment.UserCreated)
+				logger.Errorf("comentarioImportV3: %v", err)
+				return err
+			}
 
-		// Find the parent comment ID. For indexing purposes only, root ID will be represented by a zero UUID. It will
-		// also be the fallback, should parent ID not exist in the map
-		parentCommentID := uuid.NullUUID{}
-		pzID := util.ZeroUUID
-		if id, ok := commentIDMap[comment.ParentID]; ok {
-			parentCommentID = uuid.NullUUID{UUID: id, Valid: true}
-			pzID = id
-		}
+			// Find the comment's page
+			page, ok := pageMap[comment.PageID]
+			if !ok {
+				err := fmt.Errorf("failed to map page with ID=%s", comment.PageID)
+				logger.Errorf("comentarioImportV3: %v", err)
+				return err
+			}
 
-		// Try to map users who moderated/deleted/edited the comment
-		var umID, udID, ueID uuid.NullUUID
-		umID.UUID, umID.Valid = commenterIDMap[comment.UserModerated]
-		udID.UUID, udID.Valid = commenterIDMap[comment.UserDeleted]
-		ueID.UUID, ueID.Valid = commenterIDMap[comment.UserEdited]
-
-		// Create a new comment instance
-		c := &data.Comment{
-			ID:            commentID,
-			ParentID:      parentCommentID,
-			PageID:        pageID,
-			Markdown:      util.If(comment.IsDeleted, "", comment.Markdown),
-			HTML:          comment.HTML,
-			Score:         int(comment.Score),
-			IsSticky:      comment.IsSticky,
-			IsApproved:    comment.IsApproved,
-			IsPending:     comment.IsPending,
-			IsDeleted:     comment.IsDeleted,
-			CreatedTime:   time.Time(comment.CreatedTime),
-			ModeratedTime: data.ToNullDateTime(comment.ModeratedTime),
-			DeletedTime:   data.ToNullDateTime(comment.DeletedTime),
-			UserCreated:   uuid.NullUUID{UUID: uid, Valid: true},
-			UserModerated: umID,
-			UserDeleted:   udID,
-			UserEdited:    ueID,
-			AuthorName:    comment.AuthorName,
-		}
+			// Try to map users who moderated/deleted/edited the comment
+			var umID, udID, ueID uuid.NullUUID
+			umID.UUID, umID.Valid = commenterIDMap[comment.UserModerated]
+			udID.UUID, udID.Valid = commenterIDMap[comment.UserDeleted]
+			ueID.UUID, ueID.Valid = commenterIDMap[comment.UserEdited]
+
+			// Create a new comment instance, keeping its text as is
+			return run.add(&importRecord{
+				ID:        string(comment.ID),
+				ParentID:  string(comment.ParentID),
+				PagePath:  string(page.Path),
+				PageTitle: page.Title,
+				Comment: &data.Comment{
+					Markdown:      util.If(comment.IsDeleted, "", comment.Markdown),
+					HTML:          comment.HTML,
+					Score:         int(comment.Score),
+					IsSticky:      comment.IsSticky,
+					IsApproved:    comment.IsApproved,
+					IsPending:     comment.IsPending,
+					IsDeleted:     comment.IsDeleted,
+					CreatedTime:   time.Time(comment.CreatedTime),
+					ModeratedTime: data.ToNullDateTime(comment.ModeratedTime),
+					DeletedTime:   data.ToNullDateTime(comment.DeletedTime),
+					UserCreated:   uuid.NullUUID{UUID: uid, Valid: true},
+					UserModerated: umID,
+					UserDeleted:   udID,
+					UserEdited:    ueID,
+					AuthorName:    comment.AuthorName,
+				},
+			})
+		},
+	})
+}
 
-		// File it under the appropriate parent ID
-		if l, ok := commentParentIDMap[pzID]; ok {
-			commentParentIDMap[pzID] = append(l, c)
-		} else {
-			commentParentIDMap[pzID] = []*data.Comment{c}
-		}
+// comentarioReadVersion reads the format version from the export data. The version is expected to come first, so
+// reading stops as soon as it's found
+func comentarioReadVersion(run *importRun) (int, error) {
+	r, err := run.open(false)
+	if err != nil {
+		return 0, err
 	}
-
-	// Recurse the comment tree (map) to insert the comments in the right order (parents-to-children), starting with the
-	// root (= zero UUID)
-	countsPerPage := map[uuid.UUID]int{}
-	result.CommentsImported, result.CommentsNonDeleted, result.Error = insertCommentsForParent(util.ZeroUUID, commentParentIDMap, countsPerPage)
-
-	// Increase comment count on the domain, ignoring errors
-	_ = TheDomainService.IncrementCounts(&domain.ID, result.CommentsNonDeleted, 0)
-
-	// Increase comment counts on all pages
-	for pageID, pc := range countsPerPage {
-		if pc > 0 {
-			_ = ThePageService.IncrementCounts(&pageID, pc, 0)
-		}
+	defer util.LogError(r.Close, "comentarioReadVersion, r.Close()")
+
+	// Read the object until the version key is encountered
+	errFound := errors.New("version found")
+	dec := json.NewDecoder(r)
+	version := 0
+	err = importJSONObject(dec, map[string]func() error{
+		"version": func() error {
+			if err := dec.Decode(&version); err != nil {
+				return err
+			}
+			return errFound
+		},
+	})
+	if err != nil && !errors.Is(err, errFound) {
+		return 0, err
 	}
-
-	// Succeeded
-	return result
+	return version, nil
 }
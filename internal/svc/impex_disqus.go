@@ -4,11 +4,10 @@ import (
 	"database/sql"
 	"encoding/xml"
 	"fmt"
-	md "github.com/JohannesKaufmann/html-to-markdown"
 	"github.com/google/uuid"
 	"gitlab.com/comentario/comentario/internal/data"
 	"gitlab.com/comentario/comentario/internal/util"
-	"regexp"
+	"io"
 	"strings"
 	"time"
 )
@@ -49,161 +48,161 @@ type disqusPost struct {
 	Author       disqusAuthor   `xml:"author"`
 }
 
-type disqusXML struct {
-	XMLName xml.Name       `xml:"disqus"`
-	Threads []disqusThread `xml:"thread"`
-	Posts   []disqusPost   `xml:"post"`
+// disqusExportRef refers to a thread or a parent post in the exported data
+type disqusExportRef struct {
+	Id string `xml:"dsq:id,attr"`
 }
 
-func disqusImport(curUser *data.User, domain *data.Domain, buf []byte) *ImportResult {
-	// Unmarshal the XML data
-	exp := disqusXML{}
-	if err := xml.Unmarshal(buf, &exp); err != nil {
-		logger.Errorf("disqusImport: xml.Unmarshal() failed: %v", err)
-		return importError(err)
-	}
+type disqusExportThread struct {
+	XMLName xml.Name `xml:"thread"`
+	Id      string   `xml:"dsq:id,attr"`
+	URL     string   `xml:"link"`
+	Title   string   `xml:"title"`
+}
 
-	// Map Disqus thread IDs to threads
-	threads := map[string]disqusThread{}
-	for _, thread := range exp.Threads {
-		threads[thread.Id] = thread
-	}
+type disqusExportAuthor struct {
+	Name        string `xml:"name"`
+	Email       string `xml:"email,omitempty"`
+	IsAnonymous bool   `xml:"isAnonymous"`
+}
 
-	result := &ImportResult{}
+type disqusExportPost struct {
+	XMLName      xml.Name           `xml:"post"`
+	Id           string             `xml:"dsq:id,attr"`
+	Message      string             `xml:"message"`
+	CreationDate time.Time          `xml:"createdAt"`
+	IsDeleted    bool               `xml:"isDeleted"`
+	IsSpam       bool               `xml:"isSpam"`
+	Author       disqusExportAuthor `xml:"author"`
+	ThreadId     disqusExportRef    `xml:"thread"`
+	ParentId     *disqusExportRef   `xml:"parent"`
+}
 
-	// Map Disqus emails to user IDs
-	var userIDMap map[string]uuid.UUID
-	var err error
-	if userIDMap, result.UsersAdded, result.DomainUsersAdded, err = disqusMakeUserMap(&curUser.ID, &domain.ID, exp); err != nil {
-		return result.WithError(err)
+// disqusExport writes the domain data as Disqus-compatible XML, with pages as threads and comments as posts
+func disqusExport(run *exportRun) error {
+	// Fetch pages
+	ps, err := run.pages()
+	if err != nil {
+		return err
 	}
 
-	// Total number of users involved
-	result.UsersTotal = len(userIDMap)
-
-	// Prepare a map of Disqus Post ID -> Comment ID (randomly generated)
-	postToCommentIDMap := make(map[string]uuid.UUID, len(exp.Posts))
-	for _, post := range exp.Posts {
-		postToCommentIDMap[post.Id] = uuid.New()
+	// Write the root element, declaring the namespace of the "dsq:id" attributes
+	_, err = io.WriteString(
+		run.w,
+		xml.Header+`<disqus xmlns="http://disqus.com" xmlns:dsq="http://disqus.com/disqus-internals">`+"\n")
+	if err != nil {
+		return err
 	}
 
-	// Instantiate an HTML-to-Markdown converter
-	hmConv := md.NewConverter("", true, nil)
-	reHTMLTags := regexp.MustCompile(`<[^>]+>`)
-	commentParentIDMap := map[uuid.UUID][]*data.Comment{} // Groups comment lists by their parent ID
-	pageIDMap := map[string]uuid.UUID{}
-
-	// Iterate over Disqus posts
-	for _, post := range exp.Posts {
-		result.CommentsTotal++
-
-		// Skip over deleted and spam posts
-		if post.IsDeleted || post.IsSpam {
-			result.CommentsSkipped++
-			continue
+	// Write the threads
+	enc := xml.NewEncoder(run.w)
+	enc.Indent("  ", "  ")
+	for _, p := range ps {
+		if err := enc.Encode(&disqusExportThread{
+			Id:    p.ID.String(),
+			URL:   run.domain.RootURL() + p.Path,
+			Title: p.DisplayTitle(run.domain),
+		}); err != nil {
+			return err
 		}
+	}
 
-		// Find the comment ID (it must exist at this point)
-		commentID, ok := postToCommentIDMap[post.Id]
-		if !ok {
-			err := fmt.Errorf("failed to map Disqus post ID (%s) to comment ID", post.Id)
-			logger.Errorf("disqusImport: %v", err)
-			return result.WithError(err)
+	// Stream the posts
+	err = run.comments(func(ec *exportComment) error {
+		post := &disqusExportPost{
+			Id:           ec.ID.String(),
+			Message:      ec.HTML,
+			CreationDate: ec.CreatedTime.UTC(),
+			IsDeleted:    ec.IsDeleted,
+			IsSpam:       ec.Status() == "rejected",
+			Author: disqusExportAuthor{
+				Name:        ec.DisplayAuthorName(),
+				Email:       ec.AuthorEmail(),
+				IsAnonymous: ec.IsAnonymous(),
+			},
+			ThreadId: disqusExportRef{Id: ec.PageID.String()},
 		}
-
-		// Find the user ID by their email
-		uid := data.AnonymousUser.ID
-		authorName := post.Author.Name
-		if email := disqusAuthorEmail(&post.Author); email != "" {
-			if id, ok := userIDMap[email]; ok {
-				uid = id
-				authorName = ""
-			}
+		if !ec.IsRoot() {
+			post.ParentId = &disqusExportRef{Id: ec.ParentID.UUID.String()}
 		}
+		return enc.Encode(post)
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(run.w, "\n</disqus>\n")
+	return err
+}
 
-		// Extract the path from thread URL
-		var pageID uuid.UUID
-		thread := threads[post.ThreadId.Id]
-		if u, err := util.ParseAbsoluteURL(thread.URL, true, false); err != nil {
-			return result.WithError(err)
-
-			// Find the page for that path
-		} else if id, ok := pageIDMap[u.Path]; ok {
-			pageID = id
-
-			// Page doesn't exist. Find or insert a page with this path
-		} else if page, added, err := ThePageService.UpsertByDomainPath(domain, u.Path, thread.Title, nil); err != nil {
-			return result.WithError(err)
-
-		} else {
-			pageID = page.ID
-			pageIDMap[u.Path] = pageID
-
-			// If the page was added, increment the page count
-			if added {
-				result.PagesAdded++
+func disqusImport(run *importRun) error {
+	// Collect Disqus threads, mapping their IDs to page paths and titles
+	threads := map[string]*importRecord{}
+	err := disqusRead(run, false, map[string]func(dec *xml.Decoder, se *xml.StartElement) error{
+		"thread": func(dec *xml.Decoder, se *xml.StartElement) error {
+			var thread disqusThread
+			if err := dec.DecodeElement(&thread, se); err != nil {
+				return err
 			}
-		}
-
-		// Find the parent comment ID. For indexing purposes only, root ID will be represented by a zero UUID. It will
-		// also be the fallback, should parent ID not exist in the map
-		parentCommentID := uuid.NullUUID{}
-		pzID := util.ZeroUUID
-		if id, ok := postToCommentIDMap[post.ParentId.Id]; ok {
-			parentCommentID = uuid.NullUUID{UUID: id, Valid: true}
-			pzID = id
-		}
-
-		// "Reverse-convert" comment text to Markdown
-		markdown, err := hmConv.ConvertString(post.Message)
-		if err != nil {
-			// Just strip all tags on error
-			markdown = reHTMLTags.ReplaceAllString(post.Message, "")
-		}
 
-		// Create a new comment instance
-		c := &data.Comment{
-			ID:            commentID,
-			ParentID:      parentCommentID,
-			PageID:        pageID,
-			Markdown:      markdown,
-			HTML:          post.Message,
-			IsApproved:    true,
-			CreatedTime:   post.CreationDate,
-			ModeratedTime: sql.NullTime{Time: post.CreationDate, Valid: true},
-			UserCreated:   uuid.NullUUID{UUID: uid, Valid: true},
-			UserModerated: uuid.NullUUID{UUID: curUser.ID, Valid: true},
-			AuthorName:    authorName,
-		}
-
-		// File it under the appropriate parent ID
-		if l, ok := commentParentIDMap[pzID]; ok {
-			commentParentIDMap[pzID] = append(l, c)
-		} else {
-			commentParentIDMap[pzID] = []*data.Comment{c}
-		}
+			// Extract the path from thread URL
+			if u, err := util.ParseAbsoluteURL(thread.URL, true, false); err != nil {
+				return err
+			} else {
+				threads[thread.Id] = &importRecord{PagePath: u.Path, PageTitle: thread.Title}
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		logger.Errorf("disqusImport: failed to read threads: %v", err)
+		return err
 	}
 
-	// Total number of pages involved
-	result.PagesTotal = len(pageIDMap)
-
-	// Recurse the comment tree (map) to insert them in the right order (parents-to-children), starting with the root
-	// (= zero UUID)
-	countsPerPage := map[uuid.UUID]int{}
-	result.CommentsImported, result.CommentsNonDeleted, result.Error = insertCommentsForParent(util.ZeroUUID, commentParentIDMap, countsPerPage)
+	// Stream the posts
+	return disqusRead(run, true, map[string]func(dec *xml.Decoder, se *xml.StartElement) error{
+		"post": func(dec *xml.Decoder, se *xml.StartElement) error {
+			var post disqusPost
+			if err := dec.DecodeElement(&post, se); err != nil {
+				return err
+			}
 
-	// Increase comment count on the domain, ignoring errors
-	_ = TheDomainService.IncrementCounts(&domain.ID, result.CommentsNonDeleted, 0)
+			// Find the post's thread
+			thread, ok := threads[post.ThreadId.Id]
+			if !ok {
+				err := fmt.Errorf("failed to map Disqus thread ID (%s) of post %s", post.ThreadId.Id, post.Id)
+				logger.Errorf("disqusImport: %v", err)
+				return err
+			}
 
-	// Increase comment counts on all pages
-	for pageID, pc := range countsPerPage {
-		if pc > 0 {
-			_ = ThePageService.IncrementCounts(&pageID, pc, 0)
-		}
-	}
+			// Skip over deleted and spam posts
+			rec := &importRecord{
+				ID:        post.Id,
+				ParentID:  post.ParentId.Id,
+				PagePath:  thread.PagePath,
+				PageTitle: thread.PageTitle,
+				HTML:      post.Message,
+				Skip:      post.IsDeleted || post.IsSpam,
+				Comment: &data.Comment{
+					IsApproved:    true,
+					CreatedTime:   post.CreationDate,
+					ModeratedTime: sql.NullTime{Time: post.CreationDate, Valid: true},
+					UserModerated: uuid.NullUUID{UUID: run.curUser.ID, Valid: true},
+					AuthorName:    post.Author.Name,
+				},
+			}
 
-	// Done
-	return result
+			// Anonymous posts are only identified by the author name
+			if email := disqusAuthorEmail(&post.Author); email != "" {
+				rec.Author = &importAuthor{
+					Email:       email,
+					Name:        post.Author.Name,
+					Remarks:     "Imported from Disqus",
+					CreatedTime: post.CreationDate,
+				}
+			}
+			return run.add(rec)
+		},
+	})
 }
 
 // disqusAuthorEmail comes up with a (fake) email address for a Disqus Author
@@ -222,58 +221,23 @@ func disqusAuthorEmail(a *disqusAuthor) string {
 	return ""
 }
 
-// disqusMakeUserMap creates users/domain users from the provided Disqus import dump, and returns that as a map {email: userID}
-func disqusMakeUserMap(curUserID, domainID *uuid.UUID, exp disqusXML) (userIDMap map[string]uuid.UUID, usersAdded, domainUsersAdded int, err error) {
-	userIDMap = map[string]uuid.UUID{}
-
-	// Iterate over the posts
-	for _, post := range exp.Posts {
-		// Skip over deleted and spam posts
-		if post.IsDeleted || post.IsSpam {
-			continue
-		}
-
-		// Skip anonymous
-		email := disqusAuthorEmail(&post.Author)
-		if email == "" {
-			continue
-		}
-
-		// Skip authors whose email has already been processed
-		if _, ok := userIDMap[email]; ok {
-			continue
-		}
-
-		// Import the user and domain user
-		var user *data.User
-		var userAdded, domainUserAdded bool
-		if user, userAdded, domainUserAdded, err = importUserByEmail(
-			email,
-			"", // Local auth only
-			post.Author.Name,
-			"", // Website URL isn't available
-			"Imported from Disqus",
-			false, // The email is a fake one
-			false, // No SSO flag support in the export
-			curUserID,
-			domainID,
-			post.CreationDate,
-		); err != nil {
-			return
-		}
-
-		// Increment user counters
-		if userAdded {
-			usersAdded++
-		}
-		if domainUserAdded {
-			domainUsersAdded++
-		}
-
-		// Add the user's email-to-ID mapping
-		userIDMap[email] = user.ID
+// disqusRead reads the Disqus export data, calling the handler registered for each top-level element's name, which the
+// handler must consume. If main is true, the reading progress is tracked as the job's progress
+func disqusRead(run *importRun, main bool, handlers map[string]func(dec *xml.Decoder, se *xml.StartElement) error) error {
+	r, err := run.open(main)
+	if err != nil {
+		return err
 	}
+	defer util.LogError(r.Close, "disqusRead, r.Close()")
 
-	// Succeeded
-	return userIDMap, usersAdded, domainUsersAdded, nil
+	// Skip over elements having no handler, which would otherwise get descended into
+	dec := xml.NewDecoder(r)
+	xmlHandlers := map[string]func(se *xml.StartElement) error{
+		"post":   func(*xml.StartElement) error { return dec.Skip() },
+		"thread": func(*xml.StartElement) error { return dec.Skip() },
+	}
+	for name, h := range handlers {
+		xmlHandlers[name] = func(se *xml.StartElement) error { return h(dec, se) }
+	}
+	return importXMLElements(dec, xmlHandlers)
 }
@@ -0,0 +1,266 @@
+package svc
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/google/uuid"
+	"gitlab.com/comentario/comentario/internal/api/models"
+	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/util"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportWriters maps export formats to functions that write the domain data
+var exportWriters = map[string]func(run *exportRun) error{
+	"comentario": comentarioExport,
+	"csv":        csvExport,
+	"disqus":     disqusExport,
+	"ndjson":     ndjsonExport,
+}
+
+// exportComment is a comment selected for export, along with its page path and its registered author, if any
+type exportComment struct {
+	data.Comment
+	PagePath  string         `db:"page_path"`
+	UserName  sql.NullString `db:"user_name"`
+	UserEmail sql.NullString `db:"user_email"`
+}
+
+// AuthorEmail returns the email of the comment's registered author, or an empty string if the author isn't registered
+func (ec *exportComment) AuthorEmail() string {
+	return util.If(ec.IsAnonymous(), "", ec.UserEmail.String)
+}
+
+// DisplayAuthorName returns the name of the comment's author, registered or not
+func (ec *exportComment) DisplayAuthorName() string {
+	if !ec.IsAnonymous() && ec.UserName.Valid {
+		return ec.UserName.String
+	}
+	return ec.AuthorName
+}
+
+// Status returns the moderation status of the comment: "pending", "approved", or "rejected"
+func (ec *exportComment) Status() string {
+	switch {
+	case ec.IsPending:
+		return "pending"
+	case ec.IsApproved:
+		return "approved"
+	}
+	return "rejected"
+}
+
+// exportRun carries out a domain export, writing the data in a specific format. Comments are read from the database in
+// batches, and commenters, which are only known once all comments have been read, come after them
+type exportRun struct {
+	domain  *data.Domain
+	filter  *ExportFilter
+	w       io.Writer
+	authors map[uuid.UUID]bool // IDs of the authors of exported comments
+}
+
+// commenters returns the commenters to export: all domain users for a full export, otherwise only the authors of
+// exported comments
+func (run *exportRun) commenters() ([]*models.Commenter, error) {
+	um, dus, err := TheUserService.ListByDomain(&run.domain.ID, false, "", "", data.SortAsc, -1)
+	if err != nil {
+		return nil, err
+	}
+	full := run.filter.IsFull()
+	cs := make([]*models.Commenter, 0, len(dus))
+	for _, du := range dus {
+		// Find the related user instance
+		if u, ok := um[du.UserID]; ok && (full || run.authors[du.UserID]) {
+			// Convert the User/DomainUser combo into a commenter
+			cs = append(cs, u.ToCommenter(du.IsCommenter, du.IsModerator))
+		}
+	}
+	return cs, nil
+}
+
+// comments reads the comments matching the filter, oldest first, calling fn for each one. Comments are fetched in
+// batches, paging by creation time and ID, so that no query stays open while the data is being written out
+func (run *exportRun) comments(fn func(ec *exportComment) error) error {
+	q := db.From(goqu.T("cm_comments").As("c")).
+		Select("c.*", goqu.I("p.path").As("page_path"), goqu.I("u.name").As("user_name"), goqu.I("u.email").As("user_email")).
+		// Join comment pages
+		Join(goqu.T("cm_domain_pages").As("p"), goqu.On(goqu.Ex{"p.id": goqu.I("c.page_id")})).
+		// Outer-join comment authors
+		LeftJoin(goqu.T("cm_users").As("u"), goqu.On(goqu.Ex{"u.id": goqu.I("c.user_created")})).
+		// Filter by page domain
+		Where(goqu.Ex{"p.domain_id": &run.domain.ID}).
+		Order(goqu.I("c.ts_created").Asc(), goqu.I("c.id").Asc()).
+		Limit(util.ExportBatchSize)
+	q = run.filter.apply(q)
+
+	var last *exportComment
+	for {
+		// Query the next batch, which starts after the last comment of the previous one
+		bq := q
+		if last != nil {
+			bq = bq.Where(goqu.Or(
+				goqu.I("c.ts_created").Gt(last.CreatedTime),
+				goqu.And(goqu.I("c.ts_created").Eq(last.CreatedTime), goqu.I("c.id").Gt(&last.ID))))
+		}
+		var ecs []*exportComment
+		if err := bq.ScanStructs(&ecs); err != nil {
+			logger.Errorf("exportRun.comments: ScanStructs() failed: %v", err)
+			return err
+		}
+
+		// Iterate the comments
+		for _, ec := range ecs {
+			if ec.UserCreated.Valid {
+				run.authors[ec.UserCreated.UUID] = true
+			}
+			if err := fn(ec); err != nil {
+				return err
+			}
+		}
+
+		// Stop after an incomplete batch
+		if len(ecs) < util.ExportBatchSize {
+			return nil
+		}
+		last = ecs[len(ecs)-1]
+	}
+}
+
+// pages returns the domain pages matching the filter's path prefix
+func (run *exportRun) pages() ([]*data.DomainPage, error) {
+	ps, err := ThePageService.ListByDomain(&run.domain.ID)
+	if err != nil {
+		return nil, err
+	}
+	var res []*data.DomainPage
+	for _, p := range ps {
+		if strings.HasPrefix(p.Path, run.filter.PathPrefix) {
+			res = append(res, p)
+		}
+	}
+	return res, nil
+}
+
+// writeJSONArray writes a JSON array, whose elements fn passes on to add, as a named member of an object that isn't
+// the first one
+func (run *exportRun) writeJSONArray(name string, fn func(add func(v any) error) error) error {
+	if _, err := fmt.Fprintf(run.w, `,%q:[`, name); err != nil {
+		return err
+	}
+	enc := json.NewEncoder(run.w)
+	cnt := 0
+	err := fn(func(v any) error {
+		if cnt > 0 {
+			if _, err := io.WriteString(run.w, ","); err != nil {
+				return err
+			}
+		}
+		cnt++
+		return enc.Encode(v)
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(run.w, "]")
+	return err
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+// CSV export format
+//----------------------------------------------------------------------------------------------------------------------
+
+// csvExport writes the comments as CSV, one per row
+func csvExport(run *exportRun) error {
+	cw := csv.NewWriter(run.w)
+	err := cw.Write([]string{
+		"id", "parent_id", "page_path", "author_name", "author_email", "created", "status", "deleted", "score", "markdown",
+	})
+	if err != nil {
+		return err
+	}
+	err = run.comments(func(ec *exportComment) error {
+		return cw.Write([]string{
+			ec.ID.String(),
+			util.If(ec.IsRoot(), "", ec.ParentID.UUID.String()),
+			ec.PagePath,
+			ec.DisplayAuthorName(),
+			ec.AuthorEmail(),
+			ec.CreatedTime.UTC().Format(time.RFC3339),
+			ec.Status(),
+			strconv.FormatBool(ec.IsDeleted),
+			strconv.Itoa(ec.Score),
+			ec.Markdown,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+// NDJSON export format
+//----------------------------------------------------------------------------------------------------------------------
+
+// ndjsonMeta is the leading record of an NDJSON export
+type ndjsonMeta struct {
+	Version      int        `json:"version"`         // Format version, matching that of the native export
+	Host         string     `json:"host"`            // Host of the exported domain
+	ExportedTime time.Time  `json:"exportedTime"`    // When the export was made
+	Since        *time.Time `json:"since,omitempty"` // Time the export contains changes since, if it's an incremental one
+}
+
+// ndjsonRecord is a line of an NDJSON export
+type ndjsonRecord struct {
+	Type string `json:"type"` // Record type: "meta", "page", "comment", or "commenter"
+	Data any    `json:"data"` // Record data
+}
+
+// ndjsonExport writes the domain data as newline-delimited JSON, one record per line
+func ndjsonExport(run *exportRun) error {
+	enc := json.NewEncoder(run.w)
+	write := func(typ string, v any) error { return enc.Encode(&ndjsonRecord{Type: typ, Data: v}) }
+
+	// Write the metadata
+	meta := &ndjsonMeta{Version: 3, Host: run.domain.Host, ExportedTime: time.Now().UTC(), Since: run.filter.Since}
+	if err := write("meta", meta); err != nil {
+		return err
+	}
+
+	// Write the pages
+	ps, err := run.pages()
+	if err != nil {
+		return err
+	}
+	for _, p := range ps {
+		if err := write("page", p.ToDTO()); err != nil {
+			return err
+		}
+	}
+
+	// Write the comments
+	if err := run.comments(func(ec *exportComment) error {
+		return write("comment", ec.ToDTO(run.domain.IsHTTPS, run.domain.Host, ec.PagePath))
+	}); err != nil {
+		return err
+	}
+
+	// Write the commenters
+	cs, err := run.commenters()
+	if err != nil {
+		return err
+	}
+	for _, c := range cs {
+		if err := write("commenter", c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package svc
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/util"
+	"strings"
+	"time"
+)
+
+type giscusAuthor struct {
+	Login string `json:"login"`
+	URL   string `json:"url"`
+}
+
+type giscusComment struct {
+	ID          string            `json:"id"`
+	Author      *giscusAuthor     `json:"author"`
+	Body        string            `json:"body"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	DeletedAt   *time.Time        `json:"deletedAt"`
+	IsMinimized bool              `json:"isMinimized"`
+	UpvoteCount int               `json:"upvoteCount"`
+	Replies     giscusCommentList `json:"replies"`
+}
+
+type giscusCommentList struct {
+	Nodes []*giscusComment `json:"nodes"`
+}
+
+// giscusDiscussion is a GitHub discussion (giscus) or issue (utterances), whose title is mapped to a page
+type giscusDiscussion struct {
+	Title    string            `json:"title"`
+	Comments giscusCommentList `json:"comments"`
+}
+
+// IsVisible returns whether the comment is neither deleted nor hidden
+func (gc *giscusComment) IsVisible() bool {
+	return gc.DeletedAt == nil && !gc.IsMinimized
+}
+
+func giscusImport(run *importRun) error {
+	r, err := run.open(true)
+	if err != nil {
+		return err
+	}
+	defer util.LogError(r.Close, "giscusImport, r.Close()")
+
+	// Stream the discussions
+	dec := json.NewDecoder(r)
+	cnt := 0
+	err = importJSONArray(dec, func() error {
+		var d giscusDiscussion
+		if err := dec.Decode(&d); err != nil {
+			return err
+		}
+
+		// Iterate the discussion's comments and their replies
+		for _, gc := range d.Comments.Nodes {
+			cnt++
+			if err := giscusAdd(run, &d, gc, ""); err != nil {
+				return err
+			}
+			for _, reply := range gc.Replies.Nodes {
+				cnt++
+				if err := giscusAdd(run, &d, reply, gc.ID); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Errorf("giscusImport: failed to read data: %v", err)
+		return err
+	}
+
+	// Make sure there was anything at all
+	if cnt == 0 {
+		return errors.New("no comments found in the GitHub export")
+	}
+	return nil
+}
+
+// giscusAdd passes the given GitHub comment on to the import run
+func giscusAdd(run *importRun, d *giscusDiscussion, gc *giscusComment, parentID string) error {
+	// Skip over deleted and hidden comments, as well as those whose discussion doesn't map to a page path
+	path := giscusPagePath(d.Title)
+	rec := &importRecord{
+		ID:       gc.ID,
+		ParentID: parentID,
+		PagePath: path,
+		Markdown: gc.Body,
+		Skip:     !gc.IsVisible() || path == "",
+		Comment: &data.Comment{
+			Score:         gc.UpvoteCount,
+			IsApproved:    true,
+			CreatedTime:   gc.CreatedAt,
+			ModeratedTime: sql.NullTime{Time: gc.CreatedAt, Valid: true},
+			UserModerated: uuid.NullUUID{UUID: run.curUser.ID, Valid: true},
+		},
+	}
+
+	// Authors of deleted GitHub accounts remain anonymous
+	if gc.Author != nil {
+		rec.Comment.AuthorName = gc.Author.Login
+		if email := giscusAuthorEmail(gc.Author); email != "" {
+			rec.Author = &importAuthor{
+				Email:       email,
+				Name:        gc.Author.Login,
+				WebsiteURL:  gc.Author.URL,
+				Remarks:     "Imported from GitHub",
+				CreatedTime: gc.CreatedAt,
+			}
+		}
+	}
+	return run.add(rec)
+}
+
+// giscusAuthorEmail comes up with a (fake) email address for a GitHub user
+func giscusAuthorEmail(a *giscusAuthor) string {
+	if s := strings.TrimSpace(a.Login); s != "" {
+		return fmt.Sprintf("%s@github-user", s)
+	}
+	return ""
+}
+
+// giscusPagePath returns the page path for the given discussion title, which is either a path ("pathname" mapping) or
+// an absolute URL ("url" mapping). Returns an empty string if the title can't be mapped to a path
+func giscusPagePath(title string) string {
+	s := strings.TrimSpace(title)
+	if strings.HasPrefix(s, "/") {
+		return s
+	}
+	if u, err := util.ParseAbsoluteURL(s, true, false); err == nil {
+		return util.If(u.Path == "", "/", u.Path)
+	}
+	return ""
+}
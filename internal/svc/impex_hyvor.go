@@ -0,0 +1,134 @@
+package svc
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/util"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type hyvorPage struct {
+	ID    int64  `json:"id"`
+	URL   string `json:"url"`
+	Title string `json:"title"`
+}
+
+type hyvorUser struct {
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Website string `json:"website"`
+}
+
+type hyvorComment struct {
+	ID        int64      `json:"id"`
+	PageID    int64      `json:"page_id"`
+	ParentID  *int64     `json:"parent_id"`
+	Body      string     `json:"body"`
+	CreatedAt int64      `json:"created_at"`
+	Status    string     `json:"status"`
+	Upvotes   int        `json:"upvotes"`
+	Downvotes int        `json:"downvotes"`
+	User      *hyvorUser `json:"user"`
+	Name      string     `json:"name"` // Name of a guest commenter
+}
+
+// CreatedTime returns the comment's creation time
+func (hc *hyvorComment) CreatedTime() time.Time {
+	return time.Unix(hc.CreatedAt, 0).UTC()
+}
+
+// IsPublished returns whether the comment has been published
+func (hc *hyvorComment) IsPublished() bool {
+	return hc.Status == "published"
+}
+
+func hyvorImport(run *importRun) error {
+	// Read the pages, mapping Hyvor page IDs to page paths and titles
+	pages := map[int64]*importRecord{}
+	err := importJSONArrays(run, false, map[string]func(dec *json.Decoder) error{
+		"pages": func(dec *json.Decoder) error {
+			var page hyvorPage
+			if err := dec.Decode(&page); err != nil {
+				return err
+			}
+
+			// Extract the path from page URL
+			if u, err := util.ParseAbsoluteURL(page.URL, true, false); err != nil {
+				return err
+			} else {
+				pages[page.ID] = &importRecord{PagePath: u.Path, PageTitle: page.Title}
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		logger.Errorf("hyvorImport: failed to read pages: %v", err)
+		return err
+	}
+
+	// Make sure there are pages
+	if len(pages) == 0 {
+		return errors.New("no pages found in the Hyvor Talk export")
+	}
+
+	// Stream the comments
+	return importJSONArrays(run, true, map[string]func(dec *json.Decoder) error{
+		"comments": func(dec *json.Decoder) error {
+			var hc hyvorComment
+			if err := dec.Decode(&hc); err != nil {
+				return err
+			}
+
+			// Find the comment's page (it must exist)
+			page, ok := pages[hc.PageID]
+			if !ok {
+				err := fmt.Errorf("failed to map Hyvor Talk page ID (%d) of comment %d", hc.PageID, hc.ID)
+				logger.Errorf("hyvorImport: %v", err)
+				return err
+			}
+
+			// Only keep published comments
+			t := hc.CreatedTime()
+			rec := &importRecord{
+				ID:        strconv.FormatInt(hc.ID, 10),
+				PagePath:  page.PagePath,
+				PageTitle: page.PageTitle,
+				HTML:      hc.Body,
+				Skip:      !hc.IsPublished(),
+				Comment: &data.Comment{
+					Score:         hc.Upvotes - hc.Downvotes,
+					IsApproved:    true,
+					CreatedTime:   t,
+					ModeratedTime: sql.NullTime{Time: t, Valid: true},
+					UserModerated: uuid.NullUUID{UUID: run.curUser.ID, Valid: true},
+					AuthorName:    hc.Name,
+				},
+			}
+			if hc.ParentID != nil {
+				rec.ParentID = strconv.FormatInt(*hc.ParentID, 10)
+			}
+
+			// Guests and users without email remain anonymous
+			if hc.User != nil {
+				rec.Comment.AuthorName = hc.User.Name
+				if email := strings.TrimSpace(hc.User.Email); email != "" {
+					rec.Author = &importAuthor{
+						Email:       email,
+						Name:        hc.User.Name,
+						WebsiteURL:  hc.User.Website,
+						Remarks:     "Imported from Hyvor Talk",
+						RealEmail:   true,
+						CreatedTime: t,
+					}
+				}
+			}
+			return run.add(rec)
+		},
+	})
+}
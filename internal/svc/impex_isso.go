@@ -0,0 +1,222 @@
+package svc
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/google/uuid"
+	"gitlab.com/comentario/comentario/internal/config"
+	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/util"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// issoSQLiteHeader is the header every SQLite database file starts with
+var issoSQLiteHeader = []byte("SQLite format 3\x00")
+
+// Isso comment modes
+const (
+	issoModePending = 2
+	issoModeDeleted = 4
+)
+
+type issoThread struct {
+	ID    int64          `db:"id"`
+	URI   string         `db:"uri"`
+	Title sql.NullString `db:"title"`
+}
+
+type issoComment struct {
+	ID       int64           `db:"id"`
+	ThreadID int64           `db:"tid"`
+	ParentID sql.NullInt64   `db:"parent"`
+	Created  float64         `db:"created"`
+	Modified sql.NullFloat64 `db:"modified"`
+	Mode     int             `db:"mode"`
+	Text     sql.NullString  `db:"text"`
+	Author   sql.NullString  `db:"author"`
+	Email    sql.NullString  `db:"email"`
+	Website  sql.NullString  `db:"website"`
+	Likes    int             `db:"likes"`
+	Dislikes int             `db:"dislikes"`
+}
+
+// CreatedTime returns the comment's creation time
+func (ic *issoComment) CreatedTime() time.Time {
+	return issoTime(ic.Created)
+}
+
+// ModifiedTime returns the comment's last modification time, which for a deleted comment is its deletion time, falling
+// back to the creation time
+func (ic *issoComment) ModifiedTime() time.Time {
+	if ic.Modified.Valid {
+		return issoTime(ic.Modified.Float64)
+	}
+	return ic.CreatedTime()
+}
+
+// issoTime converts an Isso timestamp, in seconds since the epoch, into time
+func issoTime(f float64) time.Time {
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC()
+}
+
+func issoImport(run *importRun) error {
+	// Get hold of the database file
+	fileName, cleanup, err := issoDBFile(run)
+	if err != nil {
+		logger.Errorf("issoImport: issoDBFile() failed: %v", err)
+		return err
+	}
+	defer cleanup()
+
+	// Open the database in the read-only mode
+	sqlDB, err := sql.Open("sqlite3", "file:"+fileName+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer util.LogError(sqlDB.Close, "issoImport, sqlDB.Close()")
+	idb := goqu.New("sqlite3", sqlDB)
+
+	// Fetch the threads
+	var threads []*issoThread
+	if err := idb.From("threads").ScanStructs(&threads); err != nil {
+		logger.Errorf("issoImport: ScanStructs() failed: %v", err)
+		return err
+	}
+	threadMap := make(map[int64]*issoThread, len(threads))
+	for _, t := range threads {
+		threadMap[t.ID] = t
+	}
+
+	// Count the comments to be able to report progress
+	total, err := idb.From("comments").Count()
+	if err != nil {
+		logger.Errorf("issoImport: Count() failed: %v", err)
+		return err
+	}
+
+	// Stream the comments
+	sc, err := idb.From("comments").Select(&issoComment{}).Order(goqu.I("id").Asc()).Executor().Scanner()
+	if err != nil {
+		logger.Errorf("issoImport: Scanner() failed: %v", err)
+		return err
+	}
+	defer util.LogError(sc.Close, "issoImport, sc.Close()")
+	var i int64
+	for sc.Next() {
+		var ic issoComment
+		if err := sc.ScanStruct(&ic); err != nil {
+			logger.Errorf("issoImport: ScanStruct() failed: %v", err)
+			return err
+		}
+		i++
+		run.job.BytesRead = run.job.FileSize * i / total
+
+		// Skip over comments whose thread is unknown
+		thread, ok := threadMap[ic.ThreadID]
+		t := ic.CreatedTime()
+		rec := &importRecord{
+			ID:       strconv.FormatInt(ic.ID, 10),
+			Markdown: ic.Text.String,
+			Skip:     !ok,
+			Comment: &data.Comment{
+				Score:       ic.Likes - ic.Dislikes,
+				CreatedTime: t,
+				AuthorName:  ic.Author.String,
+			},
+		}
+		if ok {
+			rec.PagePath = thread.URI
+			rec.PageTitle = thread.Title.String
+		}
+		if ic.ParentID.Valid {
+			rec.ParentID = strconv.FormatInt(ic.ParentID.Int64, 10)
+		}
+
+		// Comments awaiting moderation in Isso remain pending
+		if ic.Mode == issoModePending {
+			rec.Comment.IsPending = true
+			rec.Comment.PendingReason = "Imported from Isso"
+		} else {
+			rec.Comment.IsApproved = true
+			rec.Comment.ModeratedTime = sql.NullTime{Time: t, Valid: true}
+			rec.Comment.UserModerated = uuid.NullUUID{UUID: run.curUser.ID, Valid: true}
+		}
+
+		// Deleted comments are imported without their text, so that their replies remain in place
+		if ic.Mode == issoModeDeleted {
+			rec.Markdown = ""
+			rec.Comment.IsDeleted = true
+			rec.Comment.DeletedTime = sql.NullTime{Time: ic.ModifiedTime(), Valid: true}
+			rec.Comment.UserDeleted = uuid.NullUUID{UUID: run.curUser.ID, Valid: true}
+		}
+
+		// Users without name or email remain anonymous
+		if email := strings.TrimSpace(ic.Email.String); email != "" && ic.Author.String != "" {
+			rec.Author = &importAuthor{
+				Email:       email,
+				Name:        ic.Author.String,
+				WebsiteURL:  ic.Website.String,
+				Remarks:     "Imported from Isso",
+				RealEmail:   true,
+				CreatedTime: t,
+			}
+		}
+		if err := run.add(rec); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// issoDBFile returns the name of the Isso SQLite database file for the import run, along with a function cleaning it
+// up. A compressed database is decompressed into a temporary file, because SQLite can only open a file
+func issoDBFile(run *importRun) (string, func(), error) {
+	r, err := run.open(true)
+	if err != nil {
+		return "", nil, err
+	}
+	defer util.LogError(r.Close, "issoDBFile, r.Close()")
+
+	// Make sure it's an SQLite database
+	head := make([]byte, len(issoSQLiteHeader))
+	if _, err := io.ReadFull(r, head); err != nil || !bytes.Equal(head, issoSQLiteHeader) {
+		return "", nil, errors.New("data isn't an SQLite database")
+	}
+
+	// Progress is reported by the number of processed comments
+	run.progress = nil
+
+	// Use the data file as is if it isn't compressed
+	if !run.compressed {
+		return run.job.FileName, func() {}, nil
+	}
+
+	// Decompress the data into a temporary file
+	f, err := os.CreateTemp(config.ServerConfig.ImportPath, "isso-*.db")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() {
+		util.LogError(func() error { return os.Remove(f.Name()) }, "issoDBFile, os.Remove()")
+	}
+	if _, err = f.Write(head); err == nil {
+		_, err = io.Copy(f, r)
+	}
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to decompress Isso database: %w", err)
+	}
+	return f.Name(), cleanup, nil
+}
@@ -0,0 +1,868 @@
+package svc
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	md "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/google/uuid"
+	"gitlab.com/comentario/comentario/extend/plugin"
+	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/util"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"time"
+)
+
+// errImportCancelled is returned when an import job has been cancelled
+var errImportCancelled = errors.New("import has been cancelled")
+
+// reImportHTMLTags matches HTML tags, which are stripped from comment text that can't be converted into Markdown
+var reImportHTMLTags = regexp.MustCompile(`<[^>]+>`)
+
+// importReaders maps import sources to functions that read the data and pass its comments on to the import run
+var importReaders = map[string]func(run *importRun) error{
+	"comentario": comentarioImport,
+	"disqus":     disqusImport,
+	"giscus":     giscusImport,
+	"hyvor":      hyvorImport,
+	"isso":       issoImport,
+	"remark42":   remark42Import,
+	"wordpress":  wordpressImport,
+}
+
+// importAuthor describes a registered author of an imported comment
+type importAuthor struct {
+	Email          string    // Author's email, which identifies the user
+	FederatedIdpID string    // ID of the federated identity provider, if any
+	Name           string    // Author's name
+	WebsiteURL     string    // Author's website URL
+	Remarks        string    // Remarks stored with a newly created user
+	RealEmail      bool      // Whether the email is a real one (as opposed to made-up)
+	FederatedSSO   bool      // Whether the user authenticates via SSO
+	CreatedTime    time.Time // Creation time of a newly created user
+}
+
+// importRecord is a comment read from the source data
+type importRecord struct {
+	ID        string        // Comment ID in the source data
+	ParentID  string        // Parent comment ID in the source data, empty for a root comment
+	PagePath  string        // Path of the comment's page
+	PageTitle string        // Title of the comment's page
+	Author    *importAuthor // Registered author of the comment. If nil, the comment's UserCreated is used, defaulting to anonymous
+	Markdown  string        // Comment text in Markdown
+	HTML      string        // Comment text in HTML, only used if there's no Markdown
+	Comment   *data.Comment // Comment properties. If neither Markdown nor HTML is given, its text is used as is
+	Skip      bool          // Whether the comment is to be skipped, along with its replies
+}
+
+// importItem is a comment awaiting insertion into the database
+type importItem struct {
+	index       int           // Index of the source record
+	srcID       string        // Comment ID in the source data
+	srcParentID string        // Parent comment ID in the source data
+	comment     *data.Comment // The comment to insert
+}
+
+// importProgressReader is a reader tracking the number of bytes read through it
+type importProgressReader struct {
+	r io.Reader
+	n int64
+}
+
+func (pr *importProgressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	pr.n += int64(n)
+	return n, err
+}
+
+// importReadCloser combines a reader with a function closing it and any underlying readers
+type importReadCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (rc *importReadCloser) Close() error {
+	return rc.close()
+}
+
+// importRun carries out an import job. The source reader passes every comment in the data on to add() as a record, in
+// the order of appearance. Comments are inserted into the database in batches, each in a single transaction that also
+// persists the job's progress: the number of leading records completely processed. When resuming an interrupted job,
+// these records aren't inserted again, which prevents duplicates: they're only checked for duplicating existing comments,
+// for their replies to be attached to the latter. For extra safety, comment IDs are derived from the source IDs, and
+// comments whose ID already exists are skipped.
+//
+// Since comments must be inserted after their parents, a reply appearing before its parent is held back until the
+// parent shows up. Replies to skipped comments are skipped, too.
+//
+// Comments on pages that existed before the import are also checked against the pages' existing comments: a comment
+// with the same author, creation time, and text is skipped as a duplicate, and its replies are attached to the existing
+// comment instead.
+//
+// In a dry run, the same processing takes place, but neither users, pages, nor comments are written: the run only
+// reports what would have been done.
+type importRun struct {
+	ctx        context.Context
+	job        *data.ImportJob
+	curUser    *data.User
+	domain     *data.Domain
+	maxLength  int                               // Max comment text length
+	hmConv     *md.Converter                     // HTML-to-Markdown converter
+	userIDs    map[string]uuid.UUID              // Resolved user IDs by email. Zero ID means the user is counted, but not resolved yet
+	pageIDs    map[string]uuid.UUID              // Resolved page IDs by path. Zero ID means the page is counted, but not resolved yet
+	skipped    map[uuid.UUID]bool                // IDs of skipped comments, whose replies are skipped, too
+	existing   map[uuid.UUID]uuid.UUID           // IDs of comments existing before the import, by content key
+	remapped   map[uuid.UUID]uuid.UUID           // IDs of existing comments, by the ID of the comment duplicating them
+	dryIDs     map[uuid.UUID]bool                // Dry run only: IDs of comments existing or "inserted" so far
+	index      int                               // Index of the last received record (1-based)
+	batch      []*importItem                     // Comments awaiting insertion
+	waiting    map[uuid.UUID][]*importItem       // Comments awaiting insertion of their parent, by parent ID
+	items      []data.ImportReportItem           // Report items
+	itemCounts map[data.ImportReportItemKind]int // Number of report items by kind
+	progress   *importProgressReader             // Reader tracking the progress of the data file, if any
+	total      int64                             // Total size of the data read via progress, if it differs from the file size
+	compressed bool                              // Whether the data file is compressed, as detected by open()
+}
+
+// newImportRun instantiates a new importRun for the given job
+func newImportRun(ctx context.Context, job *data.ImportJob, curUser *data.User, domain *data.Domain) *importRun {
+	return &importRun{
+		ctx:       ctx,
+		job:       job,
+		curUser:   curUser,
+		domain:    domain,
+		maxLength: TheDomainConfigService.GetInt(&domain.ID, data.DomainConfigKeyMaxCommentLength),
+		hmConv:    md.NewConverter("", true, nil),
+		userIDs:   map[string]uuid.UUID{},
+		pageIDs:   map[string]uuid.UUID{},
+		skipped:   map[uuid.UUID]bool{},
+		existing:  map[uuid.UUID]uuid.UUID{},
+		remapped:  map[uuid.UUID]uuid.UUID{},
+		dryIDs:    map[uuid.UUID]bool{},
+		waiting:   map[uuid.UUID][]*importItem{},
+	}
+}
+
+// add processes a comment record read from the source data
+func (run *importRun) add(rec *importRecord) error {
+	run.index++
+	run.job.CommentsTotal++
+
+	// Skip the comment if requested, or if its parent has been skipped
+	id := run.commentID(rec.ID)
+	var parentID uuid.NullUUID
+	if rec.ParentID != "" {
+		parentID = uuid.NullUUID{UUID: run.commentID(rec.ParentID), Valid: true}
+	}
+	if rec.Skip || parentID.Valid && run.skipped[parentID.UUID] {
+		run.skipped[id] = true
+		run.job.CommentsSkipped++
+		return nil
+	}
+
+	// If the record has already been processed by an interrupted run, its author and page have been counted by it
+	resumed := run.index <= run.job.RecordsCommitted
+	if resumed {
+		if rec.Author != nil {
+			if _, ok := run.userIDs[rec.Author.Email]; !ok {
+				run.userIDs[rec.Author.Email] = uuid.Nil
+			}
+		}
+		if _, ok := run.pageIDs[rec.PagePath]; !ok {
+			run.pageIDs[rec.PagePath] = uuid.Nil
+		}
+	}
+
+	// Fill in the comment's IDs and page
+	c := rec.Comment
+	c.ID = id
+	c.ParentID = parentID
+	var err error
+	if c.PageID, err = run.page(rec.PagePath, rec.PageTitle); err != nil {
+		return err
+	}
+
+	// Replace an invalid creation time with the current one
+	if now := time.Now().UTC(); !importValidTime(c.CreatedTime, now) {
+		if !resumed {
+			run.job.InvalidDates++
+			run.report(data.ImportReportItemKindInvalidDate, rec.ID, c.CreatedTime.Format(time.RFC3339))
+		}
+		c.CreatedTime = now
+		if c.ModeratedTime.Valid && !importValidTime(c.ModeratedTime.Time, now) {
+			c.ModeratedTime.Time = now
+		}
+		if rec.Author != nil && !importValidTime(rec.Author.CreatedTime, now) {
+			rec.Author.CreatedTime = now
+		}
+	}
+
+	// Authors with an invalid (real) email remain unregistered
+	if a := rec.Author; a != nil && a.RealEmail && !util.IsValidEmail(a.Email) {
+		if !resumed {
+			run.job.InvalidEmails++
+			run.report(data.ImportReportItemKindInvalidEmail, rec.ID, a.Email)
+		}
+		if c.AuthorName == "" {
+			c.AuthorName = a.Name
+		}
+		rec.Author = nil
+	}
+
+	// Resolve the comment's author
+	if rec.Author != nil {
+		uid, err := run.user(rec.Author)
+		if err != nil {
+			return err
+		}
+		c.UserCreated = uuid.NullUUID{UUID: uid, Valid: true}
+		c.AuthorName = ""
+	} else if !c.UserCreated.Valid {
+		c.UserCreated = uuid.NullUUID{UUID: data.AnonymousUser.ID, Valid: true}
+	}
+
+	// "Reverse-convert" HTML comment text to Markdown
+	markdown := rec.Markdown
+	if markdown == "" && rec.HTML != "" {
+		if markdown, err = run.hmConv.ConvertString(rec.HTML); err != nil {
+			// Just strip all tags on error
+			markdown = reImportHTMLTags.ReplaceAllString(rec.HTML, "")
+		}
+	}
+
+	// Update the comment's markdown and render it into HTML. Truncate comment text to avoid errors
+	if markdown != "" {
+		if err := TheCommentService.SetMarkdown(c, util.TruncateStr(markdown, run.maxLength), &run.domain.ID, nil); err != nil {
+			return err
+		}
+	}
+
+	// Fire a before-create event, letting plugins alter or reject the comment. Plugins aren't involved in a dry run
+	if !run.job.DryRun {
+		origMarkdown, origHTML := c.Markdown, c.HTML
+		if changed, err := handleCommentEvent(&plugin.CommentBeforeCreateEvent{}, c); err != nil {
+			return err
+		} else if changed && c.Markdown != origMarkdown && c.HTML == origHTML {
+			// Only the Markdown has been altered: re-render the HTML
+			if err := TheCommentService.SetMarkdown(c, c.Markdown, &run.domain.ID, nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	// A comment already processed by an interrupted run is only checked for duplicating an existing one, for its replies
+	// to be attached to the latter
+	if resumed {
+		if existingID, ok := run.existing[importContentKey(c)]; ok && existingID != c.ID {
+			run.remapped[c.ID] = existingID
+		}
+		return nil
+	}
+
+	// Queue the comment for insertion, flushing the batch once it's full
+	run.batch = append(run.batch, &importItem{index: run.index, srcID: rec.ID, srcParentID: rec.ParentID, comment: c})
+	if len(run.batch) >= util.ImportBatchSize {
+		return run.flush()
+	}
+	return nil
+}
+
+// commentID returns a comment ID derived from the comment's ID in the source data, which makes it stable across
+// interrupted runs
+func (run *importRun) commentID(srcID string) uuid.UUID {
+	return uuid.NewSHA1(run.domain.ID, []byte(run.job.Source+"\x00"+srcID))
+}
+
+// committed returns the number of leading records completely processed, that is, those preceding the first comment
+// still awaiting its parent
+func (run *importRun) committed() int {
+	n := run.index
+	for _, items := range run.waiting {
+		for _, it := range items {
+			n = min(n, it.index-1)
+		}
+	}
+	return n
+}
+
+// execute runs the import, returning any error occurred. The job's counters are updated as the import progresses
+func (run *importRun) execute() error {
+	// Make sure the source is known
+	read, ok := importReaders[run.job.Source]
+	if !ok {
+		return fmt.Errorf("unknown import source: %q", run.job.Source)
+	}
+
+	// A dry run doesn't write anything, so it always starts over
+	if run.job.DryRun {
+		run.job.ImportResult = data.ImportResult{}
+		run.job.RecordsCommitted = 0
+	}
+
+	// Totals are recalculated by every run, whereas other counters accumulate
+	run.job.CommentsTotal = 0
+	run.job.CommentsSkipped = 0
+
+	// Pick up the report items of an interrupted run
+	run.items = run.job.Items()
+	run.itemCounts = map[data.ImportReportItemKind]int{}
+	for _, item := range run.items {
+		run.itemCounts[item.Kind]++
+	}
+
+	// Read the data
+	if err := read(run); err != nil {
+		return err
+	}
+
+	// Insert the remaining comments
+	return run.finish()
+}
+
+// finish inserts any remaining comments. Comments whose parent doesn't exist in the source data are inserted as root
+// ones
+func (run *importRun) finish() error {
+	for {
+		// Insert the current batch, releasing comments waiting for their parents
+		if err := run.flush(); err != nil {
+			return err
+		}
+
+		// Comments whose parent isn't waiting itself refer to a parent missing from the source data: promote them to
+		// root comments
+		waitingIDs := map[uuid.UUID]bool{}
+		for _, items := range run.waiting {
+			for _, it := range items {
+				waitingIDs[it.comment.ID] = true
+			}
+		}
+		found := false
+		for parentID, items := range run.waiting {
+			if !waitingIDs[parentID] {
+				for _, it := range items {
+					run.job.CommentsOrphaned++
+					run.report(data.ImportReportItemKindCommentOrphaned, it.srcID, it.srcParentID)
+					it.comment.ParentID = uuid.NullUUID{}
+					run.batch = append(run.batch, it)
+				}
+				delete(run.waiting, parentID)
+				found = true
+			}
+		}
+
+		// Once no comments can be promoted, any waiting ones form a parent loop: skip them
+		if !found {
+			for _, items := range run.waiting {
+				run.job.CommentsSkipped += len(items)
+			}
+			run.waiting = map[uuid.UUID][]*importItem{}
+			return run.flush()
+		}
+	}
+}
+
+// flush inserts the current batch of comments in a transaction, along with the job's progress. In a dry run, the
+// comments are only counted
+func (run *importRun) flush() error {
+	// Check for cancellation
+	if run.ctx.Err() != nil {
+		return errImportCancelled
+	}
+
+	// Comments "inserted" by a dry run are only tracked in memory
+	known := map[uuid.UUID]bool{}
+	if run.job.DryRun {
+		known = run.dryIDs
+	}
+
+	// Find out which of the parent comments (and, in a dry run, the comments themselves) already exist in the database
+	var ids []uuid.UUID
+	for _, it := range run.batch {
+		c := it.comment
+		run.remapParent(c)
+		if c.ParentID.Valid && !known[c.ParentID.UUID] {
+			ids = append(ids, c.ParentID.UUID)
+		}
+		if run.job.DryRun {
+			ids = append(ids, c.ID)
+		}
+	}
+	if len(ids) > 0 {
+		var existing []uuid.UUID
+		if err := db.From("cm_comments").Select("id").Where(goqu.Ex{"id": ids}).ScanVals(&existing); err != nil {
+			logger.Errorf("importRun.flush: ScanVals() failed: %v", err)
+			return translateDBErrors(err)
+		}
+		for _, id := range existing {
+			known[id] = true
+		}
+	}
+
+	var inserted []*data.Comment
+	err := db.WithTx(func(tx *goqu.TxDatabase) error {
+		inserted = nil
+		countsPerPage := map[uuid.UUID]int{}
+		countNonDeleted := 0
+		countDuplicate := 0
+
+		// Insert the comments whose parent exists, releasing any replies waiting for them
+		queue := run.batch
+		for len(queue) > 0 {
+			it := queue[0]
+			c := it.comment
+			run.remapParent(c)
+			if c.ParentID.Valid && !known[c.ParentID.UUID] {
+				run.waiting[c.ParentID.UUID] = append(run.waiting[c.ParentID.UUID], it)
+				queue = queue[1:]
+				continue
+			}
+			queue = queue[1:]
+
+			// Skip the comment if it duplicates one existing before the import, whose ID its replies will use instead
+			if existingID, ok := run.existing[importContentKey(c)]; ok && existingID != c.ID {
+				countDuplicate++
+				run.report(data.ImportReportItemKindCommentDuplicate, it.srcID, existingID.String())
+				run.remapped[c.ID] = existingID
+				known[existingID] = true
+
+			} else if added, err := run.insert(tx, c, known); err != nil {
+				return err
+
+			} else if added {
+				inserted = append(inserted, c)
+				if !c.IsDeleted {
+					countNonDeleted++
+					countsPerPage[c.PageID]++
+				}
+
+			} else {
+				// A comment with the same ID already exists, for example, from an earlier import of the same data
+				countDuplicate++
+				run.report(data.ImportReportItemKindCommentDuplicate, it.srcID, c.ID.String())
+			}
+			known[c.ID] = true
+			if items, ok := run.waiting[c.ID]; ok {
+				queue = append(queue, items...)
+				delete(run.waiting, c.ID)
+			}
+		}
+
+		// Increase comment counts on the domain and its pages, unless it's a dry run
+		if countNonDeleted > 0 && !run.job.DryRun {
+			if err := db.ExecOne(tx.Update("cm_domains").Set(goqu.Record{"count_comments": goqu.L("? + ?", goqu.I("count_comments"), countNonDeleted)}).Where(goqu.Ex{"id": &run.domain.ID})); err != nil {
+				logger.Errorf("importRun.flush: ExecOne() failed for domain: %v", err)
+				return err
+			}
+			for pageID, cnt := range countsPerPage {
+				if err := db.ExecOne(tx.Update("cm_domain_pages").Set(goqu.Record{"count_comments": goqu.L("? + ?", goqu.I("count_comments"), cnt)}).Where(goqu.Ex{"id": pageID})); err != nil {
+					logger.Errorf("importRun.flush: ExecOne() failed for page: %v", err)
+					return err
+				}
+			}
+		}
+
+		// Update the job, making sure it hasn't been cancelled or taken over in the meantime
+		job := *run.job
+		job.CommentsImported += len(inserted)
+		job.CommentsNonDeleted += countNonDeleted
+		job.CommentsDuplicate += countDuplicate
+		job.UsersTotal = len(run.userIDs)
+		job.PagesTotal = len(run.pageIDs)
+		job.RecordsCommitted = max(job.RecordsCommitted, run.committed())
+		job.BytesRead = run.bytesRead()
+		job.UpdatedTime = time.Now().UTC()
+		if err := db.ExecOne(tx.Update("cm_import_jobs").Set(&job).Where(goqu.Ex{"id": &job.ID, "status": data.ImportJobStatusRunning, "owner_id": &importOwnerID})); errors.Is(err, sql.ErrNoRows) {
+			return errImportCancelled
+		} else if err != nil {
+			logger.Errorf("importRun.flush: ExecOne() failed for job: %v", err)
+			return err
+		}
+		*run.job = job
+		return nil
+	})
+	if errors.Is(err, errImportCancelled) {
+		return err
+	} else if err != nil {
+		return translateDBErrors(err)
+	}
+	run.batch = nil
+
+	// Fire creation events. The comments are already persisted at this point, so any changes or errors are ignored
+	if !run.job.DryRun {
+		for _, c := range inserted {
+			cc := *c
+			_, _ = handleCommentEvent(&plugin.CommentCreateEvent{}, &cc)
+		}
+	}
+
+	// Succeeded
+	return nil
+}
+
+// insert inserts the given comment in the transaction, unless one with the same ID already exists, returning whether
+// the comment has been added. In a dry run, the comment is only checked against the known comment IDs
+func (run *importRun) insert(tx *goqu.TxDatabase, c *data.Comment, known map[uuid.UUID]bool) (bool, error) {
+	if run.job.DryRun {
+		return !known[c.ID], nil
+	}
+	res, err := tx.Insert("cm_comments").Rows(c).OnConflict(goqu.DoNothing()).Executor().Exec()
+	if err != nil {
+		logger.Errorf("importRun.insert: Exec() failed: %v", err)
+		return false, err
+	}
+	cnt, err := res.RowsAffected()
+	if err != nil {
+		logger.Errorf("importRun.insert: RowsAffected() failed: %v", err)
+		return false, err
+	}
+	return cnt > 0, nil
+}
+
+// loadExisting collects the content keys of the comments on the given page, which existed before the import
+func (run *importRun) loadExisting(pageID *uuid.UUID) error {
+	sc, err := db.From("cm_comments").
+		Select("id", "page_id", "user_created", "author_name", "ts_created", "markdown").
+		Where(goqu.Ex{"page_id": pageID}).
+		Executor().Scanner()
+	if err != nil {
+		logger.Errorf("importRun.loadExisting: Scanner() failed: %v", err)
+		return translateDBErrors(err)
+	}
+	defer util.LogError(sc.Close, "importRun.loadExisting, sc.Close()")
+	for sc.Next() {
+		var c data.Comment
+		if err := sc.ScanStruct(&c); err != nil {
+			logger.Errorf("importRun.loadExisting: ScanStruct() failed: %v", err)
+			return translateDBErrors(err)
+		}
+		run.existing[importContentKey(&c)] = c.ID
+	}
+	return translateDBErrors(sc.Err())
+}
+
+// remapParent makes the given comment a reply to the existing comment its parent duplicates, if any
+func (run *importRun) remapParent(c *data.Comment) {
+	if c.ParentID.Valid {
+		if id, ok := run.remapped[c.ParentID.UUID]; ok {
+			c.ParentID.UUID = id
+		}
+	}
+}
+
+// report adds an item to the job's report, unless there already are too many items of the same kind
+func (run *importRun) report(kind data.ImportReportItemKind, ref, details string) {
+	if run.itemCounts[kind] < util.ImportReportMaxItems {
+		run.itemCounts[kind]++
+		run.items = append(run.items, data.ImportReportItem{Kind: kind, Ref: ref, Details: details})
+		run.job.WithItems(run.items)
+	}
+}
+
+// bytesRead returns the number of bytes of the data file processed so far
+func (run *importRun) bytesRead() int64 {
+	switch {
+	case run.progress == nil:
+		return run.job.BytesRead
+	case run.total > 0:
+		// Scale the progress to the file size
+		return int64(float64(run.progress.n) / float64(run.total) * float64(run.job.FileSize))
+	}
+	return run.progress.n
+}
+
+// open opens the data file for reading, transparently decompressing gzip- or zip-compressed data. If main is true,
+// the reading progress is tracked as the job's progress
+func (run *importRun) open(main bool) (io.ReadCloser, error) {
+	f, err := os.Open(run.job.FileName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sniff the content type
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		_ = f.Close()
+		return nil, err
+	} else if _, err := f.Seek(0, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	ctype := http.DetectContentType(head[:n])
+	logger.Debugf("Import data content type: %s", ctype)
+	run.compressed = ctype == "application/x-gzip" || ctype == "application/zip"
+
+	// Track the progress if needed
+	var r io.Reader = f
+	if main {
+		run.progress = &importProgressReader{r: f}
+		r = run.progress
+	}
+
+	switch ctype {
+	case "application/x-gzip":
+		// Gzip-compressed data
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		return &importReadCloser{Reader: gr, close: f.Close}, nil
+
+	case "application/zip":
+		// Zip-compressed data: the archive must contain exactly one file
+		_ = f.Close()
+		zr, err := zip.OpenReader(run.job.FileName)
+		if err != nil {
+			return nil, err
+		}
+		var zf *zip.File
+		for _, f := range zr.File {
+			if !f.FileInfo().IsDir() {
+				if zf != nil {
+					_ = zr.Close()
+					return nil, errors.New("expected exactly one file in zip archive, found many")
+				}
+				zf = f
+			}
+		}
+		if zf == nil {
+			_ = zr.Close()
+			return nil, errors.New("no files in zip archive")
+		}
+		fr, err := zf.Open()
+		if err != nil {
+			_ = zr.Close()
+			return nil, err
+		}
+
+		// Progress is tracked over the uncompressed data
+		r = fr
+		if main {
+			run.progress = &importProgressReader{r: fr}
+			run.total = int64(zf.UncompressedSize64)
+			r = run.progress
+		}
+		return &importReadCloser{Reader: r, close: zr.Close}, nil
+	}
+
+	// Uncompressed data
+	return &importReadCloser{Reader: r, close: f.Close}, nil
+}
+
+// page returns the ID of the domain page with the given path, adding the page if it doesn't exist yet. In a dry run,
+// a missing page is only counted
+func (run *importRun) page(path, title string) (uuid.UUID, error) {
+	// Check if the page has already been resolved
+	id, counted := run.pageIDs[path]
+	if counted && id != uuid.Nil {
+		return id, nil
+	}
+
+	// Find or insert a page with this path
+	var added bool
+	if run.job.DryRun {
+		if page, err := ThePageService.FindByDomainPath(&run.domain.ID, path); errors.Is(err, ErrNotFound) {
+			id, added = uuid.New(), true
+		} else if err != nil {
+			return uuid.Nil, err
+		} else {
+			id = page.ID
+		}
+	} else if page, ok, err := ThePageService.UpsertByDomainPath(run.domain, path, title, nil); err != nil {
+		return uuid.Nil, err
+	} else {
+		id, added = page.ID, ok
+	}
+	run.pageIDs[path] = id
+
+	// If the page was added, increment the page count, unless it's been counted by an interrupted run. Otherwise,
+	// collect its comments to detect duplicates
+	if !added {
+		if err := run.loadExisting(&id); err != nil {
+			return uuid.Nil, err
+		}
+	} else if !counted {
+		run.job.PagesAdded++
+		run.report(data.ImportReportItemKindPageAdded, path, title)
+	}
+	return id, nil
+}
+
+// user returns the ID of the user with the given author's email, adding the user and domain user if they don't exist
+// yet. In a dry run, missing users and domain users are only counted
+func (run *importRun) user(a *importAuthor) (uuid.UUID, error) {
+	// Check if the user has already been resolved
+	id, counted := run.userIDs[a.Email]
+	if counted && id != uuid.Nil {
+		return id, nil
+	}
+
+	// Import the user and domain user
+	var user *data.User
+	var userAdded, domainUserAdded bool
+	var err error
+	if run.job.DryRun {
+		user, userAdded, domainUserAdded, err = importFindUserByEmail(a.Email, &run.domain.ID)
+	} else {
+		user, userAdded, domainUserAdded, err = importUserByEmail(
+			a.Email,
+			a.FederatedIdpID,
+			a.Name,
+			a.WebsiteURL,
+			a.Remarks,
+			a.RealEmail,
+			a.FederatedSSO,
+			&run.curUser.ID,
+			&run.domain.ID,
+			a.CreatedTime)
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+	run.userIDs[a.Email] = user.ID
+
+	// Increment user counters, unless the user has been counted by an interrupted run
+	if counted {
+		return user.ID, nil
+	}
+	if userAdded {
+		run.job.UsersAdded++
+		run.report(data.ImportReportItemKindUserAdded, a.Email, a.Name)
+	} else {
+		run.job.UsersMatched++
+		run.report(data.ImportReportItemKindUserMatched, a.Email, user.Name)
+	}
+	if domainUserAdded {
+		run.job.DomainUsersAdded++
+	}
+	return user.ID, nil
+}
+
+// importContentKey returns a key identifying the given comment by its page, author, creation time (to the second), and
+// text, which is used to detect duplicates of existing comments
+func importContentKey(c *data.Comment) uuid.UUID {
+	return uuid.NewSHA1(c.PageID, []byte(fmt.Sprintf("%s\x00%s\x00%d\x00%s", c.UserCreated.UUID, c.AuthorName, c.CreatedTime.Unix(), c.Markdown)))
+}
+
+// importValidTime returns whether the given time is valid for an imported comment, that is, it's after the Unix epoch,
+// and not in the future (allowing for a day of clock skew and time zone confusion)
+func importValidTime(t, now time.Time) bool {
+	return t.Unix() > 0 && t.Before(now.Add(24*time.Hour))
+}
+
+// importJSONArray reads a JSON array from the decoder, calling fn for each element, which fn must consume. A null
+// value is treated as an empty array
+func importJSONArray(dec *json.Decoder, fn func() error) error {
+	if t, err := dec.Token(); err != nil {
+		return err
+	} else if t == nil {
+		return nil
+	} else if t != json.Delim('[') {
+		return fmt.Errorf("JSON array expected, got %v", t)
+	}
+	for dec.More() {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	_, err := dec.Token()
+	return err
+}
+
+// importJSONArrays reads the data file as a JSON object, calling the handler registered for an array key for each of
+// the array's elements, which the handler must consume. If main is true, the reading progress is tracked as the job's
+// progress
+func importJSONArrays(run *importRun, main bool, handlers map[string]func(dec *json.Decoder) error) error {
+	r, err := run.open(main)
+	if err != nil {
+		return err
+	}
+	defer util.LogError(r.Close, "importJSONArrays, r.Close()")
+
+	// Wrap every element handler into an array handler
+	dec := json.NewDecoder(r)
+	arrHandlers := make(map[string]func() error, len(handlers))
+	for key, h := range handlers {
+		arrHandlers[key] = func() error {
+			return importJSONArray(dec, func() error { return h(dec) })
+		}
+	}
+	return importJSONObject(dec, arrHandlers)
+}
+
+// importJSONObject reads a JSON object from the decoder, calling the handler registered for each key, which must
+// consume the key's value. Values of other keys are skipped
+func importJSONObject(dec *json.Decoder, handlers map[string]func() error) error {
+	if t, err := dec.Token(); err != nil {
+		return err
+	} else if t != json.Delim('{') {
+		return fmt.Errorf("JSON object expected, got %v", t)
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if h, ok := handlers[t.(string)]; ok {
+			err = h()
+		} else {
+			err = importJSONSkip(dec)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := dec.Token()
+	return err
+}
+
+// importJSONSkip skips the next JSON value in the decoder token by token, which keeps memory use low for large values
+func importJSONSkip(dec *json.Decoder) error {
+	depth := 0
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if d, ok := t.(json.Delim); ok {
+			if d == '[' || d == '{' {
+				depth++
+			} else {
+				depth--
+			}
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// importXMLElements reads XML from the decoder, calling the handler registered for each element's local name. Elements
+// not consumed by a handler are descended into
+func importXMLElements(dec *xml.Decoder, handlers map[string]func(se *xml.StartElement) error) error {
+	for {
+		t, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if se, ok := t.(xml.StartElement); ok {
+			if h, ok := handlers[se.Name.Local]; ok {
+				if err := h(&se); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
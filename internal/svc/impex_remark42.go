@@ -0,0 +1,127 @@
+package svc
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/util"
+	"io"
+	"strings"
+	"time"
+)
+
+type remark42User struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type remark42Locator struct {
+	URL string `json:"url"`
+}
+
+type remark42Comment struct {
+	ID        string          `json:"id"`
+	ParentID  string          `json:"pid"`
+	Text      string          `json:"text"`
+	Orig      string          `json:"orig"`
+	User      remark42User    `json:"user"`
+	Locator   remark42Locator `json:"locator"`
+	Score     int             `json:"score"`
+	Timestamp time.Time       `json:"time"`
+	Pin       bool            `json:"pin"`
+	Deleted   bool            `json:"delete"`
+	PostTitle string          `json:"title"`
+}
+
+func remark42Import(run *importRun) error {
+	r, err := run.open(true)
+	if err != nil {
+		return err
+	}
+	defer util.LogError(r.Close, "remark42Import, r.Close()")
+
+	// Stream the records
+	if err := remark42Parse(r, func(rc *remark42Comment) error {
+		// Extract the path from the locator URL
+		u, err := util.ParseAbsoluteURL(rc.Locator.URL, true, false)
+		if err != nil {
+			return err
+		}
+
+		// Prefer the original comment text, and fall back to "reverse-converting" the rendered HTML to Markdown
+		rec := &importRecord{
+			ID:        rc.ID,
+			ParentID:  rc.ParentID,
+			PagePath:  u.Path,
+			PageTitle: rc.PostTitle,
+			Markdown:  rc.Orig,
+			HTML:      rc.Text,
+			Skip:      rc.Deleted,
+			Comment: &data.Comment{
+				Score:         rc.Score,
+				IsSticky:      rc.Pin,
+				IsApproved:    true,
+				CreatedTime:   rc.Timestamp,
+				ModeratedTime: sql.NullTime{Time: rc.Timestamp, Valid: true},
+				UserModerated: uuid.NullUUID{UUID: run.curUser.ID, Valid: true},
+				AuthorName:    rc.User.Name,
+			},
+		}
+
+		// Anonymous comments are only identified by the author name
+		if email := remark42UserEmail(&rc.User); email != "" {
+			rec.Author = &importAuthor{
+				Email:       email,
+				Name:        rc.User.Name,
+				Remarks:     "Imported from Remark42",
+				CreatedTime: rc.Timestamp,
+			}
+		}
+		return run.add(rec)
+	}); err != nil {
+		logger.Errorf("remark42Import: remark42Parse() failed: %v", err)
+		return err
+	}
+	return nil
+}
+
+// remark42Parse parses the Remark42 backup read from r, which is a stream of JSON records, one per line, calling fn
+// for every comment. Records other than comments (such as the leading metadata record) are skipped
+func remark42Parse(r io.Reader, fn func(rc *remark42Comment) error) error {
+	dec := json.NewDecoder(r)
+	cnt := 0
+	for {
+		rc := &remark42Comment{}
+		if err := dec.Decode(rc); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		// Only process comment records
+		if rc.ID != "" && rc.Locator.URL != "" {
+			cnt++
+			if err := fn(rc); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Make sure there was anything at all
+	if cnt == 0 {
+		return errors.New("no comments found in the Remark42 backup")
+	}
+	return nil
+}
+
+// remark42UserEmail comes up with a (fake) email address for a Remark42 user, based on their ID (which includes the
+// auth provider prefix, such as "github_"). Returns an empty string for anonymous users
+func remark42UserEmail(u *remark42User) string {
+	if s := strings.TrimSpace(u.ID); s != "" && !strings.HasPrefix(s, "anonymous_") {
+		return fmt.Sprintf("%s@remark42-user", s)
+	}
+	return ""
+}
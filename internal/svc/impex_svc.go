@@ -1,125 +1,418 @@
 package svc
 
 import (
+	"compress/gzip"
+	"context"
+	"database/sql"
 	"errors"
+	"fmt"
+	"github.com/doug-martin/goqu/v9"
 	"github.com/google/uuid"
-	"gitlab.com/comentario/comentario/internal/api/models"
+	"gitlab.com/comentario/comentario/internal/config"
 	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/util"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
 	"time"
+	"unicode/utf8"
 )
 
-// ImportResult is the result of a comment import
-type ImportResult struct {
-	UsersTotal         int   // Total number of users
-	UsersAdded         int   // Number of added users
-	DomainUsersAdded   int   // Number of added domain users
-	PagesTotal         int   // Total number of domain pages
-	PagesAdded         int   // Number of added domain pages
-	CommentsTotal      int   // Total number of comments processed
-	CommentsImported   int   // Number of imported comments
-	CommentsSkipped    int   // Number of skipped comments
-	CommentsNonDeleted int   // Number of non-deleted imported comments
-	Error              error // Any error occurred during the import
-}
-
-// ToDTO converts the result to an API model
-func (ir *ImportResult) ToDTO() *models.ImportResult {
-	dto := &models.ImportResult{
-		CommentsImported:   uint64(ir.CommentsImported),
-		CommentsNonDeleted: uint64(ir.CommentsNonDeleted),
-		CommentsSkipped:    uint64(ir.CommentsSkipped),
-		CommentsTotal:      uint64(ir.CommentsTotal),
-		DomainUsersAdded:   uint64(ir.DomainUsersAdded),
-		PagesAdded:         uint64(ir.PagesAdded),
-		PagesTotal:         uint64(ir.PagesTotal),
-		UsersAdded:         uint64(ir.UsersAdded),
-		UsersTotal:         uint64(ir.UsersTotal),
-	}
-	if ir.Error != nil {
-		dto.Error = ir.Error.Error()
-	}
-	return dto
-}
-
-// WithError sets the error in the result and returns the result
-func (ir *ImportResult) WithError(err error) *ImportResult {
-	ir.Error = err
-	return ir
-}
-
-//----------------------------------------------------------------------------------------------------------------------
+// importOwnerID identifies this server instance as the owner of the import jobs it runs
+var importOwnerID = uuid.New()
 
 // TheImportExportService is a global ImportExportService implementation
-var TheImportExportService ImportExportService = &importExportService{}
+var TheImportExportService ImportExportService = &importExportService{cancels: map[uuid.UUID]context.CancelFunc{}}
 
 // ImportExportService is a service interface for dealing with data import/export
 type ImportExportService interface {
-	// Export exports the data for the specified domain, returning gzip-compressed binary data
-	Export(domainID *uuid.UUID) ([]byte, error)
-	// Import performs data import in the native Comentario (or legacy Commento v1/Comentario v2) format from the
-	// provided data. Returns the number of imported comments: total and non-deleted
-	Import(curUser *data.User, domain *data.Domain, buf []byte) *ImportResult
-	// ImportDisqus performs data import in Disqus format from the provided data. Returns the number of imported
-	// comments
-	ImportDisqus(curUser *data.User, domain *data.Domain, buf []byte) *ImportResult
-	// ImportWordPress performs data import in WordPress format from the provided data. Returns the number of imported
-	// comments
-	ImportWordPress(curUser *data.User, domain *data.Domain, buf []byte) *ImportResult
+	// CancelImport cancels the given running import job. Comments imported so far are kept
+	CancelImport(job *data.ImportJob) error
+	// Export writes the data of the given domain matching the filter to w, compressed with gzip. format is one of
+	// "comentario" (native Comentario JSON), "ndjson" (newline-delimited JSON), "csv" (comments only), or "disqus"
+	// (Disqus-compatible XML)
+	Export(domain *data.Domain, format string, filter *ExportFilter, w io.Writer) error
+	// FindImportJob finds and returns an import job by the domain ID and job ID
+	FindImportJob(domainID, id *uuid.UUID) (*data.ImportJob, error)
+	// ListImportJobs returns a list of import jobs of the given domain, most recent first
+	ListImportJobs(domainID *uuid.UUID) ([]*data.ImportJob, error)
+	// Run starts resuming import jobs that were interrupted, for example, by a server restart. A job is only taken over
+	// once the lease of the instance that ran it has expired
+	Run() error
+	// StartImport stores the data read from r and starts importing it into the given domain in the background. source
+	// is the format of the data: "comentario" (native Comentario, or legacy Commento v1/Comentario v2), "disqus",
+	// "giscus", "hyvor", "isso", "remark42", or "wordpress". If dryRun is true, the job only reports what would be
+	// imported, without writing anything
+	StartImport(curUser *data.User, domain *data.Domain, source string, dryRun bool, r io.Reader) (*data.ImportJob, error)
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+
+// ExportFilter narrows down the data to export. Pages are only filtered by the path prefix
+type ExportFilter struct {
+	From           *time.Time // Start of the comment creation time range (inclusive)
+	To             *time.Time // End of the comment creation time range (exclusive)
+	Since          *time.Time // Only export comments created, edited, moderated, or deleted at or after this time
+	PathPrefix     string     // Prefix of the path of pages to export
+	ApprovedOnly   bool       // Whether to only export approved comments
+	IncludeDeleted bool       // Whether to export deleted comments
+}
+
+// IsFull returns whether the filter lets all domain data through
+func (f *ExportFilter) IsFull() bool {
+	return f.From == nil && f.To == nil && f.Since == nil && f.PathPrefix == "" && !f.ApprovedOnly && f.IncludeDeleted
+}
+
+// apply narrows down the given query, selecting from the cm_comments table under the alias "c" joined with the
+// cm_domain_pages table under the alias "p", to the comments matching the filter
+func (f *ExportFilter) apply(q *goqu.SelectDataset) *goqu.SelectDataset {
+	if f.From != nil {
+		q = q.Where(goqu.I("c.ts_created").Gte(*f.From))
+	}
+	if f.To != nil {
+		q = q.Where(goqu.I("c.ts_created").Lt(*f.To))
+	}
+	if f.Since != nil {
+		q = q.Where(goqu.Or(
+			goqu.I("c.ts_created").Gte(*f.Since),
+			goqu.I("c.ts_edited").Gte(*f.Since),
+			goqu.I("c.ts_moderated").Gte(*f.Since),
+			goqu.I("c.ts_deleted").Gte(*f.Since)))
+	}
+	if f.PathPrefix != "" {
+		// Compare the leading characters rather than use LIKE, which would treat '%' and '_' as wildcards
+		q = q.Where(goqu.L(`substr("p"."path", 1, ?) = ?`, utf8.RuneCountInString(f.PathPrefix), f.PathPrefix))
+	}
+	if f.ApprovedOnly {
+		q = q.Where(goqu.Ex{"c.is_pending": false, "c.is_approved": true})
+	}
+	if !f.IncludeDeleted {
+		q = q.Where(goqu.Ex{"c.is_deleted": false})
+	}
+	return q
 }
 
 //----------------------------------------------------------------------------------------------------------------------
 
 // importExportService is a blueprint ImportExportService implementation
-type importExportService struct{}
+type importExportService struct {
+	mu      sync.Mutex                       // Mutex for cancels
+	cancels map[uuid.UUID]context.CancelFunc // Cancel functions of jobs running in this process, by job ID
+}
+
+func (svc *importExportService) CancelImport(job *data.ImportJob) error {
+	logger.Debugf("importExportService.CancelImport(%s)", &job.ID)
+
+	// Mark the job cancelled, unless it's already finished
+	job.WithFinished(data.ImportJobStatusCancelled, nil)
+	err := db.ExecOne(
+		db.Update("cm_import_jobs").
+			Set(goqu.Record{"status": job.Status, "ts_updated": job.UpdatedTime, "ts_finished": job.FinishedTime}).
+			Where(goqu.Ex{"id": &job.ID, "status": data.ImportJobStatusRunning}))
+	if err != nil {
+		logger.Errorf("importExportService.CancelImport: ExecOne() failed: %v", err)
+		return translateDBErrors(err)
+	}
+
+	// Stop the job if it's running in this process: it will clean up after itself. Otherwise, remove the data file
+	// right away
+	svc.mu.Lock()
+	cancel, ok := svc.cancels[job.ID]
+	svc.mu.Unlock()
+	if ok {
+		cancel()
+	} else {
+		importRemoveFile(job)
+	}
 
-// importError returns an ImportResult containing only the specified error
-func importError(err error) *ImportResult {
-	return &ImportResult{Error: err}
+	// Succeeded
+	return nil
 }
 
-func (svc *importExportService) Export(domainID *uuid.UUID) ([]byte, error) {
-	logger.Debugf("importExportService.Export(%s)", domainID)
-	return comentarioExport(domainID)
+func (svc *importExportService) Export(domain *data.Domain, format string, filter *ExportFilter, w io.Writer) error {
+	logger.Debugf("importExportService.Export(%s, %q, %#v)", &domain.ID, format, filter)
+
+	// Make sure the format is known
+	write, ok := exportWriters[format]
+	if !ok {
+		return fmt.Errorf("unknown export format: %q", format)
+	}
+
+	// Compress the data as it's being written
+	gw := gzip.NewWriter(w)
+	if err := write(&exportRun{domain: domain, filter: filter, w: gw, authors: map[uuid.UUID]bool{}}); err != nil {
+		logger.Errorf("importExportService.Export: failed to write %s data: %v", format, err)
+		return translateDBErrors(err)
+	}
+	if err := gw.Close(); err != nil {
+		logger.Errorf("importExportService.Export: Close() failed: %v", err)
+		return err
+	}
+
+	// Succeeded
+	return nil
 }
 
-func (svc *importExportService) Import(curUser *data.User, domain *data.Domain, buf []byte) *ImportResult {
-	logger.Debugf("importExportService.Import(%#v, %#v, [%d bytes])", curUser, domain, len(buf))
-	return comentarioImport(curUser, domain, buf)
+func (svc *importExportService) FindImportJob(domainID, id *uuid.UUID) (*data.ImportJob, error) {
+	logger.Debugf("importExportService.FindImportJob(%s, %s)", domainID, id)
+
+	// Query the database
+	var j data.ImportJob
+	if b, err := db.From("cm_import_jobs").Where(goqu.Ex{"id": id, "domain_id": domainID}).ScanStruct(&j); err != nil {
+		logger.Errorf("importExportService.FindImportJob: ScanStruct() failed: %v", err)
+		return nil, translateDBErrors(err)
+	} else if !b {
+		return nil, ErrNotFound
+	}
+
+	// Succeeded
+	return &j, nil
 }
 
-func (svc *importExportService) ImportDisqus(curUser *data.User, domain *data.Domain, buf []byte) *ImportResult {
-	logger.Debugf("importExportService.ImportDisqus(%#v, %#v, [%d bytes])", curUser, domain, len(buf))
-	return disqusImport(curUser, domain, buf)
+func (svc *importExportService) ListImportJobs(domainID *uuid.UUID) ([]*data.ImportJob, error) {
+	logger.Debugf("importExportService.ListImportJobs(%s)", domainID)
+
+	// Query the database
+	var js []*data.ImportJob
+	if err := db.From("cm_import_jobs").Where(goqu.Ex{"domain_id": domainID}).Order(goqu.I("ts_created").Desc()).ScanStructs(&js); err != nil {
+		logger.Errorf("importExportService.ListImportJobs: ScanStructs() failed: %v", err)
+		return nil, translateDBErrors(err)
+	}
+
+	// Succeeded
+	return js, nil
 }
 
-func (svc *importExportService) ImportWordPress(curUser *data.User, domain *data.Domain, buf []byte) *ImportResult {
-	logger.Debugf("importExportService.ImportWordPress(%#v, %#v, [%d bytes])", curUser, domain, len(buf))
-	return wordpressImport(curUser, domain, buf)
+func (svc *importExportService) Run() error {
+	logger.Debug("importExportService: starting import job resumption")
+	go svc.process()
+	return nil
 }
 
-// insertCommentsForParent inserts those comments from the map that have the specified parent ID, returning the number
-// of successfully inserted and non-deleted comments
-func insertCommentsForParent(parentID uuid.UUID, commentParentMap map[uuid.UUID][]*data.Comment, countsPerPage map[uuid.UUID]int) (countImported, countNonDeleted int, err error) {
-	for _, c := range commentParentMap[parentID] {
-		// Insert the comment
-		if err = TheCommentService.Create(c); err != nil {
+func (svc *importExportService) StartImport(curUser *data.User, domain *data.Domain, source string, dryRun bool, r io.Reader) (*data.ImportJob, error) {
+	logger.Debugf("importExportService.StartImport(%s, %s, %q, %v)", &curUser.ID, &domain.ID, source, dryRun)
+
+	// Make sure the data file directory exists
+	if err := os.MkdirAll(config.ServerConfig.ImportPath, 0700); err != nil {
+		logger.Errorf("importExportService.StartImport: MkdirAll() failed: %v", err)
+		return nil, err
+	}
+
+	// Store the data in a file, which allows for resuming the job should it get interrupted
+	job := data.NewImportJob(&domain.ID, &curUser.ID, source).WithDryRun(dryRun)
+	fileName := filepath.Join(config.ServerConfig.ImportPath, job.ID.String())
+	f, err := os.Create(fileName)
+	if err != nil {
+		logger.Errorf("importExportService.StartImport: Create() failed: %v", err)
+		return nil, err
+	}
+	size, err := io.Copy(f, r)
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		logger.Errorf("importExportService.StartImport: failed to store data file: %v", err)
+		util.LogError(func() error { return os.Remove(fileName) }, "importExportService.StartImport, os.Remove()")
+		return nil, err
+	}
+	job.WithFile(fileName, size)
+
+	// Persist the job, owned by this instance
+	job.WithOwner(&importOwnerID)
+	if err := db.ExecOne(db.Insert("cm_import_jobs").Rows(job)); err != nil {
+		logger.Errorf("importExportService.StartImport: ExecOne() failed: %v", err)
+		util.LogError(func() error { return os.Remove(fileName) }, "importExportService.StartImport, os.Remove()")
+		return nil, translateDBErrors(err)
+	}
+
+	// Start the import
+	svc.runJob(job, curUser, domain)
+
+	// Succeeded
+	return job, nil
+}
+
+// heartbeat periodically renews this instance's lease on the given running job until ctx is done. If the job is no
+// longer running or has been taken over by another instance, it calls cancel
+func (svc *importExportService) heartbeat(ctx context.Context, job *data.ImportJob, cancel context.CancelFunc) {
+	t := time.NewTicker(util.ImportJobHeartbeatInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
 			return
+		case <-t.C:
+			err := db.ExecOne(
+				db.Update("cm_import_jobs").
+					Set(goqu.Record{"ts_heartbeat": time.Now().UTC()}).
+					Where(goqu.Ex{"id": &job.ID, "status": data.ImportJobStatusRunning, "owner_id": &importOwnerID}))
+			if errors.Is(err, sql.ErrNoRows) {
+				cancel()
+				return
+			} else if err != nil {
+				logger.Errorf("importExportService.heartbeat: ExecOne() failed: %v", err)
+			}
+		}
+	}
+}
+
+// isTakenOver returns whether the given job is still running, but owned by another server instance
+func (svc *importExportService) isTakenOver(job *data.ImportJob) bool {
+	cnt, err := db.From("cm_import_jobs").
+		Where(goqu.Ex{"id": &job.ID, "status": data.ImportJobStatusRunning}, goqu.C("owner_id").Neq(&importOwnerID)).
+		Count()
+	if err != nil {
+		logger.Errorf("importExportService.isTakenOver: Count() failed: %v", err)
+		return false
+	}
+	return cnt > 0
+}
+
+// process periodically resumes running import jobs whose lease has expired, because the instance that owned them has
+// been restarted or is gone
+func (svc *importExportService) process() {
+	for {
+		if err := svc.resumeExpired(); err != nil {
+			logger.Errorf("importExportService: resuming import jobs failed: %v", err)
+		}
+		time.Sleep(util.ImportJobLeaseTimeout)
+	}
+}
+
+// resumeExpired takes over and resumes running import jobs whose lease has expired. Jobs that can't be resumed are
+// marked failed
+func (svc *importExportService) resumeExpired() error {
+	// Find running jobs whose owner hasn't renewed its lease in time
+	expired := goqu.Or(goqu.C("ts_heartbeat").IsNull(), goqu.C("ts_heartbeat").Lt(time.Now().UTC().Add(-util.ImportJobLeaseTimeout)))
+	var js []*data.ImportJob
+	if err := db.From("cm_import_jobs").Where(goqu.Ex{"status": data.ImportJobStatusRunning}, expired).Order(goqu.I("ts_created").Asc()).ScanStructs(&js); err != nil {
+		logger.Errorf("importExportService.resumeExpired: ScanStructs() failed: %v", err)
+		return translateDBErrors(err)
+	}
+
+	for _, job := range js {
+		// Take the job over, unless another instance has just done so
+		job.WithOwner(&importOwnerID)
+		err := db.ExecOne(
+			db.Update("cm_import_jobs").
+				Set(goqu.Record{"owner_id": &importOwnerID, "ts_heartbeat": job.HeartbeatTime}).
+				Where(goqu.Ex{"id": &job.ID, "status": data.ImportJobStatusRunning}, expired))
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		} else if err != nil {
+			logger.Errorf("importExportService.resumeExpired: ExecOne() failed: %v", err)
+			return translateDBErrors(err)
 		}
-		countImported++
-		if !c.IsDeleted {
-			countNonDeleted++
-			countsPerPage[c.PageID] = countsPerPage[c.PageID] + 1
+
+		// Resume the job, or mark it failed if that isn't possible
+		if err := svc.resumeJob(job); err != nil {
+			logger.Errorf("Failed to resume import job %s: %v", &job.ID, err)
+			job.WithFinished(data.ImportJobStatusFailed, err)
+			if err := db.ExecOne(db.Update("cm_import_jobs").Set(job).Where(goqu.Ex{"id": &job.ID, "status": data.ImportJobStatusRunning, "owner_id": &importOwnerID})); err != nil {
+				logger.Errorf("importExportService.resumeExpired: ExecOne() failed: %v", err)
+			}
+			importRemoveFile(job)
 		}
+	}
+
+	// Succeeded
+	return nil
+}
+
+// resumeJob resumes the given interrupted import job, owned by this instance
+func (svc *importExportService) resumeJob(job *data.ImportJob) error {
+	// Make sure the data file is still there
+	if _, err := os.Stat(job.FileName); err != nil {
+		return fmt.Errorf("data file is unavailable: %w", err)
+	}
 
-		// Insert any children of the comment
-		var cci, ccnd int
-		if cci, ccnd, err = insertCommentsForParent(c.ID, commentParentMap, countsPerPage); err != nil {
+	// Fetch the user who started the job and the target domain
+	user, err := TheUserService.FindUserByID(&job.UserCreated)
+	if err != nil {
+		return err
+	}
+	domain, err := TheDomainService.FindByID(&job.DomainID)
+	if err != nil {
+		return err
+	}
+
+	// Run the job
+	logger.Infof("Resuming %s import job %s into domain %s", job.Source, &job.ID, domain.Host)
+	svc.runJob(job, user, domain)
+	return nil
+}
+
+// runJob runs the given import job, owned by this instance, in the background
+func (svc *importExportService) runJob(job *data.ImportJob, curUser *data.User, domain *data.Domain) {
+	// Register the job as running
+	ctx, cancel := context.WithCancel(context.Background())
+	svc.mu.Lock()
+	svc.cancels[job.ID] = cancel
+	svc.mu.Unlock()
+
+	// Keep the job's lease renewed while it's running
+	go svc.heartbeat(ctx, job, cancel)
+
+	go func() {
+		// Unregister the job once it's finished, and remove its data file, unless the job has been taken over by another
+		// instance
+		defer func() {
+			svc.mu.Lock()
+			delete(svc.cancels, job.ID)
+			svc.mu.Unlock()
+			cancel()
+			if !svc.isTakenOver(job) {
+				importRemoveFile(job)
+			}
+		}()
+
+		// Run the import
+		err := newImportRun(ctx, job, curUser, domain).execute()
+
+		// If the job has been cancelled or taken over, it's no longer ours to update
+		if errors.Is(err, errImportCancelled) {
+			logger.Infof("Import job %s has been cancelled or taken over by another instance", &job.ID)
 			return
 		}
-		countImported += cci
-		countNonDeleted += ccnd
+
+		// Update the job's status
+		if err != nil {
+			logger.Errorf("Import job %s failed: %v", &job.ID, err)
+			job.WithFinished(data.ImportJobStatusFailed, err)
+		} else {
+			logger.Infof("Import job %s completed (dry run: %v): %d out of %d comments imported", &job.ID, job.DryRun, job.CommentsImported, job.CommentsTotal)
+			job.WithFinished(data.ImportJobStatusCompleted, nil)
+		}
+		if err := db.ExecOne(db.Update("cm_import_jobs").Set(job).Where(goqu.Ex{"id": &job.ID, "status": data.ImportJobStatusRunning, "owner_id": &importOwnerID})); err != nil {
+			logger.Errorf("importExportService.runJob: ExecOne() failed: %v", err)
+		}
+	}()
+}
+
+// importRemoveFile removes the data file of the given import job, if it exists
+func importRemoveFile(job *data.ImportJob) {
+	if err := os.Remove(job.FileName); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logger.Warningf("Failed to remove import data file %s: %v", job.FileName, err)
+	}
+}
+
+// importFindUserByEmail finds the user with the given email, returning the user and whether the user and domain user
+// would have to be added. A missing user is returned as a new, unsaved instance
+func importFindUserByEmail(email string, domainID *uuid.UUID) (*data.User, bool, bool, error) {
+	user, err := TheUserService.FindUserByEmail(email)
+	if errors.Is(err, ErrNotFound) {
+		return data.NewUser(email, ""), true, true, nil
+	} else if err != nil {
+		return nil, false, false, err
+	}
+
+	// Check if domain user exists, too
+	_, du, err := TheDomainService.FindDomainUserByID(domainID, &user.ID, false)
+	if err != nil {
+		return nil, false, false, err
 	}
-	return
+	return user, false, du == nil, nil
 }
 
 // importUserByEmail adds the specified user/domain user, returning the user and whether user and domain user were added
@@ -4,23 +4,12 @@ import (
 	"database/sql"
 	"encoding/xml"
 	"errors"
-	"fmt"
 	"github.com/google/uuid"
 	"gitlab.com/comentario/comentario/internal/data"
 	"gitlab.com/comentario/comentario/internal/util"
 	"time"
 )
 
-type rssXML struct {
-	XMLName  xml.Name     `xml:"rss"`
-	Channels []rssChannel `xml:"channel"`
-}
-
-type rssChannel struct {
-	XMLName xml.Name        `xml:"channel"`
-	Items   []wordpressItem `xml:"item"`
-}
-
 type wordpressItem struct {
 	XMLName  xml.Name           `xml:"item"`
 	ID       string             `xml:"http://wordpress.org/export/1.2/ post_id"`
@@ -51,211 +40,83 @@ func (ct wordpressCommentType) IsRegular() bool {
 	return ct == "" || ct == "comment"
 }
 
-func wordpressImport(curUser *data.User, domain *data.Domain, buf []byte) *ImportResult {
-	// Unmarshal the XML data
-	exp := rssXML{}
-	if err := xml.Unmarshal(buf, &exp); err != nil {
-		logger.Errorf("wordpressImport: xml.Unmarshal() failed: %v", err)
-		return importError(err)
-	}
-
-	result := &ImportResult{}
-
-	// Fetch domain config
-	maxLength := TheDomainConfigService.GetInt(&domain.ID, data.DomainConfigKeyMaxCommentLength)
-	logger.Debugf("Max. comment text length is %d", maxLength)
-
-	// Make sure there's at least one channel
-	if len(exp.Channels) == 0 {
-		return result.WithError(errors.New("no channels found in the RSS feed"))
-	}
-
-	// Create/map commenters: email -> ID
-	var userIDMap map[string]uuid.UUID
-	var err error
-	if userIDMap, result.UsersAdded, result.DomainUsersAdded, err = wordpressMakeUserMap(&curUser.ID, &domain.ID, exp); err != nil {
-		return result.WithError(err)
+func wordpressImport(run *importRun) error {
+	r, err := run.open(true)
+	if err != nil {
+		return err
 	}
-
-	// Total number of users
-	result.UsersTotal = len(userIDMap)
-
-	// Iterate all posts
-	pageIDMap := map[string]uuid.UUID{}
-	commentParentIDMap := map[uuid.UUID][]*data.Comment{} // Groups comment lists by their parent ID
-	for _, channel := range exp.Channels {
-		for _, post := range channel.Items {
-			result.PagesTotal++
-
-			// Extract the path from link URL
-			var pageID uuid.UUID
-			if u, err := util.ParseAbsoluteURL(post.Link, true, false); err != nil {
-				return result.WithError(err)
-
-				// Find the page for that path
-			} else if id, ok := pageIDMap[u.Path]; ok {
-				pageID = id
-
-				// Page doesn't exist. Find or insert a page with this path
-			} else if page, added, err := ThePageService.UpsertByDomainPath(domain, u.Path, post.Title, nil); err != nil {
-				return result.WithError(err)
-
-			} else {
-				pageID = page.ID
-				pageIDMap[u.Path] = pageID
-
-				// If the page was added, increment the page count
-				if added {
-					result.PagesAdded++
-				}
+	defer util.LogError(r.Close, "wordpressImport, r.Close()")
+
+	// Stream the posts (RSS items)
+	dec := xml.NewDecoder(r)
+	numChannels := 0
+	err = importXMLElements(dec, map[string]func(se *xml.StartElement) error{
+		"channel": func(*xml.StartElement) error {
+			numChannels++
+			return nil
+		},
+		"item": func(se *xml.StartElement) error {
+			var post wordpressItem
+			if err := dec.DecodeElement(&post, se); err != nil {
+				return err
 			}
 
-			// Make a map of comment IDs
-			commentIDMap := map[string]uuid.UUID{}
-			for _, comment := range post.Comments {
-				// Only keep approved comments
-				if !comment.Type.IsRegular() || comment.Approved != "1" {
-					continue
-				}
-				// Allocate a new, random comment ID
-				commentIDMap[comment.ID] = uuid.New()
+			// Extract the path from link URL and find or insert a page with this path
+			u, err := util.ParseAbsoluteURL(post.Link, true, false)
+			if err != nil {
+				return err
+			} else if _, err := run.page(u.Path, post.Title); err != nil {
+				return err
 			}
 
-			// Iterate post's comments, once again
+			// Iterate post's comments
 			for _, comment := range post.Comments {
-				result.CommentsTotal++
-
-				// Only keep approved comments
-				if !comment.Type.IsRegular() || comment.Approved != "1" {
-					result.CommentsSkipped++
-					continue
-				}
-
-				// Find the comment ID (it must exist at this point)
-				commentID, ok := commentIDMap[comment.ID]
-				if !ok {
-					err := fmt.Errorf("failed to map WordPress comment ID (%s)", comment.ID)
-					logger.Errorf("wordpressImport: %v", err)
-					return result.WithError(err)
-				}
-
-				// Find the user ID by their email
-				uid := data.AnonymousUser.ID
-				authorName := comment.Author
-				if comment.AuthorEmail != "" {
-					if id, ok := userIDMap[comment.AuthorEmail]; ok {
-						uid = id
-						authorName = ""
-					}
-				}
-
-				// Find the parent comment ID. For indexing purposes only, root ID will be represented by a zero UUID.
-				// It will also be the fallback, should parent ID not exist in the map
-				parentCommentID := uuid.NullUUID{}
-				pzID := util.ZeroUUID
-				if id, ok := commentIDMap[comment.Parent]; ok {
-					parentCommentID = uuid.NullUUID{UUID: id, Valid: true}
-					pzID = id
-				}
-
-				// Create a new comment instance
 				t := wordpressParseDate(comment.Date)
-				c := &data.Comment{
-					ID:            commentID,
-					ParentID:      parentCommentID,
-					PageID:        pageID,
-					IsApproved:    true,
-					CreatedTime:   t,
-					ModeratedTime: sql.NullTime{Time: t, Valid: true},
-					UserCreated:   uuid.NullUUID{UUID: uid, Valid: true},
-					UserModerated: uuid.NullUUID{UUID: curUser.ID, Valid: true},
-					AuthorName:    authorName,
+				rec := &importRecord{
+					ID:        comment.ID,
+					ParentID:  util.If(comment.Parent == "0", "", comment.Parent),
+					PagePath:  u.Path,
+					PageTitle: post.Title,
+					Markdown:  comment.Content,
+					// Only keep approved comments
+					Skip: !comment.Type.IsRegular() || comment.Approved != "1",
+					Comment: &data.Comment{
+						IsApproved:    true,
+						CreatedTime:   t,
+						ModeratedTime: sql.NullTime{Time: t, Valid: true},
+						UserModerated: uuid.NullUUID{UUID: run.curUser.ID, Valid: true},
+						AuthorName:    comment.Author,
+					},
 				}
 
-				// Update the comment's markdown and render it into HTML. Truncate comment text to avoid errors
-				if err := TheCommentService.SetMarkdown(c, util.TruncateStr(comment.Content, maxLength), &domain.ID, nil); err != nil {
-					return result.WithError(err)
+				// Users without name or email remain anonymous
+				if comment.Author != "" && comment.AuthorEmail != "" {
+					rec.Author = &importAuthor{
+						Email:       comment.AuthorEmail,
+						Name:        comment.Author,
+						WebsiteURL:  comment.AuthorURL,
+						Remarks:     "Imported from WordPress",
+						RealEmail:   true,
+						CreatedTime: t,
+					}
 				}
-
-				// File it under the appropriate parent ID
-				if l, ok := commentParentIDMap[pzID]; ok {
-					commentParentIDMap[pzID] = append(l, c)
-				} else {
-					commentParentIDMap[pzID] = []*data.Comment{c}
+				if err := run.add(rec); err != nil {
+					return err
 				}
 			}
-		}
+			return nil
+		},
+	})
+	if err != nil {
+		logger.Errorf("wordpressImport: failed to read data: %v", err)
+		return err
 	}
 
-	// Recurse the comment tree (map) to insert them in the right order (parents-to-children), starting with the root
-	// (= zero UUID)
-	countsPerPage := map[uuid.UUID]int{}
-	result.CommentsImported, result.CommentsNonDeleted, result.Error = insertCommentsForParent(util.ZeroUUID, commentParentIDMap, countsPerPage)
-
-	// Increase comment count on the domain, ignoring errors
-	_ = TheDomainService.IncrementCounts(&domain.ID, result.CommentsNonDeleted, 0)
-
-	// Increase comment counts on all pages
-	for pageID, pc := range countsPerPage {
-		if pc > 0 {
-			_ = ThePageService.IncrementCounts(&pageID, pc, 0)
-		}
+	// Make sure there was at least one channel
+	if numChannels == 0 {
+		return errors.New("no channels found in the RSS feed")
 	}
-
-	// Done
-	return result
-}
-
-// wordpressMakeUserMap creates a map of email -> user ID from the given Wordpress export data
-func wordpressMakeUserMap(curUserID, domainID *uuid.UUID, exp rssXML) (userMap map[string]uuid.UUID, usersAdded, domainUsersAdded int, err error) {
-	userIDMap := make(map[string]uuid.UUID)
-	for _, channel := range exp.Channels {
-		for _, post := range channel.Items {
-			for _, comment := range post.Comments {
-				// Only keep approved comments and skip users without name or email
-				if !comment.Type.IsRegular() || comment.Approved != "1" || comment.Author == "" || comment.AuthorEmail == "" {
-					continue
-				}
-
-				// Skip already existing users
-				if _, ok := userIDMap[comment.AuthorEmail]; ok {
-					continue
-				}
-
-				// Import the user and domain user
-				var user *data.User
-				var userAdded, domainUserAdded bool
-				if user, userAdded, domainUserAdded, err = importUserByEmail(
-					comment.AuthorEmail,
-					"", // Local auth only
-					comment.Author,
-					comment.AuthorURL,
-					"Imported from WordPress",
-					true,
-					false, // No SSO flag support in the export
-					curUserID,
-					domainID,
-					wordpressParseDate(comment.Date),
-				); err != nil {
-					return
-				}
-
-				// Increment user counters
-				if userAdded {
-					usersAdded++
-				}
-				if domainUserAdded {
-					domainUsersAdded++
-				}
-
-				// Add the user's email-to-ID mapping
-				userIDMap[comment.AuthorEmail] = user.ID
-			}
-		}
-	}
-
-	// Succeeded
-	return userIDMap, usersAdded, domainUsersAdded, nil
+	return nil
 }
 
 // wordpressParseDate parses a WordPress UTC/GMT date in the given string, returning the current time if parsing fails
@@ -2,15 +2,22 @@ package svc
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"encoding/base32"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"github.com/google/uuid"
 	"gitlab.com/comentario/comentario/internal/config"
 	"gitlab.com/comentario/comentario/internal/data"
 	"gitlab.com/comentario/comentario/internal/util"
 	"html/template"
+	"io"
+	"net/mail"
 	"os"
 	"path"
 	"reflect"
+	"strings"
 	"sync"
 )
 
@@ -19,16 +26,43 @@ var TheMailService MailService = &mailService{
 	templates: make(map[string]*template.Template),
 }
 
+// mailReplySignatureLen is the length of the signature included in reply address tags, in bytes
+const mailReplySignatureLen = 10
+
+// mailReplyTagEncoding is the encoding used for reply address tags. Base32 is used because the case of email address
+// local part isn't guaranteed to be preserved
+var mailReplyTagEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// mailReplyRecipientHeaders lists message headers that can contain the reply address, in the order of preference
+var mailReplyRecipientHeaders = []string{"Delivered-To", "X-Original-To", "Envelope-To", "To", "Cc"}
+
 type MailNotificationKind string
 
 const (
 	MailNotificationKindReply         = MailNotificationKind("reply")
 	MailNotificationKindModerator     = MailNotificationKind("moderator")
 	MailNotificationKindCommentStatus = MailNotificationKind("commentStatus")
+	MailNotificationKindSubscription  = MailNotificationKind("subscription")
 )
 
+// MailDigestItem is a single comment notification included in an email digest
+type MailDigestItem struct {
+	Kind          MailNotificationKind // Notification kind
+	CanModerate   bool                 // Whether the recipient can moderate the comment
+	Domain        *data.Domain         // Domain the comment belongs to
+	Page          *data.DomainPage     // Page the comment belongs to
+	Comment       *data.Comment        // The comment in question
+	CommenterName string               // Name of the comment author
+}
+
 // MailService is a service interface for sending mails
 type MailService interface {
+	// ParseReply parses the given raw email message sent in reply to a comment notification. Returns the user who sent
+	// the reply, the ID of the comment being replied to, and the reply text with any quoted text stripped. Returns
+	// ErrBadToken if the message isn't addressed to a reply address validly signed for the sender
+	ParseReply(r io.Reader) (*data.User, *uuid.UUID, string, error)
+	// SendCommentDigest sends an email digest combining the given comment notifications to the given recipient
+	SendCommentDigest(recipient *data.User, items []*MailDigestItem) error
 	// SendCommentNotification sends an email notification about a comment to the given recipient
 	SendCommentNotification(kind MailNotificationKind, recipient *data.User, canModerate bool, domain *data.Domain, page *data.DomainPage, comment *data.Comment, commenterName string) error
 	// SendConfirmEmail sends an email with a confirmation link
@@ -47,6 +81,101 @@ type mailService struct {
 	templMu   sync.RWMutex                  // Template cache mutex
 }
 
+func (svc *mailService) ParseReply(r io.Reader) (*data.User, *uuid.UUID, string, error) {
+	logger.Debug("mailService.ParseReply(...)")
+
+	// Parse the message
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		logger.Debugf("mailService.ParseReply: ReadMessage() failed: %v", err)
+		return nil, nil, "", err
+	}
+
+	// Find the sender
+	from, err := mail.ParseAddress(msg.Header.Get("From"))
+	if err != nil {
+		logger.Debugf("mailService.ParseReply: failed to parse sender address: %v", err)
+		return nil, nil, "", ErrBadToken
+	}
+
+	// Find a reply address tag among the recipients and decode it
+	tag := svc.findReplyTag(msg.Header)
+	b, err := mailReplyTagEncoding.DecodeString(strings.ToUpper(tag))
+	if err != nil || len(b) != len(uuid.UUID{})+mailReplySignatureLen {
+		logger.Debugf("mailService.ParseReply: no valid reply tag found (%q)", tag)
+		return nil, nil, "", ErrBadToken
+	}
+	commentID, err := uuid.FromBytes(b[:len(uuid.UUID{})])
+	if err != nil {
+		return nil, nil, "", ErrBadToken
+	}
+
+	// Find the sending user and verify the tag has been signed for them
+	user, err := TheUserService.FindUserByEmail(from.Address)
+	if errors.Is(err, ErrNotFound) {
+		logger.Debugf("mailService.ParseReply: no user found for sender %q", from.Address)
+		return nil, nil, "", ErrBadToken
+	} else if err != nil {
+		return nil, nil, "", err
+	} else if !hmac.Equal(b[len(uuid.UUID{}):], svc.signReply(user, &commentID)) {
+		logger.Debugf("mailService.ParseReply: reply tag signature mismatch for user %s", &user.ID)
+		return nil, nil, "", ErrBadToken
+	}
+
+	// Extract the reply text
+	text, err := util.MailMessageText(msg)
+	if err != nil {
+		logger.Debugf("mailService.ParseReply: MailMessageText() failed: %v", err)
+		return nil, nil, "", err
+	}
+
+	// Succeeded
+	return user, &commentID, util.StripQuotedText(text), nil
+}
+
+func (svc *mailService) SendCommentDigest(recipient *data.User, items []*MailDigestItem) error {
+	lang := recipient.LangID
+	t := func(id string) string { return TheI18nService.Translate(lang, id) }
+
+	// Prepare template params for each item
+	var itemParams []map[string]any
+	for _, item := range items {
+		ip := map[string]any{
+			"CanModerate":   item.CanModerate,
+			"CommenterName": item.CommenterName,
+			"CommentURL":    item.Comment.URL(item.Domain.IsHTTPS, item.Domain.Host, item.Page.Path),
+			"HTML":          template.HTML(item.Comment.HTML),
+			"IsApproved":    item.Comment.IsApproved,
+			"IsPending":     item.Comment.IsPending,
+			"Kind":          item.Kind,
+			"PageTitle":     item.Page.DisplayTitle(item.Domain),
+			"PageURL":       item.Domain.RootURL() + item.Page.Path,
+		}
+		if item.CanModerate {
+			ip["ModerateURL"] = TheI18nService.FrontendURL(
+				lang,
+				fmt.Sprintf("manage/domains/%s/comments/%s", &item.Domain.ID, &item.Comment.ID),
+				nil)
+		}
+		itemParams = append(itemParams, ip)
+	}
+
+	// Send out a digest email
+	subject := t("commentDigest")
+	return svc.sendFromTemplate(
+		lang,
+		"",
+		recipient.Email,
+		subject,
+		"comment-digest.gohtml",
+		map[string]any{
+			"EmailReason": t("notificationDigest"),
+			"Items":       itemParams,
+			"Lang":        lang,
+			"Title":       subject,
+		})
+}
+
 func (svc *mailService) SendCommentNotification(kind MailNotificationKind, recipient *data.User, canModerate bool, domain *data.Domain, page *data.DomainPage, comment *data.Comment, commenterName string) error {
 	lang := recipient.LangID
 	t := func(id string, args ...reflect.Value) string { return TheI18nService.Translate(lang, id, args...) }
@@ -66,6 +195,8 @@ func (svc *mailService) SendCommentNotification(kind MailNotificationKind, recip
 		reason = t("notificationNewReply")
 	case kind == MailNotificationKindCommentStatus:
 		reason = t("notificationCommentStatus")
+	case kind == MailNotificationKindSubscription:
+		reason = t("notificationSubscription")
 	case comment.IsPending:
 		reason = t("notificationModPending")
 	default:
@@ -112,8 +243,16 @@ func (svc *mailService) SendCommentNotification(kind MailNotificationKind, recip
 		params["DeleteURL"] = TheI18nService.FrontendURL(lang, commentPropPath, map[string]string{"action": "delete"})
 	}
 
+	// If reply-by-email is enabled and the comment can be replied to, make replies to the email go to a reply address
+	// signed for the recipient
+	var replyTo string
+	if config.SecretsConfig.InboundMail.Enabled() && comment.IsApproved && !comment.IsDeleted {
+		replyTo = svc.replyAddress(recipient, &comment.ID)
+		params["CanReply"] = true
+	}
+
 	// Send out a notification email
-	return svc.sendFromTemplate(lang, "", recipient.Email, subject, "comment-notification.gohtml", params)
+	return svc.sendFromTemplate(lang, replyTo, recipient.Email, subject, "comment-notification.gohtml", params)
 }
 
 func (svc *mailService) SendConfirmEmail(user *data.User, token *data.Token) error {
@@ -179,6 +318,25 @@ func (svc *mailService) SendPasswordReset(user *data.User, token *data.Token) er
 		})
 }
 
+// findReplyTag returns the tag of the first reply address found among the message recipients, or an empty string if
+// there's none
+func (svc *mailService) findReplyTag(h mail.Header) string {
+	for _, name := range mailReplyRecipientHeaders {
+		for _, value := range h[name] {
+			addrs, err := mail.ParseAddressList(value)
+			if err != nil {
+				continue
+			}
+			for _, addr := range addrs {
+				if tag := config.SecretsConfig.InboundMail.ReplyTag(addr.Address); tag != "" {
+					return tag
+				}
+			}
+		}
+	}
+	return ""
+}
+
 // getTemplate returns a cached template by its language and name, or nil if there's none
 func (svc *mailService) getTemplate(lang, name string) *template.Template {
 	svc.templMu.RLock()
@@ -240,6 +398,12 @@ func (svc *mailService) parseTemplateFiles(t *template.Template, names ...string
 	return nil
 }
 
+// replyAddress returns a reply address for the given comment, signed for the given user
+func (svc *mailService) replyAddress(user *data.User, commentID *uuid.UUID) string {
+	return config.SecretsConfig.InboundMail.ReplyAddress(
+		strings.ToLower(mailReplyTagEncoding.EncodeToString(append(commentID[:], svc.signReply(user, commentID)...))))
+}
+
 // send an email and log the outcome
 func (svc *mailService) send(replyTo, recipient, subject, htmlMessage string, embedFiles ...string) error {
 	logger.Debugf("mailService.send('%s', '%s', '%s', ...)", replyTo, recipient, subject)
@@ -273,3 +437,11 @@ func (svc *mailService) sendFromTemplate(lang, replyTo, recipient, subject, temp
 		body,
 		path.Join(config.ServerConfig.TemplatePath, "images", "logo.png"))
 }
+
+// signReply returns a signature of a reply to the given comment by the given user, using HMAC with SHA256 truncated to
+// mailReplySignatureLen bytes
+func (svc *mailService) signReply(user *data.User, commentID *uuid.UUID) []byte {
+	// Sign the comment ID with the user secret combined with the inbound mail secret
+	key := append(user.SecretToken[:], config.SecretsConfig.InboundMail.Secret...)
+	return util.HMACSign(commentID[:], key)[:mailReplySignatureLen]
+}
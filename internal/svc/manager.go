@@ -92,6 +92,21 @@ func (m *manager) Run() {
 		logger.Fatalf("Failed to initialise cleanup service: %v", err)
 	}
 
+	// Start the email digest service
+	if err := TheDigestService.Run(); err != nil {
+		logger.Fatalf("Failed to start digest service: %v", err)
+	}
+
+	// Start the webhook delivery service
+	if err := TheWebhookService.Run(); err != nil {
+		logger.Fatalf("Failed to start webhook service: %v", err)
+	}
+
+	// Resume interrupted import jobs
+	if err := TheImportExportService.Run(); err != nil {
+		logger.Fatalf("Failed to resume import jobs: %v", err)
+	}
+
 	// Start the websockets service, if enabled
 	if config.ServerConfig.DisableLiveUpdate {
 		logger.Info("Live update is disabled")
@@ -5,6 +5,7 @@ import (
 	"github.com/avct/uasurfer"
 	"github.com/doug-martin/goqu/v9"
 	"github.com/google/uuid"
+	"gitlab.com/comentario/comentario/extend/plugin"
 	"gitlab.com/comentario/comentario/internal/config"
 	"gitlab.com/comentario/comentario/internal/data"
 	"gitlab.com/comentario/comentario/internal/util"
@@ -313,6 +314,15 @@ func (svc *pageService) UpsertByDomainPath(domain *data.Domain, path, title stri
 		if title == "" {
 			go func() { _, _ = svc.FetchUpdatePageTitle(domain, &pResult) }()
 		}
+
+		// Notify plugins about the new page. The page is already persisted at this point, so any error is only logged
+		if ThePluginManager.Active() {
+			e := &plugin.PageCreateEvent{}
+			e.SetPage(pResult.ToPluginDomainPage())
+			if err := ThePluginManager.HandleEvent(e); err != nil {
+				logger.Warningf("pageService.UpsertByDomainPath: HandleEvent() failed: %v", err)
+			}
+		}
 	}
 
 	// Also register visit details in the background, if required
@@ -0,0 +1,416 @@
+package svc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"gitlab.com/comentario/comentario/internal/config"
+	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/util"
+	"sync"
+	"time"
+)
+
+// ThePasskeyService is a global PasskeyService implementation
+var ThePasskeyService PasskeyService = &passkeyService{}
+
+// PasskeyService is a service interface for dealing with passkeys (WebAuthn credentials)
+type PasskeyService interface {
+	// Delete deletes the passkey with the given ID, owned by the given user
+	Delete(userID, id *uuid.UUID) error
+	// ListByUser fetches and returns all passkeys registered by the given user
+	ListByUser(userID *uuid.UUID) ([]*data.Passkey, error)
+	// LoginBegin starts a passkey sign-in ceremony, returning the ID of the auth session holding the challenge and the
+	// options to pass to the browser. host is the host of the embedding page, or an empty string for the admin UI
+	LoginBegin(host string) (*uuid.UUID, *protocol.CredentialAssertion, error)
+	// LoginFinish completes a passkey sign-in ceremony started with LoginBegin, verifying the assertion response
+	// received from the browser, and returns the user the passkey belongs to
+	LoginFinish(sessionID *uuid.UUID, host string, response []byte) (*data.User, error)
+	// RegistrationBegin starts a passkey registration ceremony for the given user, returning the ID of the auth session
+	// holding the challenge and the options to pass to the browser
+	RegistrationBegin(user *data.User) (*uuid.UUID, *protocol.CredentialCreation, error)
+	// RegistrationFinish completes a passkey registration ceremony started with RegistrationBegin, verifying the
+	// attestation response received from the browser, and persists and returns the new passkey
+	RegistrationFinish(user *data.User, sessionID *uuid.UUID, name string, response []byte) (*data.Passkey, error)
+	// RelatedOrigins returns the list of origins allowed to use passkeys issued for this server: the server's own one
+	// plus that of every registered domain. The list is cached for util.WebAuthnOriginsCacheTTL
+	RelatedOrigins() ([]string, error)
+	// Rename updates the name of the passkey with the given ID, owned by the given user
+	Rename(userID, id *uuid.UUID, name string) error
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+
+// passkeyService is a blueprint PasskeyService implementation
+type passkeyService struct {
+	originsMu  sync.Mutex // Guards the cached related origins
+	origins    []string   // Cached related origins
+	originsExp time.Time  // When the cached related origins expire
+}
+
+func (svc *passkeyService) Delete(userID, id *uuid.UUID) error {
+	logger.Debugf("passkeyService.Delete(%s, %s)", userID, id)
+
+	// Delete the record
+	if err := db.ExecOne(db.Delete("cm_user_passkeys").Where(goqu.Ex{"id": id, "user_id": userID})); err != nil {
+		logger.Errorf("passkeyService.Delete: ExecOne() failed: %v", err)
+		return translateDBErrors(err)
+	}
+
+	// Succeeded
+	return nil
+}
+
+func (svc *passkeyService) ListByUser(userID *uuid.UUID) ([]*data.Passkey, error) {
+	logger.Debugf("passkeyService.ListByUser(%s)", userID)
+
+	// Query the passkeys
+	var res []*data.Passkey
+	err := db.From("cm_user_passkeys").
+		Where(goqu.Ex{"user_id": userID}).
+		Order(goqu.I("ts_created").Asc()).
+		ScanStructs(&res)
+	if err != nil {
+		logger.Errorf("passkeyService.ListByUser: ScanStructs() failed: %v", err)
+		return nil, translateDBErrors(err)
+	}
+
+	// Succeeded
+	return res, nil
+}
+
+func (svc *passkeyService) LoginBegin(host string) (*uuid.UUID, *protocol.CredentialAssertion, error) {
+	logger.Debugf("passkeyService.LoginBegin(%q)", host)
+
+	// Instantiate a relying party
+	wa, err := svc.relyingParty(host)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Start a discoverable login, letting the user pick any of their passkeys
+	opts, sd, err := wa.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		logger.Errorf("passkeyService.LoginBegin: BeginDiscoverableLogin() failed: %v", err)
+		return nil, nil, err
+	}
+
+	// Save the ceremony state
+	id, err := svc.saveSession(&data.AnonymousUser.ID, sd, host)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Succeeded
+	return id, opts, nil
+}
+
+func (svc *passkeyService) LoginFinish(sessionID *uuid.UUID, host string, response []byte) (*data.User, error) {
+	logger.Debugf("passkeyService.LoginFinish(%s, %q, ...)", sessionID, host)
+
+	// Restore the ceremony state
+	sd, err := svc.takeSession(sessionID, &data.AnonymousUser.ID, host)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the response
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		logger.Warningf("passkeyService.LoginFinish: ParseCredentialRequestResponseBytes() failed: %v", err)
+		return nil, ErrPasskeyVerification
+	}
+
+	// Instantiate a relying party
+	wa, err := svc.relyingParty(host)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate the assertion, looking up the user by the passkey used
+	var pk *data.Passkey
+	pu, cred, err := wa.ValidatePasskeyLogin(
+		func(rawID, userHandle []byte) (webauthn.User, error) {
+			p, u, err := svc.findByCredentialID(rawID)
+			if err != nil {
+				return nil, err
+			} else if !bytes.Equal(userHandle, u.WebAuthnID()) {
+				return nil, ErrPasskeyVerification
+			}
+			pk = p
+			return u, nil
+		},
+		*sd,
+		parsed)
+	if errors.Is(err, ErrDB) {
+		return nil, err
+	} else if err != nil {
+		logger.Warningf("passkeyService.LoginFinish: ValidatePasskeyLogin() failed: %v", err)
+		return nil, ErrPasskeyVerification
+	} else if cred.Authenticator.CloneWarning {
+		logger.Warningf("passkeyService.LoginFinish: passkey %s is possibly cloned (sign counter went back)", &pk.ID)
+		return nil, ErrPasskeyVerification
+	}
+
+	// Register the passkey usage
+	pk.WithCredential(cred)
+	if err := db.ExecOne(db.Update("cm_user_passkeys").Set(pk).Where(goqu.Ex{"id": &pk.ID})); err != nil {
+		logger.Errorf("passkeyService.LoginFinish: ExecOne() failed: %v", err)
+		return nil, translateDBErrors(err)
+	}
+
+	// Succeeded
+	return pu.(*data.PasskeyUser).User, nil
+}
+
+func (svc *passkeyService) RegistrationBegin(user *data.User) (*uuid.UUID, *protocol.CredentialCreation, error) {
+	logger.Debugf("passkeyService.RegistrationBegin(%s)", &user.ID)
+
+	// Fetch the user's existing passkeys, to make the authenticator refuse registering any of them again
+	pks, err := svc.ListByUser(&user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	pu := &data.PasskeyUser{User: user, Passkeys: pks}
+	var excl []protocol.CredentialDescriptor
+	for _, c := range pu.WebAuthnCredentials() {
+		excl = append(excl, c.Descriptor())
+	}
+
+	// Instantiate a relying party
+	wa, err := svc.relyingParty("")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Start the registration, requiring a discoverable credential
+	opts, sd, err := wa.BeginRegistration(
+		pu,
+		webauthn.WithExclusions(excl),
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			RequireResidentKey: protocol.ResidentKeyRequired(),
+			ResidentKey:        protocol.ResidentKeyRequirementRequired,
+			UserVerification:   protocol.VerificationRequired,
+		}))
+	if err != nil {
+		logger.Errorf("passkeyService.RegistrationBegin: BeginRegistration() failed: %v", err)
+		return nil, nil, err
+	}
+
+	// Save the ceremony state
+	id, err := svc.saveSession(&user.ID, sd, "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Succeeded
+	return id, opts, nil
+}
+
+func (svc *passkeyService) RegistrationFinish(user *data.User, sessionID *uuid.UUID, name string, response []byte) (*data.Passkey, error) {
+	logger.Debugf("passkeyService.RegistrationFinish(%s, %s, %q, ...)", &user.ID, sessionID, name)
+
+	// Restore the ceremony state
+	sd, err := svc.takeSession(sessionID, &user.ID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the response
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		logger.Warningf("passkeyService.RegistrationFinish: ParseCredentialCreationResponseBytes() failed: %v", err)
+		return nil, ErrPasskeyVerification
+	}
+
+	// Instantiate a relying party
+	wa, err := svc.relyingParty("")
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify the attestation and create a credential
+	cred, err := wa.CreateCredential(&data.PasskeyUser{User: user}, *sd, parsed)
+	if err != nil {
+		logger.Warningf("passkeyService.RegistrationFinish: CreateCredential() failed: %v", err)
+		return nil, ErrPasskeyVerification
+	}
+
+	// Persist a new passkey
+	pk := data.NewPasskey(&user.ID, name, cred)
+	if err := db.ExecOne(db.Insert("cm_user_passkeys").Rows(pk)); err != nil {
+		logger.Errorf("passkeyService.RegistrationFinish: ExecOne() failed: %v", err)
+		return nil, translateDBErrors(err)
+	}
+
+	// Succeeded
+	return pk, nil
+}
+
+func (svc *passkeyService) RelatedOrigins() ([]string, error) {
+	logger.Debug("passkeyService.RelatedOrigins()")
+	svc.originsMu.Lock()
+	defer svc.originsMu.Unlock()
+
+	// Use the cached list, if it's still fresh
+	if svc.origins != nil && time.Now().Before(svc.originsExp) {
+		return svc.origins, nil
+	}
+
+	// Query the domains
+	var ds []*data.Domain
+	if err := db.From("cm_domains").Select("is_https", "host").Order(goqu.I("host").Asc()).ScanStructs(&ds); err != nil {
+		logger.Errorf("passkeyService.RelatedOrigins: ScanStructs() failed: %v", err)
+		return nil, translateDBErrors(err)
+	}
+
+	// Collect the origins, starting with the server's own one
+	res := []string{svc.serverOrigin()}
+	for _, d := range ds {
+		res = append(res, d.RootURL())
+	}
+
+	// Succeeded: cache the list
+	svc.origins = res
+	svc.originsExp = time.Now().Add(util.WebAuthnOriginsCacheTTL)
+	return res, nil
+}
+
+func (svc *passkeyService) Rename(userID, id *uuid.UUID, name string) error {
+	logger.Debugf("passkeyService.Rename(%s, %s, %q)", userID, id, name)
+
+	// Update the record
+	err := db.ExecOne(db.Update("cm_user_passkeys").Set(goqu.Record{"name": name}).Where(goqu.Ex{"id": id, "user_id": userID}))
+	if err != nil {
+		logger.Errorf("passkeyService.Rename: ExecOne() failed: %v", err)
+		return translateDBErrors(err)
+	}
+
+	// Succeeded
+	return nil
+}
+
+// findByCredentialID finds a passkey by its credential ID, and returns it along with its owner and all their passkeys
+func (svc *passkeyService) findByCredentialID(credID []byte) (*data.Passkey, *data.PasskeyUser, error) {
+	// Query the passkey
+	var pk data.Passkey
+	if b, err := db.From("cm_user_passkeys").Where(goqu.Ex{"credential_id": credID}).ScanStruct(&pk); err != nil {
+		logger.Errorf("passkeyService.findByCredentialID: ScanStruct() failed: %v", err)
+		return nil, nil, translateDBErrors(err)
+	} else if !b {
+		return nil, nil, ErrPasskeyVerification
+	}
+
+	// Fetch the owner
+	user, err := TheUserService.FindUserByID(&pk.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Fetch the owner's passkeys
+	pks, err := svc.ListByUser(&user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Succeeded
+	return &pk, &data.PasskeyUser{User: user, Passkeys: pks}, nil
+}
+
+// relyingParty returns a new WebAuthn relying party instance, whose ID is the server's host. If host is given, the
+// corresponding domain's origin is also allowed, which requires the domain to be registered
+func (svc *passkeyService) relyingParty(host string) (*webauthn.WebAuthn, error) {
+	origins := []string{svc.serverOrigin()}
+	if host != "" {
+		if d, err := TheDomainService.FindByHost(host); err != nil {
+			return nil, err
+		} else {
+			origins = append(origins, d.RootURL())
+		}
+	}
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          config.ServerConfig.ParsedBaseURL().Hostname(),
+		RPDisplayName: util.ApplicationName,
+		RPOrigins:     origins,
+	})
+	if err != nil {
+		logger.Errorf("passkeyService.relyingParty: webauthn.New() failed: %v", err)
+		return nil, err
+	}
+	return wa, nil
+}
+
+// saveSession persists the given ceremony state in a new auth session, backed by a new token owned by the given user,
+// and returns the session ID
+func (svc *passkeyService) saveSession(ownerID *uuid.UUID, sd *webauthn.SessionData, host string) (*uuid.UUID, error) {
+	// Serialise the session data
+	b, err := json.Marshal(sd)
+	if err != nil {
+		logger.Errorf("passkeyService.saveSession: Marshal() failed: %v", err)
+		return nil, err
+	}
+
+	// Create a token, which will take the auth session along when it expires
+	token, err := data.NewToken(ownerID, data.TokenScopePasskey, util.AuthSessionDuration, false)
+	if err != nil {
+		return nil, err
+	} else if err := TheTokenService.Create(token); err != nil {
+		return nil, err
+	}
+
+	// Create an auth session
+	as, err := TheAuthSessionService.Create(string(b), host, token.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	// Succeeded
+	return &as.ID, nil
+}
+
+// serverOrigin returns the origin of the server's base URL
+func (svc *passkeyService) serverOrigin() string {
+	u := config.ServerConfig.ParsedBaseURL()
+	return u.Scheme + "://" + u.Host
+}
+
+// takeSession fetches and deletes the auth session with the given ID, verifies it was created by the given user for
+// the given host, and returns the ceremony state it holds
+func (svc *passkeyService) takeSession(id, ownerID *uuid.UUID, host string) (*webauthn.SessionData, error) {
+	// Fetch the auth session
+	as, err := TheAuthSessionService.TakeByID(id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrPasskeyVerification
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Fetch and discard the token backing the session
+	token, err := TheTokenService.FindByValue(as.TokenValue, false)
+	if errors.Is(err, ErrBadToken) {
+		return nil, ErrPasskeyVerification
+	} else if err != nil {
+		return nil, err
+	} else if err := TheTokenService.DeleteByValue(token.Value); err != nil {
+		return nil, err
+	}
+
+	// Make sure the session is used by the same user and on the same host
+	if token.Owner != *ownerID || token.Scope != data.TokenScopePasskey || as.Host != host {
+		return nil, ErrPasskeyVerification
+	}
+
+	// Deserialise the session data
+	var sd webauthn.SessionData
+	if err := json.Unmarshal([]byte(as.Data), &sd); err != nil {
+		logger.Errorf("passkeyService.takeSession: Unmarshal() failed: %v", err)
+		return nil, err
+	}
+
+	// Succeeded
+	return &sd, nil
+}
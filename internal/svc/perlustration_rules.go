@@ -0,0 +1,255 @@
+package svc
+
+import (
+	"fmt"
+	"gitlab.com/comentario/comentario/internal/api/models"
+	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/util"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// localRuleMinCapsLetters is the minimum number of letters a comment must have for the all-caps ratio to be checked
+const localRuleMinCapsLetters = 20
+
+// localRuleLangScripts maps supported language codes to Unicode scripts their texts are written in
+var localRuleLangScripts = map[string][]string{
+	"ar": {"Arabic"},
+	"be": {"Cyrillic"},
+	"bg": {"Cyrillic"},
+	"bn": {"Bengali"},
+	"el": {"Greek"},
+	"fa": {"Arabic"},
+	"he": {"Hebrew"},
+	"hi": {"Devanagari"},
+	"hy": {"Armenian"},
+	"ja": {"Han", "Hiragana", "Katakana"},
+	"ka": {"Georgian"},
+	"kk": {"Cyrillic"},
+	"ko": {"Hangul", "Han"},
+	"mk": {"Cyrillic"},
+	"mr": {"Devanagari"},
+	"ne": {"Devanagari"},
+	"ru": {"Cyrillic"},
+	"sr": {"Cyrillic", "Latin"},
+	"ta": {"Tamil"},
+	"th": {"Thai"},
+	"uk": {"Cyrillic"},
+	"ur": {"Arabic"},
+	"yi": {"Hebrew"},
+	"zh": {"Han"},
+	// Any other language is assumed to use the Latin script
+}
+
+// localRule is a single check performed by localRulesScanner. The rule is only applied when the domain configuration
+// provides a value for the rule's name
+type localRule struct {
+	name  string                                                        // Rule name, which is also its configuration key
+	check func(value string, ctx *commentScanningContext) (bool, error) // Check function, returning true if the comment violates the rule
+}
+
+// localRules is a list of rules known to localRulesScanner, in the order of their evaluation
+var localRules = []localRule{
+	{"blockedWords", localRuleBlockedWords},
+	{"blockedRegex", localRuleBlockedRegex},
+	{"maxLinks", localRuleMaxLinks},
+	{"maxRepeatedChars", localRuleMaxRepeatedChars},
+	{"maxCapsRatio", localRuleMaxCapsRatio},
+	{"languages", localRuleLanguages},
+	{"maxPerIPPerHour", localRuleMaxPerIPPerHour},
+	{"maxPerUserPerHour", localRuleMaxPerUserPerHour},
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+
+// localRulesScanner is a CommentScanner that checks comments against a set of rules configured for the domain, without
+// resorting to any external service. Each rule is configured with a "<name>=<value>" line, and, optionally, the
+// action to take on a match with a "<name>.action=<action>" line, where action is one of "flag", "pending" (the
+// default), or "reject"
+type localRulesScanner struct{}
+
+func (s *localRulesScanner) ID() models.DomainExtensionID {
+	return data.DomainExtensionIDLocalRules
+}
+
+func (s *localRulesScanner) KeyProvided() bool {
+	// No key is needed
+	return false
+}
+
+func (s *localRulesScanner) Scan(config map[string]string, ctx *commentScanningContext) (data.ModerationAction, string, error) {
+	resAction := data.ModerationActionNone
+	var matched []string
+	for _, rule := range localRules {
+		// Skip over unconfigured rules
+		value := config[rule.name]
+		if value == "" {
+			continue
+		}
+
+		// Check the rule. A failing rule is considered not matching
+		if b, err := rule.check(value, ctx); err != nil {
+			logger.Warningf("localRulesScanner.Scan: rule %q failed for domain %s: %v", rule.name, &ctx.Domain.ID, err)
+
+		} else if b {
+			matched = append(matched, rule.name)
+			if action := localRuleAction(config[rule.name+".action"]); action.Outweighs(resAction) {
+				resAction = action
+			}
+		}
+	}
+
+	// No rule matched
+	if len(matched) == 0 {
+		return data.ModerationActionNone, "", nil
+	}
+	return resAction, "Matched local rules: " + strings.Join(matched, ", "), nil
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+
+// localRuleAction parses the given rule action value, defaulting to ModerationActionPending
+func localRuleAction(s string) data.ModerationAction {
+	switch a := data.ModerationAction(s); a {
+	case data.ModerationActionFlag, data.ModerationActionPending, data.ModerationActionReject:
+		return a
+	}
+	return data.ModerationActionPending
+}
+
+// localRuleBlockedWords checks whether the comment contains any word from the given comma-separated list, ignoring the
+// case
+func localRuleBlockedWords(value string, ctx *commentScanningContext) (bool, error) {
+	// Make a set of blocked words
+	blocked := make(map[string]bool)
+	for _, w := range strings.Split(value, ",") {
+		if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+			blocked[w] = true
+		}
+	}
+
+	// Split the text into words and check each of them
+	words := strings.FieldsFunc(
+		strings.ToLower(ctx.Comment.Markdown),
+		func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	for _, w := range words {
+		if blocked[w] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// localRuleBlockedRegex checks whether the comment text matches the given regular expression
+func localRuleBlockedRegex(value string, ctx *commentScanningContext) (bool, error) {
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(ctx.Comment.Markdown), nil
+}
+
+// localRuleLanguages checks whether the comment is written in a script that doesn't belong to any of the given
+// comma-separated languages
+func localRuleLanguages(value string, ctx *commentScanningContext) (bool, error) {
+	// Collect scripts of the allowed languages
+	allowed := make(map[string]bool)
+	for _, lang := range strings.Split(value, ",") {
+		if lang = strings.ToLower(strings.TrimSpace(lang)); lang != "" {
+			if scripts, ok := localRuleLangScripts[lang]; ok {
+				for _, sc := range scripts {
+					allowed[sc] = true
+				}
+			} else {
+				allowed["Latin"] = true
+			}
+		}
+	}
+
+	// Determine the script most of the text is written in. Texts without letters are fine
+	sc := util.MainScript(ctx.Comment.Markdown)
+	return sc != "" && !allowed[sc], nil
+}
+
+// localRuleMaxCapsRatio checks whether the share of upper-case letters in the comment exceeds the given value
+func localRuleMaxCapsRatio(value string, ctx *commentScanningContext) (bool, error) {
+	ratio, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return false, err
+	}
+
+	// Don't bother with short texts
+	letters := 0
+	for _, r := range ctx.Comment.Markdown {
+		if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+	if letters < localRuleMinCapsLetters {
+		return false, nil
+	}
+	return util.UpperCaseRatio(ctx.Comment.Markdown) > ratio, nil
+}
+
+// localRuleMaxLinks checks whether the number of links in the comment exceeds the given value
+func localRuleMaxLinks(value string, ctx *commentScanningContext) (bool, error) {
+	maxLinks, err := localRuleParseCount(value)
+	if err != nil {
+		return false, err
+	}
+	return strings.Count(strings.ToLower(ctx.Comment.HTML), "<a ") > maxLinks, nil
+}
+
+// localRuleMaxPerIPPerHour checks whether the number of comments submitted from the comment author's IP address on the
+// domain during the last hour reaches the given value. Only applies to new comments
+func localRuleMaxPerIPPerHour(value string, ctx *commentScanningContext) (bool, error) {
+	maxCount, err := localRuleParseCount(value)
+	if err != nil || ctx.IsEdit || ctx.Comment.AuthorIPHash == "" {
+		return false, err
+	}
+	cnt, err := TheCommentService.CountCreatedSince(
+		&ctx.Domain.ID, nil, nil, ctx.Comment.AuthorIPHash, time.Now().UTC().Add(-time.Hour))
+	if err != nil {
+		return false, err
+	}
+	return cnt >= int64(maxCount), nil
+}
+
+// localRuleMaxPerUserPerHour checks whether the number of comments submitted by the comment author on the domain
+// during the last hour reaches the given value. Only applies to new comments by registered users
+func localRuleMaxPerUserPerHour(value string, ctx *commentScanningContext) (bool, error) {
+	maxCount, err := localRuleParseCount(value)
+	if err != nil || ctx.IsEdit || ctx.User.IsAnonymous() {
+		return false, err
+	}
+	cnt, err := TheCommentService.CountCreatedSince(
+		&ctx.Domain.ID, nil, &ctx.User.ID, "", time.Now().UTC().Add(-time.Hour))
+	if err != nil {
+		return false, err
+	}
+	return cnt >= int64(maxCount), nil
+}
+
+// localRuleMaxRepeatedChars checks whether the comment contains a sequence of identical characters longer than the
+// given value
+func localRuleMaxRepeatedChars(value string, ctx *commentScanningContext) (bool, error) {
+	maxRun, err := localRuleParseCount(value)
+	if err != nil {
+		return false, err
+	}
+	return util.LongestRuneRun(ctx.Comment.Markdown) > maxRun, nil
+}
+
+// localRuleParseCount parses the given non-negative integer rule value
+func localRuleParseCount(value string) (int, error) {
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	} else if i < 0 {
+		return 0, fmt.Errorf("value must not be negative, got %d", i)
+	}
+	return i, nil
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"gitlab.com/comentario/comentario/extend/plugin"
 	"gitlab.com/comentario/comentario/internal/api/models"
 	"gitlab.com/comentario/comentario/internal/config"
 	"gitlab.com/comentario/comentario/internal/data"
@@ -12,6 +13,7 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -20,6 +22,9 @@ import (
 // ThePerlustrationService is a global PerlustrationService implementation
 var ThePerlustrationService PerlustrationService = &perlustrationService{}
 
+// reDomainExtensionID is a regular expression that validates a domain extension ID
+var reDomainExtensionID = regexp.MustCompile(`^[a-zA-Z][-a-zA-Z0-9_.]{0,31}$`)
+
 // commentScanningContext is a context for scanning a comment
 type commentScanningContext struct {
 	Request    *http.Request    // HTTP request sent by the commenter
@@ -37,8 +42,9 @@ type CommentScanner interface {
 	ID() models.DomainExtensionID
 	// KeyProvided returns whether an API key was globally provided for this domain extension
 	KeyProvided() bool
-	// Scan scans the provided comment for inappropriate content and returns whether it was found, and a reason for that
-	Scan(config map[string]string, ctx *commentScanningContext) (bool, string, error)
+	// Scan scans the provided comment for inappropriate content and returns the action to be taken on the comment
+	// (ModerationActionNone if nothing was found), and a reason for that
+	Scan(config map[string]string, ctx *commentScanningContext) (data.ModerationAction, string, error)
 }
 
 // PerlustrationService is a collection of CommentScanners that allows to scan comments against those of them enabled
@@ -46,10 +52,11 @@ type CommentScanner interface {
 type PerlustrationService interface {
 	// Init the service
 	Init()
-	// NeedsModeration returns whether the given comment needs to be moderated, and if so, the reason for that
+	// NeedsModeration returns the moderation action to be taken on the given comment (ModerationActionNone if the
+	// comment can be approved right away), and the reason for that
 	NeedsModeration(
 		req *http.Request, comment *data.Comment, domain *data.Domain, page *data.DomainPage, user *data.User,
-		domainUser *data.DomainUser, isEdit bool) (bool, string, error)
+		domainUser *data.DomainUser, isEdit bool) (data.ModerationAction, string, error)
 }
 
 //----------------------------------------------------------------------------------------------------------------------
@@ -60,6 +67,12 @@ type perlustrationService struct {
 }
 
 func (svc *perlustrationService) Init() {
+	// Local rules go first as they're cheap to check
+	if !config.SecretsConfig.Extensions.LocalRules.Disable {
+		logger.Info("Registering Local rules extension")
+		svc.scanners = append(svc.scanners, &localRulesScanner{})
+	}
+
 	// Akismet
 	ak := config.SecretsConfig.Extensions.Akismet
 	if !ak.Disable {
@@ -81,6 +94,13 @@ func (svc *perlustrationService) Init() {
 		svc.scanners = append(svc.scanners, &apiLayerSpamCheckerScanner{apiScanner{apiKey: asck.Key}})
 	}
 
+	// Scanners provided by plugins
+	for pluginID, cfg := range ThePluginManager.PluginConfigs() {
+		for _, ps := range cfg.Scanners {
+			svc.registerPluginScanner(pluginID, ps)
+		}
+	}
+
 	// Enable/update corresponding extensions in the config
 	for _, scanner := range svc.scanners {
 		x := data.DomainExtensions[scanner.ID()]
@@ -91,11 +111,11 @@ func (svc *perlustrationService) Init() {
 
 func (svc *perlustrationService) NeedsModeration(
 	req *http.Request, comment *data.Comment, domain *data.Domain, page *data.DomainPage, user *data.User,
-	domainUser *data.DomainUser, isEdit bool) (bool, string, error) {
+	domainUser *data.DomainUser, isEdit bool) (data.ModerationAction, string, error) {
 
 	// Comments by superusers, owners, and moderators are always pre-approved
 	if user.IsSuperuser || domainUser.CanModerate() {
-		return false, "", nil
+		return data.ModerationActionNone, "", nil
 	}
 
 	// If it's a new comment, check domain moderation policy
@@ -105,28 +125,28 @@ func (svc *perlustrationService) NeedsModeration(
 		case false:
 			// If all authenticated are to be approved
 			if domain.ModAuthenticated {
-				return true, "Domain policy requires moderation on comments by authenticated users", nil
+				return data.ModerationActionPending, "Domain policy requires moderation on comments by authenticated users", nil
 			}
 
 			// If the user was created less than the required number of days ago
 			if age := domainUser.AgeInDays(); age < domain.ModUserAgeDays {
-				return true, fmt.Sprintf("User is created %d days ago (domain policy requires at least %d)", age, domain.ModUserAgeDays), nil
+				return data.ModerationActionPending, fmt.Sprintf("User is created %d days ago (domain policy requires at least %d)", age, domain.ModUserAgeDays), nil
 			}
 
 			// If there's a number of comments specified for the domain
 			if domain.ModNumComments > 0 {
 				// Verify the user has the required number of approved comments
 				if cnt, err := TheCommentService.Count(user, domainUser, &domain.ID, nil, &user.ID, true, false, false, false); err != nil {
-					return false, "", err
+					return data.ModerationActionNone, "", err
 				} else if cnt < int64(domain.ModNumComments) {
-					return true, fmt.Sprintf("User has %d approved comments (domain policy requires at least %d)", cnt, domain.ModNumComments), nil
+					return data.ModerationActionPending, fmt.Sprintf("User has %d approved comments (domain policy requires at least %d)", cnt, domain.ModNumComments), nil
 				}
 			}
 
 		// Anonymous user
 		case true:
 			if domain.ModAnonymous {
-				return true, "Domain policy requires moderation on comments by unregistered users", nil
+				return data.ModerationActionPending, "Domain policy requires moderation on comments by unregistered users", nil
 			}
 		}
 	}
@@ -134,9 +154,9 @@ func (svc *perlustrationService) NeedsModeration(
 	// Check link/image moderation policy
 	html := strings.ToLower(comment.HTML)
 	if domain.ModLinks && strings.Contains(html, "<a") {
-		return true, "Comment contains a link", nil
+		return data.ModerationActionPending, "Comment contains a link", nil
 	} else if domain.ModImages && strings.Contains(html, "<img") {
-		return true, "Comment contains an image", nil
+		return data.ModerationActionPending, "Comment contains an image", nil
 	}
 
 	// Test the comment against online checkers
@@ -149,25 +169,52 @@ func (svc *perlustrationService) NeedsModeration(
 		DomainUser: domainUser,
 		IsEdit:     isEdit,
 	}
-	if b, reason, err := svc.scan(ctx); b && err == nil {
+	if action, reason, err := svc.scan(ctx); action != data.ModerationActionNone && err == nil {
 		// Don't consider inappropriate if an error occurred
-		return true, reason, nil
+		return action, reason, nil
 	}
 
 	// No need to moderate
-	return false, "", nil
+	return data.ModerationActionNone, "", nil
 }
 
-// Scan scans the provided comment for inappropriate content and returns whether it was found
-func (svc *perlustrationService) scan(ctx *commentScanningContext) (bool, string, error) {
+// registerPluginScanner validates and registers a comment scanner provided by the plugin with the given ID, adding a
+// new domain extension for it
+func (svc *perlustrationService) registerPluginScanner(pluginID string, ps plugin.CommentScanner) {
+	id := models.DomainExtensionID(ps.ID())
+
+	// Validate the scanner's ID
+	if !reDomainExtensionID.MatchString(string(id)) {
+		logger.Warningf("Plugin %q provided comment scanner with invalid ID %q, ignoring", pluginID, id)
+		return
+	} else if _, ok := data.DomainExtensions[id]; ok {
+		logger.Warningf("Plugin %q provided comment scanner with duplicate ID %q, ignoring", pluginID, id)
+		return
+	}
+
+	// Register a new domain extension and the scanner
+	logger.Infof("Registering extension %q provided by plugin %q", id, pluginID)
+	data.DomainExtensions[id] = &data.DomainExtension{
+		ID:          id,
+		Name:        ps.Name(),
+		Config:      strings.TrimSpace(ps.DefaultConfig()),
+		KeyRequired: ps.KeyRequired(),
+	}
+	svc.scanners = append(svc.scanners, &pluginScanner{s: ps})
+}
+
+// Scan scans the provided comment for inappropriate content and returns the most severe action reported by scanners,
+// and the reason for that
+func (svc *perlustrationService) scan(ctx *commentScanningContext) (data.ModerationAction, string, error) {
 	// Fetch domain extensions
 	extensions, err := TheDomainService.ListDomainExtensions(&ctx.Domain.ID)
 	if err != nil {
-		return false, "", err
+		return data.ModerationActionNone, "", err
 	}
 
 	// Iterate known comment scanners
 	var lastErr error
+	resAction, resReason := data.ModerationActionNone, ""
 	for _, cs := range svc.scanners {
 		// Check if the scanner is enabled for the domain by searching for the corresponding extension
 		var ex *data.DomainExtension
@@ -180,17 +227,58 @@ func (svc *perlustrationService) scan(ctx *commentScanningContext) (bool, string
 
 		// Scan and skip over a failed scanner
 		if ex != nil {
-			if b, reason, err := cs.Scan(ex.ConfigParams(), ctx); err != nil {
+			if action, reason, err := cs.Scan(ex.ConfigParams(), ctx); err != nil {
 				lastErr = err
-			} else if b {
-				// Exit on a first positive
-				return true, reason, nil
+			} else if action == data.ModerationActionReject {
+				// Exit on a first rejection as nothing can outweigh it
+				return action, reason, nil
+			} else if action.Outweighs(resAction) {
+				// Remember the most severe action so far and carry on with the other scanners
+				resAction, resReason = action, reason
 			}
 		}
 	}
 
+	// Return the most severe action, if any
+	if resAction != data.ModerationActionNone {
+		return resAction, resReason, nil
+	}
+
 	// Return a (tentative) negative and any occurred error
-	return false, "", lastErr
+	return data.ModerationActionNone, "", lastErr
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+
+// pluginScanner is a CommentScanner that delegates comment content checking to a scanner provided by a plugin
+type pluginScanner struct {
+	s plugin.CommentScanner
+}
+
+func (s *pluginScanner) ID() models.DomainExtensionID {
+	return models.DomainExtensionID(s.s.ID())
+}
+
+func (s *pluginScanner) KeyProvided() bool {
+	// Plugin scanners manage their global keys on their own
+	return false
+}
+
+func (s *pluginScanner) Scan(config map[string]string, ctx *commentScanningContext) (data.ModerationAction, string, error) {
+	b, reason, err := s.s.Scan(config, &plugin.CommentScanContext{
+		Request: ctx.Request,
+		Comment: ctx.Comment.ToPluginComment(),
+		Domain:  ctx.Domain.ToPluginDomain(),
+		Page:    ctx.Page.ToPluginDomainPage(),
+		User:    ctx.User.ToPluginUser(),
+		IsEdit:  ctx.IsEdit,
+	})
+	if err != nil || !b {
+		return data.ModerationActionNone, "", err
+	}
+
+	// A positive result from a plugin scanner requires moderator's approval
+	return data.ModerationActionPending, reason, nil
 }
 
 //----------------------------------------------------------------------------------------------------------------------
@@ -212,17 +300,17 @@ type akismetScanner struct {
 }
 
 func (s *akismetScanner) ID() models.DomainExtensionID {
-	return models.DomainExtensionIDAkismet
+	return data.DomainExtensionIDAkismet
 }
 
-func (s *akismetScanner) Scan(config map[string]string, ctx *commentScanningContext) (bool, string, error) {
+func (s *akismetScanner) Scan(config map[string]string, ctx *commentScanningContext) (data.ModerationAction, string, error) {
 	// Check if the service is usable: the locally configured API key takes precedence
 	apiKey := config["apiKey"]
 	if apiKey == "" {
 		apiKey = s.apiKey
 	}
 	if apiKey == "" {
-		return false, "", errors.New("no Akismet API key configured")
+		return data.ModerationActionNone, "", errors.New("no Akismet API key configured")
 	}
 
 	// Prepare a request
@@ -251,31 +339,31 @@ func (s *akismetScanner) Scan(config map[string]string, ctx *commentScanningCont
 	logger.Debugf("Submitting comment to Akismet: %s", dataStr)
 	rq, err := http.NewRequest("POST", "https://rest.akismet.com/1.1/comment-check", strings.NewReader(dataStr))
 	if err != nil {
-		return false, "", err
+		return data.ModerationActionNone, "", err
 	}
 	rq.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 	rq.Header.Add("Content-Length", strconv.Itoa(len(dataStr)))
 	resp, err := client.Do(rq)
 	if err != nil {
-		return false, "", err
+		return data.ModerationActionNone, "", err
 	}
 	defer util.LogError(resp.Body.Close, "akismetScanner.Scan, resp.Body.Close()")
 
 	// Fetch the response
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return false, "", err
+		return data.ModerationActionNone, "", err
 	}
 	logger.Debugf("Akismet response: %s", respBody)
 
 	// Check the content
 	switch string(respBody) {
 	case "true":
-		return true, "Akismet identified the comment as spam", nil
+		return data.ModerationActionPending, "Akismet identified the comment as spam", nil
 	case "false":
-		return false, "", nil
+		return data.ModerationActionNone, "", nil
 	}
-	return false, "", fmt.Errorf("failed to call Akismet API: %s", respBody)
+	return data.ModerationActionNone, "", fmt.Errorf("failed to call Akismet API: %s", respBody)
 }
 
 //----------------------------------------------------------------------------------------------------------------------
@@ -303,17 +391,17 @@ type perspectiveResponse struct {
 }
 
 func (s *perspectiveScanner) ID() models.DomainExtensionID {
-	return models.DomainExtensionIDPerspective
+	return data.DomainExtensionIDPerspective
 }
 
-func (s *perspectiveScanner) Scan(config map[string]string, ctx *commentScanningContext) (bool, string, error) {
+func (s *perspectiveScanner) Scan(config map[string]string, ctx *commentScanningContext) (data.ModerationAction, string, error) {
 	// Check if the service is usable: the locally configured API key takes precedence
 	apiKey := config["apiKey"]
 	if apiKey == "" {
 		apiKey = s.apiKey
 	}
 	if apiKey == "" {
-		return false, "", errors.New("no Perspective API key configured")
+		return data.ModerationActionNone, "", errors.New("no Perspective API key configured")
 	}
 
 	// Identify requested attributes
@@ -347,7 +435,7 @@ func (s *perspectiveScanner) Scan(config map[string]string, ctx *commentScanning
 
 	// If there are no attributes, it makes no sense to send the request
 	if len(attrs) == 0 {
-		return false, "", nil
+		return data.ModerationActionNone, "", nil
 	}
 
 	// Prepare a request
@@ -356,7 +444,7 @@ func (s *perspectiveScanner) Scan(config map[string]string, ctx *commentScanning
 		"requestedAttributes": attrs,
 	})
 	if err != nil {
-		return false, "", err
+		return data.ModerationActionNone, "", err
 	}
 
 	// Submit a request to Perspective
@@ -366,50 +454,50 @@ func (s *perspectiveScanner) Scan(config map[string]string, ctx *commentScanning
 		fmt.Sprintf("https://commentanalyzer.googleapis.com/v1alpha1/comments:analyze?key=%s", apiKey),
 		bytes.NewReader(d))
 	if err != nil {
-		return false, "", err
+		return data.ModerationActionNone, "", err
 	}
 	rq.Header.Add("Content-Type", "application/json")
 
 	// Fetch the response
 	resp, err := client.Do(rq)
 	if err != nil {
-		return false, "", err
+		return data.ModerationActionNone, "", err
 	}
 	defer util.LogError(resp.Body.Close, "perspectiveScanner.Scan, resp.Body.Close()")
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return false, "", err
+		return data.ModerationActionNone, "", err
 	}
 	logger.Debugf("Perspective response: %s", body)
 
 	// Unmarshal the response
 	var result perspectiveResponse
 	if err := json.Unmarshal(body, &result); err != nil {
-		return false, "", err
+		return data.ModerationActionNone, "", err
 	}
 
 	// Check the scores. Those not returned will be set to 0
 	if v := result.AttributeScores.Toxicity.SummaryScore.Value; v > toxicity {
-		return true, fmt.Sprintf("Perspective toxicity threshold (%v) exceeded (actual value %v)", toxicity, v), nil
+		return data.ModerationActionPending, fmt.Sprintf("Perspective toxicity threshold (%v) exceeded (actual value %v)", toxicity, v), nil
 	}
 	if v := result.AttributeScores.SevereToxicity.SummaryScore.Value; v > severeToxicity {
-		return true, fmt.Sprintf("Perspective severeToxicity threshold (%v) exceeded (actual value %v)", severeToxicity, v), nil
+		return data.ModerationActionPending, fmt.Sprintf("Perspective severeToxicity threshold (%v) exceeded (actual value %v)", severeToxicity, v), nil
 	}
 	if v := result.AttributeScores.IdentityAttack.SummaryScore.Value; v > identityAttack {
-		return true, fmt.Sprintf("Perspective identityAttack threshold (%v) exceeded (actual value %v)", identityAttack, v), nil
+		return data.ModerationActionPending, fmt.Sprintf("Perspective identityAttack threshold (%v) exceeded (actual value %v)", identityAttack, v), nil
 	}
 	if v := result.AttributeScores.Insult.SummaryScore.Value; v > insult {
-		return true, fmt.Sprintf("Perspective insult threshold (%v) exceeded (actual value %v)", insult, v), nil
+		return data.ModerationActionPending, fmt.Sprintf("Perspective insult threshold (%v) exceeded (actual value %v)", insult, v), nil
 	}
 	if v := result.AttributeScores.Profanity.SummaryScore.Value; v > profanity {
-		return true, fmt.Sprintf("Perspective profanity threshold (%v) exceeded (actual value %v)", profanity, v), nil
+		return data.ModerationActionPending, fmt.Sprintf("Perspective profanity threshold (%v) exceeded (actual value %v)", profanity, v), nil
 	}
 	if v := result.AttributeScores.Threat.SummaryScore.Value; v > threat {
-		return true, fmt.Sprintf("Perspective threat threshold (%v) exceeded (actual value %v)", threat, v), nil
+		return data.ModerationActionPending, fmt.Sprintf("Perspective threat threshold (%v) exceeded (actual value %v)", threat, v), nil
 	}
 
 	// Succeeded
-	return false, "", nil
+	return data.ModerationActionNone, "", nil
 }
 
 //----------------------------------------------------------------------------------------------------------------------
@@ -427,17 +515,17 @@ type apiLayerSpamCheckerResponse struct {
 }
 
 func (s *apiLayerSpamCheckerScanner) ID() models.DomainExtensionID {
-	return models.DomainExtensionIDAPILayerDotSpamChecker
+	return data.DomainExtensionIDAPILayerDotSpamChecker
 }
 
-func (s *apiLayerSpamCheckerScanner) Scan(config map[string]string, ctx *commentScanningContext) (bool, string, error) {
+func (s *apiLayerSpamCheckerScanner) Scan(config map[string]string, ctx *commentScanningContext) (data.ModerationAction, string, error) {
 	// Check if the service is usable: the locally configured API key takes precedence
 	apiKey := config["apiKey"]
 	if apiKey == "" {
 		apiKey = s.apiKey
 	}
 	if apiKey == "" {
-		return false, "", errors.New("no APILayer SpamChecker API key configured")
+		return data.ModerationActionNone, "", errors.New("no APILayer SpamChecker API key configured")
 	}
 
 	// Submit a request to the APILayer
@@ -447,33 +535,33 @@ func (s *apiLayerSpamCheckerScanner) Scan(config map[string]string, ctx *comment
 		fmt.Sprintf("https://api.apilayer.com/spamchecker?threshold=%s", config["threshold"]),
 		strings.NewReader(ctx.Comment.Markdown))
 	if err != nil {
-		return false, "", err
+		return data.ModerationActionNone, "", err
 	}
 	rq.Header.Set("apikey", apiKey)
 
 	// Fetch the response
 	resp, err := client.Do(rq)
 	if err != nil {
-		return false, "", err
+		return data.ModerationActionNone, "", err
 	}
 	defer util.LogError(resp.Body.Close, "apiLayerSpamCheckerScanner.Scan, resp.Body.Close()")
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return false, "", err
+		return data.ModerationActionNone, "", err
 	}
 	logger.Debugf("APILayer SpamChecker response: %s", body)
 
 	// Unmarshal the response
 	var result apiLayerSpamCheckerResponse
 	if err := json.Unmarshal(body, &result); err != nil {
-		return false, "", err
+		return data.ModerationActionNone, "", err
 	}
 
 	// If it's spam
 	if result.IsSpam {
-		return true, "APILayer SpamChecker returned: " + result.Result, nil
+		return data.ModerationActionPending, "APILayer SpamChecker returned: " + result.Result, nil
 	}
 
 	// Succeeded
-	return false, "", nil
+	return data.ModerationActionNone, "", nil
 }
@@ -0,0 +1,104 @@
+package svc
+
+import (
+	"github.com/doug-martin/goqu/v9"
+	"github.com/google/uuid"
+	"gitlab.com/comentario/comentario/internal/data"
+)
+
+// ThePersonalTokenService is a global PersonalTokenService implementation
+var ThePersonalTokenService PersonalTokenService = &personalTokenService{}
+
+// PersonalTokenService is a service interface for dealing with personal tokens
+type PersonalTokenService interface {
+	// Create persists a new personal token
+	Create(t *data.PersonalToken) error
+	// Delete deletes the personal token with the given ID, owned by the given user
+	Delete(userID, id *uuid.UUID) error
+	// FindByValue finds and returns a personal token by its (string) value
+	FindByValue(s string) (*data.PersonalToken, error)
+	// ListByUser fetches and returns all personal tokens owned by the given user
+	ListByUser(userID *uuid.UUID) ([]*data.PersonalToken, error)
+	// MarkUsed registers the given personal token has just been used
+	MarkUsed(t *data.PersonalToken) error
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+
+// personalTokenService is a blueprint PersonalTokenService implementation
+type personalTokenService struct{}
+
+func (svc *personalTokenService) Create(t *data.PersonalToken) error {
+	logger.Debugf("personalTokenService.Create(%s, %q, %q, %q)", &t.UserID, t.Name, t.Scopes, t.DomainIDs)
+
+	// Insert a new record
+	if err := db.ExecOne(db.Insert("cm_personal_tokens").Rows(t)); err != nil {
+		logger.Errorf("personalTokenService.Create: ExecOne() failed: %v", err)
+		return translateDBErrors(err)
+	}
+
+	// Succeeded
+	return nil
+}
+
+func (svc *personalTokenService) Delete(userID, id *uuid.UUID) error {
+	logger.Debugf("personalTokenService.Delete(%s, %s)", userID, id)
+
+	// Delete the record
+	if err := db.ExecOne(db.Delete("cm_personal_tokens").Where(goqu.Ex{"id": id, "user_id": userID})); err != nil {
+		logger.Errorf("personalTokenService.Delete: ExecOne() failed: %v", err)
+		return translateDBErrors(err)
+	}
+
+	// Succeeded
+	return nil
+}
+
+func (svc *personalTokenService) FindByValue(s string) (*data.PersonalToken, error) {
+	// Don't log the value, as the token is long-lived
+	logger.Debug("personalTokenService.FindByValue(...)")
+
+	// Query the token by the value's hash
+	var t data.PersonalToken
+	if b, err := db.From("cm_personal_tokens").Where(goqu.Ex{"value_hash": data.PersonalTokenHash(s)}).ScanStruct(&t); err != nil {
+		logger.Errorf("personalTokenService.FindByValue: ScanStruct() failed: %v", err)
+		return nil, translateDBErrors(err)
+	} else if !b {
+		return nil, ErrBadToken
+	}
+
+	// Succeeded
+	return &t, nil
+}
+
+func (svc *personalTokenService) ListByUser(userID *uuid.UUID) ([]*data.PersonalToken, error) {
+	logger.Debugf("personalTokenService.ListByUser(%s)", userID)
+
+	// Query the tokens
+	var res []*data.PersonalToken
+	err := db.From("cm_personal_tokens").
+		Where(goqu.Ex{"user_id": userID}).
+		Order(goqu.I("ts_created").Asc()).
+		ScanStructs(&res)
+	if err != nil {
+		logger.Errorf("personalTokenService.ListByUser: ScanStructs() failed: %v", err)
+		return nil, translateDBErrors(err)
+	}
+
+	// Succeeded
+	return res, nil
+}
+
+func (svc *personalTokenService) MarkUsed(t *data.PersonalToken) error {
+	logger.Debugf("personalTokenService.MarkUsed(%s)", &t.ID)
+
+	// Update the last used time
+	t.LastUsedTime = data.NowNullable()
+	if err := db.ExecOne(db.Update("cm_personal_tokens").Set(goqu.Record{"ts_last_used": t.LastUsedTime}).Where(goqu.Ex{"id": &t.ID})); err != nil {
+		logger.Errorf("personalTokenService.MarkUsed: ExecOne() failed: %v", err)
+		return translateDBErrors(err)
+	}
+
+	// Succeeded
+	return nil
+}
@@ -125,6 +125,10 @@ func (c *pluginConnector) DomainAttrStore() cplugin.AttrStore {
 	return c.domainAttrStore
 }
 
+func (c *pluginConnector) DomainStore() cplugin.DomainStore {
+	return &domainStore{}
+}
+
 func (c *pluginConnector) UserAttrStore() cplugin.AttrStore {
 	return c.userAttrStore
 }
@@ -178,6 +182,27 @@ func (as *pluginAttrStore) Set(ownerID *uuid.UUID, attr cplugin.AttrValues) erro
 
 //----------------------------------------------------------------------------------------------------------------------
 
+// domainStore is an implementation of plugin.DomainStore
+type domainStore struct{}
+
+func (ds *domainStore) FindDomainByHost(host string) (*cplugin.Domain, error) {
+	if d, err := TheDomainService.FindByHost(host); err != nil {
+		return nil, err
+	} else {
+		return d.ToPluginDomain(), nil
+	}
+}
+
+func (ds *domainStore) FindDomainByID(id *uuid.UUID) (*cplugin.Domain, error) {
+	if d, err := TheDomainService.FindByID(id); err != nil {
+		return nil, err
+	} else {
+		return d.ToPluginDomain(), nil
+	}
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+
 // userStore is an implementation of plugin.UserStore
 type userStore struct{}
 
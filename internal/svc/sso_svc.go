@@ -0,0 +1,216 @@
+package svc
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/util"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TheSSOService is a global SSOService implementation
+var TheSSOService SSOService = &ssoService{
+	jwks:     map[string]*ssoJWKS{},
+	fetching: map[string]*ssoJWKSFetch{},
+}
+
+// ssoJWKSClient is the HTTP client used for fetching JWKS documents
+var ssoJWKSClient = newPublicHTTPClient(util.SSOJWKSFetchTimeout)
+
+// SSOService is a service interface for dealing with domain SSO payloads
+type SSOService interface {
+	// ParseJWT verifies the given JWT issued by the SSO provider of the specified domain and returns its claims.
+	// HS256-signed tokens are verified using the domain's SSO secret, RS256 and ES256 ones using the domain's JWKS
+	ParseJWT(domain *data.Domain, s string) (*SSOClaims, error)
+}
+
+// SSOClaims holds the claims of a JWT issued by a domain SSO provider
+type SSOClaims struct {
+	jwt.RegisteredClaims
+	Token   string         `json:"token"`   // Value of the anonymous token the authentication was initiated with
+	Email   string         `json:"email"`   // User's email
+	Name    string         `json:"name"`    // User's name
+	Website string         `json:"website"` // Optional user's website URL
+	Avatar  string         `json:"avatar"`  // Optional user's avatar URL
+	Picture string         `json:"picture"` // Optional user's avatar URL, as per the OIDC standard claims, used if no Avatar is given
+	Role    string         `json:"role"`    // Optional user's role on the domain
+	Raw     map[string]any `json:"-"`       // All claims of the token
+}
+
+// AvatarURL returns the user's avatar URL, if any
+func (c *SSOClaims) AvatarURL() string {
+	if c.Avatar != "" {
+		return c.Avatar
+	}
+	return c.Picture
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+
+// ssoJWKS is a cached JWKS document
+type ssoJWKS struct {
+	keys      map[string]crypto.PublicKey // Public keys mapped by key ID
+	fetchedAt time.Time                   // When the document was fetched
+}
+
+// ssoJWKSFetch is an ongoing JWKS document fetch, which concurrent requests for the same document wait for
+type ssoJWKSFetch struct {
+	done chan struct{}               // Closed once the fetch is complete
+	keys map[string]crypto.PublicKey // Fetched public keys, valid once done
+	err  error                       // Fetch error, valid once done
+}
+
+// ssoService is a blueprint SSOService implementation
+type ssoService struct {
+	jwks     map[string]*ssoJWKS      // Cached JWKS documents mapped by URL
+	fetching map[string]*ssoJWKSFetch // Ongoing JWKS fetches mapped by URL
+	jwksMu   sync.Mutex               // Mutex for jwks and fetching
+}
+
+func (svc *ssoService) ParseJWT(domain *data.Domain, s string) (*SSOClaims, error) {
+	logger.Debugf("ssoService.ParseJWT(%s, ...)", &domain.ID)
+
+	claims := &SSOClaims{}
+	_, err := jwt.ParseWithClaims(
+		s,
+		claims,
+		func(t *jwt.Token) (any, error) {
+			// Symmetric signature: use the domain's SSO secret
+			if t.Method == jwt.SigningMethodHS256 {
+				if sec, err := domain.SSOSecretBytes(); err != nil {
+					return nil, err
+				} else if sec == nil {
+					return nil, errors.New("domain SSO secret isn't configured")
+				} else {
+					return sec, nil
+				}
+			}
+
+			// Asymmetric signature: look the key up in the domain's JWKS
+			if domain.SSOJWKSURL == "" {
+				return nil, errors.New("domain SSO JWKS URL isn't configured")
+			}
+			kid, _ := t.Header["kid"].(string)
+			return svc.jwksKey(domain.SSOJWKSURL, kid)
+		},
+		jwt.WithValidMethods([]string{
+			jwt.SigningMethodHS256.Alg(),
+			jwt.SigningMethodRS256.Alg(),
+			jwt.SigningMethodES256.Alg(),
+		}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(util.SSOJWTLeeway))
+	if err != nil {
+		return nil, err
+	}
+
+	// Also collect all (now verified) claims as a map
+	if _, _, err := jwt.NewParser().ParseUnverified(s, (*jwt.MapClaims)(&claims.Raw)); err != nil {
+		return nil, err
+	}
+
+	// Succeeded
+	return claims, nil
+}
+
+// fetchJWKS downloads and parses the JWKS document at the given URL
+func (svc *ssoService) fetchJWKS(url string) (map[string]crypto.PublicKey, error) {
+	logger.Debugf("ssoService.fetchJWKS(%q)", url)
+
+	resp, err := ssoJWKSClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrResourceFetch, err)
+	}
+	defer util.LogError(resp.Body.Close, "ssoService.fetchJWKS, resp.Body.Close()")
+
+	// Verify the response
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: JWKS request failed with status %d", ErrResourceFetch, resp.StatusCode)
+	}
+
+	// Read and parse the document, limiting its size to 1 MiB
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrResourceFetch, err)
+	}
+	return util.ParseJWKS(b)
+}
+
+// jwksKey returns the public key with the given ID from the JWKS document at the given URL, fetching the document if
+// it isn't cached yet, its cached copy has expired, or it doesn't contain the requested key (which may be a sign of a
+// key rotation). The document is fetched without holding the lock, and only once for concurrent requests
+func (svc *ssoService) jwksKey(url, kid string) (crypto.PublicKey, error) {
+	svc.jwksMu.Lock()
+
+	// Check the cache first
+	if cached := svc.jwks[url]; cached != nil {
+		age := time.Since(cached.fetchedAt)
+		if k, ok := cached.keys[kid]; ok && age < util.SSOJWKSCacheTTL {
+			svc.jwksMu.Unlock()
+			return k, nil
+		}
+
+		// Key not found: prevent hammering the provider with unknown key IDs
+		if age < util.SSOJWKSRefetchInterval {
+			svc.jwksMu.Unlock()
+			return nil, fmt.Errorf("key %q not found in JWKS", kid)
+		}
+	}
+
+	// If the document is already being fetched, wait for that to complete
+	f := svc.fetching[url]
+	if f != nil {
+		svc.jwksMu.Unlock()
+		<-f.done
+
+	} else {
+		// Start a new fetch otherwise
+		f = &ssoJWKSFetch{done: make(chan struct{})}
+		svc.fetching[url] = f
+		svc.jwksMu.Unlock()
+		f.keys, f.err = svc.fetchJWKS(url)
+
+		// Cache the document, if succeeded, and let any waiting requests proceed
+		svc.jwksMu.Lock()
+		delete(svc.fetching, url)
+		if f.err == nil {
+			svc.cacheJWKS(url, f.keys)
+		}
+		svc.jwksMu.Unlock()
+		close(f.done)
+	}
+
+	// Look the key up
+	if f.err != nil {
+		return nil, f.err
+	} else if k, ok := f.keys[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("key %q not found in JWKS", kid)
+}
+
+// cacheJWKS puts the given keys into the JWKS cache. If the cache is full, it drops expired documents, or the oldest one
+// if there are none. Must be called with jwksMu locked
+func (svc *ssoService) cacheJWKS(url string, keys map[string]crypto.PublicKey) {
+	if _, ok := svc.jwks[url]; !ok && len(svc.jwks) >= util.SSOJWKSCacheMaxSize {
+		var oldestURL string
+		var oldest time.Time
+		for u, c := range svc.jwks {
+			if time.Since(c.fetchedAt) >= util.SSOJWKSCacheTTL {
+				delete(svc.jwks, u)
+			} else if oldestURL == "" || c.fetchedAt.Before(oldest) {
+				oldestURL, oldest = u, c.fetchedAt
+			}
+		}
+		if len(svc.jwks) >= util.SSOJWKSCacheMaxSize {
+			delete(svc.jwks, oldestURL)
+		}
+	}
+	svc.jwks[url] = &ssoJWKS{keys: keys, fetchedAt: time.Now()}
+}
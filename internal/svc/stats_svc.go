@@ -1,15 +1,19 @@
 package svc
 
 import (
+	"cmp"
 	"database/sql"
 	"fmt"
 	"github.com/doug-martin/goqu/v9"
+	"github.com/go-openapi/strfmt"
 	"github.com/google/uuid"
 	"gitlab.com/comentario/comentario/internal/api/exmodels"
 	"gitlab.com/comentario/comentario/internal/api/models"
 	"gitlab.com/comentario/comentario/internal/config"
 	"gitlab.com/comentario/comentario/internal/data"
 	"gitlab.com/comentario/comentario/internal/util"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -29,6 +33,10 @@ type StatsService interface {
 	GetDailyDomainUserCounts(isSuperuser bool, userID, domainID *uuid.UUID, numDays int) ([]uint64, error)
 	// GetDailyViewCounts collects and returns a daily statistics for views, optionally limited to a specific domain
 	GetDailyViewCounts(isSuperuser bool, userID, domainID *uuid.UUID, numDays int) ([]uint64, error)
+	// GetModeratorThroughput collects and returns the numbers of comments on the given domain approved, rejected, and
+	// deleted by every moderator over the last numDays days, the most active moderators first. Only the last moderation
+	// action on every comment is taken into account, and actions taken by comment authors themselves are disregarded
+	GetModeratorThroughput(domainID *uuid.UUID, numDays int) ([]*ModeratorThroughput, error)
 	// GetTopPages collects and returns top num performing page items by the given property prop (either "views" or
 	// "comments")
 	GetTopPages(isSuperuser bool, prop string, userID, domainID *uuid.UUID, numDays, num int) ([]*exmodels.PageStatsItem, error)
@@ -174,6 +182,48 @@ func (svc *statsService) GetDailyViewCounts(isSuperuser bool, userID, domainID *
 	return svc.queryDailyStats(q, start, numDays)
 }
 
+func (svc *statsService) GetModeratorThroughput(domainID *uuid.UUID, numDays int) ([]*ModeratorThroughput, error) {
+	logger.Debugf("statsService.GetModeratorThroughput(%s, %d)", domainID, numDays)
+
+	// Calculate the start date
+	_, start := getStatsStartDate(numDays)
+
+	// Query moderation counts, grouped by moderator and outcome
+	var modRecs []*throughputModRecord
+	if err := db.From(goqu.T("cm_comments").As("c")).
+		Select(goqu.I("c.user_moderated").As("user_id"), "c.is_approved", goqu.COUNT("*").As("cnt")).
+		Join(goqu.T("cm_domain_pages").As("p"), goqu.On(goqu.Ex{"p.id": goqu.I("c.page_id")})).
+		Where(
+			goqu.Ex{"p.domain_id": domainID, "c.is_pending": false},
+			goqu.I("c.user_moderated").IsNotNull(),
+			goqu.I("c.ts_moderated").Gte(start),
+			goqu.Or(goqu.I("c.user_created").IsNull(), goqu.I("c.user_moderated").Neq(goqu.I("c.user_created")))).
+		GroupBy("c.user_moderated", "c.is_approved").
+		ScanStructs(&modRecs); err != nil {
+		logger.Errorf("statsService.GetModeratorThroughput: ScanStructs() failed for moderated: %v", err)
+		return nil, translateDBErrors(err)
+	}
+
+	// Query deletion counts, grouped by moderator
+	var delRecs []*throughputDelRecord
+	if err := db.From(goqu.T("cm_comments").As("c")).
+		Select(goqu.I("c.user_deleted").As("user_id"), goqu.COUNT("*").As("cnt")).
+		Join(goqu.T("cm_domain_pages").As("p"), goqu.On(goqu.Ex{"p.id": goqu.I("c.page_id")})).
+		Where(
+			goqu.Ex{"p.domain_id": domainID, "c.is_deleted": true},
+			goqu.I("c.user_deleted").IsNotNull(),
+			goqu.I("c.ts_deleted").Gte(start),
+			goqu.Or(goqu.I("c.user_created").IsNull(), goqu.I("c.user_deleted").Neq(goqu.I("c.user_created")))).
+		GroupBy("c.user_deleted").
+		ScanStructs(&delRecs); err != nil {
+		logger.Errorf("statsService.GetModeratorThroughput: ScanStructs() failed for deleted: %v", err)
+		return nil, translateDBErrors(err)
+	}
+
+	// Succeeded
+	return mergeModeratorThroughput(modRecs, delRecs), nil
+}
+
 func (svc *statsService) GetTopPages(isSuperuser bool, prop string, userID, domainID *uuid.UUID, numDays, num int) ([]*exmodels.PageStatsItem, error) {
 	logger.Debugf("statsService.GetTopPages(%v, %q, %s, %s, %d, %d)", isSuperuser, prop, userID, domainID, numDays, num)
 
@@ -549,6 +599,41 @@ func getStatsStartDate(numDays int) (int, time.Time) {
 	return numDays, time.Now().UTC().Truncate(util.OneDay).AddDate(0, 0, -numDays+1)
 }
 
+// mergeModeratorThroughput combines the moderation and deletion counts per moderator, and returns them sorted by the
+// total number of processed comments, descending, then by user ID for stable ordering
+func mergeModeratorThroughput(modRecs []*throughputModRecord, delRecs []*throughputDelRecord) []*ModeratorThroughput {
+	var res []*ModeratorThroughput
+	m := map[uuid.UUID]*ModeratorThroughput{}
+	get := func(id uuid.UUID) *ModeratorThroughput {
+		t, ok := m[id]
+		if !ok {
+			t = &ModeratorThroughput{UserID: id}
+			m[id] = t
+			res = append(res, t)
+		}
+		return t
+	}
+	for _, r := range modRecs {
+		if t := get(r.UserID); r.IsApproved {
+			t.Approved += r.Count
+		} else {
+			t.Rejected += r.Count
+		}
+	}
+	for _, r := range delRecs {
+		get(r.UserID).Deleted += r.Count
+	}
+
+	// Sort the moderators
+	slices.SortFunc(res, func(a, b *ModeratorThroughput) int {
+		if c := cmp.Compare(b.Total(), a.Total()); c != 0 {
+			return c
+		}
+		return strings.Compare(a.UserID.String(), b.UserID.String())
+	})
+	return res
+}
+
 //----------------------------------------------------------------------------------------------------------------------
 
 // StatsTotals groups total statistical figures
@@ -586,3 +671,41 @@ func (t *StatsTotals) ToDTO() *models.StatsTotals {
 		CountUsersTotal:       t.CountUsersTotal,
 	}
 }
+
+//----------------------------------------------------------------------------------------------------------------------
+
+// ModeratorThroughput groups the numbers of comments processed by a moderator
+type ModeratorThroughput struct {
+	UserID   uuid.UUID // ID of the moderator
+	Approved int64     // Number of comments approved
+	Rejected int64     // Number of comments rejected
+	Deleted  int64     // Number of others' comments deleted
+}
+
+// Total returns the total number of comments processed
+func (t *ModeratorThroughput) Total() int64 {
+	return t.Approved + t.Rejected + t.Deleted
+}
+
+// ToDTO converts the object into an API model
+func (t *ModeratorThroughput) ToDTO() *models.ModeratorThroughput {
+	return &models.ModeratorThroughput{
+		Approved: t.Approved,
+		Deleted:  t.Deleted,
+		Rejected: t.Rejected,
+		UserID:   strfmt.UUID(t.UserID.String()),
+	}
+}
+
+// throughputModRecord holds the number of comments approved or rejected by a moderator
+type throughputModRecord struct {
+	UserID     uuid.UUID `db:"user_id"`
+	IsApproved bool      `db:"is_approved"`
+	Count      int64     `db:"cnt"`
+}
+
+// throughputDelRecord holds the number of comments deleted by a moderator
+type throughputDelRecord struct {
+	UserID uuid.UUID `db:"user_id"`
+	Count  int64     `db:"cnt"`
+}
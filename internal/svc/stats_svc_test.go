@@ -0,0 +1,39 @@
+package svc
+
+import (
+	"github.com/google/uuid"
+	"reflect"
+	"testing"
+)
+
+func Test_mergeModeratorThroughput(t *testing.T) {
+	id1 := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+	id2 := uuid.MustParse("00000000-0000-0000-0000-000000000002")
+	id3 := uuid.MustParse("00000000-0000-0000-0000-000000000003")
+	tests := []struct {
+		name    string
+		modRecs []*throughputModRecord
+		delRecs []*throughputDelRecord
+		want    []*ModeratorThroughput
+	}{
+		{"empty             ", nil, nil, nil},
+		{"approved, rejected", []*throughputModRecord{{id1, true, 3}, {id1, false, 2}}, nil, []*ModeratorThroughput{{UserID: id1, Approved: 3, Rejected: 2}}},
+		{"deleted only      ", nil, []*throughputDelRecord{{id2, 4}}, []*ModeratorThroughput{{UserID: id2, Deleted: 4}}},
+		{"merged            ", []*throughputModRecord{{id1, true, 1}}, []*throughputDelRecord{{id1, 2}}, []*ModeratorThroughput{{UserID: id1, Approved: 1, Deleted: 2}}},
+		{"sorted by total   ",
+			[]*throughputModRecord{{id1, true, 1}, {id2, true, 5}},
+			[]*throughputDelRecord{{id3, 3}},
+			[]*ModeratorThroughput{{UserID: id2, Approved: 5}, {UserID: id3, Deleted: 3}, {UserID: id1, Approved: 1}}},
+		{"ties sorted by ID ",
+			[]*throughputModRecord{{id3, false, 2}, {id1, true, 2}},
+			[]*throughputDelRecord{{id2, 2}},
+			[]*ModeratorThroughput{{UserID: id1, Approved: 2}, {UserID: id2, Deleted: 2}, {UserID: id3, Rejected: 2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeModeratorThroughput(tt.modRecs, tt.delRecs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeModeratorThroughput() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
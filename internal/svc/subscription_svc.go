@@ -0,0 +1,151 @@
+package svc
+
+import (
+	"github.com/doug-martin/goqu/v9"
+	"github.com/google/uuid"
+	"gitlab.com/comentario/comentario/internal/data"
+)
+
+// TheSubscriptionService is a global SubscriptionService implementation
+var TheSubscriptionService SubscriptionService = &subscriptionService{}
+
+// SubscriptionService is a service interface for dealing with page and thread subscriptions
+type SubscriptionService interface {
+	// Create persists a new subscription, unless the user is already subscribed to the same page or thread, in which
+	// case the existing subscription is returned
+	Create(s *data.PageSubscription) (*data.PageSubscription, error)
+	// Delete removes the given user's subscription to the given page or, if threadID isn't nil, thread. Deleting a
+	// non-existent subscription isn't an error
+	Delete(userID, pageID, threadID *uuid.UUID) error
+	// DeleteByDomainUser removes all subscriptions of the given user on the given domain
+	DeleteByDomainUser(domainID, userID *uuid.UUID) error
+	// ListByPageUser fetches and returns all subscriptions of the given user to the given page and its threads
+	ListByPageUser(pageID, userID *uuid.UUID) ([]*data.PageSubscription, error)
+	// ListForComment fetches and returns subscriptions matching the given comment: those to the comment's page and
+	// those to any thread the comment is part of. Returns at most one subscription per user
+	ListForComment(comment *data.Comment) ([]*data.PageSubscription, error)
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+
+// subscriptionService is a blueprint SubscriptionService implementation
+type subscriptionService struct{}
+
+func (svc *subscriptionService) Create(s *data.PageSubscription) (*data.PageSubscription, error) {
+	logger.Debugf("subscriptionService.Create(%s, %s, %v)", &s.PageID, &s.UserID, s.ThreadID)
+
+	// Check whether there's already such a subscription
+	var existing data.PageSubscription
+	if b, err := db.From("cm_page_subscriptions").Where(svc.whereMatches(&s.UserID, &s.PageID, data.NullUUIDPtr(&s.ThreadID))).ScanStruct(&existing); err != nil {
+		logger.Errorf("subscriptionService.Create: ScanStruct() failed: %v", err)
+		return nil, translateDBErrors(err)
+	} else if b {
+		return &existing, nil
+	}
+
+	// Insert a new record
+	if err := db.ExecOne(db.Insert("cm_page_subscriptions").Rows(s)); err != nil {
+		logger.Errorf("subscriptionService.Create: ExecOne() failed: %v", err)
+		return nil, translateDBErrors(err)
+	}
+
+	// Succeeded
+	return s, nil
+}
+
+func (svc *subscriptionService) Delete(userID, pageID, threadID *uuid.UUID) error {
+	logger.Debugf("subscriptionService.Delete(%s, %s, %v)", userID, pageID, threadID)
+
+	// Delete the record(s)
+	if _, err := db.Delete("cm_page_subscriptions").Where(svc.whereMatches(userID, pageID, threadID)).Executor().Exec(); err != nil {
+		logger.Errorf("subscriptionService.Delete: Exec() failed: %v", err)
+		return translateDBErrors(err)
+	}
+
+	// Succeeded
+	return nil
+}
+
+func (svc *subscriptionService) DeleteByDomainUser(domainID, userID *uuid.UUID) error {
+	logger.Debugf("subscriptionService.DeleteByDomainUser(%s, %s)", domainID, userID)
+
+	// Delete the records
+	if _, err := db.Delete("cm_page_subscriptions").Where(goqu.Ex{"domain_id": domainID, "user_id": userID}).Executor().Exec(); err != nil {
+		logger.Errorf("subscriptionService.DeleteByDomainUser: Exec() failed: %v", err)
+		return translateDBErrors(err)
+	}
+
+	// Succeeded
+	return nil
+}
+
+func (svc *subscriptionService) ListByPageUser(pageID, userID *uuid.UUID) ([]*data.PageSubscription, error) {
+	logger.Debugf("subscriptionService.ListByPageUser(%s, %s)", pageID, userID)
+
+	// Query the subscriptions
+	var res []*data.PageSubscription
+	err := db.From("cm_page_subscriptions").
+		Where(goqu.Ex{"page_id": pageID, "user_id": userID}).
+		Order(goqu.I("ts_created").Asc()).
+		ScanStructs(&res)
+	if err != nil {
+		logger.Errorf("subscriptionService.ListByPageUser: ScanStructs() failed: %v", err)
+		return nil, translateDBErrors(err)
+	}
+
+	// Succeeded
+	return res, nil
+}
+
+func (svc *subscriptionService) ListForComment(comment *data.Comment) ([]*data.PageSubscription, error) {
+	logger.Debugf("subscriptionService.ListForComment(%s)", &comment.ID)
+
+	// Collect the IDs of the comment's ancestors, each of which starts a thread the comment is part of
+	var threadIDs []uuid.UUID
+	for parentID := comment.ParentID; parentID.Valid; {
+		threadIDs = append(threadIDs, parentID.UUID)
+		parent, err := TheCommentService.FindByID(&parentID.UUID)
+		if err != nil {
+			return nil, err
+		}
+		parentID = parent.ParentID
+	}
+
+	// Query subscriptions to the page and to the threads
+	cond := goqu.Or(goqu.C("thread_id").IsNull())
+	if len(threadIDs) > 0 {
+		cond = cond.Append(goqu.C("thread_id").In(threadIDs))
+	}
+	var dbRecs []*data.PageSubscription
+	err := db.From("cm_page_subscriptions").
+		Where(goqu.Ex{"page_id": &comment.PageID}, cond).
+		Order(goqu.I("ts_created").Asc()).
+		ScanStructs(&dbRecs)
+	if err != nil {
+		logger.Errorf("subscriptionService.ListForComment: ScanStructs() failed: %v", err)
+		return nil, translateDBErrors(err)
+	}
+
+	// Only keep one subscription per user
+	var res []*data.PageSubscription
+	seen := map[uuid.UUID]bool{}
+	for _, s := range dbRecs {
+		if !seen[s.UserID] {
+			seen[s.UserID] = true
+			res = append(res, s)
+		}
+	}
+
+	// Succeeded
+	return res, nil
+}
+
+// whereMatches returns a filter expression matching the given user's subscription to the given page or, if threadID
+// isn't nil, thread
+func (svc *subscriptionService) whereMatches(userID, pageID, threadID *uuid.UUID) goqu.Ex {
+	ex := goqu.Ex{"user_id": userID, "page_id": pageID, "thread_id": nil}
+	if threadID != nil {
+		ex["thread_id"] = threadID
+	}
+	return ex
+}
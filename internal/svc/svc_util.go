@@ -3,20 +3,28 @@ package svc
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"github.com/op/go-logging"
+	"gitlab.com/comentario/comentario/internal/config"
 	"gitlab.com/comentario/comentario/internal/util"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
 )
 
 // logger represents a package-wide logger instance
 var logger = logging.MustGetLogger("svc")
 
 var (
-	ErrBadToken       = errors.New("services: invalid token")
-	ErrDB             = errors.New("services: database error")
-	ErrCommentTooLong = errors.New("services: comment text too long")
-	ErrEmailSend      = errors.New("services: failed to send email")
-	ErrNotFound       = errors.New("services: object not found")
-	ErrResourceFetch  = errors.New("services: failed to fetch resource")
+	ErrBadToken            = errors.New("services: invalid token")
+	ErrDB                  = errors.New("services: database error")
+	ErrCommentTooLong      = errors.New("services: comment text too long")
+	ErrEmailSend           = errors.New("services: failed to send email")
+	ErrNotFound            = errors.New("services: object not found")
+	ErrPasskeyVerification = errors.New("services: passkey verification failed")
+	ErrResourceFetch       = errors.New("services: failed to fetch resource")
+	ErrTooManyComments     = errors.New("services: too many comments")
 )
 
 // translateDBErrors "translates" database errors into a service error, picking the first non-nil error
@@ -33,3 +41,35 @@ func translateDBErrors(errs ...error) error {
 		return ErrDB
 	}
 }
+
+// newPublicHTTPClient returns a new HTTP client for fetching resources at user-provided URLs. It refuses to connect to
+// non-public addresses (unless in e2e-testing mode), which is checked on every dial because the host may resolve to a
+// different address than it did when the URL was validated, and because of redirects. No proxy is used for the same
+// reason
+func newPublicHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout: timeout,
+				Control: func(_, address string, _ syscall.RawConn) error {
+					if config.ServerConfig.E2e {
+						return nil
+					}
+					host, _, err := net.SplitHostPort(address)
+					if err != nil {
+						return err
+					}
+					if ip := net.ParseIP(host); !util.IsPublicIP(ip) {
+						return fmt.Errorf("connecting to non-public address %s is not allowed", host)
+					}
+					return nil
+				},
+			}).DialContext,
+			ForceAttemptHTTP2:   true,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: timeout,
+		},
+	}
+}
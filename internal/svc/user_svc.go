@@ -66,9 +66,10 @@ type UserService interface {
 	//   - dir is the sort direction.
 	//   - pageIndex is the page index, if negative, no pagination is applied.
 	ListByDomain(domainID *uuid.UUID, superuser bool, filter, sortBy string, dir data.SortDirection, pageIndex int) (map[uuid.UUID]*data.User, []*data.DomainUser, error)
-	// ListDomainModerators fetches and returns a list of moderator users for the domain with the given ID. If
-	// enabledNotifyOnly is true, only includes users who have moderator notifications enabled for that domain
-	ListDomainModerators(domainID *uuid.UUID, enabledNotifyOnly bool) ([]*data.User, error)
+	// ListDomainModerators fetches and returns a list of moderator domain users for the domain with the given ID, and
+	// the corresponding users as a UUID-indexed map. If enabledNotifyOnly is true, only includes users who have
+	// moderator notifications enabled for that domain
+	ListDomainModerators(domainID *uuid.UUID, enabledNotifyOnly bool) (map[uuid.UUID]*data.User, []*data.DomainUser, error)
 	// ListUserSessions returns all sessions of a user, sorted in reverse chronological order
 	//   - userID is ID of the user to fetch sessions for
 	//   - pageIndex is the page index, if negative, no pagination is applied.
@@ -82,6 +83,8 @@ type UserService interface {
 	UpdateBanned(curUserID *uuid.UUID, u *data.User, banned bool) error
 	// UpdateLoginLocked updates the given user's last login and lockout fields in the database
 	UpdateLoginLocked(u *data.User) error
+	// UpdateTOTP updates the given user's two-factor authentication fields in the database
+	UpdateTOTP(u *data.User) error
 }
 
 //----------------------------------------------------------------------------------------------------------------------
@@ -90,7 +93,7 @@ type UserService interface {
 type userService struct{}
 
 func (svc *userService) ConfirmUser(u *data.User) error {
-	logger.Debugf("userService.ConfirmUser(%v)", u)
+	logger.Debugf("userService.ConfirmUser(%s)", &u.ID)
 
 	// User cannot be anonymous
 	if u.IsAnonymous() {
@@ -177,7 +180,7 @@ func (svc *userService) CreateUserSession(s *data.UserSession) error {
 }
 
 func (svc *userService) DeleteUserByID(u *data.User, delComments, purgeComments bool) (int64, error) {
-	logger.Debugf("userService.DeleteUserByID(%v, %v, %v)", u, delComments, purgeComments)
+	logger.Debugf("userService.DeleteUserByID(%s, %v, %v)", &u.ID, delComments, purgeComments)
 
 	// Fire an event (we don't care if anything was changed)
 	if _, err := handleUserEvent(&plugin.UserDeleteEvent{}, u); err != nil {
@@ -304,6 +307,7 @@ func (svc *userService) FindDomainUserByID(userID, domainID *uuid.UUID) (*data.U
 			goqu.I("du.notify_replies").As("du_notify_replies"),
 			goqu.I("du.notify_moderator").As("du_notify_moderator"),
 			goqu.I("du.notify_comment_status").As("du_notify_comment_status"),
+			goqu.I("du.digest_mode").As("du_digest_mode"),
 			goqu.I("du.ts_created").As("du_ts_created")).
 		LeftJoin(
 			goqu.T("cm_domains_users").As("du"),
@@ -561,6 +565,7 @@ func (svc *userService) ListByDomain(domainID *uuid.UUID, superuser bool, filter
 			goqu.I("du.notify_replies").As("du_notify_replies"),
 			goqu.I("du.notify_moderator").As("du_notify_moderator"),
 			goqu.I("du.notify_comment_status").As("du_notify_comment_status"),
+			goqu.I("du.digest_mode").As("du_digest_mode"),
 			goqu.I("du.ts_created").As("du_ts_created")).
 		Join(goqu.T("cm_users").As("u"), goqu.On(goqu.Ex{"u.id": goqu.I("du.user_id")})).
 		LeftJoin(goqu.T("cm_user_avatars").As("a"), goqu.On(goqu.Ex{"a.user_id": goqu.I("du.user_id")})).
@@ -621,12 +626,26 @@ func (svc *userService) ListByDomain(domainID *uuid.UUID, superuser bool, filter
 	return um, dus, nil
 }
 
-func (svc *userService) ListDomainModerators(domainID *uuid.UUID, enabledNotifyOnly bool) ([]*data.User, error) {
+func (svc *userService) ListDomainModerators(domainID *uuid.UUID, enabledNotifyOnly bool) (map[uuid.UUID]*data.User, []*data.DomainUser, error) {
 	logger.Debugf("userService.ListDomainModerators(%s, %v)", domainID, enabledNotifyOnly)
 
 	// Prepare a query
 	q := db.From(goqu.T("cm_domains_users").As("du")).
-		Select("u.*", goqu.Case().When(goqu.I("a.user_id").IsNull(), false).Else(true).As("has_avatar")).
+		Select(
+			// User fields
+			"u.*",
+			goqu.Case().When(goqu.I("a.user_id").IsNull(), false).Else(true).As("has_avatar"),
+			// Domain user fields
+			goqu.I("du.domain_id").As("du_domain_id"),
+			goqu.I("du.user_id").As("du_user_id"),
+			goqu.I("du.is_owner").As("du_is_owner"),
+			goqu.I("du.is_moderator").As("du_is_moderator"),
+			goqu.I("du.is_commenter").As("du_is_commenter"),
+			goqu.I("du.notify_replies").As("du_notify_replies"),
+			goqu.I("du.notify_moderator").As("du_notify_moderator"),
+			goqu.I("du.notify_comment_status").As("du_notify_comment_status"),
+			goqu.I("du.digest_mode").As("du_digest_mode"),
+			goqu.I("du.ts_created").As("du_ts_created")).
 		// Join users
 		Join(goqu.T("cm_users").As("u"), goqu.On(goqu.Ex{"u.id": goqu.I("du.user_id")})).
 		// Outer-join user avatars
@@ -638,15 +657,27 @@ func (svc *userService) ListDomainModerators(domainID *uuid.UUID, enabledNotifyO
 		q = q.Where(goqu.Ex{"du.notify_moderator": true})
 	}
 
-	// Query domain's moderator users
-	var users []*data.User
-	if err := q.ScanStructs(&users); err != nil {
+	// Query domain's moderator users and domain users
+	var dbRecs []struct {
+		data.User
+		data.NullDomainUser
+	}
+	if err := q.ScanStructs(&dbRecs); err != nil {
 		logger.Errorf("userService.ListDomainModerators: ScanStructs() failed: %v", err)
-		return nil, translateDBErrors(err)
+		return nil, nil, translateDBErrors(err)
+	}
+
+	// Process the users
+	var dus []*data.DomainUser
+	um := map[uuid.UUID]*data.User{}
+	for _, r := range dbRecs {
+		dus = append(dus, r.NullDomainUser.ToDomainUser())
+		u := r.User
+		um[u.ID] = &u
 	}
 
 	// Succeeded
-	return users, nil
+	return um, dus, nil
 }
 
 func (svc *userService) ListUserSessions(userID *uuid.UUID, pageIndex int) ([]*data.UserSession, error) {
@@ -684,7 +715,7 @@ func (svc *userService) Persist(u *data.User) error {
 }
 
 func (svc *userService) Update(u *data.User) error {
-	logger.Debugf("userService.Update(%#v)", u)
+	logger.Debugf("userService.Update(%s)", &u.ID)
 
 	// Fire an event
 	if _, err := handleUserEvent(&plugin.UserUpdateEvent{}, u); err != nil {
@@ -696,7 +727,7 @@ func (svc *userService) Update(u *data.User) error {
 }
 
 func (svc *userService) UpdateBanned(curUserID *uuid.UUID, u *data.User, banned bool) error {
-	logger.Debugf("userService.UpdateBanned(%s, %v, %v)", curUserID, u, banned)
+	logger.Debugf("userService.UpdateBanned(%s, %s, %v)", curUserID, &u.ID, banned)
 
 	// User cannot be anonymous
 	if u.IsAnonymous() {
@@ -716,7 +747,7 @@ func (svc *userService) UpdateBanned(curUserID *uuid.UUID, u *data.User, banned
 }
 
 func (svc *userService) UpdateLoginLocked(u *data.User) error {
-	logger.Debugf("userService.UpdateLoginLocked(%v)", u)
+	logger.Debugf("userService.UpdateLoginLocked(%s, %v, %d)", &u.ID, u.IsLocked, u.FailedLoginAttempts)
 
 	// User cannot be anonymous
 	if u.IsAnonymous() {
@@ -732,6 +763,34 @@ func (svc *userService) UpdateLoginLocked(u *data.User) error {
 	return svc.Persist(u)
 }
 
+func (svc *userService) UpdateTOTP(u *data.User) error {
+	logger.Debugf("userService.UpdateTOTP(%s, %v)", &u.ID, u.TOTPEnabled)
+
+	// User cannot be anonymous
+	if u.IsAnonymous() {
+		return ErrNotFound
+	}
+
+	// Update the record
+	err := db.ExecOne(
+		db.Update("cm_users").
+			Set(goqu.Record{
+				"totp_secret":         u.TOTPSecret,
+				"totp_enabled":        u.TOTPEnabled,
+				"ts_totp_enabled":     u.TOTPEnabledTime,
+				"totp_last_counter":   u.TOTPLastCounter,
+				"totp_recovery_codes": u.TOTPRecoveryCodes,
+			}).
+			Where(goqu.Ex{"id": &u.ID}))
+	if err != nil {
+		logger.Errorf("userService.UpdateTOTP: ExecOne() failed: %v", err)
+		return translateDBErrors(err)
+	}
+
+	// Succeeded
+	return nil
+}
+
 // handleUserEvent fires a user event. It returns true if the user has been modified during the event handling
 func handleUserEvent[E plugin.UserPayload](e E, u *data.User) (changed bool, err error) {
 	// Skip unless the plugin manager is active
@@ -0,0 +1,353 @@
+package svc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/go-openapi/strfmt"
+	"github.com/google/uuid"
+	"gitlab.com/comentario/comentario/internal/api/models"
+	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/util"
+	"io"
+	"net/http"
+	"time"
+)
+
+// TheWebhookService is a global WebhookService implementation
+var TheWebhookService WebhookService = &webhookService{
+	wake: make(chan struct{}, 1),
+}
+
+// webhookClient is the HTTP client used for delivering webhook payloads
+var webhookClient = newPublicHTTPClient(util.WebhookDeliveryTimeout)
+
+// WebhookService is a service interface for dealing with outgoing domain webhooks
+type WebhookService interface {
+	// Create persists a new webhook record
+	Create(wh *data.DomainWebhook) error
+	// DeleteByID removes a webhook, specified by its ID, from the given domain
+	DeleteByID(domainID, id *uuid.UUID) error
+	// FindByID fetches and returns a webhook by its ID. The webhook must belong to the given domain
+	FindByID(domainID, id *uuid.UUID) (*data.DomainWebhook, error)
+	// ListByDomain fetches and returns a list of webhooks registered for the given domain
+	ListByDomain(domainID *uuid.UUID) ([]*data.DomainWebhook, error)
+	// ListDeliveries fetches and returns a page of deliveries for the given webhook, most recent first. pageIndex is the
+	// page index, if negative, no pagination is applied
+	ListDeliveries(webhookID *uuid.UUID, pageIndex int) ([]*data.WebhookDelivery, error)
+	// Notify queues a delivery of the given comment event to every active webhook of the domain subscribed to it
+	Notify(event models.WebhookEventType, domain *data.Domain, page *data.DomainPage, comment *data.Comment) error
+	// Run starts processing the delivery queue in the background
+	Run() error
+	// Update updates an existing webhook record in the database
+	Update(wh *data.DomainWebhook) error
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+
+// webhookPayload is the body POSTed to a webhook endpoint
+type webhookPayload struct {
+	ID        uuid.UUID               `json:"id"`        // Unique delivery ID
+	Event     models.WebhookEventType `json:"event"`     // Event type
+	Timestamp time.Time               `json:"timestamp"` // When the event occurred
+	Domain    webhookPayloadDomain    `json:"domain"`    // Domain the event occurred on
+	Page      webhookPayloadPage      `json:"page"`      // Page the event occurred on
+	Comment   *models.Comment         `json:"comment"`   // Comment the event concerns
+}
+
+// webhookPayloadDomain is the domain part of webhookPayload
+type webhookPayloadDomain struct {
+	ID   uuid.UUID `json:"id"`   // Domain ID
+	Host string    `json:"host"` // Domain host
+	Name string    `json:"name"` // Domain display name
+}
+
+// webhookPayloadPage is the page part of webhookPayload
+type webhookPayloadPage struct {
+	ID    uuid.UUID  `json:"id"`    // Page ID
+	Path  string     `json:"path"`  // Page path
+	Title string     `json:"title"` // Page title
+	URL   strfmt.URI `json:"url"`   // Absolute page URL
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+
+// webhookService is a blueprint WebhookService implementation
+type webhookService struct {
+	wake chan struct{} // Channel for waking up the queue processor once a delivery is queued
+}
+
+func (svc *webhookService) Create(wh *data.DomainWebhook) error {
+	logger.Debugf("webhookService.Create(%s, %s)", &wh.DomainID, wh.URL)
+
+	// Insert a new record
+	if err := db.ExecOne(db.Insert("cm_domain_webhooks").Rows(wh)); err != nil {
+		logger.Errorf("webhookService.Create: ExecOne() failed: %v", err)
+		return translateDBErrors(err)
+	}
+
+	// Succeeded
+	return nil
+}
+
+func (svc *webhookService) DeleteByID(domainID, id *uuid.UUID) error {
+	logger.Debugf("webhookService.DeleteByID(%s, %s)", domainID, id)
+
+	// Delete the record, which also removes all its deliveries
+	if err := db.ExecOne(db.Delete("cm_domain_webhooks").Where(goqu.Ex{"id": id, "domain_id": domainID})); err != nil {
+		logger.Errorf("webhookService.DeleteByID: ExecOne() failed: %v", err)
+		return translateDBErrors(err)
+	}
+
+	// Succeeded
+	return nil
+}
+
+func (svc *webhookService) FindByID(domainID, id *uuid.UUID) (*data.DomainWebhook, error) {
+	logger.Debugf("webhookService.FindByID(%s, %s)", domainID, id)
+
+	// Query the webhook
+	var wh data.DomainWebhook
+	if b, err := db.From("cm_domain_webhooks").Where(goqu.Ex{"id": id, "domain_id": domainID}).ScanStruct(&wh); err != nil {
+		logger.Errorf("webhookService.FindByID: ScanStruct() failed: %v", err)
+		return nil, translateDBErrors(err)
+	} else if !b {
+		return nil, ErrNotFound
+	}
+
+	// Succeeded
+	return &wh, nil
+}
+
+func (svc *webhookService) ListByDomain(domainID *uuid.UUID) ([]*data.DomainWebhook, error) {
+	logger.Debugf("webhookService.ListByDomain(%s)", domainID)
+
+	// Query the webhooks
+	var res []*data.DomainWebhook
+	if err := db.From("cm_domain_webhooks").
+		Where(goqu.Ex{"domain_id": domainID}).
+		Order(goqu.I("ts_created").Asc(), goqu.I("id").Asc()).
+		ScanStructs(&res); err != nil {
+		logger.Errorf("webhookService.ListByDomain: ScanStructs() failed: %v", err)
+		return nil, translateDBErrors(err)
+	}
+
+	// Succeeded
+	return res, nil
+}
+
+func (svc *webhookService) ListDeliveries(webhookID *uuid.UUID, pageIndex int) ([]*data.WebhookDelivery, error) {
+	logger.Debugf("webhookService.ListDeliveries(%s, %d)", webhookID, pageIndex)
+
+	// Prepare a query
+	q := db.From("cm_webhook_deliveries").
+		Where(goqu.Ex{"webhook_id": webhookID}).
+		Order(goqu.I("ts_created").Desc(), goqu.I("id").Asc())
+
+	// Paginate if required
+	if pageIndex >= 0 {
+		q = q.Limit(util.ResultPageSize).Offset(uint(pageIndex) * util.ResultPageSize)
+	}
+
+	// Query the deliveries
+	var res []*data.WebhookDelivery
+	if err := q.ScanStructs(&res); err != nil {
+		logger.Errorf("webhookService.ListDeliveries: ScanStructs() failed: %v", err)
+		return nil, translateDBErrors(err)
+	}
+
+	// Succeeded
+	return res, nil
+}
+
+func (svc *webhookService) Notify(event models.WebhookEventType, domain *data.Domain, page *data.DomainPage, comment *data.Comment) error {
+	logger.Debugf("webhookService.Notify(%s, %s, %s, %s)", event, &domain.ID, &page.ID, &comment.ID)
+
+	// Fetch domain's webhooks
+	whs, err := svc.ListByDomain(&domain.ID)
+	if err != nil {
+		return err
+	}
+
+	// Prepare a comment DTO. Webhooks are configured by domain owners, who aren't supposed to see author IPs
+	cc := *comment
+	cc.AuthorIP = ""
+	commentDTO := cc.ToDTO(domain.IsHTTPS, domain.Host, page.Path)
+
+	// Queue a delivery for every active webhook subscribed to the event
+	now := time.Now().UTC()
+	queued := false
+	for _, wh := range whs {
+		if !wh.IsActive || !wh.HasEvent(event) {
+			continue
+		}
+
+		// Compose a payload, which is unique per delivery
+		wd := data.NewWebhookDelivery(&wh.ID, event, "")
+		b, err := json.Marshal(&webhookPayload{
+			ID:        wd.ID,
+			Event:     event,
+			Timestamp: now,
+			Domain:    webhookPayloadDomain{ID: domain.ID, Host: domain.Host, Name: domain.DisplayName()},
+			Page: webhookPayloadPage{
+				ID:    page.ID,
+				Path:  page.Path,
+				Title: page.Title,
+				URL:   strfmt.URI(domain.RootURL() + page.Path),
+			},
+			Comment: commentDTO,
+		})
+		if err != nil {
+			logger.Errorf("webhookService.Notify: Marshal() failed: %v", err)
+			return err
+		}
+		wd.Payload = string(b)
+
+		// Persist the delivery
+		if err := db.ExecOne(db.Insert("cm_webhook_deliveries").Rows(wd)); err != nil {
+			logger.Errorf("webhookService.Notify: ExecOne() failed: %v", err)
+			return translateDBErrors(err)
+		}
+		queued = true
+	}
+
+	// Wake up the queue processor, unless it's already awake
+	if queued {
+		select {
+		case svc.wake <- struct{}{}:
+		default:
+		}
+	}
+
+	// Succeeded
+	return nil
+}
+
+func (svc *webhookService) Run() error {
+	logger.Debug("webhookService: starting delivery queue processing")
+	go svc.processQueue()
+	return nil
+}
+
+func (svc *webhookService) Update(wh *data.DomainWebhook) error {
+	logger.Debugf("webhookService.Update(%s, %s)", &wh.ID, wh.URL)
+
+	// Update the record
+	if err := db.ExecOne(db.Update("cm_domain_webhooks").Set(wh).Where(goqu.Ex{"id": &wh.ID, "domain_id": &wh.DomainID})); err != nil {
+		logger.Errorf("webhookService.Update: ExecOne() failed: %v", err)
+		return translateDBErrors(err)
+	}
+
+	// Succeeded
+	return nil
+}
+
+// deliver makes a single attempt to deliver the given payload to the webhook, and persists the outcome
+func (svc *webhookService) deliver(wh *data.DomainWebhook, wd *data.WebhookDelivery) error {
+	logger.Debugf("webhookService.deliver(%s, %s)", &wh.ID, &wd.ID)
+
+	// Post the payload and register the outcome
+	code, err := svc.post(wh, wd)
+	if err != nil {
+		logger.Warningf("Failed to deliver %s to webhook %s (attempt %d): %v", wd.Event, &wh.ID, wd.Attempts+1, err)
+	}
+	wd.WithAttempt(code, err)
+
+	// Update the delivery record
+	if err := db.ExecOne(db.Update("cm_webhook_deliveries").Set(wd).Where(goqu.Ex{"id": &wd.ID})); err != nil {
+		logger.Errorf("webhookService.deliver: ExecOne() failed: %v", err)
+		return translateDBErrors(err)
+	}
+
+	// Succeeded
+	return nil
+}
+
+// deliverDue attempts to deliver all queued payloads whose next attempt is due. Returns the number of processed
+// deliveries
+func (svc *webhookService) deliverDue() (int, error) {
+	// Query due deliveries along with their (active) webhooks
+	var dbRecs []struct {
+		data.WebhookDelivery
+		WebhookURL    string `db:"wh_url"`
+		WebhookSecret string `db:"wh_secret"`
+	}
+	err := db.From(goqu.T("cm_webhook_deliveries").As("wd")).
+		Select("wd.*", goqu.I("wh.url").As("wh_url"), goqu.I("wh.secret").As("wh_secret")).
+		Join(goqu.T("cm_domain_webhooks").As("wh"), goqu.On(goqu.Ex{"wh.id": goqu.I("wd.webhook_id")})).
+		Where(
+			goqu.I("wd.status").Eq(data.WebhookDeliveryStatusPending),
+			goqu.I("wd.ts_next_attempt").Lte(time.Now().UTC()),
+			goqu.I("wh.is_active").IsTrue()).
+		Order(goqu.I("wd.ts_next_attempt").Asc()).
+		Limit(util.WebhookQueueBatchSize).
+		ScanStructs(&dbRecs)
+	if err != nil {
+		logger.Errorf("webhookService.deliverDue: ScanStructs() failed: %v", err)
+		return 0, translateDBErrors(err)
+	}
+
+	// Iterate the deliveries
+	for _, r := range dbRecs {
+		wh := &data.DomainWebhook{ID: r.WebhookID, URL: r.WebhookURL, Secret: r.WebhookSecret}
+		if err := svc.deliver(wh, &r.WebhookDelivery); err != nil {
+			return 0, err
+		}
+	}
+
+	// Succeeded
+	return len(dbRecs), nil
+}
+
+// post sends the delivery's payload to the webhook URL, and returns the response status code, if any
+func (svc *webhookService) post(wh *data.DomainWebhook, wd *data.WebhookDelivery) (int, error) {
+	// Prepare a request
+	body := []byte(wd.Payload)
+	rq, err := http.NewRequest(http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	rq.Header.Set("Content-Type", "application/json")
+	rq.Header.Set("User-Agent", util.ApplicationName+"-Webhook")
+	rq.Header.Set("X-Comentario-Delivery", wd.ID.String())
+	rq.Header.Set("X-Comentario-Event", string(wd.Event))
+	rq.Header.Set("X-Comentario-Signature", "sha256="+hex.EncodeToString(util.HMACSign(body, []byte(wh.Secret))))
+
+	// Submit the request
+	resp, err := webhookClient.Do(rq)
+	if err != nil {
+		return 0, err
+	}
+	defer util.LogError(resp.Body.Close, "webhookService.post, resp.Body.Close()")
+
+	// Discard the response body, but make sure it's read to let the connection be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	// Any 2xx status is considered a success
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded with HTTP status %d", resp.StatusCode)
+	}
+
+	// Succeeded
+	return resp.StatusCode, nil
+}
+
+// processQueue endlessly processes the delivery queue, sleeping between rounds unless woken up by a new delivery
+func (svc *webhookService) processQueue() {
+	for {
+		// Deliver everything that's due, repeating while full batches get processed
+		for {
+			if n, err := svc.deliverDue(); err != nil || n < util.WebhookQueueBatchSize {
+				break
+			}
+		}
+
+		// Wait for the next round
+		select {
+		case <-svc.wake:
+		case <-time.After(util.WebhookQueuePollInterval):
+		}
+	}
+}
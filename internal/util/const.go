@@ -9,10 +9,11 @@ import (
 // Various constants and constant-like vars
 
 const (
-	ApplicationName = "Comentario"     // Application name
-	APIPath         = "api/"           // Root path of the API requests
-	SwaggerUIPath   = APIPath + "docs" // Root path of the Swagger UI
-	WebSocketsPath  = "ws/"            // Root path of the WebSockets endpoints
+	ApplicationName       = "Comentario"            // Application name
+	APIPath               = "api/"                  // Root path of the API requests
+	SwaggerUIPath         = APIPath + "docs"        // Root path of the Swagger UI
+	WebSocketsPath        = "ws/"                   // Root path of the WebSockets endpoints
+	WebAuthnWellKnownPath = "/.well-known/webauthn" // Absolute path of the WebAuthn related origins document
 
 	GitLabProjectID   = "42486427"                                                             // ID of Comentario GitLab project
 	GitLabReleasesURL = "https://gitlab.com/api/v4/projects/" + GitLabProjectID + "/releases/" // URL of the releases endpoint
@@ -24,6 +25,26 @@ const (
 	ResultPageSize = 25 // Max number of database rows to return
 
 	MaxNumberStatsDays = 30 // Max number of days to get statistics for
+
+	CommentBulkMaxCount = 1000 // Max number of comments a single bulk moderation action can apply to
+
+	DigestMaxSendAttempts      = 8  // Max number of attempts to send an email digest
+	WebhookMaxDeliveryAttempts = 10 // Max number of attempts to deliver a webhook payload
+	WebhookQueueBatchSize      = 50 // Max number of webhook deliveries to process in one go
+
+	ImportBatchSize      = 500 // Number of imported comments inserted in one transaction
+	ExportBatchSize      = 500 // Number of exported comments fetched in one query
+	ImportReportMaxItems = 100 // Max number of import report items of each kind
+
+	BackupBatchSize = 500 // Number of rows inserted in one statement when restoring a backup
+
+	TOTPDigits            = 6  // Number of digits in a TOTP code
+	TOTPSkewSteps         = 1  // Number of time steps before and after the current one a TOTP code is still accepted for
+	TOTPRecoveryCodeCount = 10 // Number of recovery codes generated for a user enabling two-factor authentication
+
+	CommentFlagMaxPerIPPerHour = 10 // Max number of comment flags submitted by unregistered users from the same IP per hour
+
+	SSOJWKSCacheMaxSize = 1000 // Max number of cached SSO JWKS documents
 )
 
 // Cookie names
@@ -55,6 +76,25 @@ const (
 	AvatarFetchTimeout       = 5 * time.Second  // Timeout for fetching external avatars
 	ConfigCacheTTL           = 30 * time.Second // TTL for cached configs
 	AttrCacheTTL             = 10 * time.Second // TTL for cached attributes
+	DigestPollInterval       = 5 * time.Minute  // How often due email digests are checked for
+	DigestRetryBaseDelay     = 15 * time.Minute // Delay before the first retry of a failed email digest
+	DigestRetryMaxDelay      = 12 * time.Hour   // Max delay between email digest retries
+	TOTPPeriod               = 30 * time.Second // Time step a TOTP code is valid for
+	WebAuthnOriginsCacheTTL  = 5 * time.Minute  // TTL for the cached list of WebAuthn related origins
+
+	WebhookDeliveryTimeout   = 10 * time.Second // Timeout for delivering a single webhook payload
+	WebhookQueuePollInterval = 15 * time.Second // How often the webhook delivery queue is polled
+	WebhookRetryBaseDelay    = 30 * time.Second // Delay before the first webhook delivery retry
+	WebhookRetryMaxDelay     = 6 * time.Hour    // Max delay between webhook delivery retries
+	WebhookDeliveryRetention = 30 * OneDay      // How long a completed webhook delivery record is retained
+
+	ImportJobHeartbeatInterval = 30 * time.Second // How often a running import job's lease is renewed
+	ImportJobLeaseTimeout      = 2 * time.Minute  // How long a job's lease lasts without renewal before another instance may take it over
+
+	SSOJWKSFetchTimeout    = 10 * time.Second // Timeout for fetching a domain's SSO JWKS document
+	SSOJWKSCacheTTL        = time.Hour        // How long a fetched SSO JWKS document is cached for
+	SSOJWKSRefetchInterval = time.Minute      // Min interval between JWKS refetches caused by an unknown key ID
+	SSOJWTLeeway           = 30 * time.Second // Clock skew tolerance when validating SSO JWT time claims
 )
 
 var (
@@ -66,6 +106,14 @@ var (
 	// DefaultLanguage represents the default language
 	DefaultLanguage = language.English
 
+	// ExportFileExtensions maps domain export formats to extensions of the exported file (before compression)
+	ExportFileExtensions = map[string]string{
+		"comentario": "json",
+		"csv":        "csv",
+		"disqus":     "xml",
+		"ndjson":     "ndjson",
+	}
+
 	// FrontendLanguages stores tags of supported frontend (Administration UI) languages
 	FrontendLanguages = []language.Tag{
 		DefaultLanguage,
@@ -103,6 +151,9 @@ func init() {
 		// Embed endpoints are cross-site by design because scripts are always loaded from a different origin
 		"api/embed/",
 
+		// Inbound mail is posted by an external mail gateway, authenticated with a shared secret
+		"api/mail/inbound",
+
 		// Avoid setting the XSRF session cookies on static resources because it prevents caching them (when combined
 		// with the "Vary: Cookie" HTTP header automatically added by the runtime)
 		"en/fonts/",
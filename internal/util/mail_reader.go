@@ -0,0 +1,146 @@
+package util
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+)
+
+// ErrMailNoText is returned when an email message contains no plain-text body
+var ErrMailNoText = errors.New("message has no plain-text body")
+
+// MaxMailTextSize is the maximum size of an email text body in bytes
+const MaxMailTextSize = 1024 * 1024 // 1 MiB
+
+var (
+	reMailAttribution    = regexp.MustCompile(`(?i)^on\s.+\swrote:$`)
+	reMailAttributionEnd = regexp.MustCompile(`(?i)\swrote:$`)
+	reMailOriginalHeader = regexp.MustCompile(`(?i)^(-+\s*original message\s*-+|_{10,})$`)
+	reMailFromHeader     = regexp.MustCompile(`(?i)^from:\s`)
+	reMailSentHeader     = regexp.MustCompile(`(?i)^(sent|date):\s`)
+)
+
+// MailMessageText extracts and returns the plain-text body of the given email message, decoding it as necessary. For
+// multipart messages, the first text/plain part is used
+func MailMessageText(msg *mail.Message) (string, error) {
+	return mailPartText(textproto.MIMEHeader(msg.Header), msg.Body)
+}
+
+// StripQuotedText removes the quoted original message, the attribution line preceding it, and the signature from the
+// given email reply text, and returns the remaining text trimmed of surrounding whitespace
+func StripQuotedText(s string) string {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	cut := len(lines)
+	for i, line := range lines {
+		// Signature delimiter
+		if line == "-- " || line == "--" {
+			cut = i
+			break
+		}
+
+		trimmed := strings.TrimSpace(line)
+		var next string
+		if i < len(lines)-1 {
+			next = strings.TrimSpace(lines[i+1])
+		}
+		switch {
+		// Quoted line, attribution line ("On <date>, <name> wrote:"), or an Outlook-style separator
+		case strings.HasPrefix(trimmed, ">"),
+			reMailAttribution.MatchString(trimmed),
+			reMailOriginalHeader.MatchString(trimmed):
+			cut = i
+
+		// Attribution line wrapped over two lines
+		case len(trimmed) > 3 && strings.EqualFold(trimmed[:3], "on ") && reMailAttributionEnd.MatchString(next):
+			cut = i
+
+		// Forwarded headers block ("From: ..." followed by "Sent: ..." or "Date: ...")
+		case reMailFromHeader.MatchString(trimmed) && reMailSentHeader.MatchString(next):
+			cut = i
+
+		default:
+			continue
+		}
+		break
+	}
+	return strings.TrimSpace(strings.Join(lines[:cut], "\n"))
+}
+
+// mailPartText extracts the plain text from a message (part) with the given headers and body
+func mailPartText(h textproto.MIMEHeader, body io.Reader) (string, error) {
+	// Parse the content type, which defaults to plain text
+	mediaType, params := "text/plain", map[string]string{}
+	if ct := h.Get("Content-Type"); ct != "" {
+		var err error
+		if mediaType, params, err = mime.ParseMediaType(ct); err != nil {
+			return "", fmt.Errorf("invalid content type %q: %w", ct, err)
+		}
+	}
+
+	switch {
+	// Iterate the parts of a multipart message, recursively
+	case strings.HasPrefix(mediaType, "multipart/"):
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return "", err
+			}
+			if s, err := mailPartText(part.Header, part); !errors.Is(err, ErrMailNoText) {
+				return s, err
+			}
+		}
+
+	// Plain text
+	case mediaType == "text/plain":
+		return mailDecodeText(h.Get("Content-Transfer-Encoding"), params["charset"], body)
+	}
+	return "", ErrMailNoText
+}
+
+// mailDecodeText decodes a text body using the given transfer encoding and charset
+func mailDecodeText(encoding, charset string, body io.Reader) (string, error) {
+	// Decode the transfer encoding
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "7bit", "8bit", "binary":
+		// Nothing to decode
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	default:
+		return "", fmt.Errorf("unsupported transfer encoding %q", encoding)
+	}
+
+	// Read the text
+	b, err := io.ReadAll(io.LimitReader(body, MaxMailTextSize+1))
+	if err != nil {
+		return "", err
+	} else if len(b) > MaxMailTextSize {
+		return "", fmt.Errorf("text body exceeds %d bytes", MaxMailTextSize)
+	}
+
+	// Convert the charset
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "us-ascii":
+		return string(b), nil
+	case "iso-8859-1", "latin1":
+		// Latin-1 bytes map directly onto Unicode code points
+		r := make([]rune, len(b))
+		for i, c := range b {
+			r[i] = rune(c)
+		}
+		return string(r), nil
+	}
+	return "", fmt.Errorf("unsupported charset %q", charset)
+}
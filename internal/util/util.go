@@ -4,22 +4,32 @@ import (
 	"archive/zip"
 	"bytes"
 	"compress/gzip"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/hmac"
 	cryptorand "crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
 	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/avct/uasurfer"
 	"github.com/microcosm-cc/bluemonday"
 	"github.com/op/go-logging"
 	"github.com/phuslu/iploc"
+	"github.com/sergi/go-diff/diffmatchpatch"
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/extension"
 	gmhtml "github.com/yuin/goldmark/renderer/html"
 	"gitlab.com/comentario/comentario/internal/intf"
 	"golang.org/x/net/html"
 	"io"
+	"math/big"
 	"math/rand"
 	"net"
 	"net/http"
@@ -28,6 +38,7 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 	"unicode/utf8"
 )
 
@@ -47,6 +58,33 @@ var (
 		"ABCDEFGHIJKLMNOPQRSTUVWXYZ",
 	}
 
+	// Names of Unicode scripts recognised by MainScript()
+	knownScripts = []string{
+		"Latin", "Cyrillic", "Greek", "Arabic", "Hebrew", "Han", "Hiragana", "Katakana", "Hangul", "Devanagari",
+		"Bengali", "Tamil", "Thai", "Armenian", "Georgian",
+	}
+
+	// Special-purpose IP ranges not covered by net.IP's methods, which must never be treated as public
+	nonPublicIPNets = func(cidrs ...string) []*net.IPNet {
+		res := make([]*net.IPNet, len(cidrs))
+		for i, c := range cidrs {
+			_, res[i], _ = net.ParseCIDR(c)
+		}
+		return res
+	}(
+		"0.0.0.0/8",       // "This" network
+		"100.64.0.0/10",   // Carrier-grade NAT
+		"192.0.0.0/24",    // IETF protocol assignments
+		"192.0.2.0/24",    // Documentation (TEST-NET-1)
+		"198.18.0.0/15",   // Benchmarking
+		"198.51.100.0/24", // Documentation (TEST-NET-2)
+		"203.0.113.0/24",  // Documentation (TEST-NET-3)
+		"240.0.0.0/4",     // Reserved, including broadcast
+		"64:ff9b::/96",    // IPv4/IPv6 translation
+		"100::/64",        // Discard-only
+		"2001:db8::/32",   // Documentation
+	)
+
 	// TheMailer is a Mailer implementation available application-wide. Defaults to a mailer that doesn't do anything
 	TheMailer intf.Mailer = &noOpMailer{}
 )
@@ -89,6 +127,14 @@ func (p *pathRegistry) Has(path string) bool {
 
 // ----------------------------------------------------------------------------------------------------------------------
 
+// TextDiffChunk is a chunk of a difference between two texts
+type TextDiffChunk struct {
+	Op   string // Chunk kind: "equal", "insert", or "delete"
+	Text string // Chunk text
+}
+
+// ----------------------------------------------------------------------------------------------------------------------
+
 // CheckErrors picks and returns the first non-nil error, or nil if there's none
 func CheckErrors(errs ...error) error {
 	for _, err := range errs {
@@ -193,6 +239,15 @@ func GoTimeout(timeout time.Duration, f func()) {
 	}
 }
 
+// HashIP returns a hex-encoded HMAC of the given IP address, made with the given key, or an empty string if the address
+// is empty. It allows to tell addresses apart without storing them
+func HashIP(ip string, key []byte) string {
+	if ip == "" {
+		return ""
+	}
+	return hex.EncodeToString(HMACSign([]byte(ip), key))
+}
+
 // HMACSign signs the given data with the given secret, using HMAC with SHA256
 func HMACSign(b, secret []byte) []byte {
 	h := hmac.New(sha256.New, secret)
@@ -270,6 +325,27 @@ func IndexOfString(s string, slice []string) int {
 	return -1
 }
 
+// IsPublicIP returns whether the given IP address is a globally routable unicast one, that is, it isn't a loopback,
+// private, link-local (including cloud metadata endpoints), multicast, unspecified, or otherwise reserved address
+func IsPublicIP(ip net.IP) bool {
+	if ip == nil ||
+		ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified() {
+		return false
+	}
+	for _, n := range nonPublicIPNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
 // IsStrongPassword checks whether the provided password is a 'strong' one
 func IsStrongPassword(s string) bool {
 	// Check length
@@ -356,6 +432,26 @@ func IsValidURL(s string, allowHTTP bool) bool {
 	return err == nil
 }
 
+// LongestRuneRun returns the length of the longest sequence of identical consecutive non-whitespace characters in the
+// given string
+func LongestRuneRun(s string) int {
+	maxRun, run := 0, 0
+	var prev rune
+	for _, r := range s {
+		switch {
+		case unicode.IsSpace(r):
+			run = 0
+		case run > 0 && r == prev:
+			run++
+		default:
+			run = 1
+		}
+		prev = r
+		maxRun = max(maxRun, run)
+	}
+	return maxRun
+}
+
 // LogError calls a function that may return an error, and if it does, logs and discards it
 func LogError(f func() error, details string) {
 	if err := f(); err != nil {
@@ -420,6 +516,32 @@ func MarkdownToHTML(markdown string, links, images, tables bool) string {
 	return p.Sanitize(buf.String())
 }
 
+// MainScript returns the name of the Unicode script (such as "Latin" or "Cyrillic") most letters in the given string
+// belong to, or an empty string if there are no letters in it
+func MainScript(s string) string {
+	counts := make(map[string]int)
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		for _, name := range knownScripts {
+			if unicode.Is(unicode.Scripts[name], r) {
+				counts[name]++
+				break
+			}
+		}
+	}
+
+	// Pick the script with the most letters, preferring the one listed first in case of a tie
+	res, resCnt := "", 0
+	for _, name := range knownScripts {
+		if cnt := counts[name]; cnt > resCnt {
+			res, resCnt = name, cnt
+		}
+	}
+	return res
+}
+
 // MaskIP hides a part of the given IPv4/IPv6 address
 func MaskIP(ip string) string {
 	// Find the second dot
@@ -489,6 +611,102 @@ func ParseAbsoluteURL(s string, allowHTTP, trimTrailingSlash bool) (*url.URL, er
 	return u, nil
 }
 
+// ParseJWKS parses the given JSON Web Key Set document and returns its public signing keys mapped by key ID. Only RSA
+// and EC (P-256, P-384, P-521) keys are supported, any other keys, as well as encryption keys, are skipped
+func ParseJWKS(b []byte) (map[string]crypto.PublicKey, error) {
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JWKS: %w", err)
+	}
+
+	// decodeInt decodes a base64url-encoded big-endian integer
+	decodeInt := func(s string) (*big.Int, error) {
+		if b, err := base64.RawURLEncoding.DecodeString(s); err != nil {
+			return nil, err
+		} else if len(b) == 0 {
+			return nil, errors.New("value is empty")
+		} else {
+			return new(big.Int).SetBytes(b), nil
+		}
+	}
+
+	res := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		// Skip keys not meant for signing
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		switch k.Kty {
+		case "RSA":
+			n, err := decodeInt(k.N)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: invalid modulus: %w", k.Kid, err)
+			}
+			e, err := decodeInt(k.E)
+			if err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+				return nil, fmt.Errorf("key %q: invalid exponent", k.Kid)
+			}
+			res[k.Kid] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				continue
+			}
+			x, err := decodeInt(k.X)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: invalid X coordinate: %w", k.Kid, err)
+			}
+			y, err := decodeInt(k.Y)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: invalid Y coordinate: %w", k.Kid, err)
+			}
+			if !curve.IsOnCurve(x, y) {
+				return nil, fmt.Errorf("key %q: point isn't on curve %s", k.Kid, k.Crv)
+			}
+			res[k.Kid] = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		}
+	}
+	return res, nil
+}
+
+// ParseSearchQuery splits the given full-text search query into terms: either individual words or, if enclosed in
+// double quotes, phrases. Whitespace within phrases is collapsed, and empty terms are skipped. An unterminated quote
+// extends to the end of the query
+func ParseSearchQuery(s string) []string {
+	var res []string
+	for i, part := range strings.Split(s, `"`) {
+		// Odd parts are enclosed in quotes
+		if i%2 == 1 {
+			if phrase := strings.Join(strings.Fields(part), " "); phrase != "" {
+				res = append(res, phrase)
+			}
+		} else {
+			res = append(res, strings.Fields(part)...)
+		}
+	}
+	return res
+}
+
 // RandomBytes makes a random byte slice of the desired size
 func RandomBytes(n int) ([]byte, error) {
 	b := make([]byte, n)
@@ -540,6 +758,37 @@ func StrToFloatDef(s string, def float64) float64 {
 	return f
 }
 
+// TextChangePercent returns the extent of the difference between the two given texts, as the percentage (0 to 100) of
+// characters that need to be inserted, deleted, or replaced to turn one text into the other, relative to the length of
+// the longer text
+func TextChangePercent(a, b string) int {
+	l := max(utf8.RuneCountInString(a), utf8.RuneCountInString(b))
+	if l == 0 {
+		return 0
+	}
+	dmp := diffmatchpatch.New()
+	return min(dmp.DiffLevenshtein(dmp.DiffMain(a, b, false))*100/l, 100)
+}
+
+// TextDiff returns a human-readable, character-level difference between the two given texts, as a list of chunks
+func TextDiff(a, b string) []TextDiffChunk {
+	dmp := diffmatchpatch.New()
+	diffs := dmp.DiffCleanupSemantic(dmp.DiffMain(a, b, false))
+	res := make([]TextDiffChunk, len(diffs))
+	for i, d := range diffs {
+		res[i].Text = d.Text
+		switch d.Type {
+		case diffmatchpatch.DiffInsert:
+			res[i].Op = "insert"
+		case diffmatchpatch.DiffDelete:
+			res[i].Op = "delete"
+		default:
+			res[i].Op = "equal"
+		}
+	}
+	return res
+}
+
 // ToStringSlice converts a slice of string-derived elements into a string slice
 func ToStringSlice[T ~string](in []T) []string {
 	// Don't convert nil
@@ -555,6 +804,42 @@ func ToStringSlice[T ~string](in []T) []string {
 	return res
 }
 
+// TOTPCode returns the TOTP code (RFC 6238) for the given secret and time step counter
+func TOTPCode(secret []byte, counter int64) string {
+	// Calculate an HMAC-SHA1 of the counter
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	h := hmac.New(sha1.New, secret)
+	h.Write(msg[:])
+	sum := h.Sum(nil)
+
+	// Apply dynamic truncation (RFC 4226, section 5.3)
+	offset := sum[len(sum)-1] & 0x0f
+	v := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	// Keep the required number of the least significant digits
+	mod := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTPDigits, v%mod)
+}
+
+// TOTPMatch checks whether the given code is a valid TOTP code for the secret at the given time, tolerating a clock
+// drift of TOTPSkewSteps. Returns the time step counter the code matches
+func TOTPMatch(secret []byte, code string, t time.Time) (int64, bool) {
+	if len(code) != TOTPDigits {
+		return 0, false
+	}
+	cur := t.Unix() / int64(TOTPPeriod/time.Second)
+	for counter := cur - TOTPSkewSteps; counter <= cur+TOTPSkewSteps; counter++ {
+		if hmac.Equal([]byte(TOTPCode(secret, counter)), []byte(code)) {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
 // TruncateStr truncates a string to the given byte length, adding an ellipsis if truncated and possible
 func TruncateStr(s string, maxLen int) string {
 	if len(s) <= maxLen {
@@ -578,6 +863,24 @@ func TruncateStr(s string, maxLen int) string {
 	return s[:maxLen] + suffix
 }
 
+// UpperCaseRatio returns the share of upper-case letters among all cased letters of the given string, as a value
+// between 0 and 1. Returns 0 if there are no cased letters in the string
+func UpperCaseRatio(s string) float64 {
+	upper, total := 0, 0
+	for _, r := range s {
+		if unicode.IsUpper(r) {
+			upper++
+			total++
+		} else if unicode.IsLower(r) {
+			total++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(upper) / float64(total)
+}
+
 // UserAgent return the value of the User-Agent request header
 func UserAgent(r *http.Request) string {
 	return r.Header.Get("User-Agent")
@@ -607,6 +910,30 @@ func UserIP(r *http.Request) string {
 	return ""
 }
 
+// VerifyPublicHost returns an error if the given host is an IP address that isn't public (see IsPublicIP), or a
+// hostname resolving to any such address
+func VerifyPublicHost(host string) error {
+	// If the host is an IP address, check it directly
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		if !IsPublicIP(ip) {
+			return fmt.Errorf("address %s isn't public", ip)
+		}
+		return nil
+	}
+
+	// Otherwise resolve the hostname and check all its addresses
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve host %q: %w", host, err)
+	}
+	for _, ip := range ips {
+		if !IsPublicIP(ip) {
+			return fmt.Errorf("host %q resolves to address %s, which isn't public", host, ip)
+		}
+	}
+	return nil
+}
+
 // UserIPCountry tries to determine the IP address and country code of the user based on it, optionally masking the IP
 func UserIPCountry(r *http.Request, maskIP bool) (ip, country string) {
 	ip = UserIP(r)
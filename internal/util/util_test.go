@@ -5,12 +5,15 @@ import (
 	"encoding/hex"
 	"errors"
 	"github.com/go-openapi/strfmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/mail"
 	"net/url"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 // mustDecode decodes the given hex string into a byte slice, panicking if it fails
@@ -280,6 +283,26 @@ func TestHMACSign(t *testing.T) {
 	}
 }
 
+func TestHashIP(t *testing.T) {
+	key := []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f}
+	tests := []struct {
+		name string
+		ip   string
+		want string
+	}{
+		{"empty", "", ""},
+		{"IPv4 ", "192.168.1.1", "9a9f98d0feaff3d7d2a5c894b51e284ceff73fc7336781645d462b47699f9236"},
+		{"IPv6 ", "2001:db8::1", "5dce28796e2acb4efd7bc8455c617733bc03fff159e749bd7f12f31805dfcccc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HashIP(tt.ip, key); got != tt.want {
+				t.Errorf("HashIP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestHTMLDocumentTitle(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -394,6 +417,40 @@ func TestIndexOfString(t *testing.T) {
 	}
 }
 
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		name string
+		ip   string
+		want bool
+	}{
+		{"nil               ", "", false},
+		{"public IPv4       ", "214.31.117.6", true},
+		{"public IPv6       ", "2a00:1450:4001:80b::200e", true},
+		{"loopback IPv4     ", "127.0.0.1", false},
+		{"loopback IPv6     ", "::1", false},
+		{"unspecified IPv4  ", "0.0.0.0", false},
+		{"unspecified IPv6  ", "::", false},
+		{"private 10/8      ", "10.1.2.3", false},
+		{"private 172.16/12 ", "172.20.0.1", false},
+		{"private 192.168/16", "192.168.1.1", false},
+		{"private IPv6      ", "fd00:ec2::254", false},
+		{"link-local IPv4   ", "169.254.169.254", false},
+		{"link-local IPv6   ", "fe80::1", false},
+		{"multicast         ", "224.0.0.1", false},
+		{"carrier-grade NAT ", "100.64.0.1", false},
+		{"broadcast         ", "255.255.255.255", false},
+		{"IPv4-mapped       ", "::ffff:127.0.0.1", false},
+		{"documentation     ", "2001:db8::1", false},
+	}
+	for _, tt := range tests {
+		t.Run(strings.TrimSpace(tt.name), func(t *testing.T) {
+			if got := IsPublicIP(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("IsPublicIP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestIsStrongPassword(t *testing.T) {
 	tests := []struct {
 		name string
@@ -733,6 +790,88 @@ func TestIsValidURL(t *testing.T) {
 	}
 }
 
+func TestLongestRuneRun(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want int
+	}{
+		{"empty       ", "", 0},
+		{"spaces only ", "      ", 0},
+		{"no repeats  ", "abc def", 1},
+		{"letters     ", "hellooooo world", 5},
+		{"punctuation ", "what?!!!!!!", 6},
+		{"multibyte   ", "ура!!! ааааааа", 7},
+		{"split by sp ", "aaa aaa", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LongestRuneRun(tt.s); got != tt.want {
+				t.Errorf("LongestRuneRun() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMailMessageText(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     string
+		want    string
+		wantErr bool
+	}{
+		{"no content type  ", "Subject: Hi\r\n\r\nHello there", "Hello there", false},
+		{"plain text       ", "Content-Type: text/plain; charset=utf-8\r\n\r\nПривет", "Привет", false},
+		{"quoted-printable ", "Content-Type: text/plain\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\nCaf=C3=A9 =\r\nnoir", "Café noir", false},
+		{"base64           ", "Content-Type: text/plain\r\nContent-Transfer-Encoding: base64\r\n\r\nSGVsbG8g\r\nd29ybGQ=", "Hello world", false},
+		{"latin-1          ", "Content-Type: text/plain; charset=iso-8859-1\r\n\r\nCaf\xe9", "Café", false},
+		{"multipart        ", "Content-Type: multipart/alternative; boundary=xx\r\n\r\n--xx\r\nContent-Type: text/html\r\n\r\n<p>Hi</p>\r\n--xx\r\nContent-Type: text/plain\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\nHi =3D there\r\n--xx--\r\n", "Hi = there", false},
+		{"nested multipart ", "Content-Type: multipart/mixed; boundary=a\r\n\r\n--a\r\nContent-Type: multipart/alternative; boundary=b\r\n\r\n--b\r\nContent-Type: text/plain\r\n\r\nNested\r\n--b--\r\n--a--\r\n", "Nested", false},
+		{"html only        ", "Content-Type: text/html\r\n\r\n<p>Hi</p>", "", true},
+		{"unknown charset  ", "Content-Type: text/plain; charset=koi8-r\r\n\r\nHi", "", true},
+		{"unknown encoding ", "Content-Type: text/plain\r\nContent-Transfer-Encoding: x-uuencode\r\n\r\nHi", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := mail.ReadMessage(strings.NewReader(tt.msg))
+			if err != nil {
+				t.Fatalf("ReadMessage() failed: %v", err)
+			}
+			got, err := MailMessageText(msg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MailMessageText() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("MailMessageText() got = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMainScript(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{"empty     ", "", ""},
+		{"no letters", "123 !?", ""},
+		{"latin     ", "Hello, world", "Latin"},
+		{"cyrillic  ", "Привет, мир", "Cyrillic"},
+		{"greek     ", "Γειά σου Κόσμε", "Greek"},
+		{"mixed     ", "Hello Привет мир", "Cyrillic"},
+		{"han       ", "你好，世界", "Han"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MainScript(tt.s); got != tt.want {
+				t.Errorf("MainScript() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestMarkdownToHTML(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -806,6 +945,74 @@ func TestMaskIP(t *testing.T) {
 	}
 }
 
+func TestParseJWKS(t *testing.T) {
+	const ecKey = `{"kty":"EC","crv":"P-256","kid":"ec","use":"sig",` +
+		`"x":"MKBCTNIcKUSDii11ySs3526iDZ8AiTo7Tu6KPAqv7D4","y":"4Etl6SRW2YiLUrN5vfvVHuhp7x8PxltmWWlbbM4IFyM"}`
+	const rsaKey = `{"kty":"RSA","kid":"rsa","n":"0vx7agoebGcQSuuPiLJXZpt","e":"AQAB"}`
+	tests := []struct {
+		name     string
+		s        string
+		wantKeys map[string]string
+		wantErr  bool
+	}{
+		{"invalid JSON      ", `{`, nil, true},
+		{"no keys           ", `{"keys":[]}`, map[string]string{}, false},
+		{"EC key            ", `{"keys":[` + ecKey + `]}`, map[string]string{"ec": "*ecdsa.PublicKey"}, false},
+		{"RSA key           ", `{"keys":[` + rsaKey + `]}`, map[string]string{"rsa": "*rsa.PublicKey"}, false},
+		{"mixed keys        ", `{"keys":[` + ecKey + `,` + rsaKey + `]}`, map[string]string{"ec": "*ecdsa.PublicKey", "rsa": "*rsa.PublicKey"}, false},
+		{"encryption key    ", `{"keys":[{"kty":"RSA","kid":"enc","use":"enc","n":"AQAB","e":"AQAB"}]}`, map[string]string{}, false},
+		{"unsupported kty   ", `{"keys":[{"kty":"oct","kid":"x","k":"AQAB"}]}`, map[string]string{}, false},
+		{"unsupported curve ", `{"keys":[{"kty":"EC","crv":"secp256k1","kid":"x","x":"AQ","y":"AQ"}]}`, map[string]string{}, false},
+		{"point not on curve", `{"keys":[{"kty":"EC","crv":"P-256","kid":"x","x":"AQ","y":"AQ"}]}`, nil, true},
+		{"bad RSA modulus   ", `{"keys":[{"kty":"RSA","kid":"x","n":"!!","e":"AQAB"}]}`, nil, true},
+		{"empty RSA exponent", `{"keys":[{"kty":"RSA","kid":"x","n":"AQAB","e":""}]}`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseJWKS([]byte(tt.s))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseJWKS() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			gotKeys := make(map[string]string, len(got))
+			for kid, k := range got {
+				gotKeys[kid] = reflect.TypeOf(k).String()
+			}
+			if !reflect.DeepEqual(gotKeys, tt.wantKeys) {
+				t.Errorf("ParseJWKS() = %v, want %v", gotKeys, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want []string
+	}{
+		{"empty string     ", "", nil},
+		{"whitespace only  ", " \t\n ", nil},
+		{"single word      ", "foo", []string{"foo"}},
+		{"multiple words   ", "  foo bar\tbaz ", []string{"foo", "bar", "baz"}},
+		{"phrase           ", `"foo  bar"`, []string{"foo bar"}},
+		{"words and phrases", `foo "bar baz" qux "x"`, []string{"foo", "bar baz", "qux", "x"}},
+		{"adjacent phrase  ", `foo"bar baz"qux`, []string{"foo", "bar baz", "qux"}},
+		{"empty phrase     ", `foo "  " bar`, []string{"foo", "bar"}},
+		{"unterminated     ", `foo "bar baz`, []string{"foo", "bar baz"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseSearchQuery(tt.s); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSearchQuery() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestRandomBytesLength(t *testing.T) {
 	tests := []struct {
 		name string
@@ -869,6 +1076,32 @@ func TestRequestReplacePath(t *testing.T) {
 	}
 }
 
+func TestStripQuotedText(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{"empty               ", "", ""},
+		{"no quote            ", "  Just a reply\n\nWith two paragraphs \n", "Just a reply\n\nWith two paragraphs"},
+		{"quoted lines        ", "Thanks!\n> Original text\n> More", "Thanks!"},
+		{"attribution         ", "Agreed.\r\n\r\nOn Mon, 1 Jan 2024 at 10:00, John Doe <john@example.com> wrote:\r\n> Hello", "Agreed."},
+		{"wrapped attribution ", "Agreed.\n\nOn Mon, 1 Jan 2024 at 10:00, John Doe <\njohn@example.com> wrote:\n\n> Hello", "Agreed."},
+		{"original message    ", "Sure\n-----Original Message-----\nFrom: John", "Sure"},
+		{"outlook headers     ", "Sure\n\nFrom: John Doe\nSent: Monday\nSubject: Hi", "Sure"},
+		{"from without sent   ", "From: my experience\nit works", "From: my experience\nit works"},
+		{"signature           ", "Nice post\n-- \nJohn", "Nice post"},
+		{"quote first         ", "> Hello\nReply", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripQuotedText(tt.s); got != tt.want {
+				t.Errorf("StripQuotedText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestStripPort(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -919,6 +1152,53 @@ func TestStrToFloatDef(t *testing.T) {
 	}
 }
 
+func TestTextChangePercent(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want int
+	}{
+		{"both empty    ", "", "", 0},
+		{"identical     ", "hello world", "hello world", 0},
+		{"added to empty", "", "hello", 100},
+		{"cleared       ", "hello", "", 100},
+		{"one char      ", "hello world", "hello wordl", 18},
+		{"appended      ", "hello", "hello world", 54},
+		{"replaced      ", "abcd", "wxyz", 100},
+		{"multibyte     ", "привет", "привет!!", 25},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TextChangePercent(tt.a, tt.b); got != tt.want {
+				t.Errorf("TextChangePercent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTextDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want []TextDiffChunk
+	}{
+		{"both empty", "", "", []TextDiffChunk{}},
+		{"identical ", "foo", "foo", []TextDiffChunk{{"equal", "foo"}}},
+		{"inserted  ", "foo", "foo bar", []TextDiffChunk{{"equal", "foo"}, {"insert", " bar"}}},
+		{"deleted   ", "foo bar", "bar", []TextDiffChunk{{"delete", "foo "}, {"equal", "bar"}}},
+		{"replaced  ", "the cat sat", "the dog sat", []TextDiffChunk{{"equal", "the "}, {"delete", "cat"}, {"insert", "dog"}, {"equal", " sat"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TextDiff(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TextDiff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestToStringSlice(t *testing.T) {
 	in := []strfmt.UUID{"foo", "", "bar"}
 	want := []string{"foo", "", "bar"}
@@ -929,6 +1209,61 @@ func TestToStringSlice(t *testing.T) {
 	})
 }
 
+func TestTOTPCode(t *testing.T) {
+	// Test vectors from RFC 6238, Appendix B (SHA1), truncated to 6 digits
+	secret := []byte("12345678901234567890")
+	tests := []struct {
+		name    string
+		counter int64
+		want    string
+	}{
+		{"T=59        ", 59 / 30, "287082"},
+		{"T=1111111109", 1111111109 / 30, "081804"},
+		{"T=1111111111", 1111111111 / 30, "050471"},
+		{"T=1234567890", 1234567890 / 30, "005924"},
+		{"T=2000000000", 2000000000 / 30, "279037"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TOTPCode(secret, tt.counter); got != tt.want {
+				t.Errorf("TOTPCode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTOTPMatch(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	tests := []struct {
+		name        string
+		code        string
+		t           time.Time
+		wantCounter int64
+		wantOK      bool
+	}{
+		{"empty code     ", "", time.Unix(59, 0), 0, false},
+		{"too short      ", "28708", time.Unix(59, 0), 0, false},
+		{"too long       ", "2870820", time.Unix(59, 0), 0, false},
+		{"wrong code     ", "123456", time.Unix(59, 0), 0, false},
+		{"current step   ", "081804", time.Unix(1111111109, 0), 37037036, true},
+		{"previous step  ", "081804", time.Unix(1111111109+30, 0), 37037036, true},
+		{"next step      ", "081804", time.Unix(1111111109-30, 0), 37037036, true},
+		{"expired step   ", "081804", time.Unix(1111111109+60, 0), 0, false},
+		{"future step    ", "081804", time.Unix(1111111109-60, 0), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotCounter, gotOK := TOTPMatch(secret, tt.code, tt.t)
+			if gotCounter != tt.wantCounter {
+				t.Errorf("TOTPMatch() got counter = %v, want %v", gotCounter, tt.wantCounter)
+			}
+			if gotOK != tt.wantOK {
+				t.Errorf("TOTPMatch() got ok = %v, want %v", gotOK, tt.wantOK)
+			}
+		})
+	}
+}
+
 func TestTruncateStr(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -977,6 +1312,28 @@ func TestTruncateStr(t *testing.T) {
 	}
 }
 
+func TestUpperCaseRatio(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want float64
+	}{
+		{"empty     ", "", 0},
+		{"no letters", "123 !?", 0},
+		{"lower     ", "hello", 0},
+		{"upper     ", "HELLO!", 1},
+		{"half      ", "HELlo WOrld!", 0.5},
+		{"cyrillic  ", "ПРИвет", 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := UpperCaseRatio(tt.s); got != tt.want {
+				t.Errorf("UpperCaseRatio() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestUserIP(t *testing.T) {
 	tests := []struct {
 		name       string